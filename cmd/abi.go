@@ -0,0 +1,199 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/abi"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/spf13/cobra"
+)
+
+func abiCommand() *cobra.Command {
+	var abiFile string
+	var paramsOnly bool
+	abiCmd := &cobra.Command{
+		Use:   "abi",
+		Short: "Encodes and decodes ABI call data",
+	}
+	abiCmd.PersistentFlags().StringVar(&abiFile, "abi", "", "file containing the JSON ABI of the contract")
+	abiCmd.PersistentFlags().BoolVar(&paramsOnly, "params-only", false, "encode/decode the parameters without the function selector, such as constructor arguments")
+
+	abiCmd.AddCommand(&cobra.Command{
+		Use:   "encode <function> [json]",
+		Short: "Encodes the JSON parameters (an object or array, read from stdin if not supplied) as call data for the function",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			entry, err := readABIFunction(ctx, abiFile, args[0])
+			if err != nil {
+				return err
+			}
+			jsonInput, err := readArgOrStdin(cmd, args, 1)
+			if err != nil {
+				return err
+			}
+			var data []byte
+			if paramsOnly {
+				data, err = entry.Inputs.EncodeABIDataJSONCtx(ctx, jsonInput)
+			} else {
+				data, err = entry.EncodeCallDataJSONCtx(ctx, jsonInput)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), ethtypes.HexBytes0xPrefix(data))
+			return nil
+		},
+	})
+
+	abiCmd.AddCommand(&cobra.Command{
+		Use:   "decode [function] [hex]",
+		Short: "Decodes call data (read from stdin if not supplied) to JSON. The function is found from the selector if not supplied",
+		Args:  cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			a, err := readABI(ctx, abiFile)
+			if err != nil {
+				return err
+			}
+			var entry *abi.Entry
+			if len(args) > 0 {
+				if entry, err = findABIFunction(ctx, a, args[0]); err != nil {
+					return err
+				}
+			}
+			hexInput, err := readArgOrStdin(cmd, args, 1)
+			if err != nil {
+				return err
+			}
+			data, err := ethtypes.NewHexBytes0xPrefix(string(bytes.TrimSpace(hexInput)))
+			if err != nil {
+				return i18n.NewError(ctx, signermsgs.MsgInvalidHexInput, err)
+			}
+			if entry == nil {
+				if paramsOnly {
+					return i18n.NewError(ctx, signermsgs.MsgABIFunctionRequired)
+				}
+				if entry, err = findABIFunctionBySelector(ctx, a, data); err != nil {
+					return err
+				}
+			}
+			var cv *abi.ComponentValue
+			if paramsOnly {
+				cv, err = entry.Inputs.DecodeABIDataCtx(ctx, data, 0)
+			} else {
+				cv, err = entry.DecodeCallDataCtx(ctx, data)
+			}
+			if err != nil {
+				return err
+			}
+			jsonOutput, err := abi.NewSerializer().SetPretty(true).SerializeJSONCtx(ctx, cv)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(jsonOutput))
+			return nil
+		},
+	})
+	return abiCmd
+}
+
+// readArgOrStdin returns the positional argument at the index, or reads stdin if it was not supplied
+func readArgOrStdin(cmd *cobra.Command, args []string, idx int) ([]byte, error) {
+	if len(args) > idx {
+		return []byte(args[idx]), nil
+	}
+	return io.ReadAll(cmd.InOrStdin())
+}
+
+func readABI(ctx context.Context, abiFile string) (abi.ABI, error) {
+	if abiFile == "" {
+		return nil, i18n.NewError(ctx, signermsgs.MsgABIFileRequired)
+	}
+	b, err := os.ReadFile(abiFile)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgReadABIFailed, abiFile, err)
+	}
+	a, err := abi.ParseABI(b)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgReadABIFailed, abiFile, err)
+	}
+	return a, nil
+}
+
+func readABIFunction(ctx context.Context, abiFile, function string) (*abi.Entry, error) {
+	a, err := readABI(ctx, abiFile)
+	if err != nil {
+		return nil, err
+	}
+	return findABIFunction(ctx, a, function)
+}
+
+// findABIFunction finds a function by name, or by signature (such as "transfer(address,uint256)") to
+// choose between overloaded functions. The name "constructor" finds the constructor, for use with --params-only.
+func findABIFunction(ctx context.Context, a abi.ABI, function string) (*abi.Entry, error) {
+	if function == string(abi.Constructor) {
+		if constructor := a.Constructor(); constructor != nil {
+			return constructor, nil
+		}
+	}
+	bySignature := strings.Contains(function, "(")
+	var found *abi.Entry
+	for _, e := range a {
+		if e.Type != abi.Function {
+			continue
+		}
+		if bySignature {
+			if sig, err := e.SignatureCtx(ctx); err == nil && sig == function {
+				return e, nil
+			}
+		} else if e.Name == function {
+			if found != nil {
+				return nil, i18n.NewError(ctx, signermsgs.MsgABIFunctionAmbiguous, function)
+			}
+			found = e
+		}
+	}
+	if found == nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgABIFunctionNotFound, function)
+	}
+	return found, nil
+}
+
+func findABIFunctionBySelector(ctx context.Context, a abi.ABI, data []byte) (*abi.Entry, error) {
+	if len(data) < 4 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgNotEnoughBytesABISignature)
+	}
+	for _, e := range a {
+		if e.Type != abi.Function {
+			continue
+		}
+		if selector, err := e.GenerateFunctionSelectorCtx(ctx); err == nil && bytes.Equal(selector, data[0:4]) {
+			return e, nil
+		}
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgABISelectorNotFound, ethtypes.HexBytes0xPrefix(data[0:4]))
+}
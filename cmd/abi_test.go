@@ -0,0 +1,139 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+const testABI = `[
+	{"type":"constructor","inputs":[{"name":"supply","type":"uint256"}]},
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"type":"bool"}]},
+	{"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}]},
+	{"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"}]},
+	{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true}]}
+]`
+
+const testTransferCallData = "0xa9059cbb" +
+	"0000000000000000000000001f185718734552d08278aa70f804580bab5fd2b4" +
+	"00000000000000000000000000000000000000000000000000000000000003e8"
+
+func writeTestABI(t *testing.T) string {
+	abiFile := path.Join(t.TempDir(), "abi.json")
+	err := os.WriteFile(abiFile, []byte(testABI), 0644)
+	assert.NoError(t, err)
+	return abiFile
+}
+
+func runTestCommand(cmd *cobra.Command, stdin string, args ...string) (string, error) {
+	out := new(bytes.Buffer)
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return strings.TrimSpace(out.String()), err
+}
+
+func TestABIEncodeDecode(t *testing.T) {
+	abiFile := writeTestABI(t)
+
+	out, err := runTestCommand(abiCommand(), "", "encode", "--abi", abiFile, "transfer", `{"to":"0x1f185718734552d08278aa70f804580bab5fd2b4","value":1000}`)
+	assert.NoError(t, err)
+	assert.Equal(t, testTransferCallData, out)
+
+	out, err = runTestCommand(abiCommand(), testTransferCallData+"\n", "decode", "--abi", abiFile)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"to":"1f185718734552d08278aa70f804580bab5fd2b4","value":"1000"}`, out)
+
+	out, err = runTestCommand(abiCommand(), "", "decode", "--abi", abiFile, "transfer", testTransferCallData)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"to":"1f185718734552d08278aa70f804580bab5fd2b4","value":"1000"}`, out)
+}
+
+func TestABIEncodeDecodeParamsOnly(t *testing.T) {
+	abiFile := writeTestABI(t)
+
+	out, err := runTestCommand(abiCommand(), `["0x1f185718734552d08278aa70f804580bab5fd2b4", "1000"]`, "encode", "--abi", abiFile, "--params-only", "transfer")
+	assert.NoError(t, err)
+	assert.Equal(t, "0x"+testTransferCallData[10:], out)
+
+	out, err = runTestCommand(abiCommand(), "", "decode", "--abi", abiFile, "--params-only", "transfer", "0x"+testTransferCallData[10:])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"to":"1f185718734552d08278aa70f804580bab5fd2b4","value":"1000"}`, out)
+
+	out, err = runTestCommand(abiCommand(), "", "encode", "--abi", abiFile, "--params-only", "constructor", `[1000]`)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x"+testTransferCallData[74:], out)
+
+	_, err = runTestCommand(abiCommand(), "", "decode", "--abi", abiFile, "--params-only", "", "0x")
+	assert.Regexp(t, "FF22136", err)
+}
+
+func TestABIOverloadedFunction(t *testing.T) {
+	abiFile := writeTestABI(t)
+
+	_, err := runTestCommand(abiCommand(), "", "encode", "--abi", abiFile, "approve", `["0x1f185718734552d08278aa70f804580bab5fd2b4"]`)
+	assert.Regexp(t, "FF22137", err)
+
+	out, err := runTestCommand(abiCommand(), "", "encode", "--abi", abiFile, "approve(address)", `["0x1f185718734552d08278aa70f804580bab5fd2b4"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xdaea85c5000000000000000000000000"+"1f185718734552d08278aa70f804580bab5fd2b4", out)
+}
+
+func TestABIErrors(t *testing.T) {
+	abiFile := writeTestABI(t)
+	badABIFile := path.Join(t.TempDir(), "bad.json")
+	err := os.WriteFile(badABIFile, []byte(`{}`), 0644)
+	assert.NoError(t, err)
+
+	_, err = runTestCommand(abiCommand(), "", "encode", "transfer", `{}`)
+	assert.Regexp(t, "FF22134", err)
+	_, err = runTestCommand(abiCommand(), "", "encode", "--abi", path.Join(t.TempDir(), "missing.json"), "transfer", `{}`)
+	assert.Regexp(t, "FF22135", err)
+	_, err = runTestCommand(abiCommand(), "", "encode", "--abi", badABIFile, "transfer", `{}`)
+	assert.Regexp(t, "FF22135", err)
+	_, err = runTestCommand(abiCommand(), "", "encode", "--abi", abiFile, "missing", `{}`)
+	assert.Regexp(t, "FF22136", err)
+	_, err = runTestCommand(abiCommand(), "", "encode", "--abi", abiFile, "missing(uint256)", `{}`)
+	assert.Regexp(t, "FF22136", err)
+	_, err = runTestCommand(abiCommand(), "", "encode", "--abi", abiFile, "transfer", `{}`)
+	assert.Error(t, err)
+	_, err = runTestCommand(abiCommand(), "", "encode", "--abi", abiFile, "--params-only", "transfer", `{}`)
+	assert.Error(t, err)
+
+	_, err = runTestCommand(abiCommand(), "", "decode", "--abi", badABIFile, testTransferCallData)
+	assert.Regexp(t, "FF22135", err)
+	_, err = runTestCommand(abiCommand(), "", "decode", "--abi", abiFile, "missing", testTransferCallData)
+	assert.Regexp(t, "FF22136", err)
+	_, err = runTestCommand(abiCommand(), "not hex", "decode", "--abi", abiFile)
+	assert.Regexp(t, "FF22133", err)
+	_, err = runTestCommand(abiCommand(), "0x1234", "decode", "--abi", abiFile)
+	assert.Regexp(t, "FF22048", err)
+	_, err = runTestCommand(abiCommand(), "0x12345678", "decode", "--abi", abiFile)
+	assert.Regexp(t, "FF22138.*0x12345678", err)
+	_, err = runTestCommand(abiCommand(), "0x12345678", "decode", "--abi", abiFile, "--params-only")
+	assert.Regexp(t, "FF22139", err)
+	_, err = runTestCommand(abiCommand(), "", "decode", "--abi", abiFile, "transfer", testTransferCallData[:20])
+	assert.Error(t, err)
+}
@@ -0,0 +1,355 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/spf13/cobra"
+)
+
+// The types of traffic the benchmark drives against the proxy
+const (
+	benchSign = "sign" // eth_signTypedData_v4 - signs without submitting anything to the chain
+	benchSend = "send" // eth_sendTransaction - signs and submits a zero value transfer to the from address
+	benchRead = "read" // a read-only call passed through to the node (eth_blockNumber by default)
+)
+
+var benchTypes = []string{benchSign, benchSend, benchRead}
+
+const benchTypedData = `{
+	"types": {
+		"EIP712Domain": [{"name":"name","type":"string"},{"name":"version","type":"string"},{"name":"chainId","type":"uint256"}],
+		"Bench": [{"name":"sequence","type":"uint256"},{"name":"contents","type":"string"}]
+	},
+	"primaryType": "Bench",
+	"domain": {"name":"ffsigner bench","version":"1","chainId":1},
+	"message": {"sequence":0,"contents":"benchmark"}
+}`
+
+type benchOptions struct {
+	url            string
+	from           string
+	mix            string
+	readMethod     string
+	concurrency    int
+	duration       time.Duration
+	requests       int
+	rate           float64
+	reportInterval time.Duration
+	output         string
+}
+
+// benchStats are the results for one type of traffic, or the total across all types
+type benchStats struct {
+	Type       string  `json:"type"`
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"errorRate"`
+	Throughput float64 `json:"throughput"` // requests per second
+	P50        float64 `json:"p50Ms"`
+	P90        float64 `json:"p90Ms"`
+	P99        float64 `json:"p99Ms"`
+	Max        float64 `json:"maxMs"`
+}
+
+type benchReport struct {
+	Duration float64       `json:"durationSeconds"`
+	Types    []*benchStats `json:"types"`
+	Total    *benchStats   `json:"total"`
+}
+
+type benchWeight struct {
+	benchType string
+	weight    int
+}
+
+// benchRecorder collects the latencies of the requests as they complete, for the interim and final reports
+type benchRecorder struct {
+	mux       sync.Mutex
+	start     time.Time
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func benchCommand() *cobra.Command {
+	opts := &benchOptions{}
+	benchCmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Drives a configurable mix of sign and read traffic against a running proxy, and reports latency percentiles and error rates",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			report, err := runBench(ctx, opts, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			if opts.output != "" {
+				b, _ := json.MarshalIndent(report, "", "  ")
+				if err := os.WriteFile(opts.output, append(b, '\n'), 0644); err != nil {
+					return err
+				}
+			}
+			writeBenchReport(cmd.OutOrStdout(), report)
+			return nil
+		},
+	}
+	benchCmd.Flags().StringVar(&opts.url, "url", "http://127.0.0.1:8545", "URL of the running proxy")
+	benchCmd.Flags().StringVar(&opts.from, "from", "", "address of a key in the proxy's wallet, for sign and send traffic")
+	benchCmd.Flags().StringVar(&opts.mix, "mix", "sign=1,read=1", "relative weights of each type of traffic - sign (eth_signTypedData_v4), send (eth_sendTransaction) and read")
+	benchCmd.Flags().StringVar(&opts.readMethod, "read-method", "eth_blockNumber", "JSON/RPC method with no parameters used for read traffic")
+	benchCmd.Flags().IntVar(&opts.concurrency, "concurrency", 10, "number of requests in flight at once")
+	benchCmd.Flags().DurationVar(&opts.duration, "duration", 30*time.Second, "how long to run for, for a soak test")
+	benchCmd.Flags().IntVar(&opts.requests, "requests", 0, "stop after this many requests, if before the duration (0 for no limit)")
+	benchCmd.Flags().Float64Var(&opts.rate, "rate", 0, "maximum requests per second across all workers (0 for as fast as possible)")
+	benchCmd.Flags().DurationVar(&opts.reportInterval, "report-interval", 10*time.Second, "interval of the interim reports written to stderr during a long run (0 to disable)")
+	benchCmd.Flags().StringVarP(&opts.output, "output", "o", "", "file to also write the final report to as JSON, for comparing between releases")
+	return benchCmd
+}
+
+func parseBenchMix(ctx context.Context, mix string) ([]*benchWeight, int, error) {
+	var weights []*benchWeight
+	total := 0
+	for _, entry := range strings.Split(mix, ",") {
+		benchType, weightStr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		weight, err := strconv.Atoi(weightStr)
+		known := false
+		for _, t := range benchTypes {
+			known = known || t == benchType
+		}
+		if !ok || !known || err != nil || weight < 0 {
+			return nil, 0, i18n.NewError(ctx, signermsgs.MsgBenchBadMix, mix)
+		}
+		if weight > 0 {
+			weights = append(weights, &benchWeight{benchType: benchType, weight: weight})
+			total += weight
+		}
+	}
+	if total == 0 {
+		return nil, 0, i18n.NewError(ctx, signermsgs.MsgBenchBadMix, mix)
+	}
+	return weights, total, nil
+}
+
+func runBench(ctx context.Context, opts *benchOptions, progress io.Writer) (*benchReport, error) {
+	weights, totalWeight, err := parseBenchMix(ctx, opts.mix)
+	if err != nil {
+		return nil, err
+	}
+	var from *ethtypes.Address0xHex
+	for _, w := range weights {
+		if w.benchType != benchRead && from == nil {
+			if opts.from == "" {
+				return nil, i18n.NewError(ctx, signermsgs.MsgBenchFromRequired)
+			}
+			if from, err = ethtypes.NewAddress(opts.from); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var typedData interface{}
+	_ = json.Unmarshal([]byte(benchTypedData), &typedData)
+
+	concurrency := opts.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	backend := rpcbackend.NewRPCClient(ffresty.NewWithConfig(ctx, ffresty.Config{
+		URL: opts.url,
+		HTTPConfig: ffresty.HTTPConfig{
+			HTTPMaxIdleConns:    concurrency,
+			HTTPMaxConnsPerHost: concurrency,
+		},
+	}))
+
+	runCtx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	// The tickets channel hands out the permission to make each request, applying the request limit and rate
+	tickets := make(chan struct{})
+	go func() {
+		defer close(tickets)
+		var ticker *time.Ticker
+		if opts.rate > 0 {
+			ticker = time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+			defer ticker.Stop()
+		}
+		for i := 0; opts.requests <= 0 || i < opts.requests; i++ {
+			if ticker != nil {
+				select {
+				case <-ticker.C:
+				case <-runCtx.Done():
+					return
+				}
+			}
+			select {
+			case tickets <- struct{}{}:
+			case <-runCtx.Done():
+				return
+			}
+		}
+	}()
+
+	recorder := &benchRecorder{
+		start:     time.Now(),
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+	if opts.reportInterval > 0 {
+		go recorder.reportProgress(runCtx, opts.reportInterval, progress)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(time.Now().UnixNano() + int64(worker))) //nolint:gosec // selecting traffic, not security
+			for range tickets {
+				benchType := pickBenchType(random, weights, totalWeight)
+				var result interface{}
+				start := time.Now()
+				var rpcErr *rpcbackend.RPCError
+				switch benchType {
+				case benchSign:
+					rpcErr = backend.CallRPC(ctx, &result, "eth_signTypedData_v4", from, typedData)
+				case benchSend:
+					rpcErr = backend.CallRPC(ctx, &result, "eth_sendTransaction", map[string]interface{}{
+						"from":  from,
+						"to":    from,
+						"value": "0x0",
+						"gas":   "0x5208",
+					})
+				default:
+					rpcErr = backend.CallRPC(ctx, &result, opts.readMethod)
+				}
+				recorder.record(benchType, time.Since(start), rpcErr != nil)
+			}
+		}(worker)
+	}
+	wg.Wait()
+	return recorder.report(), nil
+}
+
+func pickBenchType(random *rand.Rand, weights []*benchWeight, totalWeight int) string {
+	n := random.Intn(totalWeight)
+	for _, w := range weights {
+		if n < w.weight {
+			return w.benchType
+		}
+		n -= w.weight
+	}
+	return weights[len(weights)-1].benchType
+}
+
+func (r *benchRecorder) record(benchType string, latency time.Duration, failed bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.latencies[benchType] = append(r.latencies[benchType], latency)
+	if failed {
+		r.errors[benchType]++
+	}
+}
+
+func (r *benchRecorder) reportProgress(ctx context.Context, interval time.Duration, progress io.Writer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			total := r.report().Total
+			fmt.Fprintf(progress, "%s: %d requests, %.1f/s, %d errors, p99 %.1fms\n",
+				time.Since(r.start).Round(time.Second), total.Requests, total.Throughput, total.Errors, total.P99)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *benchRecorder) report() *benchReport {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	elapsed := time.Since(r.start).Seconds()
+	report := &benchReport{Duration: elapsed}
+	var all []time.Duration
+	totalErrors := 0
+	for _, benchType := range benchTypes {
+		latencies, ok := r.latencies[benchType]
+		if !ok {
+			continue
+		}
+		report.Types = append(report.Types, newBenchStats(benchType, latencies, r.errors[benchType], elapsed))
+		all = append(all, latencies...)
+		totalErrors += r.errors[benchType]
+	}
+	report.Total = newBenchStats("total", all, totalErrors, elapsed)
+	return report
+}
+
+func newBenchStats(benchType string, latencies []time.Duration, errors int, elapsed float64) *benchStats {
+	stats := &benchStats{Type: benchType, Requests: len(latencies), Errors: errors}
+	if len(latencies) == 0 {
+		return stats
+	}
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		idx := int(p*float64(len(sorted))+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return float64(sorted[idx].Microseconds()) / 1000
+	}
+	stats.ErrorRate = float64(errors) / float64(len(latencies))
+	if elapsed > 0 {
+		stats.Throughput = float64(len(latencies)) / elapsed
+	}
+	stats.P50 = percentile(0.50)
+	stats.P90 = percentile(0.90)
+	stats.P99 = percentile(0.99)
+	stats.Max = float64(sorted[len(sorted)-1].Microseconds()) / 1000
+	return stats
+}
+
+func writeBenchReport(out io.Writer, report *benchReport) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "type\trequests\terrors\terror rate\treq/s\tp50 ms\tp90 ms\tp99 ms\tmax ms\t")
+	for _, stats := range append(report.Types, report.Total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f%%\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			stats.Type, stats.Requests, stats.Errors, stats.ErrorRate*100, stats.Throughput, stats.P50, stats.P90, stats.P99, stats.Max)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(out, "duration %.2fs\n", report.Duration)
+}
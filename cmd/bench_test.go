@@ -0,0 +1,135 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBenchProxy is a JSON/RPC server that succeeds for everything other than eth_sendTransaction
+func newTestBenchProxy(t *testing.T) (string, map[string]*int64) {
+	counts := map[string]*int64{
+		"eth_signTypedData_v4": new(int64),
+		"eth_sendTransaction":  new(int64),
+		"eth_blockNumber":      new(int64),
+		"eth_chainId":          new(int64),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		atomic.AddInt64(counts[req.Method], 1)
+		w.Header().Set("Content-Type", "application/json")
+		if req.Method == "eth_sendTransaction" {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32000,"message":"pop"}}`, req.ID)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x1"}`, req.ID)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, counts
+}
+
+func TestBenchRequests(t *testing.T) {
+	url, counts := newTestBenchProxy(t)
+	output := path.Join(t.TempDir(), "report.json")
+
+	out, err := runTestCommand(benchCommand(), "", "--url", url, "--from", "0x1f185718734552d08278aa70f804580bab5fd2b4",
+		"--mix", "sign=1,send=1,read=2", "--requests", "200", "--concurrency", "4", "-o", output)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "total")
+
+	var report benchReport
+	b, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	err = json.Unmarshal(b, &report)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, report.Total.Requests)
+	assert.Len(t, report.Types, 3)
+	for _, stats := range report.Types {
+		switch stats.Type {
+		case benchSend:
+			assert.Equal(t, stats.Requests, stats.Errors)
+			assert.Equal(t, float64(1), stats.ErrorRate)
+		default:
+			assert.Zero(t, stats.Errors)
+		}
+		assert.LessOrEqual(t, stats.P50, stats.P90)
+		assert.LessOrEqual(t, stats.P90, stats.P99)
+		assert.LessOrEqual(t, stats.P99, stats.Max)
+	}
+	assert.Equal(t, int64(200), atomic.LoadInt64(counts["eth_signTypedData_v4"])+
+		atomic.LoadInt64(counts["eth_sendTransaction"])+atomic.LoadInt64(counts["eth_blockNumber"]))
+}
+
+func TestBenchDurationRateAndProgress(t *testing.T) {
+	url, counts := newTestBenchProxy(t)
+
+	progress := new(strings.Builder)
+	report, err := runBench(context.Background(), &benchOptions{
+		url:            url,
+		mix:            "read=1",
+		readMethod:     "eth_chainId",
+		duration:       300 * time.Millisecond,
+		rate:           100,
+		reportInterval: 100 * time.Millisecond,
+	}, progress)
+	assert.NoError(t, err)
+	assert.Len(t, report.Types, 1)
+	assert.Greater(t, report.Total.Requests, 0)
+	assert.LessOrEqual(t, report.Total.Requests, 40)
+	assert.Equal(t, int64(report.Total.Requests), atomic.LoadInt64(counts["eth_chainId"]))
+	assert.Contains(t, progress.String(), "requests")
+}
+
+func TestBenchBadOptions(t *testing.T) {
+	ctx := context.Background()
+
+	for _, mix := range []string{"sign", "sign=x", "wrong=1", "read=-1", "read=0"} {
+		_, err := runBench(ctx, &benchOptions{mix: mix}, nil)
+		assert.Regexp(t, "FF22229", err, mix)
+	}
+
+	_, err := runBench(ctx, &benchOptions{mix: "sign=1"}, nil)
+	assert.Regexp(t, "FF22230", err)
+
+	_, err = runBench(ctx, &benchOptions{mix: "send=1", from: "wrong"}, nil)
+	assert.Regexp(t, "bad address", err)
+
+	_, err = runTestCommand(benchCommand(), "", "--mix", "read=1", "--requests", "1", "--url", "http://127.0.0.1:1", "-o", t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestBenchStatsEmpty(t *testing.T) {
+	stats := newBenchStats("total", nil, 0, 1)
+	assert.Zero(t, stats.Requests)
+	assert.Zero(t, stats.P99)
+}
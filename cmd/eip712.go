@@ -0,0 +1,118 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/signer"
+	"github.com/spf13/cobra"
+)
+
+func eip712Command() *cobra.Command {
+	eip712Cmd := &cobra.Command{
+		Use:   "eip712",
+		Short: "Hashes and signs EIP-712 typed data",
+	}
+
+	eip712Cmd.AddCommand(&cobra.Command{
+		Use:   "hash [file]",
+		Short: "Outputs the EIP-712 digest of the typed data JSON in the file (read from stdin if not supplied)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			payload, err := readTypedData(ctx, cmd, args)
+			if err != nil {
+				return err
+			}
+			digest, err := eip712.EncodeTypedDataV4(ctx, payload)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), digest)
+			return nil
+		},
+	})
+
+	var key string
+	signCmd := &cobra.Command{
+		Use:   "sign --key <address> [file]",
+		Short: "Signs the typed data JSON in the file (read from stdin if not supplied) with a key from the configured wallet, and outputs the digest and signature",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			from, err := ethtypes.NewAddress(key)
+			if err != nil {
+				return err
+			}
+			payload, err := readTypedData(ctx, cmd, args)
+			if err != nil {
+				return err
+			}
+			initConfig()
+			if err := readConfig(ctx); err != nil {
+				return i18n.WrapError(ctx, err, i18n.MsgConfigFailed)
+			}
+			wallet, err := signer.NewWalletFromConfig(ctx)
+			if err != nil {
+				return err
+			}
+			defer wallet.Close()
+			if err := wallet.Initialize(ctx); err != nil {
+				return err
+			}
+			result, err := wallet.SignTypedDataV4(ctx, *from, payload)
+			if err != nil {
+				return err
+			}
+			b, _ := json.MarshalIndent(result, "", "  ")
+			fmt.Fprintln(cmd.OutOrStdout(), string(b))
+			return nil
+		},
+	}
+	signCmd.Flags().StringVar(&key, "key", "", "address of the key in the wallet to sign with")
+	_ = signCmd.MarkFlagRequired("key")
+	eip712Cmd.AddCommand(signCmd)
+	return eip712Cmd
+}
+
+// readTypedData parses the typed data JSON from the file named in the arguments, or from stdin
+func readTypedData(ctx context.Context, cmd *cobra.Command, args []string) (*eip712.TypedData, error) {
+	var b []byte
+	var err error
+	if len(args) > 0 {
+		b, err = os.ReadFile(args[0])
+	} else {
+		b, err = io.ReadAll(cmd.InOrStdin())
+	}
+	if err != nil {
+		return nil, err
+	}
+	var payload eip712.TypedData
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidTypedData, err)
+	}
+	return &payload, nil
+}
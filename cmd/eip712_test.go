@@ -0,0 +1,142 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTypedDataMail = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [{"name": "name","type": "string"},{"name": "wallet","type": "address"}],
+		"Mail": [{"name": "from","type": "Person"},{"name": "to","type": "Person"},{"name": "contents","type": "string"}]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "V4",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+const testTypedDataMailHash = "0xde26f53b35dd5ffdc13f8297e5cc7bbcb1a04bf33803bd2bf4a45eb251360cb8"
+
+// newTestSigningConfig writes a config file for a hex key wallet containing a new key, and sets it as the config file
+func newTestSigningConfig(t *testing.T) *secp256k1.KeyPair {
+	dir := t.TempDir()
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	err = os.WriteFile(path.Join(dir, keypair.Address.String()[2:]+".key"), []byte(fmt.Sprintf("%x", keypair.PrivateKeyBytes())), 0600)
+	assert.NoError(t, err)
+	configFile := path.Join(dir, "ffsigner.yaml")
+	err = os.WriteFile(configFile, []byte(fmt.Sprintf(`
+fileWallet:
+  path: %s
+  disableListener: true
+  keyFormat: hex
+  filenames:
+    primaryExt: .key
+`, dir)), 0600)
+	assert.NoError(t, err)
+	cfgFile = configFile
+	t.Cleanup(func() { cfgFile = "" })
+	return keypair
+}
+
+func TestEIP712Hash(t *testing.T) {
+	out, err := runTestCommand(eip712Command(), testTypedDataMail, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, testTypedDataMailHash, out)
+
+	typedDataFile := path.Join(t.TempDir(), "typed_data.json")
+	err = os.WriteFile(typedDataFile, []byte(testTypedDataMail), 0600)
+	assert.NoError(t, err)
+	out, err = runTestCommand(eip712Command(), "", "hash", typedDataFile)
+	assert.NoError(t, err)
+	assert.Equal(t, testTypedDataMailHash, out)
+}
+
+func TestEIP712HashErrors(t *testing.T) {
+	_, err := runTestCommand(eip712Command(), "not json", "hash")
+	assert.Regexp(t, "FF22142", err)
+	_, err = runTestCommand(eip712Command(), `{"types":{}}`, "hash")
+	assert.Regexp(t, "FF22080", err)
+	_, err = runTestCommand(eip712Command(), "", "hash", path.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestEIP712Sign(t *testing.T) {
+	keypair := newTestSigningConfig(t)
+
+	out, err := runTestCommand(eip712Command(), testTypedDataMail, "sign", "--key", keypair.Address.String())
+	assert.NoError(t, err)
+
+	var result ethsigner.EIP712Result
+	err = json.Unmarshal([]byte(out), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, testTypedDataMailHash, result.Hash.String())
+	sig := &secp256k1.SignatureData{
+		V: result.V.BigInt(),
+		R: new(big.Int).SetBytes(result.R),
+		S: new(big.Int).SetBytes(result.S),
+	}
+	signer, err := sig.RecoverDirect(result.Hash, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, *signer)
+}
+
+func TestEIP712SignErrors(t *testing.T) {
+	keypair := newTestSigningConfig(t)
+
+	_, err := runTestCommand(eip712Command(), testTypedDataMail, "sign")
+	assert.Regexp(t, "key", err)
+	_, err = runTestCommand(eip712Command(), testTypedDataMail, "sign", "--key", "wrong")
+	assert.Regexp(t, "bad address", err)
+	_, err = runTestCommand(eip712Command(), "not json", "sign", "--key", keypair.Address.String())
+	assert.Regexp(t, "FF22142", err)
+	_, err = runTestCommand(eip712Command(), testTypedDataMail, "sign", "--key", "0x1f185718734552d08278aa70f804580bab5fd2b4")
+	assert.Regexp(t, "FF22014", err)
+
+	cfgFile = "../test/bad-config.ffsigner.yaml"
+	_, err = runTestCommand(eip712Command(), testTypedDataMail, "sign", "--key", keypair.Address.String())
+	assert.Regexp(t, "FF00101", err)
+
+	cfgFile = "../test/no-wallet.ffsigner.yaml"
+	_, err = runTestCommand(eip712Command(), testTypedDataMail, "sign", "--key", keypair.Address.String())
+	assert.Regexp(t, "FF22017", err)
+}
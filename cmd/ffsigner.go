@@ -27,15 +27,20 @@ import (
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
 	"github.com/hyperledger/firefly-signer/internal/rpcserver"
+	"github.com/hyperledger/firefly-signer/internal/signedconfig"
 	"github.com/hyperledger/firefly-signer/internal/signerconfig"
-	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/compositewallet"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
 	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/hyperledger/firefly-signer/pkg/signer"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var sigs = make(chan os.Signal, 1)
 
+var reloadSigs = make(chan os.Signal, 1)
+
 var rootCmd = &cobra.Command{
 	Use:   "ffsigner",
 	Short: "Hyperledger FireFly Signer",
@@ -47,10 +52,24 @@ var rootCmd = &cobra.Command{
 
 var cfgFile string
 
+var configSigners []string
+
+var configSignature string
+
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "f", "", "config file")
+	rootCmd.PersistentFlags().StringSliceVar(&configSigners, "config-signers", nil, "addresses of the keys trusted to sign the config file - when set, the config file must have a valid detached signature")
+	rootCmd.PersistentFlags().StringVar(&configSignature, "config-signature", "", "detached signature file for the config file (default is the config file with a .sig extension)")
 	rootCmd.AddCommand(versionCommand())
 	rootCmd.AddCommand(configCommand())
+	rootCmd.AddCommand(encryptPasswordCommand())
+	rootCmd.AddCommand(abiCommand())
+	rootCmd.AddCommand(rlpCommand())
+	rootCmd.AddCommand(eip712Command())
+	rootCmd.AddCommand(stateCommand())
+	rootCmd.AddCommand(testVectorsCommand())
+	rootCmd.AddCommand(migrateCommand())
+	rootCmd.AddCommand(benchCommand())
 }
 
 func Execute() error {
@@ -65,7 +84,7 @@ func initConfig() {
 func run() error {
 
 	initConfig()
-	err := config.ReadConfig("ffsigner", cfgFile)
+	err := readConfig(context.Background())
 
 	// Setup logging after reading config (even if failed), to output header correctly
 	ctx, cancelCtx := context.WithCancel(context.Background())
@@ -74,6 +93,7 @@ func run() error {
 	ctx = log.WithLogger(ctx, logrus.WithField("prefix", "ffsigner"))
 
 	config.SetupLogging(ctx)
+	i18n.SetLang(config.GetString(config.Lang))
 
 	// Deferred error return from reading config
 	if err != nil {
@@ -89,21 +109,76 @@ func run() error {
 		cancelCtx()
 	}()
 
-	if !config.GetBool(signerconfig.FileWalletEnabled) {
-		return i18n.NewError(ctx, signermsgs.MsgNoWalletEnabled)
-	}
-	fileWallet, err := fswallet.NewFilesystemWallet(ctx, fswallet.ReadConfig(signerconfig.FileWalletConfig))
+	wallet, err := signer.NewWalletFromConfig(ctx)
 	if err != nil {
 		return err
 	}
 
-	server, err := rpcserver.NewServer(ctx, fileWallet)
+	// Re-read the configuration on SIGHUP, applying any changes that the wallet supports without a restart
+	if fileWallet, ok := fileWalletOf(wallet); ok {
+		signal.Notify(reloadSigs, syscall.SIGHUP)
+		defer signal.Stop(reloadSigs)
+		go reloadOnSignal(ctx, fileWallet)
+	}
+
+	server, err := rpcserver.NewServer(ctx, wallet)
 	if err != nil {
 		return err
 	}
 	return runServer(server)
 }
 
+// fileWalletOf returns the filesystem wallet, whether on its own or combined with others in a composite wallet
+func fileWalletOf(wallet ethsigner.Wallet) (fswallet.Wallet, bool) {
+	if composite, ok := wallet.(compositewallet.Wallet); ok {
+		for _, m := range composite.Members() {
+			if fileWallet, ok := m.Wallet.(fswallet.Wallet); ok {
+				return fileWallet, true
+			}
+		}
+	}
+	fileWallet, ok := wallet.(fswallet.Wallet)
+	return fileWallet, ok
+}
+
+func reloadOnSignal(ctx context.Context, fileWallet fswallet.Wallet) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-reloadSigs:
+			log.L(ctx).Infof("Reloading configuration due to %s", sig.String())
+			if err := reloadConfig(ctx, fileWallet); err != nil {
+				log.L(ctx).Errorf("Configuration reload failed: %s", err)
+			}
+		}
+	}
+}
+
+func reloadConfig(ctx context.Context, fileWallet fswallet.Wallet) error {
+	if err := readConfig(ctx); err != nil {
+		return i18n.WrapError(ctx, err, i18n.MsgConfigFailed)
+	}
+	return fileWallet.Reload(ctx, fswallet.ReadConfig(signerconfig.FileWalletConfig))
+}
+
+// readConfig reads the config file, first verifying its signature if trusted signers are set
+func readConfig(ctx context.Context) error {
+	if len(configSigners) == 0 {
+		return config.ReadConfig("ffsigner", cfgFile)
+	}
+	trusted, err := signedconfig.ParseSigners(ctx, configSigners)
+	if err != nil {
+		return err
+	}
+	verifiedFile, cleanup, err := signedconfig.VerifyFile(ctx, cfgFile, configSignature, trusted)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return config.ReadConfig("ffsigner", verifiedFile)
+}
+
 func runServer(server rpcserver.Server) error {
 	err := server.Start()
 	if err == nil {
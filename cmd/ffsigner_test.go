@@ -17,12 +17,21 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path"
 	"testing"
 	"time"
 
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/internal/signedconfig"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
 	"github.com/hyperledger/firefly-signer/mocks/rpcservermocks"
+	"github.com/hyperledger/firefly-signer/pkg/compositewallet"
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/hyperledger/firefly-signer/pkg/memwallet"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -59,6 +68,27 @@ func TestRunNoWallet(t *testing.T) {
 
 }
 
+func TestRunMultipleWallets(t *testing.T) {
+
+	rootCmd.SetArgs([]string{"-f", "../test/multiple-wallets.ffsigner.yaml"})
+	defer rootCmd.SetArgs([]string{})
+
+	err := Execute()
+	assert.Regexp(t, "FF22155", err)
+
+}
+
+func TestRunVaultWallet(t *testing.T) {
+
+	rootCmd.SetArgs([]string{"-f", "../test/vault-wallet.ffsigner.yaml"})
+	defer rootCmd.SetArgs([]string{})
+
+	// The wallet is created, and the server then fails to start
+	err := Execute()
+	assert.Regexp(t, "FF00151", err)
+
+}
+
 func TestRunBadConfig(t *testing.T) {
 
 	rootCmd.SetArgs([]string{"-f", "../test/bad-config.ffsigner.yaml"})
@@ -106,3 +136,182 @@ func TestRunServerOK(t *testing.T) {
 	assert.NoError(t, err)
 
 }
+
+func TestRunBadCryptoBackend(t *testing.T) {
+
+	rootCmd.SetArgs([]string{"-f", "../test/bad-crypto.ffsigner.yaml"})
+	defer rootCmd.SetArgs([]string{})
+
+	err := Execute()
+	assert.Regexp(t, "FF22093", err)
+
+}
+
+func TestRunSelfTest(t *testing.T) {
+
+	rootCmd.SetArgs([]string{"-f", "../test/selftest.ffsigner.yaml"})
+	defer rootCmd.SetArgs([]string{})
+
+	// The self-test passes, and the server then fails to start
+	err := Execute()
+	assert.Regexp(t, "FF00151", err)
+
+}
+
+func TestRunBadSelfTestConfig(t *testing.T) {
+
+	rootCmd.SetArgs([]string{"-f", "../test/bad-selftest.ffsigner.yaml"})
+	defer rootCmd.SetArgs([]string{})
+
+	err := Execute()
+	assert.Regexp(t, "FF22157", err)
+
+}
+
+func writeReloadTestConfig(t *testing.T, file, extra string) {
+	err := os.WriteFile(file, []byte(`fileWallet:
+  path: "../test/keystore_toml"
+  disableListener: true
+  filenames:
+    primaryExt: ".toml"
+  metadata:
+    format: auto
+    keyFileProperty: '{{ index .signing "key-file" }}'
+    passwordFileProperty: '{{ index .signing "password-file" }}'
+`+extra), 0644)
+	assert.NoError(t, err)
+}
+
+func TestReloadOnSignal(t *testing.T) {
+
+	cfgFile = path.Join(t.TempDir(), "ffsigner.yaml")
+	defer func() { cfgFile = "" }()
+	writeReloadTestConfig(t, cfgFile, "")
+	signerconfig.Reset()
+	err := config.ReadConfig("ffsigner", cfgFile)
+	assert.NoError(t, err)
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	fileWallet, err := fswallet.NewFilesystemWallet(ctx, fswallet.ReadConfig(signerconfig.FileWalletConfig))
+	assert.NoError(t, err)
+	defer fileWallet.Close()
+
+	writeReloadTestConfig(t, cfgFile, "  defaultPasswordFile: ../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.pwd\n")
+	err = reloadConfig(ctx, fileWallet)
+	assert.NoError(t, err)
+
+	writeReloadTestConfig(t, cfgFile, "  signerCacheSize: 1Mb\n")
+	err = reloadConfig(ctx, fileWallet)
+	assert.Regexp(t, "FF22102", err)
+
+	err = os.WriteFile(cfgFile, []byte("!badness"), 0644)
+	assert.NoError(t, err)
+	err = reloadConfig(ctx, fileWallet)
+	assert.Regexp(t, "FF00101", err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reloadOnSignal(ctx, fileWallet)
+	}()
+	reloadSigs <- os.Interrupt
+	assert.Eventually(t, func() bool { return len(reloadSigs) == 0 }, time.Second, time.Millisecond)
+	cancelCtx()
+	<-done
+
+}
+
+func TestFileWalletOf(t *testing.T) {
+
+	ctx := context.Background()
+	signerconfig.Reset()
+	fileWallet, err := fswallet.NewFilesystemWallet(ctx, fswallet.ReadConfig(signerconfig.FileWalletConfig))
+	assert.NoError(t, err)
+	defer fileWallet.Close()
+	devWallet, err := memwallet.NewDevWallet(ctx, 1)
+	assert.NoError(t, err)
+
+	found, ok := fileWalletOf(fileWallet)
+	assert.True(t, ok)
+	assert.Equal(t, fileWallet, found)
+
+	composite, err := compositewallet.NewCompositeWallet(ctx, &compositewallet.Config{},
+		&compositewallet.Member{Name: "dev", Wallet: devWallet},
+		&compositewallet.Member{Name: "fileWallet", Wallet: fileWallet},
+	)
+	assert.NoError(t, err)
+	found, ok = fileWalletOf(composite)
+	assert.True(t, ok)
+	assert.Equal(t, fileWallet, found)
+
+	_, ok = fileWalletOf(devWallet)
+	assert.False(t, ok)
+
+}
+
+func writeSignedTestConfig(t *testing.T) (string, *secp256k1.KeyPair) {
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	file := path.Join(t.TempDir(), "ffsigner.yaml")
+	writeReloadTestConfig(t, file, "")
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	sig, err := signedconfig.Sign(kp, content)
+	assert.NoError(t, err)
+	err = os.WriteFile(file+signedconfig.DefaultSignatureExt, []byte(sig), 0644)
+	assert.NoError(t, err)
+	return file, kp
+}
+
+func TestRunSignedConfigOK(t *testing.T) {
+
+	file, kp := writeSignedTestConfig(t)
+	rootCmd.SetArgs([]string{"-f", file, "--config-signers", kp.Address.String()})
+	defer func() {
+		rootCmd.SetArgs([]string{})
+		configSigners = nil
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := Execute()
+		if err != nil {
+			assert.Error(t, err)
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	sigs <- os.Kill
+
+	<-done
+
+}
+
+func TestRunSignedConfigUntrusted(t *testing.T) {
+
+	file, _ := writeSignedTestConfig(t)
+	rootCmd.SetArgs([]string{"-f", file, "--config-signers", "0x1f185718734552d08278aa70f804580bab5fd2b4"})
+	defer func() {
+		rootCmd.SetArgs([]string{})
+		configSigners = nil
+	}()
+
+	err := Execute()
+	assert.Regexp(t, "FF00101.*FF22105", err)
+
+}
+
+func TestRunSignedConfigBadSigner(t *testing.T) {
+
+	file, _ := writeSignedTestConfig(t)
+	rootCmd.SetArgs([]string{"-f", file, "--config-signers", "wrong"})
+	defer func() {
+		rootCmd.SetArgs([]string{})
+		configSigners = nil
+	}()
+
+	err := Execute()
+	assert.Regexp(t, "FF00101.*FF22107", err)
+
+}
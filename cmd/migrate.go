@@ -0,0 +1,160 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/hyperledger/firefly-signer/pkg/signer"
+	"github.com/spf13/cobra"
+)
+
+// accountMigrationReport compares the accounts the upstream node signs for with those in the wallet, for a
+// staged migration of keys from the node to the signer. All lists are sorted by address.
+type accountMigrationReport struct {
+	NodeAccounts   []*ethtypes.Address0xHex `json:"nodeAccounts"`
+	WalletAccounts []*ethtypes.Address0xHex `json:"walletAccounts"`
+	Migrated       []*ethtypes.Address0xHex `json:"migrated"`   // on the node and in the wallet, so the signer signs for them
+	NodeOnly       []*ethtypes.Address0xHex `json:"nodeOnly"`   // still require node-side signing
+	WalletOnly     []*ethtypes.Address0xHex `json:"walletOnly"` // only in the wallet
+}
+
+func migrateCommand() *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Assists a staged migration from keys managed by the upstream node to the signer",
+	}
+	migrateCmd.AddCommand(migrateAccountsCommand())
+	return migrateCmd
+}
+
+func migrateAccountsCommand() *cobra.Command {
+	var output string
+	var nodeOnly bool
+	accountsCmd := &cobra.Command{
+		Use:   "accounts",
+		Short: "Compares the accounts of the upstream node (eth_accounts) with the configured wallet, and reports which still require node-side signing",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := compareNodeAccounts(context.Background())
+			if err != nil {
+				return err
+			}
+			var b []byte
+			if nodeOnly {
+				// One address per line, for scripting the remaining migrations
+				var sb strings.Builder
+				for _, a := range report.NodeOnly {
+					sb.WriteString(a.String())
+					sb.WriteByte('\n')
+				}
+				b = []byte(sb.String())
+			} else {
+				b, _ = json.MarshalIndent(report, "", "  ")
+				b = append(b, '\n')
+			}
+			if output == "" {
+				fmt.Fprint(cmd.OutOrStdout(), string(b))
+				return nil
+			}
+			return os.WriteFile(output, b, 0600)
+		},
+	}
+	accountsCmd.Flags().StringVarP(&output, "output", "o", "", "file to write the report to (default is stdout)")
+	accountsCmd.Flags().BoolVar(&nodeOnly, "node-only", false, "output only the addresses that still require node-side signing, one per line")
+	return accountsCmd
+}
+
+func compareNodeAccounts(ctx context.Context) (*accountMigrationReport, error) {
+	initConfig()
+	if err := readConfig(ctx); err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgConfigFailed)
+	}
+
+	wallet, err := signer.NewWalletFromConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer wallet.Close()
+	if err := wallet.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	walletAccounts, err := wallet.GetAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := ffresty.New(ctx, signerconfig.BackendConfig)
+	if err != nil {
+		return nil, err
+	}
+	var nodeAccounts []*ethtypes.Address0xHex
+	if rpcErr := rpcbackend.NewRPCClient(httpClient).CallRPC(ctx, &nodeAccounts, "eth_accounts"); rpcErr != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgRPCRequestFailed, rpcErr.Message)
+	}
+
+	return buildAccountMigrationReport(nodeAccounts, walletAccounts), nil
+}
+
+func buildAccountMigrationReport(nodeAccounts, walletAccounts []*ethtypes.Address0xHex) *accountMigrationReport {
+	inWallet := make(map[ethtypes.Address0xHex]bool, len(walletAccounts))
+	for _, a := range walletAccounts {
+		inWallet[*a] = true
+	}
+	onNode := make(map[ethtypes.Address0xHex]bool, len(nodeAccounts))
+	for _, a := range nodeAccounts {
+		onNode[*a] = true
+	}
+	report := &accountMigrationReport{
+		NodeAccounts:   sortAddresses(nodeAccounts),
+		WalletAccounts: sortAddresses(walletAccounts),
+		Migrated:       []*ethtypes.Address0xHex{},
+		NodeOnly:       []*ethtypes.Address0xHex{},
+		WalletOnly:     []*ethtypes.Address0xHex{},
+	}
+	for _, a := range report.NodeAccounts {
+		if inWallet[*a] {
+			report.Migrated = append(report.Migrated, a)
+		} else {
+			report.NodeOnly = append(report.NodeOnly, a)
+		}
+	}
+	for _, a := range report.WalletAccounts {
+		if !onNode[*a] {
+			report.WalletOnly = append(report.WalletOnly, a)
+		}
+	}
+	return report
+}
+
+func sortAddresses(addresses []*ethtypes.Address0xHex) []*ethtypes.Address0xHex {
+	sorted := make([]*ethtypes.Address0xHex, len(addresses))
+	copy(sorted, addresses)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+	return sorted
+}
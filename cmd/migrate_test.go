@@ -0,0 +1,135 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMigrateConfig writes a config file for a hex key wallet containing the keys, with a backend
+// that returns the node accounts from eth_accounts
+func newTestMigrateConfig(t *testing.T, walletKeys []*secp256k1.KeyPair, nodeAccounts string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, "eth_accounts", req.Method)
+		w.Header().Set("Content-Type", "application/json")
+		if nodeAccounts == "" {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32601,"message":"method not available"}}`, req.ID)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, nodeAccounts)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	for _, keypair := range walletKeys {
+		err := os.WriteFile(path.Join(dir, keypair.Address.String()[2:]+".key"), []byte(fmt.Sprintf("%x", keypair.PrivateKeyBytes())), 0600)
+		assert.NoError(t, err)
+	}
+	configFile := path.Join(dir, "ffsigner.yaml")
+	err := os.WriteFile(configFile, []byte(fmt.Sprintf(`
+fileWallet:
+  path: %s
+  disableListener: true
+  keyFormat: hex
+  filenames:
+    primaryExt: .key
+backend:
+  url: %s
+  retry:
+    enabled: false
+`, dir, server.URL)), 0600)
+	assert.NoError(t, err)
+	cfgFile = configFile
+	t.Cleanup(func() { cfgFile = "" })
+}
+
+func TestMigrateAccountsReport(t *testing.T) {
+	migrated, _ := secp256k1.GenerateSecp256k1KeyPair()
+	walletOnly, _ := secp256k1.GenerateSecp256k1KeyPair()
+	nodeOnly, _ := secp256k1.GenerateSecp256k1KeyPair()
+	newTestMigrateConfig(t, []*secp256k1.KeyPair{migrated, walletOnly},
+		fmt.Sprintf(`["%s","%s"]`, strings.ToUpper(migrated.Address.String()[2:]), nodeOnly.Address))
+
+	out, err := runTestCommand(migrateCommand(), "", "accounts")
+	assert.NoError(t, err)
+
+	var report accountMigrationReport
+	err = json.Unmarshal([]byte(out), &report)
+	assert.NoError(t, err)
+	assert.Len(t, report.NodeAccounts, 2)
+	assert.Len(t, report.WalletAccounts, 2)
+	assert.Len(t, report.Migrated, 1)
+	assert.Equal(t, migrated.Address, *report.Migrated[0])
+	assert.Len(t, report.NodeOnly, 1)
+	assert.Equal(t, nodeOnly.Address, *report.NodeOnly[0])
+	assert.Len(t, report.WalletOnly, 1)
+	assert.Equal(t, walletOnly.Address, *report.WalletOnly[0])
+
+	out, err = runTestCommand(migrateCommand(), "", "accounts", "--node-only")
+	assert.NoError(t, err)
+	assert.Equal(t, nodeOnly.Address.String(), out)
+
+	output := path.Join(t.TempDir(), "report.json")
+	out, err = runTestCommand(migrateCommand(), "", "accounts", "-o", output)
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+	b, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"nodeOnly"`)
+}
+
+func TestMigrateAccountsAllMigrated(t *testing.T) {
+	keypair, _ := secp256k1.GenerateSecp256k1KeyPair()
+	newTestMigrateConfig(t, []*secp256k1.KeyPair{keypair}, fmt.Sprintf(`["%s"]`, keypair.Address))
+
+	out, err := runTestCommand(migrateCommand(), "", "accounts", "--node-only")
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestMigrateAccountsNodeError(t *testing.T) {
+	newTestMigrateConfig(t, nil, "")
+
+	_, err := runTestCommand(migrateCommand(), "", "accounts")
+	assert.Regexp(t, "FF22012.*method not available", err)
+}
+
+func TestMigrateAccountsConfigErrors(t *testing.T) {
+	cfgFile = "../test/bad-config.ffsigner.yaml"
+	t.Cleanup(func() { cfgFile = "" })
+	_, err := runTestCommand(migrateCommand(), "", "accounts")
+	assert.Regexp(t, "FF00101", err)
+
+	cfgFile = "../test/no-wallet.ffsigner.yaml"
+	_, err = runTestCommand(migrateCommand(), "", "accounts")
+	assert.Regexp(t, "FF22017", err)
+}
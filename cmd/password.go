@@ -0,0 +1,63 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/spf13/cobra"
+)
+
+func encryptPasswordCommand() *cobra.Command {
+	var conf fswallet.PasswordEncryptionConfig
+	encryptCmd := &cobra.Command{
+		Use:   "encrypt-password",
+		Short: "Encrypts a password read from stdin under a master key, for use as a password file with fileWallet.passwordEncryption",
+		Long:  "",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			masterKey, err := fswallet.ReadMasterKey(ctx, &conf)
+			if err != nil {
+				return err
+			}
+			if masterKey == nil {
+				return i18n.NewError(ctx, signermsgs.MsgMasterKeyNotConfigured)
+			}
+			password, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			// A trailing newline, from echo or a terminal, is not part of the password
+			password = []byte(strings.TrimRight(string(password), "\r\n"))
+			encrypted, err := fswallet.EncryptPassword(masterKey, password)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), encrypted)
+			return nil
+		},
+	}
+	encryptCmd.Flags().StringVar(&conf.MasterKeyFile, "master-key-file", "", "file containing the hex encoded master key")
+	encryptCmd.Flags().StringVar(&conf.MasterKeyEnv, "master-key-env", "", "environment variable containing the hex encoded master key")
+	return encryptCmd
+}
@@ -0,0 +1,71 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptPasswordCmd(t *testing.T) {
+	masterKey := bytes.Repeat([]byte{0xab}, fswallet.MasterKeyLength)
+	masterKeyFile := path.Join(t.TempDir(), "master.key")
+	err := os.WriteFile(masterKeyFile, []byte(hex.EncodeToString(masterKey)), 0600)
+	assert.NoError(t, err)
+
+	cmd := encryptPasswordCommand()
+	out := new(bytes.Buffer)
+	cmd.SetIn(strings.NewReader("my-secret\n"))
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--master-key-file", masterKeyFile})
+	err = cmd.Execute()
+	assert.NoError(t, err)
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out.String()))
+	assert.NoError(t, err)
+	block, err := aes.NewCipher(masterKey)
+	assert.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	assert.NoError(t, err)
+	password, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-secret", string(password))
+}
+
+func TestEncryptPasswordCmdNoMasterKey(t *testing.T) {
+	cmd := encryptPasswordCommand()
+	cmd.SetArgs([]string{})
+	err := cmd.Execute()
+	assert.Regexp(t, "FF22132", err)
+}
+
+func TestEncryptPasswordCmdBadMasterKey(t *testing.T) {
+	cmd := encryptPasswordCommand()
+	cmd.SetArgs([]string{"--master-key-env", "UT_MASTER_KEY_NOT_SET"})
+	err := cmd.Execute()
+	assert.Regexp(t, "FF22128", err)
+}
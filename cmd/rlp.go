@@ -0,0 +1,127 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/spf13/cobra"
+)
+
+// RLP elements are represented in JSON as 0x prefixed hex strings for data, and arrays for lists
+
+func rlpCommand() *cobra.Command {
+	rlpCmd := &cobra.Command{
+		Use:   "rlp",
+		Short: "Encodes and decodes RLP data, represented in JSON as nested arrays of 0x prefixed hex strings",
+	}
+
+	rlpCmd.AddCommand(&cobra.Command{
+		Use:   "encode [json]",
+		Short: "Encodes JSON (read from stdin if not supplied) as RLP",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			jsonInput, err := readArgOrStdin(cmd, args, 0)
+			if err != nil {
+				return err
+			}
+			var value interface{}
+			if err := json.Unmarshal(jsonInput, &value); err != nil {
+				return i18n.NewError(ctx, signermsgs.MsgInvalidRLPJSON, "$", err)
+			}
+			element, err := jsonToRLP(ctx, "$", value)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), ethtypes.HexBytes0xPrefix(element.Encode()))
+			return nil
+		},
+	})
+
+	rlpCmd.AddCommand(&cobra.Command{
+		Use:   "decode [hex]",
+		Short: "Decodes RLP (read from stdin if not supplied) to JSON",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			hexInput, err := readArgOrStdin(cmd, args, 0)
+			if err != nil {
+				return err
+			}
+			data, err := ethtypes.NewHexBytes0xPrefix(string(bytes.TrimSpace(hexInput)))
+			if err != nil {
+				return i18n.NewError(ctx, signermsgs.MsgInvalidHexInput, err)
+			}
+			element, endPos, err := rlp.Decode(data)
+			if err != nil {
+				return err
+			}
+			if endPos < len(data) {
+				return i18n.NewError(ctx, signermsgs.MsgRLPTrailingData, len(data)-endPos)
+			}
+			jsonOutput, _ := json.MarshalIndent(rlpToJSON(element), "", "  ")
+			fmt.Fprintln(cmd.OutOrStdout(), string(jsonOutput))
+			return nil
+		},
+	})
+	return rlpCmd
+}
+
+func jsonToRLP(ctx context.Context, breadcrumbs string, value interface{}) (rlp.Element, error) {
+	switch v := value.(type) {
+	case string:
+		data, err := rlp.WrapHex(v)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgInvalidRLPJSON, breadcrumbs, err)
+		}
+		return data, nil
+	case []interface{}:
+		list := make(rlp.List, len(v))
+		for i, entry := range v {
+			var err error
+			if list[i], err = jsonToRLP(ctx, fmt.Sprintf("%s[%d]", breadcrumbs, i), entry); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidRLPJSON, breadcrumbs, fmt.Sprintf("unexpected %T", value))
+	}
+}
+
+func rlpToJSON(element rlp.Element) interface{} {
+	if element == nil {
+		return nil
+	}
+	if element.IsList() {
+		list := element.(rlp.List)
+		values := make([]interface{}, len(list))
+		for i, entry := range list {
+			values[i] = rlpToJSON(entry)
+		}
+		return values
+	}
+	return ethtypes.HexBytes0xPrefix(element.(rlp.Data)).String()
+}
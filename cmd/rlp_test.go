@@ -0,0 +1,55 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRLPEncodeDecode(t *testing.T) {
+	out, err := runTestCommand(rlpCommand(), "", "encode", `["0x636174", ["0x646f67", "0x"], "0x0400"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xcd83636174c583646f6780820400", out)
+
+	out, err = runTestCommand(rlpCommand(), out+"\n", "decode")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["0x636174", ["0x646f67", "0x"], "0x0400"]`, out)
+
+	out, err = runTestCommand(rlpCommand(), "", "decode", "0x")
+	assert.NoError(t, err)
+	assert.Equal(t, "null", out)
+}
+
+func TestRLPEncodeErrors(t *testing.T) {
+	_, err := runTestCommand(rlpCommand(), "", "encode", `not json`)
+	assert.Regexp(t, `FF22140.*\$`, err)
+	_, err = runTestCommand(rlpCommand(), "", "encode", `["0x01", [12345]]`)
+	assert.Regexp(t, `FF22140.*\$\[1\]\[0\]`, err)
+	_, err = runTestCommand(rlpCommand(), "", "encode", `["0xzz"]`)
+	assert.Regexp(t, `FF22140.*\$\[0\]`, err)
+}
+
+func TestRLPDecodeErrors(t *testing.T) {
+	_, err := runTestCommand(rlpCommand(), "", "decode", "not hex")
+	assert.Regexp(t, "FF22133", err)
+	_, err = runTestCommand(rlpCommand(), "", "decode", "0xc5")
+	assert.Error(t, err)
+	_, err = runTestCommand(rlpCommand(), "", "decode", "0x0102")
+	assert.Regexp(t, "FF22141", err)
+}
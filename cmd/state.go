@@ -0,0 +1,137 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/redisnonce"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/spf13/cobra"
+)
+
+const stateArchiveVersion = 1
+
+// stateArchive is the portable form of the operational state of a signer, used to move it to another instance
+type stateArchive struct {
+	Version int                      `json:"version"`
+	Nonces  []*redisnonce.NonceState `json:"nonces"`
+}
+
+func stateCommand() *cobra.Command {
+	stateCmd := &cobra.Command{
+		Use:   "state",
+		Short: "Exports and imports the operational state of the signer, to move it to another instance",
+		Long:  "",
+	}
+	stateCmd.AddCommand(stateExportCommand())
+	stateCmd.AddCommand(stateImportCommand())
+	return stateCmd
+}
+
+func stateExportCommand() *cobra.Command {
+	var output string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Writes the operational state of the signer to a JSON archive",
+		Long:  "",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			nonces, err := stateNonceManager(ctx)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = nonces.Close() }()
+			archive := &stateArchive{Version: stateArchiveVersion}
+			if archive.Nonces, err = nonces.ExportNonces(ctx); err != nil {
+				return err
+			}
+			b, _ := json.MarshalIndent(archive, "", "  ")
+			if output == "" {
+				fmt.Fprintln(cmd.OutOrStdout(), string(b))
+				return nil
+			}
+			return os.WriteFile(output, b, 0600)
+		},
+	}
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "file to write the archive to (default is stdout)")
+	return exportCmd
+}
+
+func stateImportCommand() *cobra.Command {
+	var input string
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Restores the operational state of the signer from a JSON archive written by export",
+		Long:  "",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			var b []byte
+			var err error
+			if input == "" {
+				b, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				b, err = os.ReadFile(input)
+			}
+			if err != nil {
+				return err
+			}
+			var archive stateArchive
+			if err := json.Unmarshal(b, &archive); err != nil {
+				return err
+			}
+			if archive.Version != stateArchiveVersion {
+				return i18n.NewError(ctx, signermsgs.MsgStateArchiveBadVersion, archive.Version)
+			}
+			nonces, err := stateNonceManager(ctx)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = nonces.Close() }()
+			if err := nonces.ImportNonces(ctx, archive.Nonces); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Imported %d nonces\n", len(archive.Nonces))
+			return nil
+		},
+	}
+	importCmd.Flags().StringVarP(&input, "input", "i", "", "file to read the archive from (default is stdin)")
+	return importCmd
+}
+
+// stateNonceManager connects to the Redis server of the configured instance, which holds its nonce state
+func stateNonceManager(ctx context.Context) (redisnonce.Manager, error) {
+	initConfig()
+	if err := readConfig(ctx); err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgConfigFailed)
+	}
+	if !config.GetBool(signerconfig.RedisEnabled) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgStateArchiveNoState)
+	}
+	return redisnonce.NewManager(ctx, &redisnonce.Config{
+		URL:       config.GetString(signerconfig.RedisURL),
+		KeyPrefix: config.GetString(signerconfig.RedisKeyPrefix),
+		NonceTTL:  config.GetDuration(signerconfig.RedisNonceTTL),
+	})
+}
@@ -0,0 +1,165 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStateConfig(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	cfgFile = path.Join(t.TempDir(), "ffsigner.yaml")
+	t.Cleanup(func() { cfgFile = "" })
+	err := os.WriteFile(cfgFile, []byte(fmt.Sprintf("redis:\n  enabled: true\n  url: redis://%s\n", mr.Addr())), 0600)
+	assert.NoError(t, err)
+	return mr
+}
+
+func TestStateExportImport(t *testing.T) {
+
+	mr := newTestStateConfig(t)
+	err := mr.Set("ffsigner:nonce:1:0xfb075bb99f2aa4c49955bf703509a227d7a12248", "10")
+	assert.NoError(t, err)
+
+	archiveFile := path.Join(t.TempDir(), "state.json")
+	cmd := stateCommand()
+	cmd.SetArgs([]string{"export", "-o", archiveFile})
+	err = cmd.Execute()
+	assert.NoError(t, err)
+
+	// Import into another instance, with its own Redis
+	mr2 := newTestStateConfig(t)
+	cmd = stateCommand()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"import", "-i", archiveFile})
+	err = cmd.Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "Imported 1 nonces\n", out.String())
+	val, err := mr2.Get("ffsigner:nonce:1:0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", val)
+
+}
+
+func TestStateExportImportStdio(t *testing.T) {
+
+	newTestStateConfig(t)
+
+	cmd := stateCommand()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"export"})
+	err := cmd.Execute()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"version":1,"nonces":[]}`, out.String())
+
+	cmd = stateCommand()
+	cmd.SetIn(strings.NewReader(out.String()))
+	cmd.SetArgs([]string{"import"})
+	err = cmd.Execute()
+	assert.NoError(t, err)
+
+}
+
+func TestStateExportNoRedis(t *testing.T) {
+
+	cfgFile = "../test/firefly.ffsigner.yaml"
+	defer func() { cfgFile = "" }()
+	cmd := stateCommand()
+	cmd.SetArgs([]string{"export"})
+	err := cmd.Execute()
+	assert.Regexp(t, "FF22185", err)
+
+}
+
+func TestStateExportBadConfig(t *testing.T) {
+
+	cfgFile = "../test/bad-config.ffsigner.yaml"
+	defer func() { cfgFile = "" }()
+	cmd := stateCommand()
+	cmd.SetArgs([]string{"export"})
+	err := cmd.Execute()
+	assert.Regexp(t, "FF00101", err)
+
+}
+
+func TestStateExportFail(t *testing.T) {
+
+	mr := newTestStateConfig(t)
+	mr.SetError("pop")
+	cmd := stateCommand()
+	cmd.SetArgs([]string{"export"})
+	err := cmd.Execute()
+	assert.Regexp(t, "FF22146", err)
+
+}
+
+func TestStateImportBadArchive(t *testing.T) {
+
+	newTestStateConfig(t)
+
+	cmd := stateCommand()
+	cmd.SetArgs([]string{"import", "-i", path.Join(t.TempDir(), "missing.json")})
+	err := cmd.Execute()
+	assert.Error(t, err)
+
+	cmd = stateCommand()
+	cmd.SetIn(strings.NewReader("!json"))
+	cmd.SetArgs([]string{"import"})
+	err = cmd.Execute()
+	assert.Error(t, err)
+
+	cmd = stateCommand()
+	cmd.SetIn(strings.NewReader(`{"version":99}`))
+	cmd.SetArgs([]string{"import"})
+	err = cmd.Execute()
+	assert.Regexp(t, "FF22186", err)
+
+}
+
+func TestStateImportNoRedis(t *testing.T) {
+
+	cfgFile = "../test/firefly.ffsigner.yaml"
+	defer func() { cfgFile = "" }()
+	cmd := stateCommand()
+	cmd.SetIn(strings.NewReader(`{"version":1}`))
+	cmd.SetArgs([]string{"import"})
+	err := cmd.Execute()
+	assert.Regexp(t, "FF22185", err)
+
+}
+
+func TestStateImportFail(t *testing.T) {
+
+	newTestStateConfig(t)
+
+	cmd := stateCommand()
+	cmd.SetIn(strings.NewReader(`{"version":1,"nonces":[{"chainId":"wrong","address":"0xfb075bb99f2aa4c49955bf703509a227d7a12248","nonce":1}]}`))
+	cmd.SetArgs([]string{"import"})
+	err := cmd.Execute()
+	assert.Regexp(t, "FF22184", err)
+
+}
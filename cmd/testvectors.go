@@ -0,0 +1,397 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/hyperledger/firefly-signer/pkg/abi"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/sha3"
+)
+
+const testVectorsVersion = 1
+
+// testVectors is a corpus of inputs, and the outputs this module produces for them, so that the FireFly SDKs
+// in other languages can assert they are byte-for-byte compatible. Every output is deterministic - signatures
+// use RFC 6979 nonces - so the corpus only changes when the inputs below change.
+type testVectors struct {
+	Version      int                      `json:"version"`
+	ABI          []*abiTestVector         `json:"abi"`
+	RLP          []*rlpTestVector         `json:"rlp"`
+	EIP712       []*eip712TestVector      `json:"eip712"`
+	Transactions []*transactionTestVector `json:"transactions"`
+}
+
+type abiTestVector struct {
+	Name      string                    `json:"name"`
+	Function  json.RawMessage           `json:"function"`
+	Signature string                    `json:"signature"`
+	Selector  ethtypes.HexBytes0xPrefix `json:"selector"`
+	Params    json.RawMessage           `json:"params"`
+	CallData  ethtypes.HexBytes0xPrefix `json:"callData"`
+	Decoded   json.RawMessage           `json:"decoded"`
+}
+
+type rlpTestVector struct {
+	Name    string                    `json:"name"`
+	Value   interface{}               `json:"value"`
+	Encoded ethtypes.HexBytes0xPrefix `json:"encoded"`
+}
+
+type eip712TestVector struct {
+	Name       string                    `json:"name"`
+	PrivateKey ethtypes.HexBytes0xPrefix `json:"privateKey"`
+	Address    ethtypes.Address0xHex     `json:"address"`
+	TypedData  json.RawMessage           `json:"typedData"`
+	Result     *ethsigner.EIP712Result   `json:"result"`
+}
+
+type transactionTestVector struct {
+	Name        string                    `json:"name"`
+	Type        string                    `json:"type"`
+	ChainID     *ethtypes.HexInteger      `json:"chainId,omitempty"`
+	PrivateKey  ethtypes.HexBytes0xPrefix `json:"privateKey"`
+	Address     ethtypes.Address0xHex     `json:"address"`
+	Transaction *ethsigner.Transaction    `json:"transaction"`
+	SigningHash ethtypes.HexBytes0xPrefix `json:"signingHash"`
+	Signed      ethtypes.HexBytes0xPrefix `json:"signed"`
+	Hash        ethtypes.HexBytes0xPrefix `json:"hash"`
+}
+
+const (
+	testVectorTxLegacy = "legacy"
+	testVectorTxEIP155 = "eip155"
+	testVectorTx1559   = "eip1559"
+)
+
+var abiTestVectorInputs = []struct{ name, function, params string }{
+	{
+		name:     "static types",
+		function: `{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}]}`,
+		params:   `{"to":"0x1f185718734552d08278aa70f804580bab5fd2b4","value":"1000000000000000000"}`,
+	},
+	{
+		name:     "signed integers, booleans and fixed bytes",
+		function: `{"type":"function","name":"set","inputs":[{"name":"a","type":"int8"},{"name":"b","type":"int256"},{"name":"c","type":"bool"},{"name":"d","type":"bytes32"}]}`,
+		params:   `{"a":-1,"b":"-12345678901234567890","c":true,"d":"0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"}`,
+	},
+	{
+		name:     "dynamic types",
+		function: `{"type":"function","name":"setData","inputs":[{"name":"label","type":"string"},{"name":"data","type":"bytes"},{"name":"values","type":"uint256[]"}]}`,
+		params:   `{"label":"hello world","data":"0xfeedbeef","values":[1,2,3]}`,
+	},
+	{
+		name:     "fixed size arrays",
+		function: `{"type":"function","name":"setArrays","inputs":[{"name":"values","type":"uint16[3]"},{"name":"names","type":"string[2]"}]}`,
+		params:   `{"values":[1,65535,256],"names":["one","two"]}`,
+	},
+	{
+		name:     "tuple arrays",
+		function: `{"type":"function","name":"submit","inputs":[{"name":"orders","type":"tuple[]","components":[{"name":"owner","type":"address"},{"name":"ids","type":"uint64[]"},{"name":"label","type":"string"}]},{"name":"tag","type":"bytes4"}]}`,
+		params:   `{"orders":[{"owner":"0x1f185718734552d08278aa70f804580bab5fd2b4","ids":[1,2],"label":"first"},{"owner":"0x497eedc4299dea2f2a364be10025d0ad0f702de3","ids":[],"label":""}],"tag":"0xcafebabe"}`,
+	},
+}
+
+var rlpTestVectorInputs = []struct {
+	name  string
+	value interface{}
+}{
+	{name: "empty string", value: "0x"},
+	{name: "single byte below 0x80", value: "0x7f"},
+	{name: "single byte 0x80", value: "0x80"},
+	{name: "short string", value: "0x646f67"},
+	{name: "55 byte string", value: "0x" + strings.Repeat("61", 55)},
+	{name: "56 byte string", value: "0x" + strings.Repeat("61", 56)},
+	{name: "1024 byte string", value: "0x" + strings.Repeat("62", 1024)},
+	{name: "integer 1024", value: "0x0400"},
+	{name: "empty list", value: []interface{}{}},
+	{name: "list of strings", value: []interface{}{"0x636174", "0x646f67"}},
+	{name: "nested lists", value: []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}, []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}}}},
+	{name: "long list", value: []interface{}{"0x" + strings.Repeat("63", 30), "0x" + strings.Repeat("64", 30)}},
+}
+
+var eip712TestVectorInputs = []struct{ name, key, typedData string }{
+	{
+		// The example from the EIP-712 specification, signed with the key keccak256("cow")
+		name: "mail",
+		key:  "cow",
+		typedData: `{
+			"types": {
+				"EIP712Domain": [{"name":"name","type":"string"},{"name":"version","type":"string"},{"name":"chainId","type":"uint256"},{"name":"verifyingContract","type":"address"}],
+				"Person": [{"name":"name","type":"string"},{"name":"wallet","type":"address"}],
+				"Mail": [{"name":"from","type":"Person"},{"name":"to","type":"Person"},{"name":"contents","type":"string"}]
+			},
+			"primaryType": "Mail",
+			"domain": {"name":"Ether Mail","version":"1","chainId":1,"verifyingContract":"0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"},
+			"message": {
+				"from": {"name":"Cow","wallet":"0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+				"to": {"name":"Bob","wallet":"0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+				"contents": "Hello, Bob!"
+			}
+		}`,
+	},
+	{
+		name: "erc2612 permit",
+		key:  "firefly-signer test vector 1",
+		typedData: `{
+			"types": {
+				"EIP712Domain": [{"name":"name","type":"string"},{"name":"version","type":"string"},{"name":"chainId","type":"uint256"},{"name":"verifyingContract","type":"address"}],
+				"Permit": [{"name":"owner","type":"address"},{"name":"spender","type":"address"},{"name":"value","type":"uint256"},{"name":"nonce","type":"uint256"},{"name":"deadline","type":"uint256"}]
+			},
+			"primaryType": "Permit",
+			"domain": {"name":"Token","version":"1","chainId":1337,"verifyingContract":"0x1f185718734552d08278aa70f804580bab5fd2b4"},
+			"message": {
+				"owner": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+				"spender": "0x5d093e9b41911be5f5c4cf91b108bac5d130fa83",
+				"value": "115792089237316195423570985008687907853269984665640564039457584007913129639935",
+				"nonce": 0,
+				"deadline": 1700000000
+			}
+		}`,
+	},
+	{
+		name: "arrays and dynamic types",
+		key:  "firefly-signer test vector 2",
+		typedData: `{
+			"types": {
+				"EIP712Domain": [{"name":"name","type":"string"},{"name":"salt","type":"bytes32"}],
+				"Item": [{"name":"id","type":"uint64"},{"name":"payload","type":"bytes"},{"name":"tags","type":"string[]"}],
+				"Order": [{"name":"items","type":"Item[]"},{"name":"approved","type":"bool"},{"name":"delta","type":"int32"}]
+			},
+			"primaryType": "Order",
+			"domain": {"name":"Orders","salt":"0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"},
+			"message": {
+				"items": [
+					{"id":1,"payload":"0xfeedbeef","tags":["a","b"]},
+					{"id":2,"payload":"0x","tags":[]}
+				],
+				"approved": true,
+				"delta": -42
+			}
+		}`,
+	},
+}
+
+var transactionTestVectorInputs = []struct {
+	name, txType, key, tx string
+	chainID               int64
+}{
+	{
+		name:   "legacy without chain ID",
+		txType: testVectorTxLegacy,
+		key:    "firefly-signer test vector 1",
+		tx:     `{"nonce":"0x0","gasPrice":"0x4a817c800","gas":"0x5208","to":"0x3535353535353535353535353535353535353535","value":"0xde0b6b3a7640000","data":"0x"}`,
+	},
+	{
+		// The example from the EIP-155 specification, signed with the private key 0x4646...46
+		name:    "eip155 specification example",
+		txType:  testVectorTxEIP155,
+		key:     "0x4646464646464646464646464646464646464646464646464646464646464646",
+		chainID: 1,
+		tx:      `{"nonce":"0x9","gasPrice":"0x4a817c800","gas":"0x5208","to":"0x3535353535353535353535353535353535353535","value":"0xde0b6b3a7640000","data":"0x"}`,
+	},
+	{
+		name:    "eip155 large chain ID with call data",
+		txType:  testVectorTxEIP155,
+		key:     "firefly-signer test vector 2",
+		chainID: 4294967295,
+		tx:      `{"nonce":"0x100","gasPrice":"0x0","gas":"0xf4240","to":"0x1f185718734552d08278aa70f804580bab5fd2b4","value":"0x0","data":"0xa9059cbb000000000000000000000000497eedc4299dea2f2a364be10025d0ad0f702de300000000000000000000000000000000000000000000000000000000000003e8"}`,
+	},
+	{
+		name:    "eip1559 transfer",
+		txType:  testVectorTx1559,
+		key:     "firefly-signer test vector 1",
+		chainID: 1,
+		tx:      `{"nonce":"0x1","maxPriorityFeePerGas":"0x3b9aca00","maxFeePerGas":"0x6fc23ac00","gas":"0x5208","to":"0x3535353535353535353535353535353535353535","value":"0x1","data":"0x"}`,
+	},
+	{
+		name:    "eip1559 contract deployment",
+		txType:  testVectorTx1559,
+		key:     "firefly-signer test vector 3",
+		chainID: 1337,
+		tx:      `{"nonce":"0x0","maxPriorityFeePerGas":"0x0","maxFeePerGas":"0x0","gas":"0x1e8480","value":"0x0","data":"0x6080604052348015600f57600080fd5b50603f80601d6000396000f3fe6080604052600080fdfea164736f6c6343000811000a"}`,
+	},
+}
+
+func testVectorsCommand() *cobra.Command {
+	var output string
+	testVectorsCmd := &cobra.Command{
+		Use:   "testvectors",
+		Short: "Generates a JSON corpus of ABI, RLP, EIP-712 and transaction signing inputs and outputs, for SDKs in other languages to test compatibility against",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vectors, err := generateTestVectors(context.Background())
+			if err != nil {
+				return err
+			}
+			b, _ := json.MarshalIndent(vectors, "", "  ")
+			if output == "" {
+				fmt.Fprintln(cmd.OutOrStdout(), string(b))
+				return nil
+			}
+			return os.WriteFile(output, append(b, '\n'), 0644)
+		},
+	}
+	testVectorsCmd.Flags().StringVarP(&output, "output", "o", "", "file to write the corpus to (default is stdout)")
+	return testVectorsCmd
+}
+
+func generateTestVectors(ctx context.Context) (*testVectors, error) {
+	vectors := &testVectors{Version: testVectorsVersion}
+	for _, in := range abiTestVectorInputs {
+		v, err := generateABITestVector(ctx, in.name, in.function, in.params)
+		if err != nil {
+			return nil, err
+		}
+		vectors.ABI = append(vectors.ABI, v)
+	}
+	for _, in := range rlpTestVectorInputs {
+		element, err := jsonToRLP(ctx, "$", in.value)
+		if err != nil {
+			return nil, err
+		}
+		vectors.RLP = append(vectors.RLP, &rlpTestVector{Name: in.name, Value: in.value, Encoded: element.Encode()})
+	}
+	for _, in := range eip712TestVectorInputs {
+		v, err := generateEIP712TestVector(ctx, in.name, in.key, in.typedData)
+		if err != nil {
+			return nil, err
+		}
+		vectors.EIP712 = append(vectors.EIP712, v)
+	}
+	for _, in := range transactionTestVectorInputs {
+		v, err := generateTransactionTestVector(in.name, in.txType, in.key, in.tx, in.chainID)
+		if err != nil {
+			return nil, err
+		}
+		vectors.Transactions = append(vectors.Transactions, v)
+	}
+	return vectors, nil
+}
+
+// testVectorKey is the private key for a vector - either the key itself in hex, or the keccak256 hash of a label
+func testVectorKey(key string) (*secp256k1.KeyPair, error) {
+	if strings.HasPrefix(key, "0x") {
+		b, err := ethtypes.NewHexBytes0xPrefix(key)
+		if err != nil {
+			return nil, err
+		}
+		return secp256k1.NewSecp256k1KeyPair(b)
+	}
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(key))
+	return secp256k1.NewSecp256k1KeyPair(hash.Sum(nil))
+}
+
+func generateABITestVector(ctx context.Context, name, function, params string) (*abiTestVector, error) {
+	var entry abi.Entry
+	if err := json.Unmarshal([]byte(function), &entry); err != nil {
+		return nil, err
+	}
+	v := &abiTestVector{Name: name, Function: json.RawMessage(function), Params: json.RawMessage(params)}
+	var err error
+	if v.Signature, err = entry.SignatureCtx(ctx); err != nil {
+		return nil, err
+	}
+	if v.Selector, err = entry.GenerateFunctionSelectorCtx(ctx); err != nil {
+		return nil, err
+	}
+	if v.CallData, err = entry.EncodeCallDataJSONCtx(ctx, []byte(params)); err != nil {
+		return nil, err
+	}
+	cv, err := entry.DecodeCallDataCtx(ctx, v.CallData)
+	if err != nil {
+		return nil, err
+	}
+	if v.Decoded, err = abi.NewSerializer().SerializeJSONCtx(ctx, cv); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func generateEIP712TestVector(ctx context.Context, name, key, typedData string) (*eip712TestVector, error) {
+	keypair, err := testVectorKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var payload eip712.TypedData
+	if err := json.Unmarshal([]byte(typedData), &payload); err != nil {
+		return nil, err
+	}
+	result, err := ethsigner.SignTypedDataV4(ctx, keypair, &payload)
+	if err != nil {
+		return nil, err
+	}
+	// The typed data is re-marshaled, so the corpus does not include the indentation of the input
+	compacted, _ := json.Marshal(&payload)
+	return &eip712TestVector{
+		Name:       name,
+		PrivateKey: keypair.PrivateKeyBytes(),
+		Address:    keypair.Address,
+		TypedData:  compacted,
+		Result:     result,
+	}, nil
+}
+
+func generateTransactionTestVector(name, txType, key, txJSON string, chainID int64) (*transactionTestVector, error) {
+	keypair, err := testVectorKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var tx ethsigner.Transaction
+	if err := json.Unmarshal([]byte(txJSON), &tx); err != nil {
+		return nil, err
+	}
+	v := &transactionTestVector{
+		Name:        name,
+		Type:        txType,
+		PrivateKey:  keypair.PrivateKeyBytes(),
+		Address:     keypair.Address,
+		Transaction: &tx,
+	}
+	bigChainID := big.NewInt(chainID)
+	switch txType {
+	case testVectorTxLegacy:
+		v.SigningHash = tx.SignaturePayloadLegacyOriginal().Hash()
+		v.Signed, err = tx.SignLegacyOriginal(keypair)
+	case testVectorTxEIP155:
+		v.ChainID = (*ethtypes.HexInteger)(bigChainID)
+		v.SigningHash = tx.SignaturePayloadLegacyEIP155Big(bigChainID).Hash()
+		v.Signed, err = tx.SignLegacyEIP155Big(keypair, bigChainID)
+	default:
+		v.ChainID = (*ethtypes.HexInteger)(bigChainID)
+		v.SigningHash = tx.SignaturePayloadEIP1559Big(bigChainID).Hash()
+		v.Signed, err = tx.SignEIP1559Big(keypair, bigChainID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(v.Signed)
+	v.Hash = hash.Sum(nil)
+	return v, nil
+}
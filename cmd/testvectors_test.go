@@ -0,0 +1,135 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/abi"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestVectorsKnownAnswers(t *testing.T) {
+	out, err := runTestCommand(testVectorsCommand(), "")
+	assert.NoError(t, err)
+
+	var vectors testVectors
+	err = json.Unmarshal([]byte(out), &vectors)
+	assert.NoError(t, err)
+	assert.Equal(t, testVectorsVersion, vectors.Version)
+	assert.Len(t, vectors.ABI, len(abiTestVectorInputs))
+	assert.Len(t, vectors.RLP, len(rlpTestVectorInputs))
+	assert.Len(t, vectors.EIP712, len(eip712TestVectorInputs))
+	assert.Len(t, vectors.Transactions, len(transactionTestVectorInputs))
+
+	// From the EIP-712 and EIP-155 specifications
+	assert.Equal(t, "0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2", vectors.EIP712[0].Result.Hash.String())
+	assert.Equal(t, "0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c", vectors.EIP712[0].Result.SignatureRSV.String())
+	assert.Equal(t, "0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826", vectors.EIP712[0].Address.String())
+	assert.Equal(t, "0xdaf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53", vectors.Transactions[1].SigningHash.String())
+	assert.Equal(t, "0xf86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83", vectors.Transactions[1].Signed.String())
+}
+
+func TestTestVectorsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	vectors, err := generateTestVectors(ctx)
+	assert.NoError(t, err)
+
+	for _, v := range vectors.ABI {
+		var entry abi.Entry
+		err := json.Unmarshal(v.Function, &entry)
+		assert.NoError(t, err)
+		cv, err := entry.DecodeCallDataCtx(ctx, v.CallData)
+		assert.NoError(t, err, v.Name)
+		decoded, err := abi.NewSerializer().SerializeJSONCtx(ctx, cv)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(v.Decoded), string(decoded), v.Name)
+	}
+
+	for _, v := range vectors.RLP {
+		element, endPos, err := rlp.Decode(v.Encoded)
+		assert.NoError(t, err, v.Name)
+		assert.Equal(t, len(v.Encoded), endPos, v.Name)
+		expected, _ := json.Marshal(v.Value)
+		actual, _ := json.Marshal(rlpToJSON(element))
+		assert.JSONEq(t, string(expected), string(actual), v.Name)
+	}
+
+	for _, v := range vectors.Transactions {
+		chainID := int64(-1)
+		if v.ChainID != nil {
+			chainID = v.ChainID.Int64()
+		}
+		addr, tx, err := ethsigner.RecoverRawTransaction(ctx, v.Signed, chainID)
+		assert.NoError(t, err, v.Name)
+		assert.Equal(t, v.Address.String(), addr.String(), v.Name)
+		assert.True(t, v.Transaction.Equal(tx.Transaction), v.Name)
+	}
+
+	// The output is the same every time it is generated
+	again, err := generateTestVectors(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, vectors, again)
+}
+
+func TestTestVectorsOutputFile(t *testing.T) {
+	output := path.Join(t.TempDir(), "vectors.json")
+	out, err := runTestCommand(testVectorsCommand(), "", "-o", output)
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+
+	b, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	stdout, err := runTestCommand(testVectorsCommand(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, stdout+"\n", string(b))
+
+	_, err = runTestCommand(testVectorsCommand(), "", "-o", path.Join(output, "not-a-dir", "vectors.json"))
+	assert.Error(t, err)
+}
+
+func TestTestVectorsBadInputs(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := testVectorKey("0xzz")
+	assert.Error(t, err)
+
+	_, err = generateABITestVector(ctx, "bad", `!json`, `{}`)
+	assert.Error(t, err)
+	_, err = generateABITestVector(ctx, "bad", `{"type":"function","name":"f","inputs":[{"type":"wrong"}]}`, `{}`)
+	assert.Error(t, err)
+	_, err = generateABITestVector(ctx, "bad", `{"type":"function","name":"f","inputs":[{"name":"a","type":"uint8"}]}`, `{"a":256}`)
+	assert.Error(t, err)
+
+	_, err = generateEIP712TestVector(ctx, "bad", "0xzz", `{}`)
+	assert.Error(t, err)
+	_, err = generateEIP712TestVector(ctx, "bad", "key", `!json`)
+	assert.Error(t, err)
+	_, err = generateEIP712TestVector(ctx, "bad", "key", `{"primaryType":"Missing"}`)
+	assert.Error(t, err)
+
+	_, err = generateTransactionTestVector("bad", testVectorTxLegacy, "0xzz", `{}`, 0)
+	assert.Error(t, err)
+	_, err = generateTransactionTestVector("bad", testVectorTxLegacy, "key", `!json`, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,265 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package escrow implements export of signing keys for escrow, encrypted to a recipient's public key,
+// only once a threshold of the configured approvers have each signed an approval of the specific
+// request (key, recipient and request ID). Every step is written to the audit log.
+package escrow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signedconfig"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/sirupsen/logrus"
+)
+
+// Manager tracks export requests, and their approvals, in memory. Requests do not survive a restart.
+type Manager interface {
+	// CreateExport starts a request to export the key for the address, encrypted to the recipient public key
+	CreateExport(ctx context.Context, addr ethtypes.Address0xHex, recipient ethtypes.HexBytes0xPrefix) (*ExportRequest, error)
+	// GetExport returns the current state of a request
+	GetExport(ctx context.Context, id string) (*ExportRequest, error)
+	// Approve records an approver's EIP-191 signature over the request's approval message
+	Approve(ctx context.Context, id string, signature ethtypes.HexBytes0xPrefix) (*ExportRequest, error)
+	// Export returns the encrypted key, once the request has the required approvals. Each request can only be exported once.
+	Export(ctx context.Context, id string) (*ExportResult, error)
+}
+
+// KeySource is implemented by wallets that can provide the key for an address
+type KeySource interface {
+	GetWalletFile(ctx context.Context, addr ethtypes.Address0xHex) (keystorev3.WalletFile, error)
+}
+
+type Config struct {
+	Approvers      []*ethtypes.Address0xHex
+	Threshold      int
+	RequestTimeout time.Duration
+}
+
+type ExportRequest struct {
+	ID        string                    `json:"id"`
+	Address   ethtypes.Address0xHex     `json:"address"`
+	Recipient ethtypes.HexBytes0xPrefix `json:"recipient"`
+	Message   string                    `json:"message"` // the message each approver signs (EIP-191) to approve the request
+	Created   *fftypes.FFTime           `json:"created"`
+	Expires   *fftypes.FFTime           `json:"expires"`
+	Threshold int                       `json:"threshold"`
+	Approvals []*ethtypes.Address0xHex  `json:"approvals"`
+	Exported  bool                      `json:"exported"`
+}
+
+type ExportResult struct {
+	ID           string                    `json:"id"`
+	Address      ethtypes.Address0xHex     `json:"address"`
+	Recipient    ethtypes.HexBytes0xPrefix `json:"recipient"`
+	EncryptedKey ethtypes.HexBytes0xPrefix `json:"encryptedKey"` // see secp256k1.Encrypt for the format
+}
+
+type exportRequest struct {
+	ExportRequest
+	recipient *btcec.PublicKey
+	expires   time.Time
+}
+
+type escrowManager struct {
+	conf      Config
+	approvers map[ethtypes.Address0xHex]bool
+	keys      KeySource
+
+	mux      sync.Mutex
+	requests map[string]*exportRequest
+}
+
+func NewManager(ctx context.Context, conf *Config, keys KeySource) (Manager, error) {
+	if conf.Threshold < 1 || conf.Threshold > len(conf.Approvers) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowBadThreshold, conf.Threshold, len(conf.Approvers))
+	}
+	m := &escrowManager{
+		conf:      *conf,
+		approvers: make(map[ethtypes.Address0xHex]bool),
+		keys:      keys,
+		requests:  make(map[string]*exportRequest),
+	}
+	for _, a := range conf.Approvers {
+		m.approvers[*a] = true
+	}
+	return m, nil
+}
+
+func audit(ctx context.Context, event string, req *ExportRequest) *logrus.Entry {
+	return log.L(ctx).WithFields(logrus.Fields{
+		"audit":     "escrow",
+		"event":     event,
+		"request":   req.ID,
+		"address":   req.Address.String(),
+		"recipient": req.Recipient.String(),
+	})
+}
+
+func ffTime(t time.Time) *fftypes.FFTime {
+	ft := fftypes.FFTime(t)
+	return &ft
+}
+
+// approvalMessage is the text approvers sign, binding the approval to the request, key and recipient
+func approvalMessage(id string, addr ethtypes.Address0xHex, recipient ethtypes.HexBytes0xPrefix) string {
+	return fmt.Sprintf("Approve ffsigner escrow export request %s of the key for %s, encrypted to %s", id, addr, recipient)
+}
+
+func (m *escrowManager) CreateExport(ctx context.Context, addr ethtypes.Address0xHex, recipient ethtypes.HexBytes0xPrefix) (*ExportRequest, error) {
+	recipientKey, err := btcec.ParsePubKey(recipient)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowBadRecipient, err)
+	}
+	// The compressed form is used consistently in the approval message, however the key was supplied
+	recipient = recipientKey.SerializeCompressed()
+	now := time.Now()
+	req := &exportRequest{
+		ExportRequest: ExportRequest{
+			ID:        fftypes.NewUUID().String(),
+			Address:   addr,
+			Recipient: recipient,
+			Created:   ffTime(now),
+			Threshold: m.conf.Threshold,
+			Approvals: []*ethtypes.Address0xHex{},
+		},
+		recipient: recipientKey,
+		expires:   now.Add(m.conf.RequestTimeout),
+	}
+	req.Message = approvalMessage(req.ID, addr, recipient)
+	req.Expires = ffTime(req.expires)
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.pruneExpired(now)
+	m.requests[req.ID] = req
+	audit(ctx, "requested", &req.ExportRequest).Infof("Escrow export of key for %s requested", addr)
+	return m.copyRequest(req), nil
+}
+
+// pruneExpired must be called with the lock held
+func (m *escrowManager) pruneExpired(now time.Time) {
+	for id, req := range m.requests {
+		if now.After(req.expires) {
+			delete(m.requests, id)
+		}
+	}
+}
+
+// copyRequest must be called with the lock held
+func (m *escrowManager) copyRequest(req *exportRequest) *ExportRequest {
+	r := req.ExportRequest
+	r.Approvals = append([]*ethtypes.Address0xHex{}, req.Approvals...)
+	return &r
+}
+
+// getRequest must be called with the lock held
+func (m *escrowManager) getRequest(ctx context.Context, id string) (*exportRequest, error) {
+	req := m.requests[id]
+	if req == nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowRequestNotFound, id)
+	}
+	if time.Now().After(req.expires) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowRequestExpired, id)
+	}
+	return req, nil
+}
+
+func (m *escrowManager) GetExport(ctx context.Context, id string) (*ExportRequest, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	req, err := m.getRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.copyRequest(req), nil
+}
+
+func (m *escrowManager) Approve(ctx context.Context, id string, signature ethtypes.HexBytes0xPrefix) (*ExportRequest, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	req, err := m.getRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := secp256k1.DecodeCompactRSV(ctx, signature)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowBadApproval, id, err)
+	}
+	approver, err := sig.RecoverDirect(signedconfig.MessageHash([]byte(req.Message)), 0)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowBadApproval, id, err)
+	}
+	if !m.approvers[*approver] {
+		audit(ctx, "approval_rejected", &req.ExportRequest).WithField("approver", approver.String()).Warnf("Escrow approval from %s rejected: not an approver", approver)
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowNotApprover, approver)
+	}
+	for _, a := range req.Approvals {
+		if *a == *approver {
+			return m.copyRequest(req), nil // approvals are idempotent
+		}
+	}
+	req.Approvals = append(req.Approvals, approver)
+	audit(ctx, "approved", &req.ExportRequest).WithField("approver", approver.String()).Infof("Escrow export approved by %s (%d of %d)", approver, len(req.Approvals), req.Threshold)
+	return m.copyRequest(req), nil
+}
+
+// Export holds the lock while loading the key, so two calls for the same request cannot both export it
+func (m *escrowManager) Export(ctx context.Context, id string) (*ExportResult, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	req, err := m.getRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Exported {
+		audit(ctx, "export_rejected", &req.ExportRequest).Warnf("Escrow export rejected: already exported")
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowAlreadyExported, id)
+	}
+	if len(req.Approvals) < req.Threshold {
+		audit(ctx, "export_rejected", &req.ExportRequest).Warnf("Escrow export rejected: %d of %d approvals", len(req.Approvals), req.Threshold)
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowNotApproved, id, len(req.Approvals), req.Threshold)
+	}
+	wf, err := m.keys.GetWalletFile(ctx, req.Address)
+	if err != nil {
+		audit(ctx, "export_failed", &req.ExportRequest).Errorf("Escrow export failed: %s", err)
+		return nil, err
+	}
+	encryptedKey, err := secp256k1.Encrypt(req.recipient, wf.KeyPair().PrivateKeyBytes())
+	if err != nil {
+		audit(ctx, "export_failed", &req.ExportRequest).Errorf("Escrow export failed: %s", err)
+		return nil, i18n.NewError(ctx, signermsgs.MsgEscrowExportFailed, req.Address, err)
+	}
+	req.Exported = true
+	audit(ctx, "exported", &req.ExportRequest).Infof("Key for %s exported for escrow, with approvals from %v", req.Address, req.Approvals)
+	return &ExportResult{
+		ID:           req.ID,
+		Address:      req.Address,
+		Recipient:    req.Recipient,
+		EncryptedKey: encryptedKey,
+	}, nil
+}
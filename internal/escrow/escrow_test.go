@@ -0,0 +1,209 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package escrow
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-signer/internal/signedconfig"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+type testKeySource struct {
+	keys map[ethtypes.Address0xHex]*secp256k1.KeyPair
+}
+
+func (ks *testKeySource) GetWalletFile(ctx context.Context, addr ethtypes.Address0xHex) (keystorev3.WalletFile, error) {
+	kp := ks.keys[addr]
+	if kp == nil {
+		return nil, fmt.Errorf("pop")
+	}
+	return keystorev3.NewWalletFileLight("", kp), nil
+}
+
+func newTestManager(t *testing.T, threshold int) (*escrowManager, []*secp256k1.KeyPair, *secp256k1.KeyPair) {
+	approverKeys := make([]*secp256k1.KeyPair, 3)
+	approvers := make([]*ethtypes.Address0xHex, 3)
+	for i := range approverKeys {
+		kp, err := secp256k1.GenerateSecp256k1KeyPair()
+		assert.NoError(t, err)
+		approverKeys[i] = kp
+		approvers[i] = &kp.Address
+	}
+	key, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	m, err := NewManager(context.Background(), &Config{
+		Approvers:      approvers,
+		Threshold:      threshold,
+		RequestTimeout: 1 * time.Hour,
+	}, &testKeySource{keys: map[ethtypes.Address0xHex]*secp256k1.KeyPair{key.Address: key}})
+	assert.NoError(t, err)
+	return m.(*escrowManager), approverKeys, key
+}
+
+func approve(t *testing.T, kp *secp256k1.KeyPair, req *ExportRequest) ethtypes.HexBytes0xPrefix {
+	sig, err := signedconfig.Sign(kp, []byte(req.Message))
+	assert.NoError(t, err)
+	return ethtypes.MustNewHexBytes0xPrefix(sig)
+}
+
+func TestEscrowExportOK(t *testing.T) {
+	ctx := context.Background()
+	m, approvers, key := newTestManager(t, 2)
+	recipient, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	req, err := m.CreateExport(ctx, key.Address, recipient.PublicKey.SerializeCompressed())
+	assert.NoError(t, err)
+	assert.Contains(t, req.Message, req.ID)
+	assert.Contains(t, req.Message, key.Address.String())
+
+	_, err = m.Export(ctx, req.ID)
+	assert.Regexp(t, "FF22112.*0 of the 2", err)
+
+	req, err = m.Approve(ctx, req.ID, approve(t, approvers[0], req))
+	assert.NoError(t, err)
+	assert.Len(t, req.Approvals, 1)
+
+	// Repeat approvals by the same approver do not count twice
+	req, err = m.Approve(ctx, req.ID, approve(t, approvers[0], req))
+	assert.NoError(t, err)
+	assert.Len(t, req.Approvals, 1)
+	_, err = m.Export(ctx, req.ID)
+	assert.Regexp(t, "FF22112.*1 of the 2", err)
+
+	_, err = m.Approve(ctx, req.ID, approve(t, approvers[2], req))
+	assert.NoError(t, err)
+
+	res, err := m.Export(ctx, req.ID)
+	assert.NoError(t, err)
+	decrypted, err := recipient.Decrypt(res.EncryptedKey)
+	assert.NoError(t, err)
+	assert.Equal(t, key.PrivateKeyBytes(), decrypted)
+
+	req, err = m.GetExport(ctx, req.ID)
+	assert.NoError(t, err)
+	assert.True(t, req.Exported)
+
+	_, err = m.Export(ctx, req.ID)
+	assert.Regexp(t, "FF22114", err)
+}
+
+func TestEscrowBadThreshold(t *testing.T) {
+	_, err := NewManager(context.Background(), &Config{Threshold: 1}, &testKeySource{})
+	assert.Regexp(t, "FF22115", err)
+}
+
+func TestEscrowBadRecipient(t *testing.T) {
+	m, _, key := newTestManager(t, 1)
+	_, err := m.CreateExport(context.Background(), key.Address, []byte{0x01})
+	assert.Regexp(t, "FF22109", err)
+}
+
+func TestEscrowNotFound(t *testing.T) {
+	ctx := context.Background()
+	m, _, _ := newTestManager(t, 1)
+	_, err := m.GetExport(ctx, "unknown")
+	assert.Regexp(t, "FF22108", err)
+	_, err = m.Approve(ctx, "unknown", nil)
+	assert.Regexp(t, "FF22108", err)
+	_, err = m.Export(ctx, "unknown")
+	assert.Regexp(t, "FF22108", err)
+}
+
+func TestEscrowExpired(t *testing.T) {
+	ctx := context.Background()
+	m, _, key := newTestManager(t, 1)
+	recipient, _ := secp256k1.GenerateSecp256k1KeyPair()
+	req, err := m.CreateExport(ctx, key.Address, recipient.PublicKey.SerializeCompressed())
+	assert.NoError(t, err)
+
+	m.requests[req.ID].expires = time.Now().Add(-1 * time.Second)
+	_, err = m.GetExport(ctx, req.ID)
+	assert.Regexp(t, "FF22113", err)
+
+	// Expired requests are pruned when the next one is created
+	_, err = m.CreateExport(ctx, key.Address, recipient.PublicKey.SerializeCompressed())
+	assert.NoError(t, err)
+	assert.NotContains(t, m.requests, req.ID)
+}
+
+func TestEscrowApproveBadSignature(t *testing.T) {
+	ctx := context.Background()
+	m, _, key := newTestManager(t, 1)
+	recipient, _ := secp256k1.GenerateSecp256k1KeyPair()
+	req, err := m.CreateExport(ctx, key.Address, recipient.PublicKey.SerializeCompressed())
+	assert.NoError(t, err)
+
+	_, err = m.Approve(ctx, req.ID, []byte{0x01})
+	assert.Regexp(t, "FF22110", err)
+
+	badSig := make([]byte, 65)
+	badSig[64] = 27
+	_, err = m.Approve(ctx, req.ID, badSig)
+	assert.Regexp(t, "FF22110", err)
+}
+
+func TestEscrowApproveNotApprover(t *testing.T) {
+	ctx := context.Background()
+	m, _, key := newTestManager(t, 1)
+	recipient, _ := secp256k1.GenerateSecp256k1KeyPair()
+	req, err := m.CreateExport(ctx, key.Address, recipient.PublicKey.SerializeCompressed())
+	assert.NoError(t, err)
+
+	// The key being exported cannot approve its own export
+	_, err = m.Approve(ctx, req.ID, approve(t, key, req))
+	assert.Regexp(t, "FF22111", err)
+}
+
+func TestEscrowApprovalBoundToRequest(t *testing.T) {
+	ctx := context.Background()
+	m, approvers, key := newTestManager(t, 1)
+	recipient, _ := secp256k1.GenerateSecp256k1KeyPair()
+	req1, err := m.CreateExport(ctx, key.Address, recipient.PublicKey.SerializeCompressed())
+	assert.NoError(t, err)
+	req2, err := m.CreateExport(ctx, key.Address, recipient.PublicKey.SerializeCompressed())
+	assert.NoError(t, err)
+
+	// A signature for one request recovers to a different address for another
+	_, err = m.Approve(ctx, req2.ID, approve(t, approvers[0], req1))
+	assert.Regexp(t, "FF22111", err)
+}
+
+func TestEscrowExportKeyNotFound(t *testing.T) {
+	ctx := context.Background()
+	m, approvers, _ := newTestManager(t, 1)
+	recipient, _ := secp256k1.GenerateSecp256k1KeyPair()
+	unknown, _ := secp256k1.GenerateSecp256k1KeyPair()
+	req, err := m.CreateExport(ctx, unknown.Address, recipient.PublicKey.SerializeCompressed())
+	assert.NoError(t, err)
+	_, err = m.Approve(ctx, req.ID, approve(t, approvers[0], req))
+	assert.NoError(t, err)
+
+	_, err = m.Export(ctx, req.ID)
+	assert.Regexp(t, "pop", err)
+
+	req, err = m.GetExport(ctx, req.ID)
+	assert.NoError(t, err)
+	assert.False(t, req.Exported)
+}
@@ -0,0 +1,290 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provisioning
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+)
+
+const (
+	// ConfigAccounts the accounts that must exist at startup
+	ConfigAccounts = "accounts"
+	// ConfigAccountName a unique name for the account. An account with a name and no address is created in the filesystem wallet on first startup
+	ConfigAccountName = "name"
+	// ConfigAccountAddress the address of an account that must already be held by the wallet
+	ConfigAccountAddress = "address"
+	// ConfigStateFile the file recording the address created for each named account, so it is only created once. Defaults to provisioned.json in the fileWallet path
+	ConfigStateFile = "stateFile"
+	// ConfigReportFile a file to write the JSON provisioning report to at startup
+	ConfigReportFile = "reportFile"
+	// ConfigScryptN the scrypt cost parameter (N) of the keystore files created for accounts
+	ConfigScryptN = "scryptN"
+)
+
+const defaultStateFilename = "provisioned.json"
+
+type Config struct {
+	Accounts   []AccountConfig
+	StateFile  string
+	ReportFile string
+	ScryptN    int
+}
+
+type AccountConfig struct {
+	Name    string
+	Address string
+}
+
+func InitConfig(section config.Section) {
+	section.AddKnownKey(ConfigStateFile)
+	section.AddKnownKey(ConfigReportFile)
+	section.AddKnownKey(ConfigScryptN, 1<<18)
+	accountsSection(section)
+}
+
+func accountsSection(section config.Section) config.ArraySection {
+	accounts := section.SubArray(ConfigAccounts)
+	accounts.AddKnownKey(ConfigAccountName)
+	accounts.AddKnownKey(ConfigAccountAddress)
+	return accounts
+}
+
+func ReadConfig(section config.Section) *Config {
+	accounts := accountsSection(section)
+	conf := &Config{
+		Accounts:   make([]AccountConfig, accounts.ArraySize()),
+		StateFile:  section.GetString(ConfigStateFile),
+		ReportFile: section.GetString(ConfigReportFile),
+		ScryptN:    section.GetInt(ConfigScryptN),
+	}
+	for i := range conf.Accounts {
+		entry := accounts.ArrayEntry(i)
+		conf.Accounts[i].Name = entry.GetString(ConfigAccountName)
+		conf.Accounts[i].Address = entry.GetString(ConfigAccountAddress)
+	}
+	return conf
+}
+
+// Status is the outcome of provisioning an account
+type Status string
+
+const (
+	// StatusCreated the account was created in the filesystem wallet on this startup
+	StatusCreated Status = "created"
+	// StatusExisting the account was created in the filesystem wallet on an earlier startup, and is held by the wallet
+	StatusExisting Status = "existing"
+	// StatusPresent the configured address is held by the wallet
+	StatusPresent Status = "present"
+	// StatusMissing the account is not held by the wallet
+	StatusMissing Status = "missing"
+)
+
+// AccountReport is the provisioning outcome for one account
+type AccountReport struct {
+	Name    string                 `json:"name,omitempty"`
+	Address *ethtypes.Address0xHex `json:"address"`
+	Status  Status                 `json:"status"`
+}
+
+// Report is the provisioning outcome of every configured account, in the order they are configured
+type Report struct {
+	Time     *fftypes.FFTime  `json:"time"`
+	Accounts []*AccountReport `json:"accounts"`
+}
+
+// Provisioner makes sure the accounts in the configuration exist at startup, so an environment can be stood up
+// reproducibly without manual key creation. Accounts configured with only a name are created in the filesystem
+// wallet the first time, with generated passwords, and recorded by name in a state file so later startups find
+// the same account. Accounts configured with an address are checked to be held by the wallet, whatever its type.
+type Provisioner interface {
+	// CreateAccounts creates any named accounts not yet recorded in the state file. Called before the wallet is
+	// initialized, so the wallet indexes the new keys
+	CreateAccounts(ctx context.Context) error
+	// Verify checks every account is held by the initialized wallet, writing the report (if configured) and
+	// returning an error if any are missing
+	Verify(ctx context.Context, wallet ethsigner.Wallet) (*Report, error)
+}
+
+type provisioner struct {
+	conf       *Config
+	fileWallet *fswallet.Config
+	stateFile  string
+	accounts   []*AccountReport
+}
+
+// state is the content of the state file - the address of each account created by name
+type state struct {
+	Accounts map[string]*ethtypes.Address0xHex `json:"accounts"`
+}
+
+// NewProvisioner validates the accounts in the configuration. The filesystem wallet configuration is
+// required to create accounts that only have a name, and is nil if the filesystem wallet is not enabled.
+func NewProvisioner(ctx context.Context, conf *Config, fileWallet *fswallet.Config) (Provisioner, error) {
+	p := &provisioner{
+		conf:       conf,
+		fileWallet: fileWallet,
+		stateFile:  conf.StateFile,
+		accounts:   make([]*AccountReport, len(conf.Accounts)),
+	}
+	names := make(map[string]bool)
+	for i, a := range conf.Accounts {
+		p.accounts[i] = &AccountReport{Name: a.Name}
+		if a.Name != "" {
+			if names[a.Name] {
+				return nil, i18n.NewError(ctx, signermsgs.MsgProvisioningBadAccount, i)
+			}
+			names[a.Name] = true
+		}
+		switch {
+		case a.Address != "":
+			addr, err := ethtypes.NewAddress(a.Address)
+			if err != nil {
+				return nil, err
+			}
+			p.accounts[i].Address = addr
+		case a.Name == "":
+			return nil, i18n.NewError(ctx, signermsgs.MsgProvisioningBadAccount, i)
+		case fileWallet == nil:
+			return nil, i18n.NewError(ctx, signermsgs.MsgProvisioningNoFileWallet, a.Name)
+		}
+	}
+	if p.stateFile == "" && fileWallet != nil {
+		p.stateFile = path.Join(fileWallet.Path, defaultStateFilename)
+	}
+	return p, nil
+}
+
+func (p *provisioner) CreateAccounts(ctx context.Context) error {
+	var st *state
+	for _, a := range p.accounts {
+		if a.Address != nil {
+			continue
+		}
+		if st == nil {
+			var err error
+			if st, err = p.readState(ctx); err != nil {
+				return err
+			}
+		}
+		if addr, ok := st.Accounts[a.Name]; ok {
+			a.Address, a.Status = addr, StatusExisting
+			continue
+		}
+		addr, err := fswallet.CreateAccount(ctx, p.fileWallet, &keystorev3.ScryptOptions{N: p.conf.ScryptN})
+		if err != nil {
+			return err
+		}
+		log.L(ctx).Infof("Provisioning created account '%s': %s", a.Name, addr)
+		a.Address, a.Status = addr, StatusCreated
+		// Recorded after each account, so a failure part way through does not create the earlier ones again
+		st.Accounts[a.Name] = addr
+		if err := p.writeState(ctx, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *provisioner) readState(ctx context.Context) (*state, error) {
+	st := &state{}
+	b, err := os.ReadFile(p.stateFile)
+	if err == nil {
+		err = json.Unmarshal(b, st)
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgProvisioningStateFile, p.stateFile, err)
+	}
+	if st.Accounts == nil {
+		st.Accounts = make(map[string]*ethtypes.Address0xHex)
+	}
+	return st, nil
+}
+
+func (p *provisioner) writeState(ctx context.Context, st *state) error {
+	b, _ := json.MarshalIndent(st, "", "  ")
+	// Written to a temporary file and renamed, so the state file is never left partially written
+	tmpFile := p.stateFile + ".tmp"
+	err := os.WriteFile(tmpFile, b, 0600)
+	if err == nil {
+		err = os.Rename(tmpFile, p.stateFile)
+	}
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgProvisioningStateFile, p.stateFile, err)
+	}
+	return nil
+}
+
+func (p *provisioner) Verify(ctx context.Context, wallet ethsigner.Wallet) (*Report, error) {
+	held, err := wallet.GetAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	heldMap := make(map[ethtypes.Address0xHex]bool, len(held))
+	for _, addr := range held {
+		heldMap[*addr] = true
+	}
+	report := &Report{Time: fftypes.Now(), Accounts: p.accounts}
+	var missing []string
+	for _, a := range p.accounts {
+		switch {
+		case a.Address == nil || !heldMap[*a.Address]:
+			a.Status = StatusMissing
+			missing = append(missing, p.accountString(a))
+		case a.Status == "":
+			a.Status = StatusPresent
+		}
+		log.L(ctx).Infof("Provisioning account %s: %s", p.accountString(a), a.Status)
+	}
+	if p.conf.ReportFile != "" {
+		b, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(p.conf.ReportFile, b, 0644); err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgProvisioningReportFile, p.conf.ReportFile, err)
+		}
+	}
+	if len(missing) > 0 {
+		return report, i18n.NewError(ctx, signermsgs.MsgProvisioningMissing, strings.Join(missing, ", "))
+	}
+	return report, nil
+}
+
+func (p *provisioner) accountString(a *AccountReport) string {
+	switch {
+	case a.Name == "":
+		return a.Address.String()
+	case a.Address == nil:
+		return a.Name
+	default:
+		return a.Name + " (" + a.Address.String() + ")"
+	}
+}
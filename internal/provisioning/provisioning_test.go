@@ -0,0 +1,246 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provisioning
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testAddress = "0x1f185718734552d08278aa70f804580bab5fd2b4"
+
+func newTestFileWalletConfig(t *testing.T) *fswallet.Config {
+	return &fswallet.Config{
+		Path:            t.TempDir(),
+		DisableListener: true,
+		Filenames: fswallet.FilenamesConfig{
+			PrimaryExt:        ".key.json",
+			PasswordExt:       ".pwd",
+			PasswordTrimSpace: true,
+		},
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+
+	config.RootConfigReset()
+	section := config.RootSection("ut_provisioning")
+	InitConfig(section)
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+ut_provisioning:
+  accounts:
+  - name: alice
+  - address: "` + testAddress + `"
+`))
+	assert.NoError(t, err)
+	section.Set(ConfigReportFile, "report.json")
+
+	conf := ReadConfig(section)
+	assert.Equal(t, []AccountConfig{{Name: "alice"}, {Address: testAddress}}, conf.Accounts)
+	assert.Equal(t, "report.json", conf.ReportFile)
+	assert.Equal(t, 262144, conf.ScryptN)
+
+}
+
+func TestProvisionCreateAndRestart(t *testing.T) {
+
+	ctx := context.Background()
+	fsConf := newTestFileWalletConfig(t)
+	reportFile := path.Join(t.TempDir(), "report.json")
+	conf := &Config{
+		Accounts:   []AccountConfig{{Name: "alice"}, {Name: "bob"}},
+		ReportFile: reportFile,
+		ScryptN:    1024,
+	}
+
+	p, err := NewProvisioner(ctx, conf, fsConf)
+	assert.NoError(t, err)
+	err = p.CreateAccounts(ctx)
+	assert.NoError(t, err)
+
+	w, err := fswallet.NewFilesystemWallet(ctx, fsConf)
+	assert.NoError(t, err)
+	defer w.Close()
+	err = w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	report, err := p.Verify(ctx, w)
+	assert.NoError(t, err)
+	assert.Len(t, report.Accounts, 2)
+	alice, bob := report.Accounts[0], report.Accounts[1]
+	assert.Equal(t, "alice", alice.Name)
+	assert.Equal(t, StatusCreated, alice.Status)
+	assert.Equal(t, StatusCreated, bob.Status)
+	assert.NotEqual(t, alice.Address, bob.Address)
+
+	var written Report
+	b, err := os.ReadFile(reportFile)
+	assert.NoError(t, err)
+	err = json.Unmarshal(b, &written)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.Address, written.Accounts[0].Address)
+
+	// A restart with a further account finds the existing ones
+	conf.Accounts = append(conf.Accounts, AccountConfig{Name: "carol"})
+	p, err = NewProvisioner(ctx, conf, fsConf)
+	assert.NoError(t, err)
+	err = p.CreateAccounts(ctx)
+	assert.NoError(t, err)
+	err = w.Refresh(ctx)
+	assert.NoError(t, err)
+	report, err = p.Verify(ctx, w)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.Address, report.Accounts[0].Address)
+	assert.Equal(t, StatusExisting, report.Accounts[0].Status)
+	assert.Equal(t, StatusExisting, report.Accounts[1].Status)
+	assert.Equal(t, StatusCreated, report.Accounts[2].Status)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 3)
+
+}
+
+func TestProvisionVerifyAddresses(t *testing.T) {
+
+	ctx := context.Background()
+	p, err := NewProvisioner(ctx, &Config{
+		Accounts: []AccountConfig{{Name: "funder", Address: testAddress}, {Address: "0x5d093e9b41911be5f5c4cf91b108bac5d130fa83"}},
+	}, nil)
+	assert.NoError(t, err)
+	err = p.CreateAccounts(ctx)
+	assert.NoError(t, err)
+
+	w := &ethsignermocks.Wallet{}
+	w.On("GetAccounts", mock.Anything).Return([]*ethtypes.Address0xHex{ethtypes.MustNewAddress(testAddress)}, nil)
+	report, err := p.Verify(ctx, w)
+	assert.Regexp(t, "FF22237.*0x5d093e9b41911be5f5c4cf91b108bac5d130fa83", err)
+	assert.Equal(t, StatusPresent, report.Accounts[0].Status)
+	assert.Equal(t, StatusMissing, report.Accounts[1].Status)
+
+}
+
+func TestProvisionVerifyMissingCreated(t *testing.T) {
+
+	ctx := context.Background()
+	p, err := NewProvisioner(ctx, &Config{Accounts: []AccountConfig{{Name: "alice"}}}, newTestFileWalletConfig(t))
+	assert.NoError(t, err)
+
+	w := &ethsignermocks.Wallet{}
+	w.On("GetAccounts", mock.Anything).Return([]*ethtypes.Address0xHex{}, nil)
+	_, err = p.Verify(ctx, w)
+	assert.Regexp(t, "FF22237.*alice", err)
+
+}
+
+func TestProvisionVerifyGetAccountsFail(t *testing.T) {
+
+	ctx := context.Background()
+	p, err := NewProvisioner(ctx, &Config{}, nil)
+	assert.NoError(t, err)
+
+	w := &ethsignermocks.Wallet{}
+	w.On("GetAccounts", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	_, err = p.Verify(ctx, w)
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestProvisionVerifyReportFail(t *testing.T) {
+
+	ctx := context.Background()
+	p, err := NewProvisioner(ctx, &Config{ReportFile: t.TempDir()}, nil)
+	assert.NoError(t, err)
+
+	w := &ethsignermocks.Wallet{}
+	w.On("GetAccounts", mock.Anything).Return([]*ethtypes.Address0xHex{}, nil)
+	_, err = p.Verify(ctx, w)
+	assert.Regexp(t, "FF22236", err)
+
+}
+
+func TestNewProvisionerBadAccounts(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := NewProvisioner(ctx, &Config{Accounts: []AccountConfig{{}}}, nil)
+	assert.Regexp(t, "FF22233", err)
+
+	_, err = NewProvisioner(ctx, &Config{Accounts: []AccountConfig{{Name: "a", Address: testAddress}, {Name: "a"}}}, nil)
+	assert.Regexp(t, "FF22233", err)
+
+	_, err = NewProvisioner(ctx, &Config{Accounts: []AccountConfig{{Address: "bad"}}}, nil)
+	assert.Regexp(t, "bad address", err)
+
+	_, err = NewProvisioner(ctx, &Config{Accounts: []AccountConfig{{Name: "alice"}}}, nil)
+	assert.Regexp(t, "FF22234", err)
+
+}
+
+func TestProvisionCreateBadState(t *testing.T) {
+
+	ctx := context.Background()
+	fsConf := newTestFileWalletConfig(t)
+	err := os.WriteFile(path.Join(fsConf.Path, "provisioned.json"), []byte(`!!not json`), 0600)
+	assert.NoError(t, err)
+
+	p, err := NewProvisioner(ctx, &Config{Accounts: []AccountConfig{{Name: "alice"}}}, fsConf)
+	assert.NoError(t, err)
+	err = p.CreateAccounts(ctx)
+	assert.Regexp(t, "FF22235", err)
+
+}
+
+func TestProvisionCreateWriteStateFail(t *testing.T) {
+
+	ctx := context.Background()
+	fsConf := newTestFileWalletConfig(t)
+	p, err := NewProvisioner(ctx, &Config{
+		Accounts:  []AccountConfig{{Name: "alice"}},
+		StateFile: path.Join(fsConf.Path, "missing", "state.json"),
+		ScryptN:   1024,
+	}, fsConf)
+	assert.NoError(t, err)
+	err = p.CreateAccounts(ctx)
+	assert.Regexp(t, "FF22235", err)
+
+}
+
+func TestProvisionCreateFail(t *testing.T) {
+
+	ctx := context.Background()
+	fsConf := newTestFileWalletConfig(t)
+	fsConf.Filenames.PasswordExt = ""
+	p, err := NewProvisioner(ctx, &Config{Accounts: []AccountConfig{{Name: "alice"}}}, fsConf)
+	assert.NoError(t, err)
+	err = p.CreateAccounts(ctx)
+	assert.Regexp(t, "FF22231", err)
+
+}
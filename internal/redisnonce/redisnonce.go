@@ -0,0 +1,179 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisnonce
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/redis/go-redis/v9"
+)
+
+// Manager coordinates the nonces assigned to transactions by multiple signer replicas, so that two
+// replicas signing for the same address concurrently do not both use the pending nonce from the node.
+type Manager interface {
+	// AssignNonce returns the next nonce for the address - the pending nonce from the node, unless another
+	// replica has already assigned that nonce (or a later one) within the TTL
+	AssignNonce(ctx context.Context, chainID *big.Int, from ethtypes.Address0xHex, pendingNonce uint64) (uint64, error)
+	// ExportNonces returns the last nonce assigned to every address that has not yet expired
+	ExportNonces(ctx context.Context) ([]*NonceState, error)
+	// ImportNonces restores exported nonces, keeping any later nonce already assigned for the address
+	ImportNonces(ctx context.Context, nonces []*NonceState) error
+	Close() error
+}
+
+type Config struct {
+	URL       string
+	KeyPrefix string
+	NonceTTL  time.Duration
+}
+
+// NonceState is the last nonce assigned to an address, as exported to move the state to another Redis
+type NonceState struct {
+	ChainID   string                `json:"chainId"`
+	Address   ethtypes.Address0xHex `json:"address"`
+	Nonce     uint64                `json:"nonce"`
+	ExpiresIn *fftypes.FFDuration   `json:"expiresIn,omitempty"`
+}
+
+type redisNonceManager struct {
+	conf   Config
+	client *redis.Client
+}
+
+// assignNonceScript atomically takes the greater of the pending nonce from the node, and one more than the
+// last nonce assigned by any replica. The key expires after the TTL, so a nonce that was assigned but never
+// submitted (leaving a gap) is only skipped until the node's pending nonce is trusted again.
+var assignNonceScript = redis.NewScript(`
+local nonce = tonumber(ARGV[1])
+local last = redis.call('GET', KEYS[1])
+if last and tonumber(last) >= nonce then
+	nonce = tonumber(last) + 1
+end
+redis.call('SET', KEYS[1], nonce, 'PX', ARGV[2])
+return nonce
+`)
+
+// importNonceScript is like assignNonceScript, but keeps the last nonce already assigned if it is greater
+var importNonceScript = redis.NewScript(`
+local nonce = tonumber(ARGV[1])
+local last = redis.call('GET', KEYS[1])
+if last and tonumber(last) > nonce then
+	nonce = tonumber(last)
+end
+redis.call('SET', KEYS[1], nonce, 'PX', ARGV[2])
+return nonce
+`)
+
+func NewManager(ctx context.Context, conf *Config) (Manager, error) {
+	opts, err := redis.ParseURL(conf.URL)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgRedisBadURL, err)
+	}
+	m := &redisNonceManager{
+		conf:   *conf,
+		client: redis.NewClient(opts),
+	}
+	if err := m.client.Ping(ctx).Err(); err != nil {
+		_ = m.client.Close()
+		return nil, i18n.NewError(ctx, signermsgs.MsgRedisConnectFailed, opts.Addr, err)
+	}
+	log.L(ctx).Infof("Nonces coordinated with Redis at %s", opts.Addr)
+	return m, nil
+}
+
+func (m *redisNonceManager) nonceKey(chainID *big.Int, from ethtypes.Address0xHex) string {
+	return fmt.Sprintf("%s:nonce:%s:%s", m.conf.KeyPrefix, chainID, from)
+}
+
+func (m *redisNonceManager) AssignNonce(ctx context.Context, chainID *big.Int, from ethtypes.Address0xHex, pendingNonce uint64) (uint64, error) {
+	nonce, err := assignNonceScript.Run(ctx, m.client, []string{m.nonceKey(chainID, from)}, pendingNonce, m.conf.NonceTTL.Milliseconds()).Uint64()
+	if err != nil {
+		return 0, i18n.NewError(ctx, signermsgs.MsgRedisNonceFailed, from, err)
+	}
+	if nonce != pendingNonce {
+		log.L(ctx).Debugf("Assigned nonce %d for %s (pending nonce from node %d)", nonce, from, pendingNonce)
+	}
+	return nonce, nil
+}
+
+func (m *redisNonceManager) ExportNonces(ctx context.Context) ([]*NonceState, error) {
+	prefix := fmt.Sprintf("%s:nonce:", m.conf.KeyPrefix)
+	nonces := []*NonceState{}
+	iter := m.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		chainID, addr, ok := strings.Cut(strings.TrimPrefix(key, prefix), ":")
+		from, err := ethtypes.NewAddress(addr)
+		if !ok || err != nil {
+			log.L(ctx).Warnf("Skipping unrecognized key %s", key)
+			continue
+		}
+		nonce, err := m.client.Get(ctx, key).Uint64()
+		if err == redis.Nil {
+			continue // expired since the scan
+		}
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgRedisStateFailed, "export", err)
+		}
+		ttl, err := m.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgRedisStateFailed, "export", err)
+		}
+		nonces = append(nonces, &NonceState{
+			ChainID:   chainID,
+			Address:   *from,
+			Nonce:     nonce,
+			ExpiresIn: (*fftypes.FFDuration)(&ttl),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgRedisStateFailed, "export", err)
+	}
+	return nonces, nil
+}
+
+func (m *redisNonceManager) ImportNonces(ctx context.Context, nonces []*NonceState) error {
+	for _, ns := range nonces {
+		chainID, ok := new(big.Int).SetString(ns.ChainID, 10)
+		if !ok {
+			return i18n.NewError(ctx, signermsgs.MsgRedisStateFailed, "import", fmt.Sprintf("chainId=%s", ns.ChainID))
+		}
+		// Nonces exported without an expiry get the configured TTL
+		ttl := m.conf.NonceTTL
+		if ns.ExpiresIn != nil && *ns.ExpiresIn > 0 {
+			ttl = time.Duration(*ns.ExpiresIn)
+		}
+		if err := importNonceScript.Run(ctx, m.client, []string{m.nonceKey(chainID, ns.Address)}, ns.Nonce, ttl.Milliseconds()).Err(); err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgRedisStateFailed, "import", err)
+		}
+	}
+	log.L(ctx).Infof("Imported %d nonces into Redis", len(nonces))
+	return nil
+}
+
+func (m *redisNonceManager) Close() error {
+	return m.client.Close()
+}
@@ -0,0 +1,176 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisnonce
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAddr = *ethtypes.MustNewAddress("0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+
+func newTestManager(t *testing.T) (context.Context, *redisNonceManager, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	m, err := NewManager(ctx, &Config{
+		URL:       "redis://" + mr.Addr(),
+		KeyPrefix: "ut",
+		NonceTTL:  1 * time.Minute,
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = m.Close() })
+	return ctx, m.(*redisNonceManager), mr
+}
+
+func TestAssignNonce(t *testing.T) {
+
+	ctx, m, mr := newTestManager(t)
+
+	// The first replica uses the pending nonce from the node
+	nonce, err := m.AssignNonce(ctx, big.NewInt(1), testAddr, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), nonce)
+
+	// Another replica gets the same pending nonce, before the node has seen the first transaction
+	nonce, err = m.AssignNonce(ctx, big.NewInt(1), testAddr, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(11), nonce)
+
+	// The node catches up, and moves ahead
+	nonce, err = m.AssignNonce(ctx, big.NewInt(1), testAddr, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), nonce)
+
+	// Each chain is separate
+	nonce, err = m.AssignNonce(ctx, big.NewInt(2), testAddr, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), nonce)
+
+	val, err := mr.Get("ut:nonce:1:0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+	assert.NoError(t, err)
+	assert.Equal(t, "20", val)
+	assert.Equal(t, 1*time.Minute, mr.TTL("ut:nonce:1:0xfb075bb99f2aa4c49955bf703509a227d7a12248"))
+
+	// After the TTL the pending nonce from the node is trusted again
+	mr.FastForward(2 * time.Minute)
+	nonce, err = m.AssignNonce(ctx, big.NewInt(1), testAddr, 15)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(15), nonce)
+
+}
+
+func TestAssignNonceFail(t *testing.T) {
+
+	ctx, m, mr := newTestManager(t)
+	mr.SetError("pop")
+
+	_, err := m.AssignNonce(ctx, big.NewInt(1), testAddr, 10)
+	assert.Regexp(t, "FF22147.*pop", err)
+
+}
+
+func TestNewManagerBadURL(t *testing.T) {
+
+	_, err := NewManager(context.Background(), &Config{URL: "wrong://"})
+	assert.Regexp(t, "FF22145", err)
+
+}
+
+func TestNewManagerConnectFail(t *testing.T) {
+
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+	_, err := NewManager(context.Background(), &Config{URL: "redis://" + addr})
+	assert.Regexp(t, "FF22146", err)
+
+}
+
+func TestExportImportNonces(t *testing.T) {
+
+	ctx, m1, mr1 := newTestManager(t)
+	_, err := m1.AssignNonce(ctx, big.NewInt(1), testAddr, 10)
+	assert.NoError(t, err)
+	_, err = m1.AssignNonce(ctx, big.NewInt(2), testAddr, 5)
+	assert.NoError(t, err)
+	mr1.FastForward(10 * time.Second)
+	err = mr1.Set("ut:nonce:unrecognized", "1")
+	assert.NoError(t, err)
+
+	nonces, err := m1.ExportNonces(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, nonces, 2)
+	for _, ns := range nonces {
+		assert.Equal(t, testAddr, ns.Address)
+		assert.Equal(t, 50*time.Second, time.Duration(*ns.ExpiresIn))
+	}
+
+	// A later nonce already assigned on the other instance is kept
+	_, m2, mr2 := newTestManager(t)
+	_, err = m2.AssignNonce(ctx, big.NewInt(2), testAddr, 8)
+	assert.NoError(t, err)
+	err = m2.ImportNonces(ctx, nonces)
+	assert.NoError(t, err)
+	val, err := mr2.Get("ut:nonce:1:0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", val)
+	assert.Equal(t, 50*time.Second, mr2.TTL("ut:nonce:1:0xfb075bb99f2aa4c49955bf703509a227d7a12248"))
+	val, err = mr2.Get("ut:nonce:2:0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+	assert.NoError(t, err)
+	assert.Equal(t, "8", val)
+
+	// Without an expiry, the configured TTL is used
+	err = m2.ImportNonces(ctx, []*NonceState{{ChainID: "3", Address: testAddr, Nonce: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1*time.Minute, mr2.TTL("ut:nonce:3:0xfb075bb99f2aa4c49955bf703509a227d7a12248"))
+
+}
+
+func TestExportNoncesFail(t *testing.T) {
+
+	ctx, m, mr := newTestManager(t)
+	mr.SetError("pop")
+
+	_, err := m.ExportNonces(ctx)
+	assert.Regexp(t, "FF22184.*pop", err)
+
+}
+
+func TestImportNoncesBadChainID(t *testing.T) {
+
+	ctx, m, _ := newTestManager(t)
+
+	err := m.ImportNonces(ctx, []*NonceState{{ChainID: "wrong", Address: testAddr}})
+	assert.Regexp(t, "FF22184.*wrong", err)
+
+}
+
+func TestImportNoncesFail(t *testing.T) {
+
+	ctx, m, mr := newTestManager(t)
+	mr.SetError("pop")
+
+	err := m.ImportNonces(ctx, []*NonceState{{ChainID: "1", Address: testAddr}})
+	assert.Regexp(t, "FF22184.*pop", err)
+
+}
@@ -0,0 +1,108 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+const (
+	metricsSubsystemAccountQueue = "account_queue"
+	metricAccountQueueDepth      = "depth"
+	metricLabelAddress           = "address"
+)
+
+// accountQueues serializes the processing of transactions from each address, in the order they arrive, so
+// concurrently submitted transactions are assigned nonces, signed and sent to the node one at a time
+type accountQueues struct {
+	mux     sync.Mutex
+	queues  map[ethtypes.Address0xHex][]chan struct{} // the head of each queue is being processed, and the rest are waiting
+	metrics metric.MetricsManager                     // nil unless metrics are enabled
+}
+
+func newAccountQueues(ctx context.Context, registry metric.MetricsRegistry) (*accountQueues, error) {
+	aq := &accountQueues{
+		queues: make(map[ethtypes.Address0xHex][]chan struct{}),
+	}
+	if registry != nil {
+		mm, err := registry.NewMetricsManagerForSubsystem(ctx, metricsSubsystemAccountQueue)
+		if err != nil {
+			return nil, err
+		}
+		mm.NewGaugeMetricWithLabels(ctx, metricAccountQueueDepth, "Number of transactions from the address being processed or waiting", []string{metricLabelAddress}, false)
+		aq.metrics = mm
+	}
+	return aq, nil
+}
+
+// acquire waits until all earlier transactions from the address have been processed. The returned
+// function must be called when the transaction has been processed, to start processing the next one.
+func (aq *accountQueues) acquire(ctx context.Context, addr ethtypes.Address0xHex) (func(), error) {
+	ready := make(chan struct{})
+	aq.mux.Lock()
+	queue := append(aq.queues[addr], ready)
+	aq.queues[addr] = queue
+	if len(queue) == 1 {
+		close(ready)
+	}
+	aq.metricsDepth(ctx, addr, len(queue))
+	aq.mux.Unlock()
+
+	select {
+	case <-ready:
+		return func() { aq.remove(ctx, addr, ready) }, nil
+	case <-ctx.Done():
+		aq.remove(ctx, addr, ready)
+		return nil, i18n.NewError(ctx, signermsgs.MsgAccountQueueWaitCanceled, addr)
+	}
+}
+
+// remove takes a transaction out of the queue, whether it was processed or gave up waiting, and
+// starts processing the next transaction if it was at the head of the queue
+func (aq *accountQueues) remove(ctx context.Context, addr ethtypes.Address0xHex, ready chan struct{}) {
+	aq.mux.Lock()
+	defer aq.mux.Unlock()
+	queue := aq.queues[addr]
+	for i, entry := range queue {
+		if entry == ready {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			if i == 0 && len(queue) > 0 {
+				close(queue[0])
+			}
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(aq.queues, addr)
+	} else {
+		aq.queues[addr] = queue
+	}
+	aq.metricsDepth(ctx, addr, len(queue))
+}
+
+// must be called holding the mux
+func (aq *accountQueues) metricsDepth(ctx context.Context, addr ethtypes.Address0xHex, depth int) {
+	if aq.metrics != nil {
+		aq.metrics.SetGaugeMetricWithLabels(ctx, metricAccountQueueDepth, float64(depth), map[string]string{metricLabelAddress: addr.String()}, nil)
+	}
+}
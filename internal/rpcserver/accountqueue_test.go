@@ -0,0 +1,256 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testQueueAddr = *ethtypes.MustNewAddress("0x2b1c769ef5ad304a4889f2a07a6617cd935849ae")
+
+func (aq *accountQueues) depth(addr ethtypes.Address0xHex) int {
+	aq.mux.Lock()
+	defer aq.mux.Unlock()
+	return len(aq.queues[addr])
+}
+
+func TestAccountQueueOrdering(t *testing.T) {
+
+	aq, err := newAccountQueues(context.Background(), nil)
+	assert.NoError(t, err)
+
+	release1, err := aq.acquire(context.Background(), testQueueAddr)
+	assert.NoError(t, err)
+
+	// Queue up the next transactions one at a time, so we know the order they arrived
+	var orderMux sync.Mutex
+	order := []int{}
+	var wg sync.WaitGroup
+	for i := 2; i <= 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			release, err := aq.acquire(context.Background(), testQueueAddr)
+			assert.NoError(t, err)
+			orderMux.Lock()
+			order = append(order, i)
+			orderMux.Unlock()
+			release()
+		}(i)
+		for aq.depth(testQueueAddr) < i {
+			time.Sleep(1 * time.Millisecond)
+		}
+	}
+
+	// Other addresses are not blocked
+	otherAddr := *ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20")
+	releaseOther, err := aq.acquire(context.Background(), otherAddr)
+	assert.NoError(t, err)
+	releaseOther()
+
+	release1()
+	wg.Wait()
+	assert.Equal(t, []int{2, 3, 4}, order)
+	assert.Empty(t, aq.queues)
+
+}
+
+func TestAccountQueueCancelWaiting(t *testing.T) {
+
+	aq, err := newAccountQueues(context.Background(), nil)
+	assert.NoError(t, err)
+
+	release1, err := aq.acquire(context.Background(), testQueueAddr)
+	assert.NoError(t, err)
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, err := aq.acquire(ctx, testQueueAddr)
+		cancelled <- err
+	}()
+	for aq.depth(testQueueAddr) < 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		release3, err := aq.acquire(context.Background(), testQueueAddr)
+		assert.NoError(t, err)
+		release3()
+		close(acquired)
+	}()
+	for aq.depth(testQueueAddr) < 3 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	cancelCtx()
+	assert.Regexp(t, "FF22171", <-cancelled)
+	assert.Equal(t, 2, aq.depth(testQueueAddr))
+
+	release1()
+	<-acquired
+	assert.Empty(t, aq.queues)
+
+}
+
+func TestAccountQueueCancelHead(t *testing.T) {
+
+	aq, err := newAccountQueues(context.Background(), nil)
+	assert.NoError(t, err)
+
+	ready := make(chan struct{})
+	aq.queues[testQueueAddr] = []chan struct{}{ready}
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := aq.acquire(context.Background(), testQueueAddr)
+		assert.NoError(t, err)
+		release()
+		close(acquired)
+	}()
+	for aq.depth(testQueueAddr) < 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// Removing the head of the queue without it having been processed must still start the next one
+	aq.remove(context.Background(), testQueueAddr, ready)
+	<-acquired
+	assert.Empty(t, aq.queues)
+
+}
+
+func TestAccountQueueMetrics(t *testing.T) {
+
+	registry := metric.NewPrometheusMetricsRegistry("ffsigner")
+	aq, err := newAccountQueues(context.Background(), registry)
+	assert.NoError(t, err)
+
+	release, err := aq.acquire(context.Background(), testQueueAddr)
+	assert.NoError(t, err)
+
+	handler, err := registry.HTTPHandler(context.Background(), promhttp.HandlerOpts{})
+	assert.NoError(t, err)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Regexp(t, `ff_account_queue_depth\{address="0x2b1c769ef5ad304a4889f2a07a6617cd935849ae"[^}]*\} 1`, res.Body.String())
+
+	release()
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Regexp(t, `ff_account_queue_depth\{address="0x2b1c769ef5ad304a4889f2a07a6617cd935849ae"[^}]*\} 0`, res.Body.String())
+
+	_, err = newAccountQueues(context.Background(), registry)
+	assert.Error(t, err)
+
+}
+
+func TestAccountQueueSendTransactionInNonceOrder(t *testing.T) {
+
+	node := newTestNode(t, "0x5")
+	_, s, done := newTestServer(t, func() {
+		signerconfig.BackendConfig.Set(ffresty.HTTPConfigURL, node.server.URL)
+		signerconfig.BackendConfig.Set(ffresty.HTTPConfigRetryEnabled, false)
+		config.Set(signerconfig.ServerAccountQueueEnabled, true)
+	})
+	defer done()
+	s.backend = rpcbackend.NewRPCClient(ffresty.NewWithConfig(s.ctx, ffresty.Config{URL: node.server.URL}))
+	s.chainID = big.NewInt(1)
+	assert.NotNil(t, s.accountQueues)
+
+	// The node always returns the same pending nonce, so it is only correct if the
+	// next transaction is not started until the previous one has been sent
+	var signMux sync.Mutex
+	signing := false
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Sign", mock.Anything, mock.Anything, int64(1)).Run(func(args mock.Arguments) {
+		signMux.Lock()
+		assert.False(t, signing)
+		signing = true
+		signMux.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		signMux.Lock()
+		signing = false
+		signMux.Unlock()
+	}).Return([]byte{0x01}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.processRPC(s.ctx, sendTransactionRequest(testQueueAddr))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, "eth_getTransactionCount,eth_sendRawTransaction,eth_getTransactionCount,eth_sendRawTransaction,eth_getTransactionCount,eth_sendRawTransaction,eth_getTransactionCount,eth_sendRawTransaction,eth_getTransactionCount,eth_sendRawTransaction", strings.Join(node.calls(), ","))
+
+}
+
+func TestAccountQueueSendTransactionCancelled(t *testing.T) {
+
+	_, s, done := newTestServer(t, func() {
+		config.Set(signerconfig.ServerAccountQueueEnabled, true)
+	})
+	defer done()
+
+	release, err := s.accountQueues.acquire(s.ctx, testQueueAddr)
+	assert.NoError(t, err)
+	defer release()
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancelCtx()
+	rpcRes, err := s.processRPC(ctx, sendTransactionRequest(testQueueAddr))
+	assert.Regexp(t, "FF22171", err)
+	assert.Regexp(t, "FF22171", rpcRes.Error.Message)
+
+}
+
+func TestAccountQueueSendTransactionBadFrom(t *testing.T) {
+
+	_, s, done := newTestServer(t, func() {
+		config.Set(signerconfig.ServerAccountQueueEnabled, true)
+	})
+	defer done()
+
+	_, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_sendTransaction",
+		Params: []*fftypes.JSONAny{fftypes.JSONAnyPtr(`{"from":"bad"}`)},
+	})
+	assert.Regexp(t, "bad address", err)
+
+}
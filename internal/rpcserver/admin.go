@@ -0,0 +1,145 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/httpserver"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/escrow"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+type createExportRequest struct {
+	Address   ethtypes.Address0xHex     `json:"address"`
+	Recipient ethtypes.HexBytes0xPrefix `json:"recipient"` // secp256k1 public key, compressed or uncompressed
+}
+
+type approveExportRequest struct {
+	Signature ethtypes.HexBytes0xPrefix `json:"signature"` // EIP-191 signature over the request's message, R,S,V
+}
+
+func (s *rpcServer) initAdmin(ctx context.Context) (err error) {
+	keys, ok := s.wallet.(escrow.KeySource)
+	if !ok {
+		return i18n.NewError(ctx, signermsgs.MsgEscrowUnsupportedWallet)
+	}
+	approverStrings := config.GetStringSlice(signerconfig.AdminEscrowApprovers)
+	approvers := make([]*ethtypes.Address0xHex, len(approverStrings))
+	for i, a := range approverStrings {
+		if approvers[i], err = ethtypes.NewAddress(a); err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgEscrowBadApprover, a, err)
+		}
+	}
+	s.escrow, err = escrow.NewManager(ctx, &escrow.Config{
+		Approvers:      approvers,
+		Threshold:      config.GetInt(signerconfig.AdminEscrowThreshold),
+		RequestTimeout: config.GetDuration(signerconfig.AdminEscrowRequestTimeout),
+	}, keys)
+	if err != nil {
+		return err
+	}
+	s.adminServerDone = make(chan error)
+	s.adminServer, err = httpserver.NewHTTPServer(ctx, "admin", s.adminRouter(), s.adminServerDone, signerconfig.AdminConfig, signerconfig.CorsConfig)
+	return err
+}
+
+func (s *rpcServer) adminRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Path("/escrow/exports").Methods(http.MethodPost).HandlerFunc(s.adminCreateExport)
+	r.Path("/escrow/exports/{id}").Methods(http.MethodGet).HandlerFunc(s.adminGetExport)
+	r.Path("/escrow/exports/{id}/approvals").Methods(http.MethodPost).HandlerFunc(s.adminApproveExport)
+	r.Path("/escrow/exports/{id}/export").Methods(http.MethodPost).HandlerFunc(s.adminExport)
+	return r
+}
+
+func (s *rpcServer) adminCreateExport(w http.ResponseWriter, r *http.Request) {
+	var body createExportRequest
+	if !s.readAdminBody(w, r, &body) {
+		return
+	}
+	req, err := s.escrow.CreateExport(r.Context(), body.Address, body.Recipient)
+	s.replyAdmin(r.Context(), w, req, err, http.StatusCreated)
+}
+
+func (s *rpcServer) adminGetExport(w http.ResponseWriter, r *http.Request) {
+	req, err := s.escrow.GetExport(r.Context(), mux.Vars(r)["id"])
+	s.replyAdmin(r.Context(), w, req, err, http.StatusOK)
+}
+
+func (s *rpcServer) adminApproveExport(w http.ResponseWriter, r *http.Request) {
+	var body approveExportRequest
+	if !s.readAdminBody(w, r, &body) {
+		return
+	}
+	req, err := s.escrow.Approve(r.Context(), mux.Vars(r)["id"], body.Signature)
+	s.replyAdmin(r.Context(), w, req, err, http.StatusOK)
+}
+
+func (s *rpcServer) adminExport(w http.ResponseWriter, r *http.Request) {
+	res, err := s.escrow.Export(r.Context(), mux.Vars(r)["id"])
+	s.replyAdmin(r.Context(), w, res, err, http.StatusOK)
+}
+
+func (s *rpcServer) readAdminBody(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	b, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = s.json.Unmarshal(b, body)
+	}
+	if err != nil {
+		s.replyAdminError(r.Context(), w, i18n.WrapError(r.Context(), err, signermsgs.MsgInvalidRequest), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *rpcServer) replyAdmin(ctx context.Context, w http.ResponseWriter, result interface{}, err error, status int) {
+	if err != nil {
+		status = http.StatusInternalServerError
+		var ffErr i18n.FFError
+		if errors.As(err, &ffErr) {
+			status = ffErr.HTTPStatus()
+		}
+		s.replyAdminError(ctx, w, err, status)
+		return
+	}
+	s.writeAdminJSON(w, result, status)
+}
+
+func (s *rpcServer) replyAdminError(ctx context.Context, w http.ResponseWriter, err error, status int) {
+	log.L(ctx).Errorf("Admin request failed: %s", err)
+	s.writeAdminJSON(w, &fftypes.RESTError{Error: err.Error()}, status)
+}
+
+func (s *rpcServer) writeAdminJSON(w http.ResponseWriter, result interface{}, status int) {
+	b, _ := s.json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
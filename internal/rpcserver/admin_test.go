@@ -0,0 +1,199 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/httpserver"
+	"github.com/hyperledger/firefly-signer/internal/escrow"
+	"github.com/hyperledger/firefly-signer/internal/signedconfig"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testEscrowWallet struct {
+	ethsignermocks.Wallet
+	key *secp256k1.KeyPair
+}
+
+func (w *testEscrowWallet) GetWalletFile(ctx context.Context, addr ethtypes.Address0xHex) (keystorev3.WalletFile, error) {
+	return keystorev3.NewWalletFileLight("", w.key), nil
+}
+
+func newTestAdminServer(t *testing.T) (*rpcServer, *secp256k1.KeyPair, *secp256k1.KeyPair, func()) {
+	signerconfig.Reset()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	adminPort := strings.Split(ln.Addr().String(), ":")[1]
+	ln.Close()
+	signerconfig.ServerConfig.Set(httpserver.HTTPConfPort, 0)
+	signerconfig.ServerConfig.Set(httpserver.HTTPConfAddress, "127.0.0.1")
+	signerconfig.AdminConfig.Set(httpserver.HTTPConfPort, adminPort)
+	signerconfig.AdminConfig.Set(httpserver.HTTPConfAddress, "127.0.0.1")
+
+	approver, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	key, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	config.Set(signerconfig.AdminEnabled, true)
+	config.Set(signerconfig.AdminEscrowApprovers, []string{approver.Address.String()})
+	config.Set(signerconfig.AdminEscrowThreshold, 1)
+	config.Set(signerconfig.BackendChainID, 12345)
+
+	w := &testEscrowWallet{key: key}
+	w.On("Initialize", mock.Anything).Return(nil)
+	w.On("Close").Return(nil)
+	ss, err := NewServer(context.Background(), w)
+	assert.NoError(t, err)
+	s := ss.(*rpcServer)
+	return s, approver, key, func() {
+		s.Stop()
+		_ = s.WaitStop()
+	}
+}
+
+func adminRequest(t *testing.T, s *rpcServer, method, path string, body interface{}, result interface{}) int {
+	var b []byte
+	switch v := body.(type) {
+	case nil:
+	case string:
+		b = []byte(v)
+	default:
+		b, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	res := httptest.NewRecorder()
+	s.adminRouter().ServeHTTP(res, req)
+	if result != nil {
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), result))
+	}
+	return res.Code
+}
+
+func TestAdminEscrowExportOK(t *testing.T) {
+	s, approver, key, done := newTestAdminServer(t)
+	defer done()
+	err := s.Start()
+	assert.NoError(t, err)
+
+	recipient, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	var req escrow.ExportRequest
+	status := adminRequest(t, s, http.MethodPost, "/escrow/exports", map[string]interface{}{
+		"address":   key.Address.String(),
+		"recipient": ethtypes.HexBytes0xPrefix(recipient.PublicKey.SerializeCompressed()).String(),
+	}, &req)
+	assert.Equal(t, http.StatusCreated, status)
+
+	var errRes map[string]interface{}
+	status = adminRequest(t, s, http.MethodPost, fmt.Sprintf("/escrow/exports/%s/export", req.ID), nil, &errRes)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Regexp(t, "FF22112", errRes["error"])
+
+	sig, err := signedconfig.Sign(approver, []byte(req.Message))
+	assert.NoError(t, err)
+	status = adminRequest(t, s, http.MethodPost, fmt.Sprintf("/escrow/exports/%s/approvals", req.ID), map[string]interface{}{
+		"signature": sig,
+	}, &req)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, req.Approvals, 1)
+
+	var res escrow.ExportResult
+	status = adminRequest(t, s, http.MethodPost, fmt.Sprintf("/escrow/exports/%s/export", req.ID), nil, &res)
+	assert.Equal(t, http.StatusOK, status)
+	decrypted, err := recipient.Decrypt(res.EncryptedKey)
+	assert.NoError(t, err)
+	assert.Equal(t, key.PrivateKeyBytes(), decrypted)
+
+	status = adminRequest(t, s, http.MethodGet, fmt.Sprintf("/escrow/exports/%s", req.ID), nil, &req)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, req.Exported)
+}
+
+func TestAdminEscrowErrors(t *testing.T) {
+	s, _, _, done := newTestAdminServer(t)
+	defer done()
+
+	var errRes map[string]interface{}
+	status := adminRequest(t, s, http.MethodGet, "/escrow/exports/unknown", nil, &errRes)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Regexp(t, "FF22108", errRes["error"])
+
+	status = adminRequest(t, s, http.MethodPost, "/escrow/exports", "!json", &errRes)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Regexp(t, "FF22018", errRes["error"])
+
+	status = adminRequest(t, s, http.MethodPost, "/escrow/exports/unknown/approvals", "!json", &errRes)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Regexp(t, "FF22018", errRes["error"])
+
+	status = adminRequest(t, s, http.MethodPost, "/escrow/exports", map[string]interface{}{
+		"address":   "0x0000000000000000000000000000000000000000",
+		"recipient": "0x01",
+	}, &errRes)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Regexp(t, "FF22109", errRes["error"])
+}
+
+func TestAdminUnsupportedWallet(t *testing.T) {
+	signerconfig.Reset()
+	config.Set(signerconfig.AdminEnabled, true)
+	_, err := NewServer(context.Background(), &ethsignermocks.Wallet{})
+	assert.Regexp(t, "FF22116", err)
+}
+
+func TestAdminBadApprover(t *testing.T) {
+	signerconfig.Reset()
+	config.Set(signerconfig.AdminEnabled, true)
+	config.Set(signerconfig.AdminEscrowApprovers, []string{"!address"})
+	_, err := NewServer(context.Background(), &testEscrowWallet{})
+	assert.Regexp(t, "FF22118", err)
+}
+
+func TestAdminBadThreshold(t *testing.T) {
+	signerconfig.Reset()
+	config.Set(signerconfig.AdminEnabled, true)
+	_, err := NewServer(context.Background(), &testEscrowWallet{})
+	assert.Regexp(t, "FF22115", err)
+}
+
+func TestAdminBadServerConfig(t *testing.T) {
+	signerconfig.Reset()
+	config.Set(signerconfig.AdminEnabled, true)
+	config.Set(signerconfig.AdminEscrowApprovers, []string{"0x0000000000000000000000000000000000000000"})
+	config.Set(signerconfig.AdminEscrowThreshold, 1)
+	signerconfig.AdminConfig.Set(httpserver.HTTPConfAddress, "::::")
+	_, err := NewServer(context.Background(), &testEscrowWallet{})
+	assert.Error(t, err)
+}
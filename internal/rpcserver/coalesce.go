@@ -0,0 +1,139 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+)
+
+const (
+	metricsSubsystemCoalesce = "coalesce"
+	metricCoalescedRequests  = "requests_total"
+	metricLabelMethod        = "method"
+)
+
+// requestCoalescer shares a single call to the backend between identical read requests that are in
+// flight at the same time, so clients polling the same data do not each cost an upstream call. Only
+// concurrent requests are shared - nothing is cached after the response is returned.
+type requestCoalescer struct {
+	mux      sync.Mutex
+	methods  map[string]bool
+	inflight map[string]*coalescedCall
+	metrics  metric.MetricsManager // nil unless metrics are enabled
+}
+
+type coalescedCall struct {
+	done    chan struct{}
+	waiters int // the number of other callers sharing the response
+	res     *rpcbackend.RPCResponse
+	err     error
+}
+
+func newRequestCoalescer(ctx context.Context, methods []string, registry metric.MetricsRegistry) (*requestCoalescer, error) {
+	rc := &requestCoalescer{
+		methods:  make(map[string]bool, len(methods)),
+		inflight: make(map[string]*coalescedCall),
+	}
+	for _, method := range methods {
+		rc.methods[method] = true
+	}
+	if registry != nil {
+		mm, err := registry.NewMetricsManagerForSubsystem(ctx, metricsSubsystemCoalesce)
+		if err != nil {
+			return nil, err
+		}
+		mm.NewCounterMetricWithLabels(ctx, metricCoalescedRequests, "Number of requests answered with the response to an identical request that was already in flight", []string{metricLabelMethod}, false)
+		rc.metrics = mm
+	}
+	return rc, nil
+}
+
+// coalesceKey identifies identical requests by the method and params (which include the block),
+// ignoring the request ID and any whitespace in the params
+func coalesceKey(rpcReq *rpcbackend.RPCRequest) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString(rpcReq.Method)
+	for _, p := range rpcReq.Params {
+		buf.WriteByte(0)
+		if p == nil || json.Compact(buf, p.Bytes()) != nil {
+			buf.WriteString(p.String())
+		}
+	}
+	return buf.String()
+}
+
+// do calls the backend for the request, unless an identical request is already in flight in which case
+// it waits for that response. The shared call is not canceled if the caller that started it gives up,
+// as other callers might be waiting for the response.
+func (rc *requestCoalescer) do(ctx context.Context, rpcReq *rpcbackend.RPCRequest, syncRequest func(context.Context, *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error)) (*rpcbackend.RPCResponse, error) {
+	if !rc.methods[rpcReq.Method] {
+		return syncRequest(ctx, rpcReq)
+	}
+
+	key := coalesceKey(rpcReq)
+	rc.mux.Lock()
+	call, inflight := rc.inflight[key]
+	if inflight {
+		call.waiters++
+	} else {
+		call = &coalescedCall{done: make(chan struct{})}
+		rc.inflight[key] = call
+	}
+	rc.mux.Unlock()
+
+	if inflight {
+		if rc.metrics != nil {
+			rc.metrics.IncCounterMetricWithLabels(ctx, metricCoalescedRequests, map[string]string{metricLabelMethod: rpcReq.Method}, nil)
+		}
+	} else {
+		sharedReq := *rpcReq
+		go func() {
+			call.res, call.err = syncRequest(context.WithoutCancel(ctx), &sharedReq)
+			rc.mux.Lock()
+			delete(rc.inflight, key)
+			waiters := call.waiters
+			rc.mux.Unlock()
+			if waiters > 0 {
+				log.L(ctx).Debugf("Shared the response to %s with %d identical requests", rpcReq.Method, waiters)
+			}
+			close(call.done)
+		}()
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		err := i18n.NewError(ctx, signermsgs.MsgCoalescedRequestCanceled, rpcReq.Method)
+		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInternalError), err
+	}
+	if call.res == nil {
+		return nil, call.err
+	}
+	// Each caller gets the response with its own request ID
+	res := *call.res
+	res.ID = rpcReq.ID
+	return &res, call.err
+}
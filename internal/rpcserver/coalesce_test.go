@@ -0,0 +1,242 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/mocks/rpcbackendmocks"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (rc *requestCoalescer) waiters(rpcReq *rpcbackend.RPCRequest) int {
+	rc.mux.Lock()
+	defer rc.mux.Unlock()
+	if call := rc.inflight[coalesceKey(rpcReq)]; call != nil {
+		return call.waiters
+	}
+	return -1
+}
+
+func ethCallRequest(id int, params string) *rpcbackend.RPCRequest {
+	return &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr(fmt.Sprintf("%d", id)),
+		Method: "eth_call",
+		Params: []*fftypes.JSONAny{fftypes.JSONAnyPtr(params), fftypes.JSONAnyPtr(`"latest"`)},
+	}
+}
+
+// blockingBackend returns a SyncRequest function that counts the calls, and blocks until released
+func blockingBackend() (func(context.Context, *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error), func() int, chan struct{}) {
+	var mux sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	return func(_ context.Context, rpcReq *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error) {
+			mux.Lock()
+			calls++
+			mux.Unlock()
+			<-release
+			return &rpcbackend.RPCResponse{JSONRpc: "2.0", ID: rpcReq.ID, Result: fftypes.JSONAnyPtr(`"0x1234"`)}, nil
+		}, func() int {
+			mux.Lock()
+			defer mux.Unlock()
+			return calls
+		}, release
+}
+
+func TestCoalesceIdenticalRequests(t *testing.T) {
+
+	rc, err := newRequestCoalescer(context.Background(), []string{"eth_call"}, nil)
+	assert.NoError(t, err)
+	syncRequest, calls, release := blockingBackend()
+
+	// Whitespace and request IDs do not matter
+	var wg sync.WaitGroup
+	responses := make([]*rpcbackend.RPCResponse, 3)
+	for i, params := range []string{`{"to":"0x01","data":"0xabcd"}`, `{"to": "0x01", "data": "0xabcd"}`, `{ "to":"0x01","data":"0xabcd" }`} {
+		wg.Add(1)
+		go func(i int, params string) {
+			defer wg.Done()
+			res, err := rc.do(context.Background(), ethCallRequest(i, params), syncRequest)
+			assert.NoError(t, err)
+			responses[i] = res
+		}(i, params)
+		for rc.waiters(ethCallRequest(i, params)) < i {
+			time.Sleep(1 * time.Millisecond)
+		}
+	}
+
+	// A different block is a different request
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rpcReq := ethCallRequest(3, `{"to":"0x01","data":"0xabcd"}`)
+		rpcReq.Params[1] = fftypes.JSONAnyPtr(`"0x10"`)
+		_, err := rc.do(context.Background(), rpcReq, syncRequest)
+		assert.NoError(t, err)
+	}()
+	for calls() < 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 2, calls())
+	for i, res := range responses {
+		assert.Equal(t, fmt.Sprintf("%d", i), res.ID.String())
+		assert.Equal(t, `"0x1234"`, res.Result.String())
+	}
+	assert.Empty(t, rc.inflight)
+
+	// Nothing is cached once the response is returned
+	_, err = rc.do(context.Background(), ethCallRequest(4, `{"to":"0x01","data":"0xabcd"}`), syncRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls())
+
+}
+
+func TestCoalesceOtherMethodsNotShared(t *testing.T) {
+
+	rc, err := newRequestCoalescer(context.Background(), []string{"eth_getBalance"}, nil)
+	assert.NoError(t, err)
+	syncRequest, calls, release := blockingBackend()
+	close(release)
+
+	_, err = rc.do(context.Background(), ethCallRequest(1, `{}`), syncRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls())
+	assert.Empty(t, rc.inflight)
+
+}
+
+func TestCoalesceWaiterCanceled(t *testing.T) {
+
+	rc, err := newRequestCoalescer(context.Background(), []string{"eth_call"}, nil)
+	assert.NoError(t, err)
+	syncRequest, calls, release := blockingBackend()
+
+	// The first caller giving up does not cancel the call shared with the others
+	ctx1, cancelCtx1 := context.WithCancel(context.Background())
+	ctx2, cancelCtx2 := context.WithCancel(context.Background())
+	results := make(chan error)
+	for _, ctx := range []context.Context{ctx1, ctx2, context.Background()} {
+		go func(ctx context.Context) {
+			_, err := rc.do(ctx, ethCallRequest(1, `{}`), syncRequest)
+			results <- err
+		}(ctx)
+	}
+	for rc.waiters(ethCallRequest(1, `{}`)) < 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	cancelCtx1()
+	cancelCtx2()
+	assert.Regexp(t, "FF22178", <-results)
+	assert.Regexp(t, "FF22178", <-results)
+
+	close(release)
+	assert.NoError(t, <-results)
+	assert.Equal(t, 1, calls())
+
+}
+
+func TestCoalesceError(t *testing.T) {
+
+	rc, err := newRequestCoalescer(context.Background(), []string{"eth_call"}, nil)
+	assert.NoError(t, err)
+
+	_, err = rc.do(context.Background(), ethCallRequest(1, `{}`), func(_ context.Context, _ *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error) {
+		return nil, fmt.Errorf("pop")
+	})
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestCoalesceMetrics(t *testing.T) {
+
+	registry := metric.NewPrometheusMetricsRegistry("ffsigner")
+	rc, err := newRequestCoalescer(context.Background(), []string{"eth_call"}, registry)
+	assert.NoError(t, err)
+	syncRequest, _, release := blockingBackend()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := rc.do(context.Background(), ethCallRequest(1, `{}`), syncRequest)
+			assert.NoError(t, err)
+		}()
+	}
+	for rc.waiters(ethCallRequest(1, `{}`)) < 1 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	handler, err := registry.HTTPHandler(context.Background(), promhttp.HandlerOpts{})
+	assert.NoError(t, err)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Regexp(t, `ff_coalesce_requests_total\{[^}]*method="eth_call"[^}]*\} 1`, res.Body.String())
+
+	_, err = newRequestCoalescer(context.Background(), []string{"eth_call"}, registry)
+	assert.Error(t, err)
+
+}
+
+func TestCoalesceProcessRPC(t *testing.T) {
+
+	_, s, done := newTestServer(t, func() {
+		config.Set(signerconfig.ServerCoalesceEnabled, true)
+	})
+	defer done()
+	assert.NotNil(t, s.coalescer)
+
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.On("SyncRequest", mock.Anything, mock.Anything).Return(&rpcbackend.RPCResponse{
+		JSONRpc: "2.0",
+		ID:      fftypes.JSONAnyPtr("1"),
+		Result:  fftypes.JSONAnyPtr(`"0x1234"`),
+	}, nil)
+
+	rpcRes, err := s.processRPC(s.ctx, ethCallRequest(2, `{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "2", rpcRes.ID.String())
+	assert.Equal(t, `"0x1234"`, rpcRes.Result.String())
+
+}
+
+func TestCoalesceKey(t *testing.T) {
+
+	assert.Equal(t, "eth_call\x00{\"a\":1}\x00null\x00not json", coalesceKey(&rpcbackend.RPCRequest{
+		Method: "eth_call",
+		Params: []*fftypes.JSONAny{fftypes.JSONAnyPtr(`{ "a": 1 }`), nil, fftypes.JSONAnyPtr(`not json`)},
+	}))
+
+}
@@ -0,0 +1,140 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate" // the zlib format, per RFC 9110
+)
+
+// compressedResponseWriter compresses everything written to it, once the headers are sent
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	writer   io.WriteCloser
+}
+
+func (cw *compressedResponseWriter) WriteHeader(status int) {
+	h := cw.Header()
+	h.Del("Content-Length") // set by the handler for the uncompressed body
+	h.Set("Content-Encoding", cw.encoding)
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressedResponseWriter) Write(b []byte) (int, error) {
+	if cw.writer == nil {
+		if cw.Header().Get("Content-Encoding") == "" {
+			cw.WriteHeader(http.StatusOK)
+		}
+		if cw.encoding == encodingGzip {
+			cw.writer = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			cw.writer = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+	return cw.writer.Write(b)
+}
+
+func (cw *compressedResponseWriter) close() error {
+	if cw.writer == nil {
+		return nil
+	}
+	return cw.writer.Close()
+}
+
+// negotiateEncoding returns the response encoding to use from the Accept-Encoding header, preferring gzip
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(entry, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, p := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				q, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+		accepted[coding] = q > 0
+	}
+	switch {
+	case accepted[encodingGzip], accepted["*"]:
+		return encodingGzip
+	case accepted[encodingDeflate]:
+		return encodingDeflate
+	default:
+		return ""
+	}
+}
+
+// compressionMiddleware decompresses gzip/deflate request bodies, and (when enabled) compresses the
+// response with the encoding negotiated from the Accept-Encoding header
+func (s *rpcServer) compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var err error
+		switch encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding {
+		case "", "identity":
+		case encodingGzip:
+			r.Body, err = gzip.NewReader(r.Body)
+		case encodingDeflate:
+			r.Body, err = zlib.NewReader(r.Body)
+		default:
+			s.replyRPC(ctx, w, rpcbackend.RPCErrorResponse(
+				i18n.NewError(ctx, signermsgs.MsgUnsupportedContentEncoding, encoding),
+				fftypes.JSONAnyPtr("1"), // the request has not been read
+				rpcbackend.RPCCodeInvalidRequest,
+			), http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			s.replyRPCParseError(ctx, w, nil)
+			return
+		}
+		r.Header.Del("Content-Encoding")
+
+		// Upgrade requests (such as h2c) need the original writer, to take over the connection
+		encoding := ""
+		if s.compressResponses && r.Header.Get("Upgrade") == "" {
+			encoding = negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		}
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressedResponseWriter{ResponseWriter: w, encoding: encoding}
+		next.ServeHTTP(cw, r)
+		if err := cw.close(); err != nil {
+			log.L(ctx).Errorf("Failed to complete compressed response: %s", err)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/http2"
+)
+
+const testEthAccountsRequest = `{"jsonrpc":"2.0","id":1,"method":"eth_accounts"}`
+
+func newTestCompressionServer(t *testing.T, setConfig ...func()) (string, *rpcServer, func()) {
+	url, s, done := newTestServer(t, setConfig...)
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Initialize", mock.Anything).Return(nil)
+	w.On("GetAccounts", mock.Anything).Return([]*ethtypes.Address0xHex{
+		ethtypes.MustNewAddress("0xFB075BB99F2AA4C49955BF703509A227D7A12248"),
+	}, nil)
+	s.chainID = big.NewInt(1)
+	err := s.Start()
+	assert.NoError(t, err)
+	return url, s, done
+}
+
+func postEncoded(t *testing.T, url, contentEncoding, acceptEncoding string, body []byte) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	// Disable the transparent decompression of the client, to see the response as sent
+	res, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+	assert.NoError(t, err)
+	return res
+}
+
+func TestGzipRequestAndResponse(t *testing.T) {
+	url, _, done := newTestCompressionServer(t, func() {
+		config.Set(signerconfig.ServerCompressionEnabled, true)
+	})
+	defer done()
+
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	_, _ = gw.Write([]byte(testEthAccountsRequest))
+	gw.Close()
+
+	res := postEncoded(t, url, "gzip", "deflate;q=0.5, gzip", buf.Bytes())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Contains(t, res.Header.Values("Vary"), "Accept-Encoding")
+	gr, err := gzip.NewReader(res.Body)
+	assert.NoError(t, err)
+	b, err := io.ReadAll(gr)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":["0xfb075bb99f2aa4c49955bf703509a227d7a12248"]}`, string(b))
+}
+
+func TestDeflateRequestAndResponse(t *testing.T) {
+	url, _, done := newTestCompressionServer(t, func() {
+		config.Set(signerconfig.ServerCompressionEnabled, true)
+	})
+	defer done()
+
+	buf := new(bytes.Buffer)
+	zw := zlib.NewWriter(buf)
+	_, _ = zw.Write([]byte(testEthAccountsRequest))
+	zw.Close()
+
+	res := postEncoded(t, url, "deflate", "gzip;q=0, deflate", buf.Bytes())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "deflate", res.Header.Get("Content-Encoding"))
+	zr, err := zlib.NewReader(res.Body)
+	assert.NoError(t, err)
+	b, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+}
+
+func TestResponseCompressionDisabled(t *testing.T) {
+	url, _, done := newTestCompressionServer(t)
+	defer done()
+
+	res := postEncoded(t, url, "", "gzip", []byte(testEthAccountsRequest))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Content-Encoding"))
+	b, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+}
+
+func TestResponseNotAcceptable(t *testing.T) {
+	url, _, done := newTestCompressionServer(t, func() {
+		config.Set(signerconfig.ServerCompressionEnabled, true)
+	})
+	defer done()
+
+	res := postEncoded(t, url, "identity", "br", []byte(testEthAccountsRequest))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Content-Encoding"))
+}
+
+func TestUnsupportedContentEncoding(t *testing.T) {
+	url, _, done := newTestCompressionServer(t)
+	defer done()
+
+	res := postEncoded(t, url, "br", "", []byte(testEthAccountsRequest))
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	b, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "FF22120")
+}
+
+func TestBadGzipRequest(t *testing.T) {
+	url, _, done := newTestCompressionServer(t)
+	defer done()
+
+	res := postEncoded(t, url, "gzip", "", []byte(testEthAccountsRequest))
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestCompressedWriterNoBody(t *testing.T) {
+	cw := &compressedResponseWriter{encoding: encodingGzip}
+	assert.NoError(t, cw.close())
+}
+
+func TestCompressedWriterImplicitHeader(t *testing.T) {
+	rec := httptest.NewRecorder()
+	cw := &compressedResponseWriter{ResponseWriter: rec, encoding: encodingGzip}
+	_, err := cw.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, cw.close())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate"))
+	assert.Equal(t, "gzip", negotiateEncoding("deflate, GZIP;q=0.1"))
+	assert.Equal(t, "gzip", negotiateEncoding("*"))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0, deflate"))
+	assert.Equal(t, "", negotiateEncoding("gzip;q=0"))
+	assert.Equal(t, "", negotiateEncoding("br"))
+	assert.Equal(t, "", negotiateEncoding(""))
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	url, _, done := newTestCompressionServer(t, func() {
+		config.Set(signerconfig.ServerH2C, true)
+	})
+	defer done()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	res, err := client.Post(url, "application/json", strings.NewReader(testEthAccountsRequest))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 2, res.ProtoMajor)
+	b, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+}
+
+func TestH2CDisabled(t *testing.T) {
+	url, _, done := newTestCompressionServer(t)
+	defer done()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	_, err := client.Post(url, "application/json", strings.NewReader(testEthAccountsRequest))
+	assert.Error(t, err)
+}
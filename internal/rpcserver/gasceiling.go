@@ -0,0 +1,264 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+)
+
+const (
+	gasOracleGasPrice   = "gasPrice"
+	gasOracleFeeHistory = "feeHistory"
+	gasOracleHTTP       = "http"
+
+	gasCeilingReject = "reject"
+	gasCeilingClamp  = "clamp"
+
+	metricsSubsystemGasCeiling   = "gas_ceiling"
+	metricGasCeilingTransactions = "transactions_total"
+	metricLabelAction            = "action"
+)
+
+var gasUnits = map[string]*big.Float{
+	"wei":  big.NewFloat(1),
+	"gwei": big.NewFloat(1e9),
+}
+
+// gasCeiling protects against fat-fingered fee fields, by rejecting (or clamping) transactions with a fee
+// above a multiple of the current gas price from an oracle. The oracle gas price is cached for the refresh
+// interval, and transactions are rejected if it cannot be fetched.
+type gasCeiling struct {
+	oracleName      string
+	oracle          func(ctx context.Context, backend rpcbackend.Backend) (*big.Int, error)
+	multiplier      *big.Float
+	clamp           bool
+	refreshInterval time.Duration
+	percentile      float64
+	httpClient      *resty.Client
+	httpField       []string
+	httpUnit        *big.Float
+	metrics         metric.MetricsManager // nil unless metrics are enabled
+
+	mux     sync.Mutex
+	price   *big.Int
+	expires time.Time
+}
+
+func newGasCeiling(ctx context.Context, registry metric.MetricsRegistry) (gc *gasCeiling, err error) {
+	gc = &gasCeiling{
+		oracleName:      config.GetString(signerconfig.GasCeilingOracle),
+		multiplier:      big.NewFloat(config.GetFloat64(signerconfig.GasCeilingMultiplier)),
+		refreshInterval: config.GetDuration(signerconfig.GasCeilingRefreshInterval),
+		percentile:      config.GetFloat64(signerconfig.GasCeilingFeeHistoryPercentile),
+	}
+	if gc.multiplier.Sign() <= 0 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgGasCeilingBadConfig, "multiplier", gc.multiplier)
+	}
+	switch action := config.GetString(signerconfig.GasCeilingAction); action {
+	case gasCeilingReject:
+	case gasCeilingClamp:
+		gc.clamp = true
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgGasCeilingBadConfig, "action", action)
+	}
+	switch gc.oracleName {
+	case gasOracleGasPrice:
+		gc.oracle = gc.gasPriceOracle
+	case gasOracleFeeHistory:
+		if gc.percentile < 0 || gc.percentile > 100 {
+			return nil, i18n.NewError(ctx, signermsgs.MsgGasCeilingBadConfig, "feeHistoryPercentile", gc.percentile)
+		}
+		gc.oracle = gc.feeHistoryOracle
+	case gasOracleHTTP:
+		unit := config.GetString(signerconfig.GasCeilingHTTPUnit)
+		if gc.httpUnit = gasUnits[unit]; gc.httpUnit == nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgGasCeilingBadConfig, "httpUnit", unit)
+		}
+		field := config.GetString(signerconfig.GasCeilingHTTPField)
+		if field == "" {
+			return nil, i18n.NewError(ctx, signermsgs.MsgGasCeilingBadConfig, "httpField", field)
+		}
+		gc.httpField = strings.Split(field, ".")
+		if gc.httpClient, err = ffresty.New(ctx, signerconfig.GasCeilingHTTPConfig); err != nil {
+			return nil, err
+		}
+		gc.oracle = gc.httpOracle
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgGasCeilingBadConfig, "oracle", gc.oracleName)
+	}
+	if registry != nil {
+		mm, err := registry.NewMetricsManagerForSubsystem(ctx, metricsSubsystemGasCeiling)
+		if err != nil {
+			return nil, err
+		}
+		mm.NewCounterMetricWithLabels(ctx, metricGasCeilingTransactions, "Number of transactions with fees above the gas price ceiling, by the action taken", []string{metricLabelAction}, false)
+		gc.metrics = mm
+	}
+	return gc, nil
+}
+
+// check rejects the transaction if any of its fees is above the ceiling, or lowers them to the ceiling
+// if clamping. Transactions without fees are not checked, as the node sets the fees.
+func (gc *gasCeiling) check(ctx context.Context, backend rpcbackend.Backend, txn *ethsigner.Transaction) error {
+	fees := []struct {
+		name  string
+		value **ethtypes.HexInteger
+	}{
+		{name: "gasPrice", value: &txn.GasPrice},
+		{name: "maxFeePerGas", value: &txn.MaxFeePerGas},
+		{name: "maxPriorityFeePerGas", value: &txn.MaxPriorityFeePerGas},
+	}
+	if txn.GasPrice == nil && txn.MaxFeePerGas == nil && txn.MaxPriorityFeePerGas == nil {
+		return nil
+	}
+	price, err := gc.gasPrice(ctx, backend)
+	if err != nil {
+		return err
+	}
+	ceiling, _ := new(big.Float).Mul(new(big.Float).SetInt(price), gc.multiplier).Int(nil)
+	clamped := false
+	for _, fee := range fees {
+		value := *fee.value
+		if value == nil || value.BigInt().Cmp(ceiling) <= 0 {
+			continue
+		}
+		if !gc.clamp {
+			gc.count(ctx, gasCeilingReject)
+			return i18n.NewError(ctx, signermsgs.MsgGasPriceAboveCeiling, fee.name, value.BigInt(), ceiling, gc.multiplier, price)
+		}
+		log.L(ctx).Warnf("Clamping %s of %s to the ceiling of %s (%s x the oracle gas price of %s)", fee.name, value.BigInt(), ceiling, gc.multiplier, price)
+		*fee.value = ethtypes.NewHexInteger(ceiling)
+		clamped = true
+	}
+	if clamped {
+		gc.count(ctx, gasCeilingClamp)
+	}
+	return nil
+}
+
+func (gc *gasCeiling) count(ctx context.Context, action string) {
+	if gc.metrics != nil {
+		gc.metrics.IncCounterMetricWithLabels(ctx, metricGasCeilingTransactions, map[string]string{metricLabelAction: action}, nil)
+	}
+}
+
+// gasPrice returns the cached oracle gas price, fetching it again if it is older than the refresh interval
+func (gc *gasCeiling) gasPrice(ctx context.Context, backend rpcbackend.Backend) (*big.Int, error) {
+	gc.mux.Lock()
+	defer gc.mux.Unlock()
+	if gc.price != nil && time.Now().Before(gc.expires) {
+		return gc.price, nil
+	}
+	price, err := gc.oracle(ctx, backend)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgGasOracleFailed, gc.oracleName, err)
+	}
+	log.L(ctx).Debugf("Gas price from the %s oracle: %s", gc.oracleName, price)
+	gc.price = price
+	gc.expires = time.Now().Add(gc.refreshInterval)
+	return price, nil
+}
+
+func (gc *gasCeiling) gasPriceOracle(ctx context.Context, backend rpcbackend.Backend) (*big.Int, error) {
+	var price ethtypes.HexInteger
+	if rpcErr := backend.CallRPC(ctx, &price, "eth_gasPrice"); rpcErr != nil {
+		return nil, rpcErr.Error()
+	}
+	return price.BigInt(), nil
+}
+
+type feeHistory struct {
+	BaseFeePerGas []*ethtypes.HexInteger   `json:"baseFeePerGas"`
+	Reward        [][]*ethtypes.HexInteger `json:"reward"`
+}
+
+// feeHistoryOracle returns the base fee of the next block, plus the percentile of the priority fees in the latest block
+func (gc *gasCeiling) feeHistoryOracle(ctx context.Context, backend rpcbackend.Backend) (*big.Int, error) {
+	var history feeHistory
+	if rpcErr := backend.CallRPC(ctx, &history, "eth_feeHistory", ethtypes.NewHexInteger64(1), "latest", []float64{gc.percentile}); rpcErr != nil {
+		return nil, rpcErr.Error()
+	}
+	if len(history.BaseFeePerGas) == 0 {
+		return nil, fmt.Errorf("no baseFeePerGas in the fee history")
+	}
+	price := new(big.Int).Set(history.BaseFeePerGas[len(history.BaseFeePerGas)-1].BigInt())
+	if len(history.Reward) > 0 && len(history.Reward[0]) > 0 {
+		price.Add(price, history.Reward[0][0].BigInt())
+	}
+	return price, nil
+}
+
+// httpOracle returns the gas price from a field of the JSON returned by the external feed
+func (gc *gasCeiling) httpOracle(ctx context.Context, _ rpcbackend.Backend) (*big.Int, error) {
+	res, err := gc.httpClient.R().SetContext(ctx).Get("")
+	if err != nil {
+		return nil, err
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("%s", res.Status())
+	}
+	decoder := json.NewDecoder(strings.NewReader(res.String()))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	for _, name := range gc.httpField {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no field '%s' in the response", strings.Join(gc.httpField, "."))
+		}
+		value = obj[name]
+	}
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		text = v.String()
+	case string:
+		text = v
+	default:
+		return nil, fmt.Errorf("no field '%s' in the response", strings.Join(gc.httpField, "."))
+	}
+	if strings.HasPrefix(text, "0x") {
+		if price, ok := new(big.Int).SetString(text, 0); ok {
+			wei, _ := new(big.Float).Mul(new(big.Float).SetInt(price), gc.httpUnit).Int(nil)
+			return wei, nil
+		}
+	} else if price, ok := new(big.Float).SetString(text); ok {
+		wei, _ := new(big.Float).Mul(price, gc.httpUnit).Int(nil)
+		return wei, nil
+	}
+	return nil, fmt.Errorf("invalid gas price '%s' in field '%s'", text, strings.Join(gc.httpField, "."))
+}
@@ -0,0 +1,313 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/mocks/rpcbackendmocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestGasCeiling(t *testing.T, setConfig ...func()) *gasCeiling {
+	signerconfig.Reset()
+	config.Set(signerconfig.GasCeilingEnabled, true)
+	for _, fn := range setConfig {
+		fn()
+	}
+	gc, err := newGasCeiling(context.Background(), nil)
+	assert.NoError(t, err)
+	return gc
+}
+
+func mockGasPrice(bm *rpcbackendmocks.Backend, price int64) *mock.Call {
+	return bm.On("CallRPC", mock.Anything, mock.Anything, "eth_gasPrice").Run(func(args mock.Arguments) {
+		args[1].(*ethtypes.HexInteger).BigInt().SetInt64(price)
+	}).Return(nil)
+}
+
+func TestGasCeilingRejectGasPrice(t *testing.T) {
+
+	gc := newTestGasCeiling(t)
+	bm := &rpcbackendmocks.Backend{}
+	mockGasPrice(bm, 1000).Once()
+
+	// At the ceiling of 3x is allowed, and the oracle price is cached
+	err := gc.check(context.Background(), bm, &ethsigner.Transaction{GasPrice: ethtypes.NewHexInteger64(3000)})
+	assert.NoError(t, err)
+
+	err = gc.check(context.Background(), bm, &ethsigner.Transaction{GasPrice: ethtypes.NewHexInteger64(3001)})
+	assert.Regexp(t, "FF22208.*gasPrice of 3001 exceeds the ceiling of 3000", err)
+
+	err = gc.check(context.Background(), bm, &ethsigner.Transaction{
+		MaxFeePerGas:         ethtypes.NewHexInteger64(2000),
+		MaxPriorityFeePerGas: ethtypes.NewHexInteger64(5000),
+	})
+	assert.Regexp(t, "FF22208.*maxPriorityFeePerGas", err)
+
+	// Transactions without fees are not checked
+	err = gc.check(context.Background(), bm, &ethsigner.Transaction{})
+	assert.NoError(t, err)
+	bm.AssertExpectations(t)
+
+}
+
+func TestGasCeilingClampRefresh(t *testing.T) {
+
+	gc := newTestGasCeiling(t, func() {
+		config.Set(signerconfig.GasCeilingAction, "clamp")
+		config.Set(signerconfig.GasCeilingMultiplier, 1.5)
+		config.Set(signerconfig.GasCeilingRefreshInterval, "0")
+	})
+	bm := &rpcbackendmocks.Backend{}
+	mockGasPrice(bm, 1000).Once()
+	mockGasPrice(bm, 2000).Once()
+
+	txn := &ethsigner.Transaction{
+		MaxFeePerGas:         ethtypes.NewHexInteger64(10000),
+		MaxPriorityFeePerGas: ethtypes.NewHexInteger64(100),
+	}
+	err := gc.check(context.Background(), bm, txn)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), txn.MaxFeePerGas.BigInt().Int64())
+	assert.Equal(t, int64(100), txn.MaxPriorityFeePerGas.BigInt().Int64())
+
+	txn.MaxFeePerGas = ethtypes.NewHexInteger64(10000)
+	err = gc.check(context.Background(), bm, txn)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3000), txn.MaxFeePerGas.BigInt().Int64())
+	bm.AssertExpectations(t)
+
+}
+
+func TestGasCeilingOracleFailed(t *testing.T) {
+
+	gc := newTestGasCeiling(t)
+	bm := &rpcbackendmocks.Backend{}
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_gasPrice").Return(&rpcbackend.RPCError{Message: "pop"})
+
+	err := gc.check(context.Background(), bm, &ethsigner.Transaction{GasPrice: ethtypes.NewHexInteger64(1)})
+	assert.Regexp(t, "FF22209.*gasPrice.*pop", err)
+
+}
+
+func TestGasCeilingFeeHistory(t *testing.T) {
+
+	gc := newTestGasCeiling(t, func() {
+		config.Set(signerconfig.GasCeilingOracle, "feeHistory")
+		config.Set(signerconfig.GasCeilingFeeHistoryPercentile, 75)
+	})
+	bm := &rpcbackendmocks.Backend{}
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_feeHistory", ethtypes.NewHexInteger64(1), "latest", []float64{75}).Run(func(args mock.Arguments) {
+		fh := args[1].(*feeHistory)
+		fh.BaseFeePerGas = []*ethtypes.HexInteger{ethtypes.NewHexInteger64(100), ethtypes.NewHexInteger64(900)}
+		fh.Reward = [][]*ethtypes.HexInteger{{ethtypes.NewHexInteger64(100)}}
+	}).Return(nil)
+
+	err := gc.check(context.Background(), bm, &ethsigner.Transaction{MaxFeePerGas: ethtypes.NewHexInteger64(3000)})
+	assert.NoError(t, err)
+	err = gc.check(context.Background(), bm, &ethsigner.Transaction{MaxFeePerGas: ethtypes.NewHexInteger64(3001)})
+	assert.Regexp(t, "FF22208.*oracle gas price of 1000", err)
+
+}
+
+func TestGasCeilingFeeHistoryErrors(t *testing.T) {
+
+	gc := newTestGasCeiling(t, func() {
+		config.Set(signerconfig.GasCeilingOracle, "feeHistory")
+	})
+	bm := &rpcbackendmocks.Backend{}
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_feeHistory", mock.Anything, mock.Anything, mock.Anything).Return(&rpcbackend.RPCError{Message: "pop"}).Once()
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_feeHistory", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+	_, err := gc.feeHistoryOracle(context.Background(), bm)
+	assert.Regexp(t, "pop", err)
+	_, err = gc.feeHistoryOracle(context.Background(), bm)
+	assert.Regexp(t, "no baseFeePerGas", err)
+
+}
+
+func newTestGasFeed(t *testing.T, status int, body string) *gasCeiling {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(feed.Close)
+	return newTestGasCeiling(t, func() {
+		config.Set(signerconfig.GasCeilingOracle, "http")
+		config.Set(signerconfig.GasCeilingHTTPField, "result.fast")
+		config.Set(signerconfig.GasCeilingHTTPUnit, "gwei")
+		signerconfig.GasCeilingHTTPConfig.Set(ffresty.HTTPConfigURL, feed.URL)
+		signerconfig.GasCeilingHTTPConfig.Set(ffresty.HTTPConfigRetryEnabled, false)
+	})
+}
+
+func TestGasCeilingHTTPOracle(t *testing.T) {
+
+	for body, expected := range map[string]int64{
+		`{"result":{"fast":12.5}}`:   12500000000,
+		`{"result":{"fast":"20"}}`:   20000000000,
+		`{"result":{"fast":"0x10"}}`: 16000000000,
+	} {
+		gc := newTestGasFeed(t, 200, body)
+		price, err := gc.httpOracle(context.Background(), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, price.Int64())
+	}
+
+}
+
+func TestGasCeilingHTTPOracleErrors(t *testing.T) {
+
+	for body, expected := range map[string]string{
+		`{"result":{"fast":true}}`:    "no field 'result.fast'",
+		`{"result":"fast"}`:           "no field 'result.fast'",
+		`{"result":{"fast":"wrong"}}`: "invalid gas price 'wrong'",
+		`{"result":{"fast":"0xzz"}}`:  "invalid gas price '0xzz'",
+		`!json`:                       "invalid character",
+	} {
+		gc := newTestGasFeed(t, 200, body)
+		_, err := gc.httpOracle(context.Background(), nil)
+		assert.Regexp(t, expected, err)
+	}
+
+	gc := newTestGasFeed(t, 500, `{}`)
+	_, err := gc.httpOracle(context.Background(), nil)
+	assert.Regexp(t, "500", err)
+
+	gc.httpClient.SetBaseURL("http://localhost:0")
+	_, err = gc.httpOracle(context.Background(), nil)
+	assert.Error(t, err)
+
+}
+
+func TestGasCeilingBadConfig(t *testing.T) {
+
+	for key, value := range map[config.RootKey]interface{}{
+		signerconfig.GasCeilingMultiplier: 0,
+		signerconfig.GasCeilingAction:     "wrong",
+		signerconfig.GasCeilingOracle:     "wrong",
+	} {
+		signerconfig.Reset()
+		config.Set(key, value)
+		_, err := newGasCeiling(context.Background(), nil)
+		assert.Regexp(t, "FF22210", err)
+	}
+
+	for key, value := range map[config.RootKey]interface{}{
+		signerconfig.GasCeilingFeeHistoryPercentile: 101,
+		signerconfig.GasCeilingHTTPUnit:             "wrong",
+		signerconfig.GasCeilingHTTPField:            "",
+	} {
+		signerconfig.Reset()
+		config.Set(signerconfig.GasCeilingOracle, "feeHistory")
+		if key != signerconfig.GasCeilingFeeHistoryPercentile {
+			config.Set(signerconfig.GasCeilingOracle, "http")
+			config.Set(signerconfig.GasCeilingHTTPField, "fast")
+		}
+		config.Set(key, value)
+		_, err := newGasCeiling(context.Background(), nil)
+		assert.Regexp(t, "FF22210", err)
+	}
+
+	signerconfig.Reset()
+	config.Set(signerconfig.GasCeilingOracle, "http")
+	config.Set(signerconfig.GasCeilingHTTPField, "fast")
+	tlsConf := signerconfig.GasCeilingHTTPConfig.SubSection("tls")
+	tlsConf.Set(fftls.HTTPConfTLSEnabled, true)
+	tlsConf.Set(fftls.HTTPConfTLSCAFile, "!!!!!badness")
+	_, err := newGasCeiling(context.Background(), nil)
+	assert.Regexp(t, "FF00153", err)
+
+	signerconfig.Reset()
+	config.Set(signerconfig.GasCeilingEnabled, true)
+	config.Set(signerconfig.GasCeilingMultiplier, -1)
+	_, err = NewServer(context.Background(), &ethsignermocks.Wallet{})
+	assert.Regexp(t, "FF22210", err)
+
+}
+
+func TestGasCeilingMetrics(t *testing.T) {
+
+	registry := metric.NewPrometheusMetricsRegistry("ffsigner")
+	signerconfig.Reset()
+	config.Set(signerconfig.GasCeilingAction, "clamp")
+	config.Set(signerconfig.GasCeilingRefreshInterval, "1h")
+	gc, err := newGasCeiling(context.Background(), registry)
+	assert.NoError(t, err)
+	bm := &rpcbackendmocks.Backend{}
+	mockGasPrice(bm, 1000)
+
+	err = gc.check(context.Background(), bm, &ethsigner.Transaction{GasPrice: ethtypes.NewHexInteger64(5000)})
+	assert.NoError(t, err)
+	gc.clamp = false
+	err = gc.check(context.Background(), bm, &ethsigner.Transaction{GasPrice: ethtypes.NewHexInteger64(5000)})
+	assert.Regexp(t, "FF22208", err)
+	assert.True(t, gc.expires.After(time.Now()))
+
+	handler, err := registry.HTTPHandler(context.Background(), promhttp.HandlerOpts{})
+	assert.NoError(t, err)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Regexp(t, `ff_gas_ceiling_transactions_total\{[^}]*action="clamp"[^}]*\} 1`, res.Body.String())
+	assert.Regexp(t, `ff_gas_ceiling_transactions_total\{[^}]*action="reject"[^}]*\} 1`, res.Body.String())
+
+	_, err = newGasCeiling(context.Background(), registry)
+	assert.Error(t, err)
+
+}
+
+func TestGasCeilingSendTransaction(t *testing.T) {
+
+	_, s, done := newTestServer(t, func() {
+		config.Set(signerconfig.GasCeilingEnabled, true)
+	})
+	defer done()
+	assert.NotNil(t, s.gasCeiling)
+
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	mockGasPrice(bm, 1000)
+
+	rpcRes, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_sendTransaction",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(fmt.Sprintf(`{"from":"0xfb075bb99f2aa4c49955bf703509a227d7a12248","nonce":"0x1","gasPrice":"%s"}`, ethtypes.NewHexInteger64(3001))),
+		},
+	})
+	assert.Regexp(t, "FF22208", err)
+	assert.Equal(t, int64(rpcbackend.RPCCodeInvalidRequest), rpcRes.Error.Code)
+
+}
@@ -0,0 +1,105 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+)
+
+const (
+	healthStatusUp   = "UP"
+	healthStatusDown = "DOWN"
+)
+
+// healthStatus is the health of the wallet, with the health of each wallet when several are combined
+type healthStatus struct {
+	Status  string                   `json:"status"`
+	Error   string                   `json:"error,omitempty"`
+	Wallets map[string]*healthStatus `json:"wallets,omitempty"`
+}
+
+// signerCapabilities is the result of signer_capabilities
+type signerCapabilities struct {
+	ChainID   *ethtypes.HexInteger `json:"chainId"`
+	TypedData bool                 `json:"typedData"`
+	Health    *healthStatus        `json:"health"`
+}
+
+// memberHealthChecker is implemented by wallets that combine several others, such as the composite wallet
+type memberHealthChecker interface {
+	MemberHealth(ctx context.Context) map[string]error
+}
+
+func newHealthStatus(err error) *healthStatus {
+	if err != nil {
+		return &healthStatus{Status: healthStatusDown, Error: err.Error()}
+	}
+	return &healthStatus{Status: healthStatusUp}
+}
+
+// walletHealth checks the health of the wallet's key backend - which is down if any of the wallets combined
+// in a composite wallet is down
+func (s *rpcServer) walletHealth(ctx context.Context) *healthStatus {
+	mh, ok := s.wallet.(memberHealthChecker)
+	if !ok {
+		return newHealthStatus(ethsigner.CheckWalletHealth(ctx, s.wallet))
+	}
+	status := &healthStatus{Status: healthStatusUp, Wallets: make(map[string]*healthStatus)}
+	for name, err := range mh.MemberHealth(ctx) {
+		status.Wallets[name] = newHealthStatus(err)
+		if err != nil {
+			status.Status = healthStatusDown
+		}
+	}
+	return status
+}
+
+// readyzHandler returns 200 if the wallet is healthy, and 503 otherwise, with the health status in the body
+func (s *rpcServer) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status := s.walletHealth(ctx)
+	statusCode := http.StatusOK
+	if status.Status != healthStatusUp {
+		log.L(ctx).Warnf("Wallet health check failed: %+v", status)
+		statusCode = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func (s *rpcServer) processSignerCapabilities(ctx context.Context, rpcReq *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error) {
+	_, typedData := s.wallet.(ethsigner.WalletTypedData)
+	b, _ := s.json.Marshal(&signerCapabilities{
+		ChainID:   (*ethtypes.HexInteger)(s.chainID),
+		TypedData: typedData,
+		Health:    s.walletHealth(ctx),
+	})
+	return &rpcbackend.RPCResponse{
+		JSONRpc: "2.0",
+		ID:      rpcReq.ID,
+		Result:  fftypes.JSONAnyPtrBytes(b),
+	}, nil
+}
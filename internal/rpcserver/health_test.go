@@ -0,0 +1,147 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/stretchr/testify/assert"
+)
+
+type healthCheckWallet struct {
+	*ethsignermocks.Wallet
+	err error
+}
+
+func (hw *healthCheckWallet) HealthCheck(_ context.Context) error {
+	return hw.err
+}
+
+type memberHealthWallet struct {
+	*ethsignermocks.WalletTypedData
+	health map[string]error
+}
+
+func (mw *memberHealthWallet) MemberHealth(_ context.Context) map[string]error {
+	return mw.health
+}
+
+func getReadyz(t *testing.T, s *rpcServer) (int, *healthStatus) {
+	res := httptest.NewRecorder()
+	s.router().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var status healthStatus
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &status))
+	return res.Code, &status
+}
+
+func TestReadyzNoHealthCheck(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+
+	code, status := getReadyz(t, s)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, &healthStatus{Status: healthStatusUp}, status)
+
+}
+
+func TestReadyzHealthCheck(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+
+	hw := &healthCheckWallet{Wallet: s.wallet.(*ethsignermocks.Wallet)}
+	s.wallet = hw
+	code, status := getReadyz(t, s)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, healthStatusUp, status.Status)
+
+	hw.err = fmt.Errorf("pop")
+	code, status = getReadyz(t, s)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, &healthStatus{Status: healthStatusDown, Error: "pop"}, status)
+
+}
+
+func TestReadyzMemberHealth(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+
+	mw := &memberHealthWallet{
+		WalletTypedData: &ethsignermocks.WalletTypedData{},
+		health:          map[string]error{"fileWallet": nil, "vaultWallet": nil},
+	}
+	s.wallet = mw
+	code, status := getReadyz(t, s)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, healthStatusUp, status.Status)
+	assert.Len(t, status.Wallets, 2)
+
+	mw.health["vaultWallet"] = fmt.Errorf("pop")
+	code, status = getReadyz(t, s)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, &healthStatus{
+		Status: healthStatusDown,
+		Wallets: map[string]*healthStatus{
+			"fileWallet":  {Status: healthStatusUp},
+			"vaultWallet": {Status: healthStatusDown, Error: "pop"},
+		},
+	}, status)
+
+}
+
+func TestSignerCapabilities(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	s.chainID = big.NewInt(1337)
+
+	s.wallet = &healthCheckWallet{Wallet: s.wallet.(*ethsignermocks.Wallet), err: fmt.Errorf("pop")}
+	rpcRes, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "signer_capabilities",
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"chainId": "0x539",
+		"typedData": false,
+		"health": {"status": "DOWN", "error": "pop"}
+	}`, rpcRes.Result.String())
+
+	s.wallet = &memberHealthWallet{WalletTypedData: &ethsignermocks.WalletTypedData{}, health: map[string]error{"fileWallet": nil}}
+	rpcRes, err = s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "signer_capabilities",
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"chainId": "0x539",
+		"typedData": true,
+		"health": {"status": "UP", "wallets": {"fileWallet": {"status": "UP"}}}
+	}`, rpcRes.Result.String())
+
+}
@@ -0,0 +1,118 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+)
+
+// rpcRequestHeader is the subset of a JSON/RPC request we need to decide how to route it
+type rpcRequestHeader struct {
+	ID     *fftypes.JSONAny
+	Method string
+}
+
+// peekRequestHeader reads the top-level fields of a single JSON/RPC request object from the
+// stream, only until both the id and method have been found. Returns false if the stream
+// is not a JSON object containing both, such as a batch.
+func peekRequestHeader(r io.Reader) (*rpcRequestHeader, bool) {
+	header := &rpcRequestHeader{}
+	dec := json.NewDecoder(r)
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, false
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, _ := t.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		switch key {
+		case "id":
+			if string(value) != fftypes.NullString {
+				header.ID = fftypes.JSONAnyPtrBytes(value)
+			}
+		case "method":
+			if err := json.Unmarshal(value, &header.Method); err != nil {
+				return nil, false
+			}
+		}
+		if header.ID != nil && header.Method != "" {
+			return header, true
+		}
+	}
+	return nil, false
+}
+
+// tryStreamPassthrough reads only as much of the request as is needed to route it. Requests for methods
+// that are not intercepted by the signer are streamed unchanged to the backend, with the response
+// streamed back to the client without buffering or re-parsing (so the status code and body from the
+// backend are returned as-is). Otherwise it returns a reader for the complete request body, for the
+// caller to process.
+func (s *rpcServer) tryStreamPassthrough(ctx context.Context, w http.ResponseWriter, body io.Reader) (io.Reader, bool) {
+	peeked := new(bytes.Buffer)
+	header, ok := peekRequestHeader(io.TeeReader(body, peeked))
+	fullBody := io.MultiReader(peeked, body)
+	if !ok || interceptedMethod(header.Method) {
+		return fullBody, false
+	}
+
+	log.L(ctx).Debugf("RPC[%s] --> %s (passthrough)", header.ID, header.Method)
+	res, err := s.httpClient.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(fullBody).
+		SetDoNotParseResponse(true).
+		Post("")
+	if err != nil {
+		err := i18n.NewError(ctx, signermsgs.MsgRPCRequestFailed, err)
+		log.L(ctx).Errorf("RPC[%s] <-- ERROR: %s", header.ID, err)
+		s.replyRPC(ctx, w, rpcbackend.RPCErrorResponse(err, header.ID, rpcbackend.RPCCodeInternalError), http.StatusBadGateway)
+		return nil, true
+	}
+	resBody := res.RawBody()
+	defer resBody.Close()
+
+	for _, h := range []string{"Content-Type", "Content-Length"} {
+		if v := res.Header().Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(res.StatusCode())
+	n, err := io.Copy(w, resBody)
+	if err != nil {
+		// Headers are already sent, so all we can do is log
+		log.L(ctx).Errorf("RPC[%s] <-- [%d] stream interrupted after %d bytes: %s", header.ID, res.StatusCode(), n, err)
+		return nil, true
+	}
+	log.L(ctx).Debugf("RPC[%s] <-- [%d] %d bytes (passthrough)", header.ID, res.StatusCode(), n)
+	return nil, true
+}
@@ -0,0 +1,61 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/signhook"
+	"golang.org/x/crypto/sha3"
+)
+
+// runPostSignHooks invokes each hook whose policy selects the signed transaction, in order, returning
+// true if one of them submitted the transaction itself
+func (s *rpcServer) runPostSignHooks(ctx context.Context, txn *ethsigner.Transaction, raw ethtypes.HexBytes0xPrefix, submission string) (*signhook.SignedTransaction, bool, error) {
+	signed := &signhook.SignedTransaction{
+		ChainID:     s.chainID,
+		Transaction: txn,
+		Raw:         raw,
+		Submission:  submission,
+	}
+	if err := s.json.Unmarshal(txn.From, &signed.From); err != nil {
+		return nil, false, err
+	}
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(raw)
+	signed.Hash = hash.Sum(nil)
+
+	for _, r := range s.postSignHooks {
+		if !r.Policy.Selects(signed) {
+			continue
+		}
+		result, err := r.Hook.PostSign(ctx, signed)
+		if err != nil {
+			return nil, false, i18n.NewError(ctx, signermsgs.MsgPostSignHookFailed, r.Name, err)
+		}
+		if result == signhook.Submitted {
+			log.L(ctx).Debugf("Transaction %s from %s submitted by post-sign hook '%s'", signed.Hash, signed.From, r.Name)
+			return signed, true, nil
+		}
+	}
+	return signed, false, nil
+}
@@ -0,0 +1,133 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/mocks/rpcbackendmocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/hyperledger/firefly-signer/pkg/signhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testHook struct {
+	result signhook.Result
+	err    error
+	calls  []*signhook.SignedTransaction
+}
+
+func (th *testHook) PostSign(_ context.Context, signed *signhook.SignedTransaction) (signhook.Result, error) {
+	th.calls = append(th.calls, signed)
+	return th.result, th.err
+}
+
+func newTestHookServer(t *testing.T, hooks ...*signhook.Registration) (*rpcServer, func()) {
+	_, s, done := newTestServer(t)
+	s.postSignHooks = hooks
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Sign", mock.Anything, mock.Anything, mock.Anything).Return([]byte{0x01, 0x02}, nil)
+	return s, done
+}
+
+func hookSendTransactionRequest() *rpcbackend.RPCRequest {
+	return &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_sendTransaction",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(`{"from":"0xfb075bb99f2aa4c49955bf703509a227d7a12248","to":"0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20","nonce":"0x1"}`),
+		},
+	}
+}
+
+func TestPostSignHooksContinue(t *testing.T) {
+
+	broadcast := &testHook{result: signhook.Continue}
+	excluded := &testHook{result: signhook.Submitted}
+	s, done := newTestHookServer(t,
+		&signhook.Registration{Name: "broadcast", Hook: broadcast},
+		&signhook.Registration{Name: "excluded", Hook: excluded, Policy: &signhook.Policy{ChainIDs: []int64{99}}},
+	)
+	defer done()
+
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.On("SyncRequest", mock.Anything, mock.MatchedBy(func(rpcReq *rpcbackend.RPCRequest) bool {
+		return rpcReq.Method == "eth_sendRawTransaction" && rpcReq.Params[0].String() == `"0x0102"`
+	})).Return(&rpcbackend.RPCResponse{JSONRpc: "2.0", ID: fftypes.JSONAnyPtr("1")}, nil)
+
+	_, err := s.processRPC(s.ctx, hookSendTransactionRequest())
+	assert.NoError(t, err)
+	bm.AssertExpectations(t)
+
+	assert.Len(t, broadcast.calls, 1)
+	signed := broadcast.calls[0]
+	assert.Equal(t, "0xfb075bb99f2aa4c49955bf703509a227d7a12248", signed.From.String())
+	assert.Equal(t, "0x0102", signed.Raw.String())
+	assert.Equal(t, "0x22ae6da6b482f9b1b19b0b897c3fd43884180a1c5ee361e1107a1bc635649dda", signed.Hash.String())
+	assert.Equal(t, uint64(1), signed.Transaction.Nonce.Uint64())
+	assert.Empty(t, excluded.calls)
+
+}
+
+func TestPostSignHooksSubmitted(t *testing.T) {
+
+	relay := &testHook{result: signhook.Submitted}
+	after := &testHook{result: signhook.Continue}
+	s, done := newTestHookServer(t,
+		&signhook.Registration{Name: "relay", Hook: relay, Policy: &signhook.Policy{
+			To: []ethtypes.Address0xHex{*ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20")},
+		}},
+		&signhook.Registration{Name: "after", Hook: after},
+	)
+	defer done()
+
+	res, err := s.processRPC(s.ctx, hookSendTransactionRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, `"0x22ae6da6b482f9b1b19b0b897c3fd43884180a1c5ee361e1107a1bc635649dda"`, res.Result.String())
+	assert.Equal(t, `1`, res.ID.String())
+	assert.Len(t, relay.calls, 1)
+	assert.Empty(t, after.calls)
+
+}
+
+func TestPostSignHooksFail(t *testing.T) {
+
+	s, done := newTestHookServer(t, &signhook.Registration{Name: "relay", Hook: &testHook{err: fmt.Errorf("pop")}})
+	defer done()
+
+	res, err := s.processRPC(s.ctx, hookSendTransactionRequest())
+	assert.Regexp(t, "FF22193.*relay.*pop", err)
+	assert.Equal(t, int64(rpcbackend.RPCCodeInternalError), res.Error.Code)
+
+}
+
+func TestPostSignHooksBadFrom(t *testing.T) {
+
+	s, done := newTestHookServer(t, &signhook.Registration{Name: "relay", Hook: &testHook{}})
+	defer done()
+
+	_, _, err := s.runPostSignHooks(s.ctx, &ethsigner.Transaction{From: []byte(`"bad"`)}, ethtypes.HexBytes0xPrefix{0x01}, "")
+	assert.Regexp(t, "bad address", err)
+
+}
@@ -0,0 +1,177 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signedconfig"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/hyperledger/firefly-signer/pkg/signhook"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// privateRelayMethodTransaction is the Flashbots Protect method, taking an object with the raw transaction
+	privateRelayMethodTransaction = "eth_sendPrivateTransaction"
+	// privateRelayMethodRawTransaction takes the raw transaction as the only parameter, as eth_sendRawTransaction
+	privateRelayMethodRawTransaction = "eth_sendPrivateRawTransaction"
+	// privateRelaySignatureHeader carries the signature of the request body by the auth key, as <address>:<signature>
+	privateRelaySignatureHeader = "X-Flashbots-Signature"
+)
+
+// privateRelay is a post-sign hook that submits transactions to a private relay, instead of the backend, so
+// they are not visible in the public mempool before they are included in a block
+type privateRelay struct {
+	client      *resty.Client
+	json        rpcbackend.JSONCodec
+	method      string
+	authKey     *secp256k1.KeyPair // nil if requests to the relay are not signed
+	requestOnly bool
+	policy      *signhook.Policy
+}
+
+type privateTransactionParam struct {
+	Tx ethtypes.HexBytes0xPrefix `json:"tx"`
+}
+
+func newPrivateRelay(ctx context.Context, jsonCodec rpcbackend.JSONCodec) (*privateRelay, error) {
+	method := config.GetString(signerconfig.PrivateRelayMethod)
+	if method != privateRelayMethodTransaction && method != privateRelayMethodRawTransaction {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPrivateRelayBadMethod, method)
+	}
+	client, err := ffresty.New(ctx, signerconfig.PrivateRelayConfig)
+	if err != nil {
+		return nil, err
+	}
+	r := &privateRelay{
+		client:      client,
+		json:        jsonCodec,
+		method:      method,
+		requestOnly: config.GetBool(signerconfig.PrivateRelayRequestOnly),
+		policy:      &signhook.Policy{},
+	}
+	if keyFile := config.GetString(signerconfig.PrivateRelayAuthKeyFile); keyFile != "" {
+		if r.authKey, err = readAuthKey(ctx, keyFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range config.GetStringSlice(signerconfig.PrivateRelayPolicyFrom) {
+		addr, err := ethtypes.NewAddress(a)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgPrivateRelayBadPolicy, "from", a, err)
+		}
+		r.policy.From = append(r.policy.From, *addr)
+	}
+	for _, a := range config.GetStringSlice(signerconfig.PrivateRelayPolicyTo) {
+		addr, err := ethtypes.NewAddress(a)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgPrivateRelayBadPolicy, "to", a, err)
+		}
+		r.policy.To = append(r.policy.To, *addr)
+	}
+	for _, c := range config.GetStringSlice(signerconfig.PrivateRelayPolicyChainIDs) {
+		chainID, ok := new(big.Int).SetString(c, 0)
+		if !ok || !chainID.IsInt64() {
+			return nil, i18n.NewError(ctx, signermsgs.MsgPrivateRelayBadPolicy, "chainIds", c, "not an integer")
+		}
+		r.policy.ChainIDs = append(r.policy.ChainIDs, chainID.Int64())
+	}
+	return r, nil
+}
+
+func readAuthKey(ctx context.Context, keyFile string) (*secp256k1.KeyPair, error) {
+	b, err := os.ReadFile(keyFile)
+	if err == nil {
+		b, err = hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(b)), "0x"))
+	}
+	if err == nil {
+		err = secp256k1.ValidatePrivateKeyBytes(b)
+	}
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPrivateRelayBadAuthKey, keyFile, err)
+	}
+	return secp256k1.KeyPairFromBytes(b), nil
+}
+
+// PostSign submits the transaction to the relay if the request asks for private submission, or the policy
+// selects it and the request does not ask for public submission
+func (r *privateRelay) PostSign(ctx context.Context, signed *signhook.SignedTransaction) (signhook.Result, error) {
+	switch {
+	case signed.Submission == signhook.SubmissionPrivate:
+	case signed.Submission == signhook.SubmissionPublic, r.requestOnly, !r.policy.Selects(signed):
+		return signhook.Continue, nil
+	}
+
+	var param interface{} = &privateTransactionParam{Tx: signed.Raw}
+	if r.method == privateRelayMethodRawTransaction {
+		param = signed.Raw
+	}
+	paramJSON, _ := r.json.Marshal(param)
+	body, _ := r.json.Marshal(&rpcbackend.RPCRequest{
+		JSONRpc: "2.0",
+		ID:      fftypes.JSONAnyPtr("1"),
+		Method:  r.method,
+		Params:  []*fftypes.JSONAny{fftypes.JSONAnyPtrBytes(paramJSON)},
+	})
+
+	req := r.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body)
+	if r.authKey != nil {
+		// Flashbots authenticates the EIP-191 signature of the hex encoded hash of the body
+		bodyHash := sha3.NewLegacyKeccak256()
+		bodyHash.Write(body)
+		signature, err := signedconfig.Sign(r.authKey, []byte(ethtypes.HexBytes0xPrefix(bodyHash.Sum(nil)).String()))
+		if err != nil {
+			return signhook.Continue, err
+		}
+		req.SetHeader(privateRelaySignatureHeader, fmt.Sprintf("%s:%s", r.authKey.Address, signature))
+	}
+
+	var rpcRes rpcbackend.RPCResponse
+	res, err := req.Post("")
+	if err == nil {
+		err = r.json.Unmarshal(res.Body(), &rpcRes)
+	}
+	switch {
+	case err != nil:
+		return signhook.Continue, i18n.NewError(ctx, signermsgs.MsgPrivateRelayFailed, err)
+	case rpcRes.Error != nil && rpcRes.Error.Message != "":
+		return signhook.Continue, i18n.NewError(ctx, signermsgs.MsgPrivateRelayFailed, rpcRes.Error.Message)
+	case res.IsError():
+		return signhook.Continue, i18n.NewError(ctx, signermsgs.MsgPrivateRelayFailed, res.Status())
+	}
+	log.L(ctx).Infof("Transaction %s from %s submitted to private relay with %s", signed.Hash, signed.From, r.method)
+	return signhook.Submitted, nil
+}
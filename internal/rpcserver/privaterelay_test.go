@@ -0,0 +1,251 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-signer/internal/signedconfig"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/mocks/rpcbackendmocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/sha3"
+)
+
+const testAuthKey = "0x8e7e3d5a2fc9c1b3b0e6a1e52f1e96d3ec3b5e2a9f9f0e6a8e3c1d4b5a6f7e8d"
+
+// testRelay is a private relay, that records the requests it receives
+type testRelay struct {
+	server   *httptest.Server
+	mux      sync.Mutex
+	requests []*rpcbackend.RPCRequest
+	headers  []http.Header
+	bodies   [][]byte
+	status   int
+	response string
+}
+
+func newTestRelay(t *testing.T) *testRelay {
+	tr := &testRelay{response: `{"jsonrpc":"2.0","id":1,"result":"0x22ae6da6b482f9b1b19b0b897c3fd43884180a1c5ee361e1107a1bc635649dda"}`}
+	tr.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req rpcbackend.RPCRequest
+		_ = json.Unmarshal(body, &req)
+		tr.mux.Lock()
+		tr.requests = append(tr.requests, &req)
+		tr.headers = append(tr.headers, r.Header)
+		tr.bodies = append(tr.bodies, body)
+		status, response := tr.status, tr.response
+		tr.mux.Unlock()
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(tr.server.Close)
+	return tr
+}
+
+func newTestRelayServer(t *testing.T, tr *testRelay, setConfig ...func()) (*rpcServer, func()) {
+	_, s, done := newTestServer(t, append([]func(){func() {
+		config.Set(signerconfig.PrivateRelayEnabled, true)
+		signerconfig.PrivateRelayConfig.Set(ffresty.HTTPConfigURL, tr.server.URL)
+		signerconfig.PrivateRelayConfig.Set(ffresty.HTTPConfigRetryEnabled, false)
+	}}, setConfig...)...)
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Sign", mock.Anything, mock.Anything, mock.Anything).Return([]byte{0x01, 0x02}, nil)
+	return s, done
+}
+
+func relaySendTransactionRequest(options string) *rpcbackend.RPCRequest {
+	rpcReq := hookSendTransactionRequest()
+	if options != "" {
+		rpcReq.Params = append(rpcReq.Params, fftypes.JSONAnyPtr(options))
+	}
+	return rpcReq
+}
+
+func TestPrivateRelayPolicy(t *testing.T) {
+
+	tr := newTestRelay(t)
+	authKeyFile := path.Join(t.TempDir(), "auth.key")
+	err := os.WriteFile(authKeyFile, []byte(testAuthKey+"\n"), 0600)
+	assert.NoError(t, err)
+	s, done := newTestRelayServer(t, tr, func() {
+		config.Set(signerconfig.PrivateRelayAuthKeyFile, authKeyFile)
+		config.Set(signerconfig.PrivateRelayPolicyTo, []string{"0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20"})
+		config.Set(signerconfig.PrivateRelayPolicyChainIDs, []string{"0", "0x1"})
+		config.Set(signerconfig.PrivateRelayPolicyFrom, []string{"0xfb075bb99f2aa4c49955bf703509a227d7a12248"})
+	})
+	defer done()
+	s.chainID.SetInt64(1)
+
+	res, err := s.processRPC(s.ctx, relaySendTransactionRequest(""))
+	assert.NoError(t, err)
+	assert.Equal(t, `"0x22ae6da6b482f9b1b19b0b897c3fd43884180a1c5ee361e1107a1bc635649dda"`, res.Result.String())
+
+	assert.Len(t, tr.requests, 1)
+	assert.Equal(t, "eth_sendPrivateTransaction", tr.requests[0].Method)
+	assert.JSONEq(t, `{"tx":"0x0102"}`, tr.requests[0].Params[0].String())
+
+	// The signature header is the auth key's EIP-191 signature of the hex hash of the body
+	authAddr, signature, ok := strings.Cut(tr.headers[0].Get("X-Flashbots-Signature"), ":")
+	assert.True(t, ok)
+	bodyHash := sha3.NewLegacyKeccak256()
+	bodyHash.Write(tr.bodies[0])
+	signer, err := signedconfig.Verify(context.Background(), []byte(ethtypes.HexBytes0xPrefix(bodyHash.Sum(nil)).String()), signature,
+		[]*ethtypes.Address0xHex{ethtypes.MustNewAddress(authAddr)})
+	assert.NoError(t, err)
+	assert.Equal(t, secp256k1.KeyPairFromBytes(ethtypes.MustNewHexBytes0xPrefix(testAuthKey)).Address, *signer)
+
+	// The request can opt out, to the backend
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.On("SyncRequest", mock.Anything, mock.MatchedBy(func(rpcReq *rpcbackend.RPCRequest) bool {
+		return rpcReq.Method == "eth_sendRawTransaction"
+	})).Return(&rpcbackend.RPCResponse{JSONRpc: "2.0", ID: fftypes.JSONAnyPtr("1")}, nil)
+	_, err = s.processRPC(s.ctx, relaySendTransactionRequest(`{"submission":"public"}`))
+	assert.NoError(t, err)
+	assert.Len(t, tr.requests, 1)
+
+	// Transactions the policy does not select go to the backend
+	s.chainID.SetInt64(5)
+	_, err = s.processRPC(s.ctx, relaySendTransactionRequest(`null`))
+	assert.NoError(t, err)
+	assert.Len(t, tr.requests, 1)
+	bm.AssertNumberOfCalls(t, "SyncRequest", 2)
+
+}
+
+func TestPrivateRelayRequestOnly(t *testing.T) {
+
+	tr := newTestRelay(t)
+	s, done := newTestRelayServer(t, tr, func() {
+		config.Set(signerconfig.PrivateRelayRequestOnly, true)
+		config.Set(signerconfig.PrivateRelayMethod, "eth_sendPrivateRawTransaction")
+	})
+	defer done()
+
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.On("SyncRequest", mock.Anything, mock.Anything).Return(&rpcbackend.RPCResponse{JSONRpc: "2.0", ID: fftypes.JSONAnyPtr("1")}, nil)
+	_, err := s.processRPC(s.ctx, relaySendTransactionRequest(""))
+	assert.NoError(t, err)
+	assert.Empty(t, tr.requests)
+
+	_, err = s.processRPC(s.ctx, relaySendTransactionRequest(`{"submission":"private"}`))
+	assert.NoError(t, err)
+	assert.Len(t, tr.requests, 1)
+	assert.Equal(t, "eth_sendPrivateRawTransaction", tr.requests[0].Method)
+	assert.Equal(t, `"0x0102"`, tr.requests[0].Params[0].String())
+	assert.Empty(t, tr.headers[0].Get("X-Flashbots-Signature"))
+	bm.AssertNumberOfCalls(t, "SyncRequest", 1)
+
+}
+
+func TestPrivateRelayErrors(t *testing.T) {
+
+	tr := newTestRelay(t)
+	s, done := newTestRelayServer(t, tr)
+	defer done()
+
+	tr.response = `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"bundle rejected"}}`
+	_, err := s.processRPC(s.ctx, relaySendTransactionRequest(""))
+	assert.Regexp(t, "FF22193.*privateRelay.*FF22195.*bundle rejected", err)
+
+	tr.status, tr.response = http.StatusUnauthorized, `{}`
+	_, err = s.processRPC(s.ctx, relaySendTransactionRequest(""))
+	assert.Regexp(t, "FF22195.*401", err)
+
+	tr.status, tr.response = http.StatusOK, `!json`
+	_, err = s.processRPC(s.ctx, relaySendTransactionRequest(""))
+	assert.Regexp(t, "FF22195", err)
+
+	tr.server.Close()
+	_, err = s.processRPC(s.ctx, relaySendTransactionRequest(""))
+	assert.Regexp(t, "FF22195", err)
+
+}
+
+func TestPrivateSubmissionRequired(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Sign", mock.Anything, mock.Anything, mock.Anything).Return([]byte{0x01, 0x02}, nil)
+
+	// Without a relay, a private transaction is rejected rather than sent to the public mempool
+	_, err := s.processRPC(s.ctx, relaySendTransactionRequest(`{"submission":"private"}`))
+	assert.Regexp(t, "FF22199", err)
+
+	_, err = s.processRPC(s.ctx, relaySendTransactionRequest(`{"submission":"wrong"}`))
+	assert.Regexp(t, "FF22194", err)
+
+	_, err = s.processRPC(s.ctx, relaySendTransactionRequest(`!json`))
+	assert.Regexp(t, "FF22011", err)
+
+}
+
+func TestPrivateRelayBadConfig(t *testing.T) {
+
+	for _, setConfig := range []func(){
+		func() { config.Set(signerconfig.PrivateRelayMethod, "eth_sendBundle") },
+		func() { config.Set(signerconfig.PrivateRelayAuthKeyFile, "!!!missing") },
+		func() { config.Set(signerconfig.PrivateRelayPolicyFrom, []string{"wrong"}) },
+		func() { config.Set(signerconfig.PrivateRelayPolicyTo, []string{"wrong"}) },
+		func() { config.Set(signerconfig.PrivateRelayPolicyChainIDs, []string{"wrong"}) },
+		func() {
+			tlsConf := signerconfig.PrivateRelayConfig.SubSection("tls")
+			tlsConf.Set(fftls.HTTPConfTLSEnabled, true)
+			tlsConf.Set(fftls.HTTPConfTLSCAFile, "!!!!!badness")
+		},
+	} {
+		signerconfig.Reset()
+		config.Set(signerconfig.PrivateRelayEnabled, true)
+		setConfig()
+		_, err := NewServer(context.Background(), &ethsignermocks.Wallet{})
+		assert.Regexp(t, "FF22196|FF22197|FF22198|FF00153", err)
+	}
+
+}
+
+func TestPrivateRelayBadAuthKey(t *testing.T) {
+
+	keyFile := path.Join(t.TempDir(), "auth.key")
+	err := os.WriteFile(keyFile, []byte(fmt.Sprintf("0x%064d", 0)), 0600)
+	assert.NoError(t, err)
+	_, err = readAuthKey(context.Background(), keyFile)
+	assert.Regexp(t, "FF22198", err)
+
+}
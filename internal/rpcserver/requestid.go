@@ -0,0 +1,75 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+)
+
+// A caller-supplied request ID is only adopted if it is safe to write into logs and headers
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,64}$`)
+
+// requestIDMiddleware assigns every proxy call a request ID, using the X-FireFly-Request-ID header
+// from the caller if one is supplied. The ID is:
+// - added as a field to every log line written with the request context, through the wallet and upstream layers
+// - passed on the X-FireFly-Request-ID header of upstream calls, by the ffresty client
+// - returned on the X-FireFly-Request-ID response header, and in the error object of every JSON/RPC error
+func (s *rpcServer) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(ffapi.FFRequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = fftypes.ShortID()
+		}
+		ctx := context.WithValue(r.Context(), ffapi.CtxFFRequestIDKey{}, requestID)
+		ctx = log.WithLogField(ctx, "httpreq", requestID)
+		w.Header().Set(ffapi.FFRequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(ffapi.CtxFFRequestIDKey{}).(string)
+	return requestID
+}
+
+// setErrorRequestIDs sets the request ID on any errors in a single or batch response
+func setErrorRequestIDs(ctx context.Context, result interface{}) {
+	requestID := requestIDFromContext(ctx)
+	if requestID == "" {
+		return
+	}
+	setRequestID := func(res *rpcbackend.RPCResponse) {
+		if res != nil && res.Error != nil {
+			res.Error.RequestID = requestID
+		}
+	}
+	switch r := result.(type) {
+	case *rpcbackend.RPCResponse:
+		setRequestID(r)
+	case []*rpcbackend.RPCResponse:
+		for _, res := range r {
+			setRequestID(res)
+		}
+	}
+}
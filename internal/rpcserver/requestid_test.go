@@ -0,0 +1,108 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRequestIDSuppliedByCaller(t *testing.T) {
+
+	url, s, done := newTestServer(t)
+	defer done()
+	s.chainID = big.NewInt(1)
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Initialize", mock.Anything).Return(nil)
+	w.On("GetAccounts", mock.MatchedBy(func(ctx context.Context) bool {
+		return requestIDFromContext(ctx) == "my-request.1"
+	})).Return(nil, fmt.Errorf("pop"))
+
+	err := s.Start()
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_accounts"}`)))
+	assert.NoError(t, err)
+	req.Header.Set(ffapi.FFRequestIDHeader, "my-request.1")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.Equal(t, "my-request.1", res.Header.Get(ffapi.FFRequestIDHeader))
+
+	var rpcRes rpcbackend.RPCResponse
+	err = json.NewDecoder(res.Body).Decode(&rpcRes)
+	assert.NoError(t, err)
+	assert.Equal(t, "pop", rpcRes.Error.Message)
+	assert.Equal(t, "my-request.1", rpcRes.Error.RequestID)
+
+	w.AssertExpectations(t)
+
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+
+	url, s, done := newTestServer(t)
+	defer done()
+	s.chainID = big.NewInt(1)
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Initialize", mock.Anything).Return(nil)
+
+	err := s.Start()
+	assert.NoError(t, err)
+
+	// A header that is not safe to log is replaced
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(`[{"jsonrpc":"2.0","method":"eth_accounts"}]`)))
+	assert.NoError(t, err)
+	req.Header.Set(ffapi.FFRequestIDHeader, "bad id with spaces")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	requestID := res.Header.Get(ffapi.FFRequestIDHeader)
+	assert.Regexp(t, "^[a-zA-Z0-9]+$", requestID)
+
+	var rpcRes []*rpcbackend.RPCResponse
+	err = json.NewDecoder(res.Body).Decode(&rpcRes)
+	assert.NoError(t, err)
+	assert.Len(t, rpcRes, 1)
+	assert.Regexp(t, "FF22024", rpcRes[0].Error.Message)
+	assert.Equal(t, requestID, rpcRes[0].Error.RequestID)
+
+}
+
+func TestSetErrorRequestIDsNoID(t *testing.T) {
+
+	res := rpcbackend.RPCErrorResponse(fmt.Errorf("pop"), nil, rpcbackend.RPCCodeInternalError)
+	setErrorRequestIDs(context.Background(), res)
+	assert.Empty(t, res.Error.RequestID)
+
+	ctx := context.WithValue(context.Background(), ffapi.CtxFFRequestIDKey{}, "abc")
+	setErrorRequestIDs(ctx, []*rpcbackend.RPCResponse{nil, {}, res})
+	assert.Equal(t, "abc", res.Error.RequestID)
+
+}
@@ -18,7 +18,6 @@ package rpcserver
 
 import (
 	"context"
-	"encoding/json"
 	"io"
 	"net/http"
 	"strconv"
@@ -34,8 +33,20 @@ import (
 func (s *rpcServer) rpcHandler(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context() // will include logging ID from FireFly server framework
+	if lang, ok := signermsgs.MatchAcceptLanguage(r.Header.Get("Accept-Language")); ok {
+		// Errors returned to this caller are described in their preferred language
+		ctx = i18n.WithLang(ctx, lang)
+	}
+
+	var body io.Reader = r.Body
+	if s.streamPassthrough {
+		var streamed bool
+		if body, streamed = s.tryStreamPassthrough(ctx, w, body); streamed {
+			return
+		}
+	}
 
-	b, err := io.ReadAll(r.Body)
+	b, err := io.ReadAll(body)
 	if err != nil {
 		s.replyRPCParseError(ctx, w, b)
 		return
@@ -49,7 +60,7 @@ func (s *rpcServer) rpcHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var rpcRequest rpcbackend.RPCRequest
-	err = json.Unmarshal(b, &rpcRequest)
+	err = s.json.Unmarshal(b, &rpcRequest)
 	if err != nil {
 		s.replyRPCParseError(ctx, w, b)
 		return
@@ -75,7 +86,8 @@ func (s *rpcServer) replyRPCParseError(ctx context.Context, w http.ResponseWrite
 
 func (s *rpcServer) replyRPC(ctx context.Context, w http.ResponseWriter, result interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
-	b, _ := json.Marshal(result)
+	setErrorRequestIDs(ctx, result)
+	b, _ := s.json.Marshal(result)
 	log.L(ctx).Tracef("RPC <-- %s", b)
 	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
 	w.WriteHeader(status)
@@ -98,7 +110,7 @@ func (s *rpcServer) sniffFirstByte(data []byte) byte {
 func (s *rpcServer) handleRPCBatch(ctx context.Context, w http.ResponseWriter, batchBytes []byte) {
 
 	var rpcArray []*rpcbackend.RPCRequest
-	err := json.Unmarshal(batchBytes, &rpcArray)
+	err := s.json.Unmarshal(batchBytes, &rpcArray)
 	if err != nil || len(rpcArray) == 0 {
 		log.L(ctx).Errorf("Bad RPC array received %s", batchBytes)
 		s.replyRPCParseError(ctx, w, batchBytes)
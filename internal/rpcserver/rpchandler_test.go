@@ -18,14 +18,18 @@ package rpcserver
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"testing/iotest"
 
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
 	"github.com/hyperledger/firefly-signer/mocks/rpcbackendmocks"
@@ -40,7 +44,7 @@ func TestSignAndSendTransactionWithNonce(t *testing.T) {
 
 	url, s, done := newTestServer(t)
 	defer done()
-	s.chainID = 1
+	s.chainID = big.NewInt(1)
 
 	w := s.wallet.(*ethsignermocks.Wallet)
 	w.On("Initialize", mock.Anything).Return(nil)
@@ -97,7 +101,7 @@ func TestSignAndSendTransactionWithoutNonce(t *testing.T) {
 
 	url, s, done := newTestServer(t)
 	defer done()
-	s.chainID = 1
+	s.chainID = big.NewInt(1)
 
 	w := s.wallet.(*ethsignermocks.Wallet)
 	w.On("Initialize", mock.Anything).Return(nil)
@@ -158,7 +162,7 @@ func TestServeJSONRPCFail(t *testing.T) {
 
 	url, s, done := newTestServer(t)
 	defer done()
-	s.chainID = 1
+	s.chainID = big.NewInt(1)
 
 	w := s.wallet.(*ethsignermocks.Wallet)
 	w.On("Initialize", mock.Anything).Return(nil)
@@ -196,7 +200,8 @@ func TestServeJSONRPCFail(t *testing.T) {
 			"id": 1,
 			"error": {
 				"code": -32603,
-				"message": "error 1"	
+				"message": "error 1",
+				"requestId": "`+res.Header.Get(ffapi.FFRequestIDHeader)+`"
 			}
 		}
 	`)
@@ -209,7 +214,7 @@ func TestServeJSONRPCBatchOK(t *testing.T) {
 
 	url, s, done := newTestServer(t)
 	defer done()
-	s.chainID = 1
+	s.chainID = big.NewInt(1)
 
 	w := s.wallet.(*ethsignermocks.Wallet)
 	w.On("Initialize", mock.Anything).Return(nil)
@@ -284,11 +289,57 @@ func TestServeJSONRPCBatchOK(t *testing.T) {
 
 }
 
+func TestServeJSONRPCBatchJSONIter(t *testing.T) {
+
+	url, s, done := newTestServer(t)
+	defer done()
+	s.chainID = big.NewInt(1)
+	s.json, _ = rpcbackend.NewJSONCodec(context.Background(), rpcbackend.JSONCodecJSONIter)
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Initialize", mock.Anything).Return(nil)
+
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.On("SyncRequest", mock.Anything, mock.MatchedBy(func(rpcReq *rpcbackend.RPCRequest) bool {
+		return rpcReq.Method == "eth_rpc1" && rpcReq.ID.String() == `1`
+	})).Return(&rpcbackend.RPCResponse{
+		JSONRpc: "2.0",
+		ID:      fftypes.JSONAnyPtr(`1`),
+		Result:  fftypes.JSONAnyPtr(`{"some":"result"}`),
+	}, nil)
+
+	err := s.Start()
+	assert.NoError(t, err)
+
+	res, err := http.Post(url, "application/json", bytes.NewReader([]byte(`[
+		{
+			"jsonrpc": "2.0",
+			"id": 1,
+			"method": "eth_rpc1"
+		}
+	]`)))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	b, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{
+			"jsonrpc": "2.0",
+			"id": 1,
+			"result": {"some":"result"}
+		}
+	]`, string(b))
+
+	bm.AssertExpectations(t)
+
+}
+
 func TestServeJSONRPCBatchOneFailed(t *testing.T) {
 
 	url, s, done := newTestServer(t)
 	defer done()
-	s.chainID = 1
+	s.chainID = big.NewInt(1)
 
 	w := s.wallet.(*ethsignermocks.Wallet)
 	w.On("Initialize", mock.Anything).Return(nil)
@@ -343,7 +394,8 @@ func TestServeJSONRPCBatchOneFailed(t *testing.T) {
 			"id": 2,
 			"error": {
 				"code": -32603,
-				"message": "error 2"	
+				"message": "error 2",
+				"requestId": "`+res.Header.Get(ffapi.FFRequestIDHeader)+`"
 			}
 		}
 	]`)
@@ -356,7 +408,7 @@ func TestServeJSONRPCBatchBadArray(t *testing.T) {
 
 	url, s, done := newTestServer(t)
 	defer done()
-	s.chainID = 1
+	s.chainID = big.NewInt(1)
 
 	w := s.wallet.(*ethsignermocks.Wallet)
 	w.On("Initialize", mock.Anything).Return(nil)
@@ -376,7 +428,8 @@ func TestServeJSONRPCBatchBadArray(t *testing.T) {
 			"id": 1,
 			"error": {
 				"code": -32600,
-				"message": "FF22018: Invalid request data"
+				"message": "FF22018: Invalid request data",
+				"requestId": "`+res.Header.Get(ffapi.FFRequestIDHeader)+`"
 			}
 		}
 	`)
@@ -387,7 +440,7 @@ func TestServeJSONRPCBatchEmptyData(t *testing.T) {
 
 	url, s, done := newTestServer(t)
 	defer done()
-	s.chainID = 1
+	s.chainID = big.NewInt(1)
 
 	w := s.wallet.(*ethsignermocks.Wallet)
 	w.On("Initialize", mock.Anything).Return(nil)
@@ -407,7 +460,8 @@ func TestServeJSONRPCBatchEmptyData(t *testing.T) {
 			"id": 1,
 			"error": {
 				"code": -32600,
-				"message": "FF22018: Invalid request data"	
+				"message": "FF22018: Invalid request data",
+				"requestId": "`+res.Header.Get(ffapi.FFRequestIDHeader)+`"
 			}
 		}
 	`)
@@ -418,7 +472,7 @@ func TestServeJSONRPCBatchBadJSON(t *testing.T) {
 
 	url, s, done := newTestServer(t)
 	defer done()
-	s.chainID = 1
+	s.chainID = big.NewInt(1)
 
 	w := s.wallet.(*ethsignermocks.Wallet)
 	w.On("Initialize", mock.Anything).Return(nil)
@@ -438,7 +492,8 @@ func TestServeJSONRPCBatchBadJSON(t *testing.T) {
 			"id": 1,
 			"error": {
 				"code": -32600,
-				"message": "FF22018: Invalid request data"	
+				"message": "FF22018: Invalid request data",
+				"requestId": "`+res.Header.Get(ffapi.FFRequestIDHeader)+`"
 			}
 		}
 	`)
@@ -455,3 +510,178 @@ func TestRPCHandlerReadFail(t *testing.T) {
 	assert.Equal(t, 400, w.Result().StatusCode)
 
 }
+
+func TestServeJSONRPCStreamPassthrough(t *testing.T) {
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[{}]}`, string(b))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[]}`))
+	}))
+	defer upstream.Close()
+
+	url, s, done := newTestServer(t)
+	defer done()
+	s.chainID = big.NewInt(1)
+	s.streamPassthrough = true
+	s.httpClient.SetBaseURL(upstream.URL)
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Initialize", mock.Anything).Return(nil)
+
+	err := s.Start()
+	assert.NoError(t, err)
+
+	res, err := http.Post(url, "application/json", bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[{}]}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	b, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":[]}`, string(b))
+
+	// Nothing went through the buffered backend
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.AssertExpectations(t)
+
+}
+
+func TestServeJSONRPCStreamPassthroughUpstreamFail(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	s.streamPassthrough = true
+	s.httpClient.SetBaseURL("http://127.0.0.1:1")
+
+	w := httptest.NewRecorder()
+	s.rpcHandler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs"}`))))
+
+	assert.Equal(t, http.StatusBadGateway, w.Result().StatusCode)
+	b, err := ioutil.ReadAll(w.Result().Body)
+	assert.NoError(t, err)
+	assert.Regexp(t, "FF22012", string(b))
+
+}
+
+func TestServeJSONRPCStreamPassthroughSkipsIntercepted(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	s.streamPassthrough = true
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("GetAccounts", mock.Anything).Return([]*ethtypes.Address0xHex{}, nil)
+
+	rec := httptest.NewRecorder()
+	s.rpcHandler(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_accounts"}`))))
+
+	assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
+	w.AssertExpectations(t)
+
+}
+
+func TestServeJSONRPCStreamPassthroughRequestBody(t *testing.T) {
+
+	// Method after a large params value, and a null ID we still pass through
+	bigParam := strings.Repeat("a", 1024*1024)
+	reqBody := `{"jsonrpc":"2.0","params":["` + bigParam + `"],"id":null,"method":"eth_call","id":"abc"}`
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, reqBody, string(b))
+		w.WriteHeader(500)
+		_, _ = w.Write([]byte(`not json`))
+	}))
+	defer upstream.Close()
+
+	_, s, done := newTestServer(t)
+	defer done()
+	s.streamPassthrough = true
+	s.httpClient.SetBaseURL(upstream.URL)
+
+	pr, pw := io.Pipe()
+	go func() {
+		// Write in small chunks, to check we do not wait for the whole body before routing
+		for i := 0; i < len(reqBody); i += 4096 {
+			end := i + 4096
+			if end > len(reqBody) {
+				end = len(reqBody)
+			}
+			_, _ = pw.Write([]byte(reqBody[i:end]))
+		}
+		pw.Close()
+	}()
+
+	w := httptest.NewRecorder()
+	s.rpcHandler(w, httptest.NewRequest(http.MethodPost, "/", pr))
+
+	// Upstream status and body are returned unchanged
+	assert.Equal(t, 500, w.Result().StatusCode)
+	b, err := ioutil.ReadAll(w.Result().Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `not json`, string(b))
+
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.AssertExpectations(t)
+
+}
+
+func TestServeJSONRPCStreamPassthroughNotApplicable(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	s.streamPassthrough = true
+	s.httpClient.SetBaseURL("http://127.0.0.1:1")
+
+	// Requests without an ID get the same validation error as when not streaming
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","method":"eth_call"}`,
+		`{"jsonrpc":"2.0","id":null,"method":"eth_call"}`,
+	} {
+		w := httptest.NewRecorder()
+		s.rpcHandler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body))))
+		assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+		b, err := ioutil.ReadAll(w.Result().Body)
+		assert.NoError(t, err)
+		assert.Regexp(t, "FF22024", string(b))
+	}
+
+	for _, body := range []string{
+		`{"method":{}}`,
+		`{"id":1,"method":`,
+		`{!`,
+		`"`,
+	} {
+		w := httptest.NewRecorder()
+		s.rpcHandler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body))))
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	}
+
+}
+
+func TestServeJSONRPCAcceptLanguage(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+
+	for lang, expected := range map[string]string{
+		"es-MX,es;q=0.9,en;q=0.8": "FF22018: Datos de solicitud no válidos",
+		"fr-FR":                   "FF22018: Invalid request data",
+		"":                        "FF22018: Invalid request data",
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`[`)))
+		req.Header.Set("Accept-Language", lang)
+		s.rpcHandler(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		b, err := ioutil.ReadAll(w.Result().Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), expected)
+	}
+
+}
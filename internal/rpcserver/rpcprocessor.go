@@ -18,15 +18,17 @@ package rpcserver
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
 	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
 	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
 	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/hyperledger/firefly-signer/pkg/signhook"
 )
 
 func (s *rpcServer) processRPC(ctx context.Context, rpcReq *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error) {
@@ -35,14 +37,54 @@ func (s *rpcServer) processRPC(ctx context.Context, rpcReq *rpcbackend.RPCReques
 		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
 	}
 
-	switch rpcReq.Method {
-	case "eth_accounts", "personal_accounts":
-		return s.processEthAccounts(ctx, rpcReq)
-	case "eth_sendTransaction":
-		return s.processEthSendTransaction(ctx, rpcReq)
-	default:
-		return s.backend.SyncRequest(ctx, rpcReq)
+	if handler, ok := interceptedMethods[rpcReq.Method]; ok {
+		return handler(s, ctx, rpcReq)
 	}
+	if s.coalescer != nil {
+		return s.coalescer.do(ctx, rpcReq, s.backend.SyncRequest)
+	}
+	return s.backend.SyncRequest(ctx, rpcReq)
+}
+
+type rpcMethodHandler func(s *rpcServer, ctx context.Context, rpcReq *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error)
+
+// interceptedMethods are processed by the signer. All other methods are passed through to the backend.
+var interceptedMethods = map[string]rpcMethodHandler{
+	"eth_accounts":         (*rpcServer).processEthAccounts,
+	"personal_accounts":    (*rpcServer).processEthAccounts,
+	"eth_sendTransaction":  (*rpcServer).processEthSendTransaction,
+	"eth_signTypedData_v4": (*rpcServer).processEthSignTypedDataV4,
+	"signer_capabilities":  (*rpcServer).processSignerCapabilities,
+}
+
+const (
+	// typedDataFormatCompact returns the signature as 65 bytes of R, S, V hex - as returned by MetaMask (the default)
+	typedDataFormatCompact = "compact"
+	// typedDataFormatSplit returns the signature as an object with separate r, s and v fields
+	typedDataFormatSplit = "split"
+)
+
+// sendTransactionOptions is the optional second parameter of eth_sendTransaction
+type sendTransactionOptions struct {
+	Submission string `json:"submission"`
+}
+
+// signTypedDataOptions is the optional third parameter of eth_signTypedData_v4
+type signTypedDataOptions struct {
+	Format string `json:"format"`
+}
+
+type splitSignature struct {
+	R ethtypes.HexBytes0xPrefix `json:"r"`
+	S ethtypes.HexBytes0xPrefix `json:"s"`
+	V ethtypes.HexInteger       `json:"v"`
+}
+
+// interceptedMethod returns true for methods that are processed by the signer, rather than
+// being passed straight through to the backend
+func interceptedMethod(method string) bool {
+	_, ok := interceptedMethods[method]
+	return ok
 }
 
 func (s *rpcServer) processEthAccounts(ctx context.Context, rpcReq *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error) {
@@ -50,7 +92,7 @@ func (s *rpcServer) processEthAccounts(ctx context.Context, rpcReq *rpcbackend.R
 	if err != nil {
 		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInternalError), err
 	}
-	b, _ := json.Marshal(&accounts)
+	b, _ := s.json.Marshal(&accounts)
 	return &rpcbackend.RPCResponse{
 		JSONRpc: "2.0",
 		ID:      rpcReq.ID,
@@ -66,7 +108,7 @@ func (s *rpcServer) processEthSendTransaction(ctx context.Context, rpcReq *rpcba
 	}
 
 	var txn ethsigner.Transaction
-	err := json.Unmarshal(rpcReq.Params[0].Bytes(), &txn)
+	err := s.json.Unmarshal(rpcReq.Params[0].Bytes(), &txn)
 	if err != nil {
 		err := i18n.WrapError(ctx, err, signermsgs.MsgInvalidTransaction)
 		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeParseError), err
@@ -77,31 +119,178 @@ func (s *rpcServer) processEthSendTransaction(ctx context.Context, rpcReq *rpcba
 		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
 	}
 
+	var options sendTransactionOptions
+	if len(rpcReq.Params) > 1 && !rpcReq.Params[1].IsNil() {
+		if err := s.json.Unmarshal(rpcReq.Params[1].Bytes(), &options); err != nil {
+			err := i18n.NewError(ctx, signermsgs.MsgInvalidParam, 1, rpcReq.Method, err)
+			return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+		}
+		if options.Submission != "" && options.Submission != signhook.SubmissionPrivate && options.Submission != signhook.SubmissionPublic {
+			err := i18n.NewError(ctx, signermsgs.MsgInvalidSubmission, options.Submission)
+			return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+		}
+	}
+
+	if s.gasCeiling != nil {
+		if err := s.gasCeiling.check(ctx, s.backend, &txn); err != nil {
+			return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+		}
+	}
+
+	var from ethtypes.Address0xHex
+	if s.accountQueues != nil || s.upstreams != nil {
+		if err := s.json.Unmarshal(txn.From, &from); err != nil {
+			return nil, err
+		}
+	}
+	if s.accountQueues != nil {
+		release, err := s.accountQueues.acquire(ctx, from)
+		if err != nil {
+			return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInternalError), err
+		}
+		defer release()
+	}
+	if s.upstreams == nil {
+		return s.sendTransaction(ctx, s.backend, rpcReq, &txn, options.Submission)
+	}
+
+	// Each attempt starts from the original request, so when failing over to another upstream a nonce
+	// we assigned is explicitly resynced from that upstream's view of the pending transactions
+	var res *rpcbackend.RPCResponse
+	upstreams := s.upstreams.route(from)
+	for i, u := range upstreams {
+		attemptReq, attemptTxn := *rpcReq, txn
+		res, err = s.sendTransaction(ctx, u.backend, &attemptReq, &attemptTxn, options.Submission)
+		if err == nil || !upstreamUnavailable(ctx, err.Error()) {
+			return res, err
+		}
+		s.upstreams.markFailed(ctx, u)
+		if i+1 < len(upstreams) {
+			log.L(ctx).Warnf("Failing over transaction from %s to upstream %s (nonce resync=%t)", from, upstreams[i+1].url, txn.Nonce == nil)
+		}
+	}
+	return res, err
+
+}
+
+// sendTransaction assigns the nonce if required, then signs the transaction and submits it to the backend
+// (unless a post-sign hook submits it)
+func (s *rpcServer) sendTransaction(ctx context.Context, backend rpcbackend.Backend, rpcReq *rpcbackend.RPCRequest, txn *ethsigner.Transaction, submission string) (*rpcbackend.RPCResponse, error) {
+
 	// We have trivial nonce management built-in for sequential signing API calls, by making a JSON/RPC request
 	// to the up-stream node. This should not be relied upon for production use cases.
 	// See FireFly Transaction Manager, or FireFly EthConnect, for more advanced nonce management capabilities.
 	if txn.Nonce == nil {
 		var from ethtypes.Address0xHex
-		err := json.Unmarshal(txn.From, &from)
+		err := s.json.Unmarshal(txn.From, &from)
 		if err != nil {
 			return nil, err
 		}
-		rpcErr := s.backend.CallRPC(ctx, &txn.Nonce, "eth_getTransactionCount", &from, "pending")
+		rpcErr := backend.CallRPC(ctx, &txn.Nonce, "eth_getTransactionCount", &from, "pending")
 		if rpcErr != nil {
 			return rpcbackend.RPCErrorResponse(rpcErr.Error(), rpcReq.ID, rpcbackend.RPCCodeInternalError), rpcErr.Error()
 		}
+		// Other replicas might have signed with the same pending nonce, before the node saw the transaction
+		if s.nonces != nil {
+			nonce, err := s.nonces.AssignNonce(ctx, s.chainID, from, txn.Nonce.Uint64())
+			if err != nil {
+				return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInternalError), err
+			}
+			txn.Nonce = ethtypes.NewHexIntegerU64(nonce)
+		}
 	}
 
 	// Sign the transaction
 	var hexData ethtypes.HexBytes0xPrefix
-	hexData, err = s.wallet.Sign(ctx, &txn, s.chainID)
+	hexData, err := ethsigner.SignWithWallet(ctx, s.wallet, txn, s.chainID)
 	if err != nil {
 		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInternalError), err
 	}
 
+	if len(s.postSignHooks) > 0 || submission == signhook.SubmissionPrivate {
+		signed, submitted, err := s.runPostSignHooks(ctx, txn, hexData, submission)
+		if err != nil {
+			return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInternalError), err
+		}
+		// A transaction the client requires to be private is never sent to the public mempool
+		if !submitted && submission == signhook.SubmissionPrivate {
+			err := i18n.NewError(ctx, signermsgs.MsgNotPrivatelySubmitted)
+			return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+		}
+		if submitted {
+			return &rpcbackend.RPCResponse{
+				JSONRpc: "2.0",
+				ID:      rpcReq.ID,
+				Result:  fftypes.JSONAnyPtr(fmt.Sprintf(`"%s"`, signed.Hash)),
+			}, nil
+		}
+	}
+
 	// Progress with the original request, now updated with a raw transaction fully signed
 	rpcReq.Method = "eth_sendRawTransaction"
 	rpcReq.Params = []*fftypes.JSONAny{fftypes.JSONAnyPtr(fmt.Sprintf(`"%s"`, hexData))}
-	return s.backend.SyncRequest(ctx, rpcReq)
+	return backend.SyncRequest(ctx, rpcReq)
+
+}
+
+func (s *rpcServer) processEthSignTypedDataV4(ctx context.Context, rpcReq *rpcbackend.RPCRequest) (*rpcbackend.RPCResponse, error) {
+
+	typedDataWallet, ok := s.wallet.(ethsigner.WalletTypedData)
+	if !ok {
+		err := i18n.NewError(ctx, signermsgs.MsgTypedDataNotSupported)
+		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+	}
+
+	if len(rpcReq.Params) < 2 {
+		err := i18n.NewError(ctx, signermsgs.MsgInvalidParamCount, 2, len(rpcReq.Params))
+		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+	}
+
+	var from ethtypes.Address0xHex
+	if err := s.json.Unmarshal(rpcReq.Params[0].Bytes(), &from); err != nil {
+		err := i18n.NewError(ctx, signermsgs.MsgInvalidParam, 0, rpcReq.Method, err)
+		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+	}
+
+	// MetaMask compatible clients pass the typed data as a JSON string, rather than an object
+	typedDataJSON := rpcReq.Params[1].Bytes()
+	var typedDataString string
+	if s.json.Unmarshal(typedDataJSON, &typedDataString) == nil {
+		typedDataJSON = []byte(typedDataString)
+	}
+	var payload eip712.TypedData
+	if err := s.json.Unmarshal(typedDataJSON, &payload); err != nil {
+		err := i18n.NewError(ctx, signermsgs.MsgInvalidParam, 1, rpcReq.Method, err)
+		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+	}
+
+	options := signTypedDataOptions{Format: typedDataFormatCompact}
+	if len(rpcReq.Params) > 2 && !rpcReq.Params[2].IsNil() {
+		if err := s.json.Unmarshal(rpcReq.Params[2].Bytes(), &options); err != nil {
+			err := i18n.NewError(ctx, signermsgs.MsgInvalidParam, 2, rpcReq.Method, err)
+			return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+		}
+	}
+	if options.Format != typedDataFormatCompact && options.Format != typedDataFormatSplit {
+		err := i18n.NewError(ctx, signermsgs.MsgInvalidTypedDataFormat, options.Format)
+		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInvalidRequest), err
+	}
+
+	result, err := typedDataWallet.SignTypedDataV4(ctx, from, &payload)
+	if err != nil {
+		return rpcbackend.RPCErrorResponse(err, rpcReq.ID, rpcbackend.RPCCodeInternalError), err
+	}
+
+	var b []byte
+	if options.Format == typedDataFormatSplit {
+		b, _ = s.json.Marshal(&splitSignature{R: result.R, S: result.S, V: result.V})
+	} else {
+		b, _ = s.json.Marshal(result.SignatureRSV)
+	}
+	return &rpcbackend.RPCResponse{
+		JSONRpc: "2.0",
+		ID:      rpcReq.ID,
+		Result:  fftypes.JSONAnyPtrBytes(b),
+	}, nil
 
 }
@@ -17,13 +17,22 @@
 package rpcserver
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"strings"
 	"testing"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
 	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
 	"github.com/hyperledger/firefly-signer/mocks/rpcbackendmocks"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/memwallet"
 	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -207,3 +216,250 @@ func TestSignSignFail(t *testing.T) {
 	assert.Regexp(t, "pop", err)
 
 }
+
+func TestSignLargeChainID(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+
+	// A hash-derived chain ID, larger than an int64
+	s.chainID, _ = new(big.Int).SetString("0x1cafecafecafecafecafe", 0)
+	var err error
+	s.wallet, err = memwallet.NewDevWallet(s.ctx, 1)
+	assert.NoError(t, err)
+
+	var rawTx ethtypes.HexBytes0xPrefix
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.On("SyncRequest", mock.Anything, mock.MatchedBy(func(rpcReq *rpcbackend.RPCRequest) bool {
+		return rpcReq.Method == "eth_sendRawTransaction" && rpcReq.Params[0].Unmarshal(s.ctx, &rawTx) == nil
+	})).Return(&rpcbackend.RPCResponse{JSONRpc: "2.0", ID: fftypes.JSONAnyPtr("1")}, nil)
+
+	_, err = s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_sendTransaction",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(`{"from": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "nonce": "0x0"}`),
+		},
+	})
+	assert.NoError(t, err)
+
+	signer, _, err := ethsigner.RecoverRawTransactionBig(s.ctx, rawTx, s.chainID)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", signer.String())
+
+	// A wallet that only supports int64 chain IDs cannot sign
+	s.wallet = &ethsignermocks.Wallet{}
+	_, err = s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_sendTransaction",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(`{"from": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "nonce": "0x0"}`),
+		},
+	})
+	assert.Regexp(t, "FF22174", err)
+
+}
+
+const testTypedData = `{"types":{"EIP712Domain":[{"name":"name","type":"string"}]},"primaryType":"EIP712Domain","domain":{"name":"test"}}`
+
+func newTestTypedDataSigner(s *rpcServer) *ethsignermocks.WalletTypedData {
+	w := &ethsignermocks.WalletTypedData{}
+	s.wallet = w
+	w.On("SignTypedDataV4", mock.Anything, *ethtypes.MustNewAddress("0xfb075bb99f2aa4c49955bf703509a227d7a12248"), mock.MatchedBy(func(td *eip712.TypedData) bool {
+		return td.PrimaryType == eip712.EIP712Domain && td.Domain["name"] == "test"
+	})).Return(&ethsigner.EIP712Result{
+		SignatureRSV: ethtypes.MustNewHexBytes0xPrefix("0x" + strings.Repeat("11", 32) + strings.Repeat("22", 32) + "1b"),
+		R:            ethtypes.MustNewHexBytes0xPrefix("0x" + strings.Repeat("11", 32)),
+		S:            ethtypes.MustNewHexBytes0xPrefix("0x" + strings.Repeat("22", 32)),
+		V:            *ethtypes.NewHexInteger64(27),
+	}, nil)
+	return w
+}
+
+func TestSignTypedDataCompact(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	newTestTypedDataSigner(s)
+
+	// Typed data as an object, with no options
+	rpcRes, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_signTypedData_v4",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`),
+			fftypes.JSONAnyPtr(testTypedData),
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `"0x`+strings.Repeat("11", 32)+strings.Repeat("22", 32)+`1b"`, rpcRes.Result.String())
+
+	// Typed data as a JSON string, as sent by MetaMask compatible clients
+	typedDataString, _ := json.Marshal(testTypedData)
+	rpcRes, err = s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_signTypedData_v4",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`),
+			fftypes.JSONAnyPtrBytes(typedDataString),
+			fftypes.JSONAnyPtr(`{"format":"compact"}`),
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `"0x`+strings.Repeat("11", 32)+strings.Repeat("22", 32)+`1b"`, rpcRes.Result.String())
+
+}
+
+func TestSignTypedDataSplit(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	newTestTypedDataSigner(s)
+
+	rpcRes, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_signTypedData_v4",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`),
+			fftypes.JSONAnyPtr(testTypedData),
+			fftypes.JSONAnyPtr(`{"format":"split"}`),
+		},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"r": "0x`+strings.Repeat("11", 32)+`",
+		"s": "0x`+strings.Repeat("22", 32)+`",
+		"v": "0x1b"
+	}`, rpcRes.Result.String())
+
+}
+
+func TestSignTypedDataNotSupported(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+
+	_, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_signTypedData_v4",
+	})
+	assert.Regexp(t, "FF22143", err)
+
+}
+
+func TestSignTypedDataBadParams(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	s.wallet = &ethsignermocks.WalletTypedData{}
+
+	for _, tc := range []struct {
+		params []string
+		err    string
+	}{
+		{params: []string{`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`}, err: "FF22019"},
+		{params: []string{`"wrong"`, testTypedData}, err: "FF22011.*0"},
+		{params: []string{`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`, `[]`}, err: "FF22011.*1"},
+		{params: []string{`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`, testTypedData, `"split"`}, err: "FF22011.*2"},
+		{params: []string{`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`, testTypedData, `{"format":"wrong"}`}, err: "FF22144.*wrong"},
+	} {
+		params := make([]*fftypes.JSONAny, len(tc.params))
+		for i, p := range tc.params {
+			params[i] = fftypes.JSONAnyPtr(p)
+		}
+		rpcRes, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+			ID:     fftypes.JSONAnyPtr("1"),
+			Method: "eth_signTypedData_v4",
+			Params: params,
+		})
+		assert.Regexp(t, tc.err, err)
+		assert.Equal(t, int64(rpcbackend.RPCCodeInvalidRequest), rpcRes.Error.Code)
+	}
+
+}
+
+func TestSignTypedDataSignFail(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	w := &ethsignermocks.WalletTypedData{}
+	s.wallet = w
+	w.On("SignTypedDataV4", mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("pop"))
+
+	_, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_signTypedData_v4",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`),
+			fftypes.JSONAnyPtr(testTypedData),
+			fftypes.JSONAnyPtr(`null`),
+		},
+	})
+	assert.Regexp(t, "pop", err)
+
+}
+
+func newTestRedisServer(t *testing.T) (*rpcServer, *miniredis.Miniredis, func()) {
+	mr := miniredis.RunT(t)
+	_, s, done := newTestServer(t, func() {
+		config.Set(signerconfig.RedisEnabled, true)
+		config.Set(signerconfig.RedisURL, "redis://"+mr.Addr())
+	})
+	s.chainID = big.NewInt(1)
+
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_getTransactionCount", mock.Anything, "pending").Run(func(args mock.Arguments) {
+		hi := args[1].(**ethtypes.HexInteger)
+		*hi = ethtypes.NewHexInteger64(12345)
+	}).Return(nil)
+	return s, mr, done
+}
+
+func TestSignNonceCoordinatedWithRedis(t *testing.T) {
+
+	s, _, done := newTestRedisServer(t)
+	defer done()
+
+	var nonces []int64
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Sign", mock.Anything, mock.Anything, int64(1)).Run(func(args mock.Arguments) {
+		nonces = append(nonces, args[1].(*ethsigner.Transaction).Nonce.Int64())
+	}).Return([]byte{0x01}, nil)
+	bm := s.backend.(*rpcbackendmocks.Backend)
+	bm.On("SyncRequest", mock.Anything, mock.Anything).Return(&rpcbackend.RPCResponse{
+		JSONRpc: "2.0",
+		ID:      fftypes.JSONAnyPtr("1"),
+		Result:  fftypes.JSONAnyPtr(`"0x61ca9c99c1d752fb3bda568b8566edf33ba93585c64a970566e6dfb540a5cbc1"`),
+	}, nil)
+
+	// Both get the same pending nonce from the node, as if from different replicas
+	for i := 0; i < 2; i++ {
+		_, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+			ID:     fftypes.JSONAnyPtr("1"),
+			Method: "eth_sendTransaction",
+			Params: []*fftypes.JSONAny{
+				fftypes.JSONAnyPtr(`{"from": "0xfb075bb99f2aa4c49955bf703509a227d7a12248"}`),
+			},
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []int64{12345, 12346}, nonces)
+
+}
+
+func TestSignNonceRedisFail(t *testing.T) {
+
+	s, mr, done := newTestRedisServer(t)
+	defer done()
+	mr.SetError("pop")
+
+	_, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_sendTransaction",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(`{"from": "0xfb075bb99f2aa4c49955bf703509a227d7a12248"}`),
+		},
+	})
+	assert.Regexp(t, "FF22147.*pop", err)
+
+}
@@ -18,18 +18,31 @@ package rpcserver
 
 import (
 	"context"
+	"math/big"
 	"net/http"
+	"strings"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/ffresty"
 	"github.com/hyperledger/firefly-common/pkg/httpserver"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/escrow"
+	"github.com/hyperledger/firefly-signer/internal/provisioning"
+	"github.com/hyperledger/firefly-signer/internal/redisnonce"
 	"github.com/hyperledger/firefly-signer/internal/signerconfig"
 	"github.com/hyperledger/firefly-signer/internal/signermsgs"
 	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
 	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/hyperledger/firefly-signer/pkg/signhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type Server interface {
@@ -38,20 +51,96 @@ type Server interface {
 	WaitStop() error
 }
 
-func NewServer(ctx context.Context, wallet ethsigner.Wallet) (ss Server, err error) {
+// NewServer builds the JSON/RPC server, signing with the wallet. The post-sign hooks are invoked in order for
+// each transaction signed for eth_sendTransaction, before it is submitted.
+func NewServer(ctx context.Context, wallet ethsigner.Wallet, postSignHooks ...*signhook.Registration) (ss Server, err error) {
 
+	jsonCodec, err := rpcbackend.NewJSONCodec(ctx, config.GetString(signerconfig.ServerJSONCodec))
+	if err != nil {
+		return nil, err
+	}
 	httpClient, err := ffresty.New(ctx, signerconfig.BackendConfig)
 	if err != nil {
 		return nil, err
 	}
+	backendOptions := rpcbackend.RPCClientOptions{JSONCodec: jsonCodec}
 	s := &rpcServer{
-		backend:       rpcbackend.NewRPCClient(httpClient),
-		apiServerDone: make(chan error),
-		wallet:        wallet,
-		chainID:       config.GetInt64(signerconfig.BackendChainID),
+		backend:           rpcbackend.NewRPCClientWithOption(httpClient, backendOptions),
+		httpClient:        httpClient,
+		json:              jsonCodec,
+		streamPassthrough: config.GetBool(signerconfig.BackendStreamPassthrough),
+		h2c:               config.GetBool(signerconfig.ServerH2C),
+		compressResponses: config.GetBool(signerconfig.ServerCompressionEnabled),
+		apiServerDone:     make(chan error),
+		wallet:            wallet,
+		postSignHooks:     append([]*signhook.Registration{}, postSignHooks...),
+		chainID:           big.NewInt(config.GetInt64(signerconfig.BackendChainID)),
 	}
 	s.ctx, s.cancelCtx = context.WithCancel(ctx)
 
+	if s.upstreams, err = newUpstreamRouter(ctx, s.backend, backendOptions); err != nil {
+		return nil, err
+	}
+
+	if config.GetBool(signerconfig.MetricsEnabled) {
+		if err = s.initMetrics(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.GetBool(signerconfig.ServerAccountQueueEnabled) {
+		if s.accountQueues, err = newAccountQueues(ctx, s.metricsRegistry); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.GetBool(signerconfig.ServerCoalesceEnabled) {
+		if s.coalescer, err = newRequestCoalescer(ctx, config.GetStringSlice(signerconfig.ServerCoalesceMethods), s.metricsRegistry); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.GetBool(signerconfig.GasCeilingEnabled) {
+		if s.gasCeiling, err = newGasCeiling(ctx, s.metricsRegistry); err != nil {
+			return nil, err
+		}
+	}
+
+	// The private relay follows any hooks supplied by an embedding program
+	if config.GetBool(signerconfig.PrivateRelayEnabled) {
+		relay, err := newPrivateRelay(ctx, jsonCodec)
+		if err != nil {
+			return nil, err
+		}
+		s.postSignHooks = append(s.postSignHooks, &signhook.Registration{Name: "privateRelay", Hook: relay})
+	}
+
+	if config.GetBool(signerconfig.ProvisioningEnabled) {
+		var fileWallet *fswallet.Config
+		if config.GetBool(signerconfig.FileWalletEnabled) {
+			fileWallet = fswallet.ReadConfig(signerconfig.FileWalletConfig)
+		}
+		if s.provisioner, err = provisioning.NewProvisioner(ctx, provisioning.ReadConfig(signerconfig.ProvisioningConfig), fileWallet); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.GetBool(signerconfig.AdminEnabled) {
+		if err = s.initAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.GetBool(signerconfig.RedisEnabled) {
+		if s.nonces, err = redisnonce.NewManager(ctx, &redisnonce.Config{
+			URL:       config.GetString(signerconfig.RedisURL),
+			KeyPrefix: config.GetString(signerconfig.RedisKeyPrefix),
+			NonceTTL:  config.GetDuration(signerconfig.RedisNonceTTL),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
 	s.apiServer, err = httpserver.NewHTTPServer(ctx, "server", s.router(), s.apiServerDone, signerconfig.ServerConfig, signerconfig.CorsConfig)
 	if err != nil {
 		return nil, err
@@ -60,44 +149,134 @@ func NewServer(ctx context.Context, wallet ethsigner.Wallet) (ss Server, err err
 	return s, err
 }
 
+const metricsSubsystemServer = "jsonrpc_server"
+
+// metricsRegistrant is implemented by wallets that can record metrics
+type metricsRegistrant interface {
+	RegisterMetrics(ctx context.Context, registry metric.MetricsRegistry) error
+}
+
+func (s *rpcServer) initMetrics(ctx context.Context) (err error) {
+	s.metricsRegistry = metric.NewPrometheusMetricsRegistry("ffsigner")
+	// Standard HTTP request metrics for the JSON/RPC server
+	if err := s.metricsRegistry.NewHTTPMetricsInstrumentationsForSubsystem(ctx, metricsSubsystemServer, false, prometheus.DefBuckets, nil); err != nil {
+		return err
+	}
+	if mr, ok := s.wallet.(metricsRegistrant); ok {
+		if err := mr.RegisterMetrics(ctx, s.metricsRegistry); err != nil {
+			return err
+		}
+	}
+	handler, err := s.metricsRegistry.HTTPHandler(ctx, promhttp.HandlerOpts{})
+	if err != nil {
+		return err
+	}
+	r := mux.NewRouter()
+	r.Path(config.GetString(signerconfig.MetricsPath)).Methods(http.MethodGet).Handler(handler)
+	s.metricsServerDone = make(chan error)
+	s.metricsServer, err = httpserver.NewHTTPServer(ctx, "metrics", r, s.metricsServerDone, signerconfig.MetricsConfig, signerconfig.CorsConfig)
+	return err
+}
+
 type rpcServer struct {
 	ctx       context.Context
 	cancelCtx func()
 	backend   rpcbackend.Backend
+	json      rpcbackend.JSONCodec
+	upstreams *upstreamRouter // nil unless transactions are routed across multiple upstreams
+
+	httpClient        *resty.Client
+	streamPassthrough bool
+	h2c               bool
+	compressResponses bool
 
 	started       bool
 	apiServer     httpserver.HTTPServer
 	apiServerDone chan error
 
-	chainID int64
+	metricsRegistry   metric.MetricsRegistry
+	metricsServer     httpserver.HTTPServer
+	metricsServerDone chan error
+
+	escrow          escrow.Manager
+	adminServer     httpserver.HTTPServer
+	adminServerDone chan error
+
+	chainID *big.Int
 	wallet  ethsigner.Wallet
+	nonces  redisnonce.Manager // nil unless nonces are coordinated with other replicas
+
+	postSignHooks []*signhook.Registration
+
+	accountQueues *accountQueues    // nil unless transactions are serialized per account
+	coalescer     *requestCoalescer // nil unless identical concurrent reads share a backend call
+	gasCeiling    *gasCeiling       // nil unless fees are checked against a gas price oracle
+
+	provisioner provisioning.Provisioner // nil unless accounts are provisioned at startup
 }
 
 func (s *rpcServer) router() *mux.Router {
 	mux := mux.NewRouter()
+	mux.Use(s.requestIDMiddleware)
+	if s.metricsRegistry != nil {
+		metricsMiddleware, _ := s.metricsRegistry.GetHTTPMetricsInstrumentationsMiddlewareForSubsystem(s.ctx, metricsSubsystemServer)
+		mux.Use(metricsMiddleware)
+	}
+	mux.Use(s.compressionMiddleware)
+	if s.h2c {
+		// HTTP/2 with prior knowledge starts with a "PRI *" request, so the path must not be cleaned
+		mux.SkipClean(true)
+		mux.MatcherFunc(isH2CRequest).Handler(h2c.NewHandler(mux, &http2.Server{}))
+	}
 	mux.Path("/").Methods(http.MethodPost).Handler(http.HandlerFunc(s.rpcHandler))
+	mux.Path("/readyz").Methods(http.MethodGet).Handler(http.HandlerFunc(s.readyzHandler))
 	return mux
 }
 
+// isH2CRequest matches the start of an HTTP/2 connection without TLS, either with prior knowledge or as an upgrade
+func isH2CRequest(r *http.Request, _ *mux.RouteMatch) bool {
+	return (r.Method == "PRI" && r.URL.Path == "*") || strings.EqualFold(r.Header.Get("Upgrade"), "h2c")
+}
+
 func (s *rpcServer) runAPIServer() {
 	s.apiServer.ServeHTTP(s.ctx)
 }
 
 func (s *rpcServer) Start() error {
-	if s.chainID < 0 {
+	if s.chainID.Sign() < 0 {
 		var chainID ethtypes.HexInteger
 		rpcErr := s.backend.CallRPC(s.ctx, &chainID, "net_version")
 		if rpcErr != nil {
 			return i18n.WrapError(s.ctx, rpcErr.Error(), signermsgs.MsgQueryChainID)
 		}
-		s.chainID = chainID.BigInt().Int64()
+		s.chainID = chainID.BigInt()
+	}
+
+	// Accounts are created before the wallet is initialized, so it indexes them
+	if s.provisioner != nil {
+		if err := s.provisioner.CreateAccounts(s.ctx); err != nil {
+			return err
+		}
 	}
 
 	err := s.wallet.Initialize(s.ctx)
 	if err != nil {
 		return err
 	}
+
+	if s.provisioner != nil {
+		if _, err := s.provisioner.Verify(s.ctx, s.wallet); err != nil {
+			return err
+		}
+	}
+
 	go s.runAPIServer()
+	if s.metricsServer != nil {
+		go s.metricsServer.ServeHTTP(s.ctx)
+	}
+	if s.adminServer != nil {
+		go s.adminServer.ServeHTTP(s.ctx)
+	}
 	s.started = true
 	return nil
 }
@@ -110,6 +289,19 @@ func (s *rpcServer) WaitStop() (err error) {
 	if s.started {
 		s.started = false
 		err = <-s.apiServerDone
+		if s.metricsServer != nil {
+			if metricsErr := <-s.metricsServerDone; err == nil {
+				err = metricsErr
+			}
+		}
+		if s.adminServer != nil {
+			if adminErr := <-s.adminServerDone; err == nil {
+				err = adminErr
+			}
+		}
+	}
+	if s.nonces != nil {
+		_ = s.nonces.Close()
 	}
 	return err
 }
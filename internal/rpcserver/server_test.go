@@ -19,23 +19,35 @@ package rpcserver
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"net"
+	"net/http"
+	"os"
+	"path"
 	"strings"
 	"testing"
 
+	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/fftls"
 	"github.com/hyperledger/firefly-common/pkg/httpserver"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/provisioning"
 	"github.com/hyperledger/firefly-signer/internal/signerconfig"
 	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
 	"github.com/hyperledger/firefly-signer/mocks/rpcbackendmocks"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
 	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
-func newTestServer(t *testing.T) (string, *rpcServer, func()) {
+func newTestServer(t *testing.T, setConfig ...func()) (string, *rpcServer, func()) {
 	signerconfig.Reset()
+	for _, fn := range setConfig {
+		fn()
+	}
 
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	assert.NoError(t, err)
@@ -74,6 +86,17 @@ func TestBadTLSConfig(t *testing.T) {
 	assert.Regexp(t, "FF00153", err)
 }
 
+func TestBadRedisConfig(t *testing.T) {
+	signerconfig.Reset()
+	config.Set(signerconfig.RedisEnabled, true)
+	config.Set(signerconfig.RedisURL, "wrong://")
+
+	w := &ethsignermocks.Wallet{}
+
+	_, err := NewServer(context.Background(), w)
+	assert.Regexp(t, "FF22145", err)
+}
+
 func TestStartStop(t *testing.T) {
 
 	_, s, done := newTestServer(t)
@@ -90,7 +113,7 @@ func TestStartStop(t *testing.T) {
 	err := s.Start()
 	assert.NoError(t, err)
 
-	assert.Equal(t, int64(12345), s.chainID)
+	assert.Equal(t, int64(12345), s.chainID.Int64())
 
 }
 
@@ -128,6 +151,81 @@ func TestStartFailInitialize(t *testing.T) {
 
 }
 
+func TestStartProvisioning(t *testing.T) {
+
+	reportFile := path.Join(t.TempDir(), "report.json")
+	_, s, done := newTestServer(t, func() {
+		config.Set(signerconfig.BackendChainID, 1)
+		config.Set(signerconfig.ProvisioningEnabled, true)
+		signerconfig.ProvisioningConfig.Set(provisioning.ConfigReportFile, reportFile)
+	})
+	defer done()
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Initialize", mock.Anything).Return(nil)
+	w.On("GetAccounts", mock.Anything).Return([]*ethtypes.Address0xHex{}, nil)
+	err := s.Start()
+	assert.NoError(t, err)
+
+	_, err = os.Stat(reportFile)
+	assert.NoError(t, err)
+
+}
+
+func TestBadProvisioningConfig(t *testing.T) {
+	signerconfig.Reset()
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+fileWallet:
+  enabled: false
+provisioning:
+  enabled: true
+  accounts:
+  - name: alice
+`))
+	assert.NoError(t, err)
+
+	_, err = NewServer(context.Background(), &ethsignermocks.Wallet{})
+	assert.Regexp(t, "FF22234", err)
+}
+
+func TestStartFailProvisioningCreate(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	s.chainID = big.NewInt(1)
+
+	var err error
+	s.provisioner, err = provisioning.NewProvisioner(s.ctx, &provisioning.Config{
+		Accounts: []provisioning.AccountConfig{{Name: "alice"}},
+	}, &fswallet.Config{Path: t.TempDir()})
+	assert.NoError(t, err)
+
+	err = s.Start()
+	assert.Regexp(t, "FF22231", err)
+
+}
+
+func TestStartFailProvisioningVerify(t *testing.T) {
+
+	_, s, done := newTestServer(t)
+	defer done()
+	s.chainID = big.NewInt(1)
+
+	var err error
+	s.provisioner, err = provisioning.NewProvisioner(s.ctx, &provisioning.Config{
+		Accounts: []provisioning.AccountConfig{{Address: "0x1f185718734552d08278aa70f804580bab5fd2b4"}},
+	}, nil)
+	assert.NoError(t, err)
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Initialize", mock.Anything).Return(nil)
+	w.On("GetAccounts", mock.Anything).Return([]*ethtypes.Address0xHex{}, nil)
+	err = s.Start()
+	assert.Regexp(t, "FF22237", err)
+
+}
+
 func TestBadConfig(t *testing.T) {
 
 	signerconfig.Reset()
@@ -136,3 +234,62 @@ func TestBadConfig(t *testing.T) {
 	assert.Error(t, err)
 
 }
+
+func TestBadJSONCodecConfig(t *testing.T) {
+
+	signerconfig.Reset()
+	config.Set(signerconfig.ServerJSONCodec, "wrong")
+	_, err := NewServer(context.Background(), &ethsignermocks.Wallet{})
+	assert.Regexp(t, "FF22097", err)
+
+}
+
+func TestStartStopWithMetrics(t *testing.T) {
+
+	signerconfig.Reset()
+	config.Set(signerconfig.MetricsEnabled, true)
+	signerconfig.MetricsConfig.Set(httpserver.HTTPConfAddress, "127.0.0.1")
+	signerconfig.MetricsConfig.Set(httpserver.HTTPConfPort, 0)
+	signerconfig.ServerConfig.Set(httpserver.HTTPConfAddress, "127.0.0.1")
+	signerconfig.ServerConfig.Set(httpserver.HTTPConfPort, 0)
+	config.Set(signerconfig.BackendChainID, 12345)
+
+	w := &ethsignermocks.Wallet{}
+	w.On("Initialize", mock.Anything).Return(nil)
+
+	ss, err := NewServer(context.Background(), w)
+	assert.NoError(t, err)
+	s := ss.(*rpcServer)
+	assert.NotNil(t, s.metricsServer)
+
+	err = s.Start()
+	assert.NoError(t, err)
+
+	res, err := http.Get(fmt.Sprintf("http://%s/metrics", s.metricsServer.Addr()))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	s.Stop()
+	err = s.WaitStop()
+	assert.NoError(t, err)
+
+}
+
+type metricsWallet struct {
+	*ethsignermocks.Wallet
+	err error
+}
+
+func (mw *metricsWallet) RegisterMetrics(_ context.Context, _ metric.MetricsRegistry) error {
+	return mw.err
+}
+
+func TestMetricsWalletRegisterFail(t *testing.T) {
+
+	signerconfig.Reset()
+	config.Set(signerconfig.MetricsEnabled, true)
+
+	_, err := NewServer(context.Background(), &metricsWallet{Wallet: &ethsignermocks.Wallet{}, err: fmt.Errorf("pop")})
+	assert.Regexp(t, "pop", err)
+
+}
@@ -0,0 +1,116 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+)
+
+// upstream is one of the JSON/RPC nodes that transactions can be submitted to
+type upstream struct {
+	url         string
+	backend     rpcbackend.Backend
+	failedUntil time.Time // protected by the router's mux
+}
+
+// upstreamRouter routes the transactions from each address to the same upstream, so the nonces are
+// assigned from one node's view of the pending transactions, and are not reordered by nodes with
+// different mempools. Rendezvous hashing is used, so each replica of the signer makes the same
+// choice, and adding or removing an upstream only moves the addresses that were routed to it.
+type upstreamRouter struct {
+	upstreams  []*upstream
+	retryDelay time.Duration
+	mux        sync.Mutex
+}
+
+// newUpstreamRouter returns nil if only the backend URL is configured. The primary backend is the
+// first upstream, and each additional URL shares the rest of the backend configuration.
+func newUpstreamRouter(ctx context.Context, primary rpcbackend.Backend, options rpcbackend.RPCClientOptions) (*upstreamRouter, error) {
+	urls := config.GetStringSlice(signerconfig.BackendUpstreams)
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	ur := &upstreamRouter{
+		upstreams:  []*upstream{{url: signerconfig.BackendConfig.GetString(ffresty.HTTPConfigURL), backend: primary}},
+		retryDelay: config.GetDuration(signerconfig.BackendUpstreamRetryDelay),
+	}
+	for _, url := range urls {
+		httpClient, err := ffresty.New(ctx, signerconfig.BackendConfig)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.SetBaseURL(url)
+		ur.upstreams = append(ur.upstreams, &upstream{url: url, backend: rpcbackend.NewRPCClientWithOption(httpClient, options)})
+	}
+	return ur, nil
+}
+
+// route returns the upstreams in order of preference for the address. Upstreams that failed
+// within the retry delay are moved to the end, so they are only used if all the others fail.
+func (ur *upstreamRouter) route(addr ethtypes.Address0xHex) []*upstream {
+	type ranked struct {
+		u      *upstream
+		weight uint64
+		failed bool
+	}
+	now := time.Now()
+	ur.mux.Lock()
+	candidates := make([]*ranked, len(ur.upstreams))
+	for i, u := range ur.upstreams {
+		h := sha256.Sum256(append([]byte(u.url), addr[:]...))
+		candidates[i] = &ranked{u: u, weight: binary.BigEndian.Uint64(h[0:8]), failed: now.Before(u.failedUntil)}
+	}
+	ur.mux.Unlock()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].failed != candidates[j].failed {
+			return !candidates[i].failed
+		}
+		return candidates[i].weight > candidates[j].weight
+	})
+	ordered := make([]*upstream, len(candidates))
+	for i, c := range candidates {
+		ordered[i] = c.u
+	}
+	return ordered
+}
+
+func (ur *upstreamRouter) markFailed(ctx context.Context, u *upstream) {
+	ur.mux.Lock()
+	defer ur.mux.Unlock()
+	u.failedUntil = time.Now().Add(ur.retryDelay)
+	log.L(ctx).Warnf("Upstream %s unavailable - routing transactions to other upstreams for %s", u.url, ur.retryDelay)
+}
+
+// upstreamUnavailable is true for failures to get a JSON/RPC response from the upstream at all, as
+// opposed to errors returned by the node (such as a nonce that is too low) which are not retried
+func upstreamUnavailable(ctx context.Context, errMsg string) bool {
+	return ctx.Err() == nil && strings.HasPrefix(errMsg, string(signermsgs.MsgRPCRequestFailed))
+}
@@ -0,0 +1,221 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testNode is a JSON/RPC node that returns its own pending nonce, and records the methods called
+type testNode struct {
+	server   *httptest.Server
+	nonce    string
+	rpcError bool
+	mux      sync.Mutex
+	methods  []string
+}
+
+func newTestNode(t *testing.T, nonce string) *testNode {
+	n := &testNode{nonce: nonce}
+	n.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpcbackend.RPCRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		n.mux.Lock()
+		n.methods = append(n.methods, req.Method)
+		n.mux.Unlock()
+		res := &rpcbackend.RPCResponse{JSONRpc: "2.0", ID: req.ID}
+		switch {
+		case n.rpcError:
+			res.Error = &rpcbackend.RPCError{Code: int64(rpcbackend.RPCCodeInternalError), Message: "nonce too low"}
+		case req.Method == "eth_getTransactionCount":
+			res.Result = fftypes.JSONAnyPtr(fmt.Sprintf(`"%s"`, n.nonce))
+		default:
+			res.Result = fftypes.JSONAnyPtr(`"0x61ca9c99c1d752fb3bda568b8566edf33ba93585c64a970566e6dfb540a5cbc1"`)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+func (n *testNode) calls() []string {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return append([]string{}, n.methods...)
+}
+
+func newTestUpstreamsServer(t *testing.T, nodes ...*testNode) (*rpcServer, func()) {
+	_, s, done := newTestServer(t, func() {
+		signerconfig.BackendConfig.Set(ffresty.HTTPConfigURL, nodes[0].server.URL)
+		signerconfig.BackendConfig.Set(ffresty.HTTPConfigRetryEnabled, false)
+		upstreams := make([]string, 0, len(nodes)-1)
+		for _, n := range nodes[1:] {
+			upstreams = append(upstreams, n.server.URL)
+		}
+		config.Set(signerconfig.BackendUpstreams, upstreams)
+	})
+	s.chainID = big.NewInt(1)
+	return s, done
+}
+
+// addressRoutedTo finds an address whose preferred upstream is the one with the URL
+func addressRoutedTo(s *rpcServer, url string) ethtypes.Address0xHex {
+	for i := 0; ; i++ {
+		addr := *ethtypes.MustNewAddress(fmt.Sprintf("0x%040x", i))
+		if s.upstreams.route(addr)[0].url == url {
+			return addr
+		}
+	}
+}
+
+func sendTransactionRequest(addr ethtypes.Address0xHex) *rpcbackend.RPCRequest {
+	return &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_sendTransaction",
+		Params: []*fftypes.JSONAny{
+			fftypes.JSONAnyPtr(fmt.Sprintf(`{"from":"%s","to":"0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20","gas":"0x5208"}`, addr)),
+		},
+	}
+}
+
+func TestUpstreamRoutingConsistent(t *testing.T) {
+
+	node1, node2, node3 := newTestNode(t, "0x1"), newTestNode(t, "0x2"), newTestNode(t, "0x3")
+	s, done := newTestUpstreamsServer(t, node1, node2, node3)
+	defer done()
+
+	assert.Len(t, s.upstreams.upstreams, 3)
+	used := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		addr := *ethtypes.MustNewAddress(fmt.Sprintf("0x%040x", i))
+		preferred := s.upstreams.route(addr)
+		assert.Len(t, preferred, 3)
+		assert.Equal(t, preferred, s.upstreams.route(addr))
+		used[preferred[0].url]++
+	}
+	for _, n := range []*testNode{node1, node2, node3} {
+		assert.Greater(t, used[n.server.URL], 50)
+	}
+
+}
+
+func TestUpstreamRoutingSendTransaction(t *testing.T) {
+
+	node1, node2 := newTestNode(t, "0x1"), newTestNode(t, "0x2")
+	s, done := newTestUpstreamsServer(t, node1, node2)
+	defer done()
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Sign", mock.Anything, mock.MatchedBy(func(txn *ethsigner.Transaction) bool {
+		return txn.Nonce.Uint64() == 2
+	}), int64(1)).Return([]byte{0x01}, nil)
+
+	addr := addressRoutedTo(s, node2.server.URL)
+	for i := 0; i < 3; i++ {
+		_, err := s.processRPC(s.ctx, sendTransactionRequest(addr))
+		assert.NoError(t, err)
+	}
+	assert.Empty(t, node1.calls())
+	assert.Len(t, node2.calls(), 6)
+
+}
+
+func TestUpstreamFailoverResyncsNonce(t *testing.T) {
+
+	node1, node2 := newTestNode(t, "0x1"), newTestNode(t, "0x2")
+	s, done := newTestUpstreamsServer(t, node1, node2)
+	defer done()
+
+	w := s.wallet.(*ethsignermocks.Wallet)
+	w.On("Sign", mock.Anything, mock.MatchedBy(func(txn *ethsigner.Transaction) bool {
+		return txn.Nonce.Uint64() == 1
+	}), int64(1)).Return([]byte{0x01}, nil)
+
+	addr := addressRoutedTo(s, node2.server.URL)
+	node2.server.Close()
+	rpcRes, err := s.processRPC(s.ctx, sendTransactionRequest(addr))
+	assert.NoError(t, err)
+	assert.Equal(t, `"0x61ca9c99c1d752fb3bda568b8566edf33ba93585c64a970566e6dfb540a5cbc1"`, rpcRes.Result.String())
+	assert.Equal(t, []string{"eth_getTransactionCount", "eth_sendRawTransaction"}, node1.calls())
+
+	// The failed upstream is now least preferred, until the retry delay passes
+	assert.Equal(t, node1.server.URL, s.upstreams.route(addr)[0].url)
+	s.upstreams.upstreams[1].failedUntil = time.Now()
+	assert.Equal(t, node2.server.URL, s.upstreams.route(addr)[0].url)
+
+}
+
+func TestUpstreamNodeErrorNotRetried(t *testing.T) {
+
+	node1, node2 := newTestNode(t, "0x1"), newTestNode(t, "0x2")
+	s, done := newTestUpstreamsServer(t, node1, node2)
+	defer done()
+
+	addr := addressRoutedTo(s, node1.server.URL)
+	node1.rpcError = true
+	_, err := s.processRPC(s.ctx, sendTransactionRequest(addr))
+	assert.Regexp(t, "nonce too low", err)
+	assert.Empty(t, node2.calls())
+
+}
+
+func TestUpstreamAllUnavailable(t *testing.T) {
+
+	node1, node2 := newTestNode(t, "0x1"), newTestNode(t, "0x2")
+	s, done := newTestUpstreamsServer(t, node1, node2)
+	defer done()
+
+	node1.server.Close()
+	node2.server.Close()
+	_, err := s.processRPC(s.ctx, sendTransactionRequest(addressRoutedTo(s, node1.server.URL)))
+	assert.Regexp(t, "FF22012", err)
+
+}
+
+func TestUpstreamBadFrom(t *testing.T) {
+
+	node1, node2 := newTestNode(t, "0x1"), newTestNode(t, "0x2")
+	s, done := newTestUpstreamsServer(t, node1, node2)
+	defer done()
+
+	_, err := s.processRPC(s.ctx, &rpcbackend.RPCRequest{
+		ID:     fftypes.JSONAnyPtr("1"),
+		Method: "eth_sendTransaction",
+		Params: []*fftypes.JSONAny{fftypes.JSONAnyPtr(`{"from":"bad"}`)},
+	})
+	assert.Regexp(t, "bad address", err)
+
+}
@@ -0,0 +1,180 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// OnFailureFail refuses to start if the self-test fails
+	OnFailureFail = "fail"
+	// OnFailureWarn logs a warning if the self-test fails, and starts anyway
+	OnFailureWarn = "warn"
+)
+
+const selfTestChainID = 1337
+
+// keccakVectors are known Keccak-256 (pre-standard SHA-3, as used by Ethereum) digests
+var keccakVectors = map[string]string{
+	"":    "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+	"abc": "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45",
+}
+
+type check struct {
+	name string
+	fn   func(ctx context.Context, keypair *secp256k1.KeyPair) error
+}
+
+var checks = []check{
+	{name: "keccak256", fn: checkKeccak},
+	{name: "legacy transaction", fn: func(ctx context.Context, keypair *secp256k1.KeyPair) error {
+		return checkTransaction(ctx, keypair, func(txn *ethsigner.Transaction) ([]byte, error) {
+			return txn.SignLegacyOriginal(keypair)
+		})
+	}},
+	{name: "EIP-155 transaction", fn: func(ctx context.Context, keypair *secp256k1.KeyPair) error {
+		return checkTransaction(ctx, keypair, func(txn *ethsigner.Transaction) ([]byte, error) {
+			return txn.SignLegacyEIP155(keypair, selfTestChainID)
+		})
+	}},
+	{name: "EIP-1559 transaction", fn: func(ctx context.Context, keypair *secp256k1.KeyPair) error {
+		return checkTransaction(ctx, keypair, func(txn *ethsigner.Transaction) ([]byte, error) {
+			return txn.SignEIP1559(keypair, selfTestChainID)
+		})
+	}},
+	{name: "EIP-712 typed data", fn: checkTypedData},
+}
+
+// Run checks the cryptography the signer depends on works correctly with the active secp256k1 backend, before
+// any traffic is served, so a miscompiled or broken backend is found at startup rather than in production. It
+// signs and recovers each supported transaction type and EIP-712 typed data with an ephemeral key, and checks
+// Keccak-256 against known vectors. With onFailure set to warn, a failure is logged and nil returned.
+func Run(ctx context.Context, onFailure string) error {
+	if onFailure != OnFailureFail && onFailure != OnFailureWarn {
+		return i18n.NewError(ctx, signermsgs.MsgUnknownSelfTestOnFailure, onFailure)
+	}
+	err := runChecks(ctx)
+	if err != nil && onFailure == OnFailureWarn {
+		log.L(ctx).Warnf("Starting despite self-test failure: %s", err)
+		return nil
+	}
+	return err
+}
+
+func runChecks(ctx context.Context) error {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgSelfTestFailed, secp256k1.ActiveBackend(), "key generation", err)
+	}
+	defer keypair.Destroy()
+	for _, c := range checks {
+		if err := c.fn(ctx, keypair); err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgSelfTestFailed, secp256k1.ActiveBackend(), c.name, err)
+		}
+	}
+	log.L(ctx).Infof("Self-test passed (secp256k1 backend %s)", secp256k1.ActiveBackend())
+	return nil
+}
+
+func checkKeccak(_ context.Context, _ *secp256k1.KeyPair) error {
+	for input, expected := range keccakVectors {
+		hash := sha3.NewLegacyKeccak256()
+		hash.Write([]byte(input))
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+			return fmt.Errorf("digest of %q is %s (expected %s)", input, actual, expected)
+		}
+	}
+	return nil
+}
+
+func checkTransaction(ctx context.Context, keypair *secp256k1.KeyPair, sign func(txn *ethsigner.Transaction) ([]byte, error)) error {
+	txn := &ethsigner.Transaction{
+		Nonce:                ethtypes.NewHexInteger64(1),
+		GasPrice:             ethtypes.NewHexInteger64(1000000000),
+		MaxPriorityFeePerGas: ethtypes.NewHexInteger64(1000000000),
+		MaxFeePerGas:         ethtypes.NewHexInteger64(2000000000),
+		GasLimit:             ethtypes.NewHexInteger64(21000),
+		To:                   ethtypes.MustNewAddress("0x497eedc4299dea2f2a364be10025d0ad0f702de3"),
+		Value:                ethtypes.NewHexInteger64(100),
+		Data:                 ethtypes.MustNewHexBytes0xPrefix("0xfeedbeef"),
+	}
+	raw, err := sign(txn)
+	if err != nil {
+		return err
+	}
+	addr, decoded, err := ethsigner.RecoverRawTransaction(ctx, raw, selfTestChainID)
+	if err != nil {
+		return err
+	}
+	if *addr != keypair.Address {
+		return fmt.Errorf("recovered %s (expected %s)", addr, keypair.Address)
+	}
+	if decoded.Nonce.Int64() != 1 || !bytes.Equal(decoded.Data, txn.Data) {
+		return fmt.Errorf("decoded transaction does not match the signed transaction")
+	}
+	return nil
+}
+
+func checkTypedData(ctx context.Context, keypair *secp256k1.KeyPair) error {
+	result, err := ethsigner.SignTypedDataV4(ctx, keypair, &eip712.TypedData{
+		Types: eip712.TypeSet{
+			eip712.EIP712Domain: {
+				{Name: "name", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"SelfTest": {
+				{Name: "message", Type: "string"},
+			},
+		},
+		PrimaryType: "SelfTest",
+		Domain: map[string]interface{}{
+			"name":    "ffsigner",
+			"chainId": selfTestChainID,
+		},
+		Message: map[string]interface{}{
+			"message": "self-test",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	sig, err := secp256k1.DecodeCompactRSV(ctx, result.SignatureRSV)
+	if err != nil {
+		return err
+	}
+	addr, err := sig.RecoverDirect(result.Hash, selfTestChainID)
+	if err != nil {
+		return err
+	}
+	if *addr != keypair.Address {
+		return fmt.Errorf("recovered %s (expected %s)", addr, keypair.Address)
+	}
+	return nil
+}
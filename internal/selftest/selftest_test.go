@@ -0,0 +1,68 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selftest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func withFailingCheck(t *testing.T) {
+	origChecks := checks
+	checks = append(append([]check{}, checks...), check{
+		name: "broken",
+		fn: func(_ context.Context, _ *secp256k1.KeyPair) error {
+			return fmt.Errorf("pop")
+		},
+	})
+	t.Cleanup(func() { checks = origChecks })
+}
+
+func TestSelfTestOK(t *testing.T) {
+	err := Run(context.Background(), OnFailureFail)
+	assert.NoError(t, err)
+}
+
+func TestSelfTestFail(t *testing.T) {
+	withFailingCheck(t)
+	err := Run(context.Background(), OnFailureFail)
+	assert.Regexp(t, "FF22156.*go.*broken: pop", err)
+}
+
+func TestSelfTestWarn(t *testing.T) {
+	withFailingCheck(t)
+	err := Run(context.Background(), OnFailureWarn)
+	assert.NoError(t, err)
+}
+
+func TestSelfTestBadOnFailure(t *testing.T) {
+	err := Run(context.Background(), "ignore")
+	assert.Regexp(t, "FF22157", err)
+}
+
+func TestCheckKeccakMismatch(t *testing.T) {
+	keccakVectors["abc"] = "00"
+	defer func() {
+		keccakVectors["abc"] = "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"
+	}()
+	err := checkKeccak(context.Background(), nil)
+	assert.Regexp(t, `digest of "abc"`, err)
+}
@@ -0,0 +1,131 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signedconfig verifies a configuration file against a detached signature, so that
+// configuration pushed to a signer host (for example by a GitOps pipeline) is only used if it
+// was signed by one of a set of trusted keys.
+//
+// The signature is an Ethereum personal message (EIP-191) signature over the exact bytes of the
+// file (the format of personal_sign), stored hex encoded (65 bytes in R,S,V order) in the
+// signature file. Trusted keys are identified by their address.
+package signedconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+// DefaultSignatureExt is appended to the configuration filename to find the signature, if a signature file is not specified
+const DefaultSignatureExt = ".sig"
+
+// ParseSigners parses the list of trusted signer addresses
+func ParseSigners(ctx context.Context, signers []string) ([]*ethtypes.Address0xHex, error) {
+	addrs := make([]*ethtypes.Address0xHex, len(signers))
+	for i, s := range signers {
+		addr, err := ethtypes.NewAddress(strings.TrimSpace(s))
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgInvalidConfigSigner, s, err)
+		}
+		addrs[i] = addr
+	}
+	return addrs, nil
+}
+
+// MessageHash returns the EIP-191 personal message hash of the content, which is what is signed
+func MessageHash(content []byte) []byte {
+	return ethsigner.PersonalMessageHash(content)
+}
+
+// Sign returns the hex encoded detached signature for the content, in the format read by Verify
+func Sign(keypair *secp256k1.KeyPair, content []byte) (string, error) {
+	sig, err := keypair.SignDirect(MessageHash(content))
+	if err != nil {
+		return "", err
+	}
+	return ethtypes.HexBytes0xPrefix(sig.CompactRSV()).String(), nil
+}
+
+// Verify checks the hex encoded detached signature over the content was made by one of the
+// trusted signers, returning the address of the signer
+func Verify(ctx context.Context, content []byte, signature string, trusted []*ethtypes.Address0xHex) (*ethtypes.Address0xHex, error) {
+	signature = strings.TrimSpace(signature)
+	sigBytes, err := ethtypes.NewHexBytes0xPrefix(signature)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgConfigSignatureInvalid, signature, err)
+	}
+	sig, err := secp256k1.DecodeCompactRSV(ctx, sigBytes)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgConfigSignatureInvalid, signature, err)
+	}
+	signer, err := sig.RecoverDirect(MessageHash(content), 0)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgConfigSignatureInvalid, signature, err)
+	}
+	for _, t := range trusted {
+		if *t == *signer {
+			return signer, nil
+		}
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgConfigSignerNotTrusted, signer)
+}
+
+// VerifyFile verifies the configuration file against its detached signature file (the configuration
+// filename with DefaultSignatureExt appended, if sigFile is empty). The verified content is written
+// to a new file in a private temporary directory, so that it cannot be changed between verification
+// and use. The returned function removes the copy once it has been read.
+func VerifyFile(ctx context.Context, cfgFile, sigFile string, trusted []*ethtypes.Address0xHex) (verifiedFile string, cleanup func(), err error) {
+	if cfgFile == "" {
+		return "", nil, i18n.NewError(ctx, signermsgs.MsgConfigFileRequired)
+	}
+	if sigFile == "" {
+		sigFile = cfgFile + DefaultSignatureExt
+	}
+	content, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return "", nil, err
+	}
+	signature, err := os.ReadFile(sigFile)
+	if err != nil {
+		return "", nil, err
+	}
+	signer, err := Verify(ctx, content, string(signature), trusted)
+	if err != nil {
+		return "", nil, err
+	}
+	log.L(ctx).Infof("Configuration file %s verified, signed by %s", cfgFile, signer)
+
+	dir, err := os.MkdirTemp("", "ffsigner-config")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { _ = os.RemoveAll(dir) }
+	// The extension is retained, as it determines how the configuration is parsed
+	verifiedFile = filepath.Join(dir, "ffsigner"+filepath.Ext(cfgFile))
+	if err := os.WriteFile(verifiedFile, content, 0600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return verifiedFile, cleanup, nil
+}
@@ -0,0 +1,139 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signedconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerifyOK(t *testing.T) {
+	ctx := context.Background()
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	other, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	sig, err := Sign(kp, []byte("fileWallet: {}"))
+	assert.NoError(t, err)
+
+	signer, err := Verify(ctx, []byte("fileWallet: {}"), sig+"\n", []*ethtypes.Address0xHex{&other.Address, &kp.Address})
+	assert.NoError(t, err)
+	assert.Equal(t, kp.Address, *signer)
+
+	_, err = Verify(ctx, []byte("fileWallet: {}"), sig, []*ethtypes.Address0xHex{&other.Address})
+	assert.Regexp(t, "FF22105", err)
+
+	// A modified file recovers a different signer
+	_, err = Verify(ctx, []byte("fileWallet: {} "), sig, []*ethtypes.Address0xHex{&kp.Address})
+	assert.Regexp(t, "FF22105", err)
+}
+
+func TestSignNilKey(t *testing.T) {
+	_, err := Sign(nil, []byte{})
+	assert.Regexp(t, "nil signer", err)
+}
+
+func TestVerifyBadSignature(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := Verify(ctx, []byte{}, "not hex", nil)
+	assert.Regexp(t, "FF22104", err)
+
+	_, err = Verify(ctx, []byte{}, "0x1234", nil)
+	assert.Regexp(t, "FF22104.*FF22087", err)
+
+	// V value out of range
+	_, err = Verify(ctx, []byte{}, ethtypes.HexBytes0xPrefix(make([]byte, 65)).String()[0:130]+"05", nil)
+	assert.Regexp(t, "FF22104", err)
+}
+
+func TestParseSigners(t *testing.T) {
+	ctx := context.Background()
+
+	addrs, err := ParseSigners(ctx, []string{" 0x1f185718734552d08278aa70f804580bab5fd2b4", "497eedc4299dea2f2a364be10025d0ad0f702de3"})
+	assert.NoError(t, err)
+	assert.Len(t, addrs, 2)
+	assert.Equal(t, "0x497eedc4299dea2f2a364be10025d0ad0f702de3", addrs[1].String())
+
+	_, err = ParseSigners(ctx, []string{"wrong"})
+	assert.Regexp(t, "FF22107", err)
+}
+
+func TestVerifyFile(t *testing.T) {
+	ctx := context.Background()
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	trusted := []*ethtypes.Address0xHex{&kp.Address}
+
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "signer.yaml")
+	content := []byte("fileWallet:\n  enabled: true\n")
+	err = os.WriteFile(cfgFile, content, 0644)
+	assert.NoError(t, err)
+	sig, err := Sign(kp, content)
+	assert.NoError(t, err)
+	err = os.WriteFile(cfgFile+DefaultSignatureExt, []byte(sig), 0644)
+	assert.NoError(t, err)
+
+	verifiedFile, cleanup, err := VerifyFile(ctx, cfgFile, "", trusted)
+	assert.NoError(t, err)
+	assert.Equal(t, ".yaml", filepath.Ext(verifiedFile))
+	b, err := os.ReadFile(verifiedFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, b)
+	cleanup()
+	_, err = os.Stat(verifiedFile)
+	assert.True(t, os.IsNotExist(err))
+
+	_, _, err = VerifyFile(ctx, cfgFile, filepath.Join(dir, "missing.sig"), trusted)
+	assert.Error(t, err)
+
+	_, _, err = VerifyFile(ctx, filepath.Join(dir, "missing.yaml"), "", trusted)
+	assert.Error(t, err)
+
+	_, _, err = VerifyFile(ctx, cfgFile, "", nil)
+	assert.Regexp(t, "FF22105", err)
+
+	_, _, err = VerifyFile(ctx, "", "", trusted)
+	assert.Regexp(t, "FF22106", err)
+}
+
+func TestVerifyFileTempDirFail(t *testing.T) {
+	ctx := context.Background()
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "signer.yaml")
+	err = os.WriteFile(cfgFile, []byte{}, 0644)
+	assert.NoError(t, err)
+	sig, err := Sign(kp, []byte{})
+	assert.NoError(t, err)
+	err = os.WriteFile(cfgFile+DefaultSignatureExt, []byte(sig), 0644)
+	assert.NoError(t, err)
+
+	t.Setenv("TMPDIR", filepath.Join(dir, "missing"))
+	_, _, err = VerifyFile(ctx, cfgFile, "", []*ethtypes.Address0xHex{&kp.Address})
+	assert.Error(t, err)
+}
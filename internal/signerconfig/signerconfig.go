@@ -18,9 +18,20 @@ package signerconfig
 
 import (
 	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
 	"github.com/hyperledger/firefly-common/pkg/httpserver"
 	"github.com/hyperledger/firefly-common/pkg/wsclient"
+	"github.com/hyperledger/firefly-signer/internal/provisioning"
+	"github.com/hyperledger/firefly-signer/pkg/azurewallet"
+	"github.com/hyperledger/firefly-signer/pkg/clefwallet"
+	"github.com/hyperledger/firefly-signer/pkg/compositewallet"
+	"github.com/hyperledger/firefly-signer/pkg/dbwallet"
 	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/hyperledger/firefly-signer/pkg/k8swallet"
+	"github.com/hyperledger/firefly-signer/pkg/pkcs11wallet"
+	"github.com/hyperledger/firefly-signer/pkg/usbwallet"
+	"github.com/hyperledger/firefly-signer/pkg/vaultwallet"
+	"github.com/hyperledger/firefly-signer/pkg/web3signerwallet"
 	"github.com/spf13/viper"
 )
 
@@ -29,8 +40,104 @@ var ffc = config.AddRootKey
 var (
 	// BackendChainID optionally set the Chain ID manually (usually queries network ID)
 	BackendChainID = ffc("backend.chainId")
+	// BackendStreamPassthrough stream requests that are not intercepted by the signer directly to/from the backend
+	BackendStreamPassthrough = ffc("backend.streamPassthrough")
+	// BackendUpstreams additional URLs of JSON/RPC nodes, to route transactions across consistently by from address
+	BackendUpstreams = ffc("backend.upstreams")
+	// BackendUpstreamRetryDelay how long transactions are routed away from an upstream that failed
+	BackendUpstreamRetryDelay = ffc("backend.upstreamRetryDelay")
+	// ServerJSONCodec the JSON codec used to process JSON/RPC payloads on the server, and to the backend
+	ServerJSONCodec = ffc("server.jsonCodec")
+	// ServerH2C whether to accept HTTP/2 without TLS (h2c) on the JSON/RPC server
+	ServerH2C = ffc("server.h2c")
+	// ServerCompressionEnabled whether to compress JSON/RPC responses, when the client accepts gzip or deflate
+	ServerCompressionEnabled = ffc("server.compression.enabled")
+	// ServerAccountQueueEnabled whether to process the transactions from each address one at a time, in the order they arrive
+	ServerAccountQueueEnabled = ffc("server.accountQueue.enabled")
+	// ServerCoalesceEnabled whether identical concurrent read requests share one call to the backend
+	ServerCoalesceEnabled = ffc("server.coalesce.enabled")
+	// ServerCoalesceMethods the JSON/RPC methods for which identical concurrent requests are shared
+	ServerCoalesceMethods = ffc("server.coalesce.methods")
+	// PrivateRelayEnabled whether signed transactions selected by the policy (or the request) are sent to a private relay, instead of the backend
+	PrivateRelayEnabled = ffc("privateRelay.enabled")
+	// PrivateRelayMethod the JSON/RPC method of the private relay that submits a signed transaction
+	PrivateRelayMethod = ffc("privateRelay.method")
+	// PrivateRelayAuthKeyFile file containing the hex private key that signs each request to the relay, in the X-Flashbots-Signature header
+	PrivateRelayAuthKeyFile = ffc("privateRelay.authKeyFile")
+	// PrivateRelayRequestOnly only send the transactions that request private submission to the relay
+	PrivateRelayRequestOnly = ffc("privateRelay.requestOnly")
+	// PrivateRelayPolicyFrom the from addresses of the transactions sent to the relay
+	PrivateRelayPolicyFrom = ffc("privateRelay.policy.from")
+	// PrivateRelayPolicyTo the to addresses of the transactions sent to the relay
+	PrivateRelayPolicyTo = ffc("privateRelay.policy.to")
+	// PrivateRelayPolicyChainIDs the chain IDs of the transactions sent to the relay
+	PrivateRelayPolicyChainIDs = ffc("privateRelay.policy.chainIds")
+	// GasCeilingEnabled whether transactions with fees above a multiple of the gas price from an oracle are rejected (or clamped)
+	GasCeilingEnabled = ffc("gasCeiling.enabled")
+	// GasCeilingOracle the source of the gas price - gasPrice (eth_gasPrice on the backend) / feeHistory (eth_feeHistory on the backend) / http (an external feed)
+	GasCeilingOracle = ffc("gasCeiling.oracle")
+	// GasCeilingMultiplier the multiple of the oracle gas price that is the ceiling for the fees of a transaction
+	GasCeilingMultiplier = ffc("gasCeiling.multiplier")
+	// GasCeilingAction what happens to a transaction with fees above the ceiling - reject / clamp
+	GasCeilingAction = ffc("gasCeiling.action")
+	// GasCeilingRefreshInterval how long the gas price from the oracle is used for, before it is fetched again
+	GasCeilingRefreshInterval = ffc("gasCeiling.refreshInterval")
+	// GasCeilingFeeHistoryPercentile the percentile of the priority fees of the latest block added to the next base fee, with the feeHistory oracle
+	GasCeilingFeeHistoryPercentile = ffc("gasCeiling.feeHistoryPercentile")
+	// GasCeilingHTTPField the dot separated path of the gas price field in the JSON returned by the http oracle
+	GasCeilingHTTPField = ffc("gasCeiling.httpField")
+	// GasCeilingHTTPUnit the unit of the gas price returned by the http oracle - wei / gwei
+	GasCeilingHTTPUnit = ffc("gasCeiling.httpUnit")
 	// FileWalletEnabled if the Keystore V3 wallet is enabled
 	FileWalletEnabled = ffc("fileWallet.enabled")
+	// VaultWalletEnabled if the HashiCorp Vault wallet is enabled
+	VaultWalletEnabled = ffc("vaultWallet.enabled")
+	// AzureWalletEnabled if the Azure Key Vault wallet is enabled
+	AzureWalletEnabled = ffc("azureWallet.enabled")
+	// PKCS11WalletEnabled if the PKCS#11 (HSM) wallet is enabled
+	PKCS11WalletEnabled = ffc("pkcs11Wallet.enabled")
+	// Web3SignerWalletEnabled if the remote Web3Signer wallet is enabled
+	Web3SignerWalletEnabled = ffc("web3SignerWallet.enabled")
+	// ClefWalletEnabled if the go-ethereum Clef external signer wallet is enabled
+	ClefWalletEnabled = ffc("clefWallet.enabled")
+	// DBWalletEnabled if the SQL database wallet is enabled
+	DBWalletEnabled = ffc("dbWallet.enabled")
+	// USBWalletEnabled if the Ledger / Trezor hardware wallet is enabled
+	USBWalletEnabled = ffc("usbWallet.enabled")
+	// K8sWalletEnabled if the wallet of keystores held in Kubernetes Secrets is enabled
+	K8sWalletEnabled = ffc("k8sWallet.enabled")
+	// CompositeWalletEnabled if all the enabled wallets are combined, so the signer holds the accounts of all of them
+	CompositeWalletEnabled = ffc("compositeWallet.enabled")
+	// ProvisioningEnabled whether the accounts listed in the provisioning section are created or checked at startup
+	ProvisioningEnabled = ffc("provisioning.enabled")
+	// MetricsEnabled whether the Prometheus metrics server is enabled
+	MetricsEnabled = ffc("metrics.enabled")
+	// MetricsPath the path on which metrics are served
+	MetricsPath = ffc("metrics.path")
+	// AdminEnabled whether the admin API server is enabled
+	AdminEnabled = ffc("admin.enabled")
+	// AdminEscrowApprovers the addresses of the administrators that can approve key escrow exports
+	AdminEscrowApprovers = ffc("admin.escrow.approvers")
+	// AdminEscrowThreshold the number of approvals required for a key escrow export
+	AdminEscrowThreshold = ffc("admin.escrow.threshold")
+	// AdminEscrowRequestTimeout how long a key escrow export request remains valid
+	AdminEscrowRequestTimeout = ffc("admin.escrow.requestTimeout")
+	// RedisEnabled whether nonces are coordinated with other signer replicas through Redis
+	RedisEnabled = ffc("redis.enabled")
+	// RedisURL the URL of the Redis server
+	RedisURL = ffc("redis.url")
+	// RedisKeyPrefix the prefix of all Redis keys
+	RedisKeyPrefix = ffc("redis.keyPrefix")
+	// RedisNonceTTL how long the last nonce assigned to an address is retained in Redis
+	RedisNonceTTL = ffc("redis.nonceTTL")
+	// CryptoSecp256k1Backend the implementation to use for secp256k1 signing and recovery
+	CryptoSecp256k1Backend = ffc("crypto.secp256k1Backend")
+	// CryptoLowS whether signatures from external signers (such as HSMs and cloud KMS) are normalized to low-S
+	CryptoLowS = ffc("crypto.lowS")
+	// SelfTestEnabled whether to check signing and recovery work with the secp256k1 backend at startup
+	SelfTestEnabled = ffc("selfTest.enabled")
+	// SelfTestOnFailure whether to refuse to start (fail), or log a warning (warn), if the self-test fails
+	SelfTestOnFailure = ffc("selfTest.onFailure")
 )
 
 var ServerConfig config.Section
@@ -39,11 +146,80 @@ var CorsConfig config.Section
 
 var BackendConfig config.Section
 
+var PrivateRelayConfig config.Section
+
+var GasCeilingHTTPConfig config.Section
+
 var FileWalletConfig config.Section
 
+var VaultWalletConfig config.Section
+
+var AzureWalletConfig config.Section
+
+var PKCS11WalletConfig config.Section
+
+var Web3SignerWalletConfig config.Section
+
+var ClefWalletConfig config.Section
+
+var DBWalletConfig config.Section
+
+var USBWalletConfig config.Section
+
+var K8sWalletConfig config.Section
+
+var CompositeWalletConfig config.Section
+
+var ProvisioningConfig config.Section
+
+var MetricsConfig config.Section
+
+var AdminConfig config.Section
+
 func setDefaults() {
 	viper.SetDefault(string(BackendChainID), -1)
+	viper.SetDefault(string(BackendStreamPassthrough), false)
+	viper.SetDefault(string(BackendUpstreamRetryDelay), "30s")
+	viper.SetDefault(string(ServerJSONCodec), "standard")
+	viper.SetDefault(string(ServerH2C), false)
+	viper.SetDefault(string(ServerCompressionEnabled), false)
+	viper.SetDefault(string(ServerAccountQueueEnabled), false)
+	viper.SetDefault(string(ServerCoalesceEnabled), false)
+	viper.SetDefault(string(ServerCoalesceMethods), []string{"eth_call", "eth_getBalance", "eth_getCode", "eth_getStorageAt", "eth_blockNumber", "eth_getBlockByNumber", "eth_getLogs"})
+	viper.SetDefault(string(PrivateRelayEnabled), false)
+	viper.SetDefault(string(PrivateRelayMethod), "eth_sendPrivateTransaction")
+	viper.SetDefault(string(PrivateRelayRequestOnly), false)
+	viper.SetDefault(string(GasCeilingEnabled), false)
+	viper.SetDefault(string(GasCeilingOracle), "gasPrice")
+	viper.SetDefault(string(GasCeilingMultiplier), 3)
+	viper.SetDefault(string(GasCeilingAction), "reject")
+	viper.SetDefault(string(GasCeilingRefreshInterval), "15s")
+	viper.SetDefault(string(GasCeilingFeeHistoryPercentile), 50)
+	viper.SetDefault(string(GasCeilingHTTPUnit), "wei")
 	viper.SetDefault(string(FileWalletEnabled), true)
+	viper.SetDefault(string(VaultWalletEnabled), false)
+	viper.SetDefault(string(AzureWalletEnabled), false)
+	viper.SetDefault(string(PKCS11WalletEnabled), false)
+	viper.SetDefault(string(Web3SignerWalletEnabled), false)
+	viper.SetDefault(string(ClefWalletEnabled), false)
+	viper.SetDefault(string(DBWalletEnabled), false)
+	viper.SetDefault(string(USBWalletEnabled), false)
+	viper.SetDefault(string(K8sWalletEnabled), false)
+	viper.SetDefault(string(CompositeWalletEnabled), false)
+	viper.SetDefault(string(CryptoSecp256k1Backend), "go")
+	viper.SetDefault(string(CryptoLowS), true)
+	viper.SetDefault(string(SelfTestEnabled), false)
+	viper.SetDefault(string(SelfTestOnFailure), "fail")
+	viper.SetDefault(string(ProvisioningEnabled), false)
+	viper.SetDefault(string(MetricsEnabled), false)
+	viper.SetDefault(string(MetricsPath), "/metrics")
+	viper.SetDefault(string(AdminEnabled), false)
+	viper.SetDefault(string(AdminEscrowThreshold), 2)
+	viper.SetDefault(string(AdminEscrowRequestTimeout), "1h")
+	viper.SetDefault(string(RedisEnabled), false)
+	viper.SetDefault(string(RedisURL), "redis://localhost:6379")
+	viper.SetDefault(string(RedisKeyPrefix), "ffsigner")
+	viper.SetDefault(string(RedisNonceTTL), "1m")
 }
 
 func Reset() {
@@ -58,7 +234,49 @@ func Reset() {
 	BackendConfig = config.RootSection("backend")
 	wsclient.InitConfig(BackendConfig)
 
+	PrivateRelayConfig = config.RootSection("privateRelay")
+	ffresty.InitConfig(PrivateRelayConfig)
+
+	GasCeilingHTTPConfig = config.RootSection("gasCeiling.http")
+	ffresty.InitConfig(GasCeilingHTTPConfig)
+
 	FileWalletConfig = config.RootSection("fileWallet")
 	fswallet.InitConfig(FileWalletConfig)
 
+	VaultWalletConfig = config.RootSection("vaultWallet")
+	vaultwallet.InitConfig(VaultWalletConfig)
+
+	AzureWalletConfig = config.RootSection("azureWallet")
+	azurewallet.InitConfig(AzureWalletConfig)
+
+	PKCS11WalletConfig = config.RootSection("pkcs11Wallet")
+	pkcs11wallet.InitConfig(PKCS11WalletConfig)
+
+	Web3SignerWalletConfig = config.RootSection("web3SignerWallet")
+	web3signerwallet.InitConfig(Web3SignerWalletConfig)
+
+	ClefWalletConfig = config.RootSection("clefWallet")
+	clefwallet.InitConfig(ClefWalletConfig)
+
+	DBWalletConfig = config.RootSection("dbWallet")
+	dbwallet.InitConfig(DBWalletConfig)
+
+	USBWalletConfig = config.RootSection("usbWallet")
+	usbwallet.InitConfig(USBWalletConfig)
+
+	K8sWalletConfig = config.RootSection("k8sWallet")
+	k8swallet.InitConfig(K8sWalletConfig)
+
+	CompositeWalletConfig = config.RootSection("compositeWallet")
+	compositewallet.InitConfig(CompositeWalletConfig)
+
+	ProvisioningConfig = config.RootSection("provisioning")
+	provisioning.InitConfig(ProvisioningConfig)
+
+	MetricsConfig = config.RootSection("metrics")
+	httpserver.InitHTTPConfig(MetricsConfig, 6000)
+
+	AdminConfig = config.RootSection("admin")
+	httpserver.InitHTTPConfig(AdminConfig, 6001)
+
 }
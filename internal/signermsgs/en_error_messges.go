@@ -107,4 +107,161 @@ var (
 	MsgInvalidIntPrecisionLoss     = ffe("FF22089", "String %s cannot be converted to integer without losing precision")
 	MsgInvalidUint64PrecisionLoss  = ffe("FF22090", "String %s cannot be converted to a uint64 without losing precision")
 	MsgInvalidJSONTypeForBigInt    = ffe("FF22091", "JSON parsed '%T' cannot be converted to an integer")
+	MsgWalletDecryptInterrupted    = ffe("FF22092", "Decryption of wallet for address '%s' did not complete: %s", 408)
+	MsgUnsupportedSecp256k1Backend = ffe("FF22093", "Unsupported secp256k1 backend '%s' (not compiled into this binary)")
+	MsgUnknownPasswordProvider     = ffe("FF22094", "Unknown password provider type '%s'")
+	MsgPasswordProviderNoConfig    = ffe("FF22095", "Password provider '%s' requires '%s' to be configured")
+	MsgPasswordNotAvailable        = ffe("FF22096", "Password for address '%s' not available from %s password provider")
+	MsgUnknownJSONCodec            = ffe("FF22097", "Unknown JSON codec '%s' (valid options: %v)")
+	MsgUnknownKeyFormat            = ffe("FF22098", "Unknown key format '%s'")
+	MsgFSListenerStopped           = ffe("FF22099", "Filesystem listener for '%s' stopped unexpectedly")
+	MsgFSListenerDirRemoved        = ffe("FF22100", "Directory '%s' watched by the filesystem listener was removed or renamed")
+	MsgBadDerivationPath           = ffe("FF22101", "Invalid mnemonic derivation path '%s': %s")
+	MsgReloadRequiresRestart       = ffe("FF22102", "Configuration changes other than to %s require a restart")
+	MsgWalletClosed                = ffe("FF22103", "Wallet is closed")
+	MsgConfigSignatureInvalid      = ffe("FF22104", "Signature '%s' for the configuration file could not be verified: %s")
+	MsgConfigSignerNotTrusted      = ffe("FF22105", "Configuration file was signed by '%s', which is not a trusted signer")
+	MsgConfigFileRequired          = ffe("FF22106", "A configuration file must be specified when trusted configuration signers are set")
+	MsgInvalidConfigSigner         = ffe("FF22107", "Invalid trusted configuration signer address '%s': %s")
+	MsgEscrowRequestNotFound       = ffe("FF22108", "Escrow export request '%s' not found", 404)
+	MsgEscrowBadRecipient          = ffe("FF22109", "Invalid escrow recipient public key: %s", 400)
+	MsgEscrowBadApproval           = ffe("FF22110", "Invalid approval signature for escrow export request '%s': %s", 400)
+	MsgEscrowNotApprover           = ffe("FF22111", "Address '%s' is not an escrow approver", 403)
+	MsgEscrowNotApproved           = ffe("FF22112", "Escrow export request '%s' has %d of the %d approvals required", 409)
+	MsgEscrowRequestExpired        = ffe("FF22113", "Escrow export request '%s' has expired", 410)
+	MsgEscrowAlreadyExported       = ffe("FF22114", "Escrow export request '%s' has already been exported", 409)
+	MsgEscrowBadThreshold          = ffe("FF22115", "Escrow approval threshold %d is invalid for %d configured approvers")
+	MsgEscrowUnsupportedWallet     = ffe("FF22116", "The wallet does not support key export")
+	MsgEscrowExportFailed          = ffe("FF22117", "Export of key for address '%s' failed: %s")
+	MsgEscrowBadApprover           = ffe("FF22118", "Invalid escrow approver address '%s': %s")
+	MsgSigningDisabled             = ffe("FF22119", "Signing is disabled for address '%s', as the wallet is read-only", 403)
+	MsgUnsupportedContentEncoding  = ffe("FF22120", "Unsupported request Content-Encoding '%s' - supported: gzip, deflate", 415)
+	MsgUnknownAuditSink            = ffe("FF22121", "Unknown audit sink '%s'")
+	MsgAuditSinkNoConfig           = ffe("FF22122", "Audit sink '%s' requires '%s' to be configured")
+	MsgAuditFileOpen               = ffe("FF22123", "Failed to open audit file '%s': %s")
+	MsgDirectoryNoPath             = ffe("FF22124", "No path configured for wallet directory %d")
+	MsgInvalidFromAddress          = ffe("FF22125", "Invalid 'from' address '%s': %s")
+	MsgReceiptWaitTimeout          = ffe("FF22126", "Timed out after %s waiting for receipt for transaction %s")
+	MsgMasterKeyConfigConflict     = ffe("FF22127", "Only one of '%s' or '%s' can be configured")
+	MsgMasterKeyNotAvailable       = ffe("FF22128", "Master key not available from '%s': %s")
+	MsgMasterKeyInvalid            = ffe("FF22129", "Master key from '%s' is invalid - must be %d bytes, hex encoded")
+	MsgPasswordDecryptFailed       = ffe("FF22130", "Failed to decrypt password file '%s' with the master key")
+	MsgPasswordEncryptionProvider  = ffe("FF22131", "Password encryption is only supported with the '%s' password provider")
+	MsgMasterKeyNotConfigured      = ffe("FF22132", "A master key file or environment variable must be specified")
+	MsgInvalidHexInput             = ffe("FF22133", "Invalid hex input: %s")
+	MsgABIFileRequired             = ffe("FF22134", "An ABI file must be specified with --abi")
+	MsgReadABIFailed               = ffe("FF22135", "Failed to read ABI from '%s': %s")
+	MsgABIFunctionNotFound         = ffe("FF22136", "Function '%s' not found in the ABI")
+	MsgABIFunctionAmbiguous        = ffe("FF22137", "Function '%s' is overloaded in the ABI - specify the signature, such as 'name(uint256)'")
+	MsgABISelectorNotFound         = ffe("FF22138", "No function in the ABI has the selector '%s'")
+	MsgABIFunctionRequired         = ffe("FF22139", "The function must be specified to decode parameters without a selector")
+	MsgInvalidRLPJSON              = ffe("FF22140", "Invalid RLP JSON at %s - must be a hex string or an array: %s")
+	MsgRLPTrailingData             = ffe("FF22141", "RLP input has %d bytes of trailing data")
+	MsgInvalidTypedData            = ffe("FF22142", "Invalid EIP-712 typed data JSON: %s")
+	MsgTypedDataNotSupported       = ffe("FF22143", "The wallet does not support signing typed data")
+	MsgInvalidTypedDataFormat      = ffe("FF22144", "Invalid typed data signature format '%s' - supported: compact, split")
+	MsgRedisBadURL                 = ffe("FF22145", "Invalid Redis URL: %s")
+	MsgRedisConnectFailed          = ffe("FF22146", "Failed to connect to Redis at %s: %s")
+	MsgRedisNonceFailed            = ffe("FF22147", "Failed to assign nonce for address %s with Redis: %s")
+	MsgMulticallResultCount        = ffe("FF22148", "Multicall returned %d results, but %d calls were supplied")
+	MsgMulticallDecodeFailed       = ffe("FF22149", "Failed to decode the return data of call %d (%s) in the multicall: %s")
+	MsgUnknownNotifyOverflow       = ffe("FF22150", "Unknown notifyOverflow policy '%s' - supported: dropOldest, disconnect")
+	MsgInvalidAccountPrefix        = ffe("FF22151", "Invalid address prefix '%s' - must be hex, optionally 0x prefixed", 400)
+	MsgUnknownAccountSort          = ffe("FF22152", "Unknown account sort '%s' - supported: indexed, address", 400)
+	MsgVaultRequestFailed          = ffe("FF22153", "Vault request failed: %s")
+	MsgVaultSecretInvalid          = ffe("FF22154", "Vault secret '%s' does not contain a valid key: %s")
+	MsgMultipleWalletsEnabled      = ffe("FF22155", "Only one wallet can be enabled, unless compositeWallet.enabled is set - set fileWallet.enabled to false to use vaultWallet, azureWallet, pkcs11Wallet, web3SignerWallet, clefWallet, dbWallet, usbWallet or k8sWallet on its own")
+	MsgSelfTestFailed              = ffe("FF22156", "Startup self-test failed (secp256k1 backend %s) - %s: %s")
+	MsgUnknownSelfTestOnFailure    = ffe("FF22157", "Unknown selfTest.onFailure '%s' - supported: fail, warn")
+	MsgAzureRequestFailed          = ffe("FF22158", "Azure Key Vault request failed: %s")
+	MsgAzureManagedIdentityFailed  = ffe("FF22159", "Failed to obtain a Managed Identity access token for Azure Key Vault: %s")
+	MsgAzureSignatureInvalid       = ffe("FF22160", "Azure Key Vault returned an invalid signature for key '%s'")
+	MsgAzureKeyNotSecp256k1        = ffe("FF22161", "Azure Key Vault key type '%s' curve '%s' is not a secp256k1 (EC P-256K) key")
+	MsgInlinePasswordNoMasterKey   = ffe("FF22162", "A passwordEncryption master key must be configured to use '%s'")
+	MsgInlinePasswordDecryptFailed = ffe("FF22163", "Failed to decrypt the inline password in the metadata for %s with the master key")
+	MsgPKCS11NotSupported          = ffe("FF22164", "PKCS#11 is not supported by this build of the signer - build with CGO_ENABLED=1 and -tags pkcs11")
+	MsgPKCS11Failed                = ffe("FF22165", "PKCS#11 %s failed: %s")
+	MsgPKCS11TokenNotFound         = ffe("FF22166", "No PKCS#11 token found for slot=%d tokenLabel='%s'")
+	MsgPKCS11SignatureInvalid      = ffe("FF22167", "The PKCS#11 token returned an invalid signature for key '%s'")
+	MsgPKCS11PINNotAvailable       = ffe("FF22168", "Failed to read the PKCS#11 PIN file '%s': %s")
+	MsgPKCS11PINConflict           = ffe("FF22169", "Only one of %s and %s can be set")
+	MsgPKCS11KeyNotSecp256k1       = ffe("FF22170", "The PKCS#11 key is not a secp256k1 key")
+	MsgAccountQueueWaitCanceled    = ffe("FF22171", "Request canceled while waiting for earlier transactions from %s to be sent")
+	MsgInvalidPrivateKey           = ffe("FF22172", "Invalid private key: %s")
+	MsgDeriveKeysFailed            = ffe("FF22173", "Failed to derive keys: %s")
+	MsgChainIDTooLarge             = ffe("FF22174", "Chain ID %s is too large for the wallet, which only supports chain IDs up to 2^63-1")
+	MsgCompositeWalletDuplicate    = ffe("FF22175", "Wallet '%s' is included more than once in the composite wallet")
+	MsgCompositeWalletUnknown      = ffe("FF22176", "Wallet '%s' in the composite wallet precedence is not enabled")
+	MsgEIP712InvalidChainID        = ffe("FF22177", "Invalid chainId '%v' in the EIP-712 domain - must be a number, a decimal string or a 0x prefixed hex string", 400)
+	MsgCoalescedRequestCanceled    = ffe("FF22178", "Request canceled while waiting for the response to an identical %s request")
+	MsgWeb3SignerRequestFailed     = ffe("FF22179", "Web3Signer request failed: %s")
+	MsgWeb3SignerBadPublicKey      = ffe("FF22180", "Web3Signer returned an invalid secp256k1 public key '%s': %s")
+	MsgWeb3SignerSignatureInvalid  = ffe("FF22181", "Web3Signer returned an invalid signature for %s")
+	MsgClefRequestFailed           = ffe("FF22182", "Clef %s request failed: %s")
+	MsgClefSignatureInvalid        = ffe("FF22183", "Clef returned a signature that is not by %s for the requested payload")
+	MsgRedisStateFailed            = ffe("FF22184", "Failed to %s nonce state with Redis: %s")
+	MsgStateArchiveNoState         = ffe("FF22185", "No operational state to transfer - Redis nonce coordination is not enabled")
+	MsgStateArchiveBadVersion      = ffe("FF22186", "Unsupported state archive version %d")
+	MsgDBWalletBadTable            = ffe("FF22187", "Invalid table name '%s' for the database wallet")
+	MsgDBWalletOpenFailed          = ffe("FF22188", "Failed to open the database with driver '%s': %s")
+	MsgDBWalletQueryFailed         = ffe("FF22189", "Database wallet query failed: %s")
+	MsgDBWalletKeyInvalid          = ffe("FF22190", "Invalid key for address %s in the database wallet: %s")
+	MsgDBWalletUnknownListener     = ffe("FF22191", "Unknown listener type '%s' for the database wallet")
+	MsgDBWalletNotifyNotSupported  = ffe("FF22192", "The notify listener of the database wallet requires the postgres driver, not '%s'")
+	MsgPostSignHookFailed          = ffe("FF22193", "Post-sign hook '%s' failed: %s")
+	MsgInvalidSubmission           = ffe("FF22194", "Invalid submission '%s' - must be private or public", 400)
+	MsgPrivateRelayFailed          = ffe("FF22195", "Private relay submission failed: %s")
+	MsgPrivateRelayBadMethod       = ffe("FF22196", "Unsupported private relay method '%s'")
+	MsgPrivateRelayBadPolicy       = ffe("FF22197", "Invalid private relay policy %s '%s': %s")
+	MsgPrivateRelayBadAuthKey      = ffe("FF22198", "Invalid private relay auth key file '%s': %s")
+	MsgNotPrivatelySubmitted       = ffe("FF22199", "The transaction requested private submission, but was not submitted by a private relay", 400)
+	MsgUSBWalletNotSupported       = ffe("FF22200", "USB hardware wallets are not supported by this build of the signer - build with CGO_ENABLED=1 and -tags usb")
+	MsgUSBWalletBadDriver          = ffe("FF22201", "Unsupported hardware wallet driver '%s' - supported: ledger / trezor")
+	MsgUSBWalletNoDevice           = ffe("FF22202", "No %s device found (devicePath='%s')")
+	MsgUSBWalletRequestFailed      = ffe("FF22203", "%s %s request failed: %s")
+	MsgUSBWalletBadPath            = ffe("FF22204", "Invalid derivation path '%s' for the hardware wallet: %s")
+	MsgUSBWalletUnsupported        = ffe("FF22205", "The %s firmware version %s does not support %s")
+	MsgUSBWalletLocked             = ffe("FF22206", "The %s is locked, or the Ethereum app is not open on it")
+	MsgUSBWalletSignatureInvalid   = ffe("FF22207", "The %s returned a signature that is not by %s for the requested payload")
+	MsgGasPriceAboveCeiling        = ffe("FF22208", "Transaction %s of %s exceeds the ceiling of %s (%s x the oracle gas price of %s)", 400)
+	MsgGasOracleFailed             = ffe("FF22209", "Failed to get the gas price from the %s oracle: %s")
+	MsgGasCeilingBadConfig         = ffe("FF22210", "Invalid gas price ceiling %s '%s'")
+	MsgMPCBadThreshold             = ffe("FF22211", "Invalid threshold of %d of %d parties for %s")
+	MsgMPCNotEnoughPartials        = ffe("FF22212", "Only %d of the %d partial signatures required for %s were returned: %s")
+	MsgMPCSignatureInvalid         = ffe("FF22213", "The aggregated signature is not by %s for the requested payload")
+	MsgK8sWalletUnknownSource      = ffe("FF22214", "Unknown source '%s' for the Kubernetes wallet")
+	MsgK8sWalletNoPath             = ffe("FF22215", "The volume source of the Kubernetes wallet requires a path")
+	MsgK8sWalletNoNamespace        = ffe("FF22216", "No namespace configured for the Kubernetes wallet, and not running in a pod")
+	MsgK8sRequestFailed            = ffe("FF22217", "Kubernetes API request failed: %s")
+	MsgK8sSecretInvalid            = ffe("FF22218", "Kubernetes secret '%s' does not contain a valid key: %s")
+	MsgK8sWatchFailed              = ffe("FF22219", "Kubernetes watch of the secrets failed: %s")
+	MsgWalletDirUnreadable         = ffe("FF22220", "Wallet directory '%s' cannot be read: %s")
+	MsgWalletsUnhealthy            = ffe("FF22221", "Wallets failed their health check: %s")
+	MsgArchiveReadFailed           = ffe("FF22222", "Failed to read the wallet archive '%s': %s")
+	MsgArchiveUnknownFormat        = ffe("FF22223", "Unknown format '%s' for the wallet archive '%s' - supported: zip / tar / tar.gz")
+	MsgArchiveUnknownEncryption    = ffe("FF22224", "Unknown encryption '%s' for the wallet archive '%s' - supported: none / age / gpg")
+	MsgArchiveDecryptFailed        = ffe("FF22225", "Failed to decrypt the wallet archive '%s': %s")
+	MsgArchiveTooLarge             = ffe("FF22226", "The wallet archive '%s' is larger than the maximum of %d bytes when unpacked")
+	MsgArchiveBadEntry             = ffe("FF22227", "Invalid entry '%s' in the wallet archive '%s'")
+	MsgTwosComplementOutOfRange    = ffe("FF22228", "Value %s is out of range for a %d bit two's complement integer")
+	MsgBenchBadMix                 = ffe("FF22229", "Invalid traffic mix '%s' - expected comma separated <type>=<weight> pairs, with types sign / send / read")
+	MsgBenchFromRequired           = ffe("FF22230", "An address to sign with (--from) is required for sign and send traffic")
+	MsgCreateAccountUnsupported    = ffe("FF22231", "Accounts can only be created in a filesystem wallet of keystorev3 files found by their filename (filenames.primaryExt) with password files (filenames.passwordExt): %s")
+	MsgCreateAccountFailed         = ffe("FF22232", "Failed to create account: %s")
+	MsgProvisioningBadAccount      = ffe("FF22233", "Invalid provisioning account %d - each account must have a unique name, or an address")
+	MsgProvisioningNoFileWallet    = ffe("FF22234", "Provisioning account '%s' has no address, and accounts can only be created in the filesystem wallet (fileWallet.enabled)")
+	MsgProvisioningStateFile       = ffe("FF22235", "Failed to access the provisioning state file '%s': %s")
+	MsgProvisioningReportFile      = ffe("FF22236", "Failed to write the provisioning report '%s': %s")
+	MsgProvisioningMissing         = ffe("FF22237", "Provisioned accounts are missing from the wallet: %s")
+	MsgRotatePasswordUnsupported   = ffe("FF22238", "Passwords can only be rotated for keystorev3 files read from the operating system filesystem by their filename, with password files if using the file password provider: %s")
+	MsgRotatePasswordFailed        = ffe("FF22239", "Failed to rotate the password for address %s: %s")
+	MsgSigningInvalidEIP2098       = ffe("FF22240", "Invalid signature data (EIP-2098 compact R,YParityAndS) length=%d (expected=64)")
+	MsgInvalidEIP2930Transaction   = ffe("FF22241", "Transaction payload invalid (EIP-2930): %v")
+	MsgInvalidAccessList           = ffe("FF22242", "Invalid access list: %s")
+	MsgInvalidEIP4844Transaction   = ffe("FF22243", "Transaction payload invalid (EIP-4844): %v")
+	MsgInvalidBlobTransaction      = ffe("FF22244", "Invalid blob transaction: %s")
+	MsgInvalidEIP7702Transaction   = ffe("FF22245", "Transaction payload invalid (EIP-7702): %v")
+	MsgInvalidAuthorization        = ffe("FF22246", "Invalid authorization list: %s")
+	MsgAuthorizationNotSupported   = ffe("FF22247", "The wallet does not support signing EIP-7702 authorizations")
+	MsgInvalidSignedTransaction    = ffe("FF22248", "Transaction payload invalid (type 0x%02x): %v")
 )
@@ -41,6 +41,23 @@ var (
 	EthTransactionTo                   = ffm("EthTransaction.to", "The target address of the transaction. Omitted for contract deployments")
 	EthTransactionValue                = ffm("EthTransaction.value", "An optional amount of native token to transfer along with the transaction (in wei)")
 	EthTransactionData                 = ffm("EthTransaction.data", "The encoded and signed transaction payload")
+	EthTransactionAccessList           = ffm("EthTransaction.accessList", "Part of the EIP-2930 extension (also used by EIP-1559). The addresses and storage keys the transaction plans to access, which are charged at a discount")
+	EthTransactionMaxFeePerBlobGas     = ffm("EthTransaction.maxFeePerBlobGas", "Part of the EIP-4844 extension for blob transactions. The maximum fee per unit of blob gas you are willing to pay for the blobs")
+	EthTransactionBlobVersionedHashes  = ffm("EthTransaction.blobVersionedHashes", "Part of the EIP-4844 extension for blob transactions. The versioned hashes of the KZG commitments of the blobs, which are signed into the transaction")
+	EthTransactionBlobs                = ffm("EthTransaction.blobs", "Part of the EIP-4844 extension for blob transactions. The 131072 byte blobs, which are included in the network encoding of the signed transaction but are not signed")
+	EthTransactionCommitments          = ffm("EthTransaction.commitments", "Part of the EIP-4844 extension for blob transactions. The 48 byte KZG commitment of each blob, in the same order as the blobs")
+	EthTransactionProofs               = ffm("EthTransaction.proofs", "Part of the EIP-4844 extension for blob transactions. The 48 byte KZG proof of each blob, in the same order as the blobs")
+	EthTransactionAuthorizationList    = ffm("EthTransaction.authorizationList", "Part of the EIP-7702 extension for set code transactions. The signed authorizations for accounts to delegate to the code of a contract")
+
+	EthAccessListEntryAddress     = ffm("EthAccessListEntry.address", "An address the transaction plans to access")
+	EthAccessListEntryStorageKeys = ffm("EthAccessListEntry.storageKeys", "The 32 byte storage keys within the contract at the address that the transaction plans to access")
+
+	EthAuthorizationChainID = ffm("EthAuthorization.chainId", "The chain ID the authorization is valid on, or zero for any chain")
+	EthAuthorizationAddress = ffm("EthAuthorization.address", "The address of the contract whose code the authorizing account delegates to")
+	EthAuthorizationNonce   = ffm("EthAuthorization.nonce", "The nonce of the authorizing account at the time the authorization is processed")
+	EthAuthorizationYParity = ffm("EthAuthorization.yParity", "The Y-parity (0 or 1) of the signature of the authorizing account")
+	EthAuthorizationR       = ffm("EthAuthorization.r", "The R value of the signature of the authorizing account")
+	EthAuthorizationS       = ffm("EthAuthorization.s", "The S value of the signature of the authorizing account")
 
 	EIP712ResultHash         = ffm("EIP712Result.hash", "The EIP-712 hash generated according to the Typed Data V4 algorithm")
 	EIP712ResultSignatureRSV = ffm("EIP712Result.signatureRSV", "Hex encoded array of 65 bytes containing the R, S & V of the ECDSA signature. This is the standard signature encoding used in Ethereum recover utilities (note that some other utilities might expect a different encoding/packing of the data)")
@@ -0,0 +1,62 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"golang.org/x/text/language"
+)
+
+// Language is the language of the messages in this package
+var Language = language.Spanish
+
+var ffe = func(key, translation string) i18n.ErrorMessageKey {
+	return i18n.FFE(Language, key, translation)
+}
+
+// Translations use the same variable names and codes as ../en_error_messges.go. Any message not
+// translated here is returned in English.
+//
+//revive:disable
+var (
+	MsgRPCRequestFailed         = ffe("FF22012", "La solicitud RPC al backend falló: %s")
+	MsgReadDirFile              = ffe("FF22013", "Falló el listado del directorio")
+	MsgWalletNotAvailable       = ffe("FF22014", "La billetera para la dirección '%s' no está disponible")
+	MsgWalletFailed             = ffe("FF22015", "No se pudo inicializar la billetera para la dirección '%s'")
+	MsgBadGoTemplate            = ffe("FF22016", "Plantilla go incorrecta para '%s' - pruebe una sintaxis como '{{ index .signing \"key-file\" }}'")
+	MsgNoWalletEnabled          = ffe("FF22017", "No hay billeteras habilitadas en la configuración")
+	MsgInvalidRequest           = ffe("FF22018", "Datos de solicitud no válidos")
+	MsgInvalidParamCount        = ffe("FF22019", "Número de parámetros no válido: esperado=%d recibido=%d")
+	MsgMissingFrom              = ffe("FF22020", "Falta la dirección 'from'")
+	MsgQueryChainID             = ffe("FF22021", "No se pudo consultar el Chain ID")
+	MsgSigningFailed            = ffe("FF22022", "La firma falló: %s")
+	MsgInvalidTransaction       = ffe("FF22023", "Entrada de eth_sendTransaction no válida")
+	MsgMissingRequestID         = ffe("FF22024", "Solicitud JSON/RPC no válida. Debe establecer el ID de la solicitud")
+	MsgBadRegularExpression     = ffe("FF22056", "Expresión regular incorrecta para /%s/: %s")
+	MsgAddressMismatch          = ffe("FF22059", "La dirección '%s' cargada del archivo de billetera no coincide con la dirección / nombre de archivo solicitado '%s'")
+	MsgFailedToStartListener    = ffe("FF22060", "No se pudo iniciar el observador del sistema de archivos: %s")
+	MsgRequestCanceledContext   = ffe("FF22063", "La solicitud con id %s falló porque el contexto fue cancelado")
+	MsgInvalidChainID           = ffe("FF22086", "chainId no válido esperado=%d real=%d")
+	MsgWalletDecryptInterrupted = ffe("FF22092", "El descifrado de la billetera para la dirección '%s' no se completó: %s")
+	MsgPasswordNotAvailable     = ffe("FF22096", "La contraseña para la dirección '%s' no está disponible en el proveedor de contraseñas %s")
+	MsgUnknownKeyFormat         = ffe("FF22098", "Formato de clave desconocido '%s'")
+	MsgFSListenerStopped        = ffe("FF22099", "El observador del sistema de archivos para '%s' se detuvo inesperadamente")
+	MsgReloadRequiresRestart    = ffe("FF22102", "Los cambios de configuración distintos de %s requieren un reinicio")
+	MsgWalletClosed             = ffe("FF22103", "La billetera está cerrada")
+	MsgTypedDataNotSupported    = ffe("FF22143", "La billetera no admite la firma de datos tipados")
+	MsgInvalidTypedDataFormat   = ffe("FF22144", "Formato de firma de datos tipados '%s' no válido - admitidos: compact, split")
+)
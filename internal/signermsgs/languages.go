@@ -0,0 +1,48 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signermsgs
+
+import (
+	"github.com/hyperledger/firefly-signer/internal/signermsgs/es"
+	"golang.org/x/text/language"
+)
+
+// To contribute a translation, add a sub-package named for the language (see es), registering
+// messages with the same codes as the English catalog, and add the language to this list.
+// Messages that are not translated fall back to English.
+var languages = []language.Tag{
+	language.AmericanEnglish, // default, and the fallback for untranslated messages
+	es.Language,
+}
+
+var languageMatcher = language.NewMatcher(languages)
+
+// Languages returns the languages messages are available in
+func Languages() []language.Tag {
+	return append([]language.Tag{}, languages...)
+}
+
+// MatchAcceptLanguage returns the best available language for an HTTP Accept-Language
+// header, and false if none of the requested languages are available
+func MatchAcceptLanguage(acceptLanguage string) (language.Tag, bool) {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return language.AmericanEnglish, false
+	}
+	_, i, confidence := languageMatcher.Match(tags...)
+	return languages[i], confidence != language.No
+}
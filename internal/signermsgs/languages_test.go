@@ -0,0 +1,54 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signermsgs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestMatchAcceptLanguage(t *testing.T) {
+
+	lang, ok := MatchAcceptLanguage("es-419, en;q=0.5")
+	assert.True(t, ok)
+	assert.Equal(t, language.Spanish, lang)
+
+	lang, ok = MatchAcceptLanguage("en-GB")
+	assert.True(t, ok)
+	assert.Equal(t, language.AmericanEnglish, lang)
+
+	_, ok = MatchAcceptLanguage("de")
+	assert.False(t, ok)
+
+	_, ok = MatchAcceptLanguage("!!!")
+	assert.False(t, ok)
+
+	assert.Contains(t, Languages(), language.Spanish)
+
+}
+
+func TestUntranslatedFallsBackToEnglish(t *testing.T) {
+
+	ctx := i18n.WithLang(context.Background(), language.Spanish)
+	assert.Regexp(t, "FF22103: La billetera está cerrada", i18n.NewError(ctx, MsgWalletClosed))
+	assert.Regexp(t, "FF22010: Invalid output type: bad", i18n.NewError(ctx, MsgInvalidOutputType, "bad"))
+
+}
@@ -0,0 +1,83 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// multicallResultsABI is the return type of the Multicall3 aggregate3, aggregate3Value and tryAggregate functions
+var multicallResultsABI = ParameterArray{
+	{
+		Name: "returnData",
+		Type: "tuple[]",
+		Components: ParameterArray{
+			{Name: "success", Type: "bool"},
+			{Name: "returnData", Type: "bytes"},
+		},
+	},
+}
+
+// MulticallResult is the result of one call in a multicall batch
+type MulticallResult struct {
+	Success    bool                      `json:"success"`
+	ReturnData ethtypes.HexBytes0xPrefix `json:"returnData"`
+	// Outputs are the return values decoded against the outputs of the function, when the call succeeded
+	Outputs *ComponentValue `json:"-"`
+	// Revert is the formatted revert reason, when the call failed with a standard Error(string)
+	Revert string `json:"revert,omitempty"`
+}
+
+// DecodeMulticallResults decodes the return data of a Multicall3 style aggregate call, which is an
+// array of (bool success, bytes returnData) tuples, against the functions that were called in order.
+// A nil function in the list skips decoding the outputs of that call, leaving only the raw return data.
+func DecodeMulticallResults(returnData []byte, functions []*Entry) ([]*MulticallResult, error) {
+	return DecodeMulticallResultsCtx(context.Background(), returnData, functions)
+}
+
+func DecodeMulticallResultsCtx(ctx context.Context, returnData []byte, functions []*Entry) ([]*MulticallResult, error) {
+	cv, err := multicallResultsABI.DecodeABIDataCtx(ctx, returnData, 0)
+	if err != nil {
+		return nil, err
+	}
+	calls := cv.Children[0].Children
+	if len(calls) != len(functions) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgMulticallResultCount, len(calls), len(functions))
+	}
+	results := make([]*MulticallResult, len(calls))
+	for i, call := range calls {
+		result := &MulticallResult{
+			Success:    call.Children[0].Value.(*big.Int).Sign() != 0,
+			ReturnData: call.Children[1].Value.([]byte),
+		}
+		switch {
+		case !result.Success:
+			result.Revert, _ = ABI{}.ErrorStringCtx(ctx, result.ReturnData)
+		case functions[i] != nil:
+			if result.Outputs, err = functions[i].Outputs.DecodeABIDataCtx(ctx, result.ReturnData, 0); err != nil {
+				return nil, i18n.NewError(ctx, signermsgs.MsgMulticallDecodeFailed, i, functions[i].String(), err)
+			}
+		}
+		results[i] = result
+	}
+	return results, nil
+}
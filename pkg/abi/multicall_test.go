@@ -0,0 +1,107 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+var testBalanceOf = &Entry{
+	Type:    Function,
+	Name:    "balanceOf",
+	Inputs:  ParameterArray{{Name: "owner", Type: "address"}},
+	Outputs: ParameterArray{{Name: "balance", Type: "uint256"}},
+}
+
+var testSymbol = &Entry{
+	Type:    Function,
+	Name:    "symbol",
+	Outputs: ParameterArray{{Type: "string"}},
+}
+
+func encodeTestMulticallResults(t *testing.T, results ...[]interface{}) []byte {
+	calls := make([]interface{}, len(results))
+	for i, r := range results {
+		calls[i] = r
+	}
+	b, err := multicallResultsABI.EncodeABIDataValues([]interface{}{calls})
+	assert.NoError(t, err)
+	return b
+}
+
+func TestDecodeMulticallResults(t *testing.T) {
+
+	balance, err := testBalanceOf.Outputs.EncodeABIDataValues([]interface{}{"12345"})
+	assert.NoError(t, err)
+	symbol, err := testSymbol.Outputs.EncodeABIDataValues([]interface{}{"TKN"})
+	assert.NoError(t, err)
+	revert, err := (&Entry{Type: Error, Name: "Error", Inputs: ParameterArray{{Type: "string"}}}).EncodeCallDataValues([]interface{}{"not allowed"})
+	assert.NoError(t, err)
+
+	returnData := encodeTestMulticallResults(t,
+		[]interface{}{true, ethtypes.HexBytes0xPrefix(balance).String()},
+		[]interface{}{true, ethtypes.HexBytes0xPrefix(symbol).String()},
+		[]interface{}{false, ethtypes.HexBytes0xPrefix(revert).String()},
+		[]interface{}{true, "0x"},
+	)
+
+	results, err := DecodeMulticallResults(returnData, []*Entry{testBalanceOf, testSymbol, testBalanceOf, nil})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+
+	assert.True(t, results[0].Success)
+	assert.Equal(t, big.NewInt(12345), results[0].Outputs.Children[0].Value)
+	assert.True(t, results[1].Success)
+	assert.Equal(t, "TKN", results[1].Outputs.Children[0].Value)
+
+	assert.False(t, results[2].Success)
+	assert.Nil(t, results[2].Outputs)
+	assert.Equal(t, ethtypes.HexBytes0xPrefix(revert), results[2].ReturnData)
+	assert.Equal(t, `Error("not allowed")`, results[2].Revert)
+
+	assert.True(t, results[3].Success)
+	assert.Nil(t, results[3].Outputs)
+	assert.Empty(t, results[3].ReturnData)
+
+}
+
+func TestDecodeMulticallResultsCountMismatch(t *testing.T) {
+
+	returnData := encodeTestMulticallResults(t, []interface{}{true, "0x"})
+	_, err := DecodeMulticallResults(returnData, []*Entry{testBalanceOf, testSymbol})
+	assert.Regexp(t, "FF22148", err)
+
+}
+
+func TestDecodeMulticallResultsBadOutputs(t *testing.T) {
+
+	returnData := encodeTestMulticallResults(t, []interface{}{true, "0x1234"})
+	_, err := DecodeMulticallResults(returnData, []*Entry{testBalanceOf})
+	assert.Regexp(t, "FF22149.*balanceOf", err)
+
+}
+
+func TestDecodeMulticallResultsBadData(t *testing.T) {
+
+	_, err := DecodeMulticallResults([]byte{0x01}, []*Entry{testBalanceOf})
+	assert.Regexp(t, "FF22045", err)
+
+}
@@ -0,0 +1,328 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azurewallet
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+// azureWallet signs with EC P-256K (secp256k1) keys held in Azure Key Vault, which never leave the vault.
+// Each key's address is derived from its public key, which is cached per key so the vault is only asked
+// for keys it has not seen before. A key is pinned to the version it was first read at, as a new version
+// of a key is a different key pair (with a different address).
+type azureWallet struct {
+	conf   Config
+	client *resty.Client
+	token  *managedIdentityToken
+
+	mux         sync.Mutex
+	keys        map[string]*azureKey // by key name, nil for keys that are not secp256k1 (so they are not read again)
+	addressKeys map[ethtypes.Address0xHex]*azureKey
+	addressList []*ethtypes.Address0xHex // ordered list in listing order (append only)
+}
+
+type azureKey struct {
+	name    string
+	kid     string // includes the version
+	address ethtypes.Address0xHex
+}
+
+// azureSigner implements secp256k1.SignerDirect by signing in the vault. The vault returns the R and S
+// values only, so the recovery ID for the V value is found by recovering the address.
+type azureSigner struct {
+	ctx context.Context
+	w   *azureWallet
+	key *azureKey
+}
+
+type keyAttributes struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type keyListResponse struct {
+	Value []struct {
+		Kid        string        `json:"kid"`
+		Attributes keyAttributes `json:"attributes"`
+	} `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+type keyResponse struct {
+	Key struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	} `json:"key"`
+}
+
+type signRequest struct {
+	Alg   string `json:"alg"`
+	Value string `json:"value"`
+}
+
+type signResponse struct {
+	Value string `json:"value"`
+}
+
+func NewAzureWallet(ctx context.Context, conf *Config) (ethsigner.WalletTypedData, error) {
+	w := &azureWallet{
+		conf:   *conf,
+		client: ffresty.NewWithConfig(ctx, conf.HTTP),
+		token: &managedIdentityToken{
+			conf:   conf.ManagedIdentity,
+			client: resty.New(),
+		},
+		keys:        make(map[string]*azureKey),
+		addressKeys: make(map[ethtypes.Address0xHex]*azureKey),
+	}
+	return w, nil
+}
+
+func (w *azureWallet) request(ctx context.Context) (*resty.Request, error) {
+	token, err := w.token.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return w.client.R().
+		SetContext(ctx).
+		SetAuthToken(token), nil
+}
+
+func (w *azureWallet) Initialize(ctx context.Context) error {
+	return w.Refresh(ctx)
+}
+
+// Refresh lists the keys in the vault, reading the public key of any key that has not been seen before
+func (w *azureWallet) Refresh(ctx context.Context) error {
+	url := "/keys?api-version=" + w.conf.APIVersion
+	for url != "" {
+		var list keyListResponse
+		req, err := w.request(ctx)
+		if err != nil {
+			return err
+		}
+		res, err := req.SetResult(&list).Get(url)
+		if err != nil || res.IsError() {
+			return ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgAzureRequestFailed)
+		}
+		for _, item := range list.Value {
+			name := path.Base(item.Kid)
+			if item.Attributes.Enabled != nil && !*item.Attributes.Enabled {
+				log.L(ctx).Tracef("Ignoring key '%s': disabled", name)
+				continue
+			}
+			w.mux.Lock()
+			_, known := w.keys[name]
+			w.mux.Unlock()
+			if known {
+				continue
+			}
+			if err := w.readKey(ctx, name); err != nil {
+				return err
+			}
+		}
+		url = list.NextLink
+	}
+	return nil
+}
+
+// HealthCheck lists the first key in the vault, which checks that a Managed Identity token can be obtained,
+// and that the vault is reachable and accepts it
+func (w *azureWallet) HealthCheck(ctx context.Context) error {
+	req, err := w.request(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := req.Get("/keys?maxresults=1&api-version=" + w.conf.APIVersion)
+	if err != nil || res.IsError() {
+		return ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgAzureRequestFailed)
+	}
+	return nil
+}
+
+// readKey reads the public key of the current version of a key, and indexes it by address if it is a secp256k1 key
+func (w *azureWallet) readKey(ctx context.Context, name string) error {
+	var keyRes keyResponse
+	req, err := w.request(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := req.
+		SetResult(&keyRes).
+		SetQueryParam("api-version", w.conf.APIVersion).
+		SetPathParam("name", name).
+		Get("/keys/{name}")
+	if err != nil || res.IsError() {
+		return ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgAzureRequestFailed)
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	address, err := addressFromJWK(ctx, &keyRes)
+	if err != nil {
+		log.L(ctx).Debugf("Ignoring key '%s': %s", name, err)
+		w.keys[name] = nil
+		return nil
+	}
+	key := &azureKey{name: name, kid: keyRes.Key.Kid, address: *address}
+	w.keys[name] = key
+	if _, exists := w.addressKeys[*address]; !exists {
+		log.L(ctx).Debugf("Added address: %s (key=%s)", address, key.kid)
+		w.addressKeys[*address] = key
+		w.addressList = append(w.addressList, address)
+	}
+	return nil
+}
+
+func addressFromJWK(ctx context.Context, keyRes *keyResponse) (*ethtypes.Address0xHex, error) {
+	if !strings.HasPrefix(keyRes.Key.Kty, "EC") || keyRes.Key.Crv != "P-256K" {
+		return nil, i18n.NewError(ctx, signermsgs.MsgAzureKeyNotSecp256k1, keyRes.Key.Kty, keyRes.Key.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(keyRes.Key.X, "="))
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(keyRes.Key.Y, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(x) > 32 || len(y) > 32 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgAzureKeyNotSecp256k1, keyRes.Key.Kty, keyRes.Key.Crv)
+	}
+	uncompressed := make([]byte, 65)
+	uncompressed[0] = 0x04
+	copy(uncompressed[33-len(x):33], x)
+	copy(uncompressed[65-len(y):65], y)
+	pubKey, err := btcec.ParsePubKey(uncompressed)
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1.PublicKeyToAddress(pubKey), nil
+}
+
+// GetAccounts returns the currently cached list of known addresses
+func (w *azureWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+func (w *azureWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *azureWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	signer, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return txn.SignBig(signer, chainID)
+}
+
+func (w *azureWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	signer, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return ethsigner.SignTypedDataV4(ctx, signer, payload)
+}
+
+// getSignerForAddr returns a signer for the key with the address, re-listing the vault once
+// if the address is not known (as the key might have been created since the last Refresh)
+func (w *azureWallet) getSignerForAddr(ctx context.Context, addr ethtypes.Address0xHex) (*azureSigner, error) {
+	w.mux.Lock()
+	key, ok := w.addressKeys[addr]
+	w.mux.Unlock()
+	if !ok {
+		if err := w.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		w.mux.Lock()
+		key, ok = w.addressKeys[addr]
+		w.mux.Unlock()
+		if !ok {
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+		}
+	}
+	return &azureSigner{ctx: ctx, w: w, key: key}, nil
+}
+
+func (w *azureWallet) Close() error {
+	return nil
+}
+
+// Sign hashes the input then signs it
+func (s *azureSigner) Sign(message []byte) (*secp256k1.SignatureData, error) {
+	msgHash := sha3.NewLegacyKeccak256()
+	msgHash.Write(message)
+	return s.SignDirect(msgHash.Sum(nil))
+}
+
+// SignDirect signs the hash in the vault, returning a low-S signature with a 27/28 V value
+func (s *azureSigner) SignDirect(hash []byte) (*secp256k1.SignatureData, error) {
+	ctx := s.ctx
+	var signRes signResponse
+	req, err := s.w.request(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := req.
+		SetQueryParam("api-version", s.w.conf.APIVersion).
+		SetBody(&signRequest{
+			Alg:   "ES256K",
+			Value: base64.RawURLEncoding.EncodeToString(hash),
+		}).
+		SetResult(&signRes).
+		Post(s.key.kid + "/sign")
+	if err != nil || res.IsError() {
+		return nil, ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgAzureRequestFailed)
+	}
+	rs, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(signRes.Value, "="))
+	if err != nil || len(rs) != 64 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgAzureSignatureInvalid, s.key.kid)
+	}
+	sig, ok := secp256k1.NewSignatureFromRS(hash, new(big.Int).SetBytes(rs[0:32]), new(big.Int).SetBytes(rs[32:64]), s.key.address)
+	if ok {
+		return sig, nil
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgAzureSignatureInvalid, s.key.kid)
+}
@@ -0,0 +1,393 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azurewallet
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "test-access-token"
+
+// testAzure is a minimal Azure Key Vault keys API, and Managed Identity token endpoint
+type testAzure struct {
+	url          string
+	mux          sync.Mutex
+	keys         map[string]*secp256k1.KeyPair // nil for a non-secp256k1 key
+	disabled     map[string]bool
+	order        []string
+	keyReads     map[string]int
+	tokenReqs    int
+	highS        bool
+	badSignature bool
+	status       int
+}
+
+func (ta *testAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ta.mux.Lock()
+	defer ta.mux.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/token" {
+		ta.tokenReqs++
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != defaultManagedIdentityResource {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": testToken, "expires_in": "3600"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+testToken || r.URL.Query().Get("api-version") != defaultAPIVersion {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if ta.status != 0 {
+		w.WriteHeader(ta.status)
+		_, _ = w.Write([]byte(`{"error":{"message":"pop"}}`))
+		return
+	}
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/keys"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(segments) == 1:
+		// Paged, with one key per page
+		page := 0
+		fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+		items := []map[string]interface{}{}
+		nextLink := ""
+		if page < len(ta.order) {
+			name := ta.order[page]
+			items = append(items, map[string]interface{}{
+				"kid":        ta.url + "/keys/" + name,
+				"attributes": map[string]interface{}{"enabled": !ta.disabled[name]},
+			})
+			nextLink = fmt.Sprintf("%s/keys?api-version=%s&page=%d", ta.url, defaultAPIVersion, page+1)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"value": items, "nextLink": nextLink})
+	case r.Method == http.MethodGet && len(segments) == 2:
+		name := segments[1]
+		ta.keyReads[name]++
+		keypair, ok := ta.keys[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		jwk := map[string]string{"kid": ta.url + "/keys/" + name + "/v1", "kty": "RSA"}
+		if keypair != nil {
+			pub := keypair.PublicKey.SerializeUncompressed()
+			jwk = map[string]string{
+				"kid": ta.url + "/keys/" + name + "/v1",
+				"kty": "EC-HSM",
+				"crv": "P-256K",
+				"x":   base64.RawURLEncoding.EncodeToString(pub[1:33]),
+				"y":   base64.RawURLEncoding.EncodeToString(pub[33:65]),
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"key": jwk})
+	case r.Method == http.MethodPost && len(segments) == 4 && segments[2] == "v1" && segments[3] == "sign":
+		var req signRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		hash, _ := base64.RawURLEncoding.DecodeString(req.Value)
+		sig, _ := ta.keys[segments[1]].SignDirect(hash)
+		if ta.highS {
+			sig.S.Sub(btcec.S256().N, sig.S)
+		}
+		rs := make([]byte, 64)
+		sig.R.FillBytes(rs[0:32])
+		sig.S.FillBytes(rs[32:64])
+		if ta.badSignature {
+			rs = rs[0:32]
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"kid": ta.url + "/keys/" + segments[1] + "/v1", "value": base64.RawURLEncoding.EncodeToString(rs)})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (ta *testAzure) addKey(t *testing.T, name string, secp256k1Key bool) *secp256k1.KeyPair {
+	ta.mux.Lock()
+	defer ta.mux.Unlock()
+	var keypair *secp256k1.KeyPair
+	if secp256k1Key {
+		var err error
+		keypair, err = secp256k1.GenerateSecp256k1KeyPair()
+		assert.NoError(t, err)
+	}
+	ta.keys[name] = keypair
+	ta.order = append(ta.order, name)
+	return keypair
+}
+
+func newTestAzureWallet(t *testing.T) (context.Context, *azureWallet, *testAzure, func()) {
+	ta := &testAzure{
+		keys:     make(map[string]*secp256k1.KeyPair),
+		disabled: make(map[string]bool),
+		keyReads: make(map[string]int),
+	}
+	server := httptest.NewServer(ta)
+	ta.url = server.URL
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_azure_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ffresty.HTTPConfigURL, server.URL)
+	unitTestConfig.Set(ffresty.HTTPConfigRetryEnabled, false)
+	unitTestConfig.Set(ConfigManagedIdentityEndpoint, server.URL+"/token")
+	unitTestConfig.Set(ConfigManagedIdentityClientID, "client1")
+	ctx := context.Background()
+
+	conf, err := ReadConfig(ctx, unitTestConfig)
+	assert.NoError(t, err)
+	w, err := NewAzureWallet(ctx, conf)
+	assert.NoError(t, err)
+
+	return ctx, w.(*azureWallet), ta, func() {
+		w.Close()
+		server.Close()
+	}
+}
+
+func TestAzureWalletSignOK(t *testing.T) {
+
+	ctx, w, ta, done := newTestAzureWallet(t)
+	defer done()
+
+	key1 := ta.addKey(t, "key1", true)
+	ta.addKey(t, "rsa1", false)
+	key2 := ta.addKey(t, "key2", true)
+	ta.addKey(t, "disabled1", true)
+	ta.disabled["disabled1"] = true
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&key1.Address, &key2.Address}, accounts)
+
+	// Public keys are cached
+	err = w.Refresh(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"key1": 1, "rsa1": 1, "key2": 1}, ta.keyReads)
+	assert.Equal(t, 1, ta.tokenReqs)
+
+	for _, highS := range []bool{false, true} {
+		ta.highS = highS
+		txn := &ethsigner.Transaction{
+			From:                 json.RawMessage(fmt.Sprintf(`"%s"`, key2.Address)),
+			Nonce:                ethtypes.NewHexInteger64(1),
+			MaxFeePerGas:         ethtypes.NewHexInteger64(2000000000),
+			MaxPriorityFeePerGas: ethtypes.NewHexInteger64(1000000000),
+		}
+		signed, err := w.Sign(ctx, txn, 2022)
+		assert.NoError(t, err)
+		addr, _, err := ethsigner.RecoverRawTransaction(ctx, signed, 2022)
+		assert.NoError(t, err)
+		assert.Equal(t, key2.Address, *addr)
+	}
+
+	result, err := w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+	sig, err := secp256k1.DecodeCompactRSV(ctx, result.SignatureRSV)
+	assert.NoError(t, err)
+	assert.True(t, sig.S.Cmp(new(big.Int).Rsh(btcec.S256().N, 1)) <= 0)
+	addr, err := sig.RecoverDirect(result.Hash, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, key1.Address, *addr)
+
+}
+
+func TestAzureWalletKeyAddedAfterInitialize(t *testing.T) {
+
+	ctx, w, ta, done := newTestAzureWallet(t)
+	defer done()
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	key1 := ta.addKey(t, "key1", true)
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestAzureWalletRequestFailures(t *testing.T) {
+
+	ctx, w, ta, done := newTestAzureWallet(t)
+	defer done()
+
+	ta.status = http.StatusInternalServerError
+	err := w.Refresh(ctx)
+	assert.Regexp(t, "FF22158.*pop", err)
+
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22158.*pop", err)
+
+}
+
+func TestAzureWalletKeyReadFailure(t *testing.T) {
+
+	ctx, w, ta, done := newTestAzureWallet(t)
+	defer done()
+
+	ta.order = append(ta.order, "missing")
+	err := w.Refresh(ctx)
+	assert.Regexp(t, "FF22158", err)
+
+}
+
+func TestAzureWalletSignFailures(t *testing.T) {
+
+	ctx, w, ta, done := newTestAzureWallet(t)
+	defer done()
+
+	key1 := ta.addKey(t, "key1", true)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	ta.badSignature = true
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22160", err)
+
+	// A signature from a different key does not recover to the address
+	ta.badSignature = false
+	ta.keys["key1"], _ = secp256k1.GenerateSecp256k1KeyPair()
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22160", err)
+
+	ta.status = http.StatusForbidden
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22158", err)
+
+}
+
+func TestAzureWalletManagedIdentityFailure(t *testing.T) {
+
+	ctx, w, _, done := newTestAzureWallet(t)
+	defer done()
+
+	w.token.conf.Resource = "wrong"
+	err := w.Refresh(ctx)
+	assert.Regexp(t, "FF22159", err)
+
+	_, err = (&azureSigner{ctx: ctx, w: w, key: &azureKey{}}).Sign([]byte("hello"))
+	assert.Regexp(t, "FF22159", err)
+
+	_, err = w.getSignerForAddr(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`))
+	assert.Regexp(t, "FF22159", err)
+
+}
+
+func TestAzureWalletHealthCheck(t *testing.T) {
+
+	ctx, w, ta, done := newTestAzureWallet(t)
+	defer done()
+
+	ta.addKey(t, "key1", true)
+	assert.NoError(t, w.HealthCheck(ctx))
+	assert.Zero(t, ta.keyReads["key1"])
+
+	ta.status = http.StatusUnauthorized
+	assert.Regexp(t, "FF22158.*pop", w.HealthCheck(ctx))
+
+	w.token.conf.Resource = "wrong"
+	w.token.token = ""
+	assert.Regexp(t, "FF22159", w.HealthCheck(ctx))
+
+}
+
+func TestAzureWalletBadFrom(t *testing.T) {
+
+	ctx, w, _, done := newTestAzureWallet(t)
+	defer done()
+
+	_, err := w.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"bad"`),
+	}, 2022)
+	assert.Regexp(t, "bad address", err)
+
+}
+
+func TestAddressFromJWKBad(t *testing.T) {
+
+	ctx := context.Background()
+	for _, jwk := range []string{
+		`{"kty":"EC","crv":"P-256"}`,
+		`{"kty":"EC","crv":"P-256K","x":"!"}`,
+		`{"kty":"EC","crv":"P-256K","x":"AA","y":"!"}`,
+		`{"kty":"EC","crv":"P-256K","x":"` + base64.RawURLEncoding.EncodeToString(make([]byte, 33)) + `","y":"AA"}`,
+		`{"kty":"EC","crv":"P-256K","x":"AA","y":"AA"}`,
+	} {
+		var keyRes keyResponse
+		err := json.Unmarshal([]byte(`{"key":`+jwk+`}`), &keyRes)
+		assert.NoError(t, err)
+		_, err = addressFromJWK(ctx, &keyRes)
+		assert.Error(t, err)
+	}
+
+}
+
+func TestManagedIdentityTokenRefresh(t *testing.T) {
+
+	ctx, w, ta, done := newTestAzureWallet(t)
+	defer done()
+
+	_, err := w.token.get(ctx)
+	assert.NoError(t, err)
+	_, err = w.token.get(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ta.tokenReqs)
+
+	// Replaced once within the refresh margin of expiry
+	w.token.expires = w.token.expires.Add(-3599 * 1e9)
+	_, err = w.token.get(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, ta.tokenReqs)
+
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azurewallet
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+)
+
+const (
+	// ConfigAPIVersion the Key Vault REST API version
+	ConfigAPIVersion = "apiVersion"
+	// ConfigManagedIdentityEndpoint the endpoint to obtain Managed Identity access tokens from
+	ConfigManagedIdentityEndpoint = "managedIdentity.endpoint"
+	// ConfigManagedIdentityClientID the client ID of a user-assigned Managed Identity - the system-assigned identity is used when not set
+	ConfigManagedIdentityClientID = "managedIdentity.clientId"
+	// ConfigManagedIdentityResource the resource to request access tokens for
+	ConfigManagedIdentityResource = "managedIdentity.resource"
+)
+
+const (
+	defaultAPIVersion              = "7.4"
+	defaultManagedIdentityEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	defaultManagedIdentityResource = "https://vault.azure.net"
+)
+
+type Config struct {
+	HTTP            ffresty.Config // the URL is the vault URL, such as https://myvault.vault.azure.net
+	APIVersion      string
+	ManagedIdentity ManagedIdentityConfig
+}
+
+type ManagedIdentityConfig struct {
+	Endpoint string
+	ClientID string
+	Resource string
+}
+
+func InitConfig(section config.Section) {
+	ffresty.InitConfig(section)
+	section.AddKnownKey(ConfigAPIVersion, defaultAPIVersion)
+	section.AddKnownKey(ConfigManagedIdentityEndpoint, defaultManagedIdentityEndpoint)
+	section.AddKnownKey(ConfigManagedIdentityClientID)
+	section.AddKnownKey(ConfigManagedIdentityResource, defaultManagedIdentityResource)
+}
+
+func ReadConfig(ctx context.Context, section config.Section) (*Config, error) {
+	httpConf, err := ffresty.GenerateConfig(ctx, section)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		HTTP:       *httpConf,
+		APIVersion: section.GetString(ConfigAPIVersion),
+		ManagedIdentity: ManagedIdentityConfig{
+			Endpoint: section.GetString(ConfigManagedIdentityEndpoint),
+			ClientID: section.GetString(ConfigManagedIdentityClientID),
+			Resource: section.GetString(ConfigManagedIdentityResource),
+		},
+	}, nil
+}
@@ -0,0 +1,75 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azurewallet
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+const managedIdentityAPIVersion = "2018-02-01"
+
+// tokenRefreshMargin is how long before it expires that an access token is replaced
+const tokenRefreshMargin = 5 * time.Minute
+
+// managedIdentityToken obtains access tokens for the Managed Identity of the VM, container or
+// App Service the signer runs in, from the Azure Instance Metadata Service (IMDS). Tokens are
+// cached until shortly before they expire.
+type managedIdentityToken struct {
+	conf    ManagedIdentityConfig
+	client  *resty.Client
+	mux     sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type managedIdentityTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   string `json:"expires_in"`
+}
+
+func (mi *managedIdentityToken) get(ctx context.Context) (string, error) {
+	mi.mux.Lock()
+	defer mi.mux.Unlock()
+	if mi.token != "" && time.Now().Add(tokenRefreshMargin).Before(mi.expires) {
+		return mi.token, nil
+	}
+	var tokenRes managedIdentityTokenResponse
+	req := mi.client.R().
+		SetContext(ctx).
+		SetHeader("Metadata", "true").
+		SetQueryParam("api-version", managedIdentityAPIVersion).
+		SetQueryParam("resource", mi.conf.Resource).
+		SetResult(&tokenRes)
+	if mi.conf.ClientID != "" {
+		req.SetQueryParam("client_id", mi.conf.ClientID)
+	}
+	res, err := req.Get(mi.conf.Endpoint)
+	if err != nil || res.IsError() || tokenRes.AccessToken == "" {
+		return "", ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgAzureManagedIdentityFailed)
+	}
+	expiresIn, _ := strconv.ParseInt(tokenRes.ExpiresIn, 10, 64)
+	mi.token = tokenRes.AccessToken
+	mi.expires = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	return mi.token, nil
+}
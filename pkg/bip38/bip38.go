@@ -0,0 +1,177 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bip38 decrypts BIP-38 passphrase-protected private keys (the "6P..." strings of paper wallets and
+// older backups), so they can be imported and re-wrapped as Keystore V3 files.
+package bip38
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"fmt"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2" // ISC licensed
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/ripemd160" //nolint:staticcheck // RIPEMD-160 is required by the address hash, not used for new security purposes
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	encryptedKeyLength = 39
+
+	flagCompressed  = 0x20
+	flagLotSequence = 0x04
+	flagNonECFixed  = 0xc0 // both set for keys encrypted without EC multiplication
+)
+
+var (
+	prefixNonEC      = []byte{0x01, 0x42}
+	prefixECMultiply = []byte{0x01, 0x43}
+)
+
+// Decrypt decrypts a BIP-38 encrypted private key with its passphrase, returning the key pair, and whether the
+// Bitcoin address the key was encrypted for uses the compressed public key. Both the non-EC-multiplied ("6PR"/"6PY")
+// and EC-multiplied ("6Pf"/"6Pn") forms are supported. The passphrase is verified with the address hash in the
+// encrypted key, so an incorrect passphrase returns an error.
+func Decrypt(encrypted, passphrase string) (keypair *secp256k1.KeyPair, compressed bool, err error) {
+	b, err := base58CheckDecode(encrypted)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid bip38 key: %s", err)
+	}
+	if len(b) != encryptedKeyLength {
+		return nil, false, fmt.Errorf("invalid bip38 key: length %d != %d", len(b), encryptedKeyLength)
+	}
+	flag := b[2]
+	compressed = flag&flagCompressed != 0
+	password := []byte(norm.NFC.String(passphrase))
+	var privateKey []byte
+	switch {
+	case bytes.Equal(b[0:2], prefixNonEC) && flag&flagNonECFixed == flagNonECFixed:
+		privateKey, err = decryptNonEC(b, password)
+	case bytes.Equal(b[0:2], prefixECMultiply):
+		privateKey, err = decryptECMultiply(b, password)
+	default:
+		return nil, false, fmt.Errorf("invalid bip38 key: unsupported prefix %x and flag %x", b[0:2], flag)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := secp256k1.ValidatePrivateKeyBytes(privateKey); err != nil {
+		return nil, false, fmt.Errorf("invalid bip38 key: %s", err)
+	}
+	keypair = secp256k1.KeyPairFromBytes(privateKey)
+	if !bytes.Equal(addressHash(keypair, compressed), b[3:7]) {
+		keypair.Destroy()
+		return nil, false, fmt.Errorf("invalid bip38 passphrase")
+	}
+	return keypair, compressed, nil
+}
+
+// DecryptToWalletFile decrypts a BIP-38 encrypted private key, and re-wraps it as a Keystore V3 wallet file under
+// a new password, with the KDF selected by the options
+func DecryptToWalletFile(encrypted, passphrase, password string, options *keystorev3.KDFOptions) (keystorev3.WalletFile, error) {
+	keypair, _, err := Decrypt(encrypted, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return keystorev3.NewWalletFileKDF(password, keypair, options)
+}
+
+// decryptNonEC decrypts a key that was encrypted directly with a key derived from the passphrase
+func decryptNonEC(b, password []byte) ([]byte, error) {
+	addressHash := b[3:7]
+	derived, err := scrypt.Key(password, addressHash, 16384, 8, 8, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bip38 key: %s", err)
+	}
+	derivedHalf1, derivedHalf2 := derived[0:32], derived[32:64]
+	privateKey := aes256DecryptBlocks(derivedHalf2, b[7:39])
+	xorBytes(privateKey, derivedHalf1)
+	return privateKey, nil
+}
+
+// decryptECMultiply decrypts a key generated from an intermediate code, which is the product of the passfactor
+// (derived from the passphrase) and the factor from a random seed encrypted in the key
+func decryptECMultiply(b, password []byte) ([]byte, error) {
+	flag, addressHash, ownerEntropy := b[2], b[3:7], b[7:15]
+	ownerSalt := ownerEntropy
+	if flag&flagLotSequence != 0 {
+		ownerSalt = ownerEntropy[0:4]
+	}
+	passFactor, err := scrypt.Key(password, ownerSalt, 16384, 8, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bip38 key: %s", err)
+	}
+	if flag&flagLotSequence != 0 {
+		passFactor = doubleSHA256(append(passFactor, ownerEntropy...))
+	}
+	passPoint := secp256k1.KeyPairFromBytes(passFactor).PublicKey.SerializeCompressed()
+	derived, err := scrypt.Key(passPoint, append(append([]byte{}, addressHash...), ownerEntropy...), 1024, 1, 1, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bip38 key: %s", err)
+	}
+	derivedHalf1, derivedHalf2 := derived[0:32], derived[32:64]
+
+	// The second encrypted part holds the end of the first encrypted part, and the end of seedb
+	decrypted2 := aes256DecryptBlocks(derivedHalf2, b[23:39])
+	xorBytes(decrypted2, derivedHalf1[16:32])
+	encryptedPart1 := append(append([]byte{}, b[15:23]...), decrypted2[0:8]...)
+	decrypted1 := aes256DecryptBlocks(derivedHalf2, encryptedPart1)
+	xorBytes(decrypted1, derivedHalf1[0:16])
+	seedB := append(decrypted1, decrypted2[8:16]...)
+	factorB := doubleSHA256(seedB)
+
+	var k, factor btcec.ModNScalar
+	k.SetByteSlice(passFactor)
+	factor.SetByteSlice(factorB)
+	k.Mul(&factor)
+	privateKey := k.Bytes()
+	k.Zero()
+	return privateKey[:], nil
+}
+
+// addressHash is the first four bytes of the double SHA-256 of the Bitcoin (P2PKH) address of the key
+func addressHash(keypair *secp256k1.KeyPair, compressed bool) []byte {
+	publicKey := keypair.PublicKey.SerializeUncompressed()
+	if compressed {
+		publicKey = keypair.PublicKey.SerializeCompressed()
+	}
+	sha := sha256.Sum256(publicKey)
+	ripemd := ripemd160.New()
+	ripemd.Write(sha[:])
+	address := base58CheckEncode(append([]byte{0x00}, ripemd.Sum(nil)...))
+	return doubleSHA256([]byte(address))[0:4]
+}
+
+// aes256DecryptBlocks decrypts each 16 byte block independently (ECB), as specified by BIP-38
+func aes256DecryptBlocks(key, encrypted []byte) []byte {
+	block, _ := aes.NewCipher(key) // cannot fail with a 32 byte key
+	decrypted := make([]byte, len(encrypted))
+	for i := 0; i < len(encrypted); i += aes.BlockSize {
+		block.Decrypt(decrypted[i:i+aes.BlockSize], encrypted[i:i+aes.BlockSize])
+	}
+	return decrypted
+}
+
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
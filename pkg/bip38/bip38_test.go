@@ -0,0 +1,111 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bip38
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors from https://github.com/bitcoin/bips/blob/master/bip-0038.mediawiki
+var testVectors = []struct {
+	name       string
+	encrypted  string
+	passphrase string
+	privateKey string
+	compressed bool
+}{
+	{"non-ec 1", "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg", "TestingOneTwoThree", "cbf4b9f70470856bb4f40f80b87edb90865997ffee6df315ab166d713af433a5", false},
+	{"non-ec 2", "6PRNFFkZc2NZ6dJqFfhRoFNMR9Lnyj7dYGrzdgXXVMXcxoKTePPX1dWByq", "Satoshi", "09c2686880095b1a4c249ee3ac4eea8a014f11e6f986d0b5025ac1f39afbd9ae", false},
+	{"non-ec compressed 1", "6PYNKZ1EAgYgmQfmNVamxyXVWHzK5s6DGhwP4J5o44cvXdoY7sRzhtpUeo", "TestingOneTwoThree", "cbf4b9f70470856bb4f40f80b87edb90865997ffee6df315ab166d713af433a5", true},
+	{"non-ec compressed 2", "6PYLtMnXvfG3oJde97zRyLYFZCYizPU5T3LwgdYJz1fRhh16bU7u6PPmY7", "Satoshi", "09c2686880095b1a4c249ee3ac4eea8a014f11e6f986d0b5025ac1f39afbd9ae", true},
+	{"ec 1", "6PfQu77ygVyJLZjfvMLyhLMQbYnu5uguoJJ4kMCLqWwPEdfpwANVS76gTX", "TestingOneTwoThree", "a43a940577f4e97f5c4d39eb14ff083a98187c64ea7c99ef7ce460833959a519", false},
+	{"ec 2", "6PfLGnQs6VZnrNpmVKfjotbnQuaJK4KZoPFrAjx1JMJUa1Ft8gnf5WxfKd", "Satoshi", "c2c8036df268f498099350718c4a3ef3984d2be84618c2650f5171dcc5eb660a", false},
+	{"ec lot/sequence 1", "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j", "MOLON LABE", "44ea95afbf138356a05ea32110dfd627232d0f2991ad221187be356f19fa8190", false},
+	{"ec lot/sequence 2", "6PgGWtx25kUg8QWvwuJAgorN6k9FbE25rv5dMRwu5SKMnfpfVe5mar2ngH", "ΜΟΛΩΝ ΛΑΒΕ", "ca2759aa4adb0f96c414f36abeb8db59342985be9fa50faac228c8e7d90e3006", false},
+}
+
+func TestDecryptVectors(t *testing.T) {
+	for _, v := range testVectors {
+		t.Run(v.name, func(t *testing.T) {
+			keypair, compressed, err := Decrypt(v.encrypted, v.passphrase)
+			assert.NoError(t, err)
+			assert.Equal(t, v.privateKey, hex.EncodeToString(keypair.PrivateKeyBytes()))
+			assert.Equal(t, v.compressed, compressed)
+		})
+	}
+}
+
+func TestDecryptWrongPassphrase(t *testing.T) {
+	_, _, err := Decrypt(testVectors[0].encrypted, "wrong")
+	assert.Regexp(t, "invalid bip38 passphrase", err)
+
+	_, _, err = Decrypt(testVectors[4].encrypted, "wrong")
+	assert.Regexp(t, "invalid bip38 passphrase", err)
+}
+
+func TestDecryptToWalletFile(t *testing.T) {
+	wf, err := DecryptToWalletFile(testVectors[1].encrypted, testVectors[1].passphrase, "myPrecious", &keystorev3.KDFOptions{
+		Scrypt: &keystorev3.ScryptOptions{N: 1024},
+	})
+	assert.NoError(t, err)
+
+	wf2, err := keystorev3.ReadWalletFile(wf.JSON(), []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.Equal(t, testVectors[1].privateKey, hex.EncodeToString(wf2.PrivateKey()))
+
+	_, err = DecryptToWalletFile(testVectors[1].encrypted, "wrong", "myPrecious", nil)
+	assert.Regexp(t, "invalid bip38 passphrase", err)
+}
+
+func TestDecryptInvalid(t *testing.T) {
+	_, _, err := Decrypt("6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2Zo0g", "")
+	assert.Regexp(t, "invalid bip38 key: invalid base58 character '0'", err)
+
+	_, _, err = Decrypt("6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGh", "")
+	assert.Regexp(t, "invalid bip38 key: invalid base58check checksum", err)
+
+	_, _, err = Decrypt("1", "")
+	assert.Regexp(t, "invalid bip38 key: invalid base58check length", err)
+
+	_, _, err = Decrypt(base58CheckEncode([]byte{0x01, 0x42, 0xc0}), "")
+	assert.Regexp(t, "invalid bip38 key: length 3", err)
+
+	_, _, err = Decrypt(base58CheckEncode(append([]byte{0x01, 0x42, 0x00}, make([]byte, 36)...)), "")
+	assert.Regexp(t, "invalid bip38 key: unsupported prefix 0142 and flag 0", err)
+}
+
+func TestDecryptFlagTampered(t *testing.T) {
+	// The address hash covers whether the address is compressed, so the flag cannot be changed
+	b, err := base58CheckDecode(testVectors[0].encrypted)
+	assert.NoError(t, err)
+	b[2] |= flagCompressed
+	_, _, err = Decrypt(base58CheckEncode(b), testVectors[0].passphrase)
+	assert.Regexp(t, "invalid bip38 passphrase", err)
+}
+
+func TestBase58RoundTrip(t *testing.T) {
+	encoded := base58CheckEncode([]byte{0x00, 0x00, 0x01, 0x02})
+	assert.True(t, strings.HasPrefix(encoded, "11"))
+	decoded, err := base58CheckDecode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x00, 0x01, 0x02}, decoded)
+}
@@ -0,0 +1,216 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clefwallet
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+// Wallet delegates signing to go-ethereum's Clef, through its external API over IPC or HTTP, so the
+// requests are subject to Clef's rules and manual approval as for any other client. Clef signs with
+// the chain ID it is started with, and rejects transactions for any other chain.
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	ethsigner.HealthCheckWallet
+}
+
+type clefWallet struct {
+	transport transport
+	nextID    atomic.Int64
+
+	mux         sync.Mutex
+	addressList []*ethtypes.Address0xHex
+}
+
+// clefTransaction is the transaction format of Clef's account_signTransaction
+type clefTransaction struct {
+	From                 ethtypes.Address0xHex      `json:"from"`
+	To                   *ethtypes.Address0xHex     `json:"to,omitempty"`
+	Gas                  *ethtypes.HexInteger       `json:"gas,omitempty"`
+	GasPrice             *ethtypes.HexInteger       `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *ethtypes.HexInteger       `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *ethtypes.HexInteger       `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *ethtypes.HexInteger       `json:"value,omitempty"`
+	Nonce                *ethtypes.HexInteger       `json:"nonce,omitempty"`
+	Data                 *ethtypes.HexBytes0xPrefix `json:"data,omitempty"`
+	ChainID              *ethtypes.HexInteger       `json:"chainId,omitempty"`
+}
+
+type clefSignTransactionResult struct {
+	Raw ethtypes.HexBytes0xPrefix `json:"raw"`
+}
+
+func NewClefWallet(ctx context.Context, conf *Config) (Wallet, error) {
+	w := &clefWallet{}
+	if conf.IPCPath != "" {
+		w.transport = &ipcTransport{path: conf.IPCPath}
+	} else {
+		w.transport = &httpTransport{client: ffresty.NewWithConfig(ctx, conf.HTTP)}
+	}
+	return w, nil
+}
+
+func (w *clefWallet) call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	rpcRes, err := w.transport.roundTrip(ctx, &rpcRequest{
+		JSONRpc: "2.0",
+		ID:      w.nextID.Add(1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	if rpcRes.Error != nil {
+		return i18n.NewError(ctx, signermsgs.MsgClefRequestFailed, method, rpcRes.Error.Message)
+	}
+	if err := json.Unmarshal(rpcRes.Result, result); err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgClefRequestFailed, method, err)
+	}
+	return nil
+}
+
+func (w *clefWallet) Initialize(ctx context.Context) error {
+	return w.Refresh(ctx)
+}
+
+// HealthCheck asks Clef for the version of its external API with account_version, which checks that Clef is
+// reachable without a request that needs approval
+func (w *clefWallet) HealthCheck(ctx context.Context) error {
+	var version string
+	return w.call(ctx, &version, "account_version")
+}
+
+// Refresh reads the accounts from Clef with account_list
+func (w *clefWallet) Refresh(ctx context.Context) error {
+	var accounts []*ethtypes.Address0xHex
+	if err := w.call(ctx, &accounts, "account_list"); err != nil {
+		return err
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	log.L(ctx).Debugf("Clef returned %d accounts", len(accounts))
+	w.addressList = accounts
+	return nil
+}
+
+// GetAccounts returns the accounts read from Clef by the last Refresh
+func (w *clefWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+func (w *clefWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+// SignBig asks Clef to sign the transaction, and checks the raw transaction it returns is the
+// transaction that was requested, signed by the from address
+func (w *clefWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	clefTxn := &clefTransaction{
+		From:                 from,
+		To:                   txn.To,
+		Gas:                  txn.GasLimit,
+		GasPrice:             txn.GasPrice,
+		MaxFeePerGas:         txn.MaxFeePerGas,
+		MaxPriorityFeePerGas: txn.MaxPriorityFeePerGas,
+		Value:                txn.Value,
+		Nonce:                txn.Nonce,
+		ChainID:              ethtypes.NewHexInteger(chainID),
+	}
+	if len(txn.Data) > 0 {
+		clefTxn.Data = &txn.Data
+	}
+	var result clefSignTransactionResult
+	if err := w.call(ctx, &result, "account_signTransaction", clefTxn); err != nil {
+		return nil, err
+	}
+	signer, signed, err := ethsigner.RecoverRawTransactionBig(ctx, result.Raw, chainID)
+	if err != nil || *signer != from || !sameTransaction(txn, signed.Transaction) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgClefSignatureInvalid, from)
+	}
+	return result.Raw, nil
+}
+
+// sameTransaction checks the fields of the signed transaction match the request, other than the gas
+// pricing, which Clef rules are allowed to change
+func sameTransaction(requested, signed *ethsigner.Transaction) bool {
+	intValue := func(i *ethtypes.HexInteger) *big.Int {
+		if i == nil {
+			return new(big.Int)
+		}
+		return i.BigInt()
+	}
+	return intValue(requested.Nonce).Cmp(intValue(signed.Nonce)) == 0 &&
+		intValue(requested.Value).Cmp(intValue(signed.Value)) == 0 &&
+		intValue(requested.GasLimit).Cmp(intValue(signed.GasLimit)) == 0 &&
+		(requested.To == nil) == (signed.To == nil) &&
+		(requested.To == nil || *requested.To == *signed.To) &&
+		requested.Data.String() == signed.Data.String()
+}
+
+// SignTypedDataV4 asks Clef to sign the typed data with account_signTypedData, returning the
+// signature with the hash that was signed
+func (w *clefWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	hash, err := eip712.EncodeTypedDataV4(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	var signatureRSV ethtypes.HexBytes0xPrefix
+	if err := w.call(ctx, &signatureRSV, "account_signTypedData", &from, payload); err != nil {
+		return nil, err
+	}
+	sig, err := secp256k1.DecodeCompactRSV(ctx, signatureRSV)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgClefSignatureInvalid, from)
+	}
+	if addr, err := sig.RecoverDirect(hash, 0); err != nil || *addr != from {
+		return nil, i18n.NewError(ctx, signermsgs.MsgClefSignatureInvalid, from)
+	}
+	return &ethsigner.EIP712Result{
+		Hash:         hash,
+		SignatureRSV: signatureRSV,
+		V:            ethtypes.HexInteger(*sig.V),
+		R:            sig.R.FillBytes(make([]byte, 32)),
+		S:            sig.S.FillBytes(make([]byte, 32)),
+	}, nil
+}
+
+func (w *clefWallet) Close() error {
+	w.transport.close()
+	return nil
+}
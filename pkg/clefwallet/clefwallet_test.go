@@ -0,0 +1,431 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clefwallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+const testChainID = 1337
+
+// testClef is a minimal Clef external API, which approves every request
+type testClef struct {
+	mux       sync.Mutex
+	keys      map[ethtypes.Address0xHex]*secp256k1.KeyPair
+	order     []*ethtypes.Address0xHex
+	deny      bool
+	wrongKey  *secp256k1.KeyPair // signs with this key instead, if set
+	tamper    func(txn *ethsigner.Transaction)
+	badResult bool
+	block     chan struct{}
+	calls     []string
+}
+
+func newTestClef(t *testing.T, count int) *testClef {
+	tc := &testClef{keys: make(map[ethtypes.Address0xHex]*secp256k1.KeyPair)}
+	for i := 0; i < count; i++ {
+		keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+		assert.NoError(t, err)
+		tc.keys[keypair.Address] = keypair
+		tc.order = append(tc.order, &keypair.Address)
+	}
+	return tc
+}
+
+type testRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func (tc *testClef) handle(rpcReq *testRequest) *rpcResponse {
+	tc.mux.Lock()
+	block := tc.block
+	tc.mux.Unlock()
+	if block != nil {
+		<-block
+	}
+	tc.mux.Lock()
+	defer tc.mux.Unlock()
+	tc.calls = append(tc.calls, rpcReq.Method)
+	rpcRes := &rpcResponse{ID: rpcReq.ID}
+	if tc.deny {
+		rpcRes.Error = &rpcError{Code: -32000, Message: "Request denied"}
+		return rpcRes
+	}
+	var result interface{}
+	switch rpcReq.Method {
+	case "account_version":
+		result = "6.0.0"
+	case "account_list":
+		result = tc.order
+	case "account_signTransaction":
+		var clefTxn clefTransaction
+		_ = json.Unmarshal(rpcReq.Params[0], &clefTxn)
+		txn := &ethsigner.Transaction{
+			Nonce:                clefTxn.Nonce,
+			GasPrice:             clefTxn.GasPrice,
+			MaxPriorityFeePerGas: clefTxn.MaxPriorityFeePerGas,
+			MaxFeePerGas:         clefTxn.MaxFeePerGas,
+			GasLimit:             clefTxn.Gas,
+			To:                   clefTxn.To,
+			Value:                clefTxn.Value,
+		}
+		if clefTxn.Data != nil {
+			txn.Data = *clefTxn.Data
+		}
+		if tc.tamper != nil {
+			tc.tamper(txn)
+		}
+		raw, _ := txn.SignBig(tc.signingKey(clefTxn.From), clefTxn.ChainID.BigInt())
+		result = map[string]interface{}{"raw": ethtypes.HexBytes0xPrefix(raw), "tx": clefTxn}
+	case "account_signTypedData":
+		var from ethtypes.Address0xHex
+		var payload eip712.TypedData
+		_ = json.Unmarshal(rpcReq.Params[0], &from)
+		_ = json.Unmarshal(rpcReq.Params[1], &payload)
+		sig, _ := ethsigner.SignTypedDataV4(context.Background(), tc.signingKey(from), &payload)
+		result = sig.SignatureRSV
+	}
+	if tc.badResult {
+		result = "!!!"
+	}
+	rpcRes.Result, _ = json.Marshal(result)
+	return rpcRes
+}
+
+func (tc *testClef) signingKey(from ethtypes.Address0xHex) *secp256k1.KeyPair {
+	if tc.wrongKey != nil {
+		return tc.wrongKey
+	}
+	return tc.keys[from]
+}
+
+func (tc *testClef) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var rpcReq testRequest
+	_ = json.NewDecoder(r.Body).Decode(&rpcReq)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tc.handle(&rpcReq))
+}
+
+func (tc *testClef) serveIPC(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "clef.ipc")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				dec, enc := json.NewDecoder(conn), json.NewEncoder(conn)
+				for {
+					var rpcReq testRequest
+					if err := dec.Decode(&rpcReq); err != nil {
+						return
+					}
+					// A notification that is not a response to the request is ignored by the client
+					_ = enc.Encode(&rpcResponse{ID: json.RawMessage(`"other"`)})
+					_ = enc.Encode(tc.handle(&rpcReq))
+				}
+			}()
+		}
+	}()
+	return path
+}
+
+func newTestClefWallet(t *testing.T, tc *testClef, ipc bool) (context.Context, *clefWallet) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_clef_config")
+	InitConfig(unitTestConfig)
+	if ipc {
+		unitTestConfig.Set(ConfigIPCPath, tc.serveIPC(t))
+	} else {
+		server := httptest.NewServer(tc)
+		t.Cleanup(server.Close)
+		unitTestConfig.Set(ffresty.HTTPConfigURL, server.URL)
+		unitTestConfig.Set(ffresty.HTTPConfigRetryEnabled, false)
+	}
+	ctx := context.Background()
+	conf, err := ReadConfig(ctx, unitTestConfig)
+	assert.NoError(t, err)
+	w, err := NewClefWallet(ctx, conf)
+	assert.NoError(t, err)
+	t.Cleanup(func() { w.Close() })
+	return ctx, w.(*clefWallet)
+}
+
+func TestClefWalletSignOK(t *testing.T) {
+
+	for _, ipc := range []bool{false, true} {
+		tc := newTestClef(t, 2)
+		ctx, w := newTestClefWallet(t, tc, ipc)
+
+		err := w.Initialize(ctx)
+		assert.NoError(t, err)
+		accounts, err := w.GetAccounts(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.order, accounts)
+
+		from := *accounts[1]
+		for _, txn := range []*ethsigner.Transaction{
+			{
+				From:                 json.RawMessage(fmt.Sprintf(`"%s"`, from)),
+				Nonce:                ethtypes.NewHexInteger64(1),
+				GasLimit:             ethtypes.NewHexInteger64(21000),
+				MaxFeePerGas:         ethtypes.NewHexInteger64(2000000000),
+				MaxPriorityFeePerGas: ethtypes.NewHexInteger64(1000000000),
+				To:                   ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20"),
+				Value:                ethtypes.NewHexInteger64(100),
+				Data:                 ethtypes.MustNewHexBytes0xPrefix("0xfeedbeef"),
+			},
+			{
+				From:     json.RawMessage(fmt.Sprintf(`"%s"`, from)),
+				Nonce:    ethtypes.NewHexInteger64(2),
+				GasLimit: ethtypes.NewHexInteger64(100000),
+				GasPrice: ethtypes.NewHexInteger64(1000000000),
+			},
+		} {
+			signed, err := w.Sign(ctx, txn, testChainID)
+			assert.NoError(t, err)
+			addr, _, err := ethsigner.RecoverRawTransaction(ctx, signed, testChainID)
+			assert.NoError(t, err)
+			assert.Equal(t, from, *addr)
+		}
+
+		result, err := w.SignTypedDataV4(ctx, from, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+		assert.NoError(t, err)
+		sig, err := secp256k1.DecodeCompactRSV(ctx, result.SignatureRSV)
+		assert.NoError(t, err)
+		addr, err := sig.RecoverDirect(result.Hash, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, from, *addr)
+		assert.Equal(t, sig.V.Int64(), result.V.Int64())
+	}
+
+}
+
+func TestClefWalletDenied(t *testing.T) {
+
+	for _, ipc := range []bool{false, true} {
+		tc := newTestClef(t, 1)
+		ctx, w := newTestClefWallet(t, tc, ipc)
+		tc.deny = true
+
+		err := w.Refresh(ctx)
+		assert.Regexp(t, "FF22182.*account_list.*Request denied", err)
+
+		_, err = w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(fmt.Sprintf(`"%s"`, tc.order[0]))}, testChainID)
+		assert.Regexp(t, "FF22182.*account_signTransaction.*Request denied", err)
+
+		_, err = w.SignTypedDataV4(ctx, *tc.order[0], &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+		assert.Regexp(t, "FF22182.*account_signTypedData.*Request denied", err)
+	}
+
+}
+
+func TestClefWalletHealthCheck(t *testing.T) {
+
+	for _, ipc := range []bool{false, true} {
+		tc := newTestClef(t, 1)
+		ctx, w := newTestClefWallet(t, tc, ipc)
+
+		assert.NoError(t, w.HealthCheck(ctx))
+		assert.Equal(t, []string{"account_version"}, tc.calls)
+
+		tc.deny = true
+		assert.Regexp(t, "FF22182.*account_version.*Request denied", w.HealthCheck(ctx))
+	}
+
+}
+
+func TestClefWalletSignatureChecks(t *testing.T) {
+
+	tc := newTestClef(t, 1)
+	ctx, w := newTestClefWallet(t, tc, false)
+	from := *tc.order[0]
+	txn := &ethsigner.Transaction{
+		From:     json.RawMessage(fmt.Sprintf(`"%s"`, from)),
+		Nonce:    ethtypes.NewHexInteger64(1),
+		GasLimit: ethtypes.NewHexInteger64(21000),
+		GasPrice: ethtypes.NewHexInteger64(1000000000),
+		To:       ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20"),
+	}
+
+	// Signed by a different key
+	tc.wrongKey, _ = secp256k1.GenerateSecp256k1KeyPair()
+	_, err := w.Sign(ctx, txn, testChainID)
+	assert.Regexp(t, "FF22183", err)
+	_, err = w.SignTypedDataV4(ctx, from, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22183", err)
+	tc.wrongKey = nil
+
+	// A different transaction to the one requested
+	for _, tamper := range []func(txn *ethsigner.Transaction){
+		func(txn *ethsigner.Transaction) { txn.Nonce = ethtypes.NewHexInteger64(2) },
+		func(txn *ethsigner.Transaction) { txn.To = nil },
+		func(txn *ethsigner.Transaction) {
+			txn.To = ethtypes.MustNewAddress("0x2b1c769ef5ad304a4889f2a07a6617cd935849ae")
+		},
+		func(txn *ethsigner.Transaction) { txn.Data = ethtypes.MustNewHexBytes0xPrefix("0x01") },
+		func(txn *ethsigner.Transaction) { txn.Value = ethtypes.NewHexInteger64(1) },
+	} {
+		tc.tamper = tamper
+		_, err = w.Sign(ctx, txn, testChainID)
+		assert.Regexp(t, "FF22183", err)
+	}
+	tc.tamper = nil
+
+	_, err = w.Sign(ctx, txn, testChainID)
+	assert.NoError(t, err)
+
+	tc.badResult = true
+	_, err = w.Sign(ctx, txn, testChainID)
+	assert.Regexp(t, "FF22182", err)
+	_, err = w.SignTypedDataV4(ctx, from, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22182", err)
+
+}
+
+func TestClefWalletBadSignatureLength(t *testing.T) {
+
+	tc := newTestClef(t, 1)
+	ctx, w := newTestClefWallet(t, tc, false)
+	w.transport = &staticTransport{result: `"0x1234"`}
+
+	_, err := w.SignTypedDataV4(ctx, *tc.order[0], &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22183", err)
+
+}
+
+type staticTransport struct {
+	result string
+}
+
+func (st *staticTransport) roundTrip(_ context.Context, rpcReq *rpcRequest) (*rpcResponse, error) {
+	return &rpcResponse{Result: json.RawMessage(st.result)}, nil
+}
+
+func (st *staticTransport) close() {}
+
+func TestClefWalletBadInputs(t *testing.T) {
+
+	tc := newTestClef(t, 1)
+	ctx, w := newTestClefWallet(t, tc, false)
+
+	_, err := w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"bad"`)}, testChainID)
+	assert.Regexp(t, "bad address", err)
+
+	_, err = w.SignTypedDataV4(ctx, *tc.order[0], &eip712.TypedData{PrimaryType: "missing"})
+	assert.Regexp(t, "FF22073", err)
+
+}
+
+func TestClefIPCFailures(t *testing.T) {
+
+	tc := newTestClef(t, 1)
+	ctx, w := newTestClefWallet(t, tc, true)
+
+	ipc := w.transport.(*ipcTransport)
+
+	// Parameters that cannot be sent
+	err := w.call(ctx, nil, "account_signTransaction", map[bool]bool{true: true})
+	assert.Regexp(t, "FF22182", err)
+	assert.Nil(t, ipc.conn)
+
+	// Canceled while Clef is waiting for approval, after which the connection is re-established
+	block := make(chan struct{})
+	tc.mux.Lock()
+	tc.block = block
+	tc.mux.Unlock()
+	ctxTimeout, cancelCtx := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelCtx()
+	err = w.Refresh(ctxTimeout)
+	assert.Regexp(t, "FF22182", err)
+	assert.Nil(t, ipc.conn)
+	tc.mux.Lock()
+	tc.block = nil
+	tc.mux.Unlock()
+	close(block)
+	err = w.Refresh(ctx)
+	assert.NoError(t, err)
+	assert.NotNil(t, ipc.conn)
+
+	// Results that cannot be parsed
+	var accounts []*big.Int
+	err = w.call(ctx, &accounts, "account_list")
+	assert.Regexp(t, "FF22182", err)
+
+	// Clef not running
+	ipc.close()
+	ipc.path = filepath.Join(t.TempDir(), "missing.ipc")
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22182", err)
+
+}
+
+func TestClefHTTPFailures(t *testing.T) {
+
+	tc := newTestClef(t, 1)
+	ctx, w := newTestClefWallet(t, tc, false)
+	ht := w.transport.(*httpTransport)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	ht.client.SetBaseURL(server.URL)
+	err := w.Refresh(ctx)
+	assert.Regexp(t, "FF22182.*account_list.*502", err)
+
+	server.Close()
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22182.*account_list", err)
+
+}
+
+func TestClefWalletBadConfig(t *testing.T) {
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_clef_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set("tls.enabled", true)
+	unitTestConfig.Set("tls.caFile", "!!!")
+	_, err := ReadConfig(context.Background(), unitTestConfig)
+	assert.Error(t, err)
+
+}
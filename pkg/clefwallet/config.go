@@ -0,0 +1,50 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clefwallet
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+)
+
+const (
+	// ConfigIPCPath the path of Clef's IPC socket (clef.ipc), used instead of the URL when set
+	ConfigIPCPath = "ipcPath"
+)
+
+type Config struct {
+	HTTP    ffresty.Config // the URL is Clef's HTTP endpoint, such as http://localhost:8550
+	IPCPath string
+}
+
+func InitConfig(section config.Section) {
+	ffresty.InitConfig(section)
+	section.AddKnownKey(ConfigIPCPath)
+}
+
+func ReadConfig(ctx context.Context, section config.Section) (*Config, error) {
+	httpConf, err := ffresty.GenerateConfig(ctx, section)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		HTTP:    *httpConf,
+		IPCPath: section.GetString(ConfigIPCPath),
+	}, nil
+}
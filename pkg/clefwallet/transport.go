@@ -0,0 +1,147 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clefwallet
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+type rpcRequest struct {
+	JSONRpc string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+// transport sends a JSON/RPC request to Clef, and returns the response
+type transport interface {
+	roundTrip(ctx context.Context, rpcReq *rpcRequest) (*rpcResponse, error)
+	close()
+}
+
+type httpTransport struct {
+	client *resty.Client
+}
+
+func (ht *httpTransport) roundTrip(ctx context.Context, rpcReq *rpcRequest) (*rpcResponse, error) {
+	var rpcRes rpcResponse
+	res, err := ht.client.R().
+		SetContext(ctx).
+		SetBody(rpcReq).
+		SetResult(&rpcRes).
+		SetError(&rpcRes).
+		Post("")
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, signermsgs.MsgClefRequestFailed, rpcReq.Method, err)
+	}
+	if res.IsError() && rpcRes.Error == nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgClefRequestFailed, rpcReq.Method, res.Status())
+	}
+	return &rpcRes, nil
+}
+
+func (ht *httpTransport) close() {}
+
+// ipcTransport connects to Clef's IPC socket, which is a stream of JSON objects in each direction.
+// Requests are sent one at a time, as Clef processes the requests on a connection in order. The
+// connection is dialed on first use, and again after any failure.
+type ipcTransport struct {
+	path string
+	mux  sync.Mutex
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+func (it *ipcTransport) roundTrip(ctx context.Context, rpcReq *rpcRequest) (*rpcResponse, error) {
+	it.mux.Lock()
+	defer it.mux.Unlock()
+	rpcRes, err := it.exchange(ctx, rpcReq)
+	if err != nil {
+		it.closeConn()
+		return nil, i18n.WrapError(ctx, err, signermsgs.MsgClefRequestFailed, rpcReq.Method, err)
+	}
+	return rpcRes, nil
+}
+
+// must be called holding the mux
+func (it *ipcTransport) exchange(ctx context.Context, rpcReq *rpcRequest) (*rpcResponse, error) {
+	if it.conn == nil {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "unix", it.path)
+		if err != nil {
+			return nil, err
+		}
+		it.conn = conn
+		it.dec = json.NewDecoder(conn)
+	}
+	// Clef might be waiting for a user to approve the request, so there is no deadline unless the context has one
+	conn := it.conn
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(rpcReq); err != nil {
+		return nil, err
+	}
+	for {
+		var rpcRes rpcResponse
+		if err := it.dec.Decode(&rpcRes); err != nil {
+			return nil, err
+		}
+		// Skip anything that is not the response to this request
+		var id int64
+		if json.Unmarshal(rpcRes.ID, &id) == nil && id == rpcReq.ID {
+			return &rpcRes, nil
+		}
+	}
+}
+
+// must be called holding the mux
+func (it *ipcTransport) closeConn() {
+	if it.conn != nil {
+		_ = it.conn.Close()
+		it.conn = nil
+		it.dec = nil
+	}
+}
+
+func (it *ipcTransport) close() {
+	it.mux.Lock()
+	defer it.mux.Unlock()
+	it.closeConn()
+}
@@ -0,0 +1,342 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compositewallet combines several wallets behind one, such as a filesystem wallet and a cloud KMS
+// wallet, so one signer can sign for the accounts of all of them.
+package compositewallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// Member is one of the wallets combined by the composite wallet
+type Member struct {
+	Name   string // such as "fileWallet" - used in the precedence configuration, and in logs
+	Wallet ethsigner.Wallet
+}
+
+// Wallet combines the accounts of several wallets
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	ethsigner.AuthorizationWallet
+	// Members returns the wallets, in order of precedence
+	Members() []*Member
+	// RegisterMetrics registers the metrics of each wallet that has them
+	RegisterMetrics(ctx context.Context, registry metric.MetricsRegistry) error
+	// MemberHealth checks the health of every wallet in parallel, returning the result by wallet name (nil
+	// for each healthy wallet, including those that have no health check)
+	MemberHealth(ctx context.Context) map[string]error
+	// HealthCheck returns an error naming each wallet that failed its health check
+	HealthCheck(ctx context.Context) error
+}
+
+type member struct {
+	*Member
+	failedUntil time.Time // protected by the wallet's mux
+}
+
+// compositeWallet routes each request to the wallets that hold the address, in order of precedence. A wallet
+// that fails is moved to the back of the order for the retry delay, so requests fail over to any other wallet
+// holding the address (such as the same key in an HSM and in a backup keystore) until it has recovered.
+type compositeWallet struct {
+	members    []*member // in order of precedence
+	retryDelay time.Duration
+
+	mux         sync.Mutex
+	owners      map[ethtypes.Address0xHex][]*member // in order of precedence
+	addressList []*ethtypes.Address0xHex            // in order of precedence, then the order each wallet returns them
+}
+
+type metricsRegistrant interface {
+	RegisterMetrics(ctx context.Context, registry metric.MetricsRegistry) error
+}
+
+// NewCompositeWallet combines the wallets, ordered by the precedence configuration
+func NewCompositeWallet(ctx context.Context, conf *Config, members ...*Member) (Wallet, error) {
+	if len(members) == 0 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgNoWalletEnabled)
+	}
+	rank := make(map[string]int, len(conf.Precedence))
+	for i, name := range conf.Precedence {
+		rank[name] = i
+	}
+	w := &compositeWallet{
+		retryDelay: conf.RetryDelay,
+		owners:     make(map[ethtypes.Address0xHex][]*member),
+	}
+	byName := make(map[string]bool, len(members))
+	for _, m := range members {
+		if byName[m.Name] {
+			return nil, i18n.NewError(ctx, signermsgs.MsgCompositeWalletDuplicate, m.Name)
+		}
+		byName[m.Name] = true
+		w.members = append(w.members, &member{Member: m})
+	}
+	for _, name := range conf.Precedence {
+		if !byName[name] {
+			return nil, i18n.NewError(ctx, signermsgs.MsgCompositeWalletUnknown, name)
+		}
+	}
+	sort.SliceStable(w.members, func(i, j int) bool {
+		ri, iRanked := rank[w.members[i].Name]
+		rj, jRanked := rank[w.members[j].Name]
+		if iRanked && jRanked {
+			return ri < rj
+		}
+		return iRanked && !jRanked
+	})
+	return w, nil
+}
+
+func (w *compositeWallet) Members() []*Member {
+	members := make([]*Member, len(w.members))
+	for i, m := range w.members {
+		members[i] = m.Member
+	}
+	return members
+}
+
+func (w *compositeWallet) RegisterMetrics(ctx context.Context, registry metric.MetricsRegistry) error {
+	for _, m := range w.members {
+		if mr, ok := m.Wallet.(metricsRegistrant); ok {
+			if err := mr.RegisterMetrics(ctx, registry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *compositeWallet) MemberHealth(ctx context.Context) map[string]error {
+	results := make([]error, len(w.members))
+	var wg sync.WaitGroup
+	for i, m := range w.members {
+		wg.Add(1)
+		go func(i int, m *member) {
+			defer wg.Done()
+			results[i] = ethsigner.CheckWalletHealth(ctx, m.Wallet)
+		}(i, m)
+	}
+	wg.Wait()
+	health := make(map[string]error, len(w.members))
+	for i, m := range w.members {
+		health[m.Name] = results[i]
+	}
+	return health
+}
+
+func (w *compositeWallet) HealthCheck(ctx context.Context) error {
+	health := w.MemberHealth(ctx)
+	var failures []string
+	for _, m := range w.members {
+		if err := health[m.Name]; err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", m.Name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return i18n.NewError(ctx, signermsgs.MsgWalletsUnhealthy, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (w *compositeWallet) Initialize(ctx context.Context) error {
+	for _, m := range w.members {
+		if err := m.Wallet.Initialize(ctx); err != nil {
+			return err
+		}
+	}
+	return w.Refresh(ctx)
+}
+
+// Refresh refreshes every wallet, and rebuilds the index of the wallets that hold each address. A wallet that
+// fails keeps the accounts it had before, and is marked as failed - the refresh only fails if every wallet does.
+func (w *compositeWallet) Refresh(ctx context.Context) error {
+	accounts := make([][]*ethtypes.Address0xHex, len(w.members))
+	var lastErr error
+	failures := 0
+	for i, m := range w.members {
+		err := m.Wallet.Refresh(ctx)
+		if err == nil {
+			accounts[i], err = m.Wallet.GetAccounts(ctx)
+		}
+		if err != nil {
+			log.L(ctx).Warnf("Failed to refresh wallet %s: %s", m.Name, err)
+			w.markFailed(m)
+			lastErr = err
+			failures++
+		}
+	}
+	if failures == len(w.members) {
+		return lastErr
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	owners := make(map[ethtypes.Address0xHex][]*member)
+	addressList := []*ethtypes.Address0xHex{}
+	for i, m := range w.members {
+		memberAccounts := accounts[i]
+		if memberAccounts == nil {
+			// Keep the accounts from before the failure
+			for _, addr := range w.addressList {
+				for _, owner := range w.owners[*addr] {
+					if owner == m {
+						memberAccounts = append(memberAccounts, addr)
+					}
+				}
+			}
+		}
+		for _, addr := range memberAccounts {
+			if owners[*addr] == nil {
+				addressList = append(addressList, addr)
+			}
+			owners[*addr] = append(owners[*addr], m)
+		}
+	}
+	w.owners = owners
+	w.addressList = addressList
+	return nil
+}
+
+func (w *compositeWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+func (w *compositeWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *compositeWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) (signed []byte, err error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	err = w.withOwner(ctx, from, func(m *member) (err error) {
+		signed, err = ethsigner.SignWithWallet(ctx, m.Wallet, txn, chainID)
+		return err
+	})
+	return signed, err
+}
+
+func (w *compositeWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (result *ethsigner.EIP712Result, err error) {
+	err = w.withOwner(ctx, from, func(m *member) (err error) {
+		typedDataWallet, ok := m.Wallet.(ethsigner.WalletTypedData)
+		if !ok {
+			return i18n.NewError(ctx, signermsgs.MsgTypedDataNotSupported)
+		}
+		result, err = typedDataWallet.SignTypedDataV4(ctx, from, payload)
+		return err
+	})
+	return result, err
+}
+
+func (w *compositeWallet) SignAuthorization(ctx context.Context, from ethtypes.Address0xHex, auth *ethsigner.Authorization) error {
+	return w.withOwner(ctx, from, func(m *member) error {
+		authWallet, ok := m.Wallet.(ethsigner.AuthorizationWallet)
+		if !ok {
+			return i18n.NewError(ctx, signermsgs.MsgAuthorizationNotSupported)
+		}
+		return authWallet.SignAuthorization(ctx, from, auth)
+	})
+}
+
+// withOwner calls the function with each wallet that holds the address, until one succeeds. Wallets that have
+// not failed recently are tried first, in order of precedence. An address that is not in the index is offered
+// to every wallet, as some wallets sign for keys they have not listed (such as a filesystem wallet that looks
+// up keys by filename).
+func (w *compositeWallet) withOwner(ctx context.Context, addr ethtypes.Address0xHex, fn func(m *member) error) error {
+	var lastErr error
+	for _, m := range w.candidates(addr) {
+		err := fn(m)
+		switch {
+		case err == nil:
+			return nil
+		case isNotHeld(err):
+			// The wallet does not have the key, or cannot sign this way with it
+			if lastErr == nil {
+				lastErr = err
+			}
+		default:
+			log.L(ctx).Warnf("Wallet %s failed for %s: %s", m.Name, addr, err)
+			w.markFailed(m)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (w *compositeWallet) candidates(addr ethtypes.Address0xHex) []*member {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	owners, indexed := w.owners[addr]
+	if !indexed {
+		owners = w.members
+	}
+	now := time.Now()
+	candidates := make([]*member, 0, len(owners))
+	var failed []*member
+	for _, m := range owners {
+		if now.Before(m.failedUntil) {
+			failed = append(failed, m)
+		} else {
+			candidates = append(candidates, m)
+		}
+	}
+	return append(candidates, failed...)
+}
+
+func (w *compositeWallet) markFailed(m *member) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	m.failedUntil = time.Now().Add(w.retryDelay)
+}
+
+func isNotHeld(err error) bool {
+	var ffe i18n.FFError
+	return errors.As(err, &ffe) && (ffe.MessageKey() == signermsgs.MsgWalletNotAvailable || ffe.MessageKey() == signermsgs.MsgTypedDataNotSupported ||
+		ffe.MessageKey() == signermsgs.MsgAuthorizationNotSupported)
+}
+
+func (w *compositeWallet) Close() error {
+	var firstErr error
+	for _, m := range w.members {
+		if err := m.Wallet.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
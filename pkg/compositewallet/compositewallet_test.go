@@ -0,0 +1,396 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compositewallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/memwallet"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testKey1  = "0xac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+	testKey2  = "0x59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d"
+	testKey3  = "0x5de4111afa1a4b94908f83103eb1f1706367c2e68ca870fc3fb9a804cdab365a"
+	testAddr1 = "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"
+	testAddr2 = "0x70997970c51812dc3a010c7d01b50e0d17dc79c8"
+	testAddr3 = "0x3c44cdddb6a900fa2b585dd299e03d12fa4293bc"
+)
+
+// testWallet is a memwallet that can be made to fail, and counts the signing requests it receives
+type testWallet struct {
+	memwallet.Wallet
+	fail     error
+	unlisted bool // signs for its keys, without listing them in GetAccounts
+	signs    int
+	closed   bool
+	metrics  bool
+}
+
+func newTestWallet(t *testing.T, hexKeys ...string) *testWallet {
+	w, err := memwallet.NewFromHexKeys(context.Background(), hexKeys...)
+	assert.NoError(t, err)
+	return &testWallet{Wallet: w}
+}
+
+func (w *testWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	w.signs++
+	if w.fail != nil {
+		return nil, w.fail
+	}
+	return w.Wallet.SignBig(ctx, txn, chainID)
+}
+
+func (w *testWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	w.signs++
+	if w.fail != nil {
+		return nil, w.fail
+	}
+	return w.Wallet.SignTypedDataV4(ctx, from, payload)
+}
+
+func (w *testWallet) SignAuthorization(ctx context.Context, from ethtypes.Address0xHex, auth *ethsigner.Authorization) error {
+	w.signs++
+	if w.fail != nil {
+		return w.fail
+	}
+	return w.Wallet.SignAuthorization(ctx, from, auth)
+}
+
+func (w *testWallet) Initialize(_ context.Context) error {
+	return w.fail
+}
+
+func (w *testWallet) GetAccounts(ctx context.Context) ([]*ethtypes.Address0xHex, error) {
+	if w.fail != nil {
+		return nil, w.fail
+	}
+	if w.unlisted {
+		return []*ethtypes.Address0xHex{}, nil
+	}
+	return w.Wallet.GetAccounts(ctx)
+}
+
+func (w *testWallet) Close() error {
+	w.closed = true
+	return w.fail
+}
+
+func (w *testWallet) RegisterMetrics(_ context.Context, _ metric.MetricsRegistry) error {
+	w.metrics = true
+	return w.fail
+}
+
+func (w *testWallet) HealthCheck(_ context.Context) error {
+	return w.fail
+}
+
+// signOnlyWallet does not support typed data or authorizations
+type signOnlyWallet struct {
+	ethsigner.Wallet
+}
+
+func newTestComposite(t *testing.T, precedence []string, members ...*Member) Wallet {
+	w, err := NewCompositeWallet(context.Background(), &Config{Precedence: precedence, RetryDelay: 1 * time.Minute}, members...)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Initialize(context.Background()))
+	return w
+}
+
+func signFrom(ctx context.Context, w Wallet, addr string) ([]byte, error) {
+	return w.Sign(ctx, &ethsigner.Transaction{
+		From:     json.RawMessage(fmt.Sprintf(`"%s"`, addr)),
+		Nonce:    ethtypes.NewHexInteger64(0),
+		GasLimit: ethtypes.NewHexInteger64(21000),
+	}, 1337)
+}
+
+func TestConfig(t *testing.T) {
+
+	config.RootConfigReset()
+	section := config.RootSection("compositeWallet")
+	InitConfig(section)
+	section.Set(ConfigPrecedence, []string{"vaultWallet", "fileWallet"})
+	conf := ReadConfig(section)
+	assert.Equal(t, []string{"vaultWallet", "fileWallet"}, conf.Precedence)
+	assert.Equal(t, 30*time.Second, conf.RetryDelay)
+
+}
+
+func TestPrecedenceAndAccounts(t *testing.T) {
+
+	ctx := context.Background()
+	a, b, c := newTestWallet(t, testKey1), newTestWallet(t, testKey2, testKey1), newTestWallet(t, testKey3)
+	w := newTestComposite(t, []string{"b", "c"},
+		&Member{Name: "a", Wallet: a},
+		&Member{Name: "b", Wallet: b},
+		&Member{Name: "c", Wallet: c},
+	)
+
+	members := w.Members()
+	assert.Equal(t, "b", members[0].Name)
+	assert.Equal(t, "c", members[1].Name)
+	assert.Equal(t, "a", members[2].Name)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{
+		ethtypes.MustNewAddress(testAddr2),
+		ethtypes.MustNewAddress(testAddr1),
+		ethtypes.MustNewAddress(testAddr3),
+	}, accounts)
+
+	// Routed to the first wallet that holds each address
+	for _, addr := range []string{testAddr1, testAddr2, testAddr3} {
+		raw, err := signFrom(ctx, w, addr)
+		assert.NoError(t, err)
+		signer, _, err := ethsigner.RecoverRawTransaction(ctx, raw, 1337)
+		assert.NoError(t, err)
+		assert.Equal(t, addr, signer.String())
+	}
+	assert.Equal(t, 0, a.signs)
+	assert.Equal(t, 2, b.signs)
+	assert.Equal(t, 1, c.signs)
+
+	_, err = signFrom(ctx, w, "0x0000000000000000000000000000000000000001")
+	assert.Regexp(t, "FF22014", err)
+
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"bad"`)}, 1337)
+	assert.Regexp(t, "bad address", err)
+
+}
+
+func TestFailover(t *testing.T) {
+
+	ctx := context.Background()
+	primary, backup := newTestWallet(t, testKey1), newTestWallet(t, testKey1)
+	w := newTestComposite(t, nil,
+		&Member{Name: "primary", Wallet: primary},
+		&Member{Name: "backup", Wallet: backup},
+	)
+
+	primary.fail = fmt.Errorf("pop")
+	_, err := signFrom(ctx, w, testAddr1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, primary.signs)
+	assert.Equal(t, 1, backup.signs)
+
+	// The failed wallet is tried last until the retry delay has passed
+	primary.fail = nil
+	_, err = signFrom(ctx, w, testAddr1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, primary.signs)
+	assert.Equal(t, 2, backup.signs)
+
+	w.(*compositeWallet).members[0].failedUntil = time.Now()
+	_, err = signFrom(ctx, w, testAddr1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, primary.signs)
+
+	// When all fail, the error from the last one tried is returned
+	primary.fail = fmt.Errorf("pop1")
+	backup.fail = fmt.Errorf("pop2")
+	_, err = signFrom(ctx, w, testAddr1)
+	assert.Regexp(t, "pop2", err)
+
+}
+
+func TestUnlistedAddress(t *testing.T) {
+
+	ctx := context.Background()
+	a, b := newTestWallet(t, testKey1), newTestWallet(t, testKey2)
+	b.unlisted = true
+	w := newTestComposite(t, nil, &Member{Name: "a", Wallet: a}, &Member{Name: "b", Wallet: b})
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 1)
+
+	// Offered to each wallet in turn, skipping those that do not have it
+	_, err = signFrom(ctx, w, testAddr2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, a.signs)
+	assert.Equal(t, 1, b.signs)
+
+}
+
+func TestRefreshPartialFailure(t *testing.T) {
+
+	ctx := context.Background()
+	a, b := newTestWallet(t, testKey1), newTestWallet(t, testKey2)
+	w := newTestComposite(t, nil, &Member{Name: "a", Wallet: a}, &Member{Name: "b", Wallet: b})
+
+	// The accounts of a wallet that fails to refresh are kept
+	b.fail = fmt.Errorf("pop")
+	assert.NoError(t, w.Refresh(ctx))
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 2)
+
+	a.fail = fmt.Errorf("pop")
+	assert.Regexp(t, "pop", w.Refresh(ctx))
+
+}
+
+func TestInitializeFail(t *testing.T) {
+
+	a := newTestWallet(t, testKey1)
+	a.fail = fmt.Errorf("pop")
+	w, err := NewCompositeWallet(context.Background(), &Config{}, &Member{Name: "a", Wallet: a})
+	assert.NoError(t, err)
+	assert.Regexp(t, "pop", w.Initialize(context.Background()))
+
+	b, err := memwallet.NewFromHexKeys(context.Background(), testKey1)
+	assert.NoError(t, err)
+	assert.NoError(t, b.Close())
+	w, err = NewCompositeWallet(context.Background(), &Config{}, &Member{Name: "b", Wallet: &signOnlyWallet{Wallet: b}})
+	assert.NoError(t, err)
+	assert.Regexp(t, "FF22103", w.Initialize(context.Background()))
+
+}
+
+func TestSignTypedData(t *testing.T) {
+
+	ctx := context.Background()
+	signOnly, err := memwallet.NewFromHexKeys(ctx, testKey1)
+	assert.NoError(t, err)
+	typed := newTestWallet(t, testKey1)
+	w := newTestComposite(t, nil,
+		&Member{Name: "signOnly", Wallet: &signOnlyWallet{Wallet: signOnly}},
+		&Member{Name: "typed", Wallet: typed},
+	)
+
+	result, err := w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(testAddr1), &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.NoError(t, err)
+	assert.Len(t, result.SignatureRSV, 65)
+	assert.Equal(t, 1, typed.signs)
+
+	typed.fail = fmt.Errorf("pop")
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(testAddr1), &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "pop", err)
+
+	w = newTestComposite(t, nil, &Member{Name: "signOnly", Wallet: &signOnlyWallet{Wallet: signOnly}})
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(testAddr1), &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22143", err)
+
+}
+
+func TestSignAuthorization(t *testing.T) {
+
+	ctx := context.Background()
+	signOnly, err := memwallet.NewFromHexKeys(ctx, testKey1)
+	assert.NoError(t, err)
+	authWallet := newTestWallet(t, testKey1)
+	w := newTestComposite(t, nil,
+		&Member{Name: "signOnly", Wallet: &signOnlyWallet{Wallet: signOnly}},
+		&Member{Name: "auth", Wallet: authWallet},
+	)
+
+	auth := &ethsigner.Authorization{ChainID: ethtypes.NewHexInteger64(1337)}
+	err = w.SignAuthorization(ctx, *ethtypes.MustNewAddress(testAddr1), auth)
+	assert.NoError(t, err)
+	authority, err := auth.RecoverAuthority()
+	assert.NoError(t, err)
+	assert.Equal(t, testAddr1, authority.String())
+	assert.Equal(t, 1, authWallet.signs)
+
+	authWallet.fail = fmt.Errorf("pop")
+	err = w.SignAuthorization(ctx, *ethtypes.MustNewAddress(testAddr1), auth)
+	assert.Regexp(t, "pop", err)
+
+	w = newTestComposite(t, nil, &Member{Name: "signOnly", Wallet: &signOnlyWallet{Wallet: signOnly}})
+	err = w.SignAuthorization(ctx, *ethtypes.MustNewAddress(testAddr1), auth)
+	assert.Regexp(t, "FF22247", err)
+
+}
+
+func TestNewCompositeWalletErrors(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := NewCompositeWallet(ctx, &Config{})
+	assert.Regexp(t, "FF22017", err)
+
+	a := newTestWallet(t, testKey1)
+	_, err = NewCompositeWallet(ctx, &Config{}, &Member{Name: "a", Wallet: a}, &Member{Name: "a", Wallet: a})
+	assert.Regexp(t, "FF22175", err)
+
+	_, err = NewCompositeWallet(ctx, &Config{Precedence: []string{"b"}}, &Member{Name: "a", Wallet: a})
+	assert.Regexp(t, "FF22176", err)
+
+}
+
+func TestRegisterMetricsAndClose(t *testing.T) {
+
+	ctx := context.Background()
+	signOnly, err := memwallet.NewFromHexKeys(ctx, testKey2)
+	assert.NoError(t, err)
+	a, b := newTestWallet(t, testKey1), newTestWallet(t, testKey3)
+	w := newTestComposite(t, nil,
+		&Member{Name: "a", Wallet: a},
+		&Member{Name: "signOnly", Wallet: &signOnlyWallet{Wallet: signOnly}},
+		&Member{Name: "b", Wallet: b},
+	)
+
+	assert.NoError(t, w.RegisterMetrics(ctx, metric.NewPrometheusMetricsRegistry("test")))
+	assert.True(t, a.metrics)
+	assert.True(t, b.metrics)
+
+	a.fail = fmt.Errorf("pop1")
+	b.fail = fmt.Errorf("pop2")
+	assert.Regexp(t, "pop1", w.RegisterMetrics(ctx, metric.NewPrometheusMetricsRegistry("test")))
+	assert.Regexp(t, "pop1", w.Close())
+	assert.True(t, a.closed)
+	assert.True(t, b.closed)
+
+}
+
+func TestHealthCheck(t *testing.T) {
+
+	ctx := context.Background()
+	signOnly, err := memwallet.NewFromHexKeys(ctx, testKey2)
+	assert.NoError(t, err)
+	a, b := newTestWallet(t, testKey1), newTestWallet(t, testKey3)
+	w := newTestComposite(t, []string{"b"},
+		&Member{Name: "a", Wallet: a},
+		&Member{Name: "signOnly", Wallet: &signOnlyWallet{Wallet: signOnly}},
+		&Member{Name: "b", Wallet: b},
+	)
+
+	assert.NoError(t, w.HealthCheck(ctx))
+	assert.Equal(t, map[string]error{"a": nil, "signOnly": nil, "b": nil}, w.MemberHealth(ctx))
+
+	a.fail = fmt.Errorf("pop1")
+	b.fail = fmt.Errorf("pop2")
+	health := w.MemberHealth(ctx)
+	assert.Regexp(t, "pop1", health["a"])
+	assert.Regexp(t, "pop2", health["b"])
+	assert.NoError(t, health["signOnly"])
+	// In order of precedence
+	assert.Regexp(t, "FF22221.*b: pop2; a: pop1", w.HealthCheck(ctx))
+
+}
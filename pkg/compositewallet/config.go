@@ -0,0 +1,51 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compositewallet
+
+import (
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+)
+
+const (
+	// ConfigPrecedence the names of the wallets in the order they are preferred, for addresses held by more than one wallet
+	ConfigPrecedence = "precedence"
+	// ConfigRetryDelay how long a wallet that failed is only used if no other wallet holding the address is available
+	ConfigRetryDelay = "retryDelay"
+)
+
+const (
+	defaultRetryDelay = "30s"
+)
+
+type Config struct {
+	Precedence []string // wallets not listed follow those that are, in the order they are supplied
+	RetryDelay time.Duration
+}
+
+func InitConfig(section config.Section) {
+	section.AddKnownKey(ConfigPrecedence)
+	section.AddKnownKey(ConfigRetryDelay, defaultRetryDelay)
+}
+
+func ReadConfig(section config.Section) *Config {
+	return &Config{
+		Precedence: section.GetStringSlice(ConfigPrecedence),
+		RetryDelay: section.GetDuration(ConfigRetryDelay),
+	}
+}
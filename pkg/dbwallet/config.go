@@ -0,0 +1,102 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbwallet
+
+import (
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+)
+
+const (
+	// ListenerNone do not detect keys added while running - only those found by Initialize (or looked up on first use) are indexed
+	ListenerNone = "none"
+	// ListenerPoll re-query the table for new keys at the poll interval
+	ListenerPoll = "poll"
+	// ListenerNotify re-query the table when a PostgreSQL notification is received on the channel, such as from a trigger on insert
+	ListenerNotify = "notify"
+)
+
+const (
+	// ConfigDriver the name of the database/sql driver - postgres is built in, and programs embedding the wallet can register others
+	ConfigDriver = "driver"
+	// ConfigURL the data source name passed to the driver
+	ConfigURL = "url"
+	// ConfigTable the table holding a row for each key, with address, keystore and metadata columns
+	ConfigTable = "table"
+	// ConfigDefaultPasswordFile the password file for keys that do not have a passwordFile in their metadata
+	ConfigDefaultPasswordFile = "defaultPasswordFile"
+	// ConfigListenerType how keys added while running are detected - supported: poll (default) / notify / none
+	ConfigListenerType = "listener.type"
+	// ConfigListenerPollInterval how often the table is queried for new keys, with the poll listener
+	ConfigListenerPollInterval = "listener.pollInterval"
+	// ConfigListenerChannel the PostgreSQL notification channel to LISTEN on, with the notify listener
+	ConfigListenerChannel = "listener.channel"
+	// ConfigListenerReconnectDelay the delay before re-establishing a failed notify listener connection
+	ConfigListenerReconnectDelay = "listener.reconnectDelay"
+	// ConfigSignerCacheSize the number of signing keys to keep in memory
+	ConfigSignerCacheSize = "signerCacheSize"
+	// ConfigSignerCacheTTL the time to keep an unused signing key in memory
+	ConfigSignerCacheTTL = "signerCacheTTL"
+)
+
+type Config struct {
+	Driver              string
+	URL                 string
+	Table               string
+	DefaultPasswordFile string
+	Listener            ListenerConfig
+	SignerCacheSize     string
+	SignerCacheTTL      time.Duration
+}
+
+type ListenerConfig struct {
+	Type           string
+	PollInterval   time.Duration
+	Channel        string
+	ReconnectDelay time.Duration
+}
+
+func InitConfig(section config.Section) {
+	section.AddKnownKey(ConfigDriver, "postgres")
+	section.AddKnownKey(ConfigURL)
+	section.AddKnownKey(ConfigTable, "ffsigner_keys")
+	section.AddKnownKey(ConfigDefaultPasswordFile)
+	section.AddKnownKey(ConfigListenerType, ListenerPoll)
+	section.AddKnownKey(ConfigListenerPollInterval, "30s")
+	section.AddKnownKey(ConfigListenerChannel, "ffsigner_keys")
+	section.AddKnownKey(ConfigListenerReconnectDelay, "5s")
+	section.AddKnownKey(ConfigSignerCacheSize, 250)
+	section.AddKnownKey(ConfigSignerCacheTTL, "24h")
+}
+
+func ReadConfig(section config.Section) *Config {
+	return &Config{
+		Driver:              section.GetString(ConfigDriver),
+		URL:                 section.GetString(ConfigURL),
+		Table:               section.GetString(ConfigTable),
+		DefaultPasswordFile: section.GetString(ConfigDefaultPasswordFile),
+		Listener: ListenerConfig{
+			Type:           section.GetString(ConfigListenerType),
+			PollInterval:   section.GetDuration(ConfigListenerPollInterval),
+			Channel:        section.GetString(ConfigListenerChannel),
+			ReconnectDelay: section.GetDuration(ConfigListenerReconnectDelay),
+		},
+		SignerCacheSize: section.GetString(ConfigSignerCacheSize),
+		SignerCacheTTL:  section.GetDuration(ConfigSignerCacheTTL),
+	}
+}
@@ -0,0 +1,549 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dbwallet signs with keystore V3 keys held in a SQL database, so replicas can share one wallet
+// without a shared (RWX) filesystem.
+package dbwallet
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/karlseguin/ccache"
+	"github.com/lib/pq"
+	"golang.org/x/sync/singleflight"
+)
+
+// Wallet signs with keys held in a database table, with a row for each key:
+//
+//	CREATE TABLE ffsigner_keys (
+//	    address  VARCHAR(42) PRIMARY KEY, -- lower case, with the 0x prefix
+//	    keystore TEXT NOT NULL,           -- the keystore V3 JSON
+//	    metadata TEXT                     -- optional JSON object, such as {"passwordFile":"/secrets/key1.pwd"}
+//	);
+//
+// The password for each key is read from the passwordFile in its metadata, or the default password file.
+// Keys are loaded into a signer cache on first use, as for the filesystem wallet.
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	GetWalletFile(ctx context.Context, addr ethtypes.Address0xHex) (keystorev3.WalletFile, error)
+	// GetAccountMetadata returns the parsed metadata column for the address, without loading the key.
+	// Returns nil if the row has no metadata
+	GetAccountMetadata(ctx context.Context, addr ethtypes.Address0xHex) (map[string]interface{}, error)
+	// AddListener registers a channel to be sent each new address, in the order they are indexed. Keys added
+	// while running are found by the listener (poll or notify), and a listener that does not keep up delays
+	// finding them
+	AddListener(listener chan<- ethtypes.Address0xHex)
+	// RemoveListener stops notifications to a channel registered with AddListener. Once it returns, nothing
+	// more is sent to the channel. The channel is not closed.
+	RemoveListener(listener chan<- ethtypes.Address0xHex)
+	// ListAccounts returns a page of the indexed accounts, in the order they were indexed (address order for
+	// the accounts found by Initialize)
+	ListAccounts(ctx context.Context, skip, limit int) ([]*ethtypes.Address0xHex, error)
+	// AccountCount returns the number of accounts indexed so far
+	AccountCount(ctx context.Context) (int, error)
+	// Refresh queries the table, indexing any keys that have not been seen before
+	Refresh(ctx context.Context) error
+	// InvalidateCache removes any cached key for the address, so it is re-read from the database on next use
+	InvalidateCache(ctx context.Context, addr ethtypes.Address0xHex)
+	// HealthCheck returns an error if the database cannot be reached
+	HealthCheck(ctx context.Context) error
+}
+
+// notificationListener is the subset of pq.Listener used by the notify listener
+type notificationListener interface {
+	Listen(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Close() error
+}
+
+var newNotificationListener = newPQListener
+
+func newPQListener(conf *Config, eventCallback pq.EventCallbackType) notificationListener {
+	return pq.NewListener(conf.URL, conf.Listener.ReconnectDelay, conf.Listener.ReconnectDelay, eventCallback)
+}
+
+var tableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+type dbWallet struct {
+	conf          Config
+	db            *sql.DB
+	listSQL       string
+	getSQL        string
+	signerCache   *ccache.Cache
+	inflightLoads singleflight.Group
+	listenerCtx   context.Context
+	cancelCtx     context.CancelFunc
+	listenerDone  chan struct{} // set when Initialize starts the listener, and closed when it exits - guarded by the mux
+	closeMux      sync.RWMutex  // held for read while using the signer cache, so it is not used after Close stops it
+	closed        bool
+
+	refreshMux sync.Mutex // serializes refreshes, so listeners are notified in the order addresses are indexed
+
+	mux         sync.Mutex
+	addresses   map[ethtypes.Address0xHex]bool
+	addressList []*ethtypes.Address0xHex // ordered list in query order, then the order keys were found (append only)
+	listeners   []*addressListener
+	cachedKeys  map[*cachedKey]bool // keys loaded into the signer cache, so they can be zeroed on Close
+}
+
+type addressListener struct {
+	ch      chan<- ethtypes.Address0xHex
+	removed chan struct{} // closed when the listener is removed, to stop a blocked notification
+}
+
+// cachedKey is a key pair in the signer cache, which is zeroed when it is evicted. Signers take
+// a copy of the key pair, so a key evicted while in use is not zeroed under them.
+type cachedKey struct {
+	mux     sync.Mutex
+	keypair *secp256k1.KeyPair
+}
+
+func NewDBWallet(ctx context.Context, conf *Config) (Wallet, error) {
+	if !tableNameRegex.MatchString(conf.Table) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgDBWalletBadTable, conf.Table)
+	}
+	switch conf.Listener.Type {
+	case ListenerNone, ListenerPoll:
+	case ListenerNotify:
+		if conf.Driver != "postgres" {
+			return nil, i18n.NewError(ctx, signermsgs.MsgDBWalletNotifyNotSupported, conf.Driver)
+		}
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgDBWalletUnknownListener, conf.Listener.Type)
+	}
+	db, err := sql.Open(conf.Driver, conf.URL)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgDBWalletOpenFailed, conf.Driver, err)
+	}
+	// PostgreSQL numbers its placeholders, where most other databases use ?
+	placeholder := "?"
+	if conf.Driver == "postgres" || conf.Driver == "pgx" {
+		placeholder = "$1"
+	}
+	w := &dbWallet{
+		conf:       *conf,
+		db:         db,
+		listSQL:    fmt.Sprintf("SELECT address FROM %s ORDER BY address", conf.Table),
+		getSQL:     fmt.Sprintf("SELECT keystore, metadata FROM %s WHERE address = %s", conf.Table, placeholder),
+		addresses:  make(map[ethtypes.Address0xHex]bool),
+		cachedKeys: make(map[*cachedKey]bool),
+	}
+	w.listenerCtx, w.cancelCtx = context.WithCancel(log.WithLogField(context.Background(), "wallet", "db"))
+	w.signerCache = ccache.New(
+		// We use a LRU cache with a size-aware max
+		ccache.Configure().
+			MaxSize(fftypes.ParseToByteSize(conf.SignerCacheSize)).
+			OnDelete(func(item *ccache.Item) {
+				w.destroyKey(item.Value().(*cachedKey))
+			}),
+	)
+	return w, nil
+}
+
+// Initialize indexes the keys in the table, and starts the listener for keys added while running
+func (w *dbWallet) Initialize(ctx context.Context) error {
+	if err := w.Refresh(ctx); err != nil {
+		return err
+	}
+	switch w.conf.Listener.Type {
+	case ListenerPoll:
+		go w.pollLoop(w.startListener())
+	case ListenerNotify:
+		listener := newNotificationListener(&w.conf, func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.L(w.listenerCtx).Warnf("Notification listener connection error (event=%d): %s", event, err)
+			}
+		})
+		if err := listener.Listen(w.conf.Listener.Channel); err != nil {
+			_ = listener.Close()
+			return i18n.NewError(ctx, signermsgs.MsgDBWalletQueryFailed, err)
+		}
+		go w.notifyLoop(listener, w.startListener())
+	}
+	return nil
+}
+
+func (w *dbWallet) startListener() chan struct{} {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.listenerDone = make(chan struct{})
+	return w.listenerDone
+}
+
+func (w *dbWallet) pollLoop(done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(w.conf.Listener.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.listenerCtx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Refresh(w.listenerCtx); err != nil {
+				log.L(w.listenerCtx).Errorf("Failed to poll for new keys: %s", err)
+			}
+		}
+	}
+}
+
+// notifyLoop refreshes on every notification. The listener reconnects automatically after a failure, and then
+// sends a nil notification - so we refresh then too, in case a notification was missed while disconnected.
+func (w *dbWallet) notifyLoop(listener notificationListener, done chan struct{}) {
+	defer close(done)
+	defer func() { _ = listener.Close() }()
+	for {
+		select {
+		case <-w.listenerCtx.Done():
+			return
+		case <-listener.NotificationChannel():
+			if err := w.Refresh(w.listenerCtx); err != nil {
+				log.L(w.listenerCtx).Errorf("Failed to refresh keys after notification: %s", err)
+			}
+		}
+	}
+}
+
+func (w *dbWallet) Refresh(ctx context.Context) error {
+	w.refreshMux.Lock()
+	defer w.refreshMux.Unlock()
+	rows, err := w.db.QueryContext(ctx, w.listSQL)
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgDBWalletQueryFailed, err)
+	}
+	defer rows.Close()
+	var found []*ethtypes.Address0xHex
+	for rows.Next() {
+		var addrString string
+		if err := rows.Scan(&addrString); err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgDBWalletQueryFailed, err)
+		}
+		addr, err := ethtypes.NewAddress(addrString)
+		if err != nil {
+			log.L(ctx).Warnf("Ignoring row with invalid address '%s': %s", addrString, err)
+			continue
+		}
+		found = append(found, addr)
+	}
+	if err := rows.Err(); err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgDBWalletQueryFailed, err)
+	}
+
+	w.mux.Lock()
+	var added []*ethtypes.Address0xHex
+	for _, addr := range found {
+		if !w.addresses[*addr] {
+			log.L(ctx).Debugf("Added address: %s", addr)
+			w.addresses[*addr] = true
+			w.addressList = append(w.addressList, addr)
+			added = append(added, addr)
+		}
+	}
+	listeners := make([]*addressListener, len(w.listeners))
+	copy(listeners, w.listeners)
+	w.mux.Unlock()
+
+	w.notifyListeners(listeners, added)
+	return nil
+}
+
+// notifyListeners sends the new addresses to each listener in turn, until it is removed or the wallet is closed.
+// Called holding the refreshMux.
+// HealthCheck pings the database, re-establishing a connection if needed
+func (w *dbWallet) HealthCheck(ctx context.Context) error {
+	if err := w.db.PingContext(ctx); err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgDBWalletQueryFailed, err)
+	}
+	return nil
+}
+
+func (w *dbWallet) notifyListeners(listeners []*addressListener, added []*ethtypes.Address0xHex) {
+	for _, l := range listeners {
+	addresses:
+		for _, addr := range added {
+			select {
+			case l.ch <- *addr:
+			case <-l.removed:
+				break addresses
+			case <-w.listenerCtx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (w *dbWallet) AddListener(listener chan<- ethtypes.Address0xHex) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.listeners = append(w.listeners, &addressListener{ch: listener, removed: make(chan struct{})})
+}
+
+func (w *dbWallet) RemoveListener(listener chan<- ethtypes.Address0xHex) {
+	w.mux.Lock()
+	listeners := make([]*addressListener, 0, len(w.listeners))
+	for _, l := range w.listeners {
+		if l.ch == listener {
+			close(l.removed)
+		} else {
+			listeners = append(listeners, l)
+		}
+	}
+	w.listeners = listeners
+	w.mux.Unlock()
+	// Wait for any notification in progress to see the listener is removed
+	w.refreshMux.Lock()
+	defer w.refreshMux.Unlock()
+}
+
+// GetAccounts returns the currently cached list of known addresses
+func (w *dbWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+// ListAccounts returns a page of the currently cached list of known addresses. A limit
+// of zero or less returns all accounts after the skip.
+func (w *dbWallet) ListAccounts(_ context.Context, skip, limit int) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if skip < 0 {
+		skip = 0
+	}
+	if skip >= len(w.addressList) {
+		return []*ethtypes.Address0xHex{}, nil
+	}
+	end := len(w.addressList)
+	if limit > 0 && skip+limit < end {
+		end = skip + limit
+	}
+	accounts := make([]*ethtypes.Address0xHex, end-skip)
+	copy(accounts, w.addressList[skip:end])
+	return accounts, nil
+}
+
+func (w *dbWallet) AccountCount(_ context.Context) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return len(w.addressList), nil
+}
+
+func (w *dbWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *dbWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	keypair, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return txn.SignBig(keypair, chainID)
+}
+
+func (w *dbWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	keypair, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return ethsigner.SignTypedDataV4(ctx, keypair, payload)
+}
+
+// getSignerForAddr returns a copy of the key pair for the address, which the caller destroys once it has
+// finished signing. Loads are de-duplicated, so concurrent requests for a key not in the cache read it once.
+func (w *dbWallet) getSignerForAddr(ctx context.Context, addr ethtypes.Address0xHex) (*secp256k1.KeyPair, error) {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+	if w.closed {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	addrString := addr.String()
+	for {
+		if item := w.signerCache.Get(addrString); item != nil && !item.Expired() {
+			item.Extend(w.conf.SignerCacheTTL)
+			if keypair := item.Value().(*cachedKey).copy(); keypair != nil {
+				return keypair, nil
+			}
+		}
+		res, err, _ := w.inflightLoads.Do(addrString, func() (interface{}, error) {
+			wf, err := w.GetWalletFile(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			ck := &cachedKey{keypair: wf.KeyPair()}
+			w.mux.Lock()
+			w.cachedKeys[ck] = true
+			w.mux.Unlock()
+			w.signerCache.Set(addrString, ck, w.conf.SignerCacheTTL)
+			log.L(ctx).Infof("Loaded signing key for address: %s", addr)
+			return ck, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The key is only nil if it was evicted and zeroed already, in which case we load it again
+		if keypair := res.(*cachedKey).copy(); keypair != nil {
+			return keypair, nil
+		}
+	}
+}
+
+// getRow reads the keystore and metadata for the address. The row is read even if the address is not yet
+// indexed, so a key can be used before the listener finds it.
+func (w *dbWallet) getRow(ctx context.Context, addr ethtypes.Address0xHex) ([]byte, map[string]interface{}, error) {
+	var keystore string
+	var metadataString sql.NullString
+	err := w.db.QueryRowContext(ctx, w.getSQL, addr.String()).Scan(&keystore, &metadataString)
+	if err == sql.ErrNoRows {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+	}
+	if err != nil {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgDBWalletQueryFailed, err)
+	}
+	var metadata map[string]interface{}
+	if metadataString.Valid && metadataString.String != "" {
+		if err := json.Unmarshal([]byte(metadataString.String), &metadata); err != nil {
+			return nil, nil, i18n.NewError(ctx, signermsgs.MsgDBWalletKeyInvalid, addr, err)
+		}
+	}
+	return []byte(keystore), metadata, nil
+}
+
+func (w *dbWallet) GetAccountMetadata(ctx context.Context, addr ethtypes.Address0xHex) (map[string]interface{}, error) {
+	_, metadata, err := w.getRow(ctx, addr)
+	return metadata, err
+}
+
+// GetWalletFile reads and decrypts the keystore for the address, with the password from the file in its
+// metadata (or the default password file)
+func (w *dbWallet) GetWalletFile(ctx context.Context, addr ethtypes.Address0xHex) (keystorev3.WalletFile, error) {
+	keystore, metadata, err := w.getRow(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	passwordFile, _ := metadata["passwordFile"].(string)
+	if passwordFile == "" {
+		passwordFile = w.conf.DefaultPasswordFile
+	}
+	if passwordFile == "" {
+		return nil, i18n.NewError(ctx, signermsgs.MsgDBWalletKeyInvalid, addr, "no password file")
+	}
+	password, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgDBWalletKeyInvalid, addr, err)
+	}
+	wf, err := keystorev3.ReadWalletFileCtx(ctx, keystore, []byte(strings.TrimSpace(string(password))))
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgDBWalletKeyInvalid, addr, err)
+	}
+	if wf.KeyPair().Address != addr {
+		wf.KeyPair().Destroy()
+		return nil, i18n.NewError(ctx, signermsgs.MsgAddressMismatch, wf.KeyPair().Address, addr)
+	}
+	return wf, nil
+}
+
+// InvalidateCache removes any cached key for the address, so it is re-read from the database on next use
+func (w *dbWallet) InvalidateCache(_ context.Context, addr ethtypes.Address0xHex) {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+	if w.closed {
+		return
+	}
+	addrString := addr.String()
+	// The cache only calls OnDelete for items its worker has already promoted, so destroy directly as well
+	if item := w.signerCache.Get(addrString); item != nil {
+		w.signerCache.Delete(addrString)
+		w.destroyKey(item.Value().(*cachedKey))
+	}
+}
+
+// destroyKey zeroes a key removed from the signer cache
+func (w *dbWallet) destroyKey(ck *cachedKey) {
+	w.mux.Lock()
+	delete(w.cachedKeys, ck)
+	w.mux.Unlock()
+	ck.destroy()
+}
+
+// Close stops the listener and the signer cache, zeroes all the keys that were loaded into it, and closes
+// the database
+func (w *dbWallet) Close() error {
+	w.closeMux.Lock()
+	defer w.closeMux.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.cancelCtx()
+	w.mux.Lock()
+	listenerDone := w.listenerDone
+	w.mux.Unlock()
+	if listenerDone != nil {
+		<-listenerDone
+	}
+	w.signerCache.Stop()
+	w.mux.Lock()
+	for ck := range w.cachedKeys {
+		ck.destroy()
+	}
+	w.cachedKeys = make(map[*cachedKey]bool)
+	w.mux.Unlock()
+	return w.db.Close()
+}
+
+func (ck *cachedKey) copy() *secp256k1.KeyPair {
+	ck.mux.Lock()
+	defer ck.mux.Unlock()
+	if ck.keypair == nil {
+		return nil
+	}
+	return secp256k1.KeyPairFromBytes(ck.keypair.PrivateKeyBytes())
+}
+
+func (ck *cachedKey) destroy() {
+	ck.mux.Lock()
+	defer ck.mux.Unlock()
+	if ck.keypair != nil {
+		ck.keypair.Destroy()
+		ck.keypair = nil
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbwallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testListSQL = "SELECT address FROM ffsigner_keys ORDER BY address"
+	testGetSQL  = "SELECT keystore, metadata FROM ffsigner_keys WHERE address = ?"
+)
+
+// newTestDBWallet builds a wallet on the sqlmock driver, with a default password file containing "pass". Tests
+// with a listener running set all their expectations (including the close) before starting it, and use closeOnly.
+func newTestDBWallet(t *testing.T, setConfig ...func(section config.Section)) (context.Context, *dbWallet, sqlmock.Sqlmock, func(closeOnly ...bool)) {
+	dsn := fmt.Sprintf("ut_%s_%d", t.Name(), time.Now().UnixNano())
+	_, mock, err := sqlmock.NewWithDSN(dsn, sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+
+	passwordFile := path.Join(t.TempDir(), "default.pwd")
+	err = os.WriteFile(passwordFile, []byte("pass\n"), 0600)
+	assert.NoError(t, err)
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_db_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ConfigDriver, "sqlmock")
+	unitTestConfig.Set(ConfigURL, dsn)
+	unitTestConfig.Set(ConfigDefaultPasswordFile, passwordFile)
+	unitTestConfig.Set(ConfigListenerType, ListenerNone)
+	for _, fn := range setConfig {
+		fn(unitTestConfig)
+	}
+	ctx := context.Background()
+
+	w, err := NewDBWallet(ctx, ReadConfig(unitTestConfig))
+	assert.NoError(t, err)
+	// Open the connection, so it is always closed when the wallet is
+	err = w.(*dbWallet).db.PingContext(ctx)
+	assert.NoError(t, err)
+
+	return ctx, w.(*dbWallet), mock, func(closeOnly ...bool) {
+		if len(closeOnly) == 0 {
+			mock.ExpectClose()
+		}
+		assert.NoError(t, w.Close())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func newTestKey(t *testing.T) *secp256k1.KeyPair {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	return keypair
+}
+
+func keyRow(keypair *secp256k1.KeyPair, password string, metadata interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"keystore", "metadata"}).
+		AddRow(string(keystorev3.NewWalletFileLight(password, keypair).JSON()), metadata)
+}
+
+func TestDBWalletSignOK(t *testing.T) {
+
+	ctx, w, mock, done := newTestDBWallet(t)
+	defer done()
+
+	key1, key2 := newTestKey(t), newTestKey(t)
+	otherPasswordFile := path.Join(t.TempDir(), "other.pwd")
+	err := os.WriteFile(otherPasswordFile, []byte("other"), 0600)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}).
+		AddRow(key1.Address.String()).
+		AddRow("not an address").
+		AddRow(key2.Address.String()))
+	err = w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&key1.Address, &key2.Address}, accounts)
+
+	count, err := w.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	page, err := w.ListAccounts(ctx, 1, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, accounts[1:], page)
+
+	page, err = w.ListAccounts(ctx, -1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, accounts[0:1], page)
+
+	page, err = w.ListAccounts(ctx, 2, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+
+	mock.ExpectQuery(testGetSQL).WithArgs(key1.Address.String()).WillReturnRows(keyRow(key1, "pass", nil))
+	mock.ExpectQuery(testGetSQL).WithArgs(key2.Address.String()).
+		WillReturnRows(keyRow(key2, "other", fmt.Sprintf(`{"passwordFile":"%s"}`, otherPasswordFile)))
+	for _, keypair := range []*secp256k1.KeyPair{key1, key2} {
+		txn := &ethsigner.Transaction{
+			From:  json.RawMessage(fmt.Sprintf(`"%s"`, keypair.Address)),
+			Nonce: ethtypes.NewHexInteger64(1),
+		}
+		signed, err := w.Sign(ctx, txn, 2022)
+		assert.NoError(t, err)
+		expected, err := txn.Sign(keypair, 2022)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, signed)
+	}
+
+	// Served from the cache
+	result, err := w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+
+	// Re-read once invalidated
+	w.InvalidateCache(ctx, key1.Address)
+	mock.ExpectQuery(testGetSQL).WithArgs(key1.Address.String()).WillReturnRows(keyRow(key1, "pass", ""))
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(testGetSQL).WithArgs(key2.Address.String()).
+		WillReturnRows(keyRow(key2, "other", `{"passwordFile":"other.pwd","owner":"team1"}`))
+	metadata, err := w.GetAccountMetadata(ctx, key2.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, "team1", metadata["owner"])
+
+}
+
+func TestDBWalletPostgresPlaceholder(t *testing.T) {
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_db_config")
+	InitConfig(unitTestConfig)
+	w, err := NewDBWallet(context.Background(), ReadConfig(unitTestConfig))
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, "SELECT keystore, metadata FROM ffsigner_keys WHERE address = $1", w.(*dbWallet).getSQL)
+
+}
+
+func TestDBWalletBadConfig(t *testing.T) {
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_db_config")
+	InitConfig(unitTestConfig)
+	ctx := context.Background()
+
+	unitTestConfig.Set(ConfigTable, "keys; DROP TABLE keys")
+	_, err := NewDBWallet(ctx, ReadConfig(unitTestConfig))
+	assert.Regexp(t, "FF22187", err)
+
+	unitTestConfig.Set(ConfigTable, "signer.keys")
+	unitTestConfig.Set(ConfigListenerType, "wrong")
+	_, err = NewDBWallet(ctx, ReadConfig(unitTestConfig))
+	assert.Regexp(t, "FF22191", err)
+
+	unitTestConfig.Set(ConfigListenerType, ListenerNotify)
+	unitTestConfig.Set(ConfigDriver, "mysql")
+	_, err = NewDBWallet(ctx, ReadConfig(unitTestConfig))
+	assert.Regexp(t, "FF22192", err)
+
+	unitTestConfig.Set(ConfigListenerType, ListenerPoll)
+	_, err = NewDBWallet(ctx, ReadConfig(unitTestConfig))
+	assert.Regexp(t, "FF22188.*mysql", err)
+
+}
+
+func TestDBWalletRefreshFail(t *testing.T) {
+
+	ctx, w, mock, done := newTestDBWallet(t)
+	defer done()
+
+	mock.ExpectQuery(testListSQL).WillReturnError(fmt.Errorf("pop"))
+	err := w.Initialize(ctx)
+	assert.Regexp(t, "FF22189.*pop", err)
+
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address", "extra"}).AddRow("0x", "0x"))
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22189", err)
+
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}).
+		AddRow("0xfb075bb99f2aa4c49955bf703509a227d7a12248").
+		RowError(0, fmt.Errorf("pop")))
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22189.*pop", err)
+
+}
+
+func TestDBWalletKeyErrors(t *testing.T) {
+
+	ctx, w, mock, done := newTestDBWallet(t)
+	defer done()
+
+	keypair := newTestKey(t)
+	addr := keypair.Address.String()
+	sign := func() error {
+		_, err := w.SignTypedDataV4(ctx, keypair.Address, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+		return err
+	}
+
+	mock.ExpectQuery(testGetSQL).WithArgs(addr).WillReturnRows(sqlmock.NewRows([]string{"keystore", "metadata"}))
+	assert.Regexp(t, "FF22014", sign())
+
+	mock.ExpectQuery(testGetSQL).WithArgs(addr).WillReturnError(fmt.Errorf("pop"))
+	assert.Regexp(t, "FF22189.*pop", sign())
+
+	mock.ExpectQuery(testGetSQL).WithArgs(addr).WillReturnRows(keyRow(keypair, "pass", "!json"))
+	assert.Regexp(t, "FF22190", sign())
+
+	mock.ExpectQuery(testGetSQL).WithArgs(addr).WillReturnRows(keyRow(keypair, "pass", `{"passwordFile":"missing.pwd"}`))
+	assert.Regexp(t, "FF22190", sign())
+
+	mock.ExpectQuery(testGetSQL).WithArgs(addr).WillReturnRows(keyRow(keypair, "wrong", nil))
+	assert.Regexp(t, "FF22190", sign())
+
+	mock.ExpectQuery(testGetSQL).WithArgs(addr).WillReturnRows(keyRow(newTestKey(t), "pass", nil))
+	assert.Regexp(t, "FF22059", sign())
+
+	_, err := w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"bad"`)}, 2022)
+	assert.Error(t, err)
+
+	w.conf.DefaultPasswordFile = ""
+	mock.ExpectQuery(testGetSQL).WithArgs(addr).WillReturnRows(keyRow(keypair, "pass", nil))
+	assert.Regexp(t, "FF22190.*no password file", sign())
+
+}
+
+func TestDBWalletPollListener(t *testing.T) {
+
+	ctx, w, mock, done := newTestDBWallet(t, func(section config.Section) {
+		section.Set(ConfigListenerType, ListenerPoll)
+		section.Set(ConfigListenerPollInterval, "1ms")
+	})
+	defer done(true)
+
+	key1, key2 := newTestKey(t), newTestKey(t)
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}).AddRow(key1.Address.String()))
+	mock.ExpectQuery(testListSQL).WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}).
+		AddRow(key1.Address.String()).
+		AddRow(key2.Address.String()))
+	// Later polls are not expected, so fail until the wallet is closed
+	mock.ExpectClose()
+
+	listener := make(chan ethtypes.Address0xHex, 1)
+	w.AddListener(listener)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, key1.Address, <-listener)
+	assert.Equal(t, key2.Address, <-listener)
+	w.RemoveListener(listener)
+
+}
+
+type testNotificationListener struct {
+	listenErr error
+	ch        chan *pq.Notification
+	closed    bool
+}
+
+func (tl *testNotificationListener) Listen(channel string) error {
+	return tl.listenErr
+}
+
+func (tl *testNotificationListener) NotificationChannel() <-chan *pq.Notification {
+	return tl.ch
+}
+
+func (tl *testNotificationListener) Close() error {
+	tl.closed = true
+	return nil
+}
+
+func TestDBWalletNotifyListener(t *testing.T) {
+
+	ctx, w, mock, done := newTestDBWallet(t)
+	defer done(true)
+
+	w.conf.Listener.Type = ListenerNotify
+	tl := &testNotificationListener{ch: make(chan *pq.Notification)}
+	defer func() { newNotificationListener = newPQListener }()
+	newNotificationListener = func(conf *Config, eventCallback pq.EventCallbackType) notificationListener {
+		eventCallback(pq.ListenerEventConnectionAttemptFailed, fmt.Errorf("pop"))
+		eventCallback(pq.ListenerEventConnected, nil)
+		return tl
+	}
+
+	key1, key2 := newTestKey(t), newTestKey(t)
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}).AddRow(key1.Address.String()))
+	mock.ExpectQuery(testListSQL).WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}).
+		AddRow(key1.Address.String()).
+		AddRow(key2.Address.String()))
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}).AddRow(newTestKey(t).Address.String()))
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}).AddRow(newTestKey(t).Address.String()))
+	mock.ExpectClose()
+
+	listener := make(chan ethtypes.Address0xHex, 1)
+	w.AddListener(listener)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, key1.Address, <-listener)
+
+	// A failed refresh is retried on the next notification - including the nil sent after reconnecting
+	tl.ch <- &pq.Notification{Channel: "ffsigner_keys", Extra: key2.Address.String()}
+	tl.ch <- nil
+	assert.Equal(t, key2.Address, <-listener)
+
+	// The wallet is closed while a notification is blocked, with the listener full
+	tl.ch <- nil
+	tl.ch <- nil
+
+}
+
+func TestDBWalletNotifyListenFail(t *testing.T) {
+
+	ctx, w, mock, done := newTestDBWallet(t)
+	defer done()
+
+	w.conf.Listener.Type = ListenerNotify
+	tl := &testNotificationListener{listenErr: fmt.Errorf("pop")}
+	defer func() { newNotificationListener = newPQListener }()
+	newNotificationListener = func(conf *Config, eventCallback pq.EventCallbackType) notificationListener {
+		return tl
+	}
+
+	mock.ExpectQuery(testListSQL).WillReturnRows(sqlmock.NewRows([]string{"address"}))
+	err := w.Initialize(ctx)
+	assert.Regexp(t, "FF22189.*pop", err)
+	assert.True(t, tl.closed)
+
+}
+
+func TestDBWalletNewPQListener(t *testing.T) {
+
+	l := newPQListener(&Config{URL: "postgres://localhost:1/db", Listener: ListenerConfig{ReconnectDelay: time.Second}}, nil)
+	assert.NoError(t, l.Close())
+
+}
+
+func TestDBWalletClosed(t *testing.T) {
+
+	ctx, w, _, done := newTestDBWallet(t)
+	done()
+
+	_, err := w.SignTypedDataV4(ctx, newTestKey(t).Address, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22103", err)
+	w.InvalidateCache(ctx, newTestKey(t).Address)
+	assert.NoError(t, w.Close())
+
+}
+
+func TestDBWalletHealthCheck(t *testing.T) {
+
+	ctx, w, _, done := newTestDBWallet(t)
+	assert.NoError(t, w.HealthCheck(ctx))
+	done()
+
+	assert.Regexp(t, "FF22189.*closed", w.HealthCheck(ctx))
+
+}
+
+func TestDBWalletEvictedKeyReloaded(t *testing.T) {
+
+	ctx, w, mock, done := newTestDBWallet(t)
+	defer done()
+
+	keypair := newTestKey(t)
+	mock.ExpectQuery(testGetSQL).WithArgs(keypair.Address.String()).WillReturnRows(keyRow(keypair, "pass", nil))
+	_, err := w.getSignerForAddr(ctx, keypair.Address)
+	assert.NoError(t, err)
+
+	// A key zeroed in the cache, but not yet removed, is loaded again
+	item := w.signerCache.Get(keypair.Address.String())
+	item.Value().(*cachedKey).destroy()
+	mock.ExpectQuery(testGetSQL).WithArgs(keypair.Address.String()).WillReturnRows(keyRow(keypair, "pass", nil))
+	kp, err := w.getSignerForAddr(ctx, keypair.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, kp.Address)
+
+}
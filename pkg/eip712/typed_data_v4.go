@@ -19,7 +19,10 @@ package eip712
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"sort"
 	"strconv"
 	"strings"
@@ -50,7 +53,20 @@ type TypeSet map[string]Type
 
 const EIP712Domain = "EIP712Domain"
 
-func EncodeTypedDataV4(ctx context.Context, payload *TypedData) (encoded ethtypes.HexBytes0xPrefix, err error) {
+const domainChainID = "chainId"
+
+// EncodeTypedDataV4 returns the hash of the typed data, which is signed
+func EncodeTypedDataV4(ctx context.Context, payload *TypedData) (ethtypes.HexBytes0xPrefix, error) {
+	encoded, err := EncodeTypedDataV4Message(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(encoded), nil
+}
+
+// EncodeTypedDataV4Message returns the 0x19 0x01 prefixed message, with the domain and struct hashes,
+// that is hashed for signing. This is for signers that hash the message themselves.
+func EncodeTypedDataV4Message(ctx context.Context, payload *TypedData) (encoded ethtypes.HexBytes0xPrefix, err error) {
 	// Add empty EIP712Domain type specification if missing
 	if payload.Types == nil {
 		payload.Types = TypeSet{}
@@ -64,13 +80,17 @@ func EncodeTypedDataV4(ctx context.Context, payload *TypedData) (encoded ethtype
 	if payload.PrimaryType == "" {
 		return nil, i18n.NewError(ctx, signermsgs.MsgEIP712PrimaryTypeRequired)
 	}
+	domain, err := normalizeDomain(ctx, payload.Domain)
+	if err != nil {
+		return nil, err
+	}
 
 	// Start with the EIP-712 prefix
 	buf := new(bytes.Buffer)
 	buf.Write([]byte{0x19, 0x01})
 
 	// Encode EIP712Domain from message
-	domainHash, err := hashStruct(ctx, EIP712Domain, payload.Domain, payload.Types, "domain")
+	domainHash, err := hashStruct(ctx, EIP712Domain, domain, payload.Types, "domain")
 	if err != nil {
 		return nil, err
 	}
@@ -88,7 +108,61 @@ func EncodeTypedDataV4(ctx context.Context, payload *TypedData) (encoded ethtype
 
 	encoded = buf.Bytes()
 	log.L(ctx).Tracef("Encoded EIP-712: %s", encoded)
-	return keccak256(encoded), nil
+	return encoded, nil
+}
+
+// normalizeDomain returns a copy of the domain with the chainId parsed to an integer.
+// Clients send the chainId as a JSON number, a decimal string, or a 0x prefixed hex string,
+// and all of these must produce the same hash.
+func normalizeDomain(ctx context.Context, domain map[string]interface{}) (map[string]interface{}, error) {
+	v, ok := domain[domainChainID]
+	if !ok || v == nil {
+		return domain, nil
+	}
+	chainID, err := parseChainID(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	normalized := make(map[string]interface{}, len(domain))
+	for k, v := range domain {
+		normalized[k] = v
+	}
+	normalized[domainChainID] = chainID
+	return normalized, nil
+}
+
+func parseChainID(ctx context.Context, v interface{}) (chainID *big.Int, err error) {
+	switch vt := v.(type) {
+	case string:
+		chainID, err = ethtypes.BigIntegerFromString(ctx, strings.TrimSpace(vt))
+	case json.Number:
+		chainID, err = ethtypes.BigIntegerFromString(ctx, vt.String())
+	case float64:
+		// This is how JSON numbers come in with the default unmarshalling
+		if vt != math.Trunc(vt) || math.IsInf(vt, 0) {
+			return nil, i18n.NewError(ctx, signermsgs.MsgEIP712InvalidChainID, v)
+		}
+		chainID, _ = big.NewFloat(vt).Int(nil)
+	case *big.Int:
+		chainID = vt
+	case *ethtypes.HexInteger:
+		chainID = vt.BigInt()
+	case int64:
+		chainID = big.NewInt(vt)
+	case int:
+		chainID = big.NewInt(int64(vt))
+	case uint64:
+		chainID = new(big.Int).SetUint64(vt)
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgEIP712InvalidChainID, v)
+	}
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, signermsgs.MsgEIP712InvalidChainID, v)
+	}
+	if chainID.Sign() < 0 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgEIP712InvalidChainID, v)
+	}
+	return chainID, nil
 }
 
 // A map from type names to types is encoded per encodeType:
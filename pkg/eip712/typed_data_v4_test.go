@@ -19,9 +19,11 @@ package eip712
 import (
 	"context"
 	"encoding/json"
+	"math/big"
 	"testing"
 
 	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -633,3 +635,60 @@ func TestArrayValueInvalid(t *testing.T) {
 func TestTypedDataDocumented(t *testing.T) {
 	ffapi.CheckObjectDocumented(&TypedData{})
 }
+
+func TestMessage_DomainChainIDFormats(t *testing.T) {
+
+	ctx := context.Background()
+	types := TypeSet{
+		EIP712Domain: Type{
+			{Name: "name", Type: "string"},
+			{Name: "chainId", Type: "uint256"},
+		},
+	}
+	encode := func(chainID interface{}) (string, error) {
+		domain := map[string]interface{}{"name": "Ether Mail", "chainId": chainID}
+		ed, err := EncodeTypedDataV4(ctx, &TypedData{Types: types, PrimaryType: EIP712Domain, Domain: domain})
+		if err != nil {
+			return "", err
+		}
+		assert.Equal(t, chainID, domain["chainId"]) // input unmodified
+		return ed.String(), nil
+	}
+
+	expected, err := encode(float64(1337))
+	assert.NoError(t, err)
+	for _, chainID := range []interface{}{
+		"1337",
+		" 1337 ",
+		"0x539",
+		"0X0539",
+		json.Number("1337"),
+		int64(1337),
+		1337,
+		uint64(1337),
+		big.NewInt(1337),
+		ethtypes.NewHexInteger64(1337),
+	} {
+		ed, err := encode(chainID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, ed, "chainId %v", chainID)
+	}
+
+	for _, chainID := range []interface{}{
+		"",
+		"0x",
+		"chain1",
+		"-1",
+		1.5,
+		true,
+		json.Number("1e-1"),
+	} {
+		_, err := encode(chainID)
+		assert.Regexp(t, "FF22177", err)
+	}
+
+	// Null is left for the ABI encoding to reject
+	_, err = encode(nil)
+	assert.Regexp(t, "FF22030", err)
+
+}
@@ -0,0 +1,195 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+)
+
+const defaultPollInterval = 1 * time.Second
+
+// EthClient is a typed client for the JSON/RPC methods needed to sign and submit transactions
+// with a wallet, over any JSON/RPC backend (HTTP or WebSockets)
+type EthClient interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	GetTransactionCount(ctx context.Context, addr ethtypes.Address0xHex, blockTag string) (*ethtypes.HexInteger, error)
+	SendRawTransaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix) (ethtypes.HexBytes0xPrefix, error)
+	GetTransactionReceipt(ctx context.Context, txHash ethtypes.HexBytes0xPrefix) (*TransactionReceipt, error)
+	SendTransactionAndWait(ctx context.Context, tx *ethsigner.Transaction, opts *WaitOptions) (*TransactionReceipt, error)
+}
+
+// WaitOptions control how long SendTransactionAndWait waits for a receipt
+type WaitOptions struct {
+	// Confirmations is the number of blocks that must be mined on top of the block containing
+	// the transaction, before the receipt is returned. Zero returns as soon as it is mined
+	Confirmations uint64
+	// Timeout is the maximum time to wait after submission. Zero waits until the context is cancelled
+	Timeout time.Duration
+	// PollInterval is the time between checks for the receipt, and for new blocks. Default 1s
+	PollInterval time.Duration
+}
+
+type ethClient struct {
+	rpc     rpcbackend.RPC
+	wallet  ethsigner.Wallet
+	chainID int64
+}
+
+// NewEthClient constructs a client that signs with the wallet, for the given chain, and submits to the backend
+func NewEthClient(rpc rpcbackend.RPC, wallet ethsigner.Wallet, chainID int64) EthClient {
+	return &ethClient{
+		rpc:     rpc,
+		wallet:  wallet,
+		chainID: chainID,
+	}
+}
+
+func (ec *ethClient) BlockNumber(ctx context.Context) (uint64, error) {
+	var blockNumber ethtypes.HexUint64
+	if rpcErr := ec.rpc.CallRPC(ctx, &blockNumber, "eth_blockNumber"); rpcErr != nil {
+		return 0, rpcErr.Error()
+	}
+	return blockNumber.Uint64(), nil
+}
+
+func (ec *ethClient) GetTransactionCount(ctx context.Context, addr ethtypes.Address0xHex, blockTag string) (*ethtypes.HexInteger, error) {
+	var nonce *ethtypes.HexInteger
+	if rpcErr := ec.rpc.CallRPC(ctx, &nonce, "eth_getTransactionCount", &addr, blockTag); rpcErr != nil {
+		return nil, rpcErr.Error()
+	}
+	return nonce, nil
+}
+
+func (ec *ethClient) SendRawTransaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix) (ethtypes.HexBytes0xPrefix, error) {
+	var txHash ethtypes.HexBytes0xPrefix
+	if rpcErr := ec.rpc.CallRPC(ctx, &txHash, "eth_sendRawTransaction", rawTx); rpcErr != nil {
+		return nil, rpcErr.Error()
+	}
+	return txHash, nil
+}
+
+// GetTransactionReceipt returns nil (without error) if the transaction has not been mined
+func (ec *ethClient) GetTransactionReceipt(ctx context.Context, txHash ethtypes.HexBytes0xPrefix) (*TransactionReceipt, error) {
+	var receipt *TransactionReceipt
+	if rpcErr := ec.rpc.CallRPC(ctx, &receipt, "eth_getTransactionReceipt", txHash); rpcErr != nil {
+		return nil, rpcErr.Error()
+	}
+	return receipt, nil
+}
+
+// SendTransactionAndWait signs the transaction with the wallet, submits it, and waits for the receipt
+// to reach the requested confirmation depth. The nonce is obtained from the node if not set.
+// A receipt for a transaction that reverted is returned without error - check Success().
+func (ec *ethClient) SendTransactionAndWait(ctx context.Context, tx *ethsigner.Transaction, opts *WaitOptions) (*TransactionReceipt, error) {
+	if opts == nil {
+		opts = &WaitOptions{}
+	}
+	if tx.From == nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgMissingFrom)
+	}
+
+	// As with the JSON/RPC server, this simple nonce management is only suitable for sequential submission
+	// from each signing address. See FireFly Transaction Manager for more advanced nonce management.
+	if tx.Nonce == nil {
+		var from ethtypes.Address0xHex
+		if err := json.Unmarshal(tx.From, &from); err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgInvalidFromAddress, tx.From, err)
+		}
+		nonce, err := ec.GetTransactionCount(ctx, from, "pending")
+		if err != nil {
+			return nil, err
+		}
+		tx.Nonce = nonce
+	}
+
+	rawTx, err := ec.wallet.Sign(ctx, tx, ec.chainID)
+	if err != nil {
+		return nil, err
+	}
+	txHash, err := ec.SendRawTransaction(ctx, rawTx)
+	if err != nil {
+		return nil, err
+	}
+	log.L(ctx).Debugf("Submitted transaction %s (nonce=%s)", txHash, tx.Nonce)
+
+	return ec.waitForReceipt(ctx, txHash, opts)
+}
+
+func (ec *ethClient) waitForReceipt(ctx context.Context, txHash ethtypes.HexBytes0xPrefix, opts *WaitOptions) (*TransactionReceipt, error) {
+	pollInterval := opts.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	waitCtx := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	var receipt *TransactionReceipt
+	for {
+		confirmed, err := ec.checkReceipt(waitCtx, txHash, opts.Confirmations, &receipt)
+		if err != nil && waitCtx.Err() == nil {
+			// The node might be temporarily unavailable, so keep trying until the timeout
+			log.L(ctx).Warnf("Failed to check receipt for transaction %s: %s", txHash, err)
+		}
+		if confirmed {
+			return receipt, nil
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return nil, i18n.NewError(ctx, i18n.MsgContextCanceled)
+			}
+			return nil, i18n.NewError(ctx, signermsgs.MsgReceiptWaitTimeout, opts.Timeout, txHash)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// checkReceipt fetches the receipt, and checks whether the block containing it has enough confirmations.
+// The receipt is re-fetched each time, so a transaction moved to a different block by a re-org is
+// confirmed against its new block.
+func (ec *ethClient) checkReceipt(ctx context.Context, txHash ethtypes.HexBytes0xPrefix, confirmations uint64, lastReceipt **TransactionReceipt) (bool, error) {
+	receipt, err := ec.GetTransactionReceipt(ctx, txHash)
+	if err != nil || receipt == nil {
+		return false, err
+	}
+	if *lastReceipt == nil || !bytes.Equal((*lastReceipt).BlockHash, receipt.BlockHash) {
+		log.L(ctx).Debugf("Transaction %s mined in block %d (%s)", txHash, receipt.BlockNumber.Uint64(), receipt.BlockHash)
+	}
+	*lastReceipt = receipt
+	if confirmations == 0 {
+		return true, nil
+	}
+	blockNumber, err := ec.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	return blockNumber >= receipt.BlockNumber.Uint64()+confirmations, nil
+}
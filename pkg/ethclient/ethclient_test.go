@@ -0,0 +1,230 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/mocks/rpcbackendmocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rpcbackend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testTxHash = "0x7d48ae971faf089878b57e3c28e3035540d34f38af395958d2c73c36c57c83a2"
+
+func newTestEthClient(t *testing.T) (context.Context, *ethClient, *rpcbackendmocks.Backend, *ethsignermocks.Wallet, func()) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	bm := &rpcbackendmocks.Backend{}
+	wm := &ethsignermocks.Wallet{}
+	ec := NewEthClient(bm, wm, 12345).(*ethClient)
+	return ctx, ec, bm, wm, func() {
+		cancelCtx()
+		bm.AssertExpectations(t)
+		wm.AssertExpectations(t)
+	}
+}
+
+func mockRPCResult(bm *rpcbackendmocks.Backend, method string, resultJSON string) *mock.Call {
+	return bm.On("CallRPC", mock.Anything, mock.Anything, method, mock.Anything).Run(func(args mock.Arguments) {
+		err := json.Unmarshal([]byte(resultJSON), args[1])
+		if err != nil {
+			panic(err)
+		}
+	}).Return(nil)
+}
+
+func testReceiptJSON(blockNumber uint64, blockHash string) string {
+	return fmt.Sprintf(`{
+		"transactionHash": "%s",
+		"transactionIndex": "0x0",
+		"blockHash": "%s",
+		"blockNumber": "0x%x",
+		"from": "0xfb075bb99f2aa4c49955bf703509a227d7a12248",
+		"to": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+		"cumulativeGasUsed": "0x5208",
+		"gasUsed": "0x5208",
+		"status": "0x1",
+		"logs": [{
+			"address": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+			"topics": ["0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"],
+			"data": "0x",
+			"logIndex": "0x0"
+		}],
+		"logsBloom": "0x00"
+	}`, testTxHash, blockHash, blockNumber)
+}
+
+func testTransaction() *ethsigner.Transaction {
+	return &ethsigner.Transaction{
+		From:     json.RawMessage(`"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`),
+		To:       ethtypes.MustNewAddress("0x497eedc4299dea2f2a364be10025d0ad0f702de3"),
+		GasLimit: ethtypes.NewHexInteger64(21000),
+		GasPrice: ethtypes.NewHexInteger64(0),
+	}
+}
+
+func TestSendTransactionAndWaitConfirmations(t *testing.T) {
+	ctx, ec, bm, wm, done := newTestEthClient(t)
+	defer done()
+
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_getTransactionCount", mock.Anything, "pending").Run(func(args mock.Arguments) {
+		*(args[1].(**ethtypes.HexInteger)) = ethtypes.NewHexInteger64(42)
+	}).Return(nil)
+	wm.On("Sign", mock.Anything, mock.MatchedBy(func(tx *ethsigner.Transaction) bool {
+		return tx.Nonce.Int64() == 42
+	}), int64(12345)).Return([]byte{0x01, 0x02}, nil)
+	mockRPCResult(bm, "eth_sendRawTransaction", `"`+testTxHash+`"`)
+	mockRPCResult(bm, "eth_getTransactionReceipt", `null`).Once()
+	mockRPCResult(bm, "eth_getTransactionReceipt", testReceiptJSON(100, "0xaaaa")).Once()
+	mockRPCResult(bm, "eth_getTransactionReceipt", testReceiptJSON(101, "0xbbbb")) // re-org
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_blockNumber").Run(func(args mock.Arguments) {
+		*(args[1].(*ethtypes.HexUint64)) = 101
+	}).Return(nil).Once()
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_blockNumber").Run(func(args mock.Arguments) {
+		*(args[1].(*ethtypes.HexUint64)) = 103
+	}).Return(nil)
+
+	receipt, err := ec.SendTransactionAndWait(ctx, testTransaction(), &WaitOptions{
+		Confirmations: 2,
+		PollInterval:  1 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.True(t, receipt.Success())
+	assert.Equal(t, uint64(101), receipt.BlockNumber.Uint64())
+	assert.Equal(t, testTxHash, receipt.TransactionHash.String())
+	assert.Equal(t, int64(21000), receipt.GasUsed.Int64())
+	assert.Len(t, receipt.Logs, 1)
+	assert.Len(t, receipt.Logs[0].Topics, 1)
+}
+
+func TestSendTransactionAndWaitNoConfirmations(t *testing.T) {
+	ctx, ec, bm, wm, done := newTestEthClient(t)
+	defer done()
+
+	tx := testTransaction()
+	tx.Nonce = ethtypes.NewHexInteger64(1)
+	wm.On("Sign", mock.Anything, tx, int64(12345)).Return([]byte{0x01, 0x02}, nil)
+	mockRPCResult(bm, "eth_sendRawTransaction", `"`+testTxHash+`"`)
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_getTransactionReceipt", mock.Anything).Return(&rpcbackend.RPCError{Message: "pop"}).Once()
+	mockRPCResult(bm, "eth_getTransactionReceipt", `{"blockNumber":"0x1","status":"0x0"}`)
+
+	receipt, err := ec.SendTransactionAndWait(ctx, tx, &WaitOptions{PollInterval: 1 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.False(t, receipt.Success())
+}
+
+func TestSendTransactionAndWaitTimeout(t *testing.T) {
+	ctx, ec, bm, wm, done := newTestEthClient(t)
+	defer done()
+
+	tx := testTransaction()
+	tx.Nonce = ethtypes.NewHexInteger64(1)
+	wm.On("Sign", mock.Anything, tx, int64(12345)).Return([]byte{0x01, 0x02}, nil)
+	mockRPCResult(bm, "eth_sendRawTransaction", `"`+testTxHash+`"`)
+	mockRPCResult(bm, "eth_getTransactionReceipt", `null`)
+
+	_, err := ec.SendTransactionAndWait(ctx, tx, &WaitOptions{
+		Timeout:      10 * time.Millisecond,
+		PollInterval: 1 * time.Millisecond,
+	})
+	assert.Regexp(t, "FF22126.*"+testTxHash, err)
+}
+
+func TestSendTransactionAndWaitContextCancelled(t *testing.T) {
+	ctx, ec, bm, wm, done := newTestEthClient(t)
+	defer done()
+
+	tx := testTransaction()
+	tx.Nonce = ethtypes.NewHexInteger64(1)
+	wm.On("Sign", mock.Anything, tx, int64(12345)).Return([]byte{0x01, 0x02}, nil)
+	mockRPCResult(bm, "eth_sendRawTransaction", `"`+testTxHash+`"`)
+	mockRPCResult(bm, "eth_getTransactionReceipt", testReceiptJSON(100, "0xaaaa"))
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_blockNumber").Return(&rpcbackend.RPCError{Message: "pop"})
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := ec.SendTransactionAndWait(cancelCtx, tx, &WaitOptions{Confirmations: 1})
+	assert.Regexp(t, "FF00154", err)
+}
+
+func TestSendTransactionAndWaitMissingFrom(t *testing.T) {
+	ctx, ec, _, _, done := newTestEthClient(t)
+	defer done()
+
+	_, err := ec.SendTransactionAndWait(ctx, &ethsigner.Transaction{}, nil)
+	assert.Regexp(t, "FF22020", err)
+}
+
+func TestSendTransactionAndWaitBadFrom(t *testing.T) {
+	ctx, ec, _, _, done := newTestEthClient(t)
+	defer done()
+
+	_, err := ec.SendTransactionAndWait(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"bad address"`),
+	}, nil)
+	assert.Regexp(t, "FF22125", err)
+}
+
+func TestSendTransactionAndWaitNonceFail(t *testing.T) {
+	ctx, ec, bm, _, done := newTestEthClient(t)
+	defer done()
+
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_getTransactionCount", mock.Anything, "pending").Return(&rpcbackend.RPCError{Message: "pop"})
+
+	_, err := ec.SendTransactionAndWait(ctx, testTransaction(), nil)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestSendTransactionAndWaitSignFail(t *testing.T) {
+	ctx, ec, _, wm, done := newTestEthClient(t)
+	defer done()
+
+	tx := testTransaction()
+	tx.Nonce = ethtypes.NewHexInteger64(1)
+	wm.On("Sign", mock.Anything, tx, int64(12345)).Return(nil, fmt.Errorf("pop"))
+
+	_, err := ec.SendTransactionAndWait(ctx, tx, nil)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestSendTransactionAndWaitSubmitFail(t *testing.T) {
+	ctx, ec, bm, wm, done := newTestEthClient(t)
+	defer done()
+
+	tx := testTransaction()
+	tx.Nonce = ethtypes.NewHexInteger64(1)
+	wm.On("Sign", mock.Anything, tx, int64(12345)).Return([]byte{0x01, 0x02}, nil)
+	bm.On("CallRPC", mock.Anything, mock.Anything, "eth_sendRawTransaction", mock.Anything).Return(&rpcbackend.RPCError{Message: "pop"})
+
+	_, err := ec.SendTransactionAndWait(ctx, tx, nil)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestReceiptSuccessPreByzantium(t *testing.T) {
+	var receipt TransactionReceipt
+	err := json.Unmarshal([]byte(`{"blockNumber":"0x1"}`), &receipt)
+	assert.NoError(t, err)
+	assert.True(t, receipt.Success())
+}
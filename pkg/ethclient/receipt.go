@@ -0,0 +1,55 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethclient
+
+import "github.com/hyperledger/firefly-signer/pkg/ethtypes"
+
+// TransactionReceipt is the result of eth_getTransactionReceipt
+type TransactionReceipt struct {
+	TransactionHash   ethtypes.HexBytes0xPrefix `json:"transactionHash"`
+	TransactionIndex  ethtypes.HexUint64        `json:"transactionIndex"`
+	BlockHash         ethtypes.HexBytes0xPrefix `json:"blockHash"`
+	BlockNumber       ethtypes.HexUint64        `json:"blockNumber"`
+	From              *ethtypes.Address0xHex    `json:"from"`
+	To                *ethtypes.Address0xHex    `json:"to,omitempty"`
+	ContractAddress   *ethtypes.Address0xHex    `json:"contractAddress,omitempty"`
+	CumulativeGasUsed *ethtypes.HexInteger      `json:"cumulativeGasUsed"`
+	GasUsed           *ethtypes.HexInteger      `json:"gasUsed"`
+	EffectiveGasPrice *ethtypes.HexInteger      `json:"effectiveGasPrice,omitempty"`
+	Status            *ethtypes.HexUint64       `json:"status,omitempty"` // nil for pre-byzantium receipts
+	Logs              []*Log                    `json:"logs"`
+	LogsBloom         ethtypes.HexBytes0xPrefix `json:"logsBloom"`
+}
+
+// Log is an event emitted by a transaction, as included in its receipt
+type Log struct {
+	Address          *ethtypes.Address0xHex      `json:"address"`
+	Topics           []ethtypes.HexBytes0xPrefix `json:"topics"`
+	Data             ethtypes.HexBytes0xPrefix   `json:"data"`
+	BlockNumber      ethtypes.HexUint64          `json:"blockNumber"`
+	BlockHash        ethtypes.HexBytes0xPrefix   `json:"blockHash"`
+	TransactionHash  ethtypes.HexBytes0xPrefix   `json:"transactionHash"`
+	TransactionIndex ethtypes.HexUint64          `json:"transactionIndex"`
+	LogIndex         ethtypes.HexUint64          `json:"logIndex"`
+	Removed          bool                        `json:"removed"`
+}
+
+// Success returns true if the transaction executed successfully. Receipts without a status
+// (from before the Byzantium fork) are treated as successful.
+func (r *TransactionReceipt) Success() bool {
+	return r.Status == nil || r.Status.Uint64() == 1
+}
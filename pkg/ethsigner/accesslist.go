@@ -0,0 +1,101 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+)
+
+// AccessList is the list of addresses and storage keys that a transaction plans to access, which are
+// charged at a discount (EIP-2930). Supported by EIP-2930 and EIP-1559 transactions.
+type AccessList []AccessListEntry
+
+// AccessListEntry is an address in an AccessList, and the storage keys within it
+type AccessListEntry struct {
+	Address     ethtypes.Address0xHex       `ffstruct:"EthAccessListEntry" json:"address"`
+	StorageKeys []ethtypes.HexBytes0xPrefix `ffstruct:"EthAccessListEntry" json:"storageKeys"`
+}
+
+// UnmarshalJSON requires every storage key to be exactly 32 bytes, as they would otherwise be signed
+// into a transaction that the chain rejects
+func (e *AccessListEntry) UnmarshalJSON(b []byte) error {
+	type accessListEntryJSON AccessListEntry
+	var parsed accessListEntryJSON
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return err
+	}
+	for i, key := range parsed.StorageKeys {
+		if len(key) != 32 {
+			return i18n.NewError(context.Background(), signermsgs.MsgInvalidAccessList,
+				fmt.Sprintf("storage key %d for address %s is %d bytes (expected 32)", i, parsed.Address, len(key)))
+		}
+	}
+	*e = AccessListEntry(parsed)
+	return nil
+}
+
+// BuildRLP returns the access list as an RLP list of [address, [storageKeys...]] pairs
+func (al AccessList) BuildRLP() rlp.List {
+	rlpList := make(rlp.List, 0, len(al))
+	for _, entry := range al {
+		storageKeys := make(rlp.List, 0, len(entry.StorageKeys))
+		for _, key := range entry.StorageKeys {
+			storageKeys = append(storageKeys, rlp.Data(key))
+		}
+		address := entry.Address
+		rlpList = append(rlpList, rlp.List{rlp.WrapAddress(&address), storageKeys})
+	}
+	return rlpList
+}
+
+// decodeAccessList parses an access list from the RLP of a signed or unsigned transaction
+func decodeAccessList(ctx context.Context, element rlp.Element) (AccessList, error) {
+	if element == nil || !element.IsList() {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidAccessList, "not a list")
+	}
+	entries := element.(rlp.List)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	al := make(AccessList, len(entries))
+	for i, e := range entries {
+		entry, ok := e.(rlp.List)
+		if !ok || len(entry) != 2 || entry[0].IsList() || !entry[1].IsList() {
+			return nil, i18n.NewError(ctx, signermsgs.MsgInvalidAccessList, fmt.Sprintf("entry %d is not an [address, [storageKeys...]] pair", i))
+		}
+		address := entry[0].ToData().Address()
+		if address == nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgInvalidAccessList, fmt.Sprintf("entry %d has an invalid address", i))
+		}
+		al[i].Address = *address
+		for _, k := range entry[1].(rlp.List) {
+			key := k.ToData()
+			if k.IsList() || len(key) != 32 {
+				return nil, i18n.NewError(ctx, signermsgs.MsgInvalidAccessList, fmt.Sprintf("entry %d has an invalid storage key", i))
+			}
+			al[i].StorageKeys = append(al[i].StorageKeys, ethtypes.HexBytes0xPrefix(key))
+		}
+	}
+	return al, nil
+}
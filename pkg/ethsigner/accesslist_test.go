@@ -0,0 +1,95 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessListJSON(t *testing.T) {
+
+	var al AccessList
+	err := json.Unmarshal([]byte(`[{
+		"address": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+		"storageKeys": ["0x0000000000000000000000000000000000000000000000000000000000000001"]
+	}]`), &al)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x497eedc4299dea2f2a364be10025d0ad0f702de3", al[0].Address.String())
+	assert.Equal(t, ethtypes.MustNewHexBytes0xPrefix("0x0000000000000000000000000000000000000000000000000000000000000001"), al[0].StorageKeys[0])
+
+	b, err := json.Marshal(al)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{
+		"address": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+		"storageKeys": ["0x0000000000000000000000000000000000000000000000000000000000000001"]
+	}]`, string(b))
+
+	err = json.Unmarshal([]byte(`[{"address": "0x497eedc4299dea2f2a364be10025d0ad0f702de3", "storageKeys": ["0x01"]}]`), &al)
+	assert.Regexp(t, "FF22242.*storage key 0.*1 bytes", err)
+
+	err = json.Unmarshal([]byte(`[{"address": "wrong"}]`), &al)
+	assert.Error(t, err)
+
+}
+
+func TestAccessListBuildRLP(t *testing.T) {
+
+	al := AccessList{{
+		Address:     ethtypes.Address0xHex{0x01},
+		StorageKeys: []ethtypes.HexBytes0xPrefix{make([]byte, 32)},
+	}}
+	rlpList := al.BuildRLP()
+	assert.Len(t, rlpList, 1)
+	entry := rlpList[0].(rlp.List)
+	assert.Equal(t, rlp.Data(al[0].Address[:]), entry[0])
+	// Leading zeros of storage keys are kept, as they are not integers
+	assert.Equal(t, rlp.List{rlp.Data(make([]byte, 32))}, entry[1])
+
+	assert.Equal(t, rlp.List{}, AccessList(nil).BuildRLP())
+
+}
+
+func TestDecodeAccessListFail(t *testing.T) {
+
+	ctx := context.Background()
+	address := rlp.Data(make([]byte, 20))
+
+	_, err := decodeAccessList(ctx, nil)
+	assert.Regexp(t, "FF22242.*not a list", err)
+
+	_, err = decodeAccessList(ctx, rlp.List{rlp.Data{}})
+	assert.Regexp(t, "FF22242.*entry 0 is not", err)
+
+	_, err = decodeAccessList(ctx, rlp.List{rlp.List{address}})
+	assert.Regexp(t, "FF22242.*entry 0 is not", err)
+
+	_, err = decodeAccessList(ctx, rlp.List{rlp.List{rlp.Data{0x01}, rlp.List{}}})
+	assert.Regexp(t, "FF22242.*entry 0 has an invalid address", err)
+
+	_, err = decodeAccessList(ctx, rlp.List{rlp.List{address, rlp.List{rlp.Data{0x01}}}})
+	assert.Regexp(t, "FF22242.*entry 0 has an invalid storage key", err)
+
+	_, err = decodeAccessList(ctx, rlp.List{rlp.List{address, rlp.List{rlp.List{}}}})
+	assert.Regexp(t, "FF22242.*entry 0 has an invalid storage key", err)
+
+}
@@ -0,0 +1,169 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+// authorizationMagic is prefixed to the RLP of an authorization when it is signed, so the signature cannot
+// be replayed as a transaction (EIP-7702)
+const authorizationMagic byte = 0x05
+
+// AuthorizationList is the list of signed authorizations in an EIP-7702 set code transaction
+type AuthorizationList []Authorization
+
+// Authorization is signed by an account to delegate to the code of a contract, which takes effect when it is
+// included in an EIP-7702 set code transaction (sent by any account)
+type Authorization struct {
+	ChainID *ethtypes.HexInteger  `ffstruct:"EthAuthorization" json:"chainId"`
+	Address ethtypes.Address0xHex `ffstruct:"EthAuthorization" json:"address"`
+	Nonce   *ethtypes.HexInteger  `ffstruct:"EthAuthorization" json:"nonce"`
+	YParity *ethtypes.HexInteger  `ffstruct:"EthAuthorization" json:"yParity,omitempty"`
+	R       *ethtypes.HexInteger  `ffstruct:"EthAuthorization" json:"r,omitempty"`
+	S       *ethtypes.HexInteger  `ffstruct:"EthAuthorization" json:"s,omitempty"`
+}
+
+// SignaturePayload returns the bytes that are hashed and signed by the authorizing account:
+// 0x05 || rlp([chain_id, address, nonce])
+func (a *Authorization) SignaturePayload() []byte {
+	address := a.Address
+	rlpList := rlp.List{
+		rlp.WrapInt(a.ChainID.BigInt()),
+		rlp.WrapAddress(&address),
+		rlp.WrapInt(a.Nonce.BigInt()),
+	}
+	return append([]byte{authorizationMagic}, rlpList.Encode()...)
+}
+
+// Sign signs the authorization, setting the Y-parity, R and S values. The signing account is the
+// authority that delegates to the code at the address.
+func (a *Authorization) Sign(signer secp256k1.Signer) error {
+	if signer == nil {
+		return i18n.NewError(context.Background(), signermsgs.MsgInvalidSigner)
+	}
+	sig, err := signPayload(signer, a.SignaturePayload())
+	if err != nil {
+		return err
+	}
+	sig.UpdateEIP2930()
+	a.YParity = (*ethtypes.HexInteger)(sig.V)
+	a.R = (*ethtypes.HexInteger)(sig.R)
+	a.S = (*ethtypes.HexInteger)(sig.S)
+	return nil
+}
+
+// RecoverAuthority returns the address of the account that signed the authorization
+func (a *Authorization) RecoverAuthority() (*ethtypes.Address0xHex, error) {
+	if err := a.validate(context.Background(), 0); err != nil {
+		return nil, err
+	}
+	sig := &secp256k1.SignatureData{
+		V: new(big.Int).Set(a.YParity.BigInt()),
+		R: new(big.Int).Set(a.R.BigInt()),
+		S: new(big.Int).Set(a.S.BigInt()),
+	}
+	return sig.RecoverBig(a.SignaturePayload(), a.ChainID.BigInt())
+}
+
+// validate checks the authorization is signed, and the values fit in the sizes the chain accepts
+func (a *Authorization) validate(ctx context.Context, i int) error {
+	switch {
+	case a.R == nil || a.S == nil || a.YParity == nil:
+		return i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, fmt.Sprintf("authorization %d is not signed", i))
+	case a.YParity.BigInt().Cmp(big.NewInt(1)) > 0:
+		return i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, fmt.Sprintf("authorization %d has an invalid Y-parity %s", i, a.YParity))
+	case a.ChainID.BigInt().BitLen() > 256 || a.R.BigInt().BitLen() > 256 || a.S.BigInt().BitLen() > 256:
+		return i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, fmt.Sprintf("authorization %d has a value larger than 256 bits", i))
+	case a.Nonce.BigInt().BitLen() > 64:
+		return i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, fmt.Sprintf("authorization %d has a nonce larger than 64 bits", i))
+	}
+	return nil
+}
+
+func (al AuthorizationList) validate(ctx context.Context) error {
+	if len(al) == 0 {
+		return i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, "at least one authorization is required")
+	}
+	for i := range al {
+		if err := al[i].validate(ctx, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildRLP returns the authorization list as an RLP list of [chain_id, address, nonce, y_parity, r, s] tuples
+func (al AuthorizationList) BuildRLP() rlp.List {
+	rlpList := make(rlp.List, 0, len(al))
+	for _, a := range al {
+		address := a.Address
+		rlpList = append(rlpList, rlp.List{
+			rlp.WrapInt(a.ChainID.BigInt()),
+			rlp.WrapAddress(&address),
+			rlp.WrapInt(a.Nonce.BigInt()),
+			rlp.WrapInt(a.YParity.BigInt()),
+			rlp.WrapInt(a.R.BigInt()),
+			rlp.WrapInt(a.S.BigInt()),
+		})
+	}
+	return rlpList
+}
+
+// decodeAuthorizationList parses an authorization list from the RLP of a signed or unsigned transaction
+func decodeAuthorizationList(ctx context.Context, element rlp.Element) (AuthorizationList, error) {
+	if element == nil || !element.IsList() {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, "not a list")
+	}
+	entries := element.(rlp.List)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	al := make(AuthorizationList, len(entries))
+	for i, e := range entries {
+		tuple, ok := e.(rlp.List)
+		if !ok || len(tuple) != 6 {
+			return nil, i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, fmt.Sprintf("authorization %d is not a [chain_id, address, nonce, y_parity, r, s] tuple", i))
+		}
+		for _, v := range tuple {
+			if v.IsList() {
+				return nil, i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, fmt.Sprintf("authorization %d contains a list", i))
+			}
+		}
+		address := tuple[1].ToData().Address()
+		if address == nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgInvalidAuthorization, fmt.Sprintf("authorization %d has an invalid address", i))
+		}
+		al[i] = Authorization{
+			ChainID: (*ethtypes.HexInteger)(tuple[0].ToData().IntOrZero()),
+			Address: *address,
+			Nonce:   (*ethtypes.HexInteger)(tuple[2].ToData().IntOrZero()),
+			YParity: (*ethtypes.HexInteger)(tuple[3].ToData().IntOrZero()),
+			R:       (*ethtypes.HexInteger)(tuple[4].ToData().IntOrZero()),
+			S:       (*ethtypes.HexInteger)(tuple[5].ToData().IntOrZero()),
+		}
+	}
+	return al, nil
+}
@@ -0,0 +1,143 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/mocks/secp256k1mocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthorizationSignRecover(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	var auth Authorization
+	err = json.Unmarshal([]byte(`{
+		"chainId": "0x3e9",
+		"address": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+		"nonce": "0x05"
+	}`), &auth)
+	assert.NoError(t, err)
+
+	// 0x05 || rlp([chain_id, address, nonce])
+	payload := auth.SignaturePayload()
+	assert.Equal(t, authorizationMagic, payload[0])
+	decoded, _, err := rlp.Decode(payload[1:])
+	assert.NoError(t, err)
+	assert.Len(t, decoded.(rlp.List), 3)
+
+	_, err = auth.RecoverAuthority()
+	assert.Regexp(t, "FF22246.*not signed", err)
+
+	err = auth.Sign(keypair)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, auth.YParity.BigInt().Int64(), int64(1))
+	authority, err := auth.RecoverAuthority()
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, *authority)
+
+	// The signature is over the chain ID, address and nonce
+	auth.Nonce = ethtypes.NewHexInteger64(6)
+	authority, err = auth.RecoverAuthority()
+	assert.NoError(t, err)
+	assert.NotEqual(t, keypair.Address, *authority)
+
+	b, err := json.Marshal(&auth)
+	assert.NoError(t, err)
+	var generic map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &generic))
+	assert.Equal(t, "0x3e9", generic["chainId"])
+	assert.Contains(t, generic, "yParity")
+	assert.Contains(t, generic, "r")
+	assert.Contains(t, generic, "s")
+
+}
+
+func TestAuthorizationSignError(t *testing.T) {
+
+	auth := &Authorization{}
+	err := auth.Sign(nil)
+	assert.Regexp(t, "FF22064", err)
+
+	msn := &secp256k1mocks.Signer{}
+	msn.On("Sign", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	err = auth.Sign(msn)
+	assert.Regexp(t, "pop", err)
+	assert.Nil(t, auth.YParity)
+
+}
+
+func TestAuthorizationListValidate(t *testing.T) {
+
+	ctx := context.Background()
+	signed := func() Authorization {
+		return Authorization{YParity: ethtypes.NewHexInteger64(1), R: ethtypes.NewHexInteger64(1), S: ethtypes.NewHexInteger64(1)}
+	}
+	assert.NoError(t, AuthorizationList{signed()}.validate(ctx))
+
+	err := AuthorizationList{}.validate(ctx)
+	assert.Regexp(t, "FF22246.*at least one", err)
+
+	for regexp, changed := range map[string]func(a *Authorization){
+		"FF22246.*authorization 1 is not signed":   func(a *Authorization) { a.S = nil },
+		"FF22246.*invalid Y-parity":                func(a *Authorization) { a.YParity = ethtypes.NewHexInteger64(27) },
+		"FF22246.*larger than 256 bits":            func(a *Authorization) { a.ChainID = (*ethtypes.HexInteger)(new(big.Int).Lsh(big.NewInt(1), 256)) },
+		"FF22246.*nonce larger than 64 bits":       func(a *Authorization) { a.Nonce = (*ethtypes.HexInteger)(new(big.Int).Lsh(big.NewInt(1), 64)) },
+		"FF22246.*authorization 1 has a value lar": func(a *Authorization) { a.R = (*ethtypes.HexInteger)(new(big.Int).Lsh(big.NewInt(1), 256)) },
+	} {
+		al := AuthorizationList{signed(), signed()}
+		changed(&al[1])
+		assert.Regexp(t, regexp, al.validate(ctx))
+	}
+
+}
+
+func TestDecodeAuthorizationListFail(t *testing.T) {
+
+	ctx := context.Background()
+
+	al, err := decodeAuthorizationList(ctx, rlp.List{})
+	assert.NoError(t, err)
+	assert.Nil(t, al)
+
+	_, err = decodeAuthorizationList(ctx, nil)
+	assert.Regexp(t, "FF22246.*not a list", err)
+
+	_, err = decodeAuthorizationList(ctx, rlp.List{rlp.Data{}})
+	assert.Regexp(t, "FF22246.*authorization 0 is not", err)
+
+	_, err = decodeAuthorizationList(ctx, rlp.List{rlp.List{rlp.Data{}, rlp.Data{}}})
+	assert.Regexp(t, "FF22246.*authorization 0 is not", err)
+
+	_, err = decodeAuthorizationList(ctx, rlp.List{rlp.List{rlp.Data{}, rlp.List{}, rlp.Data{}, rlp.Data{}, rlp.Data{}, rlp.Data{}}})
+	assert.Regexp(t, "FF22246.*authorization 0 contains a list", err)
+
+	_, err = decodeAuthorizationList(ctx, rlp.List{rlp.List{rlp.Data{}, rlp.Data{0x01}, rlp.Data{}, rlp.Data{}, rlp.Data{}, rlp.Data{}}})
+	assert.Regexp(t, "FF22246.*authorization 0 has an invalid address", err)
+
+}
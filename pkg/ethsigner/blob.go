@@ -0,0 +1,285 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+const (
+	BlobSize          = 131072 // 4096 field elements of 32 bytes
+	KZGCommitmentSize = 48
+	KZGProofSize      = 48
+
+	// blobCommitmentVersionKZG is the first byte of the versioned hash of a KZG commitment
+	blobCommitmentVersionKZG byte = 0x01
+)
+
+// KZGToVersionedHash returns the versioned hash of a KZG commitment, which is the SHA-256 hash of the
+// commitment with the first byte replaced by the version (EIP-4844)
+func KZGToVersionedHash(commitment []byte) ethtypes.HexBytes0xPrefix {
+	hash := sha256.Sum256(commitment)
+	hash[0] = blobCommitmentVersionKZG
+	return hash[:]
+}
+
+func (t *Transaction) isBlobTransaction() bool {
+	return len(t.BlobVersionedHashes) > 0 || t.MaxFeePerBlobGas.BigInt().Sign() > 0
+}
+
+func wrapDataList(items []ethtypes.HexBytes0xPrefix) rlp.List {
+	rlpList := make(rlp.List, 0, len(items))
+	for _, item := range items {
+		rlpList = append(rlpList, rlp.Data(item))
+	}
+	return rlpList
+}
+
+func normalizedBytesList(items []ethtypes.HexBytes0xPrefix) []ethtypes.HexBytes0xPrefix {
+	if len(items) == 0 {
+		return nil
+	}
+	return append([]ethtypes.HexBytes0xPrefix{}, items...)
+}
+
+// validateEIP4844 checks the transaction can be signed as a blob transaction, and that the blobs, commitments
+// and proofs (if supplied for the network encoding) match the versioned hashes. The KZG proofs are not
+// verified - the node verifies them on submission.
+func (t *Transaction) validateEIP4844(ctx context.Context) error {
+	if t.To == nil {
+		return i18n.NewError(ctx, signermsgs.MsgInvalidBlobTransaction, "a blob transaction cannot deploy a contract, so requires a 'to' address")
+	}
+	if len(t.BlobVersionedHashes) == 0 {
+		return i18n.NewError(ctx, signermsgs.MsgInvalidBlobTransaction, "at least one blob versioned hash is required")
+	}
+	for i, hash := range t.BlobVersionedHashes {
+		if len(hash) != 32 || hash[0] != blobCommitmentVersionKZG {
+			return i18n.NewError(ctx, signermsgs.MsgInvalidBlobTransaction, fmt.Sprintf("versioned hash %d is not a 32 byte KZG versioned hash", i))
+		}
+	}
+	if len(t.Blobs) == 0 && len(t.Commitments) == 0 && len(t.Proofs) == 0 {
+		return nil
+	}
+	count := len(t.BlobVersionedHashes)
+	if len(t.Blobs) != count || len(t.Commitments) != count || len(t.Proofs) != count {
+		return i18n.NewError(ctx, signermsgs.MsgInvalidBlobTransaction,
+			fmt.Sprintf("%d versioned hashes, with %d blobs, %d commitments and %d proofs", count, len(t.Blobs), len(t.Commitments), len(t.Proofs)))
+	}
+	for i := 0; i < count; i++ {
+		switch {
+		case len(t.Blobs[i]) != BlobSize:
+			return i18n.NewError(ctx, signermsgs.MsgInvalidBlobTransaction, fmt.Sprintf("blob %d is %d bytes (expected %d)", i, len(t.Blobs[i]), BlobSize))
+		case len(t.Commitments[i]) != KZGCommitmentSize:
+			return i18n.NewError(ctx, signermsgs.MsgInvalidBlobTransaction, fmt.Sprintf("commitment %d is %d bytes (expected %d)", i, len(t.Commitments[i]), KZGCommitmentSize))
+		case len(t.Proofs[i]) != KZGProofSize:
+			return i18n.NewError(ctx, signermsgs.MsgInvalidBlobTransaction, fmt.Sprintf("proof %d is %d bytes (expected %d)", i, len(t.Proofs[i]), KZGProofSize))
+		case !bytes.Equal(KZGToVersionedHash(t.Commitments[i]), t.BlobVersionedHashes[i]):
+			return i18n.NewError(ctx, signermsgs.MsgInvalidBlobTransaction, fmt.Sprintf("commitment %d does not match versioned hash %s", i, t.BlobVersionedHashes[i]))
+		}
+	}
+	return nil
+}
+
+func (t *Transaction) Build4844(chainID int64) rlp.List {
+	return t.Build4844Big(big.NewInt(chainID))
+}
+
+// Build4844Big is Build4844 for a chain ID of any size
+func (t *Transaction) Build4844Big(chainID *big.Int) rlp.List {
+	rlpList := make(rlp.List, 0, 11)
+	rlpList = append(rlpList, rlp.WrapInt(chainID))
+	rlpList = append(rlpList, rlp.WrapInt(t.Nonce.BigInt()))
+	rlpList = append(rlpList, rlp.WrapInt(t.MaxPriorityFeePerGas.BigInt()))
+	rlpList = append(rlpList, rlp.WrapInt(t.MaxFeePerGas.BigInt()))
+	rlpList = append(rlpList, rlp.WrapInt(t.GasLimit.BigInt()))
+	rlpList = append(rlpList, rlp.WrapAddress(t.To))
+	rlpList = append(rlpList, rlp.WrapInt(t.Value.BigInt()))
+	rlpList = append(rlpList, rlp.Data(t.Data))
+	rlpList = append(rlpList, t.AccessList.BuildRLP())
+	rlpList = append(rlpList, rlp.WrapInt(t.MaxFeePerBlobGas.BigInt()))
+	rlpList = append(rlpList, wrapDataList(t.BlobVersionedHashes))
+	return rlpList
+}
+
+// SignaturePayloadEIP4844 returns the rlpList of fields that are signed, along with the full
+// bytes for the signature / TX Hash - which have the transaction type prefixed
+func (t *Transaction) SignaturePayloadEIP4844(chainID int64) *TransactionSignaturePayload {
+	return t.SignaturePayloadEIP4844Big(big.NewInt(chainID))
+}
+
+// SignaturePayloadEIP4844Big is SignaturePayloadEIP4844 for a chain ID of any size
+func (t *Transaction) SignaturePayloadEIP4844Big(chainID *big.Int) *TransactionSignaturePayload {
+	rlpList := t.Build4844Big(chainID)
+
+	// keccak256(0x03 || rlp([chain_id, nonce, max_priority_fee_per_gas, max_fee_per_gas, gas_limit, to, value, data, access_list, max_fee_per_blob_gas, blob_versioned_hashes]))
+	return &TransactionSignaturePayload{
+		rlpList: rlpList,
+		data:    append([]byte{TransactionType4844}, rlpList.Encode()...),
+	}
+}
+
+// SignEIP4844 uses EIP-4844 blob transaction structure (with EIP-2718 transaction type byte), with the direct
+// 0 / 1 Y-parity V value. If the blobs, commitments and proofs are set, the result is the network encoding
+// that includes them for submission with eth_sendRawTransaction - otherwise it is the signed transaction alone.
+func (t *Transaction) SignEIP4844(signer secp256k1.Signer, chainID int64) ([]byte, error) {
+	return t.SignEIP4844Big(signer, big.NewInt(chainID))
+}
+
+// SignEIP4844Big is SignEIP4844 for a chain ID of any size
+func (t *Transaction) SignEIP4844Big(signer secp256k1.Signer, chainID *big.Int) ([]byte, error) {
+	if signer == nil {
+		return nil, i18n.NewError(context.Background(), signermsgs.MsgInvalidSigner)
+	}
+	if err := t.validateEIP4844(context.Background()); err != nil {
+		return nil, err
+	}
+
+	signaturePayload := t.SignaturePayloadEIP4844Big(chainID)
+	sig, err := signPayload(signer, signaturePayload.data)
+	if err != nil {
+		return nil, err
+	}
+	return t.FinalizeEIP4844WithSignature(signaturePayload, sig)
+}
+
+func (t *Transaction) FinalizeEIP4844WithSignature(signaturePayload *TransactionSignaturePayload, sig *secp256k1.SignatureData) ([]byte, error) {
+	// Use the direct 0/1 Y-parity value
+	sig.UpdateEIP2930()
+
+	// 0x03 || rlp([chain_id, ..., blob_versioned_hashes, y_parity, r, s])
+	rlpList := t.addSignature(signaturePayload.rlpList, sig)
+	if len(t.Blobs) == 0 {
+		return append([]byte{TransactionType4844}, rlpList.Encode()...), nil
+	}
+	// The network encoding wraps the signed transaction with the blobs, commitments and proofs:
+	// 0x03 || rlp([tx_payload_body, blobs, commitments, proofs])
+	wrapper := rlp.List{rlpList, wrapDataList(t.Blobs), wrapDataList(t.Commitments), wrapDataList(t.Proofs)}
+	return append([]byte{TransactionType4844}, wrapper.Encode()...), nil
+}
+
+// decodeEIP4844SignaturePayload decodes the RLP list of the transaction, from either the network encoding
+// (where the blobs, commitments and proofs are set on the transaction) or the signed transaction alone
+func decodeEIP4844SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int, rlpMinLen int) (rlp.List, *Transaction, error) {
+	if len(rawTx) == 0 || rawTx[0] != TransactionType4844 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP4844Transaction, "TransactionType")
+	}
+
+	rawTx = rawTx[1:]
+	decoded, _, err := rlp.Decode(rawTx)
+	if err != nil {
+		log.L(ctx).Errorf("Invalid EIP-4844 transaction data: %s", err)
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP4844Transaction, err)
+	}
+	rlpList, ok := decoded.(rlp.List)
+	var sidecar rlp.List
+	if ok && len(rlpList) == 4 && rlpList[0].IsList() {
+		sidecar = rlpList[1:]
+		rlpList = rlpList[0].(rlp.List)
+	}
+	if !ok || len(rlpList) < rlpMinLen {
+		log.L(ctx).Errorf("Invalid EIP-4844 transaction data (%d RLP elements)", len(rlpList))
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP4844Transaction, "EOF")
+	}
+	encodedChainID := rlpList[0].ToData().IntOrZero()
+	if encodedChainID.Cmp(chainID) != 0 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidChainID, chainID, encodedChainID)
+	}
+	accessList, err := decodeAccessList(ctx, rlpList[8])
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := &Transaction{
+		Nonce:                (*ethtypes.HexInteger)(rlpList[1].ToData().Int()),
+		MaxPriorityFeePerGas: (*ethtypes.HexInteger)(rlpList[2].ToData().Int()),
+		MaxFeePerGas:         (*ethtypes.HexInteger)(rlpList[3].ToData().Int()),
+		GasLimit:             (*ethtypes.HexInteger)(rlpList[4].ToData().Int()),
+		To:                   rlpList[5].ToData().Address(),
+		Value:                (*ethtypes.HexInteger)(rlpList[6].ToData().Int()),
+		Data:                 ethtypes.HexBytes0xPrefix(rlpList[7].ToData()),
+		AccessList:           accessList,
+		MaxFeePerBlobGas:     (*ethtypes.HexInteger)(rlpList[9].ToData().Int()),
+	}
+	if tx.BlobVersionedHashes, err = decodeDataList(ctx, rlpList[10], "blob versioned hashes"); err == nil && sidecar != nil {
+		if tx.Blobs, err = decodeDataList(ctx, sidecar[0], "blobs"); err == nil {
+			if tx.Commitments, err = decodeDataList(ctx, sidecar[1], "commitments"); err == nil {
+				tx.Proofs, err = decodeDataList(ctx, sidecar[2], "proofs")
+			}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return rlpList, tx, nil
+}
+
+func decodeDataList(ctx context.Context, element rlp.Element, name string) ([]ethtypes.HexBytes0xPrefix, error) {
+	if !element.IsList() {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP4844Transaction, fmt.Sprintf("%s is not a list", name))
+	}
+	var items []ethtypes.HexBytes0xPrefix
+	for _, e := range element.(rlp.List) {
+		if e.IsList() {
+			return nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP4844Transaction, fmt.Sprintf("%s contains a list", name))
+		}
+		items = append(items, ethtypes.HexBytes0xPrefix(e.ToData()))
+	}
+	return items, nil
+}
+
+func DecodeEIP4844SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*Transaction, error) {
+	return DecodeEIP4844SignaturePayloadBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// DecodeEIP4844SignaturePayloadBig is DecodeEIP4844SignaturePayload for a chain ID of any size
+func DecodeEIP4844SignaturePayloadBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*Transaction, error) {
+	_, tx, err := decodeEIP4844SignaturePayload(ctx, rawTx, chainID, 11 /* no signature data */)
+	return tx, err
+}
+
+// RecoverEIP4844Transaction recovers the signer of a blob transaction, in either the network encoding or the
+// signed transaction alone
+func RecoverEIP4844Transaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+	return RecoverEIP4844TransactionBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// RecoverEIP4844TransactionBig is RecoverEIP4844Transaction for a chain ID of any size
+func RecoverEIP4844TransactionBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+
+	rlpList, tx, err := decodeEIP4844SignaturePayload(ctx, rawTx, chainID, 14 /* with signature data */)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return recoverCommon(tx,
+		append([]byte{TransactionType4844}, (rlpList[0:11]).Encode()...),
+		chainID,
+		rlpList[11].ToData().Int(),
+		rlpList[12].ToData().BytesNotNil(),
+		rlpList[13].ToData().BytesNotNil(),
+	)
+}
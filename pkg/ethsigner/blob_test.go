@@ -0,0 +1,176 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/mocks/secp256k1mocks"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func testBlobTransaction(t *testing.T) *Transaction {
+	var txn Transaction
+	err := json.Unmarshal([]byte(`{
+		"nonce": "0x03",
+		"maxPriorityFeePerGas": "0x3b9aca00",
+		"maxFeePerGas": "0x6fc23ac00",
+		"maxFeePerBlobGas": "0x3b9aca00",
+		"gas": "0x9c40",
+		"to": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+		"value": "0x00",
+		"data": "0xabcd"
+	}`), &txn)
+	assert.NoError(t, err)
+	commitment := make([]byte, KZGCommitmentSize)
+	commitment[0] = 0xc0
+	txn.Blobs = []ethtypes.HexBytes0xPrefix{make([]byte, BlobSize)}
+	txn.Commitments = []ethtypes.HexBytes0xPrefix{commitment}
+	txn.Proofs = []ethtypes.HexBytes0xPrefix{make([]byte, KZGProofSize)}
+	txn.BlobVersionedHashes = []ethtypes.HexBytes0xPrefix{KZGToVersionedHash(commitment)}
+	return &txn
+}
+
+func TestKZGToVersionedHash(t *testing.T) {
+
+	// The versioned hash of the commitment to the zero blob (the point at infinity)
+	commitment := make([]byte, KZGCommitmentSize)
+	commitment[0] = 0xc0
+	assert.Equal(t, "0x010657f37554c781402a22917dee2f75def7ab966d7b770905398eba3c444014", KZGToVersionedHash(commitment).String())
+
+}
+
+func TestSignAutoEIP4844NetworkEncoding(t *testing.T) {
+
+	txn := testBlobTransaction(t)
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	raw, err := txn.Sign(keypair, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, TransactionType4844, raw[0])
+	assert.Equal(t, txn.SignaturePayload(1001).Bytes(), txn.SignaturePayloadEIP4844(1001).Bytes())
+
+	// The network encoding wraps the signed transaction with the sidecar
+	decodedRLP, _, err := rlp.Decode(raw[1:])
+	assert.NoError(t, err)
+	assert.Len(t, decodedRLP.(rlp.List), 4)
+	assert.Len(t, decodedRLP.(rlp.List)[0].(rlp.List), 14)
+	assert.LessOrEqual(t, decodedRLP.(rlp.List)[0].(rlp.List)[11].ToData().Int().Int64(), int64(1))
+
+	signer, txr, err := RecoverRawTransaction(context.Background(), raw, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address.String(), signer.String())
+	assert.True(t, txn.Equal(txr.Transaction))
+	assert.Equal(t, txn.Blobs, txr.Blobs)
+	assert.Equal(t, txn.Commitments, txr.Commitments)
+	assert.Equal(t, txn.Proofs, txr.Proofs)
+
+	// Without the sidecar the signed transaction is returned alone, with the same hash
+	txn.Blobs, txn.Commitments, txn.Proofs = nil, nil, nil
+	rawNoSidecar, err := txn.Sign(keypair, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, append([]byte{TransactionType4844}, decodedRLP.(rlp.List)[0].Encode()...), rawNoSidecar)
+	signer, txr, err = RecoverEIP4844Transaction(context.Background(), rawNoSidecar, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address.String(), signer.String())
+	assert.Nil(t, txr.Blobs)
+
+	// The unsigned payload can be decoded too
+	decoded, err := DecodeEIP4844SignaturePayload(context.Background(), txn.SignaturePayloadEIP4844(1001).Bytes(), 1001)
+	assert.NoError(t, err)
+	assert.True(t, txn.Equal(decoded))
+
+}
+
+func TestSignEIP4844Invalid(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	for regexp, changed := range map[string]func(tx *Transaction){
+		"FF22244.*'to' address":          func(tx *Transaction) { tx.To = nil },
+		"FF22244.*at least one":          func(tx *Transaction) { tx.BlobVersionedHashes = nil },
+		"FF22244.*versioned hash 0":      func(tx *Transaction) { tx.BlobVersionedHashes[0] = make([]byte, 32) },
+		"FF22244.*1 versioned hashes":    func(tx *Transaction) { tx.Proofs = nil },
+		"FF22244.*blob 0 is 1 bytes":     func(tx *Transaction) { tx.Blobs[0] = []byte{0x00} },
+		"FF22244.*commitment 0 is":       func(tx *Transaction) { tx.Commitments[0] = []byte{0x00} },
+		"FF22244.*proof 0 is":            func(tx *Transaction) { tx.Proofs[0] = []byte{0x00} },
+		"FF22244.*commitment 0 does not": func(tx *Transaction) { tx.Commitments[0] = make([]byte, KZGCommitmentSize) },
+	} {
+		txn := testBlobTransaction(t)
+		changed(txn)
+		_, err := txn.SignEIP4844(keypair, 1001)
+		assert.Regexp(t, regexp, err)
+	}
+
+	_, err = testBlobTransaction(t).SignEIP4844(nil, 1001)
+	assert.Regexp(t, "FF22064", err)
+
+	msn := &secp256k1mocks.Signer{}
+	msn.On("Sign", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	_, err = testBlobTransaction(t).SignEIP4844Big(msn, big.NewInt(1001))
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestRecoverEIP4844TransactionFail(t *testing.T) {
+	ctx := context.Background()
+
+	_, _, err := RecoverEIP4844Transaction(ctx, []byte{TransactionType1559}, 1001)
+	assert.Regexp(t, "FF22243.*TransactionType", err)
+
+	_, _, err = RecoverEIP4844Transaction(ctx, []byte{TransactionType4844, 0xff}, 1001)
+	assert.Regexp(t, "FF22243", err)
+
+	_, _, err = RecoverEIP4844Transaction(ctx, append([]byte{TransactionType4844}, rlp.WrapInt(big.NewInt(1)).Encode()...), 1001)
+	assert.Regexp(t, "FF22243.*EOF", err)
+
+	txn := testBlobTransaction(t)
+	_, err = DecodeEIP4844SignaturePayload(ctx, txn.SignaturePayloadEIP4844(1001).Bytes(), 1002)
+	assert.Regexp(t, "FF22086", err)
+
+	payload := txn.Build4844(1001)
+	payload[8] = rlp.Data{}
+	_, err = DecodeEIP4844SignaturePayload(ctx, append([]byte{TransactionType4844}, payload.Encode()...), 1001)
+	assert.Regexp(t, "FF22242", err)
+
+	payload = txn.Build4844(1001)
+	payload[10] = rlp.Data{}
+	_, err = DecodeEIP4844SignaturePayload(ctx, append([]byte{TransactionType4844}, payload.Encode()...), 1001)
+	assert.Regexp(t, "FF22243.*blob versioned hashes is not a list", err)
+
+	payload = txn.Build4844(1001)
+	payload[10] = rlp.List{rlp.List{}}
+	_, err = DecodeEIP4844SignaturePayload(ctx, append([]byte{TransactionType4844}, payload.Encode()...), 1001)
+	assert.Regexp(t, "FF22243.*blob versioned hashes contains a list", err)
+
+	for i, name := range []string{"blobs", "commitments", "proofs"} {
+		wrapper := rlp.List{txn.Build4844(1001), rlp.List{}, rlp.List{}, rlp.List{}}
+		wrapper[i+1] = rlp.Data{}
+		_, err = DecodeEIP4844SignaturePayload(ctx, append([]byte{TransactionType4844}, wrapper.Encode()...), 1001)
+		assert.Regexp(t, "FF22243.*"+name+" is not a list", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+// DecodedTransaction is a signed transaction parsed from its raw bytes, with the signature and the sender
+type DecodedTransaction struct {
+	*Transaction
+	Type      byte                      // the EIP-2718 transaction type, or TransactionTypeLegacy for legacy and EIP-155 transactions
+	ChainID   *big.Int                  // from the payload, or the EIP-155 V value - zero for a legacy transaction without EIP-155
+	Signature *secp256k1.SignatureData  // the V, R and S values as encoded in the transaction
+	From      *ethtypes.Address0xHex    // the sender, recovered from the signature
+	Hash      ethtypes.HexBytes0xPrefix // the transaction hash
+	Payload   []byte                    // the bytes that were hashed and signed
+}
+
+// DecodeTransaction parses a raw signed transaction of any supported type, without needing to know the chain
+// ID it was signed for. The chain ID is read from the payload of a typed transaction, or derived from the
+// V value of an EIP-155 transaction. A blob transaction in the network encoding has the hash of the signed
+// transaction within it.
+func DecodeTransaction(raw []byte) (*DecodedTransaction, error) {
+	ctx := context.Background()
+	if len(raw) == 0 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgEmptyTransactionBytes)
+	}
+
+	// Every typed transaction starts with the chain ID, and ends with the signature
+	txType, body := TransactionTypeLegacy, raw
+	if raw[0] < 0xc0 {
+		switch raw[0] {
+		case TransactionType2930, TransactionType1559, TransactionType4844, TransactionType7702:
+			txType, body = raw[0], raw[1:]
+		default:
+			return nil, i18n.NewError(ctx, signermsgs.MsgUnsupportedTransactionType, raw[0])
+		}
+	}
+	decoded, _, err := rlp.Decode(body)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidSignedTransaction, txType, err)
+	}
+	rlpList, ok := decoded.(rlp.List)
+	if ok && txType == TransactionType4844 && len(rlpList) == 4 && rlpList[0].IsList() {
+		rlpList = rlpList[0].(rlp.List)
+	}
+	if !ok || len(rlpList) < 4 || (txType == TransactionTypeLegacy && len(rlpList) < 9) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidSignedTransaction, txType, "EOF")
+	}
+	sig := &secp256k1.SignatureData{
+		V: rlpList[len(rlpList)-3].ToData().IntOrZero(),
+		R: rlpList[len(rlpList)-2].ToData().IntOrZero(),
+		S: rlpList[len(rlpList)-1].ToData().IntOrZero(),
+	}
+
+	var chainID *big.Int
+	signedBytes := raw
+	if txType == TransactionTypeLegacy {
+		chainID = legacyChainID(sig.V)
+	} else {
+		chainID = rlpList[0].ToData().IntOrZero()
+		signedBytes = append([]byte{txType}, rlpList.Encode()...)
+	}
+
+	from, tx, err := RecoverRawTransactionBig(ctx, raw, chainID)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(signedBytes)
+	return &DecodedTransaction{
+		Transaction: tx.Transaction,
+		Type:        txType,
+		ChainID:     chainID,
+		Signature:   sig,
+		From:        from,
+		Hash:        hash.Sum(nil),
+		Payload:     tx.Payload,
+	}, nil
+}
+
+// legacyChainID is the chain ID of an EIP-155 V value of (2*ChainID + 35 + Y-parity), or zero for a
+// legacy V value of 27/28 (or any other V value, which then fails recovery)
+func legacyChainID(v *big.Int) *big.Int {
+	if isLegacyV(v) || v.Cmp(big.NewInt(35)) < 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Rsh(new(big.Int).Sub(v, big.NewInt(35)), 1)
+}
@@ -0,0 +1,137 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/sha3"
+)
+
+func keccak(b []byte) ethtypes.HexBytes0xPrefix {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(b)
+	return hash.Sum(nil)
+}
+
+func TestDecodeTransactionExistingEIP1559(t *testing.T) {
+
+	// Sample from TX 0x61ca9c99c1d752fb3bda568b8566edf33ba93585c64a970566e6dfb540a5cbc1
+	raw, err := hex.DecodeString(
+		"02f89701248459682f00854e58be5c3c8302b13d943c99f2a4b366d46bcf2277639a135a6d1288eceb878e1bc9bf040000a4a0712d680000000000000000000000000000000000000000000000000000000000000001c001a0ea6e1513d716146af3a02e1497fbe7fc3b2ffb08ccb4a1bfef4eaa2a122f62dfa00ddc23aec20948a55d3e1f8afd29b5570d8d279450a472b55561ef6afe4a07ff")
+	assert.NoError(t, err)
+
+	decoded, err := DecodeTransaction(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, TransactionType1559, decoded.Type)
+	assert.Equal(t, int64(1), decoded.ChainID.Int64())
+	assert.Equal(t, "0x61ca9c99c1d752fb3bda568b8566edf33ba93585c64a970566e6dfb540a5cbc1", decoded.Hash.String())
+	assert.Equal(t, int64(0x24), decoded.Nonce.Int64())
+	assert.Equal(t, "0x3c99f2a4b366d46bcf2277639a135a6d1288eceb", decoded.To.String())
+	assert.Equal(t, int64(1), decoded.Signature.V.Int64())
+	assert.Equal(t, "ea6e1513d716146af3a02e1497fbe7fc3b2ffb08ccb4a1bfef4eaa2a122f62df", decoded.Signature.R.Text(16))
+	assert.NotNil(t, decoded.From)
+
+}
+
+func TestDecodeTransactionRoundTrip(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	to := ethtypes.MustNewAddress("0x497eedc4299dea2f2a364be10025d0ad0f702de3")
+	largeChainID := new(big.Int).Lsh(big.NewInt(1), 62)
+
+	for _, tc := range []struct {
+		name    string
+		txn     *Transaction
+		chainID *big.Int
+		txType  byte
+	}{
+		{name: "original", txn: &Transaction{GasPrice: ethtypes.NewHexInteger64(1), To: to}, chainID: big.NewInt(0), txType: TransactionTypeLegacy},
+		{name: "EIP-155", txn: &Transaction{GasPrice: ethtypes.NewHexInteger64(1), To: to}, chainID: big.NewInt(1001), txType: TransactionTypeLegacy},
+		{name: "EIP-155 large chain ID", txn: &Transaction{GasPrice: ethtypes.NewHexInteger64(1), To: to}, chainID: largeChainID, txType: TransactionTypeLegacy},
+		{name: "EIP-2930", txn: &Transaction{GasPrice: ethtypes.NewHexInteger64(1), To: to, AccessList: AccessList{{Address: *to}}}, chainID: big.NewInt(1001), txType: TransactionType2930},
+		{name: "EIP-1559", txn: &Transaction{MaxFeePerGas: ethtypes.NewHexInteger64(1), To: to}, chainID: largeChainID, txType: TransactionType1559},
+		{name: "EIP-4844", txn: testBlobTransaction(t), chainID: big.NewInt(1001), txType: TransactionType4844},
+		{name: "EIP-7702", txn: testSetCodeTransaction(t, keypair), chainID: big.NewInt(1001), txType: TransactionType7702},
+	} {
+		raw, err := tc.txn.SignBig(keypair, tc.chainID)
+		assert.NoError(t, err, tc.name)
+
+		decoded, err := DecodeTransaction(raw)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.txType, decoded.Type, tc.name)
+		assert.Equal(t, tc.chainID.String(), decoded.ChainID.String(), tc.name)
+		assert.Equal(t, keypair.Address, *decoded.From, tc.name)
+		assert.True(t, tc.txn.Equal(decoded.Transaction), tc.name)
+		assert.Equal(t, tc.txn.SignaturePayloadBig(tc.chainID).Bytes(), decoded.Payload, tc.name)
+		if tc.txType != TransactionType4844 {
+			assert.Equal(t, keccak(raw), decoded.Hash, tc.name)
+		}
+	}
+
+}
+
+func TestDecodeTransactionBlobNetworkEncoding(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	txn := testBlobTransaction(t)
+	wrapped, err := txn.Sign(keypair, 1001)
+	assert.NoError(t, err)
+	txn.Blobs, txn.Commitments, txn.Proofs = nil, nil, nil
+	signed, err := txn.Sign(keypair, 1001)
+	assert.NoError(t, err)
+
+	// The hash is of the signed transaction, without the blobs
+	decoded, err := DecodeTransaction(wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, keccak(signed), decoded.Hash)
+	assert.Len(t, decoded.Blobs, 1)
+
+}
+
+func TestDecodeTransactionFail(t *testing.T) {
+
+	_, err := DecodeTransaction(nil)
+	assert.Regexp(t, "FF22081", err)
+
+	_, err = DecodeTransaction([]byte{0x05})
+	assert.Regexp(t, "FF22082.*0x05", err)
+
+	_, err = DecodeTransaction([]byte{TransactionType1559, 0xff})
+	assert.Regexp(t, "FF22248.*0x02", err)
+
+	_, err = DecodeTransaction(append([]byte{TransactionType1559}, rlp.WrapInt(big.NewInt(1)).Encode()...))
+	assert.Regexp(t, "FF22248.*0x02.*EOF", err)
+
+	_, err = DecodeTransaction(rlp.List{rlp.Data{}, rlp.Data{}, rlp.Data{}, rlp.Data{}}.Encode())
+	assert.Regexp(t, "FF22248.*0x00.*EOF", err)
+
+	// Neither 27/28 nor an EIP-155 V value
+	legacy := (&Transaction{}).BuildLegacy()
+	legacy = append(legacy, rlp.WrapInt(big.NewInt(30)), rlp.WrapInt(big.NewInt(1)), rlp.WrapInt(big.NewInt(1)))
+	_, err = DecodeTransaction(legacy.Encode())
+	assert.Regexp(t, "FF22085", err)
+
+}
@@ -0,0 +1,76 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+// PersonalMessagePrefix starts the EIP-191 (version 0x45) envelope of a personal message, followed by the
+// decimal length of the message and then the message itself
+const PersonalMessagePrefix = "\x19Ethereum Signed Message:\n"
+
+// PersonalMessage returns the EIP-191 envelope of the message, which is what is hashed and signed
+func PersonalMessage(message []byte) []byte {
+	envelope := make([]byte, 0, len(PersonalMessagePrefix)+20+len(message))
+	envelope = append(envelope, PersonalMessagePrefix...)
+	envelope = strconv.AppendInt(envelope, int64(len(message)), 10)
+	return append(envelope, message...)
+}
+
+// PersonalMessageHash returns the Keccak-256 hash of the EIP-191 envelope of the message
+func PersonalMessageHash(message []byte) ethtypes.HexBytes0xPrefix {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(PersonalMessage(message))
+	return hash.Sum(nil)
+}
+
+// SignPersonalMessage signs the message in the EIP-191 envelope (as personal_sign / eth_sign do), returning
+// the 65 byte R, S, V signature with a V value of 27 or 28. The message is not hashed first, so pass the bytes
+// the user is shown.
+func SignPersonalMessage(ctx context.Context, signer secp256k1.Signer, message []byte) (ethtypes.HexBytes0xPrefix, error) {
+	if signer == nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidSigner)
+	}
+	sig, err := signPayload(signer, PersonalMessage(message))
+	if err != nil {
+		return nil, err
+	}
+	if sig.V.Cmp(big.NewInt(1)) <= 0 {
+		// Some signers return the direct 0/1 Y-parity
+		sig.V = new(big.Int).Add(sig.V, big.NewInt(27))
+	}
+	return sig.CompactRSV(), nil
+}
+
+// RecoverPersonalMessage returns the address that signed the message with SignPersonalMessage, from a 65 byte
+// R, S, V signature with a V value of 27/28 or 0/1. Compare the result to the expected address to verify it.
+func RecoverPersonalMessage(ctx context.Context, message []byte, signature []byte) (*ethtypes.Address0xHex, error) {
+	sig, err := secp256k1.DecodeCompactRSV(ctx, signature)
+	if err != nil {
+		return nil, err
+	}
+	return sig.RecoverDirect(PersonalMessageHash(message), 0)
+}
@@ -0,0 +1,95 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/mocks/secp256k1mocks"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSignPersonalMessage(t *testing.T) {
+
+	// Test data taken from:
+	// https://github.com/web3j/web3j/blob/master/crypto/src/test/java/org/web3j/crypto/SignTest.java
+	ctx := context.Background()
+	keyBytes, err := hex.DecodeString("a392604efc2fad9c0b3da43b5f698a2e3f270f170d859912be0d54742275c5f6")
+	assert.NoError(t, err)
+	keypair, err := secp256k1.NewSecp256k1KeyPair(keyBytes)
+	assert.NoError(t, err)
+	message := []byte("A test message")
+
+	assert.Equal(t, "\x19Ethereum Signed Message:\n14A test message", string(PersonalMessage(message)))
+
+	sig, err := SignPersonalMessage(ctx, keypair, message)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x0464eee9e2fe1a10ffe48c78b80de1ed8dcf996f3f60955cb2e03cb21903d930"+
+		"06624da478b3f862582e85b31c6a21c6cae2eee2bd50f55c93c4faad9d9c8d7f"+
+		"1c", sig.String())
+
+	signer, err := RecoverPersonalMessage(ctx, message, sig)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xef678007d18427e6022059dbc264f27507cd1ffc", signer.String())
+
+	// A 0/1 Y-parity is accepted too
+	sig[64] -= 27
+	signer, err = RecoverPersonalMessage(ctx, message, sig)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xef678007d18427e6022059dbc264f27507cd1ffc", signer.String())
+
+	// A different message recovers a different address
+	signer, err = RecoverPersonalMessage(ctx, []byte("Another message"), sig)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "0xef678007d18427e6022059dbc264f27507cd1ffc", signer.String())
+
+}
+
+func TestSignPersonalMessageYParity(t *testing.T) {
+
+	msn := &secp256k1mocks.Signer{}
+	msn.On("Sign", mock.Anything).Return(&secp256k1.SignatureData{V: big.NewInt(1), R: big.NewInt(2), S: big.NewInt(3)}, nil)
+	sig, err := SignPersonalMessage(context.Background(), msn, []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, byte(28), sig[64])
+
+}
+
+func TestSignPersonalMessageFail(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := SignPersonalMessage(ctx, nil, []byte("hello"))
+	assert.Regexp(t, "FF22064", err)
+
+	msn := &secp256k1mocks.Signer{}
+	msn.On("Sign", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	_, err = SignPersonalMessage(ctx, msn, []byte("hello"))
+	assert.Regexp(t, "pop", err)
+
+	_, err = RecoverPersonalMessage(ctx, []byte("hello"), []byte{0x01})
+	assert.Regexp(t, "FF22087", err)
+
+	_, err = RecoverPersonalMessage(ctx, []byte("hello"), make([]byte, 65))
+	assert.Error(t, err)
+
+}
@@ -0,0 +1,175 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+func (t *Transaction) Build7702(chainID int64) rlp.List {
+	return t.Build7702Big(big.NewInt(chainID))
+}
+
+// Build7702Big is Build7702 for a chain ID of any size
+func (t *Transaction) Build7702Big(chainID *big.Int) rlp.List {
+	rlpList := make(rlp.List, 0, 10)
+	rlpList = append(rlpList, rlp.WrapInt(chainID))
+	rlpList = append(rlpList, rlp.WrapInt(t.Nonce.BigInt()))
+	rlpList = append(rlpList, rlp.WrapInt(t.MaxPriorityFeePerGas.BigInt()))
+	rlpList = append(rlpList, rlp.WrapInt(t.MaxFeePerGas.BigInt()))
+	rlpList = append(rlpList, rlp.WrapInt(t.GasLimit.BigInt()))
+	rlpList = append(rlpList, rlp.WrapAddress(t.To))
+	rlpList = append(rlpList, rlp.WrapInt(t.Value.BigInt()))
+	rlpList = append(rlpList, rlp.Data(t.Data))
+	rlpList = append(rlpList, t.AccessList.BuildRLP())
+	rlpList = append(rlpList, t.AuthorizationList.BuildRLP())
+	return rlpList
+}
+
+// SignaturePayloadEIP7702 returns the rlpList of fields that are signed, along with the full
+// bytes for the signature / TX Hash - which have the transaction type prefixed
+func (t *Transaction) SignaturePayloadEIP7702(chainID int64) *TransactionSignaturePayload {
+	return t.SignaturePayloadEIP7702Big(big.NewInt(chainID))
+}
+
+// SignaturePayloadEIP7702Big is SignaturePayloadEIP7702 for a chain ID of any size
+func (t *Transaction) SignaturePayloadEIP7702Big(chainID *big.Int) *TransactionSignaturePayload {
+	rlpList := t.Build7702Big(chainID)
+
+	// keccak256(0x04 || rlp([chain_id, nonce, max_priority_fee_per_gas, max_fee_per_gas, gas_limit, destination, value, data, access_list, authorization_list]))
+	return &TransactionSignaturePayload{
+		rlpList: rlpList,
+		data:    append([]byte{TransactionType7702}, rlpList.Encode()...),
+	}
+}
+
+// SignEIP7702 uses EIP-7702 set code transaction structure (with EIP-2718 transaction type byte), with the
+// direct 0 / 1 Y-parity V value. Each authorization must already be signed by its authorizing account
+// (see Authorization.Sign), which need not be the account that signs the transaction.
+func (t *Transaction) SignEIP7702(signer secp256k1.Signer, chainID int64) ([]byte, error) {
+	return t.SignEIP7702Big(signer, big.NewInt(chainID))
+}
+
+// SignEIP7702Big is SignEIP7702 for a chain ID of any size
+func (t *Transaction) SignEIP7702Big(signer secp256k1.Signer, chainID *big.Int) ([]byte, error) {
+	if signer == nil {
+		return nil, i18n.NewError(context.Background(), signermsgs.MsgInvalidSigner)
+	}
+	if t.To == nil {
+		return nil, i18n.NewError(context.Background(), signermsgs.MsgInvalidEIP7702Transaction, "a set code transaction cannot deploy a contract, so requires a 'to' address")
+	}
+	if err := t.AuthorizationList.validate(context.Background()); err != nil {
+		return nil, err
+	}
+
+	signaturePayload := t.SignaturePayloadEIP7702Big(chainID)
+	sig, err := signPayload(signer, signaturePayload.data)
+	if err != nil {
+		return nil, err
+	}
+	return t.FinalizeEIP7702WithSignature(signaturePayload, sig)
+}
+
+func (t *Transaction) FinalizeEIP7702WithSignature(signaturePayload *TransactionSignaturePayload, sig *secp256k1.SignatureData) ([]byte, error) {
+	// Use the direct 0/1 Y-parity value
+	sig.UpdateEIP2930()
+
+	// 0x04 || rlp([chain_id, ..., access_list, authorization_list, y_parity, r, s])
+	rlpList := t.addSignature(signaturePayload.rlpList, sig)
+	return append([]byte{TransactionType7702}, rlpList.Encode()...), nil
+}
+
+func decodeEIP7702SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int, rlpMinLen int) (rlp.List, *Transaction, error) {
+	if len(rawTx) == 0 || rawTx[0] != TransactionType7702 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP7702Transaction, "TransactionType")
+	}
+
+	rawTx = rawTx[1:]
+	decoded, _, err := rlp.Decode(rawTx)
+	if err != nil {
+		log.L(ctx).Errorf("Invalid EIP-7702 transaction data: %s", err)
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP7702Transaction, err)
+	}
+	rlpList, ok := decoded.(rlp.List)
+	if !ok || len(rlpList) < rlpMinLen {
+		log.L(ctx).Errorf("Invalid EIP-7702 transaction data (%d RLP elements)", len(rlpList))
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP7702Transaction, "EOF")
+	}
+	encodedChainID := rlpList[0].ToData().IntOrZero()
+	if encodedChainID.Cmp(chainID) != 0 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidChainID, chainID, encodedChainID)
+	}
+	accessList, err := decodeAccessList(ctx, rlpList[8])
+	if err != nil {
+		return nil, nil, err
+	}
+	authorizationList, err := decodeAuthorizationList(ctx, rlpList[9])
+	if err != nil {
+		return nil, nil, err
+	}
+	return rlpList, &Transaction{
+		Nonce:                (*ethtypes.HexInteger)(rlpList[1].ToData().Int()),
+		MaxPriorityFeePerGas: (*ethtypes.HexInteger)(rlpList[2].ToData().Int()),
+		MaxFeePerGas:         (*ethtypes.HexInteger)(rlpList[3].ToData().Int()),
+		GasLimit:             (*ethtypes.HexInteger)(rlpList[4].ToData().Int()),
+		To:                   rlpList[5].ToData().Address(),
+		Value:                (*ethtypes.HexInteger)(rlpList[6].ToData().Int()),
+		Data:                 ethtypes.HexBytes0xPrefix(rlpList[7].ToData()),
+		AccessList:           accessList,
+		AuthorizationList:    authorizationList,
+	}, nil
+}
+
+func DecodeEIP7702SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*Transaction, error) {
+	return DecodeEIP7702SignaturePayloadBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// DecodeEIP7702SignaturePayloadBig is DecodeEIP7702SignaturePayload for a chain ID of any size
+func DecodeEIP7702SignaturePayloadBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*Transaction, error) {
+	_, tx, err := decodeEIP7702SignaturePayload(ctx, rawTx, chainID, 10 /* no signature data */)
+	return tx, err
+}
+
+func RecoverEIP7702Transaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+	return RecoverEIP7702TransactionBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// RecoverEIP7702TransactionBig is RecoverEIP7702Transaction for a chain ID of any size. The address returned
+// is the sender of the transaction - use Authorization.RecoverAuthority for the signer of each authorization.
+func RecoverEIP7702TransactionBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+
+	rlpList, tx, err := decodeEIP7702SignaturePayload(ctx, rawTx, chainID, 13 /* with signature data */)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return recoverCommon(tx,
+		append([]byte{TransactionType7702}, (rlpList[0:10]).Encode()...),
+		chainID,
+		rlpList[10].ToData().Int(),
+		rlpList[11].ToData().BytesNotNil(),
+		rlpList[12].ToData().BytesNotNil(),
+	)
+}
@@ -0,0 +1,142 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/mocks/secp256k1mocks"
+	"github.com/hyperledger/firefly-signer/pkg/rlp"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func testSetCodeTransaction(t *testing.T, authority *secp256k1.KeyPair) *Transaction {
+	var txn Transaction
+	err := json.Unmarshal([]byte(`{
+		"nonce": "0x03",
+		"maxPriorityFeePerGas": "0x3b9aca00",
+		"maxFeePerGas": "0x6fc23ac00",
+		"gas": "0x9c40",
+		"to": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+		"value": "0x00",
+		"data": "0xabcd",
+		"authorizationList": [{
+			"chainId": "0x3e9",
+			"address": "0x1f185718734552d08278aa70f804580bab5fd2b4",
+			"nonce": "0x00"
+		}]
+	}`), &txn)
+	assert.NoError(t, err)
+	assert.NoError(t, txn.AuthorizationList[0].Sign(authority))
+	return &txn
+}
+
+func TestSignAutoEIP7702(t *testing.T) {
+
+	sender, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	authority, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	txn := testSetCodeTransaction(t, authority)
+
+	raw, err := txn.Sign(sender, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, TransactionType7702, raw[0])
+	assert.Equal(t, txn.SignaturePayload(1001).Bytes(), txn.SignaturePayloadEIP7702(1001).Bytes())
+
+	signer, txr, err := RecoverRawTransaction(context.Background(), raw, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, sender.Address.String(), signer.String())
+	assert.True(t, txn.Equal(txr.Transaction))
+	assert.Equal(t, txn.Normalize(), txr.Normalize())
+
+	// The authority of each authorization is recovered separately to the sender
+	recovered, err := txr.AuthorizationList[0].RecoverAuthority()
+	assert.NoError(t, err)
+	assert.Equal(t, authority.Address.String(), recovered.String())
+
+	// The unsigned payload can be decoded too
+	decoded, err := DecodeEIP7702SignaturePayload(context.Background(), txn.SignaturePayloadEIP7702(1001).Bytes(), 1001)
+	assert.NoError(t, err)
+	assert.True(t, txn.Equal(decoded))
+
+	// The V value is the direct Y-parity
+	decodedRLP, _, err := rlp.Decode(raw[1:])
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, decodedRLP.(rlp.List)[10].ToData().Int().Int64(), int64(1))
+
+}
+
+func TestSignEIP7702Error(t *testing.T) {
+
+	authority, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	_, err = testSetCodeTransaction(t, authority).SignEIP7702(nil, 1001)
+	assert.Regexp(t, "FF22064", err)
+
+	txn := testSetCodeTransaction(t, authority)
+	txn.To = nil
+	_, err = txn.SignEIP7702(authority, 1001)
+	assert.Regexp(t, "FF22245.*'to' address", err)
+
+	txn = testSetCodeTransaction(t, authority)
+	txn.AuthorizationList[0].R = nil
+	_, err = txn.SignEIP7702(authority, 1001)
+	assert.Regexp(t, "FF22246.*not signed", err)
+
+	msn := &secp256k1mocks.Signer{}
+	msn.On("Sign", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	_, err = testSetCodeTransaction(t, authority).SignEIP7702Big(msn, big.NewInt(1001))
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestRecoverEIP7702TransactionFail(t *testing.T) {
+	ctx := context.Background()
+
+	_, _, err := RecoverEIP7702Transaction(ctx, []byte{TransactionType1559}, 1001)
+	assert.Regexp(t, "FF22245.*TransactionType", err)
+
+	_, _, err = RecoverEIP7702Transaction(ctx, []byte{TransactionType7702, 0xff}, 1001)
+	assert.Regexp(t, "FF22245", err)
+
+	_, _, err = RecoverEIP7702Transaction(ctx, append([]byte{TransactionType7702}, rlp.WrapInt(big.NewInt(1)).Encode()...), 1001)
+	assert.Regexp(t, "FF22245.*EOF", err)
+
+	authority, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	txn := testSetCodeTransaction(t, authority)
+	_, err = DecodeEIP7702SignaturePayload(ctx, txn.SignaturePayloadEIP7702(1001).Bytes(), 1002)
+	assert.Regexp(t, "FF22086", err)
+
+	payload := txn.Build7702(1001)
+	payload[8] = rlp.Data{}
+	_, err = DecodeEIP7702SignaturePayload(ctx, append([]byte{TransactionType7702}, payload.Encode()...), 1001)
+	assert.Regexp(t, "FF22242", err)
+
+	payload = txn.Build7702(1001)
+	payload[9] = rlp.Data{}
+	_, err = DecodeEIP7702SignaturePayload(ctx, append([]byte{TransactionType7702}, payload.Encode()...), 1001)
+	assert.Regexp(t, "FF22246", err)
+}
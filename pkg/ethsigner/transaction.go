@@ -17,6 +17,7 @@
 package ethsigner
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -48,20 +49,29 @@ func (sp *TransactionSignaturePayload) Hash() ethtypes.HexBytes0xPrefix {
 
 const (
 	TransactionTypeLegacy byte = 0x00
-	TransactionType2930   byte = 0x01 // unused
+	TransactionType2930   byte = 0x01
 	TransactionType1559   byte = 0x02
+	TransactionType4844   byte = 0x03
+	TransactionType7702   byte = 0x04
 )
 
 type Transaction struct {
-	From                 json.RawMessage           `ffstruct:"EthTransaction" json:"from,omitempty"` // only here as a possible input to signing key selection (eth_sendTransaction)
-	Nonce                *ethtypes.HexInteger      `ffstruct:"EthTransaction" json:"nonce,omitempty"`
-	GasPrice             *ethtypes.HexInteger      `ffstruct:"EthTransaction" json:"gasPrice,omitempty"`
-	MaxPriorityFeePerGas *ethtypes.HexInteger      `ffstruct:"EthTransaction" json:"maxPriorityFeePerGas,omitempty"`
-	MaxFeePerGas         *ethtypes.HexInteger      `ffstruct:"EthTransaction" json:"maxFeePerGas,omitempty"`
-	GasLimit             *ethtypes.HexInteger      `ffstruct:"EthTransaction" json:"gas,omitempty"` // note this is required for some methods (eth_estimateGas)
-	To                   *ethtypes.Address0xHex    `ffstruct:"EthTransaction" json:"to,omitempty"`
-	Value                *ethtypes.HexInteger      `ffstruct:"EthTransaction" json:"value,omitempty"`
-	Data                 ethtypes.HexBytes0xPrefix `ffstruct:"EthTransaction" json:"data"`
+	From                 json.RawMessage             `ffstruct:"EthTransaction" json:"from,omitempty"` // only here as a possible input to signing key selection (eth_sendTransaction)
+	Nonce                *ethtypes.HexInteger        `ffstruct:"EthTransaction" json:"nonce,omitempty"`
+	GasPrice             *ethtypes.HexInteger        `ffstruct:"EthTransaction" json:"gasPrice,omitempty"`
+	MaxPriorityFeePerGas *ethtypes.HexInteger        `ffstruct:"EthTransaction" json:"maxPriorityFeePerGas,omitempty"`
+	MaxFeePerGas         *ethtypes.HexInteger        `ffstruct:"EthTransaction" json:"maxFeePerGas,omitempty"`
+	GasLimit             *ethtypes.HexInteger        `ffstruct:"EthTransaction" json:"gas,omitempty"` // note this is required for some methods (eth_estimateGas)
+	To                   *ethtypes.Address0xHex      `ffstruct:"EthTransaction" json:"to,omitempty"`
+	Value                *ethtypes.HexInteger        `ffstruct:"EthTransaction" json:"value,omitempty"`
+	Data                 ethtypes.HexBytes0xPrefix   `ffstruct:"EthTransaction" json:"data"`
+	AccessList           AccessList                  `ffstruct:"EthTransaction" json:"accessList,omitempty"`
+	MaxFeePerBlobGas     *ethtypes.HexInteger        `ffstruct:"EthTransaction" json:"maxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes  []ethtypes.HexBytes0xPrefix `ffstruct:"EthTransaction" json:"blobVersionedHashes,omitempty"`
+	Blobs                []ethtypes.HexBytes0xPrefix `ffstruct:"EthTransaction" json:"blobs,omitempty"`       // not signed - only in the network encoding
+	Commitments          []ethtypes.HexBytes0xPrefix `ffstruct:"EthTransaction" json:"commitments,omitempty"` // not signed - only in the network encoding
+	Proofs               []ethtypes.HexBytes0xPrefix `ffstruct:"EthTransaction" json:"proofs,omitempty"`      // not signed - only in the network encoding
+	AuthorizationList    AuthorizationList           `ffstruct:"EthTransaction" json:"authorizationList,omitempty"`
 }
 
 type TransactionWithOriginalPayload struct {
@@ -81,8 +91,13 @@ func (t *Transaction) BuildLegacy() rlp.List {
 }
 
 func AddEIP155HashValuesToRLPList(rlpList rlp.List, chainID int64) rlp.List {
+	return AddEIP155HashValuesToRLPListBig(rlpList, big.NewInt(chainID))
+}
+
+// AddEIP155HashValuesToRLPListBig is AddEIP155HashValuesToRLPList for a chain ID of any size
+func AddEIP155HashValuesToRLPListBig(rlpList rlp.List, chainID *big.Int) rlp.List {
 	// These values go into the hash of the transaction
-	rlpList = append(rlpList, rlp.WrapInt(big.NewInt(chainID)))
+	rlpList = append(rlpList, rlp.WrapInt(chainID))
 	rlpList = append(rlpList, rlp.WrapInt(big.NewInt(0)))
 	rlpList = append(rlpList, rlp.WrapInt(big.NewInt(0)))
 	return rlpList
@@ -93,8 +108,13 @@ func (t *Transaction) AddEIP155HashValues(rlpList rlp.List, chainID int64) rlp.L
 }
 
 func (t *Transaction) Build1559(chainID int64) rlp.List {
+	return t.Build1559Big(big.NewInt(chainID))
+}
+
+// Build1559Big is Build1559 for a chain ID of any size
+func (t *Transaction) Build1559Big(chainID *big.Int) rlp.List {
 	rlpList := make(rlp.List, 0, 9)
-	rlpList = append(rlpList, rlp.WrapInt(big.NewInt(chainID)))
+	rlpList = append(rlpList, rlp.WrapInt(chainID))
 	rlpList = append(rlpList, rlp.WrapInt(t.Nonce.BigInt()))
 	rlpList = append(rlpList, rlp.WrapInt(t.MaxPriorityFeePerGas.BigInt()))
 	rlpList = append(rlpList, rlp.WrapInt(t.MaxFeePerGas.BigInt()))
@@ -102,31 +122,82 @@ func (t *Transaction) Build1559(chainID int64) rlp.List {
 	rlpList = append(rlpList, rlp.WrapAddress(t.To))
 	rlpList = append(rlpList, rlp.WrapInt(t.Value.BigInt()))
 	rlpList = append(rlpList, rlp.Data(t.Data))
-	rlpList = append(rlpList, rlp.List{}) // access list not currently supported
+	rlpList = append(rlpList, t.AccessList.BuildRLP())
+	return rlpList
+}
+
+func (t *Transaction) Build2930(chainID int64) rlp.List {
+	return t.Build2930Big(big.NewInt(chainID))
+}
+
+// Build2930Big is Build2930 for a chain ID of any size
+func (t *Transaction) Build2930Big(chainID *big.Int) rlp.List {
+	rlpList := make(rlp.List, 0, 8)
+	rlpList = append(rlpList, rlp.WrapInt(chainID))
+	rlpList = append(rlpList, rlp.WrapInt(t.Nonce.BigInt()))
+	rlpList = append(rlpList, rlp.WrapInt(t.GasPrice.BigInt()))
+	rlpList = append(rlpList, rlp.WrapInt(t.GasLimit.BigInt()))
+	rlpList = append(rlpList, rlp.WrapAddress(t.To))
+	rlpList = append(rlpList, rlp.WrapInt(t.Value.BigInt()))
+	rlpList = append(rlpList, rlp.Data(t.Data))
+	rlpList = append(rlpList, t.AccessList.BuildRLP())
 	return rlpList
 }
 
 // Automatically pick signer, based on input fields.
+// - If there is an authorization list, use EIP-7702
+// - If there are blob versioned hashes, or a max fee per blob gas, use EIP-4844
 // - If either of the new EIP-1559 fields are set, use EIP-1559
+// - If there is an access list (without the EIP-1559 fields), use EIP-2930
+// - For chain ID 0 (a network from before EIP-155) use legacy-legacy (non EIP-155) signing
 // - By default use EIP-155 signing
-// Never picks legacy-legacy (non EIP-155), or EIP-2930
 func (t *Transaction) Sign(signer secp256k1.Signer, chainID int64) ([]byte, error) {
+	return t.SignBig(signer, big.NewInt(chainID))
+}
+
+// SignBig is Sign for a chain ID of any size
+func (t *Transaction) SignBig(signer secp256k1.Signer, chainID *big.Int) ([]byte, error) {
 	if signer == nil {
 		return nil, i18n.NewError(context.Background(), signermsgs.MsgInvalidSigner)
 	}
-	if t.MaxPriorityFeePerGas.BigInt().Sign() > 0 || t.MaxFeePerGas.BigInt().Sign() > 0 {
-		return t.SignEIP1559(signer, chainID)
+	switch {
+	case len(t.AuthorizationList) > 0:
+		return t.SignEIP7702Big(signer, chainID)
+	case t.isBlobTransaction():
+		return t.SignEIP4844Big(signer, chainID)
+	case t.MaxPriorityFeePerGas.BigInt().Sign() > 0 || t.MaxFeePerGas.BigInt().Sign() > 0:
+		return t.SignEIP1559Big(signer, chainID)
+	case len(t.AccessList) > 0:
+		return t.SignEIP2930Big(signer, chainID)
+	case chainID.Sign() == 0:
+		return t.SignLegacyOriginal(signer)
+	default:
+		return t.SignLegacyEIP155Big(signer, chainID)
 	}
-	return t.SignLegacyEIP155(signer, chainID)
 }
 
 // Returns the bytes that would be used to sign the transaction, without actually
 // perform the signing. Can be used with Recover to verify a signing result.
 func (t *Transaction) SignaturePayload(chainID int64) (sp *TransactionSignaturePayload) {
-	if t.MaxPriorityFeePerGas.BigInt().Sign() > 0 || t.MaxFeePerGas.BigInt().Sign() > 0 {
-		return t.SignaturePayloadEIP1559(chainID)
+	return t.SignaturePayloadBig(big.NewInt(chainID))
+}
+
+// SignaturePayloadBig is SignaturePayload for a chain ID of any size
+func (t *Transaction) SignaturePayloadBig(chainID *big.Int) (sp *TransactionSignaturePayload) {
+	switch {
+	case len(t.AuthorizationList) > 0:
+		return t.SignaturePayloadEIP7702Big(chainID)
+	case t.isBlobTransaction():
+		return t.SignaturePayloadEIP4844Big(chainID)
+	case t.MaxPriorityFeePerGas.BigInt().Sign() > 0 || t.MaxFeePerGas.BigInt().Sign() > 0:
+		return t.SignaturePayloadEIP1559Big(chainID)
+	case len(t.AccessList) > 0:
+		return t.SignaturePayloadEIP2930Big(chainID)
+	case chainID.Sign() == 0:
+		return t.SignaturePayloadLegacyOriginal()
+	default:
+		return t.SignaturePayloadLegacyEIP155Big(chainID)
 	}
-	return t.SignaturePayloadLegacyEIP155(chainID)
 }
 
 // SignaturePayloadLegacyOriginal returns the rlpList of fields that are signed, and the
@@ -146,13 +217,26 @@ func (t *Transaction) SignLegacyOriginal(signer secp256k1.Signer) ([]byte, error
 		return nil, i18n.NewError(context.Background(), signermsgs.MsgInvalidSigner)
 	}
 	signaturePayload := t.SignaturePayloadLegacyOriginal()
-	sig, err := signer.Sign(signaturePayload.data)
+	sig, err := signPayload(signer, signaturePayload.data)
 	if err != nil {
 		return nil, err
 	}
 	return t.FinalizeLegacyOriginalWithSignature(signaturePayload, sig)
 }
 
+// signPayload hashes the payload once here for a signer that only accepts a digest, otherwise the
+// signer performs the hash
+func signPayload(signer secp256k1.Signer, payload []byte) (*secp256k1.SignatureData, error) {
+	if digestSigner, ok := signer.(secp256k1.SignerDigest); ok {
+		var digest [32]byte
+		hash := sha3.NewLegacyKeccak256()
+		hash.Write(payload)
+		copy(digest[:], hash.Sum(nil))
+		return digestSigner.SignDigest(digest)
+	}
+	return signer.Sign(payload)
+}
+
 func (t *Transaction) FinalizeLegacyOriginalWithSignature(signaturePayload *TransactionSignaturePayload, sig *secp256k1.SignatureData) ([]byte, error) {
 	rlpList := t.addSignature(signaturePayload.rlpList, sig)
 	return rlpList.Encode(), nil
@@ -162,8 +246,13 @@ func (t *Transaction) FinalizeLegacyOriginalWithSignature(signaturePayload *Tran
 // bytes. Note that for legacy and EIP-155 transactions (everything prior to EIP-2718),
 // there is no transaction type byte added (so the bytes are exactly rlpList.Encode())
 func (t *Transaction) SignaturePayloadLegacyEIP155(chainID int64) *TransactionSignaturePayload {
+	return t.SignaturePayloadLegacyEIP155Big(big.NewInt(chainID))
+}
+
+// SignaturePayloadLegacyEIP155Big is SignaturePayloadLegacyEIP155 for a chain ID of any size
+func (t *Transaction) SignaturePayloadLegacyEIP155Big(chainID *big.Int) *TransactionSignaturePayload {
 	rlpList := t.BuildLegacy()
-	rlpList = t.AddEIP155HashValues(rlpList, chainID)
+	rlpList = AddEIP155HashValuesToRLPListBig(rlpList, chainID)
 	return &TransactionSignaturePayload{
 		rlpList: rlpList,
 		data:    rlpList.Encode(),
@@ -172,22 +261,32 @@ func (t *Transaction) SignaturePayloadLegacyEIP155(chainID int64) *TransactionSi
 
 // SignLegacyEIP155 uses legacy transaction structure, with EIP-155 signing V value (2*ChainID + 35 + Y-parity)
 func (t *Transaction) SignLegacyEIP155(signer secp256k1.Signer, chainID int64) ([]byte, error) {
+	return t.SignLegacyEIP155Big(signer, big.NewInt(chainID))
+}
+
+// SignLegacyEIP155Big is SignLegacyEIP155 for a chain ID of any size
+func (t *Transaction) SignLegacyEIP155Big(signer secp256k1.Signer, chainID *big.Int) ([]byte, error) {
 	if signer == nil {
 		return nil, fmt.Errorf("invalid signer")
 	}
 
-	signaturePayload := t.SignaturePayloadLegacyEIP155(chainID)
+	signaturePayload := t.SignaturePayloadLegacyEIP155Big(chainID)
 
-	sig, err := signer.Sign(signaturePayload.data)
+	sig, err := signPayload(signer, signaturePayload.data)
 	if err != nil {
 		return nil, err
 	}
-	return t.FinalizeLegacyEIP155WithSignature(signaturePayload, sig, chainID)
+	return t.FinalizeLegacyEIP155WithSignatureBig(signaturePayload, sig, chainID)
 }
 
 func (t *Transaction) FinalizeLegacyEIP155WithSignature(signaturePayload *TransactionSignaturePayload, sig *secp256k1.SignatureData, chainID int64) ([]byte, error) {
+	return t.FinalizeLegacyEIP155WithSignatureBig(signaturePayload, sig, big.NewInt(chainID))
+}
+
+// FinalizeLegacyEIP155WithSignatureBig is FinalizeLegacyEIP155WithSignature for a chain ID of any size
+func (t *Transaction) FinalizeLegacyEIP155WithSignatureBig(signaturePayload *TransactionSignaturePayload, sig *secp256k1.SignatureData, chainID *big.Int) ([]byte, error) {
 	// Use the EIP-155 V value, of (2*ChainID + 35 + Y-parity)
-	sig.UpdateEIP155(chainID)
+	sig.UpdateEIP155Big(chainID)
 
 	rlpList := t.addSignature(signaturePayload.rlpList[0:6] /* we don't include the chainID+0+0 hash values in the payload */, sig)
 	return rlpList.Encode(), nil
@@ -196,7 +295,12 @@ func (t *Transaction) FinalizeLegacyEIP155WithSignature(signaturePayload *Transa
 // SignaturePayloadEIP1559 returns the rlpList of fields that are signed, along with the full
 // bytes for the signature / TX Hash - which have the transaction type prefixed
 func (t *Transaction) SignaturePayloadEIP1559(chainID int64) *TransactionSignaturePayload {
-	rlpList := t.Build1559(chainID)
+	return t.SignaturePayloadEIP1559Big(big.NewInt(chainID))
+}
+
+// SignaturePayloadEIP1559Big is SignaturePayloadEIP1559 for a chain ID of any size
+func (t *Transaction) SignaturePayloadEIP1559Big(chainID *big.Int) *TransactionSignaturePayload {
+	rlpList := t.Build1559Big(chainID)
 
 	// The signature payload is the transaction type, concatenated with RLP list _excluding_ signature
 	// keccak256(0x02 || rlp([chain_id, nonce, max_priority_fee_per_gas, max_fee_per_gas, gas_limit, destination, amount, data, access_list]))
@@ -208,12 +312,17 @@ func (t *Transaction) SignaturePayloadEIP1559(chainID int64) *TransactionSignatu
 
 // SignEIP1559 uses EIP-1559 transaction structure (with EIP-2718 transaction type byte), with EIP-2930 V value (0 / 1 - direct parity-Y)
 func (t *Transaction) SignEIP1559(signer secp256k1.Signer, chainID int64) ([]byte, error) {
+	return t.SignEIP1559Big(signer, big.NewInt(chainID))
+}
+
+// SignEIP1559Big is SignEIP1559 for a chain ID of any size
+func (t *Transaction) SignEIP1559Big(signer secp256k1.Signer, chainID *big.Int) ([]byte, error) {
 	if signer == nil {
 		return nil, fmt.Errorf("invalid signer")
 	}
 
-	signaturePayload := t.SignaturePayloadEIP1559(chainID)
-	sig, err := signer.Sign(signaturePayload.data)
+	signaturePayload := t.SignaturePayloadEIP1559Big(chainID)
+	sig, err := signPayload(signer, signaturePayload.data)
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +339,58 @@ func (t *Transaction) FinalizeEIP1559WithSignature(signaturePayload *Transaction
 	return append([]byte{TransactionType1559}, rlpList.Encode()...), nil
 }
 
+// SignaturePayloadEIP2930 returns the rlpList of fields that are signed, along with the full
+// bytes for the signature / TX Hash - which have the transaction type prefixed
+func (t *Transaction) SignaturePayloadEIP2930(chainID int64) *TransactionSignaturePayload {
+	return t.SignaturePayloadEIP2930Big(big.NewInt(chainID))
+}
+
+// SignaturePayloadEIP2930Big is SignaturePayloadEIP2930 for a chain ID of any size
+func (t *Transaction) SignaturePayloadEIP2930Big(chainID *big.Int) *TransactionSignaturePayload {
+	rlpList := t.Build2930Big(chainID)
+
+	// keccak256(0x01 || rlp([chainId, nonce, gasPrice, gasLimit, to, value, data, accessList]))
+	return &TransactionSignaturePayload{
+		rlpList: rlpList,
+		data:    append([]byte{TransactionType2930}, rlpList.Encode()...),
+	}
+}
+
+// SignEIP2930 uses EIP-2930 transaction structure (with EIP-2718 transaction type byte), with the legacy gas price,
+// an access list, and a direct 0 / 1 Y-parity V value
+func (t *Transaction) SignEIP2930(signer secp256k1.Signer, chainID int64) ([]byte, error) {
+	return t.SignEIP2930Big(signer, big.NewInt(chainID))
+}
+
+// SignEIP2930Big is SignEIP2930 for a chain ID of any size
+func (t *Transaction) SignEIP2930Big(signer secp256k1.Signer, chainID *big.Int) ([]byte, error) {
+	if signer == nil {
+		return nil, i18n.NewError(context.Background(), signermsgs.MsgInvalidSigner)
+	}
+
+	signaturePayload := t.SignaturePayloadEIP2930Big(chainID)
+	sig, err := signPayload(signer, signaturePayload.data)
+	if err != nil {
+		return nil, err
+	}
+	return t.FinalizeEIP2930WithSignature(signaturePayload, sig)
+}
+
+func (t *Transaction) FinalizeEIP2930WithSignature(signaturePayload *TransactionSignaturePayload, sig *secp256k1.SignatureData) ([]byte, error) {
+	// Use the direct 0/1 Y-parity value
+	sig.UpdateEIP2930()
+
+	// 0x01 || rlp([chainId, nonce, gasPrice, gasLimit, to, value, data, accessList, signatureYParity, signatureR, signatureS])
+	rlpList := t.addSignature(signaturePayload.rlpList, sig)
+	return append([]byte{TransactionType2930}, rlpList.Encode()...), nil
+}
+
 func RecoverLegacyRawTransaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+	return RecoverLegacyRawTransactionBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// RecoverLegacyRawTransactionBig is RecoverLegacyRawTransaction for a chain ID of any size
+func RecoverLegacyRawTransactionBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
 
 	decoded, _, err := rlp.Decode(rawTx)
 	if err != nil {
@@ -253,21 +413,22 @@ func RecoverLegacyRawTransaction(ctx context.Context, rawTx ethtypes.HexBytes0xP
 		Data:     ethtypes.HexBytes0xPrefix(rlpList[5].ToData()),
 	}
 
-	vValue := rlpList[6].ToData().Int().Int64()
+	vValue := rlpList[6].ToData().Int()
 	rValue := rlpList[7].ToData().BytesNotNil()
 	sValue := rlpList[8].ToData().BytesNotNil()
 
 	var message []byte
-	if vValue != 27 && vValue != 28 {
-		// Legacy with EIP155 extensions
-		vValue = vValue - (chainID * 2) - 8
-		if vValue != 27 && vValue != 28 {
+	if !isLegacyV(vValue) {
+		// Legacy with EIP155 extensions, where V is (2*ChainID + 35 + Y-parity) - which can be larger than an int64
+		vValue = new(big.Int).Sub(vValue, new(big.Int).Lsh(chainID, 1))
+		vValue.Sub(vValue, big.NewInt(35-27))
+		if !isLegacyV(vValue) {
 			return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP155TransactionV, chainID)
 		}
 
 		signedRLPList := make(rlp.List, 6, 9)
 		copy(signedRLPList, rlpList[0:6])
-		signedRLPList = AddEIP155HashValuesToRLPList(signedRLPList, chainID)
+		signedRLPList = AddEIP155HashValuesToRLPListBig(signedRLPList, chainID)
 		message = signedRLPList.Encode()
 	} else {
 		// Legacy original transaction
@@ -278,17 +439,21 @@ func RecoverLegacyRawTransaction(ctx context.Context, rawTx ethtypes.HexBytes0xP
 
 }
 
-func recoverCommon(tx *Transaction, message []byte, chainID int64, v int64, r, s []byte) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+// isLegacyV checks for the original 27/28 V value
+func isLegacyV(v *big.Int) bool {
+	return v.IsInt64() && (v.Int64() == 27 || v.Int64() == 28)
+}
+
+func recoverCommon(tx *Transaction, message []byte, chainID *big.Int, v *big.Int, r, s []byte) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
 	foundSig := &secp256k1.SignatureData{
-		V: new(big.Int),
+		V: v,
 		R: new(big.Int),
 		S: new(big.Int),
 	}
-	foundSig.V.SetInt64(v)
 	foundSig.R.SetBytes(r)
 	foundSig.S.SetBytes(s)
 
-	signer, err := foundSig.Recover(message, chainID)
+	signer, err := foundSig.RecoverBig(message, chainID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -299,7 +464,7 @@ func recoverCommon(tx *Transaction, message []byte, chainID int64, v int64, r, s
 	}, nil
 }
 
-func decodeEIP1559SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64, rlpMinLen int) (rlp.List, *Transaction, error) {
+func decodeEIP1559SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int, rlpMinLen int) (rlp.List, *Transaction, error) {
 	if len(rawTx) == 0 || rawTx[0] != TransactionType1559 {
 		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP1559Transaction, "TransactionType")
 	}
@@ -316,10 +481,14 @@ func decodeEIP1559SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0
 		log.L(ctx).Errorf("Invalid EIP-1559 transaction data (%d RLP elements)", rlpList)
 		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP1559Transaction, "EOF")
 	}
-	encodedChainID := rlpList[0].ToData().IntOrZero().Int64()
-	if encodedChainID != chainID {
+	encodedChainID := rlpList[0].ToData().IntOrZero()
+	if encodedChainID.Cmp(chainID) != 0 {
 		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidChainID, chainID, encodedChainID)
 	}
+	accessList, err := decodeAccessList(ctx, rlpList[8])
+	if err != nil {
+		return nil, nil, err
+	}
 	return rlpList, &Transaction{
 		Nonce:                (*ethtypes.HexInteger)(rlpList[1].ToData().Int()),
 		MaxPriorityFeePerGas: (*ethtypes.HexInteger)(rlpList[2].ToData().Int()),
@@ -328,16 +497,26 @@ func decodeEIP1559SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0
 		To:                   rlpList[5].ToData().Address(),
 		Value:                (*ethtypes.HexInteger)(rlpList[6].ToData().Int()),
 		Data:                 ethtypes.HexBytes0xPrefix(rlpList[7].ToData()),
-		// No access list support
+		AccessList:           accessList,
 	}, nil
 }
 
 func DecodeEIP1559SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*Transaction, error) {
+	return DecodeEIP1559SignaturePayloadBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// DecodeEIP1559SignaturePayloadBig is DecodeEIP1559SignaturePayload for a chain ID of any size
+func DecodeEIP1559SignaturePayloadBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*Transaction, error) {
 	_, tx, err := decodeEIP1559SignaturePayload(ctx, rawTx, chainID, 9 /* no signature data */)
 	return tx, err
 }
 
 func RecoverEIP1559Transaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+	return RecoverEIP1559TransactionBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// RecoverEIP1559TransactionBig is RecoverEIP1559Transaction for a chain ID of any size
+func RecoverEIP1559TransactionBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
 
 	rlpList, tx, err := decodeEIP1559SignaturePayload(ctx, rawTx, chainID, 12 /* with signature data */)
 	if err != nil {
@@ -347,13 +526,84 @@ func RecoverEIP1559Transaction(ctx context.Context, rawTx ethtypes.HexBytes0xPre
 	return recoverCommon(tx,
 		append([]byte{TransactionType1559}, (rlpList[0:9]).Encode()...),
 		chainID,
-		rlpList[9].ToData().Int().Int64(),
+		rlpList[9].ToData().Int(),
 		rlpList[10].ToData().BytesNotNil(),
 		rlpList[11].ToData().BytesNotNil(),
 	)
 }
 
+func decodeEIP2930SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int, rlpMinLen int) (rlp.List, *Transaction, error) {
+	if len(rawTx) == 0 || rawTx[0] != TransactionType2930 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP2930Transaction, "TransactionType")
+	}
+
+	rawTx = rawTx[1:]
+	decoded, _, err := rlp.Decode(rawTx)
+	if err != nil {
+		log.L(ctx).Errorf("Invalid EIP-2930 transaction data '%s': %s", rawTx, err)
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP2930Transaction, err)
+	}
+	rlpList, ok := decoded.(rlp.List)
+	if !ok || len(rlpList) < rlpMinLen {
+		log.L(ctx).Errorf("Invalid EIP-2930 transaction data (%d RLP elements)", len(rlpList))
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidEIP2930Transaction, "EOF")
+	}
+	encodedChainID := rlpList[0].ToData().IntOrZero()
+	if encodedChainID.Cmp(chainID) != 0 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgInvalidChainID, chainID, encodedChainID)
+	}
+	accessList, err := decodeAccessList(ctx, rlpList[7])
+	if err != nil {
+		return nil, nil, err
+	}
+	return rlpList, &Transaction{
+		Nonce:      (*ethtypes.HexInteger)(rlpList[1].ToData().Int()),
+		GasPrice:   (*ethtypes.HexInteger)(rlpList[2].ToData().Int()),
+		GasLimit:   (*ethtypes.HexInteger)(rlpList[3].ToData().Int()),
+		To:         rlpList[4].ToData().Address(),
+		Value:      (*ethtypes.HexInteger)(rlpList[5].ToData().Int()),
+		Data:       ethtypes.HexBytes0xPrefix(rlpList[6].ToData()),
+		AccessList: accessList,
+	}, nil
+}
+
+func DecodeEIP2930SignaturePayload(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*Transaction, error) {
+	return DecodeEIP2930SignaturePayloadBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// DecodeEIP2930SignaturePayloadBig is DecodeEIP2930SignaturePayload for a chain ID of any size
+func DecodeEIP2930SignaturePayloadBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*Transaction, error) {
+	_, tx, err := decodeEIP2930SignaturePayload(ctx, rawTx, chainID, 8 /* no signature data */)
+	return tx, err
+}
+
+func RecoverEIP2930Transaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+	return RecoverEIP2930TransactionBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// RecoverEIP2930TransactionBig is RecoverEIP2930Transaction for a chain ID of any size
+func RecoverEIP2930TransactionBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+
+	rlpList, tx, err := decodeEIP2930SignaturePayload(ctx, rawTx, chainID, 11 /* with signature data */)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return recoverCommon(tx,
+		append([]byte{TransactionType2930}, (rlpList[0:8]).Encode()...),
+		chainID,
+		rlpList[8].ToData().Int(),
+		rlpList[9].ToData().BytesNotNil(),
+		rlpList[10].ToData().BytesNotNil(),
+	)
+}
+
 func RecoverRawTransaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID int64) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
+	return RecoverRawTransactionBig(ctx, rawTx, big.NewInt(chainID))
+}
+
+// RecoverRawTransactionBig is RecoverRawTransaction for a chain ID of any size
+func RecoverRawTransactionBig(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix, chainID *big.Int) (*ethtypes.Address0xHex, *TransactionWithOriginalPayload, error) {
 
 	// The first byte of the payload (per EIP-2718) is either `>= 0xc0` for legacy transactions,
 	// or a transaction type selector (up to `0x7f`).
@@ -363,9 +613,15 @@ func RecoverRawTransaction(ctx context.Context, rawTx ethtypes.HexBytes0xPrefix,
 	txTypeByte := rawTx[0]
 	switch {
 	case txTypeByte >= 0xc7:
-		return RecoverLegacyRawTransaction(ctx, rawTx, chainID)
+		return RecoverLegacyRawTransactionBig(ctx, rawTx, chainID)
+	case txTypeByte == TransactionType2930:
+		return RecoverEIP2930TransactionBig(ctx, rawTx, chainID)
 	case txTypeByte == TransactionType1559:
-		return RecoverEIP1559Transaction(ctx, rawTx, chainID)
+		return RecoverEIP1559TransactionBig(ctx, rawTx, chainID)
+	case txTypeByte == TransactionType4844:
+		return RecoverEIP4844TransactionBig(ctx, rawTx, chainID)
+	case txTypeByte == TransactionType7702:
+		return RecoverEIP7702TransactionBig(ctx, rawTx, chainID)
 	default:
 		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUnsupportedTransactionType, txTypeByte)
 	}
@@ -378,3 +634,94 @@ func (t *Transaction) addSignature(rlpList rlp.List, sig *secp256k1.SignatureDat
 	rlpList = append(rlpList, rlp.WrapInt(sig.S))
 	return rlpList
 }
+
+// Equal returns true if the two transactions are semantically identical, which is when they would be signed
+// into the same RLP encoding from the same address. An unset numeric field is equal to zero (as both are
+// encoded the same), while an unset "to" differs from the zero address. The "from" address is compared
+// regardless of case or 0x prefix. The blobs, commitments and proofs of a blob transaction are not signed,
+// so are not compared.
+func (t *Transaction) Equal(other *Transaction) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return t.Nonce.BigInt().Cmp(other.Nonce.BigInt()) == 0 &&
+		t.GasPrice.BigInt().Cmp(other.GasPrice.BigInt()) == 0 &&
+		t.MaxPriorityFeePerGas.BigInt().Cmp(other.MaxPriorityFeePerGas.BigInt()) == 0 &&
+		t.MaxFeePerGas.BigInt().Cmp(other.MaxFeePerGas.BigInt()) == 0 &&
+		t.GasLimit.BigInt().Cmp(other.GasLimit.BigInt()) == 0 &&
+		bytes.Equal(rlp.WrapAddress(t.To), rlp.WrapAddress(other.To)) &&
+		t.Value.BigInt().Cmp(other.Value.BigInt()) == 0 &&
+		bytes.Equal(t.Data, other.Data) &&
+		bytes.Equal(t.AccessList.BuildRLP().Encode(), other.AccessList.BuildRLP().Encode()) &&
+		t.MaxFeePerBlobGas.BigInt().Cmp(other.MaxFeePerBlobGas.BigInt()) == 0 &&
+		bytes.Equal(wrapDataList(t.BlobVersionedHashes).Encode(), wrapDataList(other.BlobVersionedHashes).Encode()) &&
+		bytes.Equal(t.AuthorizationList.BuildRLP().Encode(), other.AuthorizationList.BuildRLP().Encode()) &&
+		bytes.Equal(t.normalizedFrom(), other.normalizedFrom())
+}
+
+// Normalize returns a copy of the transaction in a canonical form, so that transactions that are Equal
+// are also deeply equal (for use in tests, or comparing serialized transactions). Every numeric field is
+// set (to zero when unset), the data is non-nil, and "from" is a lower-case 0x prefixed address when it
+// is a valid address. The unsigned blobs, commitments and proofs are dropped. Note an unset nonce is
+// significant to eth_sendTransaction, so the result is only for comparison.
+func (t *Transaction) Normalize() *Transaction {
+	return &Transaction{
+		From:                 t.normalizedFrom(),
+		Nonce:                normalizedHexInteger(t.Nonce),
+		GasPrice:             normalizedHexInteger(t.GasPrice),
+		MaxPriorityFeePerGas: normalizedHexInteger(t.MaxPriorityFeePerGas),
+		MaxFeePerGas:         normalizedHexInteger(t.MaxFeePerGas),
+		GasLimit:             normalizedHexInteger(t.GasLimit),
+		To:                   t.To,
+		Value:                normalizedHexInteger(t.Value),
+		Data:                 append(ethtypes.HexBytes0xPrefix{}, t.Data...),
+		AccessList:           t.normalizedAccessList(),
+		MaxFeePerBlobGas:     normalizedHexInteger(t.MaxFeePerBlobGas),
+		BlobVersionedHashes:  normalizedBytesList(t.BlobVersionedHashes),
+		AuthorizationList:    t.normalizedAuthorizationList(),
+	}
+}
+
+// normalizedAccessList is nil for an empty access list, which encodes the same as an unset one
+func (t *Transaction) normalizedAccessList() AccessList {
+	if len(t.AccessList) == 0 {
+		return nil
+	}
+	return append(AccessList{}, t.AccessList...)
+}
+
+// normalizedAuthorizationList is nil for an empty authorization list, with every numeric field of each
+// authorization set (to zero when unset)
+func (t *Transaction) normalizedAuthorizationList() AuthorizationList {
+	if len(t.AuthorizationList) == 0 {
+		return nil
+	}
+	al := make(AuthorizationList, len(t.AuthorizationList))
+	for i, a := range t.AuthorizationList {
+		al[i] = Authorization{
+			ChainID: normalizedHexInteger(a.ChainID),
+			Address: a.Address,
+			Nonce:   normalizedHexInteger(a.Nonce),
+			YParity: normalizedHexInteger(a.YParity),
+			R:       normalizedHexInteger(a.R),
+			S:       normalizedHexInteger(a.S),
+		}
+	}
+	return al
+}
+
+func (t *Transaction) normalizedFrom() json.RawMessage {
+	from := bytes.TrimSpace(t.From)
+	if len(from) == 0 || bytes.Equal(from, []byte("null")) {
+		return nil
+	}
+	var addr ethtypes.Address0xHex
+	if err := json.Unmarshal(from, &addr); err == nil {
+		from, _ = json.Marshal(addr)
+	}
+	return from
+}
+
+func normalizedHexInteger(i *ethtypes.HexInteger) *ethtypes.HexInteger {
+	return (*ethtypes.HexInteger)(new(big.Int).Set(i.BigInt()))
+}
@@ -131,6 +131,14 @@ func TestSignLegacyEIP155(t *testing.T) {
 	_, _, err = RecoverRawTransaction(context.Background(), raw, 1002)
 	assert.Regexp(t, "FF22085", err)
 
+	payload := txn.SignaturePayload(1001)
+	assert.Equal(t, txn.SignaturePayloadLegacyEIP155(1001).Bytes(), payload.Bytes())
+	sig, err := keypair.Sign(payload.Bytes())
+	assert.NoError(t, err)
+	raw2, err := txn.FinalizeLegacyEIP155WithSignature(payload, sig, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, raw2)
+
 }
 
 func TestSignAutoEIP1559(t *testing.T) {
@@ -161,6 +169,122 @@ func TestSignAutoEIP1559(t *testing.T) {
 
 }
 
+func TestSignAutoEIP2930(t *testing.T) {
+
+	var txn Transaction
+	err := json.Unmarshal([]byte(`{
+		"nonce": "0x03",
+		"gasPrice": "0x3b9aca00",
+		"gas": "0x9c40",
+		"to": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+		"value": "0x00",
+		"data": "0xabcd",
+		"accessList": [
+			{
+				"address": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+				"storageKeys": [
+					"0x0000000000000000000000000000000000000000000000000000000000000001",
+					"0x0000000000000000000000000000000000000000000000000000000000000002"
+				]
+			},
+			{
+				"address": "0x1f185718734552d08278aa70f804580bab5fd2b4",
+				"storageKeys": []
+			}
+		]
+	}`), &txn)
+	assert.NoError(t, err)
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	raw, err := txn.Sign(keypair, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, TransactionType2930, raw[0])
+	assert.Equal(t, txn.SignaturePayload(1001).Bytes(), txn.SignaturePayloadEIP2930(1001).Bytes())
+
+	signer, txr, err := RecoverRawTransaction(context.Background(), raw, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address.String(), signer.String())
+	assert.True(t, txn.Equal(txr.Transaction))
+	assert.Len(t, txr.AccessList, 2)
+	assert.Empty(t, txr.AccessList[1].StorageKeys)
+
+	// The unsigned payload can be decoded too
+	decoded, err := DecodeEIP2930SignaturePayload(context.Background(), txn.SignaturePayloadEIP2930(1001).Bytes(), 1001)
+	assert.NoError(t, err)
+	assert.True(t, txn.Equal(decoded))
+
+	// The V value is the direct Y-parity
+	decodedRLP, _, err := rlp.Decode(raw[1:])
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, decodedRLP.(rlp.List)[8].ToData().Int().Int64(), int64(1))
+
+}
+
+func TestSignEIP1559AccessList(t *testing.T) {
+
+	txn := Transaction{
+		Nonce:                ethtypes.NewHexInteger64(3),
+		MaxPriorityFeePerGas: ethtypes.NewHexInteger64(123456780),
+		MaxFeePerGas:         ethtypes.NewHexInteger64(150000000),
+		GasLimit:             ethtypes.NewHexInteger64(40574),
+		To:                   ethtypes.MustNewAddress("0x497eedc4299dea2f2a364be10025d0ad0f702de3"),
+		AccessList: AccessList{{
+			Address:     *ethtypes.MustNewAddress("0x497eedc4299dea2f2a364be10025d0ad0f702de3"),
+			StorageKeys: []ethtypes.HexBytes0xPrefix{make([]byte, 32)},
+		}},
+	}
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	// EIP-1559 is picked over EIP-2930, and includes the access list
+	raw, err := txn.Sign(keypair, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, TransactionType1559, raw[0])
+
+	signer, txr, err := RecoverRawTransaction(context.Background(), raw, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address.String(), signer.String())
+	assert.Equal(t, txn.AccessList, txr.AccessList)
+
+}
+
+func TestSignEIP2930Error(t *testing.T) {
+	txn := Transaction{}
+	_, err := txn.SignEIP2930(nil, 12345)
+	assert.Regexp(t, "FF22064", err)
+
+	msn := &secp256k1mocks.Signer{}
+	msn.On("Sign", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	_, err = txn.SignEIP2930(msn, 12345)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestRecoverEIP2930TransactionFail(t *testing.T) {
+	ctx := context.Background()
+
+	_, _, err := RecoverEIP2930Transaction(ctx, []byte{TransactionType1559}, 1001)
+	assert.Regexp(t, "FF22241.*TransactionType", err)
+
+	_, _, err = RecoverEIP2930Transaction(ctx, []byte{TransactionType2930, 0xff}, 1001)
+	assert.Regexp(t, "FF22241", err)
+
+	_, _, err = RecoverEIP2930Transaction(ctx, append([]byte{TransactionType2930}, rlp.WrapInt(big.NewInt(1)).Encode()...), 1001)
+	assert.Regexp(t, "FF22241.*EOF", err)
+
+	_, err = DecodeEIP2930SignaturePayload(ctx, append([]byte{TransactionType2930}, (rlp.List{}).Encode()...), 1001)
+	assert.Regexp(t, "FF22241.*EOF", err)
+
+	txn := &Transaction{AccessList: AccessList{{Address: ethtypes.Address0xHex{0x01}}}}
+	_, err = DecodeEIP2930SignaturePayload(ctx, txn.SignaturePayloadEIP2930(1001).Bytes(), 1002)
+	assert.Regexp(t, "FF22086", err)
+
+	payload := txn.Build2930(1001)
+	payload[7] = rlp.Data{}
+	_, err = DecodeEIP2930SignaturePayload(ctx, append([]byte{TransactionType2930}, payload.Encode()...), 1001)
+	assert.Regexp(t, "FF22242", err)
+}
+
 func TestSignLegacyOriginal(t *testing.T) {
 
 	inputData, err := hex.DecodeString(
@@ -238,6 +362,36 @@ func TestSignEIP1559Error(t *testing.T) {
 	assert.Regexp(t, "pop", err)
 }
 
+func TestSignWithDigestSigner(t *testing.T) {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	txn := Transaction{
+		Nonce:    ethtypes.NewHexInteger64(3),
+		GasPrice: ethtypes.NewHexInteger64(100000000000),
+		GasLimit: ethtypes.NewHexInteger64(200000),
+		Value:    ethtypes.NewHexInteger64(100000000000),
+	}
+	signaturePayload := txn.SignaturePayloadLegacyEIP155(1001)
+
+	msn := &secp256k1mocks.SignerDigest{}
+	msn.On("SignDigest", [32]byte(signaturePayload.Hash())).Return(func(digest [32]byte) (*secp256k1.SignatureData, error) {
+		return keypair.SignDigest(digest)
+	})
+	raw, err := txn.SignLegacyEIP155(msn, 1001)
+	assert.NoError(t, err)
+	msn.AssertNotCalled(t, "Sign", mock.Anything)
+
+	addr, _, err := RecoverLegacyRawTransaction(context.Background(), raw, 1001)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address.String(), addr.String())
+
+	msn = &secp256k1mocks.SignerDigest{}
+	msn.On("SignDigest", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	_, err = txn.SignEIP1559(msn, 1001)
+	assert.Regexp(t, "pop", err)
+}
+
 func TestEthTXDocumented(t *testing.T) {
 	ffapi.CheckObjectDocumented(&Transaction{})
 }
@@ -257,8 +411,8 @@ func TestRecoverRawTransactionEmpty(t *testing.T) {
 }
 
 func TestRecoverRawTransactionInvalidType(t *testing.T) {
-	_, _, err := RecoverRawTransaction(context.Background(), []byte{0x03}, 1001)
-	assert.Regexp(t, "FF22082.*0x03", err)
+	_, _, err := RecoverRawTransaction(context.Background(), []byte{0x05}, 1001)
+	assert.Regexp(t, "FF22082.*0x05", err)
 }
 
 func TestRecoverLegacyTransactionEmpty(t *testing.T) {
@@ -340,7 +494,7 @@ func TestRecoverEIP1559BadChainID(t *testing.T) {
 		rlp.WrapInt(big.NewInt(223)),
 		rlp.WrapInt(big.NewInt(333)),
 	}).Encode()...), 1001)
-	assert.Regexp(t, "FF22086.*1,001.*111", err)
+	assert.Regexp(t, "FF22086.*1001.*111", err)
 }
 
 func TestRecoverEIP1559Signature(t *testing.T) {
@@ -353,10 +507,160 @@ func TestRecoverEIP1559Signature(t *testing.T) {
 		rlp.WrapInt(big.NewInt(666)),
 		rlp.WrapInt(big.NewInt(777)),
 		rlp.WrapInt(big.NewInt(888)),
-		rlp.WrapInt(big.NewInt(999)),
+		rlp.List{},
 		rlp.WrapInt(big.NewInt(111)),
 		rlp.WrapInt(big.NewInt(223)),
 		rlp.WrapInt(big.NewInt(333)),
 	}).Encode()...), 1001)
 	assert.Regexp(t, "invalid", err)
+
+	_, _, err = RecoverEIP1559Transaction(context.Background(), append([]byte{TransactionType1559}, (rlp.List{
+		rlp.WrapInt(big.NewInt(1001)),
+		rlp.WrapInt(big.NewInt(222)),
+		rlp.WrapInt(big.NewInt(333)),
+		rlp.WrapInt(big.NewInt(444)),
+		rlp.WrapInt(big.NewInt(555)),
+		rlp.WrapInt(big.NewInt(666)),
+		rlp.WrapInt(big.NewInt(777)),
+		rlp.WrapInt(big.NewInt(888)),
+		rlp.WrapInt(big.NewInt(999)),
+		rlp.WrapInt(big.NewInt(111)),
+		rlp.WrapInt(big.NewInt(223)),
+		rlp.WrapInt(big.NewInt(333)),
+	}).Encode()...), 1001)
+	assert.Regexp(t, "FF22242.*not a list", err)
+}
+
+func TestTransactionEqual(t *testing.T) {
+
+	var tx1, tx2 Transaction
+	err := json.Unmarshal([]byte(`{
+		"from": "0x1F185718734552D08278AA70F804580BAB5FD2B4",
+		"nonce": "0x00",
+		"gas": 21000,
+		"to": "0x497eedc4299dea2f2a364be10025d0ad0f702de3",
+		"value": "0x0de0b6b3a7640000",
+		"data": "0xABCD"
+	}`), &tx1)
+	assert.NoError(t, err)
+	err = json.Unmarshal([]byte(`{
+		"from": "1f185718734552d08278aa70f804580bab5fd2b4",
+		"gas": "0x5208",
+		"gasPrice": "0",
+		"to": "0x497EEDC4299DEA2F2A364BE10025D0AD0F702DE3",
+		"value": "1000000000000000000",
+		"data": "0xabcd"
+	}`), &tx2)
+	assert.NoError(t, err)
+
+	assert.True(t, tx1.Equal(&tx2))
+	assert.True(t, tx2.Equal(&tx1))
+	assert.Equal(t, tx1.Normalize(), tx2.Normalize())
+	assert.Equal(t, `"0x1f185718734552d08278aa70f804580bab5fd2b4"`, string(tx1.Normalize().From))
+
+	// Each field is significant
+	for _, changed := range []func(tx *Transaction){
+		func(tx *Transaction) { tx.Nonce = ethtypes.NewHexInteger64(1) },
+		func(tx *Transaction) { tx.GasPrice = ethtypes.NewHexInteger64(1) },
+		func(tx *Transaction) { tx.MaxPriorityFeePerGas = ethtypes.NewHexInteger64(1) },
+		func(tx *Transaction) { tx.MaxFeePerGas = ethtypes.NewHexInteger64(1) },
+		func(tx *Transaction) { tx.GasLimit = ethtypes.NewHexInteger64(1) },
+		func(tx *Transaction) { tx.To = nil },
+		func(tx *Transaction) { tx.Value = nil },
+		func(tx *Transaction) { tx.Data = nil },
+		func(tx *Transaction) { tx.From = json.RawMessage(`"0x497eedc4299dea2f2a364be10025d0ad0f702de3"`) },
+		func(tx *Transaction) { tx.From = nil },
+		func(tx *Transaction) { tx.AccessList = AccessList{{Address: ethtypes.Address0xHex{0x01}}} },
+		func(tx *Transaction) { tx.MaxFeePerBlobGas = ethtypes.NewHexInteger64(1) },
+		func(tx *Transaction) { tx.BlobVersionedHashes = []ethtypes.HexBytes0xPrefix{{0x01}} },
+		func(tx *Transaction) { tx.AuthorizationList = AuthorizationList{{}} },
+	} {
+		tx3 := tx2
+		changed(&tx3)
+		assert.False(t, tx1.Equal(&tx3))
+		assert.NotEqual(t, tx1.Normalize(), tx3.Normalize())
+	}
+
+	// An empty access list is the same as an unset one
+	assert.True(t, (&Transaction{}).Equal(&Transaction{AccessList: AccessList{}}))
+	assert.Equal(t, (&Transaction{}).Normalize(), (&Transaction{AccessList: AccessList{}}).Normalize())
+
+	// An unset "to" differs from the zero address
+	assert.False(t, (&Transaction{}).Equal(&Transaction{To: &ethtypes.Address0xHex{}}))
+	// Unset and null "from" are the same, and invalid addresses are compared as supplied
+	assert.True(t, (&Transaction{}).Equal(&Transaction{From: json.RawMessage(" null ")}))
+	assert.True(t, (&Transaction{From: json.RawMessage(`"key1"`)}).Equal(&Transaction{From: json.RawMessage(`"key1"`)}))
+	assert.False(t, (&Transaction{From: json.RawMessage(`"key1"`)}).Equal(&Transaction{From: json.RawMessage(`"key2"`)}))
+
+	var nilTX *Transaction
+	assert.True(t, nilTX.Equal(nil))
+	assert.False(t, nilTX.Equal(&tx1))
+	assert.False(t, tx1.Equal(nil))
+
+}
+
+func TestSignChainIDZeroLegacyOriginal(t *testing.T) {
+
+	txn := Transaction{
+		Nonce:    ethtypes.NewHexInteger64(3),
+		GasPrice: ethtypes.NewHexInteger64(100000000),
+		GasLimit: ethtypes.NewHexInteger64(40574),
+		To:       ethtypes.MustNewAddress("0x497eedc4299dea2f2a364be10025d0ad0f702de3"),
+	}
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	// A network from before EIP-155 has no chain ID in the signature
+	raw, err := txn.Sign(keypair, 0)
+	assert.NoError(t, err)
+	decoded, _, err := rlp.Decode(raw)
+	assert.NoError(t, err)
+	v := decoded.(rlp.List)[6].ToData().Int().Int64()
+	assert.True(t, v == 27 || v == 28)
+	assert.Equal(t, txn.SignaturePayloadLegacyOriginal().Bytes(), txn.SignaturePayload(0).Bytes())
+
+	signer, _, err := RecoverRawTransaction(context.Background(), raw, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address.String(), signer.String())
+
+}
+
+func TestSignLargeChainIDs(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	for _, chainID := range []*big.Int{
+		big.NewInt(2147483648),              // 2^31
+		new(big.Int).Lsh(big.NewInt(1), 62), // 2^62 - so the EIP-155 V value does not fit an int64
+		new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(1)),
+	} {
+		legacy := Transaction{
+			Nonce:    ethtypes.NewHexInteger64(3),
+			GasPrice: ethtypes.NewHexInteger64(100000000),
+			GasLimit: ethtypes.NewHexInteger64(40574),
+		}
+		raw, err := legacy.SignBig(keypair, chainID)
+		assert.NoError(t, err)
+		signer, _, err := RecoverRawTransactionBig(context.Background(), raw, chainID)
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.Address.String(), signer.String())
+		_, _, err = RecoverRawTransactionBig(context.Background(), raw, new(big.Int).Add(chainID, big.NewInt(1)))
+		assert.Regexp(t, "FF22085", err)
+
+		eip1559 := Transaction{
+			Nonce:        ethtypes.NewHexInteger64(3),
+			MaxFeePerGas: ethtypes.NewHexInteger64(150000000),
+			GasLimit:     ethtypes.NewHexInteger64(40574),
+		}
+		raw, err = eip1559.SignBig(keypair, chainID)
+		assert.NoError(t, err)
+		assert.Equal(t, eip1559.SignaturePayloadBig(chainID).Bytes(), append([]byte{TransactionType1559}, eip1559.Build1559Big(chainID).Encode()...))
+		signer, _, err = RecoverRawTransactionBig(context.Background(), raw, chainID)
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.Address.String(), signer.String())
+		_, err = DecodeEIP1559SignaturePayloadBig(context.Background(), raw, big.NewInt(1))
+		assert.Regexp(t, "FF22086", err)
+	}
+
 }
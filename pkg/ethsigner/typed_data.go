@@ -22,6 +22,7 @@ import (
 	"github.com/hyperledger/firefly-signer/pkg/eip712"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
 	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
 )
 
 type EIP712Result struct {
@@ -42,7 +43,27 @@ func SignTypedDataV4(ctx context.Context, signer secp256k1.SignerDirect, payload
 	if err != nil {
 		return nil, err
 	}
+	return typedDataResult(encodedData, sig), nil
+}
+
+// SignTypedDataV4Message signs typed data with a signer that hashes the message itself, such as a
+// remote signer that cannot sign a hash directly. A signer that implements secp256k1.SignerDigest is
+// given the digest instead.
+func SignTypedDataV4Message(ctx context.Context, signer secp256k1.Signer, payload *eip712.TypedData) (*EIP712Result, error) {
+	message, err := eip712.EncodeTypedDataV4Message(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signPayload(signer, message)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(message)
+	return typedDataResult(hash.Sum(nil), sig), nil
+}
 
+func typedDataResult(encodedData ethtypes.HexBytes0xPrefix, sig *secp256k1.SignatureData) *EIP712Result {
 	signatureBytes := make([]byte, 65)
 	sig.R.FillBytes(signatureBytes[0:32])
 	sig.S.FillBytes(signatureBytes[32:64])
@@ -58,5 +79,5 @@ func SignTypedDataV4(ctx context.Context, signer secp256k1.SignerDirect, payload
 		// 65 bytes - R (32B), S (32B), V (1B)
 		// See: https://github.com/OpenZeppelin/openzeppelin-contracts/blob/7294d34c17ca215c201b3772ff67036fa4b1ef12/contracts/utils/cryptography/ECDSA.sol#L56-L73
 		SignatureRSV: signatureBytes,
-	}, nil
+	}
 }
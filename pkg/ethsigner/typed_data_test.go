@@ -101,6 +101,60 @@ func TestSignTypedDataV4SignFail(t *testing.T) {
 	assert.Regexp(t, "pop", err)
 }
 
+func TestSignTypedDataV4Message(t *testing.T) {
+
+	payload := &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	}
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	// The same signature as signing the hash directly
+	ctx := context.Background()
+	sig, err := SignTypedDataV4Message(ctx, keypair, payload)
+	assert.NoError(t, err)
+	sigDirect, err := SignTypedDataV4(ctx, keypair, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, sigDirect, sig)
+
+	message, err := eip712.EncodeTypedDataV4Message(ctx, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x19, 0x01}, []byte(message[0:2]))
+	assert.Len(t, message, 34)
+
+	_, err = SignTypedDataV4Message(ctx, keypair, &eip712.TypedData{PrimaryType: "missing"})
+	assert.Regexp(t, "FF22073", err)
+
+	msn := &secp256k1mocks.Signer{}
+	msn.On("Sign", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	_, err = SignTypedDataV4Message(ctx, msn, payload)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestSignTypedDataV4MessageDigestSigner(t *testing.T) {
+
+	payload := &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	}
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	encodedData, err := eip712.EncodeTypedDataV4(ctx, payload)
+	assert.NoError(t, err)
+
+	msn := &secp256k1mocks.SignerDigest{}
+	msn.On("SignDigest", [32]byte(encodedData)).Return(func(digest [32]byte) (*secp256k1.SignatureData, error) {
+		return keypair.SignDigest(digest)
+	})
+	sig, err := SignTypedDataV4Message(ctx, msn, payload)
+	assert.NoError(t, err)
+	sigDirect, err := SignTypedDataV4(ctx, keypair, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, sigDirect, sig)
+	msn.AssertExpectations(t)
+}
+
 func TestMessage_2(t *testing.T) {
 	logrus.SetLevel(logrus.TraceLevel)
 
@@ -18,6 +18,10 @@ package ethsigner
 
 import (
 	"context"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
 
 	"github.com/hyperledger/firefly-signer/pkg/eip712"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
@@ -33,6 +37,48 @@ type Wallet interface {
 	Close() error
 }
 
+// BigChainIDWallet is implemented by wallets that can sign for any chain ID, including those too large for an int64
+type BigChainIDWallet interface {
+	Wallet
+	SignBig(ctx context.Context, txn *Transaction, chainID *big.Int) ([]byte, error)
+}
+
+// SignWithWallet signs with SignBig if the wallet implements BigChainIDWallet, and otherwise with Sign - which
+// is only possible if the chain ID fits in an int64
+func SignWithWallet(ctx context.Context, w Wallet, txn *Transaction, chainID *big.Int) ([]byte, error) {
+	if bw, ok := w.(BigChainIDWallet); ok {
+		return bw.SignBig(ctx, txn, chainID)
+	}
+	if !chainID.IsInt64() {
+		return nil, i18n.NewError(ctx, signermsgs.MsgChainIDTooLarge, chainID)
+	}
+	return w.Sign(ctx, txn, chainID.Int64())
+}
+
+// HealthCheckWallet is implemented by wallets that can check their key backend is usable without signing - such
+// as that their directories can be read, or that a remote key manager is reachable and accepts their credentials
+type HealthCheckWallet interface {
+	Wallet
+	HealthCheck(ctx context.Context) error
+}
+
+// CheckWalletHealth returns the result of HealthCheck if the wallet implements HealthCheckWallet, and otherwise
+// nil - as a wallet that has no backend to check is usable once initialized
+func CheckWalletHealth(ctx context.Context, w Wallet) error {
+	if hw, ok := w.(HealthCheckWallet); ok {
+		return hw.HealthCheck(ctx)
+	}
+	return nil
+}
+
+// AuthorizationWallet is implemented by wallets that can sign EIP-7702 authorizations with their keys, for
+// inclusion in the authorization list of a set code transaction
+type AuthorizationWallet interface {
+	Wallet
+	// SignAuthorization signs the authorization with the key of the address, setting its Y-parity, R and S values
+	SignAuthorization(ctx context.Context, from ethtypes.Address0xHex, auth *Authorization) error
+}
+
 type WalletTypedData interface {
 	Wallet
 	SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*EIP712Result, error)
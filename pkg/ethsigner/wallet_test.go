@@ -0,0 +1,86 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethsigner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type int64Wallet struct {
+	Wallet
+	chainID int64
+}
+
+func (w *int64Wallet) Sign(_ context.Context, _ *Transaction, chainID int64) ([]byte, error) {
+	w.chainID = chainID
+	return []byte{0x01}, nil
+}
+
+type bigWallet struct {
+	int64Wallet
+	bigChainID *big.Int
+}
+
+func (w *bigWallet) SignBig(_ context.Context, _ *Transaction, chainID *big.Int) ([]byte, error) {
+	w.bigChainID = chainID
+	return []byte{0x02}, nil
+}
+
+func TestSignWithWallet(t *testing.T) {
+
+	ctx := context.Background()
+	tooLarge := new(big.Int).Lsh(big.NewInt(1), 63)
+
+	w := &int64Wallet{}
+	signed, err := SignWithWallet(ctx, w, &Transaction{}, big.NewInt(12345))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, signed)
+	assert.Equal(t, int64(12345), w.chainID)
+
+	_, err = SignWithWallet(ctx, w, &Transaction{}, tooLarge)
+	assert.Regexp(t, "FF22174", err)
+
+	bw := &bigWallet{}
+	signed, err = SignWithWallet(ctx, bw, &Transaction{}, tooLarge)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x02}, signed)
+	assert.Equal(t, tooLarge, bw.bigChainID)
+
+}
+
+type healthWallet struct {
+	Wallet
+	err error
+}
+
+func (w *healthWallet) HealthCheck(_ context.Context) error {
+	return w.err
+}
+
+func TestCheckWalletHealth(t *testing.T) {
+
+	ctx := context.Background()
+	assert.NoError(t, CheckWalletHealth(ctx, &int64Wallet{}))
+	assert.NoError(t, CheckWalletHealth(ctx, &healthWallet{}))
+	assert.Regexp(t, "pop", CheckWalletHealth(ctx, &healthWallet{err: fmt.Errorf("pop")}))
+
+}
@@ -0,0 +1,139 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethtypes
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+// SignedHexInteger is an integer that can be negative, such as an ABI int256 - serializes to JSON as an 0x hex
+// string (no leading zeros) with a leading minus sign for negative values ("-0x1"), and parses flexibly in the
+// same way as HexInteger
+type SignedHexInteger big.Int
+
+func (h *SignedHexInteger) String() string {
+	bi := (*big.Int)(h)
+	if bi.Sign() < 0 {
+		return "-0x" + new(big.Int).Neg(bi).Text(16)
+	}
+	return "0x" + bi.Text(16)
+}
+
+func (h SignedHexInteger) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%s"`, h.String())), nil
+}
+
+func (h *SignedHexInteger) UnmarshalJSON(b []byte) error {
+	bi, err := UnmarshalBigInt(context.Background(), b)
+	if err != nil {
+		return err
+	}
+	*h = SignedHexInteger(*bi)
+	return nil
+}
+
+func (h *SignedHexInteger) BigInt() *big.Int {
+	if h == nil {
+		return new(big.Int)
+	}
+	return (*big.Int)(h)
+}
+
+func (h *SignedHexInteger) Int64() int64 {
+	return h.BigInt().Int64()
+}
+
+func NewSignedHexInteger64(i int64) *SignedHexInteger {
+	return (*SignedHexInteger)(big.NewInt(i))
+}
+
+func NewSignedHexInteger(i *big.Int) *SignedHexInteger {
+	return (*SignedHexInteger)(i)
+}
+
+// NewSignedHexIntegerFromTwosComplement interprets the unsigned value as the two's complement representation
+// of a signed integer of the bit size - such as the value of an ABI int256 read as a uint256 or raw 32 byte word
+func NewSignedHexIntegerFromTwosComplement(ctx context.Context, u *big.Int, bits uint) (*SignedHexInteger, error) {
+	oneMoreThanMax := new(big.Int).Lsh(big.NewInt(1), bits)
+	if u.Sign() < 0 || u.Cmp(oneMoreThanMax) >= 0 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgTwosComplementOutOfRange, u.Text(10), bits)
+	}
+	i := new(big.Int).Set(u)
+	if bits > 0 && i.Bit(int(bits-1)) == 1 {
+		// The sign bit is set, so this is a negative number
+		i.Sub(i, oneMoreThanMax)
+	}
+	return (*SignedHexInteger)(i), nil
+}
+
+// NewSignedHexIntegerFromTwosComplementBytes interprets big-endian bytes, such as a 32 byte ABI word, as a two's
+// complement signed integer of the same number of bits as the bytes
+func NewSignedHexIntegerFromTwosComplementBytes(b []byte) *SignedHexInteger {
+	i, _ := NewSignedHexIntegerFromTwosComplement(context.Background(), new(big.Int).SetBytes(b), uint(len(b)*8))
+	return i
+}
+
+// TwosComplement returns the two's complement representation of the value for the bit size, as an unsigned
+// integer, or an error if the value does not fit in a signed integer of that size
+func (h *SignedHexInteger) TwosComplement(ctx context.Context, bits uint) (*HexInteger, error) {
+	i := h.BigInt()
+	if bits == 0 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgTwosComplementOutOfRange, i.Text(10), bits)
+	}
+	// The range is -2^(bits-1) to 2^(bits-1)-1
+	half := new(big.Int).Lsh(big.NewInt(1), bits-1)
+	if i.Cmp(half) >= 0 || i.Cmp(new(big.Int).Neg(half)) < 0 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgTwosComplementOutOfRange, i.Text(10), bits)
+	}
+	// A bitwise AND with all ones for the bit size gives a positive integer containing the two's complement bits
+	allOnes := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	return (*HexInteger)(new(big.Int).And(i, allOnes)), nil
+}
+
+// TwosComplementBytes returns the two's complement representation of the value as big-endian bytes of the length,
+// such as 32 for an ABI int256 word
+func (h *SignedHexInteger) TwosComplementBytes(ctx context.Context, length int) ([]byte, error) {
+	u, err := h.TwosComplement(ctx, uint(length*8))
+	if err != nil {
+		return nil, err
+	}
+	return u.BigInt().FillBytes(make([]byte, length)), nil
+}
+
+func (h *SignedHexInteger) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case int64:
+		*h = *NewSignedHexInteger64(src)
+		return nil
+	case string:
+		bi, err := BigIntegerFromString(context.Background(), src)
+		if err != nil {
+			return err
+		}
+		*h = SignedHexInteger(*bi)
+		return nil
+	default:
+		return i18n.NewError(context.Background(), i18n.MsgTypeRestoreFailed, src, h)
+	}
+}
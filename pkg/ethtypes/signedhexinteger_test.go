@@ -0,0 +1,163 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethtypes
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedHexIntegerOk(t *testing.T) {
+
+	testStruct := struct {
+		I1 *SignedHexInteger `json:"i1"`
+		I2 *SignedHexInteger `json:"i2"`
+		I3 *SignedHexInteger `json:"i3"`
+		I4 *SignedHexInteger `json:"i4"`
+		I5 *SignedHexInteger `json:"i5"`
+		I6 *SignedHexInteger `json:"i6,omitempty"`
+	}{}
+
+	testData := `{
+		"i1": "-0xabcd1234",
+		"i2": "-54321",
+		"i3": -12345,
+		"i4": "0x10"
+	}`
+
+	err := json.Unmarshal([]byte(testData), &testStruct)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(-0xabcd1234), testStruct.I1.BigInt().Int64())
+	assert.Equal(t, int64(-54321), testStruct.I2.BigInt().Int64())
+	assert.Equal(t, int64(-12345), testStruct.I3.Int64())
+	assert.Equal(t, int64(16), testStruct.I4.Int64())
+	assert.Nil(t, testStruct.I5)
+	assert.Equal(t, int64(0), testStruct.I5.BigInt().Int64()) // BigInt() safe on nils
+
+	jsonSerialized, err := json.Marshal(&testStruct)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"i1": "-0xabcd1234",
+		"i2": "-0xd431",
+		"i3": "-0x3039",
+		"i4": "0x10",
+		"i5": null
+	}`, string(jsonSerialized))
+
+}
+
+func TestSignedHexIntegerBadJSON(t *testing.T) {
+
+	var i SignedHexInteger
+	err := json.Unmarshal([]byte(`{}`), &i)
+	assert.Regexp(t, "FF22091", err)
+
+	err = i.UnmarshalJSON([]byte(`{!badJSON`))
+	assert.Regexp(t, "invalid", err)
+
+}
+
+func TestSignedHexIntegerConstructors(t *testing.T) {
+	assert.Equal(t, "-0x1", NewSignedHexInteger64(-1).String())
+	assert.Equal(t, "0x0", NewSignedHexInteger64(0).String())
+	assert.Equal(t, "0x3039", NewSignedHexInteger(big.NewInt(12345)).String())
+}
+
+func TestSignedHexIntegerTwosComplement(t *testing.T) {
+	ctx := context.Background()
+
+	u, err := NewSignedHexInteger64(-1).TwosComplement(ctx, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xff", u.String())
+
+	u, err = NewSignedHexInteger64(-128).TwosComplement(ctx, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x80", u.String())
+
+	u, err = NewSignedHexInteger64(127).TwosComplement(ctx, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x7f", u.String())
+
+	_, err = NewSignedHexInteger64(128).TwosComplement(ctx, 8)
+	assert.Regexp(t, "FF22228.*128.*8", err)
+
+	_, err = NewSignedHexInteger64(-129).TwosComplement(ctx, 8)
+	assert.Regexp(t, "FF22228", err)
+
+	_, err = NewSignedHexInteger64(0).TwosComplement(ctx, 0)
+	assert.Regexp(t, "FF22228", err)
+
+	b, err := NewSignedHexInteger64(-2).TwosComplementBytes(ctx, 32)
+	assert.NoError(t, err)
+	assert.Equal(t, "fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe", HexBytesPlain(b).String())
+
+	_, err = NewSignedHexInteger(new(big.Int).Lsh(big.NewInt(1), 255)).TwosComplementBytes(ctx, 32)
+	assert.Regexp(t, "FF22228", err)
+}
+
+func TestSignedHexIntegerFromTwosComplement(t *testing.T) {
+	ctx := context.Background()
+
+	i, err := NewSignedHexIntegerFromTwosComplement(ctx, big.NewInt(0xff), 8)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), i.Int64())
+
+	i, err = NewSignedHexIntegerFromTwosComplement(ctx, big.NewInt(0x7f), 8)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(127), i.Int64())
+
+	i, err = NewSignedHexIntegerFromTwosComplement(ctx, big.NewInt(0), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), i.Int64())
+
+	_, err = NewSignedHexIntegerFromTwosComplement(ctx, big.NewInt(0x100), 8)
+	assert.Regexp(t, "FF22228", err)
+
+	_, err = NewSignedHexIntegerFromTwosComplement(ctx, big.NewInt(-1), 8)
+	assert.Regexp(t, "FF22228", err)
+
+	word, _ := NewHexBytes0xPrefix("0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe")
+	assert.Equal(t, "-0x2", NewSignedHexIntegerFromTwosComplementBytes(word).String())
+
+	// Round trip the most negative int256
+	minInt256 := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255))
+	b, err := NewSignedHexInteger(minInt256).TwosComplementBytes(ctx, 32)
+	assert.NoError(t, err)
+	assert.Equal(t, minInt256, NewSignedHexIntegerFromTwosComplementBytes(b).BigInt())
+}
+
+func TestSignedHexIntegerScan(t *testing.T) {
+	i := &SignedHexInteger{}
+	err := i.Scan(false)
+	assert.Regexp(t, "FF00105", err)
+	err = i.Scan(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x0", i.String())
+	err = i.Scan(int64(-5555))
+	assert.NoError(t, err)
+	assert.Equal(t, "-0x15b3", i.String())
+	err = i.Scan("-0x15b3")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-5555), i.Int64())
+	err = i.Scan("not a number")
+	assert.Regexp(t, "FF22088", err)
+}
@@ -0,0 +1,97 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+type AccountSort string
+
+const (
+	// AccountSortIndexed returns accounts in the order they were indexed (default)
+	AccountSortIndexed AccountSort = "indexed"
+	// AccountSortAddress returns accounts in address order
+	AccountSortAddress AccountSort = "address"
+)
+
+// AccountQuery filters, sorts and pages the accounts returned by QueryAccounts
+type AccountQuery struct {
+	Prefix     string      // only addresses that start with this hex prefix (0x optional, case-insensitive)
+	Sort       AccountSort // indexed (default) or address
+	Descending bool        // reverses the sort order
+	Skip       int         // number of matching accounts to skip
+	Limit      int         // maximum number of accounts to return - all remaining when zero or less
+}
+
+// QueryAccounts returns a page of the currently cached list of known addresses that match the query,
+// along with the total number that match (so the caller can page through them)
+func (w *fsWallet) QueryAccounts(ctx context.Context, query *AccountQuery) ([]*ethtypes.Address0xHex, int, error) {
+	prefix := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(query.Prefix, "0x"), "0X"))
+	if _, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix)%2)); err != nil || len(prefix) > 40 {
+		return nil, -1, i18n.NewError(ctx, signermsgs.MsgInvalidAccountPrefix, query.Prefix)
+	}
+	switch query.Sort {
+	case "", AccountSortIndexed, AccountSortAddress:
+	default:
+		return nil, -1, i18n.NewError(ctx, signermsgs.MsgUnknownAccountSort, query.Sort)
+	}
+
+	w.mux.Lock()
+	matches := make([]*ethtypes.Address0xHex, 0, len(w.addressList))
+	for _, addr := range w.addressList {
+		if strings.HasPrefix(addr.String()[2:], prefix) {
+			matches = append(matches, addr)
+		}
+	}
+	w.mux.Unlock()
+
+	if query.Sort == AccountSortAddress {
+		sort.Slice(matches, func(i, j int) bool { return bytes.Compare(matches[i][:], matches[j][:]) < 0 })
+	}
+	if query.Descending {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+	return pageAccounts(matches, query.Skip, query.Limit), len(matches), nil
+}
+
+// pageAccounts returns a copy of a page of the accounts. A limit of zero or less returns all accounts after the skip.
+func pageAccounts(accounts []*ethtypes.Address0xHex, skip, limit int) []*ethtypes.Address0xHex {
+	if skip < 0 {
+		skip = 0
+	}
+	if skip >= len(accounts) {
+		return []*ethtypes.Address0xHex{}
+	}
+	end := len(accounts)
+	if limit > 0 && skip+limit < end {
+		end = skip + limit
+	}
+	page := make([]*ethtypes.Address0xHex, end-skip)
+	copy(page, accounts[skip:end])
+	return page
+}
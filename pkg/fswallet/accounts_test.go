@@ -0,0 +1,90 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryAccounts(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+
+	all, err := f.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	page, total, err := f.QueryAccounts(ctx, &AccountQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, all, page)
+
+	page, total, err = f.QueryAccounts(ctx, &AccountQuery{Descending: true, Skip: 1, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, all[1:2], page)
+
+	page, _, err = f.QueryAccounts(ctx, &AccountQuery{Sort: AccountSortAddress})
+	assert.NoError(t, err)
+	for i := 1; i < len(page); i++ {
+		assert.Less(t, page[i-1].String(), page[i].String())
+	}
+	desc, _, err := f.QueryAccounts(ctx, &AccountQuery{Sort: AccountSortAddress, Descending: true})
+	assert.NoError(t, err)
+	assert.Equal(t, page[0], desc[2])
+	assert.Equal(t, page[2], desc[0])
+
+	prefix := strings.ToUpper(all[1].String()[2:5])
+	page, total, err = f.QueryAccounts(ctx, &AccountQuery{Prefix: "0x" + prefix})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, total, 1)
+	assert.Contains(t, page, all[1])
+	for _, addr := range page {
+		assert.True(t, strings.HasPrefix(addr.String()[2:], strings.ToLower(prefix)))
+	}
+
+	page, total, err = f.QueryAccounts(ctx, &AccountQuery{Prefix: all[1].String()})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, all[1:2], page)
+
+	page, total, err = f.QueryAccounts(ctx, &AccountQuery{Skip: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Empty(t, page)
+
+}
+
+func TestQueryAccountsBadQuery(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+
+	_, _, err := f.QueryAccounts(ctx, &AccountQuery{Prefix: "0xzz"})
+	assert.Regexp(t, "FF22151", err)
+
+	_, _, err = f.QueryAccounts(ctx, &AccountQuery{Prefix: strings.Repeat("a", 41)})
+	assert.Regexp(t, "FF22151", err)
+
+	_, _, err = f.QueryAccounts(ctx, &AccountQuery{Sort: "random"})
+	assert.Regexp(t, "FF22152", err)
+
+}
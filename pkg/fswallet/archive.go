@@ -0,0 +1,310 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing/fstest"
+
+	"filippo.io/age"
+	agearmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+const (
+	// ArchiveFormatAuto selects the format from the extension of the archive, after any .age or .gpg extension
+	ArchiveFormatAuto  = "auto"
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTar   = "tar"
+	ArchiveFormatTarGz = "tar.gz"
+
+	// ArchiveEncryptionAuto selects the encryption from the extension of the archive - .age, or .gpg / .pgp / .asc
+	ArchiveEncryptionAuto = "auto"
+	ArchiveEncryptionNone = "none"
+	ArchiveEncryptionAge  = "age"
+	ArchiveEncryptionGPG  = "gpg"
+)
+
+// readArchive decrypts and unpacks the archive into memory, so the wallet can be read from a single sealed
+// file. Only regular files are unpacked - directories are implied by the names of the files they contain.
+func readArchive(ctx context.Context, conf *ArchiveConfig) (fstest.MapFS, error) {
+	encryption := conf.Encryption
+	extEncryption, name := archiveEncryptionFromExt(conf.Path)
+	if encryption == "" || encryption == ArchiveEncryptionAuto {
+		encryption = extEncryption
+	}
+	format := conf.Format
+	if format == "" || format == ArchiveFormatAuto {
+		format = archiveFormatFromExt(name)
+	}
+	switch format {
+	case ArchiveFormatZip, ArchiveFormatTar, ArchiveFormatTarGz:
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgArchiveUnknownFormat, format, conf.Path)
+	}
+
+	f, err := os.Open(conf.Path)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgArchiveReadFailed, conf.Path, err)
+	}
+	defer f.Close()
+	r, err := decryptArchive(ctx, conf, encryption, bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+
+	u := &archiveUnpacker{conf: conf, files: fstest.MapFS{}}
+	if format == ArchiveFormatZip {
+		// The zip directory is at the end of the file, so the whole archive is read into memory first
+		var data []byte
+		if data, err = u.readAll(ctx, r); err == nil {
+			err = u.unpackZip(ctx, data)
+		}
+	} else {
+		if format == ArchiveFormatTarGz {
+			var gz *gzip.Reader
+			if gz, err = gzip.NewReader(r); err != nil {
+				return nil, i18n.NewError(ctx, signermsgs.MsgArchiveReadFailed, conf.Path, err)
+			}
+			r = gz
+		}
+		err = u.unpackTar(ctx, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.L(ctx).Infof("Unpacked %d files (%d bytes) from wallet archive %s", len(u.files), u.size, conf.Path)
+	return u.files, nil
+}
+
+func archiveEncryptionFromExt(name string) (string, string) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".age":
+		return ArchiveEncryptionAge, strings.TrimSuffix(name, path.Ext(name))
+	case ".gpg", ".pgp", ".asc":
+		return ArchiveEncryptionGPG, strings.TrimSuffix(name, path.Ext(name))
+	default:
+		return ArchiveEncryptionNone, name
+	}
+}
+
+func archiveFormatFromExt(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveFormatZip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveFormatTarGz
+	case strings.HasSuffix(lower, ".tar"):
+		return ArchiveFormatTar
+	default:
+		return path.Ext(name)
+	}
+}
+
+func decryptArchive(ctx context.Context, conf *ArchiveConfig, encryption string, r *bufio.Reader) (io.Reader, error) {
+	var passphrase []byte
+	if conf.PassphraseFile != "" {
+		b, err := os.ReadFile(conf.PassphraseFile)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgArchiveDecryptFailed, conf.Path, err)
+		}
+		passphrase = bytes.TrimSpace(b)
+	}
+	var dr io.Reader
+	var err error
+	switch encryption {
+	case ArchiveEncryptionNone:
+		return r, nil
+	case ArchiveEncryptionAge:
+		dr, err = decryptAge(conf, passphrase, r)
+	case ArchiveEncryptionGPG:
+		dr, err = decryptGPG(conf, passphrase, r)
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgArchiveUnknownEncryption, encryption, conf.Path)
+	}
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgArchiveDecryptFailed, conf.Path, err)
+	}
+	return dr, nil
+}
+
+func decryptAge(conf *ArchiveConfig, passphrase []byte, r *bufio.Reader) (io.Reader, error) {
+	var identities []age.Identity
+	if conf.IdentityFile != "" {
+		b, err := os.ReadFile(conf.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		if identities, err = age.ParseIdentities(bytes.NewReader(b)); err != nil {
+			return nil, err
+		}
+	}
+	if passphrase != nil {
+		identity, err := age.NewScryptIdentity(string(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	var src io.Reader = r
+	if peek, _ := r.Peek(len(agearmor.Header)); string(peek) == agearmor.Header {
+		src = agearmor.NewReader(r)
+	}
+	return age.Decrypt(src, identities...)
+}
+
+func decryptGPG(conf *ArchiveConfig, passphrase []byte, r *bufio.Reader) (io.Reader, error) {
+	var keyring openpgp.EntityList
+	if conf.KeyringFile != "" {
+		b, err := os.ReadFile(conf.KeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		if keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(b)); err != nil {
+			if keyring, err = openpgp.ReadKeyRing(bytes.NewReader(b)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var src io.Reader = r
+	if peek, _ := r.Peek(len("-----BEGIN PGP")); string(peek) == "-----BEGIN PGP" {
+		block, err := pgparmor.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		src = block.Body
+	}
+	prompted := false
+	md, err := openpgp.ReadMessage(src, keyring, func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		// Called again if the passphrase was wrong, so only the first attempt is made
+		if prompted || passphrase == nil {
+			return nil, errors.New("no passphrase to decrypt the archive, or the private key it is encrypted to")
+		}
+		prompted = true
+		if symmetric {
+			return passphrase, nil
+		}
+		for _, k := range keys {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				if err := k.PrivateKey.Decrypt(passphrase); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return md.UnverifiedBody, nil
+}
+
+// archiveUnpacker holds the files unpacked so far, and their total size, which is limited to the maximum
+// size of the archive so a small archive cannot expand to exhaust memory
+type archiveUnpacker struct {
+	conf  *ArchiveConfig
+	files fstest.MapFS
+	size  int64
+}
+
+func (u *archiveUnpacker) readAll(ctx context.Context, r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, u.conf.MaxSize-u.size+1))
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgArchiveReadFailed, u.conf.Path, err)
+	}
+	if int64(len(b)) > u.conf.MaxSize-u.size {
+		return nil, i18n.NewError(ctx, signermsgs.MsgArchiveTooLarge, u.conf.Path, u.conf.MaxSize)
+	}
+	return b, nil
+}
+
+func (u *archiveUnpacker) addFile(ctx context.Context, name string, mode fs.FileMode, r io.Reader) error {
+	cleanName := path.Clean(strings.TrimPrefix(name, "/"))
+	if !fs.ValidPath(cleanName) || cleanName == "." {
+		return i18n.NewError(ctx, signermsgs.MsgArchiveBadEntry, name, u.conf.Path)
+	}
+	b, err := u.readAll(ctx, r)
+	if err != nil {
+		return err
+	}
+	u.size += int64(len(b))
+	u.files[cleanName] = &fstest.MapFile{Data: b, Mode: mode.Perm()}
+	return nil
+}
+
+func (u *archiveUnpacker) unpackZip(ctx context.Context, data []byte) error {
+	// Reading the zip is not counted towards the maximum size, as only the files it contains are kept
+	u.size = 0
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgArchiveReadFailed, u.conf.Path, err)
+	}
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		if err := u.unpackZipFile(ctx, zf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *archiveUnpacker) unpackZipFile(ctx context.Context, zf *zip.File) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgArchiveReadFailed, u.conf.Path, fmt.Errorf("%s: %w", zf.Name, err))
+	}
+	defer rc.Close()
+	return u.addFile(ctx, zf.Name, zf.Mode(), rc)
+}
+
+func (u *archiveUnpacker) unpackTar(ctx context.Context, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgArchiveReadFailed, u.conf.Path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := u.addFile(ctx, hdr.Name, hdr.FileInfo().Mode(), tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func testArchiveFiles(t *testing.T) (*secp256k1.KeyPair, map[string][]byte) {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	return keypair, map[string][]byte{
+		"keys/" + keypair.Address.String()[2:] + ".key": []byte(fmt.Sprintf("0x%x\n", keypair.PrivateKeyBytes())),
+		"keys/readme.txt": []byte("not a key"),
+	}
+}
+
+func testZip(t *testing.T, files map[string][]byte) []byte {
+	buff := new(bytes.Buffer)
+	zw := zip.NewWriter(buff)
+	_, err := zw.Create("keys/")
+	assert.NoError(t, err)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, err = w.Write(data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	return buff.Bytes()
+}
+
+func testTarGz(t *testing.T, files map[string][]byte) []byte {
+	buff := new(bytes.Buffer)
+	gw := gzip.NewWriter(buff)
+	tw := tar.NewWriter(gw)
+	err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "./keys/", Mode: 0755})
+	assert.NoError(t, err)
+	for name, data := range files {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "./" + name, Mode: 0600, Size: int64(len(data))})
+		assert.NoError(t, err)
+		_, err = tw.Write(data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gw.Close())
+	return buff.Bytes()
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	filename := path.Join(t.TempDir(), name)
+	err := os.WriteFile(filename, data, 0600)
+	assert.NoError(t, err)
+	return filename
+}
+
+func newTestArchiveWallet(t *testing.T, setup func(section config.Section)) (context.Context, Wallet, error) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ConfigPath, "keys")
+	unitTestConfig.Set(ConfigFilenamesPrimaryExt, ".key")
+	unitTestConfig.Set(ConfigKeyFormat, KeyFormatHex)
+	setup(unitTestConfig)
+	ctx := context.Background()
+
+	w, err := NewFilesystemWallet(ctx, ReadConfig(unitTestConfig))
+	if err == nil {
+		t.Cleanup(func() { _ = w.Close() })
+	}
+	return ctx, w, err
+}
+
+func checkArchiveWallet(t *testing.T, keypair *secp256k1.KeyPair, setup func(section config.Section)) {
+	ctx, w, err := newTestArchiveWallet(t, setup)
+	assert.NoError(t, err)
+
+	err = w.Initialize(ctx)
+	assert.NoError(t, err)
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 1)
+	assert.Equal(t, keypair.Address.String(), accounts[0].String())
+}
+
+func TestArchiveZipOK(t *testing.T) {
+
+	keypair, files := testArchiveFiles(t)
+	filename := writeTestFile(t, "wallet.zip", testZip(t, files))
+
+	checkArchiveWallet(t, keypair, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+	})
+
+}
+
+func TestArchiveTarGzRootOK(t *testing.T) {
+
+	keypair, files := testArchiveFiles(t)
+	rootFiles := map[string][]byte{}
+	for name, data := range files {
+		rootFiles[path.Base(name)] = data
+	}
+	filename := writeTestFile(t, "wallet.tgz", testTarGz(t, rootFiles))
+
+	// The path defaults to the root of the archive
+	checkArchiveWallet(t, keypair, func(section config.Section) {
+		section.Set(ConfigPath, "")
+		section.Set(ConfigArchivePath, filename)
+	})
+
+}
+
+func TestArchiveAgeX25519OK(t *testing.T) {
+
+	keypair, files := testArchiveFiles(t)
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+
+	buff := new(bytes.Buffer)
+	aw := armor.NewWriter(buff)
+	w, err := age.Encrypt(aw, identity.Recipient())
+	assert.NoError(t, err)
+	_, err = w.Write(testTarGz(t, files))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, aw.Close())
+	filename := writeTestFile(t, "wallet.tar.gz.age", buff.Bytes())
+	identityFile := writeTestFile(t, "identity.txt", []byte(identity.String()+"\n"))
+
+	checkArchiveWallet(t, keypair, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+		section.Set(ConfigArchiveIdentityFile, identityFile)
+	})
+
+}
+
+func TestArchiveAgePassphraseOK(t *testing.T) {
+
+	keypair, files := testArchiveFiles(t)
+	recipient, err := age.NewScryptRecipient("correct horse")
+	assert.NoError(t, err)
+	recipient.SetWorkFactor(10)
+
+	buff := new(bytes.Buffer)
+	w, err := age.Encrypt(buff, recipient)
+	assert.NoError(t, err)
+	_, err = w.Write(testZip(t, files))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	filename := writeTestFile(t, "wallet.bin", buff.Bytes())
+	passphraseFile := writeTestFile(t, "passphrase", []byte("correct horse\n"))
+
+	checkArchiveWallet(t, keypair, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+		section.Set(ConfigArchiveFormat, ArchiveFormatZip)
+		section.Set(ConfigArchiveEncryption, ArchiveEncryptionAge)
+		section.Set(ConfigArchivePassphraseFile, passphraseFile)
+	})
+
+}
+
+func TestArchiveGPGSymmetricOK(t *testing.T) {
+
+	keypair, files := testArchiveFiles(t)
+
+	buff := new(bytes.Buffer)
+	w, err := openpgp.SymmetricallyEncrypt(buff, []byte("correct horse"), nil, nil)
+	assert.NoError(t, err)
+	_, err = w.Write(testZip(t, files))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	filename := writeTestFile(t, "wallet.zip.gpg", buff.Bytes())
+	passphraseFile := writeTestFile(t, "passphrase", []byte("correct horse"))
+
+	checkArchiveWallet(t, keypair, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+		section.Set(ConfigArchivePassphraseFile, passphraseFile)
+	})
+
+}
+
+func TestArchiveGPGKeyOK(t *testing.T) {
+
+	keypair, files := testArchiveFiles(t)
+	entity, err := openpgp.NewEntity("wallet", "", "wallet@example.com", nil)
+	assert.NoError(t, err)
+
+	buff := new(bytes.Buffer)
+	aw, err := pgparmor.Encode(buff, "PGP MESSAGE", nil)
+	assert.NoError(t, err)
+	w, err := openpgp.Encrypt(aw, []*openpgp.Entity{entity}, nil, nil, nil)
+	assert.NoError(t, err)
+	_, err = w.Write(testTarGz(t, files))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, aw.Close())
+	filename := writeTestFile(t, "wallet.tar.gz.asc", buff.Bytes())
+
+	err = entity.EncryptPrivateKeys([]byte("key passphrase"), nil)
+	assert.NoError(t, err)
+	keyring := new(bytes.Buffer)
+	err = entity.SerializePrivateWithoutSigning(keyring, nil)
+	assert.NoError(t, err)
+	keyringFile := writeTestFile(t, "keyring.gpg", keyring.Bytes())
+	passphraseFile := writeTestFile(t, "passphrase", []byte("key passphrase"))
+
+	checkArchiveWallet(t, keypair, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+		section.Set(ConfigArchiveKeyringFile, keyringFile)
+		section.Set(ConfigArchivePassphraseFile, passphraseFile)
+	})
+
+}
+
+func TestArchiveAgeWrongIdentity(t *testing.T) {
+
+	_, files := testArchiveFiles(t)
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	otherIdentity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+
+	buff := new(bytes.Buffer)
+	w, err := age.Encrypt(buff, identity.Recipient())
+	assert.NoError(t, err)
+	_, err = w.Write(testZip(t, files))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	filename := writeTestFile(t, "wallet.zip.age", buff.Bytes())
+	identityFile := writeTestFile(t, "identity.txt", []byte(otherIdentity.String()))
+
+	_, _, err = newTestArchiveWallet(t, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+		section.Set(ConfigArchiveIdentityFile, identityFile)
+	})
+	assert.Regexp(t, "FF22225", err)
+
+}
+
+func TestArchiveGPGWrongPassphrase(t *testing.T) {
+
+	_, files := testArchiveFiles(t)
+
+	buff := new(bytes.Buffer)
+	w, err := openpgp.SymmetricallyEncrypt(buff, []byte("correct horse"), nil, nil)
+	assert.NoError(t, err)
+	_, err = w.Write(testZip(t, files))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	filename := writeTestFile(t, "wallet.zip.gpg", buff.Bytes())
+	passphraseFile := writeTestFile(t, "passphrase", []byte("battery staple"))
+
+	_, _, err = newTestArchiveWallet(t, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+		section.Set(ConfigArchivePassphraseFile, passphraseFile)
+	})
+	assert.Regexp(t, "FF22225", err)
+
+}
+
+func TestArchiveDecryptMissingFiles(t *testing.T) {
+
+	filename := writeTestFile(t, "wallet.zip.age", []byte("age"))
+	for _, key := range []string{ConfigArchiveIdentityFile, ConfigArchiveKeyringFile, ConfigArchivePassphraseFile} {
+		_, _, err := newTestArchiveWallet(t, func(section config.Section) {
+			section.Set(ConfigArchivePath, filename)
+			section.Set(ConfigArchiveEncryption, ArchiveEncryptionGPG)
+			if key == ConfigArchiveIdentityFile {
+				section.Set(ConfigArchiveEncryption, ArchiveEncryptionAge)
+			}
+			section.Set(key, path.Join(t.TempDir(), "missing"))
+		})
+		assert.Regexp(t, "FF22225", err)
+	}
+
+}
+
+func TestArchiveUnknownFormat(t *testing.T) {
+
+	_, _, err := newTestArchiveWallet(t, func(section config.Section) {
+		section.Set(ConfigArchivePath, "wallet.rar.age")
+	})
+	assert.Regexp(t, "FF22223.*\\.rar", err)
+
+}
+
+func TestArchiveUnknownEncryption(t *testing.T) {
+
+	filename := writeTestFile(t, "wallet.zip", testZip(t, map[string][]byte{}))
+	_, _, err := newTestArchiveWallet(t, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+		section.Set(ConfigArchiveEncryption, "rot13")
+	})
+	assert.Regexp(t, "FF22224", err)
+
+}
+
+func TestArchiveMissing(t *testing.T) {
+
+	_, _, err := newTestArchiveWallet(t, func(section config.Section) {
+		section.Set(ConfigArchivePath, path.Join(t.TempDir(), "wallet.zip"))
+	})
+	assert.Regexp(t, "FF22222", err)
+
+}
+
+func TestArchiveCorrupt(t *testing.T) {
+
+	for _, name := range []string{"wallet.zip", "wallet.tar", "wallet.tar.gz"} {
+		filename := writeTestFile(t, name, []byte("not an archive, but long enough to be read as a tar header block"))
+		_, _, err := newTestArchiveWallet(t, func(section config.Section) {
+			section.Set(ConfigArchivePath, filename)
+		})
+		assert.Regexp(t, "FF22222", err)
+	}
+
+}
+
+func TestArchiveTooLarge(t *testing.T) {
+
+	files := map[string][]byte{"keys/big.key": bytes.Repeat([]byte{'0'}, 2048)}
+	for name, data := range map[string][]byte{"wallet.zip": testZip(t, files), "wallet.tgz": testTarGz(t, files)} {
+		filename := writeTestFile(t, name, data)
+		_, _, err := newTestArchiveWallet(t, func(section config.Section) {
+			section.Set(ConfigArchivePath, filename)
+			section.Set(ConfigArchiveMaxSize, "1Kb")
+		})
+		assert.Regexp(t, "FF22226", err)
+	}
+
+}
+
+func TestArchiveBadEntry(t *testing.T) {
+
+	buff := new(bytes.Buffer)
+	tw := tar.NewWriter(buff)
+	err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "../escape.key", Size: 1})
+	assert.NoError(t, err)
+	_, err = tw.Write([]byte{'0'})
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+	filename := writeTestFile(t, "wallet.tar", buff.Bytes())
+
+	_, _, err = newTestArchiveWallet(t, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+	})
+	assert.Regexp(t, "FF22227.*escape", err)
+
+}
+
+func TestArchiveZipEntryCorrupt(t *testing.T) {
+
+	data := testZip(t, map[string][]byte{"keys/a.key": bytes.Repeat([]byte{'a'}, 100)})
+	// Corrupt the stored data of the entry, so the checksum fails when it is read
+	idx := bytes.Index(data, bytes.Repeat([]byte{'a'}, 10))
+	if idx < 0 {
+		// compressed - corrupt the byte after the local header name instead
+		idx = bytes.Index(data, []byte("keys/a.key")) + len("keys/a.key")
+	}
+	data[idx] ^= 0xff
+	filename := writeTestFile(t, "wallet.zip", data)
+
+	_, _, err := newTestArchiveWallet(t, func(section config.Section) {
+		section.Set(ConfigArchivePath, filename)
+	})
+	assert.Regexp(t, "FF22222", err)
+
+}
@@ -0,0 +1,155 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+const (
+	// AuditSinkNone disables the signing audit log (default)
+	AuditSinkNone = "none"
+	// AuditSinkStdout writes each audit record as a line of JSON to stdout
+	AuditSinkStdout = "stdout"
+	// AuditSinkFile appends each audit record as a line of JSON to a file
+	AuditSinkFile = "file"
+)
+
+const (
+	// AuditOperationSignTransaction is recorded for Sign
+	AuditOperationSignTransaction = "sign_transaction"
+	// AuditOperationSignTypedData is recorded for SignTypedDataV4
+	AuditOperationSignTypedData = "sign_typed_data"
+	// AuditOperationSignAuthorization is recorded for SignAuthorization
+	AuditOperationSignAuthorization = "sign_authorization"
+)
+
+// AuditRecord describes a single signing request, whether it succeeded or failed
+type AuditRecord struct {
+	Time      *fftypes.FFTime           `json:"time"`
+	Operation string                    `json:"operation"`
+	Address   *ethtypes.Address0xHex    `json:"address,omitempty"` // nil if the request did not contain a valid address
+	ChainID   *big.Int                  `json:"chainId,omitempty"` // transactions only
+	Hash      ethtypes.HexBytes0xPrefix `json:"hash,omitempty"`    // the transaction hash, EIP-712 hash, or EIP-7702 authorization hash, once signed
+	Fields    map[string]interface{}    `json:"fields,omitempty"`  // the log fields of the caller's context, such as the request ID
+	Success   bool                      `json:"success"`
+	Error     string                    `json:"error,omitempty"`
+}
+
+// AuditSink receives an audit record for every signing request. Records are delivered synchronously
+// before the signing call returns, from any go-routine, so implementations must be safe for concurrent use.
+type AuditSink interface {
+	AuditSign(ctx context.Context, record *AuditRecord)
+}
+
+// jsonAuditSink writes one line of JSON per record
+type jsonAuditSink struct {
+	mux sync.Mutex
+	out io.Writer
+}
+
+// NewJSONAuditSink returns a sink that writes each record as a line of JSON to the writer
+func NewJSONAuditSink(out io.Writer) AuditSink {
+	return &jsonAuditSink{out: out}
+}
+
+func (s *jsonAuditSink) AuditSign(ctx context.Context, record *AuditRecord) {
+	b, err := json.Marshal(record)
+	if err == nil {
+		s.mux.Lock()
+		_, err = s.out.Write(append(b, '\n'))
+		s.mux.Unlock()
+	}
+	if err != nil {
+		log.L(ctx).Errorf("Failed to write signing audit record %+v: %s", record, err)
+	}
+}
+
+// ChannelAuditSink delivers each record to a channel. The send blocks until it is received, so
+// that records are never dropped - the consumer must keep up, or signing is delayed.
+type ChannelAuditSink chan<- *AuditRecord
+
+func (s ChannelAuditSink) AuditSign(ctx context.Context, record *AuditRecord) {
+	select {
+	case s <- record:
+	case <-ctx.Done():
+		log.L(ctx).Errorf("Signing audit record %+v not delivered, as the request context is done", record)
+	}
+}
+
+// newAuditSinkFromConfig returns nil when auditing is disabled, and any file it opened for the wallet to close
+func newAuditSinkFromConfig(ctx context.Context, conf *AuditConfig) (AuditSink, io.Closer, error) {
+	switch conf.Sink {
+	case "", AuditSinkNone:
+		return nil, nil, nil
+	case AuditSinkStdout:
+		return NewJSONAuditSink(os.Stdout), nil, nil
+	case AuditSinkFile:
+		if conf.File == "" {
+			return nil, nil, i18n.NewError(ctx, signermsgs.MsgAuditSinkNoConfig, AuditSinkFile, ConfigAuditFile)
+		}
+		f, err := os.OpenFile(conf.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, nil, i18n.NewError(ctx, signermsgs.MsgAuditFileOpen, conf.File, err)
+		}
+		return NewJSONAuditSink(f), f, nil
+	default:
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUnknownAuditSink, conf.Sink)
+	}
+}
+
+// auditSinkRef allows the sink (of any type) to be swapped atomically
+type auditSinkRef struct {
+	sink AuditSink
+}
+
+// SetAuditSink replaces the audit sink built from the audit configuration, for example to deliver records to a
+// ChannelAuditSink, or to a custom compliance system. A nil sink disables auditing.
+func (w *fsWallet) SetAuditSink(sink AuditSink) {
+	w.auditSink.Store(&auditSinkRef{sink: sink})
+}
+
+// audit records the outcome of a signing request, if there is an audit sink
+func (w *fsWallet) audit(ctx context.Context, record *AuditRecord, err error) {
+	ref := w.auditSink.Load()
+	if ref == nil || ref.sink == nil {
+		return
+	}
+	record.Time = fftypes.Now()
+	if fields := log.L(ctx).Data; len(fields) > 0 {
+		record.Fields = make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			record.Fields[k] = v
+		}
+	}
+	record.Success = err == nil
+	if err != nil {
+		record.Error = err.Error()
+	}
+	ref.sink.AuditSign(ctx, record)
+}
@@ -0,0 +1,230 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/sha3"
+)
+
+type errorWriter struct{}
+
+func (errorWriter) Write(_ []byte) (int, error) {
+	return 0, fmt.Errorf("pop")
+}
+
+func TestAuditSignTransaction(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	records := make(chan *AuditRecord, 1)
+	f.SetAuditSink(ChannelAuditSink(records))
+	ctx = log.WithLogger(ctx, log.L(ctx).WithField("req", "abc123"))
+
+	signed, err := f.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`),
+	}, 2022)
+	assert.NoError(t, err)
+
+	record := <-records
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(signed)
+	assert.Equal(t, AuditOperationSignTransaction, record.Operation)
+	assert.Equal(t, "0x1f185718734552d08278aa70f804580bab5fd2b4", record.Address.String())
+	assert.Equal(t, int64(2022), record.ChainID.Int64())
+	assert.Equal(t, ethtypes.HexBytes0xPrefix(hash.Sum(nil)), record.Hash)
+	assert.Equal(t, "abc123", record.Fields["req"])
+	assert.True(t, record.Success)
+	assert.NotNil(t, record.Time)
+
+	_, err = f.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"`),
+	}, 2022)
+	assert.Regexp(t, "FF22014", err)
+	record = <-records
+	assert.Equal(t, "0xffffffffffffffffffffffffffffffffffffffff", record.Address.String())
+	assert.False(t, record.Success)
+	assert.Regexp(t, "FF22014", record.Error)
+	assert.Nil(t, record.Hash)
+
+	_, err = f.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"bad address"`),
+	}, 2022)
+	assert.Error(t, err)
+	record = <-records
+	assert.Nil(t, record.Address)
+	assert.False(t, record.Success)
+
+}
+
+func TestAuditSignTypedData(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	records := make(chan *AuditRecord, 1)
+	f.SetAuditSink(ChannelAuditSink(records))
+
+	result, err := f.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0x1f185718734552d08278aa70f804580bab5fd2b4`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+
+	record := <-records
+	assert.Equal(t, AuditOperationSignTypedData, record.Operation)
+	assert.Equal(t, result.Hash, record.Hash)
+	assert.Zero(t, record.ChainID)
+	assert.True(t, record.Success)
+
+}
+
+func TestAuditSignAuthorization(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	records := make(chan *AuditRecord, 1)
+	f.SetAuditSink(ChannelAuditSink(records))
+
+	auth := &ethsigner.Authorization{ChainID: ethtypes.NewHexInteger64(2022)}
+	err := f.SignAuthorization(ctx, *ethtypes.MustNewAddress(`0x1f185718734552d08278aa70f804580bab5fd2b4`), auth)
+	assert.NoError(t, err)
+	authority, err := auth.RecoverAuthority()
+	assert.NoError(t, err)
+	assert.Equal(t, "0x1f185718734552d08278aa70f804580bab5fd2b4", authority.String())
+
+	record := <-records
+	assert.Equal(t, AuditOperationSignAuthorization, record.Operation)
+	assert.Len(t, record.Hash, 32)
+	assert.Equal(t, int64(2022), record.ChainID.Int64())
+	assert.True(t, record.Success)
+
+	err = f.SignAuthorization(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`), auth)
+	assert.Regexp(t, "FF22014", err)
+	record = <-records
+	assert.False(t, record.Success)
+	assert.Empty(t, record.Hash)
+
+}
+
+func TestAuditSinkDisabled(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	f.SetAuditSink(nil)
+
+	_, err := f.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`),
+	}, 2022)
+	assert.NoError(t, err)
+
+}
+
+func TestAuditFileSink(t *testing.T) {
+	config.RootConfigReset()
+	auditFile := path.Join(t.TempDir(), "audit.log")
+
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ConfigPath, "../../test/keystore_toml")
+	unitTestConfig.Set(ConfigFilenamesPrimaryExt, ".toml")
+	unitTestConfig.Set(ConfigMetadataKeyFileProperty, `{{ index .signing "key-file" }}`)
+	unitTestConfig.Set(ConfigMetadataPasswordFileProperty, `{{ index .signing "password-file" }}`)
+	unitTestConfig.Set(ConfigDisableListener, true)
+	unitTestConfig.Set(ConfigAuditSink, AuditSinkFile)
+	unitTestConfig.Set(ConfigAuditFile, auditFile)
+	ctx := context.Background()
+
+	ff, err := NewFilesystemWallet(ctx, ReadConfig(unitTestConfig))
+	assert.NoError(t, err)
+	err = ff.Initialize(ctx)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = ff.Sign(ctx, &ethsigner.Transaction{
+			From: json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`),
+		}, 2022)
+		assert.NoError(t, err)
+	}
+	ff.Close()
+
+	fh, err := os.Open(auditFile)
+	assert.NoError(t, err)
+	defer fh.Close()
+	stat, err := fh.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	scanner := bufio.NewScanner(fh)
+	lines := 0
+	for scanner.Scan() {
+		var record AuditRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		assert.NoError(t, err)
+		assert.Equal(t, "0x1f185718734552d08278aa70f804580bab5fd2b4", record.Address.String())
+		assert.True(t, record.Success)
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestAuditSinkFromConfig(t *testing.T) {
+	ctx := context.Background()
+
+	sink, closer, err := newAuditSinkFromConfig(ctx, &AuditConfig{Sink: AuditSinkStdout})
+	assert.NoError(t, err)
+	assert.NotNil(t, sink)
+	assert.Nil(t, closer)
+
+	sink, _, err = newAuditSinkFromConfig(ctx, &AuditConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, sink)
+
+	_, _, err = newAuditSinkFromConfig(ctx, &AuditConfig{Sink: "wrong"})
+	assert.Regexp(t, "FF22121", err)
+
+	_, _, err = newAuditSinkFromConfig(ctx, &AuditConfig{Sink: AuditSinkFile})
+	assert.Regexp(t, "FF22122", err)
+
+	_, _, err = newAuditSinkFromConfig(ctx, &AuditConfig{Sink: AuditSinkFile, File: path.Join(t.TempDir(), "missing", "audit.log")})
+	assert.Regexp(t, "FF22123", err)
+}
+
+func TestNewWalletBadAuditConfig(t *testing.T) {
+	_, err := NewFilesystemWallet(context.Background(), &Config{Audit: AuditConfig{Sink: "wrong"}})
+	assert.Regexp(t, "FF22121", err)
+}
+
+func TestJSONAuditSinkWriteFail(t *testing.T) {
+	// Errors are logged, as the signing request has already completed
+	NewJSONAuditSink(errorWriter{}).AuditSign(context.Background(), &AuditRecord{})
+}
+
+func TestChannelAuditSinkContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ChannelAuditSink(make(chan *AuditRecord)).AuditSign(ctx, &AuditRecord{})
+}
@@ -0,0 +1,159 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+)
+
+// cachedKey is a decrypted key held in the signer cache. Once evicted (or the wallet is closed) the key
+// material is zeroed, as soon as no signing request is still copying it. A key that has been handed out by
+// GetWalletFile is never zeroed, as the caller might still be using it.
+type cachedKey struct {
+	wf        keystorev3.WalletFile
+	mux       sync.Mutex
+	users     int
+	evicted   bool
+	retained  bool
+	destroyed bool
+}
+
+// destroyableKey is implemented by wallet files that can zero their private key
+type destroyableKey interface {
+	Destroy()
+}
+
+// acquire returns false if the key has already been zeroed, in which case it must be loaded again
+func (ck *cachedKey) acquire(retain bool) bool {
+	ck.mux.Lock()
+	defer ck.mux.Unlock()
+	if ck.destroyed {
+		return false
+	}
+	ck.users++
+	ck.retained = ck.retained || retain
+	return true
+}
+
+func (ck *cachedKey) release() {
+	ck.mux.Lock()
+	defer ck.mux.Unlock()
+	ck.users--
+	ck.destroyIfUnused()
+}
+
+func (ck *cachedKey) evict() {
+	ck.mux.Lock()
+	defer ck.mux.Unlock()
+	ck.evicted = true
+	ck.destroyIfUnused()
+}
+
+func (ck *cachedKey) destroyIfUnused() {
+	if ck.evicted && ck.users == 0 && !ck.retained && !ck.destroyed {
+		if d, ok := ck.wf.(destroyableKey); ok {
+			d.Destroy()
+		}
+		ck.destroyed = true
+	}
+}
+
+// keyFilePath normalizes a filename for tracking, as files are referred to relative to the
+// wallet directory by the listener, but might be absolute (or relative to elsewhere) in metadata
+func keyFilePath(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filepath.Clean(filename)
+}
+
+// trackKeyFile records that the key for the address was loaded using the file (primary, key or password
+// file), so that the cached key is evicted if the listener sees the file change
+func (w *fsWallet) trackKeyFile(addr ethtypes.Address0xHex, filename string) {
+	filename = keyFilePath(filename)
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	addrs := w.keyFiles[filename]
+	if addrs == nil {
+		addrs = make(map[ethtypes.Address0xHex]bool)
+		w.keyFiles[filename] = addrs
+	}
+	addrs[addr] = true
+}
+
+// evictForFile evicts any cached keys that were loaded using the file
+func (w *fsWallet) evictForFile(ctx context.Context, filename string) {
+	filename = keyFilePath(filename)
+	w.mux.Lock()
+	addrs := w.keyFiles[filename]
+	delete(w.keyFiles, filename)
+	w.mux.Unlock()
+	for addr := range addrs {
+		log.L(ctx).Infof("Evicting cached key for %s, as '%s' changed", addr, filename)
+		w.InvalidateCache(ctx, addr)
+	}
+}
+
+// InvalidateCache removes any cached key for the address, so that it is loaded from the files again
+// on next use. A load that is already in progress completes, but its result is not cached.
+func (w *fsWallet) InvalidateCache(_ context.Context, addr ethtypes.Address0xHex) {
+	addrString := addr.String()
+	w.inflightLoads.Forget(addrString)
+	w.closeMux.Lock()
+	defer w.closeMux.Unlock()
+	// Any load in progress might have read the old files, so must not cache its result
+	w.cacheEpoch++
+	if !w.closed {
+		// The cache only calls onEvict for items its worker has already promoted, so evict directly as well
+		if item := w.signerCache.Get(addrString); item != nil {
+			w.signerCache.Delete(addrString)
+			w.onEvict(item.Value().(*cachedKey))
+		}
+	}
+}
+
+// onEvict zeroes a key removed from the signer cache (once it is no longer in use). It is called from the
+// cache's worker for keys evicted due to size or replacement, as well as directly.
+func (w *fsWallet) onEvict(ck *cachedKey) {
+	w.cachedKeysMux.Lock()
+	delete(w.cachedKeys, ck)
+	w.cachedKeysMux.Unlock()
+	ck.evict()
+}
+
+// evictAllCachedKeys zeroes every key still in the signer cache, which must already have been stopped
+func (w *fsWallet) evictAllCachedKeys() {
+	w.cachedKeysMux.Lock()
+	cachedKeys := w.cachedKeys
+	w.cachedKeys = make(map[*cachedKey]bool)
+	w.cachedKeysMux.Unlock()
+	for ck := range cachedKeys {
+		ck.evict()
+	}
+}
+
+func (w *fsWallet) getCacheEpoch() uint64 {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+	return w.cacheEpoch
+}
@@ -17,7 +17,11 @@
 package fswallet
 
 import (
+	"time"
+
 	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/retry"
+	"github.com/hyperledger/firefly-signer/pkg/hdwallet"
 )
 
 const (
@@ -35,30 +39,120 @@ const (
 	ConfigFilenamesPasswordPath = "filenames.passwordPath"
 	// ConfigFilenamesPasswordTrimSpace whether to trim whitespace from passwords loaded from files (such as trailing newline characters)
 	ConfigFilenamesPasswordTrimSpace = "filenames.passwordTrimSpace"
+	// ConfigDirectories additional directories to index, each with a path and optionally its own filenames configuration. The top-level path takes precedence, followed by these in order
+	ConfigDirectories = "directories"
+	// ConfigDirectoryPath the path of an additional wallet directory
+	ConfigDirectoryPath = "path"
 	// ConfigDefaultPasswordFile default password file to use if neither the metadata, or passwordExtension find a password
 	ConfigDefaultPasswordFile = "defaultPasswordFile"
+	// ConfigBackgroundScan index the directory in the background after Initialize, looking up keys by filename until they are indexed
+	ConfigBackgroundScan = "backgroundScan"
+	// ConfigLookupTemplate go template for the primary filename of an address (such as "{{ .address }}.key.json"). When set, keys are looked up on demand with the template, and the directories are not scanned or indexed
+	ConfigLookupTemplate = "lookupTemplate"
+	// ConfigReadOnly discovery-only mode, where accounts are indexed and listeners notified, but signing is rejected
+	ConfigReadOnly = "readOnly"
 	// ConfigDisableListener disable the filesystem listener that detects newly added keys automatically
 	ConfigDisableListener = "disableListener"
+	// ConfigListenerRetryInitialDelay the initial delay before re-establishing a failed filesystem listener
+	ConfigListenerRetryInitialDelay = "listenerRetry.initialDelay"
+	// ConfigListenerRetryMaximumDelay the maximum delay between attempts to re-establish a failed filesystem listener
+	ConfigListenerRetryMaximumDelay = "listenerRetry.maximumDelay"
+	// ConfigListenerRetryFactor the factor to increase the delay by, between attempts to re-establish the filesystem listener
+	ConfigListenerRetryFactor = "listenerRetry.factor"
+	// ConfigRefreshInterval re-scan the directory at this interval (with jitter), as a fallback for filesystems where listener events are not delivered
+	ConfigRefreshInterval = "refreshInterval"
+	// ConfigNotifyQueueSize the maximum number of new address notifications queued for each listener, after which notifyOverflow applies
+	ConfigNotifyQueueSize = "notifyQueueSize"
+	// ConfigNotifyOverflow what happens when a listener's queue is full - supported: dropOldest (default) / disconnect
+	ConfigNotifyOverflow = "notifyOverflow"
 	// ConfigSignerCacheSize the number of signing keys to keep in memory
 	ConfigSignerCacheSize = "signerCacheSize"
 	// ConfigSignerCacheTTL the time to keep an unused signing key in memory
 	ConfigSignerCacheTTL = "signerCacheTTL"
+	// ConfigSignerCachePreload decrypt every indexed key into the signer cache during Initialize (or after the background scan), so the first signature for each key does not wait for the KDF
+	ConfigSignerCachePreload = "signerCachePreload"
+	// ConfigKDFTimeout the maximum time a request waits for the KDF to decrypt a key. The decrypt completes in the background, and is cached for retries
+	ConfigKDFTimeout = "kdfTimeout"
+	// ConfigKDFConcurrency the maximum number of keystore files decrypted in parallel, with further requests queued. Unlimited when zero
+	ConfigKDFConcurrency = "kdfConcurrency"
+	// ConfigKeyFormat the format of the key files - supported: keystorev3 (default) / hex (unencrypted private key, for dev/test only) / pem (unencrypted SEC 1 or PKCS#8) / mnemonic (BIP-39)
+	ConfigKeyFormat = "keyFormat"
+	// ConfigMnemonicDerivationPath the BIP-32 path of the key to derive from each mnemonic, when keyFormat is mnemonic
+	ConfigMnemonicDerivationPath = "mnemonic.derivationPath"
+	// ConfigMnemonicUsePassword whether the password from the password provider is used as the BIP-39 passphrase, when keyFormat is mnemonic
+	ConfigMnemonicUsePassword = "mnemonic.usePassword"
+	// ConfigPasswordProviderType where to obtain passwords for keys - supported: file (default) / env / exec
+	ConfigPasswordProviderType = "passwordProvider.type"
+	// ConfigPasswordProviderEnvPrefix prefix for the environment variable name, which is suffixed with the upper-case hex address (no 0x)
+	ConfigPasswordProviderEnvPrefix = "passwordProvider.env.prefix"
+	// ConfigPasswordProviderEnvDefault name of an environment variable to use if there is not one specific to the address
+	ConfigPasswordProviderEnvDefault = "passwordProvider.env.default"
+	// ConfigPasswordProviderExecCommand command to run to obtain a password. The address is passed as the last argument
+	ConfigPasswordProviderExecCommand = "passwordProvider.exec.command"
+	// ConfigPasswordProviderExecArgs arguments to pass to the command, before the address
+	ConfigPasswordProviderExecArgs = "passwordProvider.exec.args"
+	// ConfigPasswordEncryptionMasterKeyFile file containing the hex encoded AES-256 master key that password files are encrypted under
+	ConfigPasswordEncryptionMasterKeyFile = "passwordEncryption.masterKeyFile"
+	// ConfigPasswordEncryptionMasterKeyEnv environment variable containing the hex encoded AES-256 master key that password files are encrypted under
+	ConfigPasswordEncryptionMasterKeyEnv = "passwordEncryption.masterKeyEnv"
+	// ConfigAuditSink where to write an audit record of every signing request - supported: none (default) / stdout / file
+	ConfigAuditSink = "audit.sink"
+	// ConfigAuditFile the file to append audit records to, when the audit sink is file
+	ConfigAuditFile = "audit.file"
+	// ConfigArchivePath a single archive file the wallet is read from, unpacked into memory on startup. The path, directories and password files are then names within the archive
+	ConfigArchivePath = "archive.path"
+	// ConfigArchiveFormat the format of the archive - supported: auto (from extension) / zip / tar / tar.gz
+	ConfigArchiveFormat = "archive.format"
+	// ConfigArchiveEncryption the encryption of the archive - supported: auto (from extension - .age or .gpg) / none / age / gpg
+	ConfigArchiveEncryption = "archive.encryption"
+	// ConfigArchiveIdentityFile the file containing the age identities (private keys) the archive can be decrypted with
+	ConfigArchiveIdentityFile = "archive.identityFile"
+	// ConfigArchiveKeyringFile the file containing the OpenPGP private keys (armored or binary) the archive can be decrypted with
+	ConfigArchiveKeyringFile = "archive.keyringFile"
+	// ConfigArchivePassphraseFile the file containing the passphrase the archive is encrypted with (age or gpg symmetric encryption), or that protects the OpenPGP private key
+	ConfigArchivePassphraseFile = "archive.passphraseFile"
+	// ConfigArchiveMaxSize the maximum total size of the files in the archive, once decrypted and unpacked
+	ConfigArchiveMaxSize = "archive.maxSize"
 	// ConfigMetadataFormat format to parse the metadata - supported: auto (from extension) / filename / toml / yaml / json (please quote "0x..." strings in YAML)
 	ConfigMetadataFormat = "metadata.format"
 	// ConfigMetadataKeyFileProperty use for toml/yaml/json to find the name of the file containing the keystorev3 file
 	ConfigMetadataKeyFileProperty = "metadata.keyFileProperty"
 	// ConfigMetadataPasswordFileProperty use for toml/yaml to find the name of the file containing the keystorev3 file
 	ConfigMetadataPasswordFileProperty = "metadata.passwordFileProperty"
+	// ConfigMetadataEncryptedPasswordProperty use for toml/yaml/json to find the password inline in the metadata, encrypted under the passwordEncryption master key. Takes precedence over passwordFileProperty when it returns a value
+	ConfigMetadataEncryptedPasswordProperty = "metadata.encryptedPasswordProperty"
 )
 
 type Config struct {
 	Path                string
+	Directories         []DirectoryConfig
 	DefaultPasswordFile string
 	SignerCacheSize     string
 	SignerCacheTTL      string
+	SignerCachePreload  bool
 	DisableListener     bool
+	BackgroundScan      bool
+	LookupTemplate      string
+	ReadOnly            bool
+	ListenerRetry       retry.Retry
+	RefreshInterval     time.Duration
+	NotifyQueueSize     int
+	NotifyOverflow      string
+	KDFTimeout          time.Duration
+	KDFConcurrency      int
+	KeyFormat           string
+	Mnemonic            MnemonicConfig
 	Filenames           FilenamesConfig
 	Metadata            MetadataConfig
+	PasswordProvider    PasswordProviderConfig
+	PasswordEncryption  PasswordEncryptionConfig
+	Audit               AuditConfig
+	Archive             ArchiveConfig
+}
+
+type DirectoryConfig struct {
+	Path      string
+	Filenames *FilenamesConfig // nil to use the top-level filenames configuration
 }
 
 type FilenamesConfig struct {
@@ -70,10 +164,52 @@ type FilenamesConfig struct {
 	With0xPrefix      bool
 }
 
+type MnemonicConfig struct {
+	DerivationPath string
+	UsePassword    bool
+}
+
+type PasswordProviderConfig struct {
+	Type string
+	Env  PasswordProviderEnvConfig
+	Exec PasswordProviderExecConfig
+}
+
+type PasswordProviderEnvConfig struct {
+	Prefix  string
+	Default string
+}
+
+type PasswordProviderExecConfig struct {
+	Command string
+	Args    []string
+}
+
+type PasswordEncryptionConfig struct {
+	MasterKeyFile string
+	MasterKeyEnv  string
+}
+
+type AuditConfig struct {
+	Sink string
+	File string
+}
+
+type ArchiveConfig struct {
+	Path           string
+	Format         string
+	Encryption     string
+	IdentityFile   string
+	KeyringFile    string
+	PassphraseFile string
+	MaxSize        int64
+}
+
 type MetadataConfig struct {
-	Format               string
-	KeyFileProperty      string
-	PasswordFileProperty string
+	Format                    string
+	KeyFileProperty           string
+	PasswordFileProperty      string
+	EncryptedPasswordProperty string
 }
 
 func InitConfig(section config.Section) {
@@ -85,21 +221,109 @@ func InitConfig(section config.Section) {
 	section.AddKnownKey(ConfigFilenamesPasswordTrimSpace, true)
 	section.AddKnownKey(ConfigFilenamesWith0xPrefix)
 	section.AddKnownKey(ConfigDisableListener)
+	section.AddKnownKey(ConfigBackgroundScan, false)
+	section.AddKnownKey(ConfigLookupTemplate)
+	section.AddKnownKey(ConfigReadOnly, false)
+	section.AddKnownKey(ConfigListenerRetryInitialDelay, defaultListenerRetryInitialDelay.String())
+	section.AddKnownKey(ConfigListenerRetryMaximumDelay, "30s")
+	section.AddKnownKey(ConfigListenerRetryFactor, defaultListenerRetryFactor)
+	section.AddKnownKey(ConfigRefreshInterval)
+	section.AddKnownKey(ConfigNotifyQueueSize, defaultNotifyQueueSize)
+	section.AddKnownKey(ConfigNotifyOverflow, NotifyOverflowDropOldest)
 	section.AddKnownKey(ConfigDefaultPasswordFile)
 	section.AddKnownKey(ConfigSignerCacheSize, 250)
 	section.AddKnownKey(ConfigSignerCacheTTL, "24h")
+	section.AddKnownKey(ConfigSignerCachePreload, false)
+	section.AddKnownKey(ConfigKDFTimeout)
+	section.AddKnownKey(ConfigKDFConcurrency, 0)
+	section.AddKnownKey(ConfigKeyFormat, KeyFormatKeystoreV3)
+	section.AddKnownKey(ConfigMnemonicDerivationPath, hdwallet.DefaultDerivationPath)
+	section.AddKnownKey(ConfigMnemonicUsePassword, false)
 	section.AddKnownKey(ConfigMetadataFormat, `auto`)
 	section.AddKnownKey(ConfigMetadataKeyFileProperty)
 	section.AddKnownKey(ConfigMetadataPasswordFileProperty)
+	section.AddKnownKey(ConfigMetadataEncryptedPasswordProperty)
+	section.AddKnownKey(ConfigPasswordProviderType, PasswordProviderFile)
+	section.AddKnownKey(ConfigPasswordProviderEnvPrefix, "FFSIGNER_PASSWORD_")
+	section.AddKnownKey(ConfigPasswordProviderEnvDefault)
+	section.AddKnownKey(ConfigPasswordProviderExecCommand)
+	section.AddKnownKey(ConfigPasswordProviderExecArgs)
+	section.AddKnownKey(ConfigPasswordEncryptionMasterKeyFile)
+	section.AddKnownKey(ConfigPasswordEncryptionMasterKeyEnv)
+	section.AddKnownKey(ConfigAuditSink, AuditSinkNone)
+	section.AddKnownKey(ConfigAuditFile)
+	section.AddKnownKey(ConfigArchivePath)
+	section.AddKnownKey(ConfigArchiveFormat, ArchiveFormatAuto)
+	section.AddKnownKey(ConfigArchiveEncryption, ArchiveEncryptionAuto)
+	section.AddKnownKey(ConfigArchiveIdentityFile)
+	section.AddKnownKey(ConfigArchiveKeyringFile)
+	section.AddKnownKey(ConfigArchivePassphraseFile)
+	section.AddKnownKey(ConfigArchiveMaxSize, "256Mb")
+	directoriesSection(section)
+}
+
+// directoriesSection returns the array of additional directories, with its known keys. The array
+// entries have no defaults for the filenames keys, so an entry only overrides the top-level filenames
+// configuration when it sets primaryExt or primaryMatchRegex.
+func directoriesSection(section config.Section) config.ArraySection {
+	dirs := section.SubArray(ConfigDirectories)
+	dirs.AddKnownKey(ConfigDirectoryPath)
+	dirs.AddKnownKey(ConfigFilenamesPrimaryExt)
+	dirs.AddKnownKey(ConfigFilenamesPrimaryMatchRegex)
+	dirs.AddKnownKey(ConfigFilenamesPasswordExt)
+	dirs.AddKnownKey(ConfigFilenamesPasswordPath)
+	dirs.AddKnownKey(ConfigFilenamesPasswordTrimSpace, true)
+	dirs.AddKnownKey(ConfigFilenamesWith0xPrefix)
+	return dirs
+}
+
+func readDirectoriesConfig(section config.Section) []DirectoryConfig {
+	dirs := directoriesSection(section)
+	dirConfs := make([]DirectoryConfig, dirs.ArraySize())
+	for i := range dirConfs {
+		entry := dirs.ArrayEntry(i)
+		dirConfs[i].Path = entry.GetString(ConfigDirectoryPath)
+		if entry.GetString(ConfigFilenamesPrimaryExt) != "" || entry.GetString(ConfigFilenamesPrimaryMatchRegex) != "" {
+			dirConfs[i].Filenames = &FilenamesConfig{
+				PrimaryExt:        entry.GetString(ConfigFilenamesPrimaryExt),
+				PrimaryMatchRegex: entry.GetString(ConfigFilenamesPrimaryMatchRegex),
+				PasswordExt:       entry.GetString(ConfigFilenamesPasswordExt),
+				PasswordPath:      entry.GetString(ConfigFilenamesPasswordPath),
+				PasswordTrimSpace: entry.GetBool(ConfigFilenamesPasswordTrimSpace),
+				With0xPrefix:      entry.GetBool(ConfigFilenamesWith0xPrefix),
+			}
+		}
+	}
+	return dirConfs
 }
 
 func ReadConfig(section config.Section) *Config {
 	return &Config{
 		Path:                section.GetString(ConfigPath),
+		Directories:         readDirectoriesConfig(section),
 		DefaultPasswordFile: section.GetString(ConfigDefaultPasswordFile),
 		SignerCacheSize:     section.GetString(ConfigSignerCacheSize),
 		SignerCacheTTL:      section.GetString(ConfigSignerCacheTTL),
+		SignerCachePreload:  section.GetBool(ConfigSignerCachePreload),
 		DisableListener:     section.GetBool(ConfigDisableListener),
+		BackgroundScan:      section.GetBool(ConfigBackgroundScan),
+		LookupTemplate:      section.GetString(ConfigLookupTemplate),
+		ReadOnly:            section.GetBool(ConfigReadOnly),
+		KDFTimeout:          section.GetDuration(ConfigKDFTimeout),
+		KDFConcurrency:      section.GetInt(ConfigKDFConcurrency),
+		KeyFormat:           section.GetString(ConfigKeyFormat),
+		NotifyQueueSize:     section.GetInt(ConfigNotifyQueueSize),
+		NotifyOverflow:      section.GetString(ConfigNotifyOverflow),
+		RefreshInterval:     section.GetDuration(ConfigRefreshInterval),
+		ListenerRetry: retry.Retry{
+			InitialDelay: section.GetDuration(ConfigListenerRetryInitialDelay),
+			MaximumDelay: section.GetDuration(ConfigListenerRetryMaximumDelay),
+			Factor:       section.GetFloat64(ConfigListenerRetryFactor),
+		},
+		Mnemonic: MnemonicConfig{
+			DerivationPath: section.GetString(ConfigMnemonicDerivationPath),
+			UsePassword:    section.GetBool(ConfigMnemonicUsePassword),
+		},
 		Filenames: FilenamesConfig{
 			PrimaryExt:        section.GetString(ConfigFilenamesPrimaryExt),
 			PrimaryMatchRegex: section.GetString(ConfigFilenamesPrimaryMatchRegex),
@@ -109,9 +333,38 @@ func ReadConfig(section config.Section) *Config {
 			With0xPrefix:      section.GetBool(ConfigFilenamesWith0xPrefix),
 		},
 		Metadata: MetadataConfig{
-			Format:               section.GetString(ConfigMetadataFormat),
-			KeyFileProperty:      section.GetString(ConfigMetadataKeyFileProperty),
-			PasswordFileProperty: section.GetString(ConfigMetadataPasswordFileProperty),
+			Format:                    section.GetString(ConfigMetadataFormat),
+			KeyFileProperty:           section.GetString(ConfigMetadataKeyFileProperty),
+			PasswordFileProperty:      section.GetString(ConfigMetadataPasswordFileProperty),
+			EncryptedPasswordProperty: section.GetString(ConfigMetadataEncryptedPasswordProperty),
+		},
+		PasswordProvider: PasswordProviderConfig{
+			Type: section.GetString(ConfigPasswordProviderType),
+			Env: PasswordProviderEnvConfig{
+				Prefix:  section.GetString(ConfigPasswordProviderEnvPrefix),
+				Default: section.GetString(ConfigPasswordProviderEnvDefault),
+			},
+			Exec: PasswordProviderExecConfig{
+				Command: section.GetString(ConfigPasswordProviderExecCommand),
+				Args:    section.GetStringSlice(ConfigPasswordProviderExecArgs),
+			},
+		},
+		PasswordEncryption: PasswordEncryptionConfig{
+			MasterKeyFile: section.GetString(ConfigPasswordEncryptionMasterKeyFile),
+			MasterKeyEnv:  section.GetString(ConfigPasswordEncryptionMasterKeyEnv),
+		},
+		Audit: AuditConfig{
+			Sink: section.GetString(ConfigAuditSink),
+			File: section.GetString(ConfigAuditFile),
+		},
+		Archive: ArchiveConfig{
+			Path:           section.GetString(ConfigArchivePath),
+			Format:         section.GetString(ConfigArchiveFormat),
+			Encryption:     section.GetString(ConfigArchiveEncryption),
+			IdentityFile:   section.GetString(ConfigArchiveIdentityFile),
+			KeyringFile:    section.GetString(ConfigArchiveKeyringFile),
+			PassphraseFile: section.GetString(ConfigArchivePassphraseFile),
+			MaxSize:        section.GetByteSize(ConfigArchiveMaxSize),
 		},
 	}
 }
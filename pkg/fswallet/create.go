@@ -0,0 +1,119 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+// generatedPasswordLength is the number of random bytes in a generated password, which is hex encoded
+const generatedPasswordLength = 32
+
+// CreateAccount generates a new key in the wallet path, as a Keystore V3 file named from its address with
+// filenames.primaryExt, protected by a random password written to a file named with filenames.passwordExt
+// (encrypted under the master key, if passwordEncryption is configured). The wallet finds the new key when it
+// next scans the directory, or through its listener.
+//
+// The wallet must be configured with keystorev3 files found by their filename, and password files.
+func CreateAccount(ctx context.Context, conf *Config, scrypt *keystorev3.ScryptOptions) (*ethtypes.Address0xHex, error) {
+	c := *conf
+	setConfigDefaults(&c)
+	if reason := createUnsupportedReason(&c); reason != "" {
+		return nil, i18n.NewError(ctx, signermsgs.MsgCreateAccountUnsupported, reason)
+	}
+	masterKey, err := ReadMasterKey(ctx, &c.PasswordEncryption)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(masterKey)
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgCreateAccountFailed, err)
+	}
+	defer keypair.Destroy()
+	passwordBytes := make([]byte, generatedPasswordLength)
+	if _, err := rand.Read(passwordBytes); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgCreateAccountFailed, err)
+	}
+	password := hex.EncodeToString(passwordBytes)
+	walletFile, err := keystorev3.NewWalletFileScrypt(password, keypair, scrypt)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgCreateAccountFailed, err)
+	}
+	passwordFileContent := []byte(password)
+	if masterKey != nil {
+		encrypted, err := EncryptPassword(masterKey, passwordFileContent)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgCreateAccountFailed, err)
+		}
+		passwordFileContent = []byte(encrypted)
+	}
+
+	addr := ethtypes.Address0xHex(keypair.Address)
+	filename := addr.String()
+	if !c.Filenames.With0xPrefix {
+		filename = strings.TrimPrefix(filename, "0x")
+	}
+	passwordPath := c.Filenames.PasswordPath
+	if passwordPath == "" {
+		passwordPath = c.Path
+	}
+	// The password is written first, so the wallet can decrypt the key as soon as it sees the key file
+	if err := os.WriteFile(path.Join(passwordPath, filename+c.Filenames.PasswordExt), passwordFileContent, 0600); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgCreateAccountFailed, err)
+	}
+	if err := os.WriteFile(path.Join(c.Path, filename+c.Filenames.PrimaryExt), walletFile.JSON(), 0600); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgCreateAccountFailed, err)
+	}
+	return &addr, nil
+}
+
+// createUnsupportedReason returns the configuration that prevents CreateAccount from writing a key the wallet
+// can load, or the empty string if there is none
+func createUnsupportedReason(conf *Config) string {
+	switch {
+	case conf.Path == "":
+		return ConfigPath
+	case conf.Archive.Path != "":
+		return ConfigArchivePath
+	case conf.KeyFormat != KeyFormatKeystoreV3:
+		return ConfigKeyFormat
+	case conf.LookupTemplate != "":
+		return ConfigLookupTemplate
+	case conf.Filenames.PrimaryMatchRegex != "" || conf.Filenames.PrimaryExt == "":
+		return ConfigFilenamesPrimaryExt
+	case conf.Filenames.PasswordExt == "":
+		return ConfigFilenamesPasswordExt
+	case isMetadataFormat(conf.Metadata.Format):
+		return ConfigMetadataFormat
+	case conf.PasswordProvider.Type != "" && conf.PasswordProvider.Type != PasswordProviderFile:
+		return ConfigPasswordProviderType
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCreateConfig(t *testing.T) *Config {
+	return &Config{
+		Path:            t.TempDir(),
+		DisableListener: true,
+		Filenames: FilenamesConfig{
+			PrimaryExt:        ".key.json",
+			PasswordExt:       ".pwd",
+			PasswordTrimSpace: true,
+		},
+		Metadata: MetadataConfig{
+			Format: "auto",
+		},
+	}
+}
+
+func TestCreateAccountOK(t *testing.T) {
+
+	ctx := context.Background()
+	conf := newTestCreateConfig(t)
+	addr, err := CreateAccount(ctx, conf, &keystorev3.ScryptOptions{N: 1024})
+	assert.NoError(t, err)
+
+	filename := strings.TrimPrefix(addr.String(), "0x")
+	pwd, err := os.ReadFile(path.Join(conf.Path, filename+".pwd"))
+	assert.NoError(t, err)
+	assert.Len(t, pwd, 64)
+	info, err := os.Stat(path.Join(conf.Path, filename+".key.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	w, err := NewFilesystemWallet(ctx, conf)
+	assert.NoError(t, err)
+	defer w.Close()
+	err = w.Initialize(ctx)
+	assert.NoError(t, err)
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{addr}, accounts)
+
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: []byte(`"` + addr.String() + `"`)}, 1)
+	assert.NoError(t, err)
+
+}
+
+func TestCreateAccountEncryptedPasswordAndPath(t *testing.T) {
+
+	ctx := context.Background()
+	conf := newTestCreateConfig(t)
+	conf.Filenames.With0xPrefix = true
+	conf.Filenames.PasswordPath = t.TempDir()
+	masterKeyFile := path.Join(t.TempDir(), "master.key")
+	err := os.WriteFile(masterKeyFile, []byte(hex.EncodeToString(make([]byte, MasterKeyLength))), 0600)
+	assert.NoError(t, err)
+	conf.PasswordEncryption.MasterKeyFile = masterKeyFile
+
+	addr, err := CreateAccount(ctx, conf, &keystorev3.ScryptOptions{N: 1024})
+	assert.NoError(t, err)
+	_, err = os.Stat(path.Join(conf.Filenames.PasswordPath, addr.String()+".pwd"))
+	assert.NoError(t, err)
+
+	w, err := NewFilesystemWallet(ctx, conf)
+	assert.NoError(t, err)
+	defer w.Close()
+	err = w.Initialize(ctx)
+	assert.NoError(t, err)
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: []byte(`"` + addr.String() + `"`)}, 1)
+	assert.NoError(t, err)
+
+}
+
+func TestCreateAccountUnsupported(t *testing.T) {
+
+	for _, setConf := range []func(conf *Config){
+		func(conf *Config) { conf.Path = "" },
+		func(conf *Config) { conf.Archive.Path = "wallet.zip" },
+		func(conf *Config) { conf.KeyFormat = KeyFormatHex },
+		func(conf *Config) { conf.LookupTemplate = "{{ .address }}.key.json" },
+		func(conf *Config) { conf.Filenames.PrimaryMatchRegex = "^(.*).key.json$" },
+		func(conf *Config) { conf.Filenames.PasswordExt = "" },
+		func(conf *Config) { conf.Filenames.PrimaryExt = ".toml" },
+		func(conf *Config) { conf.PasswordProvider.Type = PasswordProviderEnv },
+	} {
+		conf := newTestCreateConfig(t)
+		setConf(conf)
+		_, err := CreateAccount(context.Background(), conf, nil)
+		assert.Regexp(t, "FF22231", err)
+	}
+
+}
+
+func TestCreateAccountBadMasterKey(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	conf.PasswordEncryption.MasterKeyFile = path.Join(conf.Path, "missing")
+	_, err := CreateAccount(context.Background(), conf, nil)
+	assert.Regexp(t, "FF22128", err)
+
+}
+
+func TestCreateAccountBadScrypt(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	_, err := CreateAccount(context.Background(), conf, &keystorev3.ScryptOptions{N: 1000})
+	assert.Regexp(t, "FF22232", err)
+
+}
+
+func TestCreateAccountWriteFail(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	conf.Filenames.PasswordPath = path.Join(conf.Path, "missing")
+	_, err := CreateAccount(context.Background(), conf, &keystorev3.ScryptOptions{N: 1024})
+	assert.Regexp(t, "FF22232", err)
+
+	conf = newTestCreateConfig(t)
+	conf.Filenames.PasswordPath = conf.Path
+	conf.Path = path.Join(conf.Path, "missing")
+	_, err = CreateAccount(context.Background(), conf, &keystorev3.ScryptOptions{N: 1024})
+	assert.Regexp(t, "FF22232", err)
+
+}
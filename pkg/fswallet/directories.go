@@ -0,0 +1,104 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// walletDir is one of the directories indexed by the wallet. The directory from the top-level path
+// configuration is first, followed by the additional directories in configuration order - which is
+// also their order of precedence when the same address is found in more than one.
+type walletDir struct {
+	path              string
+	filenames         *FilenamesConfig // nil if the directory uses the top-level (reloadable) filenames configuration
+	primaryMatchRegex *regexp.Regexp   // compiled from filenames, when the directory has its own
+}
+
+// indexedFile is the primary file for an address, in one of the wallet directories
+type indexedFile struct {
+	dir  int
+	name string
+}
+
+func compilePrimaryMatchRegex(ctx context.Context, regex string) (*regexp.Regexp, error) {
+	if regex == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgBadRegularExpression, ConfigFilenamesPrimaryMatchRegex, err)
+	}
+	if len(re.SubexpNames()) < 2 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgMissingRegexpCaptureGroup, re.String())
+	}
+	return re, nil
+}
+
+func newWalletDirs(ctx context.Context, conf *Config) ([]*walletDir, error) {
+	dirs := []*walletDir{{path: conf.Path}}
+	for i, dc := range conf.Directories {
+		if dc.Path == "" {
+			return nil, i18n.NewError(ctx, signermsgs.MsgDirectoryNoPath, i)
+		}
+		d := &walletDir{path: dc.Path}
+		if dc.Filenames != nil {
+			filenames := *dc.Filenames
+			d.filenames = &filenames
+			var err error
+			if d.primaryMatchRegex, err = compilePrimaryMatchRegex(ctx, filenames.PrimaryMatchRegex); err != nil {
+				return nil, err
+			}
+		}
+		dirs = append(dirs, d)
+	}
+	return dirs, nil
+}
+
+// dirFilenames returns the filenames configuration, and compiled regular expression, that apply to the directory
+func (w *fsWallet) dirFilenames(d *walletDir) (FilenamesConfig, *regexp.Regexp) {
+	if d.filenames != nil {
+		return *d.filenames, d.primaryMatchRegex
+	}
+	w.reloadMux.RLock()
+	defer w.reloadMux.RUnlock()
+	return w.conf.Filenames, w.primaryMatchRegex
+}
+
+// dirForAddress returns the directory the address was indexed from, or the first directory if it is not indexed
+func (w *fsWallet) dirForAddress(addr ethtypes.Address0xHex) *walletDir {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.dirs[w.addressToFileMap[addr].dir]
+}
+
+// dirForFile returns the index of the directory containing the file, from a listener event
+func (w *fsWallet) dirForFile(filename string) (int, bool) {
+	parent := filepath.Dir(filepath.Clean(filename))
+	for i, d := range w.dirs {
+		if filepath.Clean(d.path) == parent {
+			return i, true
+		}
+	}
+	return -1, false
+}
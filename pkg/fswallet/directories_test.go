@@ -0,0 +1,224 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMultiDirWallet(t *testing.T, directoriesYAML string, listener ...chan<- ethtypes.Address0xHex) (context.Context, *fsWallet, string, func()) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader("ut_fs_config:\n  directories:\n" + directoriesYAML))
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	unitTestConfig.Set(ConfigPath, dir)
+	unitTestConfig.Set(ConfigFilenamesPrimaryExt, ".key")
+	unitTestConfig.Set(ConfigKeyFormat, KeyFormatHex)
+	unitTestConfig.Set(ConfigDisableListener, len(listener) == 0)
+	ctx := context.Background()
+
+	ff, err := NewFilesystemWallet(ctx, ReadConfig(unitTestConfig), listener...)
+	assert.NoError(t, err)
+
+	return ctx, ff.(*fsWallet), dir, func() {
+		ff.Close()
+	}
+}
+
+func writeTestHexKey(t *testing.T, dir, filename string, keypair *secp256k1.KeyPair) {
+	err := os.WriteFile(path.Join(dir, filename), []byte(fmt.Sprintf("%x", keypair.PrivateKeyBytes())), 0600)
+	assert.NoError(t, err)
+}
+
+func TestDirectoriesConfig(t *testing.T) {
+
+	_, f, dir, done := newTestMultiDirWallet(t, `
+  - path: /dir1
+  - path: /dir2
+    filenames:
+      primaryMatchRegex: ^(0x[0-9a-f]+)\.team2$
+      passwordExt: .team2pwd
+`)
+	defer done()
+
+	assert.Len(t, f.dirs, 3)
+	assert.Equal(t, dir, f.dirs[0].path)
+	assert.Nil(t, f.dirs[0].filenames)
+	assert.Equal(t, "/dir1", f.dirs[1].path)
+	assert.Nil(t, f.dirs[1].filenames)
+	assert.Equal(t, "/dir2", f.dirs[2].path)
+	assert.Equal(t, ".team2pwd", f.dirs[2].filenames.PasswordExt)
+	assert.True(t, f.dirs[2].filenames.PasswordTrimSpace)
+	assert.NotNil(t, f.dirs[2].primaryMatchRegex)
+
+}
+
+func TestDirectoriesNoPath(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := NewFilesystemWallet(ctx, &Config{
+		Directories: []DirectoryConfig{{}},
+	})
+	assert.Regexp(t, "FF22124", err)
+
+}
+
+func TestDirectoriesBadRegexp(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := NewFilesystemWallet(ctx, &Config{
+		Directories: []DirectoryConfig{{
+			Path:      "/dir1",
+			Filenames: &FilenamesConfig{PrimaryMatchRegex: "no capture group"},
+		}},
+	})
+	assert.Regexp(t, "FF22057", err)
+
+}
+
+func TestDirectoriesPrecedence(t *testing.T) {
+
+	dir2 := t.TempDir()
+	ctx, f, dir1, done := newTestMultiDirWallet(t, fmt.Sprintf(`
+  - path: %s
+    filenames:
+      primaryExt: .hex
+`, dir2))
+	defer done()
+
+	shared, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	only2, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	writeTestHexKey(t, dir1, shared.Address.String()[2:]+".key", shared)
+	writeTestHexKey(t, dir2, shared.Address.String()[2:]+".hex", shared)
+	writeTestHexKey(t, dir2, only2.Address.String()[2:]+".hex", only2)
+	// Ignored in the second directory, as it has its own extension
+	writeTestHexKey(t, dir2, "0x"+shared.Address.String()[2:]+".key", shared)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	accounts, err := f.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 2)
+	assert.Equal(t, indexedFile{dir: 0, name: shared.Address.String()[2:] + ".key"}, f.addressToFileMap[shared.Address])
+	assert.Equal(t, indexedFile{dir: 1, name: only2.Address.String()[2:] + ".hex"}, f.addressToFileMap[only2.Address])
+
+	// A later event for the directory with lower precedence does not change the file used
+	fi, err := os.Stat(path.Join(dir2, shared.Address.String()[2:]+".hex"))
+	assert.NoError(t, err)
+	f.notifyNewFiles(ctx, 1, fs.FileInfoToDirEntry(fi))
+	assert.Equal(t, 0, f.addressToFileMap[shared.Address].dir)
+
+	wf, err := f.GetWalletFile(ctx, only2.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, only2.PrivateKeyBytes(), wf.PrivateKey())
+	assert.Equal(t, 1, f.signerCache.ItemCount())
+
+	// A key added to the directory with higher precedence replaces the cached key
+	writeTestHexKey(t, dir1, only2.Address.String()[2:]+".key", only2)
+	err = f.Refresh(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, indexedFile{dir: 0, name: only2.Address.String()[2:] + ".key"}, f.addressToFileMap[only2.Address])
+	assert.Zero(t, f.signerCache.ItemCount())
+
+}
+
+func TestDirectoriesPasswordFromDirectory(t *testing.T) {
+
+	dir2 := t.TempDir()
+	ctx, f, _, done := newTestMultiDirWallet(t, fmt.Sprintf(`
+  - path: %s
+    filenames:
+      primaryExt: .key
+      passwordExt: .pass
+`, dir2))
+	defer done()
+	f.conf.Filenames.PasswordExt = ".pwd"
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	writeTestHexKey(t, dir2, keypair.Address.String()[2:]+".key", keypair)
+	err = os.WriteFile(path.Join(dir2, keypair.Address.String()[2:]+".pass"), []byte("team2secret\n"), 0600)
+	assert.NoError(t, err)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	password, err := f.passwordProvider.GetPassword(ctx, keypair.Address, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "team2secret", string(password))
+
+}
+
+func TestDirectoriesListener(t *testing.T) {
+
+	dir2 := t.TempDir()
+	listener := make(chan ethtypes.Address0xHex, 1)
+	ctx, f, _, done := newTestMultiDirWallet(t, fmt.Sprintf("  - path: %s\n", dir2), listener)
+	defer done()
+
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	writeTestHexKey(t, dir2, keypair.Address.String()[2:]+".key", keypair)
+
+	newAddr := <-listener
+	assert.Equal(t, keypair.Address, newAddr)
+
+	wf, err := f.GetWalletFile(ctx, keypair.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), wf.PrivateKey())
+
+}
+
+func TestDirectoriesListenerDirRemoved(t *testing.T) {
+
+	dir2 := t.TempDir()
+	ctx, f, _, done := newTestMultiDirWallet(t, fmt.Sprintf("  - path: %s\n", dir2), make(chan ethtypes.Address0xHex, 1))
+	defer done()
+
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	err = os.RemoveAll(dir2)
+	assert.NoError(t, err)
+	for f.ListenerHealth() == nil {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Error(t, f.ListenerHealth())
+
+}
@@ -0,0 +1,59 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"io/fs"
+	"os"
+)
+
+// FS is the filesystem the wallet reads its key, metadata and password files through. The configured
+// directory and file paths are used as names within the filesystem unchanged, so for an fs.FS such as
+// embed.FS or fstest.MapFS they must be relative, slash-separated paths (such as "keys").
+//
+// The filesystem listener can only watch the operating system filesystem, so is not started for any
+// other filesystem - use refreshInterval to pick up changes if the filesystem is not static.
+type FS interface {
+	fs.StatFS
+	fs.ReadFileFS
+}
+
+// WriteFileFS is an FS that files can also be written to
+type WriteFileFS interface {
+	FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// OSFS is the operating system filesystem, used by default. Unlike os.DirFS, names are operating system
+// paths, and can be absolute.
+type OSFS struct{}
+
+func (OSFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
@@ -0,0 +1,112 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMapFSWallet(t *testing.T, fsys fstest.MapFS) (context.Context, *fsWallet, func()) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ConfigPath, "keys")
+	unitTestConfig.Set(ConfigFilenamesPrimaryExt, ".key")
+	unitTestConfig.Set(ConfigKeyFormat, KeyFormatHex)
+	ctx := context.Background()
+
+	ff, err := NewFilesystemWalletFS(ctx, ReadConfig(unitTestConfig), fsys, nil)
+	assert.NoError(t, err)
+
+	return ctx, ff.(*fsWallet), func() {
+		ff.Close()
+	}
+}
+
+func TestMapFSWalletOK(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	fsys := fstest.MapFS{
+		path.Join("keys", keypair.Address.String()[2:]+".key"): &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("0x%x\n", keypair.PrivateKeyBytes())),
+		},
+		"keys/readme.txt": &fstest.MapFile{Data: []byte("not a key")},
+	}
+
+	ctx, f, done := newTestMapFSWallet(t, fsys)
+	defer done()
+
+	// The listener is not started for a filesystem other than the OS one
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, f.ListenerHealth())
+
+	accounts, err := f.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address.String(), accounts[0].String())
+	assert.Len(t, accounts, 1)
+
+	from := fmt.Sprintf(`"%s"`, keypair.Address)
+	_, err = f.Sign(ctx, &ethsigner.Transaction{
+		From: []byte(from),
+	}, 2022)
+	assert.NoError(t, err)
+
+}
+
+func TestMapFSWalletNotDirectory(t *testing.T) {
+
+	ctx, f, done := newTestMapFSWallet(t, fstest.MapFS{
+		"keys": &fstest.MapFile{Data: []byte("a file")},
+	})
+	defer done()
+
+	err := f.Initialize(ctx)
+	assert.Regexp(t, "FF22013", err)
+
+}
+
+func TestOSFSWriteFile(t *testing.T) {
+
+	var fsys WriteFileFS = OSFS{}
+	filename := path.Join(t.TempDir(), "test.txt")
+	err := fsys.WriteFile(filename, []byte("hello"), 0600)
+	assert.NoError(t, err)
+
+	b, err := fsys.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+
+	fi, err := fsys.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), fi.Size())
+
+	file, err := fsys.Open(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+}
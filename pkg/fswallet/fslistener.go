@@ -18,7 +18,11 @@ package fswallet
 
 import (
 	"context"
-	"os"
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"path/filepath"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
@@ -26,47 +30,192 @@ import (
 	"github.com/hyperledger/firefly-signer/internal/signermsgs"
 )
 
+// startFilesystemListener establishes the initial watch synchronously, so a misconfiguration
+// is reported from Initialize. The watcher is then supervised in the background, and
+// re-established (with backoff) followed by a full re-scan, if it fails.
 func (w *fsWallet) startFilesystemListener(ctx context.Context) error {
 	if w.conf.DisableListener {
 		log.L(ctx).Debugf("Filesystem listener disabled")
 		close(w.fsListenerDone)
 		return nil
 	}
-	watcher, err := fsnotify.NewWatcher()
-	if err == nil {
-		go w.fsListenerLoop(ctx, func() {
-			_ = watcher.Close()
-			close(w.fsListenerDone)
-		}, watcher.Events, watcher.Errors)
-		err = watcher.Add(w.conf.Path)
+	if _, isOS := w.fs.(OSFS); !isOS {
+		log.L(ctx).Infof("Filesystem listener not started, as the wallet is not on the operating system filesystem")
+		close(w.fsListenerDone)
+		return nil
 	}
+	watcher, err := w.newWatcher()
 	if err != nil {
+		close(w.fsListenerDone)
 		log.L(ctx).Errorf("Failed to start filesystem listener: %s", err)
 		return i18n.WrapError(ctx, err, signermsgs.MsgFailedToStartListener, err)
 	}
+	w.setListenerHealth(ctx, nil)
+	go w.fsListenerSupervisor(ctx, watcher)
 	return nil
 }
 
-func (w *fsWallet) fsListenerLoop(ctx context.Context, done func(), events chan fsnotify.Event, errors chan error) {
-	defer done()
+func (w *fsWallet) newWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range w.dirs {
+		if err := watcher.Add(d.path); err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+	}
+	return watcher, nil
+}
+
+// fsListenerSupervisor runs the listener loop until the context is cancelled, restarting
+// the watcher each time it fails
+func (w *fsWallet) fsListenerSupervisor(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer close(w.fsListenerDone)
 
 	for {
+		err := w.fsListenerLoop(ctx, watcher.Events, watcher.Errors)
+		_ = watcher.Close()
+		if err == nil {
+			return // context cancelled
+		}
+		w.setListenerHealth(ctx, err)
+		if watcher = w.restartWatcher(ctx); watcher == nil {
+			return // context cancelled
+		}
+		w.metricsListenerRestart(ctx)
+		// We will have missed any events while the watcher was down
+		if err := w.Refresh(ctx); err != nil {
+			log.L(ctx).Errorf("Re-scan after filesystem listener restart failed: %s", err)
+		}
+		w.setListenerHealth(ctx, nil)
+	}
+}
+
+// restartWatcher attempts to re-establish the watcher with an exponential backoff,
+// returning nil only if the context is cancelled
+func (w *fsWallet) restartWatcher(ctx context.Context) *fsnotify.Watcher {
+	delay := w.conf.ListenerRetry.InitialDelay
+	for {
+		log.L(ctx).Warnf("Restarting filesystem listener in %s", delay)
 		select {
 		case <-ctx.Done():
 			log.L(ctx).Infof("File listener exiting")
-			return
+			return nil
+		case <-time.After(delay):
+		}
+		watcher, err := w.newWatcher()
+		if err == nil {
+			log.L(ctx).Infof("Filesystem listener restarted")
+			return watcher
+		}
+		w.setListenerHealth(ctx, i18n.WrapError(ctx, err, signermsgs.MsgFailedToStartListener, err))
+		delay = time.Duration(float64(delay) * w.conf.ListenerRetry.Factor)
+		if delay > w.conf.ListenerRetry.MaximumDelay {
+			delay = w.conf.ListenerRetry.MaximumDelay
+		}
+	}
+}
+
+// fsListenerLoop processes events until the context is cancelled (returning nil), or the
+// watcher fails in a way that requires it to be re-established (returning the error)
+func (w *fsWallet) fsListenerLoop(ctx context.Context, events chan fsnotify.Event, errs chan error) error {
+	watchedPaths := make(map[string]bool, len(w.dirs))
+	for _, d := range w.dirs {
+		watchedPaths[filepath.Clean(d.path)] = true
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			log.L(ctx).Infof("File listener exiting")
+			return nil
 		case event, ok := <-events:
-			if ok {
-				log.L(ctx).Tracef("FSEvent [%s]: %s", event.Op, event.Name)
-				fi, err := os.Stat(event.Name)
-				if err == nil {
-					w.notifyNewFiles(ctx, fi)
-				}
+			if !ok {
+				return i18n.NewError(ctx, signermsgs.MsgFSListenerStopped, w.conf.Path)
+			}
+			log.L(ctx).Tracef("FSEvent [%s]: %s", event.Op, event.Name)
+			w.metricsListenerEvent(ctx, event.Op.String())
+			if watchedPaths[filepath.Clean(event.Name)] && event.Has(fsnotify.Remove|fsnotify.Rename) {
+				// The watch is lost along with the directory
+				return i18n.NewError(ctx, signermsgs.MsgFSListenerDirRemoved, event.Name)
+			}
+			if event.Op&^fsnotify.Chmod != 0 {
+				// The key might have been replaced, or re-encrypted with a new password
+				w.evictForFile(ctx, event.Name)
+			}
+			dirIndex, ok := w.dirForFile(event.Name)
+			if !ok || w.lookupTemplate != nil {
+				continue
+			}
+			fi, err := w.fs.Stat(event.Name)
+			if err == nil {
+				w.notifyNewFiles(ctx, dirIndex, fs.FileInfoToDirEntry(fi))
 			}
-		case err, ok := <-errors:
-			if ok {
-				log.L(ctx).Errorf("FSEvent error: %s", err)
+		case err, ok := <-errs:
+			if !ok {
+				return i18n.NewError(ctx, signermsgs.MsgFSListenerStopped, w.conf.Path)
 			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// The watch is still valid, but we've missed events
+				log.L(ctx).Warnf("FSEvent overflow - re-scanning directory")
+				if err := w.Refresh(ctx); err != nil {
+					log.L(ctx).Errorf("Re-scan after event overflow failed: %s", err)
+				}
+				continue
+			}
+			log.L(ctx).Errorf("FSEvent error: %s", err)
+			return err
 		}
 	}
 }
+
+// startPeriodicRefresh re-scans the directory every refreshInterval as a fallback for filesystems,
+// such as NFS, where the listener never receives events for new files
+func (w *fsWallet) startPeriodicRefresh(ctx context.Context) {
+	if w.conf.RefreshInterval <= 0 {
+		close(w.refreshDone)
+		return
+	}
+	go w.periodicRefreshLoop(ctx)
+}
+
+func (w *fsWallet) periodicRefreshLoop(ctx context.Context) {
+	defer close(w.refreshDone)
+	for {
+		select {
+		case <-ctx.Done():
+			log.L(ctx).Debugf("Periodic refresh exiting")
+			return
+		case <-time.After(refreshJitter(w.conf.RefreshInterval)):
+		}
+		if err := w.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.L(ctx).Errorf("Periodic re-scan failed: %s", err)
+		}
+	}
+}
+
+// refreshJitter varies the interval randomly by up to 10% either way, so replicas sharing
+// a volume do not all scan it at the same moment
+func refreshJitter(interval time.Duration) time.Duration {
+	spread := int64(interval) / 5
+	if spread <= 0 {
+		return interval
+	}
+	return interval - time.Duration(spread/2) + time.Duration(rand.Int64N(spread))
+}
+
+func (w *fsWallet) setListenerHealth(ctx context.Context, err error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.listenerErr = err
+	w.metricsListenerHealthy(ctx, err == nil)
+}
+
+// ListenerHealth returns nil if the filesystem listener is running, or is disabled. Otherwise it
+// returns the error that caused it to stop, while it is being re-established.
+func (w *fsWallet) ListenerHealth() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.listenerErr
+}
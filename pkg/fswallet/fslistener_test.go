@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -107,11 +108,154 @@ func TestFileListenerRemoveDirWhileListening(t *testing.T) {
 
 	errs := make(chan error, 1)
 	errs <- fmt.Errorf("pop")
+	err := f.fsListenerLoop(ctx, make(chan fsnotify.Event), errs)
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestFileListenerLoopChannelsClosed(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, true)
+	defer done()
+
+	events := make(chan fsnotify.Event)
+	close(events)
+	err := f.fsListenerLoop(ctx, events, make(chan error))
+	assert.Regexp(t, "FF22099", err)
+
+	errs := make(chan error)
+	close(errs)
+	err = f.fsListenerLoop(ctx, make(chan fsnotify.Event), errs)
+	assert.Regexp(t, "FF22099", err)
+
+}
+
+func TestFileListenerLoopOverflowRescan(t *testing.T) {
+
+	ctx, f, listener, done := newEmptyWalletTestDir(t, false)
+	defer done()
+
+	// Write a file the listener did not see, which the re-scan should find
+	testKeyFIle, err := ioutil.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json")
+	assert.NoError(t, err)
+	f.dirs[0].path = t.TempDir()
+	err = ioutil.WriteFile(path.Join(f.dirs[0].path, "1f185718734552d08278aa70f804580bab5fd2b4.key.json"), testKeyFIle, 0644)
+	assert.NoError(t, err)
+
+	errs := make(chan error, 1)
+	errs <- fsnotify.ErrEventOverflow
 	ctx, cancelCtx := context.WithCancel(ctx)
 	go func() {
-		time.Sleep(10 * time.Millisecond)
+		<-listener
 		cancelCtx()
 	}()
-	f.fsListenerLoop(ctx, func() {}, make(chan fsnotify.Event), errs)
+	err = f.fsListenerLoop(ctx, make(chan fsnotify.Event), errs)
+	assert.NoError(t, err)
+
+}
+
+func TestFileListenerRestartAfterDirRemoved(t *testing.T) {
+
+	ctx, f, listener, done := newEmptyWalletTestDir(t, false)
+	defer done()
+	f.conf.ListenerRetry.InitialDelay = 10 * time.Millisecond
+	f.conf.ListenerRetry.MaximumDelay = 20 * time.Millisecond
+
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, f.ListenerHealth())
+
+	err = os.RemoveAll(f.conf.Path)
+	assert.NoError(t, err)
+	for f.ListenerHealth() == nil {
+		time.Sleep(1 * time.Millisecond)
+	}
+	// Wait for at least one failed attempt to re-establish
+	for !strings.Contains(f.ListenerHealth().Error(), "FF22060") {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// Re-create the directory with a key in it, which should be found by the re-scan
+	err = os.Mkdir(f.conf.Path, 0755)
+	assert.NoError(t, err)
+	testKeyFIle, err := ioutil.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json")
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(f.conf.Path, "1f185718734552d08278aa70f804580bab5fd2b4.key.json"), testKeyFIle, 0644)
+	assert.NoError(t, err)
+
+	newAddr := <-listener
+	assert.Equal(t, `0x1f185718734552d08278aa70f804580bab5fd2b4`, newAddr.String())
+	for f.ListenerHealth() != nil {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+}
+
+func TestPeriodicRefresh(t *testing.T) {
+
+	ctx, f, listener, done := newEmptyWalletTestDir(t, false)
+	defer done()
+
+	f.conf.DisableListener = true
+	f.conf.RefreshInterval = 10 * time.Millisecond
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	testKeyFIle, err := ioutil.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json")
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(f.conf.Path, "1f185718734552d08278aa70f804580bab5fd2b4.key.json"), testKeyFIle, 0644)
+	assert.NoError(t, err)
+
+	newAddr := <-listener
+	assert.Equal(t, `0x1f185718734552d08278aa70f804580bab5fd2b4`, newAddr.String())
+
+	// Failures are logged, and the refresh continues
+	err = os.RemoveAll(f.conf.Path)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	err = f.Close()
+	assert.NoError(t, err)
+	<-f.refreshDone
+
+}
+
+func TestRefreshJitter(t *testing.T) {
+
+	for i := 0; i < 100; i++ {
+		d := refreshJitter(time.Second)
+		assert.GreaterOrEqual(t, d, 900*time.Millisecond)
+		assert.Less(t, d, 1100*time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(1), refreshJitter(1))
+
+}
+
+func TestFileListenerEvictsChangedPasswordFile(t *testing.T) {
+
+	ctx, f, listener, done := newEmptyWalletTestDir(t, true)
+	defer done()
+
+	testPWFIle, err := ioutil.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.pwd")
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(f.conf.Path, "1f185718734552d08278aa70f804580bab5fd2b4.pwd"), testPWFIle, 0644)
+	assert.NoError(t, err)
+	testKeyFIle, err := ioutil.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json")
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(f.conf.Path, "1f185718734552d08278aa70f804580bab5fd2b4.key.json"), testKeyFIle, 0644)
+	assert.NoError(t, err)
+	<-listener
+
+	addr := *ethtypes.MustNewAddress(`1f185718734552d08278aa70f804580bab5fd2b4`)
+	_, err = f.GetWalletFile(ctx, addr)
+	assert.NoError(t, err)
+
+	// Changing the password means the cached key is evicted, and the key can no longer be loaded
+	err = ioutil.WriteFile(path.Join(f.conf.Path, "1f185718734552d08278aa70f804580bab5fd2b4.pwd"), []byte("wrong"), 0644)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := f.GetWalletFile(ctx, addr)
+		return err != nil
+	}, 60*time.Second, 10*time.Millisecond)
 
 }
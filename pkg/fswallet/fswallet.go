@@ -19,26 +19,34 @@ package fswallet
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"io/fs"
-	"os"
+	"math/big"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/metric"
 	"github.com/hyperledger/firefly-signer/internal/signermsgs"
 	"github.com/hyperledger/firefly-signer/pkg/eip712"
 	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/hdwallet"
 	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
 	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
 	"github.com/karlseguin/ccache"
 	"github.com/pelletier/go-toml"
+	"golang.org/x/crypto/sha3"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
 	"gopkg.in/yaml.v2"
 )
 
@@ -47,40 +55,179 @@ import (
 // keys are added to the wallet (via FS listener).
 type Wallet interface {
 	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	ethsigner.AuthorizationWallet
 	GetWalletFile(ctx context.Context, addr ethtypes.Address0xHex) (keystorev3.WalletFile, error)
+	// GetAccountMetadata returns the parsed metadata file for the address (such as descriptions, owners or tags),
+	// without loading the key. Returns nil if the wallet is not configured with metadata files
+	GetAccountMetadata(ctx context.Context, addr ethtypes.Address0xHex) (map[string]interface{}, error)
+	// AddListener registers a channel to be sent each new address, in the order they are indexed. Each listener
+	// has its own bounded queue (notifyQueueSize), so a listener that does not keep up has its oldest notifications
+	// dropped (or is disconnected, with notifyOverflow: disconnect) without delaying any other listener
 	AddListener(listener chan<- ethtypes.Address0xHex)
+	// RemoveListener stops notifications to a channel registered with AddListener
+	RemoveListener(listener chan<- ethtypes.Address0xHex)
+	// ListAccounts returns a page of the indexed accounts, in the order they were indexed. The directory is
+	// read in batches, each sorted by filename, so this is filename order for wallets of up to 1000 files.
+	// Beyond that, and for keys added while running, the order is only stable within one process.
+	ListAccounts(ctx context.Context, skip, limit int) ([]*ethtypes.Address0xHex, error)
+	// QueryAccounts returns a page of the indexed accounts that match the query, filtered by address prefix and
+	// sorted, along with the total number that match
+	QueryAccounts(ctx context.Context, query *AccountQuery) (accounts []*ethtypes.Address0xHex, total int, err error)
+	// AccountCount returns the number of accounts indexed so far
+	AccountCount(ctx context.Context) (int, error)
+	// ListenerHealth returns nil while the filesystem listener is running (or disabled), and otherwise the
+	// error that caused it to fail while it is being re-established
+	ListenerHealth() error
+	// HealthCheck returns an error if any of the wallet directories cannot be listed, or the listener has failed
+	HealthCheck(ctx context.Context) error
+	// RegisterMetrics enables recording of wallet metrics into the supplied registry
+	RegisterMetrics(ctx context.Context, registry metric.MetricsRegistry) error
+	// InvalidateCache removes any cached key for the address, so it is re-loaded from its files on next use.
+	// Keys are evicted automatically when the listener sees a change to the files they were loaded from
+	InvalidateCache(ctx context.Context, addr ethtypes.Address0xHex)
+	// RotatePassword re-encrypts the keystorev3 file of the address under a new password, replacing the file
+	// (and its password file, with the file password provider) and removing the key from the cache
+	RotatePassword(ctx context.Context, addr ethtypes.Address0xHex, oldPassword, newPassword string) error
+	// SetAuditSink replaces the sink for the audit record of every signing request, built from the audit configuration
+	SetAuditSink(sink AuditSink)
+	// Closed returns true once Close has been called, after which signing requests are rejected
+	Closed() bool
+	// Reload applies changes to the filenames, metadata and defaultPasswordFile configuration without a restart,
+	// retaining the signer cache. Changes to other configuration are rejected
+	Reload(ctx context.Context, conf *Config) error
 }
 
+// refreshBatchSize is the number of directory entries read and indexed at a time during a refresh,
+// so that very large wallets are never listed into memory in full
+const refreshBatchSize = 1000
+
+const (
+	defaultListenerRetryInitialDelay = 250 * time.Millisecond
+	defaultListenerRetryFactor       = 2.0
+	defaultNotifyQueueSize           = 1000
+	defaultArchiveMaxSize            = 256 * 1024 * 1024
+)
+
 func NewFilesystemWallet(ctx context.Context, conf *Config, initialListeners ...chan<- ethtypes.Address0xHex) (ww Wallet, err error) {
+	return NewFilesystemWalletWithPasswordProvider(ctx, conf, nil, initialListeners...)
+}
+
+// NewFilesystemWalletWithPasswordProvider allows a custom PasswordProvider to be supplied, in place of
+// the one built from the passwordProvider configuration (for example to obtain passwords from a secret manager).
+// When an archive is configured, the wallet is read from the files unpacked from it, rather than the filesystem.
+func NewFilesystemWalletWithPasswordProvider(ctx context.Context, conf *Config, pp PasswordProvider, initialListeners ...chan<- ethtypes.Address0xHex) (ww Wallet, err error) {
+	if conf.Archive.Path == "" {
+		return NewFilesystemWalletFS(ctx, conf, OSFS{}, pp, initialListeners...)
+	}
+	archiveConf := conf.Archive
+	if archiveConf.MaxSize <= 0 {
+		archiveConf.MaxSize = defaultArchiveMaxSize
+	}
+	fsys, err := readArchive(ctx, &archiveConf)
+	if err != nil {
+		return nil, err
+	}
+	walletConf := *conf
+	if walletConf.Path == "" {
+		walletConf.Path = "."
+	}
+	return NewFilesystemWalletFS(ctx, &walletConf, fsys, pp, initialListeners...)
+}
+
+// NewFilesystemWalletFS reads the wallet through the supplied filesystem, such as an embed.FS or an in-memory
+// filesystem, in place of the operating system filesystem. The PasswordProvider is optional, as for
+// NewFilesystemWalletWithPasswordProvider
+func NewFilesystemWalletFS(ctx context.Context, conf *Config, fsys FS, pp PasswordProvider, initialListeners ...chan<- ethtypes.Address0xHex) (ww Wallet, err error) {
 	w := &fsWallet{
 		conf:             *conf,
-		listeners:        initialListeners,
-		addressToFileMap: make(map[ethtypes.Address0xHex]string),
+		fs:               fsys,
+		addressToFileMap: make(map[ethtypes.Address0xHex]indexedFile),
+		keyFiles:         make(map[string]map[ethtypes.Address0xHex]bool),
+		cachedKeys:       make(map[*cachedKey]bool),
+	}
+	w.notifyCtx, w.notifyCancel = context.WithCancel(context.Background())
+	for _, l := range initialListeners {
+		w.addListener(l)
+	}
+	setConfigDefaults(&w.conf)
+	if err := validateKeyFormat(ctx, w.conf.KeyFormat); err != nil {
+		return nil, err
+	}
+	if err := validateNotifyOverflow(ctx, w.conf.NotifyOverflow); err != nil {
+		return nil, err
+	}
+	if w.conf.KeyFormat == KeyFormatMnemonic {
+		if w.mnemonicPath, err = hdwallet.ParseDerivationPath(w.conf.Mnemonic.DerivationPath); err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgBadDerivationPath, w.conf.Mnemonic.DerivationPath, err)
+		}
+	}
+	if w.conf.KDFConcurrency > 0 {
+		w.kdfSemaphore = semaphore.NewWeighted(int64(w.conf.KDFConcurrency))
 	}
 	w.signerCache = ccache.New(
 		// We use a LRU cache with a size-aware max
 		ccache.Configure().
-			MaxSize(fftypes.ParseToByteSize(conf.SignerCacheSize)),
+			MaxSize(fftypes.ParseToByteSize(conf.SignerCacheSize)).
+			OnDelete(func(item *ccache.Item) {
+				w.onEvict(item.Value().(*cachedKey))
+			}),
 	)
-	w.metadataKeyFileProperty, err = goTemplateFromConfig(ctx, ConfigMetadataKeyFileProperty, conf.Metadata.KeyFileProperty)
+	rc, err := compileReloadableConfig(ctx, &w.conf)
 	if err != nil {
 		return nil, err
 	}
-	w.metadataPasswordFileProperty, err = goTemplateFromConfig(ctx, ConfigMetadataPasswordFileProperty, conf.Metadata.PasswordFileProperty)
-	if err != nil {
+	w.applyReloadableConfig(&w.conf, rc)
+	if w.dirs, err = newWalletDirs(ctx, &w.conf); err != nil {
 		return nil, err
 	}
-	if conf.Filenames.PrimaryMatchRegex != "" {
-		if w.primaryMatchRegex, err = regexp.Compile(conf.Filenames.PrimaryMatchRegex); err != nil {
-			return nil, i18n.NewError(ctx, signermsgs.MsgBadRegularExpression, ConfigFilenamesPrimaryMatchRegex, err)
-		}
-		if len(w.primaryMatchRegex.SubexpNames()) < 2 {
-			return nil, i18n.NewError(ctx, signermsgs.MsgMissingRegexpCaptureGroup, w.primaryMatchRegex.String())
+	if w.lookupTemplate, err = goTemplateFromConfig(ctx, ConfigLookupTemplate, w.conf.LookupTemplate); err != nil {
+		return nil, err
+	}
+	w.passwordProvider = pp
+	if w.passwordProvider == nil {
+		if w.passwordProvider, err = newPasswordProviderFromConfig(ctx, w); err != nil {
+			return nil, err
 		}
 	}
+	sink, auditFile, err := newAuditSinkFromConfig(ctx, &w.conf.Audit)
+	if err != nil {
+		return nil, err
+	}
+	w.SetAuditSink(sink)
+	w.auditFile = auditFile
 	return w, nil
 }
 
+// setConfigDefaults fills in defaults for any configuration not supplied, so that configurations
+// can be compared on Reload regardless of how they were built
+func setConfigDefaults(conf *Config) {
+	if conf.KeyFormat == "" {
+		conf.KeyFormat = KeyFormatKeystoreV3
+	}
+	if conf.KeyFormat == KeyFormatMnemonic && conf.Mnemonic.DerivationPath == "" {
+		conf.Mnemonic.DerivationPath = hdwallet.DefaultDerivationPath
+	}
+	if conf.ListenerRetry.InitialDelay <= 0 {
+		conf.ListenerRetry.InitialDelay = defaultListenerRetryInitialDelay
+	}
+	if conf.ListenerRetry.MaximumDelay < conf.ListenerRetry.InitialDelay {
+		conf.ListenerRetry.MaximumDelay = conf.ListenerRetry.InitialDelay
+	}
+	if conf.ListenerRetry.Factor < 1 {
+		conf.ListenerRetry.Factor = defaultListenerRetryFactor
+	}
+	if conf.NotifyQueueSize <= 0 {
+		conf.NotifyQueueSize = defaultNotifyQueueSize
+	}
+	if conf.NotifyOverflow == "" {
+		conf.NotifyOverflow = NotifyOverflowDropOldest
+	}
+	if strings.ToLower(conf.Metadata.Format) == "auto" {
+		conf.Metadata.Format = strings.TrimPrefix(conf.Filenames.PrimaryExt, ".")
+	}
+}
+
 func goTemplateFromConfig(ctx context.Context, name string, templateStr string) (*template.Template, error) {
 	if templateStr == "" {
 		return nil, nil
@@ -93,39 +240,117 @@ func goTemplateFromConfig(ctx context.Context, name string, templateStr string)
 }
 
 type fsWallet struct {
-	conf                         Config
-	signerCache                  *ccache.Cache
-	signerCacheTTL               time.Duration
-	metadataKeyFileProperty      *template.Template
-	metadataPasswordFileProperty *template.Template
-	primaryMatchRegex            *regexp.Regexp
+	conf                              Config
+	fs                                FS
+	signerCache                       *ccache.Cache
+	signerCacheTTL                    time.Duration
+	metadataKeyFileProperty           *template.Template
+	metadataPasswordFileProperty      *template.Template
+	metadataEncryptedPasswordProperty *template.Template
+	primaryMatchRegex                 *regexp.Regexp
+	lookupTemplate                    *template.Template // set on construction - nil if the directories are scanned
+	reloadMux                         sync.RWMutex       // protects the reloadable configuration, and the templates/regexp above
+	mnemonicPath                      []uint32
+	passwordProvider                  PasswordProvider
+	dirs                              []*walletDir // set on construction, in order of precedence
+	inflightLoads                     singleflight.Group
+	kdfSemaphore                      *semaphore.Weighted                   // limits concurrent keystore decrypts - nil if unlimited
+	metrics                           atomic.Pointer[metric.MetricsManager] // set once by RegisterMetrics, read from any go-routine
+	closeOnce                         sync.Once
+	closeMux                          sync.RWMutex // held for read while using the signer cache, so it is not used after Close stops it
+	closed                            bool
+	cacheEpoch                        uint64 // incremented under the closeMux write lock each time the cache is invalidated
+	cachedKeysMux                     sync.Mutex
+	cachedKeys                        map[*cachedKey]bool // keys currently in the signer cache, so they can be zeroed on Close
 
 	mux               sync.Mutex
-	addressToFileMap  map[ethtypes.Address0xHex]string // map for lookup to filename
-	addressList       []*ethtypes.Address0xHex         // ordered list in filename at startup, then notification order
-	listeners         []chan<- ethtypes.Address0xHex
+	addressToFileMap  map[ethtypes.Address0xHex]indexedFile // map for lookup to the primary file
+	addressList       []*ethtypes.Address0xHex              // ordered list in directory order at startup, then notification order (append only)
+	listeners         []*addressListener
+	notifyCtx         context.Context // cancelled on Close, to stop any blocked notification dispatchers
+	notifyCancel      context.CancelFunc
+	listenerErr       error
 	fsListenerCancel  context.CancelFunc
 	fsListenerStarted chan error
 	fsListenerDone    chan struct{}
+	refreshDone       chan struct{}
+	initialScanDone   chan struct{}
+
+	// files each cached key was loaded from (protected by mux), so the key is evicted when one of them changes
+	keyFiles map[string]map[ethtypes.Address0xHex]bool
+
+	auditSink atomic.Pointer[auditSinkRef] // replaced by SetAuditSink, read from any go-routine
+	auditFile io.Closer                    // opened for the audit file sink, closed on Close
 }
 
 func (w *fsWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
-	keypair, err := w.getSignerForJSONAccount(ctx, txn.From)
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *fsWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) (signed []byte, err error) {
+	record := &AuditRecord{Operation: AuditOperationSignTransaction, ChainID: chainID}
+	defer func() {
+		if err == nil {
+			hash := sha3.NewLegacyKeccak256()
+			hash.Write(signed)
+			record.Hash = hash.Sum(nil)
+		}
+		w.audit(ctx, record, err)
+	}()
+
+	from, err := parseJSONAccount(txn.From)
 	if err != nil {
 		return nil, err
 	}
-	return txn.Sign(keypair, chainID)
+	record.Address = &from
+	keypair, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return txn.SignBig(keypair, chainID)
 }
 
-func (w *fsWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+func (w *fsWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (result *ethsigner.EIP712Result, err error) {
+	record := &AuditRecord{Operation: AuditOperationSignTypedData, Address: &from}
+	defer func() {
+		if err == nil {
+			record.Hash = result.Hash
+		}
+		w.audit(ctx, record, err)
+	}()
+
 	keypair, err := w.getSignerForAddr(ctx, from)
 	if err != nil {
 		return nil, err
 	}
+	defer keypair.Destroy()
 	return ethsigner.SignTypedDataV4(ctx, keypair, payload)
 }
 
+func (w *fsWallet) SignAuthorization(ctx context.Context, from ethtypes.Address0xHex, auth *ethsigner.Authorization) (err error) {
+	record := &AuditRecord{Operation: AuditOperationSignAuthorization, Address: &from, ChainID: auth.ChainID.BigInt()}
+	defer func() {
+		if err == nil {
+			hash := sha3.NewLegacyKeccak256()
+			hash.Write(auth.SignaturePayload())
+			record.Hash = hash.Sum(nil)
+		}
+		w.audit(ctx, record, err)
+	}()
+
+	keypair, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer keypair.Destroy()
+	return auth.Sign(keypair)
+}
+
 func (w *fsWallet) Initialize(ctx context.Context) error {
+	if w.Closed() {
+		return i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
 	// Run a get accounts pass, to check all is ok
 	lCtx, lCancel := context.WithCancel(log.WithLogField(ctx, "fswallet", w.conf.Path))
 	w.fsListenerCancel = lCancel
@@ -135,14 +360,34 @@ func (w *fsWallet) Initialize(ctx context.Context) error {
 	if err := w.startFilesystemListener(lCtx); err != nil {
 		return err
 	}
+	w.refreshDone = make(chan struct{})
+	w.startPeriodicRefresh(lCtx)
+	if w.conf.BackgroundScan {
+		// Index the directory incrementally in the background, with keys looked up on demand
+		// by filename in the meantime
+		w.initialScanDone = make(chan struct{})
+		go func() {
+			defer close(w.initialScanDone)
+			if err := w.Refresh(lCtx); err != nil {
+				log.L(lCtx).Errorf("Background scan failed: %s", err)
+				return
+			}
+			w.preloadKeys(lCtx)
+		}()
+		return nil
+	}
 	// Do an initial full scan before returning
-	return w.Refresh(ctx)
+	if err := w.Refresh(ctx); err != nil {
+		return err
+	}
+	w.preloadKeys(ctx)
+	return nil
 }
 
 func (w *fsWallet) AddListener(listener chan<- ethtypes.Address0xHex) {
 	w.mux.Lock()
 	defer w.mux.Unlock()
-	w.listeners = append(w.listeners, listener)
+	w.addListener(listener)
 }
 
 // GetAccounts returns the currently cached list of known addresses
@@ -154,99 +399,252 @@ func (w *fsWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, err
 	return accounts, nil
 }
 
-func (w *fsWallet) matchFilename(ctx context.Context, f fs.FileInfo) *ethtypes.Address0xHex {
+// ListAccounts returns a page of the currently cached list of known addresses. A limit
+// of zero or less returns all accounts after the skip.
+func (w *fsWallet) ListAccounts(_ context.Context, skip, limit int) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return pageAccounts(w.addressList, skip, limit), nil
+}
+
+// AccountCount returns the number of currently cached known addresses
+func (w *fsWallet) AccountCount(_ context.Context) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return len(w.addressList), nil
+}
+
+func (w *fsWallet) matchFilename(ctx context.Context, d *walletDir, f fs.DirEntry) *ethtypes.Address0xHex {
 	if f.IsDir() {
-		log.L(ctx).Tracef("Ignoring '%s/%s: directory", w.conf.Path, f.Name())
+		log.L(ctx).Tracef("Ignoring '%s/%s: directory", d.path, f.Name())
 		return nil
 	}
-	if w.primaryMatchRegex != nil {
-		match := w.primaryMatchRegex.FindStringSubmatch(f.Name())
+	filenames, primaryMatchRegex := w.dirFilenames(d)
+	if primaryMatchRegex != nil {
+		match := primaryMatchRegex.FindStringSubmatch(f.Name())
 		if match == nil {
-			log.L(ctx).Tracef("Ignoring '%s/%s': does not match regexp", w.conf.Path, f.Name())
+			log.L(ctx).Tracef("Ignoring '%s/%s': does not match regexp", d.path, f.Name())
 			return nil
 		}
 		addr, err := ethtypes.NewAddress(match[1]) // safe due to SubexpNames() length check
 		if err != nil {
-			log.L(ctx).Warnf("Ignoring '%s/%s': invalid address '%s': %s", w.conf.Path, f.Name(), match[1], err)
+			log.L(ctx).Warnf("Ignoring '%s/%s': invalid address '%s': %s", d.path, f.Name(), match[1], err)
 			return nil
 		}
 		return addr
 	}
-	if !strings.HasSuffix(f.Name(), w.conf.Filenames.PrimaryExt) {
-		log.L(ctx).Tracef("Ignoring '%s/%s: does not match extension '%s'", w.conf.Path, f.Name(), w.conf.Filenames.PrimaryExt)
+	if !strings.HasSuffix(f.Name(), filenames.PrimaryExt) {
+		log.L(ctx).Tracef("Ignoring '%s/%s: does not match extension '%s'", d.path, f.Name(), filenames.PrimaryExt)
 	}
-	addrString := strings.TrimSuffix(f.Name(), w.conf.Filenames.PrimaryExt)
+	addrString := strings.TrimSuffix(f.Name(), filenames.PrimaryExt)
 	addr, err := ethtypes.NewAddress(addrString)
 	if err != nil {
-		log.L(ctx).Warnf("Ignoring '%s/%s': invalid address '%s': %s", w.conf.Path, f.Name(), addrString, err)
+		log.L(ctx).Warnf("Ignoring '%s/%s': invalid address '%s': %s", d.path, f.Name(), addrString, err)
 		return nil
 	}
 	return addr
 }
 
+// Refresh scans the wallet directories in order of precedence, indexing any new addresses. Each
+// directory is read incrementally in batches, with each batch indexed (and listeners notified) before
+// the next is read, so accounts become available progressively on very large wallets.
 func (w *fsWallet) Refresh(ctx context.Context) error {
-	log.L(ctx).Infof("Refreshing account list at %s", w.conf.Path)
-	dirEntries, err := os.ReadDir(w.conf.Path)
+	if w.lookupTemplate != nil {
+		log.L(ctx).Debugf("Keys are looked up with %s - directories are not scanned", ConfigLookupTemplate)
+		return nil
+	}
+	for i := range w.dirs {
+		if err := w.refreshDir(ctx, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *fsWallet) refreshDir(ctx context.Context, dirIndex int) error {
+	d := w.dirs[dirIndex]
+	log.L(ctx).Infof("Refreshing account list at %s", d.path)
+	dir, err := w.fs.Open(d.path)
 	if err != nil {
 		return i18n.WrapError(ctx, err, signermsgs.MsgReadDirFile)
 	}
-	files := make([]os.FileInfo, 0, len(dirEntries))
-	for _, de := range dirEntries {
-		fi, infoErr := de.Info()
-		if infoErr == nil {
-			files = append(files, fi)
+	defer dir.Close()
+	rdf, ok := dir.(fs.ReadDirFile)
+	if !ok {
+		return i18n.NewError(ctx, signermsgs.MsgReadDirFile)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return i18n.WrapError(ctx, err, signermsgs.MsgReadDirFile)
+		}
+		dirEntries, err := rdf.ReadDir(refreshBatchSize)
+		if len(dirEntries) > 0 {
+			// ReadDir on an open directory returns entries in directory order, which varies by filesystem
+			sort.Slice(dirEntries, func(i, j int) bool { return dirEntries[i].Name() < dirEntries[j].Name() })
+			w.notifyNewFiles(ctx, dirIndex, dirEntries...)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return i18n.WrapError(ctx, err, signermsgs.MsgReadDirFile)
 		}
 	}
-	if len(files) > 0 {
-		w.notifyNewFiles(ctx, files...)
+}
+
+// indexByFilename looks for the file for an address that has not been indexed (yet), when the filename
+// can be derived from the address. This allows keys to be used before a background scan reaches them.
+// Directories are checked in order of precedence.
+func (w *fsWallet) indexByFilename(ctx context.Context, addr ethtypes.Address0xHex) (indexedFile, bool) {
+	if !w.conf.BackgroundScan {
+		return indexedFile{}, false
+	}
+	for i, d := range w.dirs {
+		filenames, primaryMatchRegex := w.dirFilenames(d)
+		if primaryMatchRegex != nil {
+			continue
+		}
+		for _, filename := range []string{
+			strings.TrimPrefix(addr.String(), "0x") + filenames.PrimaryExt,
+			addr.String() + filenames.PrimaryExt,
+		} {
+			fi, err := w.fs.Stat(path.Join(d.path, filename))
+			if err == nil {
+				w.notifyNewFiles(ctx, i, fs.FileInfoToDirEntry(fi))
+				w.mux.Lock()
+				primaryFile, ok := w.addressToFileMap[addr]
+				w.mux.Unlock()
+				return primaryFile, ok
+			}
+		}
 	}
-	return nil
+	return indexedFile{}, false
 }
 
-func (w *fsWallet) notifyNewFiles(ctx context.Context, files ...fs.FileInfo) {
+// notifyNewFiles indexes files found in one of the directories. If an address is found in more than one
+// directory, the file in the directory with the highest precedence is used regardless of the order the
+// files are found in. Within one directory, the file already indexed is kept (see keepIndexedFile).
+func (w *fsWallet) notifyNewFiles(ctx context.Context, dirIndex int, files ...fs.DirEntry) {
+	d := w.dirs[dirIndex]
+	files = w.resolveSymlinks(ctx, d, files)
 	// Lock now we have the list
 	w.mux.Lock()
-	defer w.mux.Unlock()
 	newAddresses := make([]*ethtypes.Address0xHex, 0)
+	superseded := make([]*ethtypes.Address0xHex, 0)
 	for _, f := range files {
-		addr := w.matchFilename(ctx, f)
-		if addr != nil {
-			if existingFilename, exists := w.addressToFileMap[*addr]; existingFilename != f.Name() {
-				w.addressToFileMap[*addr] = f.Name()
-				if !exists {
-					log.L(ctx).Debugf("Added address: %s (file=%s)", addr, f.Name())
-					w.addressList = append(w.addressList, addr)
-					newAddresses = append(newAddresses, addr)
-				}
-			}
+		addr := w.matchFilename(ctx, d, f)
+		if addr == nil {
+			continue
 		}
-	}
-	listeners := make([]chan<- ethtypes.Address0xHex, len(w.listeners))
-	copy(listeners, w.listeners)
-	log.L(ctx).Debugf("Processed %d files. Found %d new addresses", len(files), len(newAddresses))
-	// Avoid holding the lock while calling the listeners, by using a go-routine
-	go func() {
-		for _, l := range w.listeners {
-			for _, addr := range newAddresses {
-				l <- *addr
+		file := indexedFile{dir: dirIndex, name: f.Name()}
+		existing, exists := w.addressToFileMap[*addr]
+		switch {
+		case exists && existing.dir < dirIndex:
+			log.L(ctx).Debugf("Ignoring '%s/%s': address %s is in '%s', which takes precedence", d.path, f.Name(), addr, w.dirs[existing.dir].path)
+		case !exists:
+			log.L(ctx).Debugf("Added address: %s (file=%s/%s)", addr, d.path, f.Name())
+			w.addressToFileMap[*addr] = file
+			w.addressList = append(w.addressList, addr)
+			newAddresses = append(newAddresses, addr)
+		case existing.dir == dirIndex && existing != file && w.keepIndexedFile(ctx, d, existing, file, addr):
+			// Another filename in the same directory for an address that is already indexed
+		case existing != file:
+			w.addressToFileMap[*addr] = file
+			if existing.dir != dirIndex {
+				log.L(ctx).Infof("Address %s now loaded from '%s/%s', which takes precedence over '%s'", addr, d.path, f.Name(), w.dirs[existing.dir].path)
+				superseded = append(superseded, addr)
 			}
 		}
-	}()
+	}
+	if len(newAddresses) > 0 {
+		w.metricsAccountCount(ctx)
+	}
+	log.L(ctx).Debugf("Processed %d files in '%s'. Found %d new addresses", len(files), d.path, len(newAddresses))
+	// Avoid holding the lock while calling the listeners, by queuing the notifications for a dispatcher
+	// go-routine per listener - so each listener sees addresses in the order they were indexed
+	w.queueNotifications(ctx, newAddresses)
+	w.mux.Unlock()
+
+	// Any key cached from the directory with lower precedence must not be used again
+	for _, addr := range superseded {
+		w.InvalidateCache(ctx, *addr)
+	}
 }
 
+// Close stops the filesystem listener and any background scan, stops delivery of queued notifications to
+// listeners, and discards all cached signing keys. Subsequent signing requests fail. It is safe to call
+// more than once, and any call returns only once the wallet is fully closed.
 func (w *fsWallet) Close() error {
-	if w.fsListenerCancel != nil {
-		w.fsListenerCancel()
-		<-w.fsListenerDone
-	}
+	w.closeOnce.Do(func() {
+		w.closeMux.Lock()
+		w.closed = true
+		w.closeMux.Unlock()
+
+		w.notifyCancel()
+		if w.fsListenerCancel != nil {
+			w.fsListenerCancel()
+			<-w.fsListenerDone
+		}
+		if w.refreshDone != nil {
+			<-w.refreshDone
+		}
+		if w.initialScanDone != nil {
+			<-w.initialScanDone
+		}
+
+		// Nothing can use the cache now closed is set, so it is safe to stop the cache's worker and clear it
+		w.signerCache.Stop()
+		w.signerCache.Clear()
+		w.evictAllCachedKeys()
+		if w.auditFile != nil {
+			_ = w.auditFile.Close()
+		}
+	})
 	return nil
 }
 
-func (w *fsWallet) getSignerForJSONAccount(ctx context.Context, rawAddrJSON json.RawMessage) (*secp256k1.KeyPair, error) {
+func (w *fsWallet) Closed() bool {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+	return w.closed
+}
+
+func (w *fsWallet) getCachedKey(ctx context.Context, addrString string) (*cachedKey, error) {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+	if w.closed {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	cached := w.signerCache.Get(addrString)
+	w.metricsCacheLookup(ctx, cached != nil)
+	if cached == nil {
+		return nil, nil
+	}
+	cached.Extend(w.signerCacheTTL)
+	return cached.Value().(*cachedKey), nil
+}
 
-	// We require an ethereum address in the "from" field
-	var from ethtypes.Address0xHex
-	err := json.Unmarshal(rawAddrJSON, &from)
+// cacheKey caches a loaded key, unless the cache has been invalidated since the load started
+// (as the files might have changed after they were read)
+func (w *fsWallet) cacheKey(addrString string, ck *cachedKey, epoch uint64) {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+	if !w.closed && w.cacheEpoch == epoch {
+		w.cachedKeysMux.Lock()
+		w.cachedKeys[ck] = true
+		w.cachedKeysMux.Unlock()
+		w.signerCache.Set(addrString, ck, w.signerCacheTTL)
+	}
+}
+
+// parseJSONAccount parses the "from" field, which we require to be an ethereum address
+func parseJSONAccount(rawAddrJSON json.RawMessage) (from ethtypes.Address0xHex, err error) {
+	err = json.Unmarshal(rawAddrJSON, &from)
+	return from, err
+}
+
+func (w *fsWallet) getSignerForJSONAccount(ctx context.Context, rawAddrJSON json.RawMessage) (*secp256k1.KeyPair, error) {
+	from, err := parseJSONAccount(rawAddrJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -255,95 +653,216 @@ func (w *fsWallet) getSignerForJSONAccount(ctx context.Context, rawAddrJSON json
 
 func (w *fsWallet) getSignerForAddr(ctx context.Context, from ethtypes.Address0xHex) (*secp256k1.KeyPair, error) {
 
-	wf, err := w.GetWalletFile(ctx, from)
+	if w.conf.ReadOnly {
+		return nil, i18n.NewError(ctx, signermsgs.MsgSigningDisabled, from)
+	}
+	ck, err := w.acquireKey(ctx, from, false)
 	if err != nil {
 		return nil, err
 	}
-	return wf.KeyPair(), nil
+	defer ck.release()
+	// The caller gets its own copy of the key pair, which it destroys once signing is complete
+	return ck.wf.KeyPair(), nil
 
 }
 
+// GetWalletFile returns the cached wallet file for the address, loading it if required. The key held
+// by the returned file is not zeroed when it is evicted from the cache, as the caller might still be using it.
 func (w *fsWallet) GetWalletFile(ctx context.Context, addr ethtypes.Address0xHex) (keystorev3.WalletFile, error) {
 
-	addrString := addr.String()
-	cached := w.signerCache.Get(addrString)
-	if cached != nil {
-		cached.Extend(w.signerCacheTTL)
-		return cached.Value().(keystorev3.WalletFile), nil
+	ck, err := w.acquireKey(ctx, addr, true)
+	if err != nil {
+		return nil, err
 	}
+	ck.release()
+	return ck.wf, nil
 
-	w.mux.Lock()
-	primaryFilename, ok := w.addressToFileMap[addr]
-	w.mux.Unlock()
+}
+
+// acquireKey returns the cached key for the address, loading it if required. The caller must release the
+// key once it has finished with it, and until then the key is not zeroed even if it is evicted.
+func (w *fsWallet) acquireKey(ctx context.Context, addr ethtypes.Address0xHex, retain bool) (*cachedKey, error) {
+
+	for {
+		ck, err := w.getCachedKey(ctx, addr.String())
+		if err == nil && ck == nil {
+			var primaryFilename string
+			if primaryFilename, err = w.primaryFilename(ctx, addr); err == nil {
+				ck, err = w.loadAndCacheKey(ctx, addr, primaryFilename)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ck.acquire(retain) {
+			return ck, nil
+		}
+		// The key was evicted and zeroed before we could use it, so look it up again
+	}
+
+}
+
+// primaryFilename returns the path of the key or metadata file for the address
+func (w *fsWallet) primaryFilename(ctx context.Context, addr ethtypes.Address0xHex) (string, error) {
+	var primaryFile indexedFile
+	var ok bool
+	if w.lookupTemplate != nil {
+		primaryFile, ok = w.lookupByTemplate(ctx, addr)
+	} else {
+		w.mux.Lock()
+		primaryFile, ok = w.addressToFileMap[addr]
+		w.mux.Unlock()
+		if !ok {
+			primaryFile, ok = w.indexByFilename(ctx, addr)
+		}
+	}
 	if !ok {
-		return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+		return "", i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
 	}
+	return path.Join(w.dirs[primaryFile.dir].path, primaryFile.name), nil
+}
 
-	kv3, err := w.loadWalletFile(ctx, addr, path.Join(w.conf.Path, primaryFilename))
+// GetAccountMetadata reads the metadata file on each call, so reflects any changes without waiting for
+// the key to be evicted from the cache. YAML maps are converted to string keys, so the result can be
+// serialized as JSON.
+func (w *fsWallet) GetAccountMetadata(ctx context.Context, addr ethtypes.Address0xHex) (map[string]interface{}, error) {
+	primaryFilename, err := w.primaryFilename(ctx, addr)
 	if err != nil {
 		return nil, err
 	}
+	w.reloadMux.RLock()
+	format := w.conf.Metadata.Format
+	w.reloadMux.RUnlock()
+	if !isMetadataFormat(format) {
+		return nil, nil
+	}
+	b, err := w.fs.ReadFile(primaryFilename)
+	if err != nil {
+		log.L(ctx).Errorf("Failed to read '%s': %s", primaryFilename, err)
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
+	}
+	metadata, err := parseMetadata(format, b)
+	if err != nil {
+		log.L(ctx).Errorf("Failed to parse '%s' as %s: %s", primaryFilename, format, err)
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
+	}
+	return jsonCompatible(metadata).(map[string]interface{}), nil
+}
+
+// loadAndCacheKey ensures there is only one load in flight for each address. The KDF cannot be
+// interrupted part way through, so if the caller gives up (context cancelled, or kdfTimeout reached) the
+// load continues in the background and the CPU is still spent. The result is cached when it completes,
+// so a retry from the client is served from the cache (or joins the in-flight load) rather than starting
+// another KDF. When kdfConcurrency is set, a load waiting for a decrypt slot is abandoned if the caller that
+// started it gives up first, so a burst of requests that have timed out does not leave a queue of decrypts.
+func (w *fsWallet) loadAndCacheKey(ctx context.Context, addr ethtypes.Address0xHex, primaryFilename string) (*cachedKey, error) {
 
-	keypair := kv3.KeyPair()
-	if keypair.Address != addr {
-		return nil, i18n.NewError(ctx, signermsgs.MsgAddressMismatch, keypair.Address, addr)
+	// No point doing any of the file I/O if the caller has already gone away
+	if err := ctx.Err(); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletDecryptInterrupted, addr, err)
 	}
 
-	w.signerCache.Set(addrString, kv3, w.signerCacheTTL)
-	return kv3, err
+	waitCtx := ctx
+	if w.conf.KDFTimeout > 0 {
+		var waitCancel context.CancelFunc
+		waitCtx, waitCancel = context.WithTimeout(ctx, w.conf.KDFTimeout)
+		defer waitCancel()
+	}
+
+	addrString := addr.String()
+	loadCtx := context.WithoutCancel(ctx)
+	resultChan := w.inflightLoads.DoChan(addrString, func() (interface{}, error) {
+		epoch := w.getCacheEpoch()
+		kv3, err := w.loadWalletFile(loadCtx, waitCtx, addr, primaryFilename)
+		if err != nil {
+			return nil, err
+		}
+		keypair := kv3.KeyPair()
+		keypair.Destroy()
+		if keypair.Address != addr {
+			if d, ok := kv3.(destroyableKey); ok {
+				d.Destroy()
+			}
+			return nil, i18n.NewError(loadCtx, signermsgs.MsgAddressMismatch, keypair.Address, addr)
+		}
+		ck := &cachedKey{wf: kv3}
+		w.cacheKey(addrString, ck, epoch)
+		return ck, nil
+	})
+
+	select {
+	case res := <-resultChan:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*cachedKey), nil
+	case <-waitCtx.Done():
+		log.L(ctx).Errorf("Gave up waiting for signing key for address %s to load (will be cached when complete): %s", addr, waitCtx.Err())
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletDecryptInterrupted, addr, waitCtx.Err())
+	}
 
 }
 
-func (w *fsWallet) loadWalletFile(ctx context.Context, addr ethtypes.Address0xHex, primaryFilename string) (keystorev3.WalletFile, error) {
+func (w *fsWallet) loadWalletFile(ctx, queueCtx context.Context, addr ethtypes.Address0xHex, primaryFilename string) (keystorev3.WalletFile, error) {
 
-	b, err := os.ReadFile(primaryFilename)
+	w.trackKeyFile(addr, primaryFilename)
+	b, err := w.fs.ReadFile(primaryFilename)
 	if err != nil {
 		log.L(ctx).Errorf("Failed to read '%s': %s", primaryFilename, err)
 		return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
 	}
 
-	keyFilename, passwordFilename, err := w.getKeyAndPasswordFiles(ctx, addr, primaryFilename, b)
+	keyFilename, metadata, err := w.getKeyFileAndMetadata(ctx, addr, primaryFilename, b)
 	if err != nil {
 		return nil, err
 	}
-	log.L(ctx).Debugf("Reading keyfile=%s passwordfile=%s", keyFilename, passwordFilename)
+	log.L(ctx).Debugf("Reading keyfile=%s", keyFilename)
 
 	if keyFilename != primaryFilename {
-		b, err = os.ReadFile(keyFilename)
+		w.trackKeyFile(addr, keyFilename)
+		b, err = w.fs.ReadFile(keyFilename)
 		if err != nil {
 			log.L(ctx).Errorf("Failed to read '%s' (keyfile): %s", keyFilename, err)
 			return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
 		}
 	}
 
-	var password []byte
-	if passwordFilename != "" {
-		password, err = os.ReadFile(passwordFilename)
+	if wf, ok, err := readUnencryptedKeyFile(w.conf.KeyFormat, b); ok {
 		if err != nil {
-			log.L(ctx).Debugf("Failed to read '%s' (password file): %s", passwordFilename, err)
-		} else if w.conf.Filenames.PasswordTrimSpace {
-			password = []byte(strings.TrimSpace(string(password)))
+			log.L(ctx).Errorf("Failed to read '%s' (bad %s key file): %s", keyFilename, w.conf.KeyFormat, err)
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
 		}
+		log.L(ctx).Infof("Loaded unencrypted signing key for address: %s", addr)
+		return wf, nil
 	}
 
-	// fall back to default password file
-	if password == nil {
-		if w.conf.DefaultPasswordFile == "" {
-			log.L(ctx).Errorf("No password file available for address, and no default password file: %s", addr)
-			return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
-		}
-		password, err = os.ReadFile(w.conf.DefaultPasswordFile)
-		if err != nil {
-			log.L(ctx).Errorf("Failed to read '%s' (default password file): %s", w.conf.DefaultPasswordFile, err)
-			return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
-		}
+	if w.conf.KeyFormat == KeyFormatMnemonic {
+		return w.loadMnemonicKeyFile(ctx, addr, keyFilename, metadata, b)
+	}
 
+	password, err := w.passwordProvider.GetPassword(ctx, addr, metadata)
+	if err != nil {
+		log.L(ctx).Errorf("No password available for address %s: %s", addr, err)
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
 	}
 
-	// Ok - now we have what we need to open up the keyfile
-	kv3, err := keystorev3.ReadWalletFile(b, password)
+	// Ok - now we have what we need to open up the keyfile, which is the expensive part
+	if w.kdfSemaphore != nil {
+		if err := w.kdfSemaphore.Acquire(queueCtx, 1); err != nil {
+			log.L(ctx).Errorf("Abandoned waiting to decrypt signing key for address %s: %s", addr, err)
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletDecryptInterrupted, addr, err)
+		}
+		defer w.kdfSemaphore.Release(1)
+	}
+	decryptStart := time.Now()
+	kv3, err := keystorev3.ReadWalletFileWithOptions(b, password, &keystorev3.ReadOptions{
+		Warn: func(msg string) {
+			log.L(ctx).Warnf("Read '%s' with a variant of the keystorev3 format: %s", keyFilename, msg)
+		},
+	})
+	w.metricsDecrypted(ctx, decryptStart, err == nil)
 	if err != nil {
-		log.L(ctx).Errorf("Failed to read '%s' (bad keystorev3 file): %s", w.conf.DefaultPasswordFile, err)
+		log.L(ctx).Errorf("Failed to read '%s' (bad keystorev3 file): %s", keyFilename, err)
 		return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
 	}
 	log.L(ctx).Infof("Loaded signing key for address: %s", addr)
@@ -351,45 +870,73 @@ func (w *fsWallet) loadWalletFile(ctx context.Context, addr ethtypes.Address0xHe
 
 }
 
-func (w *fsWallet) getKeyAndPasswordFiles(ctx context.Context, addr ethtypes.Address0xHex, primaryFilename string, primaryFile []byte) (kf string, pf string, err error) {
-	if strings.ToLower(w.conf.Metadata.Format) == "auto" {
-		w.conf.Metadata.Format = strings.TrimPrefix(w.conf.Filenames.PrimaryExt, ".")
+func (w *fsWallet) loadMnemonicKeyFile(ctx context.Context, addr ethtypes.Address0xHex, keyFilename string, metadata map[string]interface{}, b []byte) (keystorev3.WalletFile, error) {
+	var passphrase []byte
+	if w.conf.Mnemonic.UsePassword {
+		var err error
+		if passphrase, err = w.passwordProvider.GetPassword(ctx, addr, metadata); err != nil {
+			log.L(ctx).Errorf("No password available for address %s: %s", addr, err)
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
+		}
+	}
+	wf, err := readMnemonicKeyFile(b, string(passphrase), w.mnemonicPath)
+	if err != nil {
+		log.L(ctx).Errorf("Failed to read '%s' (bad mnemonic key file): %s", keyFilename, err)
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
+	}
+	log.L(ctx).Infof("Loaded signing key for address: %s (derived at %s)", addr, w.conf.Mnemonic.DerivationPath)
+	return wf, nil
+}
+
+// getKeyFileAndMetadata returns the parsed metadata (nil if the primary file is not a metadata file)
+// and the name of the file containing the keystore
+func (w *fsWallet) getKeyFileAndMetadata(ctx context.Context, addr ethtypes.Address0xHex, primaryFilename string, primaryFile []byte) (kf string, metadata map[string]interface{}, err error) {
+	w.reloadMux.RLock()
+	format, keyFileProperty := w.conf.Metadata.Format, w.metadataKeyFileProperty
+	w.reloadMux.RUnlock()
+
+	if !isMetadataFormat(format) {
+		// No separate metadata file - the primary file is the key file
+		return primaryFilename, nil, nil
+	}
+	if metadata, err = parseMetadata(format, primaryFile); err != nil {
+		log.L(ctx).Errorf("Failed to parse '%s' as %s: %s", primaryFilename, format, err)
+		return "", nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
 	}
 
-	var metadata map[string]interface{}
-	switch w.conf.Metadata.Format {
+	kf, err = w.goTemplateToString(ctx, primaryFilename, metadata, keyFileProperty)
+	if err != nil || kf == "" {
+		return "", nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
+	}
+	return kf, metadata, nil
+}
+
+func isMetadataFormat(format string) bool {
+	switch format {
+	case "toml", "tml", "json", "yaml", "yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseMetadata parses a metadata file, returning an empty (non-nil) map for an empty file
+func parseMetadata(format string, b []byte) (metadata map[string]interface{}, err error) {
+	switch format {
 	case "toml", "tml":
-		err = toml.Unmarshal(primaryFile, &metadata)
+		err = toml.Unmarshal(b, &metadata)
 	case "json":
-		err = json.Unmarshal(primaryFile, &metadata)
-	case "yaml", "yml":
-		err = yaml.Unmarshal(primaryFile, &metadata)
+		err = json.Unmarshal(b, &metadata)
 	default:
-		// No separate metadata file - we just use the default password file extension instead
-		passwordPath := w.conf.Filenames.PasswordPath
-		if passwordPath == "" {
-			passwordPath = w.conf.Path
-		}
-		passwordFilename := addr.String()
-		if !w.conf.Filenames.With0xPrefix {
-			passwordFilename = strings.TrimPrefix(passwordFilename, "0x")
-		}
-		passwordFilename += w.conf.Filenames.PasswordExt
-		return primaryFilename, path.Join(passwordPath, passwordFilename), nil
+		err = yaml.Unmarshal(b, &metadata)
 	}
 	if err != nil {
-		log.L(ctx).Errorf("Failed to parse '%s' as %s: %s", primaryFilename, w.conf.Metadata.Format, err)
-		return "", "", i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
-	}
-
-	kf, err = w.goTemplateToString(ctx, primaryFilename, metadata, w.metadataKeyFileProperty)
-	if err == nil {
-		pf, err = w.goTemplateToString(ctx, primaryFilename, metadata, w.metadataPasswordFileProperty)
+		return nil, err
 	}
-	if err != nil || kf == "" {
-		return "", "", i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
+	if metadata == nil {
+		metadata = map[string]interface{}{}
 	}
-	return kf, pf, nil
+	return metadata, nil
 }
 
 func (w *fsWallet) goTemplateToString(ctx context.Context, filename string, data map[string]interface{}, t *template.Template) (string, error) {
@@ -398,10 +945,14 @@ func (w *fsWallet) goTemplateToString(ctx context.Context, filename string, data
 	}
 	buff := new(strings.Builder)
 	err := t.Execute(buff, data)
-	val := buff.String()
-	if strings.Contains(val, "<no value>") || err != nil {
+	if err != nil {
 		log.L(ctx).Errorf("Failed to execute go template against metadata file %s: err=%v", filename, err)
+		return "", err
+	}
+	val := buff.String()
+	if strings.Contains(val, "<no value>") {
+		log.L(ctx).Errorf("Go template returned no value against metadata file %s", filename)
 		return "", nil
 	}
-	return val, err
+	return val, nil
 }
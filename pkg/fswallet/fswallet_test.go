@@ -19,14 +19,17 @@ package fswallet
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-signer/pkg/eip712"
 	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -163,7 +166,7 @@ func TestListAccountsBadDir(t *testing.T) {
 
 	ctx, f, done := newTestTOMLMetadataWallet(t, false)
 	defer done()
-	f.conf.Path = "!!!"
+	f.dirs[0].path = "!!!"
 	err := f.Initialize(ctx)
 	assert.Regexp(t, "FF22013", err)
 
@@ -254,6 +257,29 @@ func TestSignTypedDataNotFound(t *testing.T) {
 
 }
 
+func TestSignReadOnly(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	f.conf.ReadOnly = true
+
+	accounts, err := f.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, accounts)
+
+	_, err = f.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`),
+	}, 2022)
+	assert.Regexp(t, "FF22119", err)
+
+	_, err = f.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0x1f185718734552d08278aa70f804580bab5fd2b4`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22119", err)
+	assert.Zero(t, f.signerCache.ItemCount())
+
+}
+
 func TestGetAccountCached(t *testing.T) {
 
 	ctx, f, done := newTestTOMLMetadataWallet(t, true)
@@ -432,7 +458,472 @@ func TestLoadKeyBadPath(t *testing.T) {
 	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, false)
 	defer done()
 
-	_, err := f.loadWalletFile(ctx, *ethtypes.MustNewAddress("0xFFFF5718734552d08278aa70f804580bab5fd2b4"), "../../test/keystore_toml/wrong.txt")
+	_, err := f.loadWalletFile(ctx, ctx, *ethtypes.MustNewAddress("0xFFFF5718734552d08278aa70f804580bab5fd2b4"), "../../test/keystore_toml/wrong.txt")
+	assert.Regexp(t, "FF22015", err)
+
+}
+
+func TestGetAccountKDFTimeout(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	f.conf.KDFTimeout = 1 * time.Millisecond
+
+	_, err := f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.Regexp(t, "FF22092.*deadline", err)
+
+	// A retry joins the decrypt still in flight, rather than starting another
+	_, err = f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.Regexp(t, "FF22092.*deadline", err)
+
+	// The abandoned decrypt still completes, and populates the cache
+	for f.signerCache.Get("0x1f185718734552d08278aa70f804580bab5fd2b4") == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.NoError(t, err)
+
+}
+
+func TestGetAccountContextCancelled(t *testing.T) {
+
+	_, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.Regexp(t, "FF22092.*canceled", err)
+
+}
+
+func TestGetAccountKDFConcurrencyQueued(t *testing.T) {
+
+	ctx, tomlWallet, done := newTestTOMLMetadataWallet(t, false)
+	done()
+	conf := tomlWallet.conf
+	conf.KDFConcurrency = 1
+	ff, err := NewFilesystemWallet(ctx, &conf)
+	assert.NoError(t, err)
+	defer ff.Close()
+	f := ff.(*fsWallet)
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	// Hold the only slot, so the decrypt queues until the request gives up
+	err = f.kdfSemaphore.Acquire(ctx, 1)
+	assert.NoError(t, err)
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = f.getSignerForJSONAccount(waitCtx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.Regexp(t, "FF22092.*deadline", err)
+
+	// The queued decrypt is abandoned while the slot is still held, rather than left waiting for it
+	_, err, _ = f.inflightLoads.Do("0x1f185718734552d08278aa70f804580bab5fd2b4", func() (interface{}, error) { return nil, nil })
+	assert.Regexp(t, "FF22092.*deadline", err)
+	assert.Nil(t, f.signerCache.Get("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	f.kdfSemaphore.Release(1)
+
+	_, err = f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.NoError(t, err)
+	assert.True(t, f.kdfSemaphore.TryAcquire(1))
+
+}
+
+func TestListAccountsPaginated(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+
+	count, err := f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	all, err := f.GetAccounts(ctx)
+	assert.NoError(t, err)
+
+	page, err := f.ListAccounts(ctx, 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, all[0:2], page)
+
+	page, err = f.ListAccounts(ctx, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, all[2:], page)
+
+	page, err = f.ListAccounts(ctx, -1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, all, page)
+
+	page, err = f.ListAccounts(ctx, 3, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+
+}
+
+func TestRefreshMultipleBatches(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	defer done()
+	f.conf.DisableListener = true
+
+	for i := 0; i < refreshBatchSize+5; i++ {
+		err := os.WriteFile(path.Join(f.conf.Path, fmt.Sprintf("%040x.key.json", i+1)), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	f.listeners = nil
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	count, err := f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, refreshBatchSize+5, count)
+
+}
+
+func TestRefreshContextCancelled(t *testing.T) {
+
+	_, f, done := newTestTOMLMetadataWallet(t, false)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := f.Refresh(ctx)
+	assert.Regexp(t, "FF22013", err)
+
+}
+
+func TestRefreshSortedAndNotifiedInOrder(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	defer done()
+	f.conf.DisableListener = true
+
+	// Written in reverse order
+	for i := 10; i > 0; i-- {
+		err := os.WriteFile(path.Join(f.conf.Path, fmt.Sprintf("%040x.key.json", i)), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	listener := make(chan ethtypes.Address0xHex, 10)
+	f.listeners = nil
+	f.addListener(listener)
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	accounts, err := f.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 10)
+	for i, addr := range accounts {
+		assert.Equal(t, fmt.Sprintf("0x%040x", i+1), addr.String())
+		assert.Equal(t, *addr, <-listener)
+	}
+
+}
+
+func TestBackgroundScan(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, false)
+	defer done()
+	f.conf.BackgroundScan = true
+
+	// Usable before it has been indexed, by filename
+	_, err := f.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.NoError(t, err)
+	_, err = f.GetWalletFile(ctx, *ethtypes.MustNewAddress("0xabcd000000000000000000000000000000000000"))
+	assert.Regexp(t, "FF22014", err)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+	<-f.initialScanDone
+
+	count, err := f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+}
+
+func TestBackgroundScanFail(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, false)
+	defer done()
+	f.conf.BackgroundScan = true
+	f.dirs[0].path = "!!!"
+
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+	<-f.initialScanDone
+
+	count, err := f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+}
+
+func TestCloseRejectsSigning(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	_, err := f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.NoError(t, err)
+	assert.False(t, f.Closed())
+
+	err = f.Close()
+	assert.NoError(t, err)
+	assert.True(t, f.Closed())
+
+	_, err = f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.Regexp(t, "FF22103", err)
+
+	_, err = f.SignTypedDataV4(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"), &eip712.TypedData{})
+	assert.Regexp(t, "FF22103", err)
+
+	err = f.Initialize(ctx)
+	assert.Regexp(t, "FF22103", err)
+
+	// The key is not cached by a load that completes after close
+	f.cacheKey("0x1f185718734552d08278aa70f804580bab5fd2b4", &cachedKey{}, f.getCacheEpoch())
+
+	// Safe to close again
+	err = f.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestCloseStopsListener(t *testing.T) {
+
+	_, f, _, done := newEmptyWalletTestDir(t, true)
+	defer done()
+
+	err := f.Close()
+	assert.NoError(t, err)
+	select {
+	case <-f.fsListenerDone:
+	default:
+		assert.Fail(t, "listener still running")
+	}
+	assert.NoError(t, f.ListenerHealth())
+
+	err = f.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestInvalidateCache(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	_, err := f.GetWalletFile(ctx, addr)
+	assert.NoError(t, err)
+	assert.Len(t, f.keyFiles, 2) // key and password files
+
+	// Served from the cache until invalidated
+	f.conf.Filenames.PasswordExt = ".wrong"
+	_, err = f.GetWalletFile(ctx, addr)
+	assert.NoError(t, err)
+
+	f.InvalidateCache(ctx, addr)
+	_, err = f.GetWalletFile(ctx, addr)
+	assert.Regexp(t, "FF22015", err)
+
+	// A load that started before an invalidation is not cached
+	epoch := f.getCacheEpoch()
+	f.InvalidateCache(ctx, addr)
+	f.cacheKey(addr.String(), &cachedKey{}, epoch)
+	assert.Nil(t, f.signerCache.Get(addr.String()))
+
+	// Safe once closed
+	f.Close()
+	f.InvalidateCache(ctx, addr)
+
+}
+
+func assertKeyZeroed(t *testing.T, ck *cachedKey) {
+	assert.True(t, ck.destroyed)
+	assert.Equal(t, make([]byte, len(ck.wf.PrivateKey())), ck.wf.PrivateKey())
+}
+
+func TestCachedKeyZeroedOnInvalidate(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	ck, err := f.acquireKey(ctx, addr, false)
+	assert.NoError(t, err)
+
+	// Not zeroed while in use, even once evicted
+	f.InvalidateCache(ctx, addr)
+	assert.False(t, ck.destroyed)
+	keypair := ck.wf.KeyPair()
+	ck.release()
+	assertKeyZeroed(t, ck)
+	f.cachedKeysMux.Lock()
+	assert.Empty(t, f.cachedKeys)
+	f.cachedKeysMux.Unlock()
+
+	// The copy taken for signing is unaffected, until it is destroyed itself
+	assert.False(t, keypair.PrivateKey.Key.IsZero())
+	keypair.Destroy()
+	assert.True(t, keypair.PrivateKey.Key.IsZero())
+
+	// A zeroed key cannot be used, and a new one is loaded
+	assert.False(t, ck.acquire(false))
+	ck2, err := f.acquireKey(ctx, addr, false)
+	assert.NoError(t, err)
+	assert.NotSame(t, ck, ck2)
+	ck2.release()
+
+}
+
+func TestCachedKeyRetainedByGetWalletFile(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	wf, err := f.GetWalletFile(ctx, addr)
+	assert.NoError(t, err)
+
+	f.InvalidateCache(ctx, addr)
+	assert.Equal(t, addr, wf.KeyPair().Address)
+
+}
+
+func TestCachedKeysZeroedOnClose(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	ck, err := f.acquireKey(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"), false)
+	assert.NoError(t, err)
+	ck.release()
+	assert.Len(t, f.cachedKeys, 1)
+
+	err = f.Close()
+	assert.NoError(t, err)
+	assertKeyZeroed(t, ck)
+	assert.Empty(t, f.cachedKeys)
+
+}
+
+func TestCachedKeyZeroedOnSizeEviction(t *testing.T) {
+
+	ctx, hexWallet, dir, done := newTestUnencryptedKeyWallet(t, KeyFormatHex)
+	done()
+	conf := hexWallet.conf
+	conf.SignerCacheSize = "1"
+	ff, err := NewFilesystemWallet(ctx, &conf)
+	assert.NoError(t, err)
+	defer ff.Close()
+	f := ff.(*fsWallet)
+
+	keypair1, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	writeTestHexKey(t, dir, keypair1.Address.String()+".key", keypair1)
+	keypair2, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	writeTestHexKey(t, dir, keypair2.Address.String()+".key", keypair2)
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	ck1, err := f.acquireKey(ctx, keypair1.Address, false)
+	assert.NoError(t, err)
+	ck1.release()
+	ck2, err := f.acquireKey(ctx, keypair2.Address, false)
+	assert.NoError(t, err)
+	ck2.release()
+
+	// Exceeding the cache size evicts the least recently used key, which is zeroed by the cache's worker
+	for {
+		ck1.mux.Lock()
+		destroyed := ck1.destroyed
+		ck1.mux.Unlock()
+		if destroyed {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.True(t, ck1.wf.(*rawKeyFile).keypair.PrivateKey.Key.IsZero())
+
+}
+
+func TestGetAccountMetadataTOML(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+
+	metadata, err := f.GetAccountMetadata(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.NoError(t, err)
+	assert.Equal(t, "File based configuration", metadata["metadata"].(map[string]interface{})["description"])
+	assert.Equal(t, "file-based-signer", metadata["signing"].(map[string]interface{})["type"])
+
+	// The key is not loaded
+	assert.Zero(t, f.signerCache.ItemCount())
+
+}
+
+func TestGetAccountMetadataYAML(t *testing.T) {
+
+	dir := t.TempDir()
+	err := os.WriteFile(path.Join(dir, "1f185718734552d08278aa70f804580bab5fd2b4.yaml"), []byte(`
+owner: treasury
+tags: [hot, eu-west]
+signing:
+  key-file: ../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json
+`), 0644)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	ff, err := NewFilesystemWallet(ctx, &Config{
+		Path:            dir,
+		Filenames:       FilenamesConfig{PrimaryExt: ".yaml"},
+		Metadata:        MetadataConfig{Format: "auto", KeyFileProperty: `{{ index .signing "key-file" }}`},
+		DisableListener: true,
+	})
+	assert.NoError(t, err)
+	defer ff.Close()
+	err = ff.Initialize(ctx)
+	assert.NoError(t, err)
+
+	metadata, err := ff.GetAccountMetadata(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.NoError(t, err)
+	b, err := json.Marshal(metadata)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"owner": "treasury",
+		"tags": ["hot", "eu-west"],
+		"signing": {"key-file": "../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json"}
+	}`, string(b))
+
+}
+
+func TestGetAccountMetadataNoMetadata(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	metadata, err := f.GetAccountMetadata(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.NoError(t, err)
+	assert.Nil(t, metadata)
+
+}
+
+func TestGetAccountMetadataErrors(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+
+	_, err := f.GetAccountMetadata(ctx, *ethtypes.MustNewAddress("0xabcd1234abcd1234abcd1234abcd1234abcd1234"))
+	assert.Regexp(t, "FF22014", err)
+
+	f.conf.Metadata.Format = "json"
+	_, err = f.GetAccountMetadata(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.Regexp(t, "FF22015", err)
+
+	f.conf.Metadata.Format = "toml"
+	f.dirs[0].path = t.TempDir()
+	_, err = f.GetAccountMetadata(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
 	assert.Regexp(t, "FF22015", err)
 
 }
@@ -0,0 +1,56 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"io"
+	"io/fs"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+// HealthCheck checks that every wallet directory can be opened and listed, and that the filesystem
+// listener is running (if enabled), without reading any key files
+func (w *fsWallet) HealthCheck(ctx context.Context) error {
+	if w.Closed() {
+		return i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	for _, d := range w.dirs {
+		if err := w.checkDirReadable(d.path); err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgWalletDirUnreadable, d.path, err)
+		}
+	}
+	return w.ListenerHealth()
+}
+
+func (w *fsWallet) checkDirReadable(path string) error {
+	dir, err := w.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	rdf, ok := dir.(fs.ReadDirFile)
+	if !ok {
+		return &fs.PathError{Op: "readdir", Path: path, Err: fs.ErrInvalid}
+	}
+	if _, err := rdf.ReadDir(1); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheckOK(t *testing.T) {
+
+	ctx, f, done := newTestMapFSWallet(t, fstest.MapFS{
+		"keys/readme.txt": &fstest.MapFile{Data: []byte("not a key")},
+	})
+	defer done()
+
+	assert.NoError(t, f.HealthCheck(ctx))
+
+	f.setListenerHealth(ctx, fmt.Errorf("pop"))
+	assert.Regexp(t, "pop", f.HealthCheck(ctx))
+
+}
+
+func TestHealthCheckMissingDir(t *testing.T) {
+
+	ctx, f, done := newTestMapFSWallet(t, fstest.MapFS{})
+	defer done()
+
+	assert.Regexp(t, "FF22220.*keys", f.HealthCheck(ctx))
+
+}
+
+func TestHealthCheckNotDirectory(t *testing.T) {
+
+	ctx, f, done := newTestMapFSWallet(t, fstest.MapFS{
+		"keys": &fstest.MapFile{Data: []byte("a file")},
+	})
+	defer done()
+
+	assert.Regexp(t, "FF22220.*keys", f.HealthCheck(ctx))
+
+}
+
+func TestHealthCheckClosed(t *testing.T) {
+
+	ctx, f, done := newTestMapFSWallet(t, fstest.MapFS{
+		"keys/readme.txt": &fstest.MapFile{Data: []byte("not a key")},
+	})
+	done()
+
+	assert.Regexp(t, "FF22103", f.HealthCheck(ctx))
+
+}
@@ -0,0 +1,162 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/hdwallet"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+const (
+	// KeyFormatKeystoreV3 key files are password protected Keystore V3 JSON files (the default)
+	KeyFormatKeystoreV3 = "keystorev3"
+	// KeyFormatHex key files contain an unencrypted 32 byte private key, as hex with an optional 0x prefix.
+	// Intended for dev/test environments only, as no password is required to use the key.
+	KeyFormatHex = "hex"
+	// KeyFormatPEM key files contain an unencrypted secp256k1 private key as a PEM "EC PRIVATE KEY" (SEC 1)
+	// or "PRIVATE KEY" (PKCS#8) block, as emitted by many key management pipelines.
+	KeyFormatPEM = "pem"
+	// KeyFormatMnemonic key files contain a BIP-39 mnemonic phrase, from which the key is derived at the
+	// configured BIP-32 path. The password for the key is optionally used as the BIP-39 passphrase.
+	KeyFormatMnemonic = "mnemonic"
+)
+
+func validateKeyFormat(ctx context.Context, keyFormat string) error {
+	switch keyFormat {
+	case KeyFormatKeystoreV3, KeyFormatHex, KeyFormatPEM, KeyFormatMnemonic:
+		return nil
+	default:
+		return i18n.NewError(ctx, signermsgs.MsgUnknownKeyFormat, keyFormat)
+	}
+}
+
+// rawKeyFile allows an unencrypted private key to be returned via the keystorev3.WalletFile interface
+type rawKeyFile struct {
+	keypair  *secp256k1.KeyPair
+	metadata map[string]interface{}
+}
+
+func newRawKeyFile(keypair *secp256k1.KeyPair) *rawKeyFile {
+	return &rawKeyFile{
+		keypair: keypair,
+		metadata: map[string]interface{}{
+			"address": keypair.Address.String(),
+		},
+	}
+}
+
+// readHexKeyFile parses a file containing only a hex encoded private key
+func readHexKeyFile(b []byte) (keystorev3.WalletFile, error) {
+	hexStr := strings.TrimPrefix(strings.TrimSpace(string(b)), "0x")
+	keyBytes, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex private key: %s", err)
+	}
+	if len(keyBytes) != 32 {
+		return nil, fmt.Errorf("invalid private key length: %d", len(keyBytes))
+	}
+	if err := secp256k1.ValidatePrivateKeyBytes(keyBytes); err != nil {
+		return nil, err
+	}
+	return newRawKeyFile(secp256k1.KeyPairFromBytes(keyBytes)), nil
+}
+
+// readPEMKeyFile parses a file containing an unencrypted PEM private key
+func readPEMKeyFile(b []byte) (keystorev3.WalletFile, error) {
+	keypair, err := secp256k1.ParsePEMPrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return newRawKeyFile(keypair), nil
+}
+
+// readMnemonicKeyFile derives the key at the supplied path, from a file containing a BIP-39 mnemonic
+func readMnemonicKeyFile(b []byte, passphrase string, derivationPath []uint32) (keystorev3.WalletFile, error) {
+	master, err := hdwallet.NewMasterKeyFromMnemonic(string(b), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := master.Derive(derivationPath)
+	if err != nil {
+		return nil, err
+	}
+	return newRawKeyFile(key.KeyPair()), nil
+}
+
+// readUnencryptedKeyFile handles the key formats that do not require a password
+func readUnencryptedKeyFile(keyFormat string, b []byte) (wf keystorev3.WalletFile, ok bool, err error) {
+	switch keyFormat {
+	case KeyFormatHex:
+		wf, err = readHexKeyFile(b)
+	case KeyFormatPEM:
+		wf, err = readPEMKeyFile(b)
+	default:
+		return nil, false, nil
+	}
+	return wf, true, err
+}
+
+func (r *rawKeyFile) PrivateKey() []byte {
+	return r.keypair.PrivateKeyBytes()
+}
+
+// KeyPair returns a copy of the key pair, so the caller can destroy it once used without affecting the
+// cached key
+func (r *rawKeyFile) KeyPair() *secp256k1.KeyPair {
+	keyBytes := r.keypair.PrivateKeyBytes()
+	defer zeroBytes(keyBytes)
+	return secp256k1.KeyPairFromBytes(keyBytes)
+}
+
+func (r *rawKeyFile) Destroy() {
+	r.keypair.Destroy()
+}
+
+// JSON returns only the metadata, as there is no encrypted form of the key to serialize
+func (r *rawKeyFile) JSON() []byte {
+	b, _ := json.Marshal(r.metadata)
+	return b
+}
+
+func (r *rawKeyFile) GetID() *fftypes.UUID {
+	return nil
+}
+
+func (r *rawKeyFile) GetVersion() int {
+	return 0
+}
+
+func (r *rawKeyFile) Metadata() map[string]interface{} {
+	return r.metadata
+}
+
+// Reencrypt returns the key as an encrypted keystore V3 file, as an unencrypted key has no current password
+func (r *rawKeyFile) Reencrypt(newPassword string, options *keystorev3.KDFOptions) (keystorev3.WalletFile, error) {
+	keypair := r.KeyPair()
+	defer keypair.Destroy()
+	return keystorev3.NewWalletFileKDF(newPassword, keypair, options)
+}
@@ -0,0 +1,63 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// lookupByTemplate resolves the primary file for an address with the lookup template, checking the directories
+// in order of precedence. The file is resolved on every lookup, rather than from the index, as the directories
+// are not scanned or watched for keys being moved or removed. A key found for the first time is added to the
+// account list (and listeners notified), so the list contains the keys that have been used.
+func (w *fsWallet) lookupByTemplate(ctx context.Context, addr ethtypes.Address0xHex) (indexedFile, bool) {
+	buff := new(strings.Builder)
+	err := w.lookupTemplate.Execute(buff, map[string]string{
+		"address":   strings.TrimPrefix(addr.String(), "0x"),
+		"address0x": addr.String(),
+	})
+	if err != nil {
+		log.L(ctx).Errorf("Failed to execute %s for %s: %s", ConfigLookupTemplate, addr, err)
+		return indexedFile{}, false
+	}
+	filename := buff.String()
+	for i, d := range w.dirs {
+		fi, err := w.fs.Stat(path.Join(d.path, filename))
+		if err != nil || fi.IsDir() {
+			log.L(ctx).Tracef("Key for %s not found at '%s/%s'", addr, d.path, filename)
+			continue
+		}
+		file := indexedFile{dir: i, name: filename}
+		w.mux.Lock()
+		_, exists := w.addressToFileMap[addr]
+		w.addressToFileMap[addr] = file // so the password for the key is found relative to its directory
+		if !exists {
+			log.L(ctx).Debugf("Added address: %s (file=%s/%s)", addr, d.path, filename)
+			w.addressList = append(w.addressList, &addr)
+			w.metricsAccountCount(ctx)
+			w.queueNotifications(ctx, []*ethtypes.Address0xHex{&addr})
+		}
+		w.mux.Unlock()
+		return file, true
+	}
+	return indexedFile{}, false
+}
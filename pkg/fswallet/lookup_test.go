@@ -0,0 +1,185 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLookupWallet(t *testing.T, lookupTemplate string, extraDirs ...string) (context.Context, *fsWallet, string, chan ethtypes.Address0xHex, func()) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	dir := t.TempDir()
+	unitTestConfig.Set(ConfigPath, dir)
+	unitTestConfig.Set(ConfigFilenamesPrimaryExt, ".key")
+	unitTestConfig.Set(ConfigKeyFormat, KeyFormatHex)
+	unitTestConfig.Set(ConfigDisableListener, true)
+	unitTestConfig.Set(ConfigLookupTemplate, lookupTemplate)
+	conf := ReadConfig(unitTestConfig)
+	for _, d := range extraDirs {
+		conf.Directories = append(conf.Directories, DirectoryConfig{Path: d})
+	}
+	ctx := context.Background()
+
+	listener := make(chan ethtypes.Address0xHex, 1)
+	ff, err := NewFilesystemWallet(ctx, conf, listener)
+	assert.NoError(t, err)
+
+	return ctx, ff.(*fsWallet), dir, listener, func() {
+		ff.Close()
+	}
+}
+
+func TestLookupTemplateNoScan(t *testing.T) {
+
+	ctx, f, dir, listener, done := newTestLookupWallet(t, "{{ .address }}/private.hex")
+	defer done()
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	err = os.Mkdir(path.Join(dir, keypair.Address.String()[2:]), 0700)
+	assert.NoError(t, err)
+	writeTestHexKey(t, path.Join(dir, keypair.Address.String()[2:]), "private.hex", keypair)
+	// A file that would be indexed by a scan with the primaryExt
+	scanned, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	writeTestHexKey(t, dir, scanned.Address.String()[2:]+".key", scanned)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+	accounts, err := f.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, accounts)
+
+	wf, err := f.GetWalletFile(ctx, keypair.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), wf.PrivateKey())
+	assert.Equal(t, keypair.Address, <-listener)
+
+	// Looked up again after the cache is cleared, without being added to the list twice
+	f.InvalidateCache(ctx, keypair.Address)
+	_, err = f.GetWalletFile(ctx, keypair.Address)
+	assert.NoError(t, err)
+	accounts, err = f.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&keypair.Address}, accounts)
+
+	_, err = f.GetWalletFile(ctx, scanned.Address)
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestLookupTemplateDirectoryPrecedence(t *testing.T) {
+
+	dir2 := t.TempDir()
+	ctx, f, dir1, _, done := newTestLookupWallet(t, "{{ .address0x }}.key", dir2)
+	defer done()
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	writeTestHexKey(t, dir2, keypair.Address.String()+".key", keypair)
+
+	wf, err := f.GetWalletFile(ctx, keypair.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), wf.PrivateKey())
+	assert.Equal(t, dir2, f.dirForAddress(keypair.Address).path)
+
+	// The first directory takes precedence once the key is there
+	writeTestHexKey(t, dir1, keypair.Address.String()+".key", keypair)
+	f.InvalidateCache(ctx, keypair.Address)
+	_, err = f.GetWalletFile(ctx, keypair.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, dir1, f.dirForAddress(keypair.Address).path)
+
+}
+
+func TestLookupTemplateDirectoryNotFile(t *testing.T) {
+
+	ctx, f, dir, _, done := newTestLookupWallet(t, "{{ .address }}")
+	defer done()
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	err = os.Mkdir(path.Join(dir, keypair.Address.String()[2:]), 0700)
+	assert.NoError(t, err)
+
+	_, err = f.GetWalletFile(ctx, keypair.Address)
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestLookupTemplateBadTemplate(t *testing.T) {
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ConfigLookupTemplate, "{{ !wrong }}")
+	_, err := NewFilesystemWallet(context.Background(), ReadConfig(unitTestConfig))
+	assert.Regexp(t, "FF22016.*lookupTemplate", err)
+
+}
+
+func TestLookupTemplateExecuteFail(t *testing.T) {
+
+	ctx, f, _, _, done := newTestLookupWallet(t, "{{ .address.wrong }}")
+	defer done()
+
+	_, err := f.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestLookupTemplateListenerDoesNotIndex(t *testing.T) {
+
+	ctx, f, dir, _, done := newTestLookupWallet(t, "{{ .address }}.key")
+	defer done()
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	filename := path.Join(dir, keypair.Address.String()[2:]+".key")
+	writeTestHexKey(t, dir, keypair.Address.String()[2:]+".key", keypair)
+
+	lCtx, cancel := context.WithCancel(ctx)
+	events := make(chan fsnotify.Event)
+	loopDone := make(chan error)
+	go func() { loopDone <- f.fsListenerLoop(lCtx, events, make(chan error)) }()
+	events <- fsnotify.Event{Name: filename, Op: fsnotify.Create}
+	events <- fsnotify.Event{Name: filename, Op: fsnotify.Write}
+	cancel()
+	select {
+	case err := <-loopDone:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "listener did not exit")
+	}
+
+	count, err := f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+}
@@ -0,0 +1,128 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+// MasterKeyLength is the length of the AES-256 master key used to encrypt password files
+const MasterKeyLength = 32
+
+// ReadMasterKey returns nil if password encryption is not configured. Otherwise it reads the hex
+// encoded master key from the configured file or environment variable.
+func ReadMasterKey(ctx context.Context, conf *PasswordEncryptionConfig) ([]byte, error) {
+	var source, keyString string
+	switch {
+	case conf.MasterKeyFile != "" && conf.MasterKeyEnv != "":
+		return nil, i18n.NewError(ctx, signermsgs.MsgMasterKeyConfigConflict, ConfigPasswordEncryptionMasterKeyFile, ConfigPasswordEncryptionMasterKeyEnv)
+	case conf.MasterKeyFile != "":
+		source = conf.MasterKeyFile
+		b, err := os.ReadFile(conf.MasterKeyFile)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgMasterKeyNotAvailable, source, err)
+		}
+		keyString = string(b)
+	case conf.MasterKeyEnv != "":
+		source = conf.MasterKeyEnv
+		var ok bool
+		if keyString, ok = os.LookupEnv(conf.MasterKeyEnv); !ok {
+			return nil, i18n.NewError(ctx, signermsgs.MsgMasterKeyNotAvailable, source, "not set")
+		}
+	default:
+		return nil, nil
+	}
+	masterKey, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(keyString), "0x"))
+	if err != nil || len(masterKey) != MasterKeyLength {
+		return nil, i18n.NewError(ctx, signermsgs.MsgMasterKeyInvalid, source, MasterKeyLength)
+	}
+	return masterKey, nil
+}
+
+// newPasswordCipherFromConfig returns nil if password encryption is not configured. The master key
+// itself is not retained once the cipher is initialized.
+func newPasswordCipherFromConfig(ctx context.Context, conf *PasswordEncryptionConfig) (cipher.AEAD, error) {
+	masterKey, err := ReadMasterKey(ctx, conf)
+	if err != nil || masterKey == nil {
+		return nil, err
+	}
+	defer zeroBytes(masterKey)
+	return newPasswordCipher(masterKey)
+}
+
+func newPasswordCipher(masterKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// EncryptPassword encrypts a password with AES-256-GCM under the master key, returning the base64
+// encoded nonce and ciphertext - the format of a password file when password encryption is configured
+func EncryptPassword(masterKey, password []byte) (string, error) {
+	aead, err := newPasswordCipher(masterKey)
+	if err != nil {
+		return "", err
+	}
+	return sealPassword(aead, password)
+}
+
+// sealPassword encrypts a password in the format written by EncryptPassword
+func sealPassword(aead cipher.AEAD, password []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, password, nil)), nil
+}
+
+// decryptPassword decrypts the contents of a password file written by EncryptPassword. Surrounding
+// whitespace (such as a trailing newline) is ignored.
+func decryptPassword(ctx context.Context, aead cipher.AEAD, filename string, fileContent []byte) ([]byte, error) {
+	if password, ok := openPassword(aead, fileContent); ok {
+		return password, nil
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgPasswordDecryptFailed, filename)
+}
+
+// openPassword decrypts a password in the format written by EncryptPassword, whether read from a
+// password file or inline from a metadata file
+func openPassword(aead cipher.AEAD, encrypted []byte) ([]byte, bool) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encrypted)))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, false
+	}
+	password, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	return password, err == nil
+}
@@ -0,0 +1,332 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMasterKey(t *testing.T) ([]byte, string) {
+	masterKey := make([]byte, MasterKeyLength)
+	_, err := rand.Read(masterKey)
+	assert.NoError(t, err)
+	masterKeyFile := path.Join(t.TempDir(), "master.key")
+	err = os.WriteFile(masterKeyFile, []byte(hex.EncodeToString(masterKey)+"\n"), 0600)
+	assert.NoError(t, err)
+	return masterKey, masterKeyFile
+}
+
+func newTestEncryptedPasswordWallet(t *testing.T, masterKeyFile string) (context.Context, *fsWallet, string, func()) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	dir := t.TempDir()
+	keyFile, err := os.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json")
+	assert.NoError(t, err)
+	err = os.WriteFile(path.Join(dir, "1f185718734552d08278aa70f804580bab5fd2b4.key.json"), keyFile, 0600)
+	assert.NoError(t, err)
+	unitTestConfig.Set(ConfigPath, dir)
+	unitTestConfig.Set(ConfigFilenamesPrimaryExt, ".key.json")
+	unitTestConfig.Set(ConfigFilenamesPasswordExt, ".pwd")
+	unitTestConfig.Set(ConfigPasswordEncryptionMasterKeyFile, masterKeyFile)
+	unitTestConfig.Set(ConfigDisableListener, true)
+	ctx := context.Background()
+
+	ff, err := NewFilesystemWallet(ctx, ReadConfig(unitTestConfig))
+	assert.NoError(t, err)
+	err = ff.Initialize(ctx)
+	assert.NoError(t, err)
+
+	return ctx, ff.(*fsWallet), dir, func() {
+		ff.Close()
+	}
+}
+
+func TestEncryptedPasswordFile(t *testing.T) {
+
+	masterKey, masterKeyFile := newTestMasterKey(t)
+	ctx, f, dir, done := newTestEncryptedPasswordWallet(t, masterKeyFile)
+	defer done()
+
+	password, err := os.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.pwd")
+	assert.NoError(t, err)
+	encrypted, err := EncryptPassword(masterKey, password)
+	assert.NoError(t, err)
+	err = os.WriteFile(path.Join(dir, "1f185718734552d08278aa70f804580bab5fd2b4.pwd"), []byte(encrypted+"\n"), 0600)
+	assert.NoError(t, err)
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	wf, err := f.GetWalletFile(ctx, addr)
+	assert.NoError(t, err)
+	assert.Equal(t, addr, wf.KeyPair().Address)
+
+}
+
+func TestEncryptedDefaultPasswordFile(t *testing.T) {
+
+	masterKey, masterKeyFile := newTestMasterKey(t)
+	ctx, f, dir, done := newTestEncryptedPasswordWallet(t, masterKeyFile)
+	defer done()
+
+	password, err := os.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.pwd")
+	assert.NoError(t, err)
+	encrypted, err := EncryptPassword(masterKey, password)
+	assert.NoError(t, err)
+	f.conf.DefaultPasswordFile = path.Join(dir, "default.pwd")
+	err = os.WriteFile(f.conf.DefaultPasswordFile, []byte(encrypted), 0600)
+	assert.NoError(t, err)
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	decrypted, err := f.passwordProvider.GetPassword(ctx, addr, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, password, decrypted)
+
+	err = os.WriteFile(f.conf.DefaultPasswordFile, password, 0600)
+	assert.NoError(t, err)
+	_, err = f.passwordProvider.GetPassword(ctx, addr, nil)
+	assert.Regexp(t, "FF22130", err)
+
+}
+
+func TestEncryptedPasswordFileWrongKey(t *testing.T) {
+
+	_, masterKeyFile := newTestMasterKey(t)
+	ctx, f, dir, done := newTestEncryptedPasswordWallet(t, masterKeyFile)
+	defer done()
+
+	otherKey, _ := newTestMasterKey(t)
+	encrypted, err := EncryptPassword(otherKey, []byte("correcthorsebatterystaple"))
+	assert.NoError(t, err)
+	err = os.WriteFile(path.Join(dir, "1f185718734552d08278aa70f804580bab5fd2b4.pwd"), []byte(encrypted), 0600)
+	assert.NoError(t, err)
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	_, err = f.passwordProvider.GetPassword(ctx, addr, nil)
+	assert.Regexp(t, "FF22130", err)
+	_, err = f.GetWalletFile(ctx, addr)
+	assert.Regexp(t, "FF22015", err)
+
+}
+
+func TestEncryptedPasswordFilePlaintext(t *testing.T) {
+
+	_, masterKeyFile := newTestMasterKey(t)
+	ctx, f, dir, done := newTestEncryptedPasswordWallet(t, masterKeyFile)
+	defer done()
+
+	for _, content := range []string{"not base64!", "c2hvcnQ="} {
+		err := os.WriteFile(path.Join(dir, "1f185718734552d08278aa70f804580bab5fd2b4.pwd"), []byte(content), 0600)
+		assert.NoError(t, err)
+		_, err = f.passwordProvider.GetPassword(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"), nil)
+		assert.Regexp(t, "FF22130", err)
+	}
+
+}
+
+func TestReadMasterKeyEnv(t *testing.T) {
+
+	masterKey, _ := newTestMasterKey(t)
+	t.Setenv("UT_MASTER_KEY", "0x"+hex.EncodeToString(masterKey))
+	readKey, err := ReadMasterKey(context.Background(), &PasswordEncryptionConfig{MasterKeyEnv: "UT_MASTER_KEY"})
+	assert.NoError(t, err)
+	assert.Equal(t, masterKey, readKey)
+
+}
+
+func TestReadMasterKeyNotConfigured(t *testing.T) {
+
+	readKey, err := ReadMasterKey(context.Background(), &PasswordEncryptionConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, readKey)
+
+}
+
+func TestReadMasterKeyErrors(t *testing.T) {
+
+	ctx := context.Background()
+	badKeyFile := path.Join(t.TempDir(), "bad.key")
+	err := os.WriteFile(badKeyFile, []byte("abcd"), 0600)
+	assert.NoError(t, err)
+
+	_, err = ReadMasterKey(ctx, &PasswordEncryptionConfig{MasterKeyFile: "file", MasterKeyEnv: "ENV"})
+	assert.Regexp(t, "FF22127", err)
+	_, err = ReadMasterKey(ctx, &PasswordEncryptionConfig{MasterKeyFile: path.Join(t.TempDir(), "missing")})
+	assert.Regexp(t, "FF22128", err)
+	_, err = ReadMasterKey(ctx, &PasswordEncryptionConfig{MasterKeyEnv: "UT_MASTER_KEY_NOT_SET"})
+	assert.Regexp(t, "FF22128", err)
+	_, err = ReadMasterKey(ctx, &PasswordEncryptionConfig{MasterKeyFile: badKeyFile})
+	assert.Regexp(t, "FF22129", err)
+
+}
+
+func TestPasswordEncryptionBadConfig(t *testing.T) {
+
+	ctx := context.Background()
+	_, masterKeyFile := newTestMasterKey(t)
+
+	_, err := NewFilesystemWallet(ctx, &Config{
+		PasswordEncryption: PasswordEncryptionConfig{MasterKeyFile: masterKeyFile},
+		PasswordProvider:   PasswordProviderConfig{Type: PasswordProviderEnv},
+	})
+	assert.Regexp(t, "FF22131", err)
+
+	_, err = NewFilesystemWallet(ctx, &Config{
+		PasswordEncryption: PasswordEncryptionConfig{MasterKeyEnv: "UT_MASTER_KEY_NOT_SET"},
+	})
+	assert.Regexp(t, "FF22128", err)
+
+}
+
+func TestEncryptPasswordBadKey(t *testing.T) {
+
+	_, err := EncryptPassword([]byte("short"), []byte("password"))
+	assert.Error(t, err)
+
+}
+
+func newTestInlinePasswordWallet(t *testing.T, masterKeyFile, encryptedPassword string) (context.Context, *fsWallet, error) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	dir := t.TempDir()
+	keyFile, err := filepath.Abs("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json")
+	assert.NoError(t, err)
+	passwordFile, err := filepath.Abs("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.pwd")
+	assert.NoError(t, err)
+	metadata := fmt.Sprintf("[signing]\nkey-file = %q\npassword-file = %q\n", keyFile, passwordFile)
+	if encryptedPassword != "" {
+		metadata += fmt.Sprintf("password = %q\n", encryptedPassword)
+	}
+	err = os.WriteFile(path.Join(dir, "1f185718734552d08278aa70f804580bab5fd2b4.toml"), []byte(metadata), 0600)
+	assert.NoError(t, err)
+	unitTestConfig.Set(ConfigPath, dir)
+	unitTestConfig.Set(ConfigFilenamesPrimaryExt, ".toml")
+	unitTestConfig.Set(ConfigMetadataKeyFileProperty, `{{ index .signing "key-file" }}`)
+	unitTestConfig.Set(ConfigMetadataEncryptedPasswordProperty, `{{ index .signing "password" }}`)
+	unitTestConfig.Set(ConfigPasswordEncryptionMasterKeyFile, masterKeyFile)
+	unitTestConfig.Set(ConfigDisableListener, true)
+	ctx := context.Background()
+
+	ff, err := NewFilesystemWallet(ctx, ReadConfig(unitTestConfig))
+	if err != nil {
+		return ctx, nil, err
+	}
+	t.Cleanup(func() { ff.Close() })
+	return ctx, ff.(*fsWallet), ff.Initialize(ctx)
+}
+
+func TestInlineEncryptedPassword(t *testing.T) {
+
+	masterKey, masterKeyFile := newTestMasterKey(t)
+	encrypted, err := EncryptPassword(masterKey, []byte("correcthorsebatterystaple"))
+	assert.NoError(t, err)
+	ctx, f, err := newTestInlinePasswordWallet(t, masterKeyFile, encrypted)
+	assert.NoError(t, err)
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	wf, err := f.GetWalletFile(ctx, addr)
+	assert.NoError(t, err)
+	assert.Equal(t, addr, wf.KeyPair().Address)
+
+}
+
+func TestInlineEncryptedPasswordWrongKey(t *testing.T) {
+
+	_, masterKeyFile := newTestMasterKey(t)
+	otherKey, _ := newTestMasterKey(t)
+	encrypted, err := EncryptPassword(otherKey, []byte("correcthorsebatterystaple"))
+	assert.NoError(t, err)
+	ctx, f, err := newTestInlinePasswordWallet(t, masterKeyFile, encrypted)
+	assert.NoError(t, err)
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	_, err = f.passwordProvider.GetPassword(ctx, addr, map[string]interface{}{
+		"signing": map[string]interface{}{"password": encrypted},
+	})
+	assert.Regexp(t, "FF22163", err)
+
+}
+
+func TestInlineEncryptedPasswordFallbackToPasswordFile(t *testing.T) {
+
+	masterKey, masterKeyFile := newTestMasterKey(t)
+	ctx, f, err := newTestInlinePasswordWallet(t, masterKeyFile, "")
+	assert.NoError(t, err)
+
+	// Without an inline password, the password file from the metadata is used - encrypted under the master key
+	dir := t.TempDir()
+	encrypted, err := EncryptPassword(masterKey, []byte("correcthorsebatterystaple"))
+	assert.NoError(t, err)
+	err = os.WriteFile(path.Join(dir, "password.enc"), []byte(encrypted), 0600)
+	assert.NoError(t, err)
+	f.metadataPasswordFileProperty, err = goTemplateFromConfig(ctx, ConfigMetadataPasswordFileProperty, `{{ index .signing "password-file" }}`)
+	assert.NoError(t, err)
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	password, err := f.passwordProvider.GetPassword(ctx, addr, map[string]interface{}{
+		"signing": map[string]interface{}{"password-file": path.Join(dir, "password.enc")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "correcthorsebatterystaple", string(password))
+
+}
+
+func TestInlineEncryptedPasswordNoMasterKey(t *testing.T) {
+
+	_, _, err := newTestInlinePasswordWallet(t, "", "")
+	assert.Regexp(t, "FF22162", err)
+
+}
+
+func TestInlineEncryptedPasswordNoMasterKeyAfterReload(t *testing.T) {
+
+	ctx := context.Background()
+	f := &fsWallet{conf: Config{Path: t.TempDir()}}
+	f.dirs = []*walletDir{{path: f.conf.Path}}
+	f.metadataEncryptedPasswordProperty, _ = goTemplateFromConfig(ctx, ConfigMetadataEncryptedPasswordProperty, `{{ .password }}`)
+	pp := &filePasswordProvider{w: f}
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	_, err := pp.GetPassword(ctx, addr, map[string]interface{}{"password": "abc"})
+	assert.Regexp(t, "FF22162", err)
+
+}
+
+func TestInlineEncryptedPasswordBadTemplate(t *testing.T) {
+
+	ctx := context.Background()
+	f := &fsWallet{conf: Config{Path: t.TempDir()}}
+	f.dirs = []*walletDir{{path: f.conf.Path}}
+	f.metadataEncryptedPasswordProperty, _ = goTemplateFromConfig(ctx, ConfigMetadataEncryptedPasswordProperty, `{{ index .password 1 }}`)
+	pp := &filePasswordProvider{w: f}
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	_, err := pp.GetPassword(ctx, addr, map[string]interface{}{"password": 12345})
+	assert.Regexp(t, "FF22015", err)
+
+}
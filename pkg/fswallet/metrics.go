@@ -0,0 +1,139 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/metric"
+)
+
+const (
+	// MetricsSubsystem is the subsystem name under which all wallet metrics are registered
+	MetricsSubsystem = "fswallet"
+
+	metricSignerCacheHits   = "signer_cache_hits_total"
+	metricSignerCacheMisses = "signer_cache_misses_total"
+	metricDecryptDuration   = "decrypt_duration_seconds"
+	metricAccounts          = "accounts"
+	metricListenerEvents    = "listener_events_total"
+	metricListenerRestarts  = "listener_restarts_total"
+	metricListenerHealthy   = "listener_healthy"
+	metricNotifyDropped     = "notifications_dropped_total"
+
+	metricLabelOperation = "operation"
+	metricLabelOutcome   = "outcome"
+
+	metricOutcomeSuccess = "success"
+	metricOutcomeFailure = "failure"
+)
+
+// Keystore decryption is dominated by the KDF, which is tuned to take somewhere between
+// milliseconds (light) and seconds (standard) per key
+var decryptDurationBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// RegisterMetrics creates the wallet metrics in a new subsystem of the supplied registry, after
+// which the metrics are recorded. Must be called before Initialize. The embedding server is
+// responsible for serving the registry.
+func (w *fsWallet) RegisterMetrics(ctx context.Context, registry metric.MetricsRegistry) error {
+	mm, err := registry.NewMetricsManagerForSubsystem(ctx, MetricsSubsystem)
+	if err != nil {
+		return err
+	}
+	mm.NewCounterMetric(ctx, metricSignerCacheHits, "Number of signing key lookups served from the in-memory cache", false)
+	mm.NewCounterMetric(ctx, metricSignerCacheMisses, "Number of signing key lookups that required the keystore to be loaded", false)
+	mm.NewHistogramMetricWithLabels(ctx, metricDecryptDuration, "Time taken to decrypt a keystore file, by outcome (a wrong password still pays the full KDF cost)", decryptDurationBuckets, []string{metricLabelOutcome}, false)
+	mm.NewGaugeMetric(ctx, metricAccounts, "Number of accounts known to the wallet", false)
+	mm.NewCounterMetricWithLabels(ctx, metricListenerEvents, "Number of filesystem listener events processed", []string{metricLabelOperation}, false)
+	mm.NewCounterMetric(ctx, metricListenerRestarts, "Number of times the filesystem listener has been re-established after failing", false)
+	mm.NewCounterMetric(ctx, metricNotifyDropped, "Number of new address notifications dropped because a listener was not keeping up", false)
+	mm.NewGaugeMetric(ctx, metricListenerHealthy, "1 if the filesystem listener is running, 0 if it has failed and is being re-established", false)
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.metrics.Store(&mm)
+	mm.SetGaugeMetric(ctx, metricAccounts, float64(len(w.addressList)), nil)
+	return nil
+}
+
+// metricsManager returns the registered metrics manager, or nil. Safe to call from any go-routine,
+// with or without the mux held, as metrics might be registered while the wallet is in use
+func (w *fsWallet) metricsManager() metric.MetricsManager {
+	if mm := w.metrics.Load(); mm != nil {
+		return *mm
+	}
+	return nil
+}
+
+func (w *fsWallet) metricsCacheLookup(ctx context.Context, hit bool) {
+	if mm := w.metricsManager(); mm != nil {
+		if hit {
+			mm.IncCounterMetric(ctx, metricSignerCacheHits, nil)
+		} else {
+			mm.IncCounterMetric(ctx, metricSignerCacheMisses, nil)
+		}
+	}
+}
+
+func (w *fsWallet) metricsDecrypted(ctx context.Context, startTime time.Time, success bool) {
+	if mm := w.metricsManager(); mm != nil {
+		outcome := metricOutcomeSuccess
+		if !success {
+			outcome = metricOutcomeFailure
+		}
+		mm.ObserveHistogramMetricWithLabels(ctx, metricDecryptDuration, time.Since(startTime).Seconds(), map[string]string{metricLabelOutcome: outcome}, nil)
+	}
+}
+
+// must be called holding the mux
+func (w *fsWallet) metricsAccountCount(ctx context.Context) {
+	if mm := w.metricsManager(); mm != nil {
+		mm.SetGaugeMetric(ctx, metricAccounts, float64(len(w.addressList)), nil)
+	}
+}
+
+func (w *fsWallet) metricsListenerEvent(ctx context.Context, operation string) {
+	if mm := w.metricsManager(); mm != nil {
+		mm.IncCounterMetricWithLabels(ctx, metricListenerEvents, map[string]string{metricLabelOperation: operation}, nil)
+	}
+}
+
+func (w *fsWallet) metricsListenerRestart(ctx context.Context) {
+	if mm := w.metricsManager(); mm != nil {
+		mm.IncCounterMetric(ctx, metricListenerRestarts, nil)
+	}
+}
+
+// must be called holding the mux
+func (w *fsWallet) metricsListenerHealthy(ctx context.Context, healthy bool) {
+	if mm := w.metricsManager(); mm != nil {
+		v := 0.0
+		if healthy {
+			v = 1
+		}
+		mm.SetGaugeMetric(ctx, metricListenerHealthy, v, nil)
+	}
+}
+
+func (w *fsWallet) metricsNotifyDropped(ctx context.Context, dropped int) {
+	if mm := w.metricsManager(); mm != nil {
+		for i := 0; i < dropped; i++ {
+			mm.IncCounterMetric(ctx, metricNotifyDropped, nil)
+		}
+	}
+}
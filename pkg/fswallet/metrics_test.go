@@ -0,0 +1,131 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrapeMetrics(t *testing.T, registry metric.MetricsRegistry) string {
+	handler, err := registry.HTTPHandler(context.Background(), promhttp.HandlerOpts{})
+	assert.NoError(t, err)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	b, err := io.ReadAll(rec.Result().Body)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestWalletMetrics(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, false)
+	defer done()
+
+	registry := metric.NewPrometheusMetricsRegistry("ut")
+	err := f.RegisterMetrics(ctx, registry)
+	assert.NoError(t, err)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+	_, err = f.GetWalletFile(ctx, addr)
+	assert.NoError(t, err)
+	_, err = f.GetWalletFile(ctx, addr)
+	assert.NoError(t, err)
+	f.metricsListenerEvent(ctx, "CREATE")
+
+	scraped := scrapeMetrics(t, registry)
+	assert.Regexp(t, `ff_fswallet_accounts\{.*\} 3`, scraped)
+	assert.Regexp(t, `ff_fswallet_signer_cache_hits_total\{.*\} 1`, scraped)
+	assert.Regexp(t, `ff_fswallet_signer_cache_misses_total\{.*\} 1`, scraped)
+	assert.Regexp(t, `ff_fswallet_decrypt_duration_seconds_count\{.*outcome="success".*\} 1`, scraped)
+	assert.NotRegexp(t, `outcome="failure"`, scraped)
+	assert.Regexp(t, `ff_fswallet_listener_events_total\{.*operation="CREATE".*\} 1`, scraped)
+
+}
+
+func TestWalletMetricsDuplicateRegistration(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, false)
+	defer done()
+
+	registry := metric.NewPrometheusMetricsRegistry("ut")
+	err := f.RegisterMetrics(ctx, registry)
+	assert.NoError(t, err)
+	err = f.RegisterMetrics(ctx, registry)
+	assert.Regexp(t, "FF00", err)
+
+}
+
+func TestWalletMetricsDecryptFailure(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, false)
+	defer done()
+	f.passwordProvider = &testPasswordProvider{password: []byte("wrong")}
+
+	registry := metric.NewPrometheusMetricsRegistry("ut")
+	err := f.RegisterMetrics(ctx, registry)
+	assert.NoError(t, err)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	_, err = f.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.Regexp(t, "FF22015", err)
+
+	scraped := scrapeMetrics(t, registry)
+	assert.Regexp(t, `ff_fswallet_decrypt_duration_seconds_count\{.*outcome="failure".*\} 1`, scraped)
+	assert.NotRegexp(t, `outcome="success"`, scraped)
+
+}
+
+func TestWalletMetricsRegisterWhileInUse(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, false)
+	defer done()
+
+	stop := make(chan struct{})
+	recorderDone := make(chan struct{})
+	go func() {
+		defer close(recorderDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				f.metricsCacheLookup(ctx, true)
+				f.metricsListenerRestart(ctx)
+			}
+		}
+	}()
+
+	registry := metric.NewPrometheusMetricsRegistry("ut")
+	err := f.RegisterMetrics(ctx, registry)
+	assert.NoError(t, err)
+	close(stop)
+	<-recorderDone
+
+}
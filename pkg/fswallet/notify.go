@@ -0,0 +1,165 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+const (
+	// NotifyOverflowDropOldest drops the oldest queued notifications for a listener that is not keeping up (default)
+	NotifyOverflowDropOldest = "dropOldest"
+	// NotifyOverflowDisconnect removes a listener that is not keeping up, closing its channel
+	NotifyOverflowDisconnect = "disconnect"
+)
+
+func validateNotifyOverflow(ctx context.Context, notifyOverflow string) error {
+	switch notifyOverflow {
+	case NotifyOverflowDropOldest, NotifyOverflowDisconnect:
+		return nil
+	default:
+		return i18n.NewError(ctx, signermsgs.MsgUnknownNotifyOverflow, notifyOverflow)
+	}
+}
+
+// addressListener is a registered listener channel, with its own bounded queue of pending notifications
+// and dispatcher go-routine - so a slow (or stopped) consumer only delays its own notifications
+type addressListener struct {
+	ch             chan<- ethtypes.Address0xHex
+	queue          []ethtypes.Address0xHex // guarded by the wallet mux
+	dispatching    bool                    // guarded by the wallet mux
+	dispatcherDone chan struct{}           // closed when the current dispatcher exits - guarded by the wallet mux
+	removed        chan struct{}           // closed when the listener is removed, to stop a blocked dispatcher
+	closeOnRemove  bool                    // guarded by the wallet mux - the channel is closed once no dispatcher is sending to it
+}
+
+// must be called holding the mux
+func (w *fsWallet) addListener(ch chan<- ethtypes.Address0xHex) {
+	w.listeners = append(w.listeners, &addressListener{ch: ch, removed: make(chan struct{})})
+}
+
+// RemoveListener stops notifications to a channel registered with AddListener, discarding any that are queued.
+// Once it returns, nothing more is sent to the channel. The channel is not closed.
+func (w *fsWallet) RemoveListener(ch chan<- ethtypes.Address0xHex) {
+	w.mux.Lock()
+	var waitFor []chan struct{}
+	for _, l := range w.listeners {
+		if l.ch == ch {
+			if l.dispatching {
+				waitFor = append(waitFor, l.dispatcherDone)
+			}
+			w.removeListener(l, false)
+		}
+	}
+	w.mux.Unlock()
+	for _, dispatcherDone := range waitFor {
+		<-dispatcherDone
+	}
+}
+
+// removeListener removes the listener and discards its queue. If closeChannel is set the channel is closed,
+// by the dispatcher if one is running (as it might be blocked sending to it).
+//
+// must be called holding the mux
+func (w *fsWallet) removeListener(l *addressListener, closeChannel bool) {
+	listeners := make([]*addressListener, 0, len(w.listeners))
+	for _, other := range w.listeners {
+		if other != l {
+			listeners = append(listeners, other)
+		}
+	}
+	w.listeners = listeners
+	l.queue = nil
+	close(l.removed)
+	l.closeOnRemove = closeChannel
+	if closeChannel && !l.dispatching {
+		close(l.ch)
+	}
+}
+
+// queueNotifications adds the addresses to the queue of every listener, in order, and starts the
+// dispatcher for any listener that does not have one running. If a listener's queue is full, the
+// notifyOverflow policy either drops the oldest notifications or disconnects the listener, rather than
+// blocking indexing (and all other listeners).
+//
+// must be called holding the mux
+func (w *fsWallet) queueNotifications(ctx context.Context, addresses []*ethtypes.Address0xHex) {
+	if len(addresses) == 0 {
+		return
+	}
+	for _, l := range w.listeners {
+		for _, addr := range addresses {
+			l.queue = append(l.queue, *addr)
+		}
+		if dropped := len(l.queue) - w.conf.NotifyQueueSize; dropped > 0 {
+			if w.conf.NotifyOverflow == NotifyOverflowDisconnect {
+				log.L(ctx).Warnf("Listener is not keeping up with new address notifications. Disconnected with %d queued", len(l.queue))
+				w.metricsNotifyDropped(ctx, len(l.queue))
+				w.removeListener(l, true)
+				continue
+			}
+			log.L(ctx).Warnf("Listener is not keeping up with new address notifications. Dropped %d oldest", dropped)
+			l.queue = append(l.queue[:0], l.queue[dropped:]...)
+			w.metricsNotifyDropped(ctx, dropped)
+		}
+		if !l.dispatching {
+			l.dispatching = true
+			l.dispatcherDone = make(chan struct{})
+			go w.dispatchNotifications(l)
+		}
+	}
+}
+
+// dispatchNotifications delivers the queued notifications for one listener, until its queue is empty,
+// the listener is removed, or the wallet is closed
+func (w *fsWallet) dispatchNotifications(l *addressListener) {
+	for {
+		w.mux.Lock()
+		if len(l.queue) == 0 {
+			w.endDispatch(l)
+			w.mux.Unlock()
+			return
+		}
+		addr := l.queue[0]
+		l.queue = l.queue[1:]
+		w.mux.Unlock()
+
+		select {
+		case l.ch <- addr:
+		case <-l.removed:
+		case <-w.notifyCtx.Done():
+			w.mux.Lock()
+			w.endDispatch(l)
+			w.mux.Unlock()
+			return
+		}
+	}
+}
+
+// must be called holding the mux
+func (w *fsWallet) endDispatch(l *addressListener) {
+	l.dispatching = false
+	if l.closeOnRemove {
+		close(l.ch)
+	}
+	close(l.dispatcherDone)
+}
@@ -0,0 +1,210 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAddresses(start, count int) []*ethtypes.Address0xHex {
+	addrs := make([]*ethtypes.Address0xHex, count)
+	for i := range addrs {
+		addrs[i] = ethtypes.MustNewAddress(fmt.Sprintf("0x%040x", start+i))
+	}
+	return addrs
+}
+
+func TestSlowListenerDoesNotBlockOthers(t *testing.T) {
+
+	ctx, f, listener1, done := newEmptyWalletTestDir(t, false)
+	defer done()
+
+	// A second listener that never reads
+	f.AddListener(make(chan ethtypes.Address0xHex))
+
+	f.mux.Lock()
+	f.queueNotifications(ctx, testAddresses(1, 10))
+	f.mux.Unlock()
+
+	for i := 1; i <= 10; i++ {
+		assert.Equal(t, fmt.Sprintf("0x%040x", i), (<-listener1).String())
+	}
+
+}
+
+func TestSlowListenerDropsOldest(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	defer done()
+	f.conf.NotifyQueueSize = 3
+
+	registry := metric.NewPrometheusMetricsRegistry("ut")
+	err := f.RegisterMetrics(ctx, registry)
+	assert.NoError(t, err)
+
+	// Replace the listeners with one that is not being read, and block its dispatcher
+	listener := make(chan ethtypes.Address0xHex)
+	f.listeners = nil
+	f.addListener(listener)
+	f.listeners[0].dispatching = true
+
+	f.mux.Lock()
+	f.queueNotifications(ctx, testAddresses(1, 2))
+	f.queueNotifications(ctx, testAddresses(3, 3))
+	f.queueNotifications(ctx, nil)
+	assert.Len(t, f.listeners[0].queue, 3)
+	f.listeners[0].dispatching = false
+	f.queueNotifications(ctx, testAddresses(6, 1))
+	f.mux.Unlock()
+
+	// Only the latest are delivered, in order
+	for i := 4; i <= 6; i++ {
+		assert.Equal(t, fmt.Sprintf("0x%040x", i), (<-listener).String())
+	}
+	assert.Regexp(t, `ff_fswallet_notifications_dropped_total\{.*\} 3`, scrapeMetrics(t, registry))
+
+}
+
+func TestCloseStopsBlockedDispatcher(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	defer done()
+
+	f.listeners = nil
+	f.AddListener(make(chan ethtypes.Address0xHex))
+
+	f.mux.Lock()
+	f.queueNotifications(ctx, testAddresses(1, 2))
+	f.mux.Unlock()
+
+	err := f.Close()
+	assert.NoError(t, err)
+
+	for {
+		f.mux.Lock()
+		dispatching := f.listeners[0].dispatching
+		f.mux.Unlock()
+		if !dispatching {
+			break
+		}
+	}
+
+}
+
+func TestRemoveListener(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	defer done()
+
+	f.listeners = nil
+	listener := make(chan ethtypes.Address0xHex)
+	f.AddListener(listener)
+
+	// The dispatcher is blocked sending to the listener, until it is removed
+	f.mux.Lock()
+	f.queueNotifications(ctx, testAddresses(1, 2))
+	f.mux.Unlock()
+	f.RemoveListener(listener)
+	assert.Empty(t, f.listeners)
+
+	f.mux.Lock()
+	f.queueNotifications(ctx, testAddresses(3, 1))
+	f.mux.Unlock()
+	select {
+	case addr, ok := <-listener:
+		assert.Fail(t, "unexpected notification", "%s %t", addr, ok)
+	default:
+	}
+
+	// Safe to remove again
+	f.RemoveListener(listener)
+
+}
+
+func TestRemoveListenerNotDispatching(t *testing.T) {
+
+	_, f, listener, done := newEmptyWalletTestDir(t, false)
+	defer done()
+
+	f.RemoveListener(listener)
+	assert.Empty(t, f.listeners)
+
+}
+
+func TestSlowListenerDisconnected(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	defer done()
+	f.conf.NotifyQueueSize = 3
+	f.conf.NotifyOverflow = NotifyOverflowDisconnect
+
+	registry := metric.NewPrometheusMetricsRegistry("ut")
+	err := f.RegisterMetrics(ctx, registry)
+	assert.NoError(t, err)
+
+	listener := make(chan ethtypes.Address0xHex)
+	f.listeners = nil
+	f.AddListener(listener)
+
+	// The dispatcher cannot take any from the queue while the mux is held, so all overflow the queue
+	f.mux.Lock()
+	f.queueNotifications(ctx, testAddresses(1, 2))
+	f.queueNotifications(ctx, testAddresses(3, 3))
+	f.mux.Unlock()
+	assert.Empty(t, f.listeners)
+
+	// The channel is closed once the dispatcher exits
+	for range listener {
+	}
+	assert.Regexp(t, `ff_fswallet_notifications_dropped_total\{.*\} 5`, scrapeMetrics(t, registry))
+
+}
+
+func TestSlowListenerDisconnectedNotDispatching(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	defer done()
+	f.conf.NotifyQueueSize = 1
+	f.conf.NotifyOverflow = NotifyOverflowDisconnect
+
+	listener := make(chan ethtypes.Address0xHex)
+	f.listeners = nil
+	f.AddListener(listener)
+
+	f.mux.Lock()
+	f.queueNotifications(ctx, testAddresses(1, 2))
+	f.mux.Unlock()
+	_, ok := <-listener
+	assert.False(t, ok)
+
+}
+
+func TestBadNotifyOverflow(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	done()
+	conf := f.conf
+	conf.NotifyOverflow = "wrong"
+	_, err := NewFilesystemWallet(ctx, &conf)
+	assert.Regexp(t, "FF22150", err)
+
+}
@@ -0,0 +1,246 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+const (
+	// PasswordProviderFile reads passwords from files on disk, located via metadata or filename conventions (default)
+	PasswordProviderFile = "file"
+	// PasswordProviderEnv reads passwords from environment variables
+	PasswordProviderEnv = "env"
+	// PasswordProviderExec runs an external command, and uses its output as the password
+	PasswordProviderExec = "exec"
+)
+
+// PasswordProvider is called by the wallet to obtain the password to decrypt the keystore for an address.
+// The metadata is the parsed metadata file for the key, or nil if the key has no metadata file.
+type PasswordProvider interface {
+	GetPassword(ctx context.Context, addr ethtypes.Address0xHex, metadata map[string]interface{}) ([]byte, error)
+}
+
+func newPasswordProviderFromConfig(ctx context.Context, w *fsWallet) (PasswordProvider, error) {
+	passwordCipher, err := newPasswordCipherFromConfig(ctx, &w.conf.PasswordEncryption)
+	if err != nil {
+		return nil, err
+	}
+	if passwordCipher != nil && w.conf.PasswordProvider.Type != "" && w.conf.PasswordProvider.Type != PasswordProviderFile {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPasswordEncryptionProvider, PasswordProviderFile)
+	}
+	if passwordCipher == nil && w.conf.Metadata.EncryptedPasswordProperty != "" {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInlinePasswordNoMasterKey, ConfigMetadataEncryptedPasswordProperty)
+	}
+	switch w.conf.PasswordProvider.Type {
+	case "", PasswordProviderFile:
+		return &filePasswordProvider{w: w, passwordCipher: passwordCipher}, nil
+	case PasswordProviderEnv:
+		return &envPasswordProvider{conf: &w.conf}, nil
+	case PasswordProviderExec:
+		if w.conf.PasswordProvider.Exec.Command == "" {
+			return nil, i18n.NewError(ctx, signermsgs.MsgPasswordProviderNoConfig, PasswordProviderExec, ConfigPasswordProviderExecCommand)
+		}
+		return &execPasswordProvider{conf: &w.conf}, nil
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgUnknownPasswordProvider, w.conf.PasswordProvider.Type)
+	}
+}
+
+func trimPassword(filenames *FilenamesConfig, password []byte) []byte {
+	if filenames.PasswordTrimSpace {
+		return []byte(strings.TrimSpace(string(password)))
+	}
+	return password
+}
+
+// filePasswordProvider is the original behavior of the wallet - a password file found either via
+// the metadata, or the address + password extension, falling back to a default password file.
+// If password encryption is configured, the files are encrypted under the master key and are
+// decrypted in memory. The metadata can alternatively carry the encrypted password inline.
+type filePasswordProvider struct {
+	w              *fsWallet
+	passwordCipher cipher.AEAD // nil when password files are plaintext
+}
+
+func (pp *filePasswordProvider) GetPassword(ctx context.Context, addr ethtypes.Address0xHex, metadata map[string]interface{}) ([]byte, error) {
+	w := pp.w
+	d := w.dirForAddress(addr)
+	filenames, _ := w.dirFilenames(d)
+	w.reloadMux.RLock()
+	defaultPasswordFile, passwordFileProperty := w.conf.DefaultPasswordFile, w.metadataPasswordFileProperty
+	encryptedPasswordProperty := w.metadataEncryptedPasswordProperty
+	w.reloadMux.RUnlock()
+
+	var passwordFilename string
+	if metadata != nil {
+		encryptedPassword, err := w.goTemplateToString(ctx, addr.String(), metadata, encryptedPasswordProperty)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
+		}
+		if encryptedPassword != "" {
+			if pp.passwordCipher == nil {
+				return nil, i18n.NewError(ctx, signermsgs.MsgInlinePasswordNoMasterKey, ConfigMetadataEncryptedPasswordProperty)
+			}
+			password, ok := openPassword(pp.passwordCipher, []byte(encryptedPassword))
+			if !ok {
+				return nil, i18n.NewError(ctx, signermsgs.MsgInlinePasswordDecryptFailed, addr)
+			}
+			return password, nil
+		}
+		passwordFilename, err = w.goTemplateToString(ctx, addr.String(), metadata, passwordFileProperty)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletFailed, addr)
+		}
+	} else {
+		passwordFilename = addressPasswordFilename(d, &filenames, addr)
+	}
+	log.L(ctx).Debugf("Reading passwordfile=%s", passwordFilename)
+
+	if passwordFilename != "" {
+		// Tracked even if it does not exist yet, as creating it changes the password used
+		w.trackKeyFile(addr, passwordFilename)
+		password, err := w.fs.ReadFile(passwordFilename)
+		if err == nil {
+			if pp.passwordCipher != nil {
+				return decryptPassword(ctx, pp.passwordCipher, passwordFilename, password)
+			}
+			return trimPassword(&filenames, password), nil
+		}
+		log.L(ctx).Debugf("Failed to read '%s' (password file): %s", passwordFilename, err)
+	}
+
+	// fall back to default password file
+	if defaultPasswordFile == "" {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPasswordNotAvailable, addr, PasswordProviderFile)
+	}
+	w.trackKeyFile(addr, defaultPasswordFile)
+	password, err := w.fs.ReadFile(defaultPasswordFile)
+	if err != nil {
+		log.L(ctx).Errorf("Failed to read '%s' (default password file): %s", defaultPasswordFile, err)
+		return nil, i18n.NewError(ctx, signermsgs.MsgPasswordNotAvailable, addr, PasswordProviderFile)
+	}
+	if pp.passwordCipher != nil {
+		return decryptPassword(ctx, pp.passwordCipher, defaultPasswordFile, password)
+	}
+	return password, nil
+}
+
+// addressPasswordFilename returns the password file named from the address, in the passwordPath or the wallet directory
+func addressPasswordFilename(d *walletDir, filenames *FilenamesConfig, addr ethtypes.Address0xHex) string {
+	passwordPath := filenames.PasswordPath
+	if passwordPath == "" {
+		passwordPath = d.path
+	}
+	passwordFilename := addr.String()
+	if !filenames.With0xPrefix {
+		passwordFilename = strings.TrimPrefix(passwordFilename, "0x")
+	}
+	return path.Join(passwordPath, passwordFilename+filenames.PasswordExt)
+}
+
+// envPasswordProvider looks up an environment variable named with a prefix and the upper-case
+// hex address (no 0x prefix), falling back to a default environment variable if configured
+type envPasswordProvider struct {
+	conf *Config
+}
+
+func (pp *envPasswordProvider) GetPassword(ctx context.Context, addr ethtypes.Address0xHex, _ map[string]interface{}) ([]byte, error) {
+	envConf := &pp.conf.PasswordProvider.Env
+	names := []string{envConf.Prefix + strings.ToUpper(ethtypes.AddressPlainHex(addr).String())}
+	if envConf.Default != "" {
+		names = append(names, envConf.Default)
+	}
+	for _, name := range names {
+		if password, ok := os.LookupEnv(name); ok {
+			return trimPassword(&pp.conf.Filenames, []byte(password)), nil
+		}
+		log.L(ctx).Debugf("Password environment variable %s not set", name)
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgPasswordNotAvailable, addr, PasswordProviderEnv)
+}
+
+// execPasswordProvider runs a command, with the address as the final argument (and in the
+// FFSIGNER_ADDRESS environment variable) and the metadata as JSON on stdin. The stdout of
+// the command is the password.
+type execPasswordProvider struct {
+	conf *Config
+}
+
+func (pp *execPasswordProvider) GetPassword(ctx context.Context, addr ethtypes.Address0xHex, metadata map[string]interface{}) ([]byte, error) {
+	execConf := &pp.conf.PasswordProvider.Exec
+	args := make([]string, 0, len(execConf.Args)+1)
+	args = append(args, execConf.Args...)
+	args = append(args, addr.String())
+	cmd := exec.CommandContext(ctx, execConf.Command, args...)
+	cmd.Env = append(os.Environ(), "FFSIGNER_ADDRESS="+addr.String())
+	if metadata != nil {
+		metadataJSON, err := json.Marshal(jsonCompatible(metadata))
+		if err != nil {
+			return nil, i18n.WrapError(ctx, err, signermsgs.MsgPasswordNotAvailable, addr, PasswordProviderExec)
+		}
+		cmd.Stdin = bytes.NewReader(metadataJSON)
+	}
+	stderr := new(strings.Builder)
+	cmd.Stderr = stderr
+	password, err := cmd.Output()
+	if err != nil {
+		log.L(ctx).Errorf("Password command '%s' failed for %s: %s (stderr=%s)", execConf.Command, addr, err, stderr)
+		return nil, i18n.WrapError(ctx, err, signermsgs.MsgPasswordNotAvailable, addr, PasswordProviderExec)
+	}
+	return trimPassword(&pp.conf.Filenames, password), nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} maps that YAML decodes nested
+// objects into, to map[string]interface{} maps that can be serialized to JSON
+func jsonCompatible(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vt))
+		for k, v := range vt {
+			m[fmt.Sprintf("%v", k)] = jsonCompatible(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vt))
+		for k, v := range vt {
+			m[k] = jsonCompatible(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(vt))
+		for i, v := range vt {
+			a[i] = jsonCompatible(v)
+		}
+		return a
+	default:
+		return v
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPasswordProvider struct {
+	password []byte
+	err      error
+	metadata map[string]interface{}
+}
+
+func (pp *testPasswordProvider) GetPassword(_ context.Context, _ ethtypes.Address0xHex, metadata map[string]interface{}) ([]byte, error) {
+	pp.metadata = metadata
+	return pp.password, pp.err
+}
+
+func TestCustomPasswordProvider(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, false)
+	defer done()
+
+	testPassword, err := os.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.pwd")
+	assert.NoError(t, err)
+	pp := &testPasswordProvider{password: testPassword}
+
+	ff, err := NewFilesystemWalletWithPasswordProvider(ctx, &f.conf, pp)
+	assert.NoError(t, err)
+	defer ff.Close()
+	err = ff.Initialize(ctx)
+	assert.NoError(t, err)
+
+	_, err = ff.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.NoError(t, err)
+	assert.Equal(t, "file-based-signer", pp.metadata["signing"].(map[string]interface{})["type"])
+
+}
+
+func TestCustomPasswordProviderFail(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	f.passwordProvider = &testPasswordProvider{err: fmt.Errorf("pop")}
+
+	_, err := f.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.Regexp(t, "FF22015", err)
+
+}
+
+func TestUnknownPasswordProvider(t *testing.T) {
+
+	_, err := NewFilesystemWallet(context.Background(), &Config{
+		PasswordProvider: PasswordProviderConfig{Type: "wrong"},
+	})
+	assert.Regexp(t, "FF22094", err)
+
+}
+
+func TestEnvPasswordProvider(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+	f.conf.PasswordProvider.Type = PasswordProviderEnv
+	f.conf.PasswordProvider.Env.Prefix = "UT_PASSWORD_"
+	pp, err := newPasswordProviderFromConfig(ctx, f)
+	assert.NoError(t, err)
+	f.passwordProvider = pp
+
+	testPassword, err := os.ReadFile("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.pwd")
+	assert.NoError(t, err)
+	t.Setenv("UT_PASSWORD_1F185718734552D08278AA70F804580BAB5FD2B4", string(testPassword)+"\n")
+
+	_, err = f.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.NoError(t, err)
+
+}
+
+func TestEnvPasswordProviderDefault(t *testing.T) {
+
+	ctx := context.Background()
+	pp := &envPasswordProvider{conf: &Config{
+		PasswordProvider: PasswordProviderConfig{
+			Env: PasswordProviderEnvConfig{Prefix: "UT_PASSWORD_", Default: "UT_PASSWORD_DEFAULT"},
+		},
+	}}
+	addr := *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")
+
+	_, err := pp.GetPassword(ctx, addr, nil)
+	assert.Regexp(t, "FF22096", err)
+
+	t.Setenv("UT_PASSWORD_DEFAULT", "fallback")
+	password, err := pp.GetPassword(ctx, addr, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "fallback", string(password))
+
+}
+
+func TestExecPasswordProvider(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	f.conf.PasswordProvider.Type = PasswordProviderExec
+	f.conf.PasswordProvider.Exec.Command = "/bin/sh"
+	f.conf.PasswordProvider.Exec.Args = []string{"-c", `test "$0" = "$FFSIGNER_ADDRESS" && grep -q file-based-signer && cat ../../test/keystore_toml/${0#0x}.pwd`}
+	pp, err := newPasswordProviderFromConfig(ctx, f)
+	assert.NoError(t, err)
+	f.passwordProvider = pp
+
+	_, err = f.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.NoError(t, err)
+
+}
+
+func TestExecPasswordProviderFail(t *testing.T) {
+
+	ctx := context.Background()
+	pp := &execPasswordProvider{conf: &Config{
+		PasswordProvider: PasswordProviderConfig{
+			Exec: PasswordProviderExecConfig{Command: "/bin/sh", Args: []string{"-c", "exit 1"}},
+		},
+	}}
+	_, err := pp.GetPassword(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"), nil)
+	assert.Regexp(t, "FF22096", err)
+
+}
+
+func TestExecPasswordProviderBadMetadata(t *testing.T) {
+
+	ctx := context.Background()
+	pp := &execPasswordProvider{conf: &Config{
+		PasswordProvider: PasswordProviderConfig{
+			Exec: PasswordProviderExecConfig{Command: "/bin/sh"},
+		},
+	}}
+	_, err := pp.GetPassword(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"), map[string]interface{}{
+		"bad": json.RawMessage(`!!!`),
+	})
+	assert.Regexp(t, "FF22096", err)
+
+}
+
+func TestExecPasswordProviderMissingCommand(t *testing.T) {
+
+	_, err := NewFilesystemWallet(context.Background(), &Config{
+		PasswordProvider: PasswordProviderConfig{Type: PasswordProviderExec},
+	})
+	assert.Regexp(t, "FF22095", err)
+
+}
+
+func TestExecPasswordProviderYAMLMetadata(t *testing.T) {
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_fs_config")
+	InitConfig(unitTestConfig)
+	dir := t.TempDir()
+	unitTestConfig.Set(ConfigPath, dir)
+	unitTestConfig.Set(ConfigFilenamesPrimaryExt, ".yaml")
+	unitTestConfig.Set(ConfigMetadataKeyFileProperty, `{{ index .signing "key-file" }}`)
+	unitTestConfig.Set(ConfigDisableListener, true)
+	unitTestConfig.Set(ConfigPasswordProviderType, PasswordProviderExec)
+	unitTestConfig.Set(ConfigPasswordProviderExecCommand, "/bin/sh")
+	unitTestConfig.Set(ConfigPasswordProviderExecArgs, []string{"-c", `grep -q '"signing":{"key-file":".*","type":"file-based-signer"}' && cat ../../test/keystore_toml/${0#0x}.pwd`})
+	ctx := context.Background()
+
+	keyFile, err := filepath.Abs("../../test/keystore_toml/1f185718734552d08278aa70f804580bab5fd2b4.key.json")
+	assert.NoError(t, err)
+	err = os.WriteFile(path.Join(dir, "1f185718734552d08278aa70f804580bab5fd2b4.yaml"), []byte(fmt.Sprintf(`signing:
+  type: file-based-signer
+  key-file: %s
+`, keyFile)), 0644)
+	assert.NoError(t, err)
+
+	ff, err := NewFilesystemWallet(ctx, ReadConfig(unitTestConfig))
+	assert.NoError(t, err)
+	defer ff.Close()
+	err = ff.Initialize(ctx)
+	assert.NoError(t, err)
+
+	_, err = ff.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.NoError(t, err)
+
+}
+
+func TestFilePasswordProviderBadTemplate(t *testing.T) {
+
+	ctx, f, done := newTestTOMLMetadataWallet(t, true)
+	defer done()
+	f.metadataPasswordFileProperty = template.Must(template.New("").Parse(`{{ index .signing 12345 }}`))
+
+	_, err := f.GetWalletFile(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+	assert.Regexp(t, "FF22015", err)
+
+}
+
+func TestJSONCompatible(t *testing.T) {
+
+	b, err := json.Marshal(jsonCompatible(map[string]interface{}{
+		"a": map[interface{}]interface{}{
+			1:   "one",
+			"b": []interface{}{map[interface{}]interface{}{"c": true}},
+		},
+	}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a":{"1":"one","b":[{"c":true}]}}`, string(b))
+
+}
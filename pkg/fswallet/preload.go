@@ -0,0 +1,94 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// preloadKeys decrypts every indexed key into the signer cache when signerCachePreload is set, so the first
+// signature for each key does not wait for the KDF. The keys are loaded by a pool of kdfConcurrency workers
+// (or one per CPU). A key that fails to load is logged and skipped, as it fails in the same way when it is
+// used, and loading stops early if the context is cancelled (such as by Close).
+func (w *fsWallet) preloadKeys(ctx context.Context) {
+	if !w.conf.SignerCachePreload {
+		return
+	}
+	if w.conf.ReadOnly {
+		log.L(ctx).Infof("Not preloading keys, as signing is disabled")
+		return
+	}
+	addrs, _ := w.GetAccounts(ctx)
+	total := len(addrs)
+	if total == 0 {
+		return
+	}
+	if maxSize := fftypes.ParseToByteSize(w.conf.SignerCacheSize); int64(total) > maxSize {
+		log.L(ctx).Warnf("Preloading %d keys into a signer cache of size %d - the least recently used keys will be evicted", total, maxSize)
+	}
+	workers := w.conf.KDFConcurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	progressInterval := total / 10
+	if progressInterval == 0 {
+		progressInterval = 1
+	}
+	log.L(ctx).Infof("Preloading %d keys with %d workers", total, workers)
+
+	startTime := time.Now()
+	var processed, failed atomic.Int64
+	work := make(chan *ethtypes.Address0xHex)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for addr := range work {
+				ck, err := w.acquireKey(ctx, *addr, false)
+				if err != nil {
+					log.L(ctx).Warnf("Failed to preload key %s: %s", addr, err)
+					failed.Add(1)
+				} else {
+					ck.release()
+				}
+				if count := processed.Add(1); count%int64(progressInterval) == 0 && count < int64(total) {
+					log.L(ctx).Infof("Preloaded %d/%d keys", count, total)
+				}
+			}
+		}()
+	}
+dispatch:
+	for _, addr := range addrs {
+		select {
+		case work <- addr:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+	log.L(ctx).Infof("Preloaded %d/%d keys in %s (%d failed)", processed.Load()-failed.Load(), total, time.Since(startTime), failed.Load())
+}
@@ -0,0 +1,133 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPreloadWallet(t *testing.T, setConf func(conf *Config)) (context.Context, *fsWallet, []*secp256k1.KeyPair, func()) {
+	ctx, hexWallet, dir, done := newTestUnencryptedKeyWallet(t, KeyFormatHex)
+	done()
+	keypairs := make([]*secp256k1.KeyPair, 3)
+	for i := range keypairs {
+		keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+		assert.NoError(t, err)
+		writeTestHexKey(t, dir, keypair.Address.String()+".key", keypair)
+		keypairs[i] = keypair
+	}
+	// A key that is indexed, but fails to load
+	err := os.WriteFile(path.Join(dir, "0x1f185718734552d08278aa70f804580bab5fd2b4.key"), []byte("not hex"), 0600)
+	assert.NoError(t, err)
+
+	conf := hexWallet.conf
+	conf.SignerCachePreload = true
+	setConf(&conf)
+	ff, err := NewFilesystemWallet(ctx, &conf)
+	assert.NoError(t, err)
+	return ctx, ff.(*fsWallet), keypairs, func() {
+		ff.Close()
+	}
+}
+
+func TestPreloadKeys(t *testing.T) {
+
+	ctx, f, keypairs, done := newTestPreloadWallet(t, func(conf *Config) {
+		conf.KDFConcurrency = 2
+	})
+	defer done()
+
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+	for _, keypair := range keypairs {
+		assert.NotNil(t, f.signerCache.Get(keypair.Address.String()))
+	}
+	assert.Nil(t, f.signerCache.Get("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+
+}
+
+func TestPreloadKeysBackgroundScan(t *testing.T) {
+
+	ctx, f, keypairs, done := newTestPreloadWallet(t, func(conf *Config) {
+		conf.BackgroundScan = true
+		conf.SignerCacheSize = "1"
+	})
+	defer done()
+
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+	<-f.initialScanDone
+	// The cache only holds one key, but all were loaded
+	loaded := 0
+	for _, keypair := range keypairs {
+		if f.signerCache.Get(keypair.Address.String()) != nil {
+			loaded++
+		}
+	}
+	assert.GreaterOrEqual(t, loaded, 1)
+
+}
+
+func TestPreloadKeysReadOnly(t *testing.T) {
+
+	ctx, f, keypairs, done := newTestPreloadWallet(t, func(conf *Config) {
+		conf.ReadOnly = true
+	})
+	defer done()
+
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, f.signerCache.Get(keypairs[0].Address.String()))
+
+}
+
+func TestPreloadKeysCancelled(t *testing.T) {
+
+	ctx, f, keypairs, done := newTestPreloadWallet(t, func(conf *Config) {
+		conf.SignerCachePreload = false
+	})
+	defer done()
+
+	err := f.Initialize(ctx)
+	assert.NoError(t, err)
+
+	f.conf.SignerCachePreload = true
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	f.preloadKeys(cancelledCtx)
+	for _, keypair := range keypairs {
+		assert.Nil(t, f.signerCache.Get(keypair.Address.String()))
+	}
+
+}
+
+func TestPreloadKeysEmpty(t *testing.T) {
+
+	ctx, f, _, done := newEmptyWalletTestDir(t, false)
+	defer done()
+
+	f.conf.SignerCachePreload = true
+	f.preloadKeys(ctx)
+	assert.Zero(t, f.signerCache.ItemCount())
+
+}
@@ -0,0 +1,126 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+// reloadableConfigKeys are the configuration keys that can be changed by Reload, without a restart
+var reloadableConfigKeys = []string{
+	ConfigFilenamesPrimaryExt,
+	ConfigFilenamesPrimaryMatchRegex,
+	ConfigFilenamesPasswordExt,
+	ConfigFilenamesPasswordPath,
+	ConfigFilenamesWith0xPrefix,
+	ConfigDefaultPasswordFile,
+	ConfigMetadataFormat,
+	ConfigMetadataKeyFileProperty,
+	ConfigMetadataPasswordFileProperty,
+	ConfigMetadataEncryptedPasswordProperty,
+}
+
+// reloadableConfig is the parsed form of the templates and regular expression in the reloadable configuration
+type reloadableConfig struct {
+	metadataKeyFileProperty           *template.Template
+	metadataPasswordFileProperty      *template.Template
+	metadataEncryptedPasswordProperty *template.Template
+	primaryMatchRegex                 *regexp.Regexp
+}
+
+func compileReloadableConfig(ctx context.Context, conf *Config) (rc *reloadableConfig, err error) {
+	rc = &reloadableConfig{}
+	rc.metadataKeyFileProperty, err = goTemplateFromConfig(ctx, ConfigMetadataKeyFileProperty, conf.Metadata.KeyFileProperty)
+	if err != nil {
+		return nil, err
+	}
+	rc.metadataPasswordFileProperty, err = goTemplateFromConfig(ctx, ConfigMetadataPasswordFileProperty, conf.Metadata.PasswordFileProperty)
+	if err != nil {
+		return nil, err
+	}
+	rc.metadataEncryptedPasswordProperty, err = goTemplateFromConfig(ctx, ConfigMetadataEncryptedPasswordProperty, conf.Metadata.EncryptedPasswordProperty)
+	if err != nil {
+		return nil, err
+	}
+	if rc.primaryMatchRegex, err = compilePrimaryMatchRegex(ctx, conf.Filenames.PrimaryMatchRegex); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// applyReloadableConfig must be called with the reloadMux held (other than during construction).
+// The fields are set individually, as the rest of the configuration is read without the lock.
+func (w *fsWallet) applyReloadableConfig(conf *Config, rc *reloadableConfig) {
+	w.conf.Filenames.PrimaryExt = conf.Filenames.PrimaryExt
+	w.conf.Filenames.PrimaryMatchRegex = conf.Filenames.PrimaryMatchRegex
+	w.conf.Filenames.PasswordExt = conf.Filenames.PasswordExt
+	w.conf.Filenames.PasswordPath = conf.Filenames.PasswordPath
+	w.conf.Filenames.With0xPrefix = conf.Filenames.With0xPrefix
+	w.conf.DefaultPasswordFile = conf.DefaultPasswordFile
+	w.conf.Metadata = conf.Metadata
+	w.metadataKeyFileProperty = rc.metadataKeyFileProperty
+	w.metadataPasswordFileProperty = rc.metadataPasswordFileProperty
+	w.metadataEncryptedPasswordProperty = rc.metadataEncryptedPasswordProperty
+	w.primaryMatchRegex = rc.primaryMatchRegex
+}
+
+// Reload applies a change to the filenames, metadata and default password file configuration, without
+// restarting and losing the signer cache. Changes to any other configuration are rejected. Keys already
+// cached, and addresses already indexed, are retained - then the directory is re-scanned to index any
+// files that match the new configuration.
+func (w *fsWallet) Reload(ctx context.Context, conf *Config) error {
+	newConf := *conf
+	setConfigDefaults(&newConf)
+
+	w.reloadMux.RLock()
+	current, updated := w.conf, newConf
+	w.reloadMux.RUnlock()
+	clearReloadableConfig(&current)
+	clearReloadableConfig(&updated)
+	if !reflect.DeepEqual(current, updated) {
+		return i18n.NewError(ctx, signermsgs.MsgReloadRequiresRestart, strings.Join(reloadableConfigKeys, ", "))
+	}
+
+	rc, err := compileReloadableConfig(ctx, &newConf)
+	if err != nil {
+		return err
+	}
+	w.reloadMux.Lock()
+	w.applyReloadableConfig(&newConf, rc)
+	w.reloadMux.Unlock()
+	log.L(ctx).Infof("Reloaded configuration for %s", w.conf.Path)
+
+	return w.Refresh(ctx)
+}
+
+func clearReloadableConfig(conf *Config) {
+	conf.Filenames.PrimaryExt = ""
+	conf.Filenames.PrimaryMatchRegex = ""
+	conf.Filenames.PasswordExt = ""
+	conf.Filenames.PasswordPath = ""
+	conf.Filenames.With0xPrefix = false
+	conf.DefaultPasswordFile = ""
+	conf.Metadata = MetadataConfig{}
+}
@@ -0,0 +1,143 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadPasswordExtRetainsCache(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	conf := f.conf
+	conf.Filenames.PasswordExt = ".wrong"
+	err := f.Reload(ctx, &conf)
+	assert.NoError(t, err)
+
+	_, err = f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.Regexp(t, "FF22015", err)
+
+	conf.Filenames.PasswordExt = ".pwd"
+	err = f.Reload(ctx, &conf)
+	assert.NoError(t, err)
+
+	_, err = f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.NoError(t, err)
+
+	// The key is served from the cache, even though the password could no longer be found
+	conf.Filenames.PasswordExt = ".wrong"
+	err = f.Reload(ctx, &conf)
+	assert.NoError(t, err)
+
+	_, err = f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.NoError(t, err)
+
+}
+
+func TestReloadToMetadataIndexesNewFiles(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	count, err := f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	conf := f.conf
+	conf.Filenames.PrimaryMatchRegex = ""
+	conf.Filenames.PrimaryExt = ".toml"
+	conf.Metadata.Format = "auto"
+	conf.Metadata.KeyFileProperty = `{{ index .signing "key-file" }}`
+	conf.Metadata.PasswordFileProperty = `{{ index .signing "password-file" }}`
+	err = f.Reload(ctx, &conf)
+	assert.NoError(t, err)
+	assert.Equal(t, "toml", f.conf.Metadata.Format)
+
+	count, err = f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, "1f185718734552d08278aa70f804580bab5fd2b4.toml", f.addressToFileMap[*ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4")].name)
+
+	_, err = f.getSignerForJSONAccount(ctx, json.RawMessage(`"0x1f185718734552d08278aa70f804580bab5fd2b4"`))
+	assert.NoError(t, err)
+
+}
+
+func TestReloadNonReloadableChange(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	conf := f.conf
+	conf.SignerCacheSize = "1Mb"
+	err := f.Reload(ctx, &conf)
+	assert.Regexp(t, "FF22102", err)
+
+	conf = f.conf
+	conf.Filenames.PasswordTrimSpace = !conf.Filenames.PasswordTrimSpace
+	err = f.Reload(ctx, &conf)
+	assert.Regexp(t, "FF22102", err)
+
+}
+
+func TestReloadUnchangedWithDefaults(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	conf := f.conf
+	conf.KeyFormat = ""
+	conf.NotifyQueueSize = 0
+	err := f.Reload(ctx, &conf)
+	assert.NoError(t, err)
+
+}
+
+func TestReloadBadConfig(t *testing.T) {
+
+	ctx, f, done := newTestRegexpFilenameOnlyWallet(t, true)
+	defer done()
+
+	conf := f.conf
+	conf.Filenames.PrimaryMatchRegex = "[[["
+	err := f.Reload(ctx, &conf)
+	assert.Regexp(t, "FF22056", err)
+
+	conf.Filenames.PrimaryMatchRegex = "no_capture_group"
+	err = f.Reload(ctx, &conf)
+	assert.Regexp(t, "FF22057", err)
+
+	conf.Filenames.PrimaryMatchRegex = ""
+	conf.Metadata.KeyFileProperty = "{{ !!! }}"
+	err = f.Reload(ctx, &conf)
+	assert.Regexp(t, "FF22016", err)
+
+	conf.Metadata.KeyFileProperty = ""
+	conf.Metadata.PasswordFileProperty = "{{ !!! }}"
+	err = f.Reload(ctx, &conf)
+	assert.Regexp(t, "FF22016", err)
+
+	// Nothing was applied
+	assert.NotNil(t, f.primaryMatchRegex)
+
+}
@@ -0,0 +1,153 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+)
+
+// RotatePassword decrypts the keystore file with the old password, and replaces it with one encrypted under the
+// new password with the same KDF. With the file password provider, the password file named from the address is
+// replaced too (encrypted under the master key, if passwordEncryption is configured). Each file is replaced
+// atomically, by renaming a new file over it, but the pair is not - a load of the key between the two renames
+// fails, and succeeds once both are in place.
+func (w *fsWallet) RotatePassword(ctx context.Context, addr ethtypes.Address0xHex, oldPassword, newPassword string) error {
+	keyFilename, err := w.primaryFilename(ctx, addr)
+	if err != nil {
+		return err
+	}
+	pp, isFilePasswordProvider := w.passwordProvider.(*filePasswordProvider)
+	d := w.dirForAddress(addr)
+	filenames, _ := w.dirFilenames(d)
+	w.reloadMux.RLock()
+	reason := w.rotateUnsupportedReason(isFilePasswordProvider, &filenames)
+	w.reloadMux.RUnlock()
+	if reason != "" {
+		return i18n.NewError(ctx, signermsgs.MsgRotatePasswordUnsupported, reason)
+	}
+	b, err := os.ReadFile(keyFilename)
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+	}
+	if w.kdfSemaphore != nil {
+		if err := w.kdfSemaphore.Acquire(ctx, 1); err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+		}
+		defer w.kdfSemaphore.Release(1)
+	}
+	wf, err := keystorev3.ReadWalletFile(b, []byte(oldPassword))
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+	}
+	defer destroyWalletFile(wf)
+	keypair := wf.KeyPair()
+	keypair.Destroy()
+	if keypair.Address != addr {
+		return i18n.NewError(ctx, signermsgs.MsgAddressMismatch, keypair.Address, addr)
+	}
+	newWF, err := wf.Reencrypt(newPassword, nil)
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+	}
+	defer destroyWalletFile(newWF)
+
+	// Both new files are written before either is renamed into place
+	var passwordFilename, passwordTmp string
+	if isFilePasswordProvider {
+		passwordFileContent := newPassword
+		if pp.passwordCipher != nil {
+			if passwordFileContent, err = sealPassword(pp.passwordCipher, []byte(newPassword)); err != nil {
+				return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+			}
+		}
+		passwordFilename = addressPasswordFilename(d, &filenames, addr)
+		if passwordTmp, err = writeTempFile(passwordFilename, []byte(passwordFileContent)); err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+		}
+		defer os.Remove(passwordTmp) // no-op once renamed
+	}
+	keyTmp, err := writeTempFile(keyFilename, newWF.JSON())
+	if err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+	}
+	defer os.Remove(keyTmp) // no-op once renamed
+
+	// The key must be reloaded from the new files, whether or not the renames succeed
+	defer w.InvalidateCache(ctx, addr)
+	if err := os.Rename(keyTmp, keyFilename); err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+	}
+	if passwordTmp != "" {
+		if err := os.Rename(passwordTmp, passwordFilename); err != nil {
+			log.L(ctx).Errorf("Keystore file '%s' is encrypted under the new password, but the password file '%s' could not be replaced: %s", keyFilename, passwordFilename, err)
+			return i18n.NewError(ctx, signermsgs.MsgRotatePasswordFailed, addr, err)
+		}
+	}
+	log.L(ctx).Infof("Rotated the password of the signing key for address: %s", addr)
+	return nil
+}
+
+// rotateUnsupportedReason returns the configuration that prevents RotatePassword from replacing the files the
+// wallet reads the key from, or the empty string if there is none. Must be called holding the reloadMux.
+func (w *fsWallet) rotateUnsupportedReason(isFilePasswordProvider bool, filenames *FilenamesConfig) string {
+	_, isOS := w.fs.(OSFS)
+	switch {
+	case !isOS:
+		return ConfigArchivePath
+	case w.conf.KeyFormat != KeyFormatKeystoreV3:
+		return ConfigKeyFormat
+	case isMetadataFormat(w.conf.Metadata.Format):
+		return ConfigMetadataFormat
+	case isFilePasswordProvider && filenames.PasswordExt == "":
+		return ConfigFilenamesPasswordExt
+	}
+	return ""
+}
+
+// writeTempFile writes the data to a new file alongside the one it is to replace, returning its name
+func writeTempFile(filename string, data []byte) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func destroyWalletFile(wf keystorev3.WalletFile) {
+	if d, ok := wf.(destroyableKey); ok {
+		d.Destroy()
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRotateWallet(t *testing.T, conf *Config) (context.Context, *fsWallet, *ethtypes.Address0xHex, string) {
+	ctx := context.Background()
+	addr, err := CreateAccount(ctx, conf, &keystorev3.ScryptOptions{N: 1024})
+	assert.NoError(t, err)
+	filename := addr.String()
+	if !conf.Filenames.With0xPrefix {
+		filename = strings.TrimPrefix(filename, "0x")
+	}
+	passwordPath := conf.Filenames.PasswordPath
+	if passwordPath == "" {
+		passwordPath = conf.Path
+	}
+	password, err := os.ReadFile(path.Join(passwordPath, filename+".pwd"))
+	assert.NoError(t, err)
+
+	w, err := NewFilesystemWallet(ctx, conf)
+	assert.NoError(t, err)
+	t.Cleanup(func() { w.Close() })
+	err = w.Initialize(ctx)
+	assert.NoError(t, err)
+	return ctx, w.(*fsWallet), addr, string(password)
+}
+
+func TestRotatePasswordOK(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	conf.KDFConcurrency = 1
+	ctx, w, addr, password := newTestRotateWallet(t, conf)
+	wf1, err := w.GetWalletFile(ctx, *addr)
+	assert.NoError(t, err)
+
+	err = w.RotatePassword(ctx, *addr, password, "new password")
+	assert.NoError(t, err)
+
+	filename := strings.TrimPrefix(addr.String(), "0x")
+	newPassword, err := os.ReadFile(path.Join(conf.Path, filename+".pwd"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new password", string(newPassword))
+	b, err := os.ReadFile(path.Join(conf.Path, filename+".key.json"))
+	assert.NoError(t, err)
+	wf2, err := keystorev3.ReadWalletFile(b, newPassword)
+	assert.NoError(t, err)
+	assert.NotEqual(t, wf1.GetID(), wf2.GetID())
+	info, err := os.Stat(path.Join(conf.Path, filename+".key.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// No temporary files left behind, and the key is reloaded from the new files
+	entries, err := os.ReadDir(conf.Path)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	wf3, err := w.GetWalletFile(ctx, *addr)
+	assert.NoError(t, err)
+	assert.Equal(t, wf2.GetID(), wf3.GetID())
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: []byte(`"` + addr.String() + `"`)}, 1)
+	assert.NoError(t, err)
+
+}
+
+func TestRotatePasswordEncrypted(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	conf.Filenames.With0xPrefix = true
+	conf.Filenames.PasswordPath = t.TempDir()
+	masterKeyFile := path.Join(t.TempDir(), "master.key")
+	err := os.WriteFile(masterKeyFile, []byte(hex.EncodeToString(make([]byte, MasterKeyLength))), 0600)
+	assert.NoError(t, err)
+	conf.PasswordEncryption.MasterKeyFile = masterKeyFile
+	ctx, w, addr, encryptedPassword := newTestRotateWallet(t, conf)
+	password, err := decryptPassword(ctx, w.passwordProvider.(*filePasswordProvider).passwordCipher, "", []byte(encryptedPassword))
+	assert.NoError(t, err)
+
+	err = w.RotatePassword(ctx, *addr, string(password), "new password")
+	assert.NoError(t, err)
+
+	b, err := os.ReadFile(path.Join(conf.Filenames.PasswordPath, addr.String()+".pwd"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "new password")
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: []byte(`"` + addr.String() + `"`)}, 1)
+	assert.NoError(t, err)
+
+}
+
+func TestRotatePasswordEnvProvider(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	ctx, w, addr, password := newTestRotateWallet(t, conf)
+	w.passwordProvider = &envPasswordProvider{conf: &w.conf}
+
+	err := w.RotatePassword(ctx, *addr, password, "new password")
+	assert.NoError(t, err)
+
+	// The password file is the operator's to update, as it is not used by the provider
+	filename := strings.TrimPrefix(addr.String(), "0x")
+	b, err := os.ReadFile(path.Join(conf.Path, filename+".pwd"))
+	assert.NoError(t, err)
+	assert.Equal(t, password, string(b))
+	b, err = os.ReadFile(path.Join(conf.Path, filename+".key.json"))
+	assert.NoError(t, err)
+	_, err = keystorev3.ReadWalletFile(b, []byte("new password"))
+	assert.NoError(t, err)
+
+}
+
+func TestRotatePasswordWrongPassword(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	ctx, w, addr, _ := newTestRotateWallet(t, conf)
+
+	err := w.RotatePassword(ctx, *addr, "wrong", "new password")
+	assert.Regexp(t, "FF22239.*invalid password", err)
+
+}
+
+func TestRotatePasswordNotFound(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	ctx, w, _, password := newTestRotateWallet(t, conf)
+
+	err := w.RotatePassword(ctx, *ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"), password, "new password")
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestRotatePasswordUnsupported(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	ctx, w, addr, password := newTestRotateWallet(t, conf)
+
+	for _, setWallet := range []func(w *fsWallet){
+		func(w *fsWallet) { w.fs = fstest.MapFS{} },
+		func(w *fsWallet) { w.conf.KeyFormat = KeyFormatHex },
+		func(w *fsWallet) { w.conf.Metadata.Format = "toml" },
+		func(w *fsWallet) { w.conf.Filenames.PasswordExt = "" },
+	} {
+		savedFS, savedConf := w.fs, w.conf
+		setWallet(w)
+		err := w.RotatePassword(ctx, *addr, password, "new password")
+		assert.Regexp(t, "FF22238", err)
+		w.fs, w.conf = savedFS, savedConf
+	}
+
+}
+
+func TestRotatePasswordAddressMismatch(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	ctx, w, addr, password := newTestRotateWallet(t, conf)
+	other, err := CreateAccount(ctx, conf, &keystorev3.ScryptOptions{N: 1024})
+	assert.NoError(t, err)
+	b, err := os.ReadFile(path.Join(conf.Path, strings.TrimPrefix(addr.String(), "0x")+".key.json"))
+	assert.NoError(t, err)
+	err = os.WriteFile(path.Join(conf.Path, strings.TrimPrefix(other.String(), "0x")+".key.json"), b, 0600)
+	assert.NoError(t, err)
+	err = w.Refresh(ctx)
+	assert.NoError(t, err)
+
+	err = w.RotatePassword(ctx, *other, password, "new password")
+	assert.Regexp(t, "FF22059", err)
+
+}
+
+func TestRotatePasswordWriteFail(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	conf.Filenames.PasswordPath = t.TempDir()
+	ctx, w, addr, password := newTestRotateWallet(t, conf)
+	err := os.RemoveAll(conf.Filenames.PasswordPath)
+	assert.NoError(t, err)
+
+	err = w.RotatePassword(ctx, *addr, password, "new password")
+	assert.Regexp(t, "FF22239", err)
+
+}
+
+func TestRotatePasswordReadFail(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	ctx, w, addr, password := newTestRotateWallet(t, conf)
+	err := os.Remove(path.Join(conf.Path, strings.TrimPrefix(addr.String(), "0x")+".key.json"))
+	assert.NoError(t, err)
+
+	err = w.RotatePassword(ctx, *addr, password, "new password")
+	assert.Regexp(t, "FF22239", err)
+
+}
+
+func TestRotatePasswordKDFQueueCancelled(t *testing.T) {
+
+	conf := newTestCreateConfig(t)
+	conf.KDFConcurrency = 1
+	ctx, w, addr, password := newTestRotateWallet(t, conf)
+	assert.True(t, w.kdfSemaphore.TryAcquire(1))
+	defer w.kdfSemaphore.Release(1)
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err := w.RotatePassword(cancelledCtx, *addr, password, "new password")
+	assert.Regexp(t, "FF22239", err)
+
+}
@@ -0,0 +1,73 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// resolveSymlinks replaces any symlinks in the directory entries with the file they resolve to (keeping
+// the name of the link), so a link to a keystore file is indexed like the file itself. Links that are
+// broken, form a cycle, or resolve to a directory are ignored.
+func (w *fsWallet) resolveSymlinks(ctx context.Context, d *walletDir, files []fs.DirEntry) []fs.DirEntry {
+	resolved := make([]fs.DirEntry, 0, len(files))
+	for _, f := range files {
+		if f.Type()&fs.ModeSymlink == 0 {
+			resolved = append(resolved, f)
+			continue
+		}
+		fi, err := w.fs.Stat(path.Join(d.path, f.Name()))
+		if err != nil {
+			log.L(ctx).Warnf("Ignoring '%s/%s': unable to resolve symlink: %s", d.path, f.Name(), err)
+			continue
+		}
+		if fi.IsDir() {
+			log.L(ctx).Tracef("Ignoring '%s/%s': symlink to a directory", d.path, f.Name())
+			continue
+		}
+		resolved = append(resolved, fs.FileInfoToDirEntry(fi))
+	}
+	return resolved
+}
+
+// keepIndexedFile decides which of two filenames in the same directory is used for an address. The file
+// that is already indexed is kept while it exists (and still matches the filenames configuration), so the choice does not depend on the order files are
+// found in (a link to the indexed file is a duplicate of it, and any other file is logged as a conflict).
+// If the indexed file has gone, the new file replaces it. Called with the mux held.
+func (w *fsWallet) keepIndexedFile(ctx context.Context, d *walletDir, existing, file indexedFile, addr *ethtypes.Address0xHex) bool {
+	existingInfo, err := w.fs.Stat(path.Join(d.path, existing.name))
+	if err != nil {
+		log.L(ctx).Infof("Address %s now loaded from '%s/%s', as '%s' is no longer available", addr, d.path, file.name, existing.name)
+		return false
+	}
+	if matched := w.matchFilename(ctx, d, fs.FileInfoToDirEntry(existingInfo)); matched == nil || *matched != *addr {
+		log.L(ctx).Infof("Address %s now loaded from '%s/%s', as '%s' no longer matches the filenames configuration", addr, d.path, file.name, existing.name)
+		return false
+	}
+	if fi, err := w.fs.Stat(path.Join(d.path, file.name)); err == nil && os.SameFile(existingInfo, fi) {
+		log.L(ctx).Debugf("Ignoring '%s/%s': same file as '%s', which is already indexed for address %s", d.path, file.name, existing.name, addr)
+	} else {
+		log.L(ctx).Warnf("Ignoring '%s/%s': address %s is already indexed from '%s' in the same directory", d.path, file.name, addr, existing.name)
+	}
+	return true
+}
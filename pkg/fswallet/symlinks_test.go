@@ -0,0 +1,123 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswallet
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymlinkToKeyFile(t *testing.T) {
+
+	ctx, f, dir, done := newTestUnencryptedKeyWallet(t, KeyFormatHex)
+	defer done()
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	keysDir := t.TempDir()
+	writeTestHexKey(t, keysDir, "key.hex", keypair)
+	err = os.Symlink(path.Join(keysDir, "key.hex"), path.Join(dir, keypair.Address.String()+".key"))
+	assert.NoError(t, err)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+	accounts, err := f.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&keypair.Address}, accounts)
+
+	signer, err := f.getSignerForAddr(ctx, keypair.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, signer.Address)
+
+}
+
+func TestSymlinksIgnored(t *testing.T) {
+
+	ctx, f, dir, done := newTestUnencryptedKeyWallet(t, KeyFormatHex)
+	defer done()
+
+	// Dangling, a cycle, and links to directories (including the wallet directory itself)
+	err := os.Symlink(path.Join(dir, "missing"), path.Join(dir, "0x1f185718734552d08278aa70f804580bab5fd2b4.key"))
+	assert.NoError(t, err)
+	err = os.Symlink(path.Join(dir, "0x5d093e9b41911be5f5c4cf91b108bac5d130fa83.key"), path.Join(dir, "0x497eedc4299dea2f2a364be10025d0ad0f702de3.key"))
+	assert.NoError(t, err)
+	err = os.Symlink(path.Join(dir, "0x497eedc4299dea2f2a364be10025d0ad0f702de3.key"), path.Join(dir, "0x5d093e9b41911be5f5c4cf91b108bac5d130fa83.key"))
+	assert.NoError(t, err)
+	err = os.Symlink(t.TempDir(), path.Join(dir, "0xabcd1234abcd1234abcd1234abcd1234abcd1234.key"))
+	assert.NoError(t, err)
+	err = os.Symlink(dir, path.Join(dir, "0x0000000000000000000000000000000000000001.key"))
+	assert.NoError(t, err)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+	count, err := f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+}
+
+func TestDuplicateFilenamesForAddress(t *testing.T) {
+
+	ctx, f, dir, done := newTestUnencryptedKeyWallet(t, KeyFormatHex)
+	defer done()
+
+	// The 0x prefixed name sorts first, so is indexed first - unless the address starts with 0
+	var keypair *secp256k1.KeyPair
+	var err error
+	for keypair == nil || keypair.Address[0] < 0x10 {
+		keypair, err = secp256k1.GenerateSecp256k1KeyPair()
+		assert.NoError(t, err)
+	}
+	withPrefix := keypair.Address.String() + ".key"
+	withoutPrefix := strings.TrimPrefix(keypair.Address.String(), "0x") + ".key"
+	writeTestHexKey(t, dir, withPrefix, keypair)
+	err = os.Symlink(path.Join(dir, withPrefix), path.Join(dir, withoutPrefix))
+	assert.NoError(t, err)
+
+	err = f.Initialize(ctx)
+	assert.NoError(t, err)
+	count, err := f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, withPrefix, f.addressToFileMap[keypair.Address].name)
+
+	// A separate file for the same address does not replace the indexed file, whatever order it is found in
+	err = os.Remove(path.Join(dir, withoutPrefix))
+	assert.NoError(t, err)
+	writeTestHexKey(t, dir, withoutPrefix, keypair)
+	fi, err := os.Stat(path.Join(dir, withoutPrefix))
+	assert.NoError(t, err)
+	f.notifyNewFiles(ctx, 0, fs.FileInfoToDirEntry(fi))
+	assert.Equal(t, withPrefix, f.addressToFileMap[keypair.Address].name)
+
+	// Until the indexed file is removed
+	err = os.Remove(path.Join(dir, withPrefix))
+	assert.NoError(t, err)
+	f.notifyNewFiles(ctx, 0, fs.FileInfoToDirEntry(fi))
+	assert.Equal(t, withoutPrefix, f.addressToFileMap[keypair.Address].name)
+	count, err = f.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+}
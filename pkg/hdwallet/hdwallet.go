@@ -0,0 +1,162 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hdwallet implements BIP-39 mnemonics, and BIP-32 hierarchical deterministic
+// derivation of secp256k1 private keys from the resulting seed.
+package hdwallet
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2" // ISC licensed
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+const (
+	// HardenedKeyStart is the first index of a hardened child key (written as 0' or 0h in a path)
+	HardenedKeyStart uint32 = 0x80000000
+	// DefaultDerivationPath is the BIP-44 path of the first Ethereum account, as used by most wallets
+	DefaultDerivationPath = "m/44'/60'/0'/0/0"
+)
+
+var masterKeyHMACKey = []byte("Bitcoin seed")
+
+// ExtendedKey is a BIP-32 extended private key
+type ExtendedKey struct {
+	privateKey btcec.ModNScalar
+	chainCode  [32]byte
+}
+
+// NewMasterKey returns the BIP-32 master key for a seed, which must be between 16 and 64 bytes
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed length: %d", len(seed))
+	}
+	mac := hmac.New(sha512.New, masterKeyHMACKey)
+	mac.Write(seed)
+	return newExtendedKey(mac.Sum(nil), nil)
+}
+
+// NewMasterKeyFromMnemonic validates the mnemonic, and returns the BIP-32 master key for its seed
+func NewMasterKeyFromMnemonic(mnemonic, passphrase string) (*ExtendedKey, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	return NewMasterKey(MnemonicToSeed(mnemonic, passphrase))
+}
+
+// newExtendedKey builds a key from the output of the HMAC-SHA512 in BIP-32, adding the parent key
+// (if not the master key). Invalid keys have a probability lower than 1 in 2^127 for any index.
+func newExtendedKey(i []byte, parent *btcec.ModNScalar) (*ExtendedKey, error) {
+	k := &ExtendedKey{}
+	if overflow := k.privateKey.SetByteSlice(i[:32]); overflow {
+		return nil, fmt.Errorf("derived key is not less than the secp256k1 curve order")
+	}
+	if parent != nil {
+		k.privateKey.Add(parent)
+	}
+	if k.privateKey.IsZero() {
+		return nil, fmt.Errorf("derived key is zero")
+	}
+	copy(k.chainCode[:], i[32:])
+	return k, nil
+}
+
+// Child derives the child key at the supplied index. Indexes from HardenedKeyStart are hardened.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	var data []byte
+	if index >= HardenedKeyStart {
+		privateKey := k.privateKey.Bytes()
+		data = append([]byte{0x00}, privateKey[:]...)
+	} else {
+		data = k.KeyPair().PublicKey.SerializeCompressed()
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+	mac := hmac.New(sha512.New, k.chainCode[:])
+	mac.Write(data)
+	return newExtendedKey(mac.Sum(nil), &k.privateKey)
+}
+
+// Derive derives the key at a path of child indexes, relative to this key
+func (k *ExtendedKey) Derive(path []uint32) (key *ExtendedKey, err error) {
+	key = k
+	for _, index := range path {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// DerivePath parses and derives a path such as "m/44'/60'/0'/0/0", relative to this key
+func (k *ExtendedKey) DerivePath(path string) (*ExtendedKey, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return k.Derive(indexes)
+}
+
+// PrivateKeyBytes returns the 32 byte private key
+func (k *ExtendedKey) PrivateKeyBytes() []byte {
+	b := k.privateKey.Bytes()
+	return b[:]
+}
+
+// ChainCode returns the 32 byte chain code
+func (k *ExtendedKey) ChainCode() []byte {
+	return append([]byte{}, k.chainCode[:]...)
+}
+
+// KeyPair returns the secp256k1 key pair (and Ethereum address) for this key
+func (k *ExtendedKey) KeyPair() *secp256k1.KeyPair {
+	return secp256k1.KeyPairFromBytes(k.PrivateKeyBytes())
+}
+
+// ParseDerivationPath parses a BIP-32 path such as "m/44'/60'/0'/0/0" into child indexes.
+// Hardened indexes are marked with a ' or h suffix, and the leading "m/" is optional.
+func ParseDerivationPath(path string) ([]uint32, error) {
+	path = strings.TrimSpace(path)
+	if path == "m" || path == "" {
+		return []uint32{}, nil
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "m/"), "/")
+	indexes := make([]uint32, len(segments))
+	for i, segment := range segments {
+		hardened := false
+		if trimmed := strings.TrimRight(segment, "'hH"); trimmed != segment {
+			hardened = segment == trimmed+"'" || segment == trimmed+"h" || segment == trimmed+"H"
+			if !hardened {
+				return nil, fmt.Errorf("invalid derivation path '%s': bad segment '%s'", path, segment)
+			}
+			segment = trimmed
+		}
+		index, err := strconv.ParseUint(segment, 10, 32)
+		if err != nil || uint32(index) >= HardenedKeyStart {
+			return nil, fmt.Errorf("invalid derivation path '%s': bad segment '%s'", path, segments[i])
+		}
+		indexes[i] = uint32(index)
+		if hardened {
+			indexes[i] += HardenedKeyStart
+		}
+	}
+	return indexes, nil
+}
@@ -0,0 +1,100 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBIP32Vector1(t *testing.T) {
+	// Test vector 1 from https://github.com/bitcoin/bips/blob/master/bip-0032.mediawiki
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	assert.NoError(t, err)
+	assert.Equal(t, "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35", hex.EncodeToString(master.PrivateKeyBytes()))
+	assert.Equal(t, "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508", hex.EncodeToString(master.ChainCode()))
+
+	for path, expected := range map[string]string{
+		"m":                        "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35",
+		"m/0'":                     "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea",
+		"m/0H/1":                   "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368",
+		"m/0h/1/2h":                "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca",
+		"m/0'/1/2'/2":              "0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4",
+		"0'/1/2'/2/1000000000":     "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8",
+		" m/0'/1/2'/2/1000000000 ": "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8",
+	} {
+		key, err := master.DerivePath(path)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, hex.EncodeToString(key.PrivateKeyBytes()), path)
+	}
+}
+
+func TestMnemonicEthereumAccount(t *testing.T) {
+	master, err := NewMasterKeyFromMnemonic(mnemonicTestVectors[0].mnemonic, "")
+	assert.NoError(t, err)
+
+	key, err := master.DerivePath(DefaultDerivationPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x9858effd232b4033e47d90003d41ec34ecaeda94", key.KeyPair().Address.String())
+}
+
+func TestNewMasterKeyErrors(t *testing.T) {
+	_, err := NewMasterKey(make([]byte, 15))
+	assert.Regexp(t, "invalid seed length: 15", err)
+
+	_, err = NewMasterKeyFromMnemonic("abandon", "")
+	assert.Regexp(t, "invalid mnemonic word count", err)
+}
+
+func TestNewExtendedKeyInvalid(t *testing.T) {
+	// IL not less than N
+	_, err := newExtendedKey(bytes.Repeat([]byte{0xff}, 64), nil)
+	assert.Regexp(t, "not less than the secp256k1 curve order", err)
+
+	// IL of zero for the master key
+	_, err = newExtendedKey(make([]byte, 64), nil)
+	assert.Regexp(t, "zero", err)
+
+	// IL + parent == N
+	var parent btcec.ModNScalar
+	parent.SetInt(1)
+	il := new(big.Int).Sub(btcec.S256().N, big.NewInt(1))
+	_, err = newExtendedKey(append(il.FillBytes(make([]byte, 32)), make([]byte, 32)...), &parent)
+	assert.Regexp(t, "zero", err)
+}
+
+func TestDeriveErrors(t *testing.T) {
+	master, err := NewMasterKey(make([]byte, 16))
+	assert.NoError(t, err)
+
+	for _, path := range []string{
+		"m/x",
+		"m/1'x",
+		"m/1''",
+		"m/2147483648",
+		"m//1",
+	} {
+		_, err = master.DerivePath(path)
+		assert.Regexp(t, "invalid derivation path", err, path)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdwallet
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	mnemonicSeedIterations = 2048
+	mnemonicSeedLength     = 64
+	mnemonicBitsPerWord    = 11
+)
+
+// The BIP-39 English wordlist: https://github.com/bitcoin/bips/blob/master/bip-0039/english.txt
+//
+//go:embed english.txt
+var englishWordlistFile string
+
+var (
+	englishWordlist  = strings.Fields(englishWordlistFile)
+	englishWordIndex = indexWordlist(englishWordlist)
+)
+
+func indexWordlist(wordlist []string) map[string]int {
+	index := make(map[string]int, len(wordlist))
+	for i, word := range wordlist {
+		index[word] = i
+	}
+	return index
+}
+
+// mnemonicWords splits a mnemonic into its NFKD normalized words, so that any whitespace
+// (such as a trailing newline in a file) is accepted between and around the words
+func mnemonicWords(mnemonic string) []string {
+	return strings.Fields(norm.NFKD.String(mnemonic))
+}
+
+// NewMnemonic returns the BIP-39 English mnemonic for the supplied entropy,
+// which must be 16, 20, 24, 28 or 32 bytes (for 12 to 24 words)
+func NewMnemonic(entropy []byte) (string, error) {
+	entropyBits := len(entropy) * 8
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return "", fmt.Errorf("invalid mnemonic entropy length: %d", len(entropy))
+	}
+	checksumBits := entropyBits / 32
+	hash := sha256.Sum256(entropy)
+
+	// Entropy followed by the first checksumBits of the hash, split into 11 bit words
+	b := new(big.Int).SetBytes(entropy)
+	b.Lsh(b, uint(checksumBits))
+	b.Or(b, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	words := make([]string, (entropyBits+checksumBits)/mnemonicBitsPerWord)
+	mask := big.NewInt(1<<mnemonicBitsPerWord - 1)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = englishWordlist[new(big.Int).And(b, mask).Int64()]
+		b.Rsh(b, mnemonicBitsPerWord)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// ValidateMnemonic checks the mnemonic is 12 to 24 words from the BIP-39 English
+// wordlist, with a valid checksum
+func ValidateMnemonic(mnemonic string) error {
+	words := mnemonicWords(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return fmt.Errorf("invalid mnemonic word count: %d", len(words))
+	}
+
+	b := new(big.Int)
+	for i, word := range words {
+		idx, ok := englishWordIndex[word]
+		if !ok {
+			return fmt.Errorf("invalid mnemonic: word %d is not in the BIP-39 English wordlist", i+1)
+		}
+		b.Lsh(b, mnemonicBitsPerWord)
+		b.Or(b, big.NewInt(int64(idx)))
+	}
+
+	totalBits := len(words) * mnemonicBitsPerWord
+	checksumBits := totalBits / 33
+	checksum := new(big.Int).And(b, big.NewInt(1<<checksumBits-1)).Int64()
+	entropy := make([]byte, (totalBits-checksumBits)/8)
+	b.Rsh(b, uint(checksumBits)).FillBytes(entropy)
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return fmt.Errorf("invalid mnemonic: checksum mismatch")
+	}
+	return nil
+}
+
+// MnemonicToSeed returns the 64 byte BIP-39 seed for a mnemonic and optional passphrase.
+// The mnemonic is not validated, so call ValidateMnemonic first if required.
+func MnemonicToSeed(mnemonic, passphrase string) []byte {
+	return pbkdf2.Key(
+		[]byte(strings.Join(mnemonicWords(mnemonic), " ")),
+		[]byte("mnemonic"+norm.NFKD.String(passphrase)),
+		mnemonicSeedIterations, mnemonicSeedLength, sha512.New,
+	)
+}
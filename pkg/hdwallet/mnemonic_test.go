@@ -0,0 +1,87 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdwallet
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors from https://github.com/trezor/python-mnemonic/blob/master/vectors.json
+var mnemonicTestVectors = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		entropy:  "00000000000000000000000000000000",
+		mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		seed:     "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		entropy:  "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		mnemonic: "legal winner thank year wave sausage worth useful legal winner thank yellow",
+		seed:     "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		entropy:  "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+		seed:     "dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+	},
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	assert.Len(t, englishWordlist, 2048)
+	for _, v := range mnemonicTestVectors {
+		entropy, err := hex.DecodeString(v.entropy)
+		assert.NoError(t, err)
+
+		mnemonic, err := NewMnemonic(entropy)
+		assert.NoError(t, err)
+		assert.Equal(t, v.mnemonic, mnemonic)
+		assert.NoError(t, ValidateMnemonic(mnemonic))
+
+		assert.Equal(t, v.seed, hex.EncodeToString(MnemonicToSeed(mnemonic, "TREZOR")))
+	}
+}
+
+func TestMnemonicWhitespace(t *testing.T) {
+	v := mnemonicTestVectors[0]
+	mnemonic := "\n  " + v.mnemonic + "\r\n"
+	assert.NoError(t, ValidateMnemonic(mnemonic))
+	assert.Equal(t, v.seed, hex.EncodeToString(MnemonicToSeed(mnemonic, "TREZOR")))
+}
+
+func TestNewMnemonicBadEntropy(t *testing.T) {
+	_, err := NewMnemonic(make([]byte, 15))
+	assert.Regexp(t, "invalid mnemonic entropy length: 15", err)
+	_, err = NewMnemonic(make([]byte, 36))
+	assert.Regexp(t, "invalid mnemonic entropy length: 36", err)
+}
+
+func TestValidateMnemonicErrors(t *testing.T) {
+	err := ValidateMnemonic("abandon abandon abandon")
+	assert.Regexp(t, "invalid mnemonic word count: 3", err)
+
+	err = ValidateMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon notaword")
+	assert.Regexp(t, "word 12 is not in the BIP-39 English wordlist", err)
+
+	err = ValidateMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")
+	assert.Regexp(t, "checksum mismatch", err)
+}
@@ -0,0 +1,131 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8swallet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+)
+
+const (
+	// SourceAPI list and watch the Secrets through the Kubernetes API
+	SourceAPI = "api"
+	// SourceVolume read the Secrets from a (projected) volume mounted into the pod
+	SourceVolume = "volume"
+)
+
+const (
+	// ConfigSource where the Secrets are read from - api (default) / volume
+	ConfigSource = "source"
+	// ConfigPath the directory the Secret volume is mounted at, with the volume source. Each subdirectory is a Secret, or the directory itself if it holds the keystore entry directly.
+	ConfigPath = "path"
+	// ConfigNamespace the namespace of the Secrets, with the api source - defaults to the namespace of the pod
+	ConfigNamespace = "namespace"
+	// ConfigLabelSelector the label selector for the Secrets holding keys, with the api source
+	ConfigLabelSelector = "labelSelector"
+	// ConfigTokenFile the service account token sent to the Kubernetes API, re-read on every request as it is rotated
+	ConfigTokenFile = "tokenFile"
+	// ConfigKeystoreEntry the name of the Secret data entry holding the Keystore V3 file
+	ConfigKeystoreEntry = "keystoreEntry"
+	// ConfigPasswordEntry the name of the Secret data entry holding the password of the Keystore V3 file
+	ConfigPasswordEntry = "passwordEntry"
+	// ConfigWatchTimeout the time after which the Kubernetes API closes a watch, which is then re-established
+	ConfigWatchTimeout = "watch.timeout"
+	// ConfigWatchReconnectDelay the delay before re-listing the Secrets after a watch fails
+	ConfigWatchReconnectDelay = "watch.reconnectDelay"
+)
+
+// serviceAccountDir is where Kubernetes mounts the service account token, CA and namespace into a pod
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+type Config struct {
+	HTTP          ffresty.Config
+	Source        string
+	Path          string
+	Namespace     string
+	LabelSelector string
+	TokenFile     string
+	KeystoreEntry string
+	PasswordEntry string
+	Watch         WatchConfig
+}
+
+type WatchConfig struct {
+	Timeout        time.Duration
+	ReconnectDelay time.Duration
+}
+
+func InitConfig(section config.Section) {
+	ffresty.InitConfig(section)
+	section.AddKnownKey(ConfigSource, SourceAPI)
+	section.AddKnownKey(ConfigPath)
+	section.AddKnownKey(ConfigNamespace)
+	section.AddKnownKey(ConfigLabelSelector, "firefly-signer/key")
+	section.AddKnownKey(ConfigTokenFile, filepath.Join(serviceAccountDir, "token"))
+	section.AddKnownKey(ConfigKeystoreEntry, "keystore")
+	section.AddKnownKey(ConfigPasswordEntry, "password")
+	section.AddKnownKey(ConfigWatchTimeout, "5m")
+	section.AddKnownKey(ConfigWatchReconnectDelay, "5s")
+}
+
+// ReadConfig reads the configuration, defaulting the API URL, CA and namespace to those of the cluster
+// when running in a pod
+func ReadConfig(ctx context.Context, section config.Section) (*Config, error) {
+	httpConf, err := ffresty.GenerateConfig(ctx, section)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{
+		HTTP:          *httpConf,
+		Source:        section.GetString(ConfigSource),
+		Path:          section.GetString(ConfigPath),
+		Namespace:     section.GetString(ConfigNamespace),
+		LabelSelector: section.GetString(ConfigLabelSelector),
+		TokenFile:     section.GetString(ConfigTokenFile),
+		KeystoreEntry: section.GetString(ConfigKeystoreEntry),
+		PasswordEntry: section.GetString(ConfigPasswordEntry),
+		Watch: WatchConfig{
+			Timeout:        section.GetDuration(ConfigWatchTimeout),
+			ReconnectDelay: section.GetDuration(ConfigWatchReconnectDelay),
+		},
+	}
+	if conf.HTTP.URL == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		conf.HTTP.URL = "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	}
+	if conf.HTTP.TLSClientConfig == nil {
+		if ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")); err == nil {
+			rootCAs := x509.NewCertPool()
+			rootCAs.AppendCertsFromPEM(ca)
+			conf.HTTP.TLSClientConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+		}
+	}
+	if conf.Namespace == "" {
+		if ns, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace")); err == nil {
+			conf.Namespace = strings.TrimSpace(string(ns))
+		}
+	}
+	return conf, nil
+}
@@ -0,0 +1,376 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package k8swallet is a wallet of Keystore V3 files held in Kubernetes Secrets, read through the Kubernetes
+// API or from a Secret volume mounted into the pod. The Secrets are watched, so keys added, removed or rotated
+// by the platform are picked up without a restart.
+package k8swallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+// Wallet signs with the Keystore V3 files in Kubernetes Secrets. Each Secret holds one key, as a keystore
+// entry with its password in a password entry.
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	ethsigner.HealthCheckWallet
+}
+
+type k8sWallet struct {
+	conf        Config
+	client      *resty.Client // nil with the volume source
+	watchClient *resty.Client // without a request timeout, as a watch is a long running request
+	watchCtx    context.Context
+	cancelCtx   context.CancelFunc
+	watchDone   chan struct{} // set when Initialize starts the watch, and closed when it exits - guarded by the mux
+
+	refreshMux sync.Mutex // serializes updates to the secrets
+
+	mux         sync.Mutex
+	closed      bool
+	secrets     map[string]map[string][]byte // the data of each secret, by name
+	keys        map[ethtypes.Address0xHex]*secretKey
+	addressList []*ethtypes.Address0xHex // in the order of the secret names
+}
+
+// secretKey is the keystore and password from a secret, and the key pair once it has been decrypted.
+// The key pair is zeroed when the secret is rotated or removed, and signers take a copy of it.
+type secretKey struct {
+	name     string
+	keystore []byte
+	password []byte
+
+	mux     sync.Mutex
+	keypair *secp256k1.KeyPair
+}
+
+func NewK8sWallet(ctx context.Context, conf *Config) (Wallet, error) {
+	w := &k8sWallet{
+		conf:    *conf,
+		secrets: make(map[string]map[string][]byte),
+		keys:    make(map[ethtypes.Address0xHex]*secretKey),
+	}
+	switch conf.Source {
+	case SourceAPI:
+		if conf.Namespace == "" {
+			return nil, i18n.NewError(ctx, signermsgs.MsgK8sWalletNoNamespace)
+		}
+		httpConf := conf.HTTP
+		httpConf.OnBeforeRequest = w.authorize
+		w.client = ffresty.NewWithConfig(ctx, httpConf)
+		httpConf.HTTPRequestTimeout = 0
+		httpConf.Retry = false
+		w.watchClient = ffresty.NewWithConfig(ctx, httpConf)
+	case SourceVolume:
+		if conf.Path == "" {
+			return nil, i18n.NewError(ctx, signermsgs.MsgK8sWalletNoPath)
+		}
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgK8sWalletUnknownSource, conf.Source)
+	}
+	w.watchCtx, w.cancelCtx = context.WithCancel(log.WithLogField(context.Background(), "wallet", "k8s"))
+	return w, nil
+}
+
+// Initialize reads the secrets, and starts watching them for changes
+func (w *k8sWallet) Initialize(ctx context.Context) error {
+	if w.conf.Source == SourceVolume {
+		watcher, err := w.newVolumeWatcher()
+		if err != nil {
+			return i18n.WrapError(ctx, err, signermsgs.MsgFailedToStartListener, err)
+		}
+		if err := w.Refresh(ctx); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+		go w.volumeWatchLoop(watcher, w.startWatch())
+		return nil
+	}
+	resourceVersion, err := w.listSecrets(ctx)
+	if err != nil {
+		return err
+	}
+	go w.apiWatchLoop(resourceVersion, w.startWatch())
+	return nil
+}
+
+func (w *k8sWallet) startWatch() chan struct{} {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.watchDone = make(chan struct{})
+	return w.watchDone
+}
+
+// Refresh re-reads all the secrets. They are watched once the wallet is initialized, so this is only
+// needed to recover from a missed update.
+func (w *k8sWallet) Refresh(ctx context.Context) error {
+	if w.conf.Source == SourceVolume {
+		secrets, err := readVolume(w.conf.Path)
+		if err != nil {
+			return err
+		}
+		w.setSecrets(ctx, secrets)
+		return nil
+	}
+	_, err := w.listSecrets(ctx)
+	return err
+}
+
+// HealthCheck checks the Secret volume can be read, or that the service account can list the Secrets through
+// the Kubernetes API, without re-indexing the keys
+func (w *k8sWallet) HealthCheck(ctx context.Context) error {
+	w.mux.Lock()
+	closed := w.closed
+	w.mux.Unlock()
+	if closed {
+		return i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	if w.conf.Source == SourceVolume {
+		if _, err := os.ReadDir(w.conf.Path); err != nil {
+			return i18n.NewError(ctx, signermsgs.MsgWalletDirUnreadable, w.conf.Path, err)
+		}
+		return nil
+	}
+	res, err := w.client.R().
+		SetContext(ctx).
+		SetQueryParam("labelSelector", w.conf.LabelSelector).
+		SetQueryParam("limit", "1").
+		Get(w.secretsPath())
+	if err != nil || res.IsError() {
+		return ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgK8sRequestFailed)
+	}
+	return nil
+}
+
+// setSecrets replaces all the secrets, and re-indexes the keys
+func (w *k8sWallet) setSecrets(ctx context.Context, secrets map[string]map[string][]byte) {
+	w.refreshMux.Lock()
+	defer w.refreshMux.Unlock()
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.secrets = secrets
+	w.index(ctx)
+}
+
+// updateSecret adds, replaces or (with nil data) removes one secret, and re-indexes the keys
+func (w *k8sWallet) updateSecret(ctx context.Context, name string, data map[string][]byte) {
+	w.refreshMux.Lock()
+	defer w.refreshMux.Unlock()
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if data == nil {
+		delete(w.secrets, name)
+	} else {
+		w.secrets[name] = data
+	}
+	w.index(ctx)
+}
+
+// index rebuilds the keys from the secrets, keeping any decrypted key pair where the keystore and password
+// are unchanged. Called with the mux held.
+func (w *k8sWallet) index(ctx context.Context) {
+	names := make([]string, 0, len(w.secrets))
+	for name := range w.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	keys := make(map[ethtypes.Address0xHex]*secretKey, len(names))
+	addressList := make([]*ethtypes.Address0xHex, 0, len(names))
+	for _, name := range names {
+		data := w.secrets[name]
+		keystore, ok := data[w.conf.KeystoreEntry]
+		if !ok {
+			log.L(ctx).Tracef("Ignoring secret '%s' with no %s entry", name, w.conf.KeystoreEntry)
+			continue
+		}
+		password := []byte(strings.TrimSpace(string(data[w.conf.PasswordEntry])))
+		sk := &secretKey{name: name, keystore: keystore, password: password}
+		addr, err := sk.address(ctx)
+		if err != nil {
+			log.L(ctx).Errorf("Ignoring secret '%s': %s", name, err)
+			continue
+		}
+		if existing, ok := keys[*addr]; ok {
+			log.L(ctx).Warnf("Secret '%s' has the same address %s as secret '%s'", name, addr, existing.name)
+			sk.destroy()
+			continue
+		}
+		if existing, ok := w.keys[*addr]; ok && bytes.Equal(existing.keystore, keystore) && bytes.Equal(existing.password, password) {
+			sk.destroy()
+			sk = existing
+		} else if ok {
+			log.L(ctx).Infof("Key for address %s rotated (secret=%s)", addr, name)
+		} else {
+			log.L(ctx).Debugf("Added address: %s (secret=%s)", addr, name)
+		}
+		keys[*addr] = sk
+		addressList = append(addressList, addr)
+	}
+	for addr, sk := range w.keys {
+		if keys[addr] != sk {
+			if _, ok := keys[addr]; !ok {
+				log.L(ctx).Infof("Removed address: %s (secret=%s)", addr, sk.name)
+			}
+			sk.destroy()
+		}
+	}
+	w.keys = keys
+	w.addressList = addressList
+}
+
+// address returns the address in the keystore file, or decrypts it if the file does not contain the address
+func (sk *secretKey) address(ctx context.Context) (*ethtypes.Address0xHex, error) {
+	var header struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(sk.keystore, &header); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgK8sSecretInvalid, sk.name, err)
+	}
+	if addr, err := ethtypes.NewAddress(header.Address); err == nil {
+		return addr, nil
+	}
+	keypair, err := sk.copy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return &keypair.Address, nil
+}
+
+// GetAccounts returns the addresses of the keys in the secrets
+func (w *k8sWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+func (w *k8sWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *k8sWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	keypair, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return txn.SignBig(keypair, chainID)
+}
+
+func (w *k8sWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	keypair, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return ethsigner.SignTypedDataV4(ctx, keypair, payload)
+}
+
+// getSignerForAddr returns a copy of the key pair for the address, which the caller destroys once it has
+// finished signing. The keystore is decrypted on first use.
+func (w *k8sWallet) getSignerForAddr(ctx context.Context, addr ethtypes.Address0xHex) (*secp256k1.KeyPair, error) {
+	w.mux.Lock()
+	closed, sk := w.closed, w.keys[addr]
+	w.mux.Unlock()
+	if closed {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	if sk == nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+	}
+	keypair, err := sk.copy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if keypair.Address != addr {
+		keypair.Destroy()
+		return nil, i18n.NewError(ctx, signermsgs.MsgAddressMismatch, keypair.Address, addr)
+	}
+	return keypair, nil
+}
+
+// copy returns a copy of the key pair, decrypting the keystore if it has not been already
+func (sk *secretKey) copy(ctx context.Context) (*secp256k1.KeyPair, error) {
+	sk.mux.Lock()
+	defer sk.mux.Unlock()
+	if sk.keypair == nil {
+		wf, err := keystorev3.ReadWalletFileCtx(ctx, sk.keystore, sk.password)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgK8sSecretInvalid, sk.name, err)
+		}
+		sk.keypair = wf.KeyPair()
+		log.L(ctx).Infof("Loaded signing key for address: %s (secret=%s)", sk.keypair.Address, sk.name)
+	}
+	return secp256k1.KeyPairFromBytes(sk.keypair.PrivateKeyBytes()), nil
+}
+
+// destroy zeroes the key pair, which is decrypted again if the key is used after being rotated
+func (sk *secretKey) destroy() {
+	sk.mux.Lock()
+	defer sk.mux.Unlock()
+	if sk.keypair != nil {
+		sk.keypair.Destroy()
+		sk.keypair = nil
+	}
+}
+
+// Close stops the watch, and zeroes all the decrypted keys
+func (w *k8sWallet) Close() error {
+	w.mux.Lock()
+	if w.closed {
+		w.mux.Unlock()
+		return nil
+	}
+	w.closed = true
+	watchDone := w.watchDone
+	w.mux.Unlock()
+	w.cancelCtx()
+	if watchDone != nil {
+		<-watchDone
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for _, sk := range w.keys {
+		sk.destroy()
+	}
+	return nil
+}
@@ -0,0 +1,503 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8swallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeystore(t *testing.T, password string) (*secp256k1.KeyPair, []byte) {
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	return kp, keystorev3.NewWalletFileLight(password, kp).JSON()
+}
+
+func signTestTransaction(ctx context.Context, w Wallet, from ethtypes.Address0xHex) error {
+	signed, err := w.Sign(ctx, &ethsigner.Transaction{
+		From:  json.RawMessage(fmt.Sprintf(`"%s"`, from)),
+		Nonce: ethtypes.NewHexInteger64(1),
+	}, 2022)
+	if err == nil {
+		var addr *ethtypes.Address0xHex
+		if addr, _, err = ethsigner.RecoverRawTransaction(ctx, signed, 2022); err == nil && *addr != from {
+			err = fmt.Errorf("signed by %s", addr)
+		}
+	}
+	return err
+}
+
+func accounts(t *testing.T, w Wallet) []*ethtypes.Address0xHex {
+	accounts, err := w.GetAccounts(context.Background())
+	assert.NoError(t, err)
+	return accounts
+}
+
+// writeVolume writes the files as the kubelet does - into a new timestamped directory, that the ..data link
+// is then switched to atomically, with a link through ..data for each top level entry
+func writeVolume(t *testing.T, root string, files map[string]string) {
+	tsDir := fmt.Sprintf("..%d", time.Now().UnixNano())
+	for name, content := range files {
+		p := filepath.Join(root, tsDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0600))
+	}
+	assert.NoError(t, os.Symlink(tsDir, filepath.Join(root, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(root, "..data_tmp"), filepath.Join(root, "..data")))
+	entries, _ := os.ReadDir(filepath.Join(root, tsDir))
+	for _, e := range entries {
+		link := filepath.Join(root, e.Name())
+		if _, err := os.Lstat(link); err != nil {
+			assert.NoError(t, os.Symlink(filepath.Join("..data", e.Name()), link))
+		}
+	}
+}
+
+func newTestVolumeWallet(t *testing.T) (context.Context, string, Wallet) {
+	root := t.TempDir()
+	w, err := NewK8sWallet(context.Background(), &Config{
+		Source:        SourceVolume,
+		Path:          root,
+		KeystoreEntry: "keystore",
+		PasswordEntry: "password",
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	return context.Background(), root, w
+}
+
+func TestVolumeWalletRotation(t *testing.T) {
+
+	ctx, root, w := newTestVolumeWallet(t)
+	kp1, ks1 := newTestKeystore(t, "pass1")
+	kp2, ks2 := newTestKeystore(t, "pass2")
+	writeVolume(t, root, map[string]string{
+		"key1/keystore": string(ks1),
+		"key1/password": "pass1\n",
+		"key2/keystore": string(ks2),
+		"key2/password": "pass2",
+		"other/config":  "not a key",
+	})
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&kp1.Address, &kp2.Address}, accounts(t, w))
+	assert.NoError(t, signTestTransaction(ctx, w, kp1.Address))
+
+	result, err := w.SignTypedDataV4(ctx, kp2.Address, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.NoError(t, err)
+	sig, err := secp256k1.DecodeCompactRSV(ctx, result.SignatureRSV)
+	assert.NoError(t, err)
+	addr, err := sig.RecoverDirect(result.Hash, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, kp2.Address, *addr)
+
+	// The platform rotates key2 to a new key, and re-encrypts key1 with a new password
+	kp3, ks3 := newTestKeystore(t, "pass3")
+	ks1Rotated := keystorev3.NewWalletFileLight("pass1-rotated", kp1).JSON()
+	writeVolume(t, root, map[string]string{
+		"key1/keystore": string(ks1Rotated),
+		"key1/password": "pass1-rotated",
+		"key2/keystore": string(ks3),
+		"key2/password": "pass3",
+	})
+	assert.Eventually(t, func() bool {
+		accounts := accounts(t, w)
+		return len(accounts) == 2 && *accounts[1] == kp3.Address
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, signTestTransaction(ctx, w, kp1.Address))
+	assert.NoError(t, signTestTransaction(ctx, w, kp3.Address))
+	assert.Regexp(t, "FF22014", signTestTransaction(ctx, w, kp2.Address))
+
+	err = w.Close()
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Regexp(t, "FF22103", signTestTransaction(ctx, w, kp1.Address))
+
+}
+
+func TestVolumeWalletSingleSecret(t *testing.T) {
+
+	ctx, root, w := newTestVolumeWallet(t)
+	kp, ks := newTestKeystore(t, "pass")
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "keystore"), ks, 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "password"), []byte("pass"), 0600))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "plain"), 0700))
+	assert.NoError(t, os.Symlink("missing", filepath.Join(root, "broken")))
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&kp.Address}, accounts(t, w))
+
+	// A plain subdirectory is watched too
+	kp2, ks2 := newTestKeystore(t, "pass2")
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "plain", "password"), []byte("pass2"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "plain", "keystore"), ks2, 0600))
+	assert.Eventually(t, func() bool {
+		return len(accounts(t, w)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, signTestTransaction(ctx, w, kp2.Address))
+
+	assert.NoError(t, os.Remove(filepath.Join(root, "keystore")))
+	assert.Eventually(t, func() bool {
+		return len(accounts(t, w)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+}
+
+func TestVolumeWalletInvalidKeys(t *testing.T) {
+
+	ctx, root, w := newTestVolumeWallet(t)
+	kp1, ks1 := newTestKeystore(t, "pass1")
+	kp2 := keystorev3.NewWalletFileLight("pass2", kp1)
+	kp2.Metadata()["address"] = nil
+	kp3, ks3 := newTestKeystore(t, "pass3")
+	writeVolume(t, root, map[string]string{
+		"a-key/keystore":       string(ks1),
+		"a-key/password":       "wrong",
+		"b-duplicate/keystore": string(kp2.JSON()),
+		"b-duplicate/password": "pass2",
+		"c-badjson/keystore":   "!json",
+		"d-noaddr/keystore":    `{"address":"bad"}`,
+		"e-key/keystore":       string(ks3),
+		"e-key/password":       "pass3",
+	})
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&kp1.Address, &kp3.Address}, accounts(t, w))
+	assert.Regexp(t, "FF22218.*a-key", signTestTransaction(ctx, w, kp1.Address))
+	assert.NoError(t, signTestTransaction(ctx, w, kp3.Address))
+
+	// A keystore with an address field that is not the address of its key
+	_, ks4 := newTestKeystore(t, "pass4")
+	var lying map[string]interface{}
+	assert.NoError(t, json.Unmarshal(ks4, &lying))
+	lying["address"] = ethtypes.AddressPlainHex(kp3.Address).String()
+	b, _ := json.Marshal(lying)
+	w.(*k8sWallet).setSecrets(ctx, map[string]map[string][]byte{
+		"lying": {"keystore": b, "password": []byte("pass4")},
+	})
+	assert.Regexp(t, "FF22059", signTestTransaction(ctx, w, kp3.Address))
+	_, err = w.SignTypedDataV4(ctx, kp1.Address, &eip712.TypedData{})
+	assert.Regexp(t, "FF22014", err)
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"bad"`)}, 2022)
+	assert.Error(t, err)
+
+}
+
+func TestVolumeWalletMissingPath(t *testing.T) {
+
+	ctx, root, w := newTestVolumeWallet(t)
+	assert.NoError(t, w.HealthCheck(ctx))
+	assert.NoError(t, os.Remove(root))
+	err := w.Initialize(ctx)
+	assert.Regexp(t, "FF22060", err)
+	err = w.Refresh(ctx)
+	assert.Error(t, err)
+	assert.Regexp(t, "FF22220", w.HealthCheck(ctx))
+
+}
+
+// testAPIServer serves the secrets list and watch of the Kubernetes API, streaming the events sent to it
+type testAPIServer struct {
+	server   *httptest.Server
+	mux      sync.Mutex
+	items    []*secret
+	listErr  bool
+	lists    int
+	watches  []string // the resource version of each watch
+	events   chan *watchEvent
+	tokens   []string
+	watchErr bool
+}
+
+func newTestAPIServer(t *testing.T) *testAPIServer {
+	as := &testAPIServer{events: make(chan *watchEvent)}
+	as.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/namespaces/ns1/secrets", r.URL.Path)
+		assert.Equal(t, "firefly-signer/key", r.URL.Query().Get("labelSelector"))
+		as.mux.Lock()
+		as.tokens = append(as.tokens, r.Header.Get("Authorization"))
+		if r.URL.Query().Get("watch") != "true" {
+			as.lists++
+			listErr, list := as.listErr, &secretList{Metadata: secretMetadata{ResourceVersion: "100"}, Items: as.items}
+			as.mux.Unlock()
+			if listErr {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(list)
+			return
+		}
+		as.watches = append(as.watches, r.URL.Query().Get("resourceVersion"))
+		watchErr := as.watchErr
+		as.mux.Unlock()
+		if watchErr {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-as.events:
+				if !ok || event == nil {
+					return // the watch timeout
+				}
+				_ = json.NewEncoder(w).Encode(event)
+				w.(http.Flusher).Flush()
+				if event.Type == "ERROR" {
+					return // the API server ends the watch after an error
+				}
+			}
+		}
+	}))
+	t.Cleanup(as.server.Close)
+	return as
+}
+
+func (as *testAPIServer) send(t *testing.T, eventType string, obj interface{}) {
+	b, err := json.Marshal(obj)
+	assert.NoError(t, err)
+	as.events <- &watchEvent{Type: eventType, Object: b}
+}
+
+func (as *testAPIServer) stats() (int, []string, []string) {
+	as.mux.Lock()
+	defer as.mux.Unlock()
+	return as.lists, append([]string{}, as.watches...), append([]string{}, as.tokens...)
+}
+
+func newTestAPIWallet(t *testing.T, as *testAPIServer) (context.Context, Wallet) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("token1\n"), 0600))
+	config.RootConfigReset()
+	section := config.RootSection("k8sWallet")
+	InitConfig(section)
+	section.Set(ffresty.HTTPConfigURL, as.server.URL)
+	section.Set(ffresty.HTTPConfigRetryEnabled, false)
+	section.Set(ConfigNamespace, "ns1")
+	section.Set(ConfigTokenFile, tokenFile)
+	section.Set(ConfigWatchReconnectDelay, "1ms")
+	conf, err := ReadConfig(context.Background(), section)
+	assert.NoError(t, err)
+	w, err := NewK8sWallet(context.Background(), conf)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	return context.Background(), w
+}
+
+func newTestSecret(name, rv string, keystore []byte, password string) *secret {
+	return &secret{
+		Metadata: secretMetadata{Name: name, ResourceVersion: rv},
+		Data:     map[string][]byte{"keystore": keystore, "password": []byte(password)},
+	}
+}
+
+func TestAPIWalletWatch(t *testing.T) {
+
+	as := newTestAPIServer(t)
+	kp1, ks1 := newTestKeystore(t, "pass1")
+	as.items = []*secret{newTestSecret("key1", "90", ks1, "pass1")}
+	ctx, w := newTestAPIWallet(t, as)
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&kp1.Address}, accounts(t, w))
+	assert.NoError(t, signTestTransaction(ctx, w, kp1.Address))
+
+	kp2, ks2 := newTestKeystore(t, "pass2")
+	as.send(t, "ADDED", newTestSecret("key2", "101", ks2, "pass2"))
+	as.send(t, "BOOKMARK", &secret{Metadata: secretMetadata{ResourceVersion: "102"}})
+	assert.Eventually(t, func() bool { return len(accounts(t, w)) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, signTestTransaction(ctx, w, kp2.Address))
+
+	// Rotating the password of key1
+	as.send(t, "MODIFIED", newTestSecret("key1", "103", keystorev3.NewWalletFileLight("new", kp1).JSON(), "new"))
+	as.send(t, "DELETED", newTestSecret("key2", "104", ks2, "pass2"))
+	assert.Eventually(t, func() bool { return len(accounts(t, w)) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, signTestTransaction(ctx, w, kp1.Address))
+
+	// The watch timeout resumes from the last resource version
+	as.events <- nil
+	as.send(t, "BOOKMARK", &secret{Metadata: secretMetadata{ResourceVersion: "105"}})
+	lists, watches, tokens := as.stats()
+	assert.Equal(t, 1, lists)
+	assert.Equal(t, []string{"100", "104"}, watches)
+	assert.Equal(t, "Bearer token1", tokens[0])
+
+	// An error re-lists the secrets
+	as.send(t, "ERROR", &status{Code: 410, Message: "too old resource version"})
+	as.send(t, "BOOKMARK", &secret{Metadata: secretMetadata{ResourceVersion: "106"}})
+	lists, watches, _ = as.stats()
+	assert.Equal(t, 2, lists)
+	assert.Equal(t, []string{"100", "104", "100"}, watches)
+
+	err = w.Refresh(ctx)
+	assert.NoError(t, err)
+
+}
+
+func TestAPIWalletWatchErrors(t *testing.T) {
+
+	as := newTestAPIServer(t)
+	as.watchErr = true
+	ctx, w := newTestAPIWallet(t, as)
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		lists, _, _ := as.stats()
+		return lists > 2
+	}, 5*time.Second, time.Millisecond)
+
+	// Listing failures are retried too
+	as.mux.Lock()
+	as.listErr = true
+	as.mux.Unlock()
+	listsBefore, _, _ := as.stats()
+	assert.Eventually(t, func() bool {
+		lists, _, _ := as.stats()
+		return lists > listsBefore+3
+	}, 5*time.Second, time.Millisecond)
+
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22217", err)
+
+}
+
+func TestAPIWalletBadWatchEvents(t *testing.T) {
+
+	as := newTestAPIServer(t)
+	ctx, w := newTestAPIWallet(t, as)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	as.events <- &watchEvent{Type: "ADDED", Object: json.RawMessage(`"not a secret"`)}
+	assert.Eventually(t, func() bool {
+		lists, _, _ := as.stats()
+		return lists == 2
+	}, 5*time.Second, time.Millisecond)
+
+}
+
+func TestAPIWalletBadWatchStream(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"type":"ADDED","object":{}}!!!`))
+	}))
+	defer server.Close()
+	as := newTestAPIServer(t)
+	ctx, w := newTestAPIWallet(t, as)
+	kw := w.(*k8sWallet)
+
+	kw.watchClient.SetBaseURL(server.URL)
+	_, err := kw.watchSecrets(ctx, "100")
+	assert.Regexp(t, "FF22219", err)
+
+	kw.watchClient.SetBaseURL("http://localhost:0")
+	_, err = kw.watchSecrets(ctx, "100")
+	assert.Regexp(t, "FF22217", err)
+
+}
+
+func TestAPIWalletInitializeFail(t *testing.T) {
+
+	as := newTestAPIServer(t)
+	as.listErr = true
+	ctx, w := newTestAPIWallet(t, as)
+	err := w.Initialize(ctx)
+	assert.Regexp(t, "FF22217", err)
+
+}
+
+func TestAPIWalletHealthCheck(t *testing.T) {
+
+	as := newTestAPIServer(t)
+	ctx, w := newTestAPIWallet(t, as)
+	assert.NoError(t, w.HealthCheck(ctx))
+	lists, _, _ := as.stats()
+	assert.Equal(t, 1, lists)
+
+	as.mux.Lock()
+	as.listErr = true
+	as.mux.Unlock()
+	assert.Regexp(t, "FF22217", w.HealthCheck(ctx))
+
+	assert.NoError(t, w.Close())
+	assert.Regexp(t, "FF22103", w.HealthCheck(ctx))
+
+}
+
+func TestNewK8sWalletBadConfig(t *testing.T) {
+
+	_, err := NewK8sWallet(context.Background(), &Config{Source: "wrong"})
+	assert.Regexp(t, "FF22214", err)
+	_, err = NewK8sWallet(context.Background(), &Config{Source: SourceVolume})
+	assert.Regexp(t, "FF22215", err)
+	_, err = NewK8sWallet(context.Background(), &Config{Source: SourceAPI})
+	assert.Regexp(t, "FF22216", err)
+
+}
+
+func TestReadConfigInCluster(t *testing.T) {
+
+	defer func(dir string) { serviceAccountDir = dir }(serviceAccountDir)
+	serviceAccountDir = t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(serviceAccountDir, "namespace"), []byte("ns1\n"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(serviceAccountDir, "ca.crt"), []byte("not a cert"), 0600))
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+	config.RootConfigReset()
+	section := config.RootSection("k8sWallet")
+	InitConfig(section)
+	conf, err := ReadConfig(context.Background(), section)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1:443", conf.HTTP.URL)
+	assert.Equal(t, "ns1", conf.Namespace)
+	assert.NotNil(t, conf.HTTP.TLSClientConfig)
+	assert.Equal(t, "firefly-signer/key", conf.LabelSelector)
+
+	section.Set("tls.enabled", true)
+	section.Set("tls.caFile", "!!!!!badness")
+	_, err = ReadConfig(context.Background(), section)
+	assert.Regexp(t, "FF00153", err)
+
+}
@@ -0,0 +1,293 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8swallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+type secretMetadata struct {
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type secret struct {
+	Metadata secretMetadata    `json:"metadata"`
+	Data     map[string][]byte `json:"data"` // base64 decoded
+}
+
+type secretList struct {
+	Metadata secretMetadata `json:"metadata"`
+	Items    []*secret      `json:"items"`
+}
+
+// watchEvent is an event on a watch stream. The object is a secret, except for ERROR events where it is a Status.
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// authorize sends the service account token, which is re-read as the kubelet rotates it
+func (w *k8sWallet) authorize(req *resty.Request) error {
+	if token, err := os.ReadFile(w.conf.TokenFile); err == nil {
+		req.SetAuthToken(strings.TrimSpace(string(token)))
+	}
+	return nil
+}
+
+func (w *k8sWallet) secretsPath() string {
+	return "/api/v1/namespaces/" + url.PathEscape(w.conf.Namespace) + "/secrets"
+}
+
+// listSecrets replaces the secrets with those currently matching the label selector, returning the
+// resource version to watch for changes from
+func (w *k8sWallet) listSecrets(ctx context.Context) (string, error) {
+	var list secretList
+	res, err := w.client.R().
+		SetContext(ctx).
+		SetQueryParam("labelSelector", w.conf.LabelSelector).
+		SetResult(&list).
+		Get(w.secretsPath())
+	if err != nil || res.IsError() {
+		return "", ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgK8sRequestFailed)
+	}
+	secrets := make(map[string]map[string][]byte, len(list.Items))
+	for _, s := range list.Items {
+		secrets[s.Metadata.Name] = s.Data
+	}
+	w.setSecrets(ctx, secrets)
+	return list.Metadata.ResourceVersion, nil
+}
+
+// apiWatchLoop watches the secrets until the wallet is closed. A watch closed by the API server at its
+// timeout is resumed from the last resource version, and after a failure the secrets are listed again
+// before watching, in case any change was missed.
+func (w *k8sWallet) apiWatchLoop(resourceVersion string, done chan struct{}) {
+	defer close(done)
+	ctx := w.watchCtx
+	var err error
+	for {
+		if resourceVersion == "" {
+			resourceVersion, err = w.listSecrets(ctx)
+		}
+		if err == nil {
+			resourceVersion, err = w.watchSecrets(ctx, resourceVersion)
+		}
+		if ctx.Err() != nil {
+			log.L(ctx).Infof("Secret watch exiting")
+			return
+		}
+		if err != nil {
+			log.L(ctx).Warnf("Secret watch failed, re-listing in %s: %s", w.conf.Watch.ReconnectDelay, err)
+			resourceVersion = ""
+			select {
+			case <-ctx.Done():
+				log.L(ctx).Infof("Secret watch exiting")
+				return
+			case <-time.After(w.conf.Watch.ReconnectDelay):
+			}
+		}
+	}
+}
+
+// watchSecrets applies the changes from a watch stream until it ends, returning the last resource version
+func (w *k8sWallet) watchSecrets(ctx context.Context, resourceVersion string) (string, error) {
+	res, err := w.watchClient.R().
+		SetContext(ctx).
+		SetQueryParams(map[string]string{
+			"labelSelector":       w.conf.LabelSelector,
+			"watch":               "true",
+			"allowWatchBookmarks": "true",
+			"resourceVersion":     resourceVersion,
+			"timeoutSeconds":      strconv.Itoa(int(w.conf.Watch.Timeout.Seconds())),
+		}).
+		SetDoNotParseResponse(true).
+		Get(w.secretsPath())
+	if err != nil {
+		return "", i18n.NewError(ctx, signermsgs.MsgK8sRequestFailed, err)
+	}
+	body := res.RawBody()
+	defer body.Close()
+	if res.IsError() {
+		return "", i18n.NewError(ctx, signermsgs.MsgK8sRequestFailed, res.Status())
+	}
+	log.L(ctx).Debugf("Watching secrets from resource version %s", resourceVersion)
+	decoder := json.NewDecoder(body)
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+				return "", i18n.NewError(ctx, signermsgs.MsgK8sWatchFailed, err)
+			}
+			return resourceVersion, nil
+		}
+		if event.Type == "ERROR" {
+			// Typically a 410 Gone, as the resource version is too old to resume from
+			var s status
+			_ = json.Unmarshal(event.Object, &s)
+			return "", i18n.NewError(ctx, signermsgs.MsgK8sWatchFailed, s.Message)
+		}
+		var s secret
+		if err := json.Unmarshal(event.Object, &s); err != nil {
+			return "", i18n.NewError(ctx, signermsgs.MsgK8sWatchFailed, err)
+		}
+		log.L(ctx).Tracef("Secret event [%s]: %s", event.Type, s.Metadata.Name)
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			w.updateSecret(ctx, s.Metadata.Name, s.Data)
+		case "DELETED":
+			w.updateSecret(ctx, s.Metadata.Name, nil)
+		}
+		resourceVersion = s.Metadata.ResourceVersion
+	}
+}
+
+// readVolume reads a secret volume. Each subdirectory is a secret named by the subdirectory, or the directory
+// itself is a secret (named by the directory) if it holds files directly, as when a single Secret is mounted.
+//
+// The kubelet writes the files of a Secret volume into a timestamped directory, and switches an ..data symlink
+// to it atomically - with a symlink for each file (or subdirectory of a projected volume) pointing through
+// ..data. So the entries starting with .. are skipped, and the links followed.
+func readVolume(root string) (map[string]map[string][]byte, error) {
+	secrets := make(map[string]map[string][]byte)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	rootData := make(map[string][]byte)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "..") {
+			continue
+		}
+		p := filepath.Join(root, e.Name())
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue // a broken link, or removed since listing
+		}
+		if fi.IsDir() {
+			if data, err := readSecretDir(p); err == nil {
+				secrets[e.Name()] = data
+			}
+			continue
+		}
+		if b, err := os.ReadFile(p); err == nil {
+			rootData[e.Name()] = b
+		}
+	}
+	if len(rootData) > 0 {
+		secrets[filepath.Base(root)] = rootData
+	}
+	return secrets, nil
+}
+
+func readSecretDir(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "..") {
+			continue
+		}
+		if b, err := os.ReadFile(filepath.Join(dir, e.Name())); err == nil {
+			data[e.Name()] = b
+		}
+	}
+	return data, nil
+}
+
+// newVolumeWatcher watches the volume directory, and any subdirectories that are not links into ..data
+// (which only change when ..data is switched, as the whole volume is updated)
+func (w *k8sWallet) newVolumeWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(w.conf.Path); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	w.watchSubdirectories(watcher)
+	return watcher, nil
+}
+
+func (w *k8sWallet) watchSubdirectories(watcher *fsnotify.Watcher) {
+	entries, _ := os.ReadDir(w.conf.Path)
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), "..") {
+			_ = watcher.Add(filepath.Join(w.conf.Path, e.Name()))
+		}
+	}
+}
+
+// volumeWatchLoop re-reads the volume on every change until the wallet is closed. The kubelet updating
+// the volume is seen as the creation of the ..data link.
+func (w *k8sWallet) volumeWatchLoop(watcher *fsnotify.Watcher, done chan struct{}) {
+	defer close(done)
+	defer func() { _ = watcher.Close() }()
+	ctx := w.watchCtx
+	for {
+		select {
+		case <-ctx.Done():
+			log.L(ctx).Infof("Secret volume watch exiting")
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			log.L(ctx).Tracef("FSEvent [%s]: %s", event.Op, event.Name)
+			if event.Op&^fsnotify.Chmod == 0 {
+				continue
+			}
+			w.watchSubdirectories(watcher)
+			if err := w.Refresh(ctx); err != nil {
+				log.L(ctx).Errorf("Failed to re-read the secret volume: %s", err)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events might have been missed
+			log.L(ctx).Warnf("FSEvent error - re-reading the secret volume: %s", err)
+			if err := w.Refresh(ctx); err != nil {
+				log.L(ctx).Errorf("Failed to re-read the secret volume: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id defaults are the second recommended option of RFC 9106, for environments constrained in memory
+const (
+	Argon2idDefaultTime        = 3
+	Argon2idDefaultMemory      = 64 * 1024 // KiB
+	Argon2idDefaultParallelism = 4
+)
+
+// Argon2idOptions controls the Argon2id key derivation of a new wallet file
+type Argon2idOptions struct {
+	// Time is the number of passes over the memory - defaults to Argon2idDefaultTime
+	Time uint32
+	// Memory is the memory cost in KiB - defaults to Argon2idDefaultMemory
+	Memory uint32
+	// Parallelism is the number of lanes - defaults to Argon2idDefaultParallelism
+	Parallelism uint8
+}
+
+func readArgon2idWalletFile(jsonWallet []byte, password []byte, metadata map[string]interface{}) (WalletFile, error) {
+	var w *walletFileArgon2id
+	if err := json.Unmarshal(jsonWallet, &w); err != nil {
+		return nil, fmt.Errorf("invalid argon2id keystore: %s", err)
+	}
+	w.metadata = metadata
+	return w, w.decrypt(password)
+}
+
+func newArgon2idWalletFileSecp256k1(password string, keypair *secp256k1.KeyPair, options *Argon2idOptions) WalletFile {
+	wf := newArgon2idWalletFileBytes(password, keypair.PrivateKeyBytes(), options)
+	wf.Metadata()["address"] = ethtypes.AddressPlainHex(keypair.Address).String()
+	return wf
+}
+
+func newArgon2idWalletFileBytes(password string, privateKey []byte, options *Argon2idOptions) *walletFileArgon2id {
+	params := kdfParamsArgon2id{
+		DKLen:       32,
+		Time:        Argon2idDefaultTime,
+		Memory:      Argon2idDefaultMemory,
+		Parallelism: Argon2idDefaultParallelism,
+		Salt:        mustReadBytes(32, rand.Reader),
+	}
+	if options != nil {
+		if options.Time > 0 {
+			params.Time = options.Time
+		}
+		if options.Memory > 0 {
+			params.Memory = options.Memory
+		}
+		if options.Parallelism > 0 {
+			params.Parallelism = options.Parallelism
+		}
+	}
+
+	derivedKey := argon2.IDKey([]byte(password), params.Salt, params.Time, params.Memory, params.Parallelism, uint32(params.DKLen))
+
+	return &walletFileArgon2id{
+		walletFileBase: newWalletFileBase(privateKey),
+		Crypto: cryptoArgon2id{
+			cryptoCommon: mustEncryptCommon(kdfTypeArgon2id, derivedKey, privateKey),
+			KDFParams:    params,
+		},
+	}
+}
+
+func (w *walletFileArgon2id) decrypt(password []byte) (err error) {
+	params := &w.Crypto.KDFParams
+	// argon2 panics on these, rather than returning an error
+	if params.Time < 1 || params.Parallelism < 1 || params.DKLen < 1 {
+		return fmt.Errorf("invalid argon2id keystore: time, parallelism and dklen must be at least 1")
+	}
+
+	derivedKey := argon2.IDKey(password, params.Salt, params.Time, params.Memory, params.Parallelism, uint32(params.DKLen))
+
+	w.privateKey, err = w.Crypto.decryptCommon(derivedKey)
+	return err
+}
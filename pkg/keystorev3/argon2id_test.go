@@ -0,0 +1,81 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgon2idWalletRoundTrip(t *testing.T) {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	w1 := NewWalletFileArgon2id("correct horse", keypair, &Argon2idOptions{Time: 1, Memory: 1024, Parallelism: 2})
+
+	var generic map[string]interface{}
+	err = json.Unmarshal(w1.JSON(), &generic)
+	assert.NoError(t, err)
+	assert.Equal(t, ethtypes.AddressPlainHex(keypair.Address).String(), generic["address"])
+	crypto := generic["crypto"].(map[string]interface{})
+	assert.Equal(t, "argon2id", crypto["kdf"])
+	kdfParams := crypto["kdfparams"].(map[string]interface{})
+	assert.Equal(t, float64(1), kdfParams["time"])
+	assert.Equal(t, float64(1024), kdfParams["memory"])
+	assert.Equal(t, float64(2), kdfParams["parallelism"])
+	assert.Equal(t, float64(32), kdfParams["dklen"])
+
+	w2, err := ReadWalletFile(w1.JSON(), []byte("correct horse"))
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), w2.PrivateKey())
+	assert.Equal(t, w1.GetID(), w2.GetID())
+
+	_, err = ReadWalletFile(w1.JSON(), []byte("wrong"))
+	assert.Regexp(t, "invalid password", err)
+
+}
+
+func TestArgon2idWalletDefaults(t *testing.T) {
+
+	w1 := NewWalletFileCustomBytesArgon2id("correct horse", []byte("any bytes"), nil)
+	params := w1.(*walletFileArgon2id).Crypto.KDFParams
+	assert.Equal(t, uint32(Argon2idDefaultTime), params.Time)
+	assert.Equal(t, uint32(Argon2idDefaultMemory), params.Memory)
+	assert.Equal(t, uint8(Argon2idDefaultParallelism), params.Parallelism)
+
+	w2, err := ReadWalletFile(w1.JSON(), []byte("correct horse"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("any bytes"), w2.PrivateKey())
+
+}
+
+func TestArgon2idWalletFileDecryptInvalid(t *testing.T) {
+
+	_, err := readArgon2idWalletFile([]byte(`!! not json`), []byte(""), nil)
+	assert.Regexp(t, "invalid argon2id keystore", err)
+
+	_, err = readArgon2idWalletFile([]byte(`{}`), []byte(""), nil)
+	assert.Regexp(t, "invalid argon2id keystore: time, parallelism and dklen", err)
+
+	_, err = readArgon2idWalletFile([]byte(`{"crypto":{"kdfparams":{"time":1,"parallelism":1,"memory":8,"dklen":16}}}`), []byte(""), nil)
+	assert.Regexp(t, "derived key length", err)
+
+}
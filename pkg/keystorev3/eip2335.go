@@ -0,0 +1,273 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// EIP-2335 (keystore V4) defines a modular structure, where the kdf, checksum and cipher are each
+// a function with parameters and a message. It is used for BLS12-381 keys for Ethereum consensus,
+// but the secret is opaque to the keystore - this package does not derive the public key, so the
+// caller supplies it when creating a file.
+// See https://eips.ethereum.org/EIPS/eip-2335
+
+const (
+	version4             = 4
+	checksumTypeSHA256   = "sha256"
+	eip2335ScryptN       = 1 << 18
+	eip2335DefaultKDF    = kdfTypeScrypt
+	eip2335DerivedKeyLen = 32
+)
+
+// WalletFileV4 is an EIP-2335 keystore, holding the secret of a key such as a BLS12-381 validator key
+type WalletFileV4 interface {
+	Secret() []byte
+	Pubkey() []byte
+	Path() string
+	Description() string
+	JSON() []byte
+	GetID() *fftypes.UUID
+	GetVersion() int
+	// Destroy zeroes the decrypted secret held by the wallet file
+	Destroy()
+}
+
+// WalletFileV4Options are the optional fields and the key derivation of a new EIP-2335 keystore
+type WalletFileV4Options struct {
+	// Pubkey is the public key of the secret, which is stored in the file unencrypted
+	Pubkey []byte
+	// Path is the EIP-2334 derivation path of the key, if it was derived (such as m/12381/3600/0/0/0)
+	Path        string
+	Description string
+	// KDF is scrypt (the default) or pbkdf2
+	KDF string
+	// Scrypt controls the cost when the KDF is scrypt - N defaults to 2^18, as in EIP-2335
+	Scrypt *ScryptOptions
+	// Pbkdf2 controls the cost when the KDF is pbkdf2
+	Pbkdf2 *Pbkdf2Options
+}
+
+type eip2335Module struct {
+	Function string                 `json:"function"`
+	Params   json.RawMessage        `json:"params"`
+	Message  ethtypes.HexBytesPlain `json:"message"`
+}
+
+type eip2335Crypto struct {
+	KDF      eip2335Module `json:"kdf"`
+	Checksum eip2335Module `json:"checksum"`
+	Cipher   eip2335Module `json:"cipher"`
+}
+
+type walletFileV4 struct {
+	Crypto           eip2335Crypto          `json:"crypto"`
+	DescriptionField string                 `json:"description,omitempty"`
+	PubkeyField      ethtypes.HexBytesPlain `json:"pubkey"`
+	PathField        string                 `json:"path"`
+	UUID             *fftypes.UUID          `json:"uuid"`
+	Version          int                    `json:"version"`
+	secret           []byte
+}
+
+// NewWalletFileV4 encrypts the secret into an EIP-2335 keystore
+func NewWalletFileV4(password string, secret []byte, options *WalletFileV4Options) (WalletFileV4, error) {
+	if options == nil {
+		options = &WalletFileV4Options{}
+	}
+	w := &walletFileV4{
+		DescriptionField: options.Description,
+		PubkeyField:      options.Pubkey,
+		PathField:        options.Path,
+		UUID:             fftypes.NewUUID(),
+		Version:          version4,
+		secret:           secret,
+	}
+
+	salt := mustReadBytes(32, rand.Reader)
+	kdf := options.KDF
+	if kdf == "" {
+		kdf = eip2335DefaultKDF
+	}
+	var kdfParams interface{}
+	switch kdf {
+	case kdfTypeScrypt:
+		n, r, p := options.Scrypt.params()
+		if options.Scrypt == nil || options.Scrypt.N == 0 {
+			n = eip2335ScryptN
+		}
+		kdfParams = &kdfParamsScrypt{DKLen: eip2335DerivedKeyLen, N: n, R: r, P: p, Salt: salt}
+	case kdfTypePbkdf2:
+		c := Pbkdf2DefaultC
+		if options.Pbkdf2 != nil && options.Pbkdf2.C > 0 {
+			c = options.Pbkdf2.C
+		}
+		kdfParams = &kdfParamsPbkdf2{DKLen: eip2335DerivedKeyLen, C: c, PRF: prfHmacSHA256, Salt: salt}
+	default:
+		return nil, fmt.Errorf("unsupported kdf: %s", kdf)
+	}
+	w.Crypto.KDF.Function = kdf
+	w.Crypto.KDF.Params, _ = json.Marshal(kdfParams)
+	derivedKey, err := w.deriveKey(eip2335Password(password))
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(derivedKey)
+
+	iv := mustReadBytes(16 /* 128bit */, rand.Reader)
+	w.Crypto.Cipher.Function = cipherAES128ctr
+	w.Crypto.Cipher.Params, _ = json.Marshal(&cipherParams{IV: iv})
+	w.Crypto.Cipher.Message = mustAES128CtrEncrypt(derivedKey[0:16], iv, secret)
+
+	w.Crypto.Checksum.Function = checksumTypeSHA256
+	w.Crypto.Checksum.Params = json.RawMessage(`{}`)
+	w.Crypto.Checksum.Message = eip2335Checksum(derivedKey, w.Crypto.Cipher.Message)
+	return w, nil
+}
+
+// ReadWalletFileV4 decrypts an EIP-2335 keystore
+func ReadWalletFileV4(jsonWallet []byte, password []byte) (WalletFileV4, error) {
+	var w *walletFileV4
+	if err := json.Unmarshal(jsonWallet, &w); err != nil {
+		return nil, fmt.Errorf("invalid wallet file: %s", err)
+	}
+	if w.UUID == nil {
+		return nil, fmt.Errorf("missing keyfile uuid")
+	}
+	if w.Version != version4 {
+		return nil, fmt.Errorf("incorrect keyfile version (only V4 supported): %d", w.Version)
+	}
+	if w.Crypto.Checksum.Function != checksumTypeSHA256 {
+		return nil, fmt.Errorf("unsupported checksum: %s", w.Crypto.Checksum.Function)
+	}
+	if w.Crypto.Cipher.Function != cipherAES128ctr {
+		return nil, fmt.Errorf("unsupported cipher: %s", w.Crypto.Cipher.Function)
+	}
+	var cp cipherParams
+	if err := json.Unmarshal(w.Crypto.Cipher.Params, &cp); err != nil {
+		return nil, fmt.Errorf("invalid cipher params: %s", err)
+	}
+	if len(cp.IV) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid cipher params: iv length %d", len(cp.IV))
+	}
+
+	derivedKey, err := w.deriveKey(eip2335Password(string(password)))
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(derivedKey)
+	if !bytes.Equal(eip2335Checksum(derivedKey, w.Crypto.Cipher.Message), w.Crypto.Checksum.Message) {
+		return nil, fmt.Errorf("invalid password provided")
+	}
+	if w.secret, err = aes128CtrDecrypt(derivedKey[0:16], cp.IV, w.Crypto.Cipher.Message); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *walletFileV4) deriveKey(password []byte) (derivedKey []byte, err error) {
+	switch w.Crypto.KDF.Function {
+	case kdfTypeScrypt:
+		var params kdfParamsScrypt
+		if err := json.Unmarshal(w.Crypto.KDF.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid scrypt params: %s", err)
+		}
+		if derivedKey, err = scryptKey(context.Background(), password, params.Salt, params.N, params.R, params.P, params.DKLen); err != nil {
+			return nil, fmt.Errorf("invalid scrypt keystore: %s", err)
+		}
+	case kdfTypePbkdf2:
+		var params kdfParamsPbkdf2
+		if err := json.Unmarshal(w.Crypto.KDF.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid pbkdf2 params: %s", err)
+		}
+		if params.PRF != prfHmacSHA256 {
+			return nil, fmt.Errorf("invalid pbkdf2 wallet file: unsupported prf '%s'", params.PRF)
+		}
+		derivedKey = pbkdf2.Key(password, params.Salt, params.C, params.DKLen, sha256.New)
+	default:
+		return nil, fmt.Errorf("unsupported kdf: %s", w.Crypto.KDF.Function)
+	}
+	if len(derivedKey) < eip2335DerivedKeyLen {
+		return nil, fmt.Errorf("invalid keystore: derived key length %d < %d", len(derivedKey), eip2335DerivedKeyLen)
+	}
+	return derivedKey, nil
+}
+
+// eip2335Password normalizes the password to NFKD, and strips the C0, C1 and Delete control codes
+func eip2335Password(password string) []byte {
+	normalized := norm.NFKD.String(password)
+	b := make([]byte, 0, len(normalized))
+	for _, r := range normalized {
+		if r < 0x20 || (r >= 0x7f && r <= 0x9f) {
+			continue
+		}
+		b = utf8.AppendRune(b, r)
+	}
+	return b
+}
+
+func eip2335Checksum(derivedKey, cipherMessage []byte) []byte {
+	hash := sha256.New()
+	hash.Write(derivedKey[16:32])
+	hash.Write(cipherMessage)
+	return hash.Sum(nil)
+}
+
+func (w *walletFileV4) Secret() []byte {
+	return w.secret
+}
+
+func (w *walletFileV4) Pubkey() []byte {
+	return w.PubkeyField
+}
+
+func (w *walletFileV4) Path() string {
+	return w.PathField
+}
+
+func (w *walletFileV4) Description() string {
+	return w.DescriptionField
+}
+
+func (w *walletFileV4) GetID() *fftypes.UUID {
+	return w.UUID
+}
+
+func (w *walletFileV4) GetVersion() int {
+	return w.Version
+}
+
+func (w *walletFileV4) JSON() []byte {
+	b, _ := json.Marshal(w)
+	return b
+}
+
+func (w *walletFileV4) Destroy() {
+	zeroBytes(w.secret)
+}
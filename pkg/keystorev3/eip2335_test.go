@@ -0,0 +1,255 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors from https://eips.ethereum.org/EIPS/eip-2335#test-cases
+const (
+	eip2335TestPassword = "𝔱𝔢𝔰𝔱𝔭𝔞𝔰𝔰𝔴𝔬𝔯𝔡🔑"
+	eip2335TestSecret   = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	eip2335TestPubkey   = "9612d7a727c9d0a22e185a1c768478dfe919cada9266988cb32359c11f2b7b27f4ae4040902382ae2910c15e2b420d07"
+
+	eip2335ScryptVector = `{
+		"crypto": {
+			"kdf": {
+				"function": "scrypt",
+				"params": {
+					"dklen": 32,
+					"n": 262144,
+					"p": 1,
+					"r": 8,
+					"salt": "d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"
+				},
+				"message": ""
+			},
+			"checksum": {
+				"function": "sha256",
+				"params": {},
+				"message": "d2217fe5f3e9a1e34581ef8a78f7c9928e436d36dacc5e846690a5581e8ea484"
+			},
+			"cipher": {
+				"function": "aes-128-ctr",
+				"params": {
+					"iv": "264daa3f303d7259501c93d997d84fe6"
+				},
+				"message": "06ae90d55fe0a6e9c5c3bc5b170827b2e5cce3929ed3f116c2811e6366dfe20f"
+			}
+		},
+		"description": "This is a test keystore that uses scrypt to secure the secret.",
+		"pubkey": "9612d7a727c9d0a22e185a1c768478dfe919cada9266988cb32359c11f2b7b27f4ae4040902382ae2910c15e2b420d07",
+		"path": "m/12381/60/3141592653/589793238",
+		"uuid": "1d85ae20-35c5-4611-98e8-aa14a633906f",
+		"version": 4
+	}`
+
+	eip2335Pbkdf2Vector = `{
+		"crypto": {
+			"kdf": {
+				"function": "pbkdf2",
+				"params": {
+					"dklen": 32,
+					"c": 262144,
+					"prf": "hmac-sha256",
+					"salt": "d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"
+				},
+				"message": ""
+			},
+			"checksum": {
+				"function": "sha256",
+				"params": {},
+				"message": "8a9f5d9912ed7e75ea794bc5a89bca5f193721d30868ade6f73043c6ea6febf1"
+			},
+			"cipher": {
+				"function": "aes-128-ctr",
+				"params": {
+					"iv": "264daa3f303d7259501c93d997d84fe6"
+				},
+				"message": "cee03fde2af33149775b7223e7845e4fb2c8ae1792e5f99fe9ecf474cc8c16ad"
+			}
+		},
+		"description": "This is a test keystore that uses PBKDF2 to secure the secret.",
+		"pubkey": "9612d7a727c9d0a22e185a1c768478dfe919cada9266988cb32359c11f2b7b27f4ae4040902382ae2910c15e2b420d07",
+		"path": "m/12381/60/0/0",
+		"uuid": "64625def-3331-4eea-ab6f-782f3ed16a83",
+		"version": 4
+	}`
+)
+
+func TestEIP2335ScryptVector(t *testing.T) {
+
+	w, err := ReadWalletFileV4([]byte(eip2335ScryptVector), []byte(eip2335TestPassword))
+	assert.NoError(t, err)
+	assert.Equal(t, eip2335TestSecret, hex.EncodeToString(w.Secret()))
+	assert.Equal(t, eip2335TestPubkey, hex.EncodeToString(w.Pubkey()))
+	assert.Equal(t, "m/12381/60/3141592653/589793238", w.Path())
+	assert.Equal(t, "This is a test keystore that uses scrypt to secure the secret.", w.Description())
+	assert.Equal(t, "1d85ae20-35c5-4611-98e8-aa14a633906f", w.GetID().String())
+	assert.Equal(t, 4, w.GetVersion())
+
+	w.Destroy()
+	assert.Equal(t, make([]byte, 32), w.Secret())
+
+}
+
+func TestEIP2335Pbkdf2Vector(t *testing.T) {
+
+	w, err := ReadWalletFileV4([]byte(eip2335Pbkdf2Vector), []byte(eip2335TestPassword))
+	assert.NoError(t, err)
+	assert.Equal(t, eip2335TestSecret, hex.EncodeToString(w.Secret()))
+	assert.Equal(t, "m/12381/60/0/0", w.Path())
+
+	_, err = ReadWalletFileV4([]byte(eip2335Pbkdf2Vector), []byte("testpassword"))
+	assert.Regexp(t, "invalid password", err)
+
+}
+
+func TestEIP2335Password(t *testing.T) {
+
+	// From the EIP - NFKD maps the mathematical fraktur letters to ASCII, and control codes are stripped
+	assert.Equal(t, "7465737470617373776f7264f09f9491", hex.EncodeToString(eip2335Password(eip2335TestPassword)))
+	assert.Equal(t, "abc", string(eip2335Password("a\x00b\x7f\u0085c\n")))
+
+}
+
+func TestEIP2335CreateScrypt(t *testing.T) {
+
+	secret, _ := hex.DecodeString(eip2335TestSecret)
+	pubkey, _ := hex.DecodeString(eip2335TestPubkey)
+	w1, err := NewWalletFileV4("myPrecious", secret, &WalletFileV4Options{
+		Pubkey:      pubkey,
+		Path:        "m/12381/3600/0/0/0",
+		Description: "validator key",
+		Scrypt:      &ScryptOptions{N: 1024},
+	})
+	assert.NoError(t, err)
+
+	var generic map[string]interface{}
+	err = json.Unmarshal(w1.JSON(), &generic)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4), generic["version"])
+	assert.Equal(t, eip2335TestPubkey, generic["pubkey"])
+	kdf := generic["crypto"].(map[string]interface{})["kdf"].(map[string]interface{})
+	assert.Equal(t, "scrypt", kdf["function"])
+	assert.Equal(t, float64(1024), kdf["params"].(map[string]interface{})["n"])
+
+	w2, err := ReadWalletFileV4(w1.JSON(), []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.Equal(t, secret, w2.Secret())
+	assert.Equal(t, "m/12381/3600/0/0/0", w2.Path())
+	assert.Equal(t, "validator key", w2.Description())
+	assert.Equal(t, w1.GetID(), w2.GetID())
+
+}
+
+func TestEIP2335CreatePbkdf2(t *testing.T) {
+
+	w1, err := NewWalletFileV4("myPrecious", []byte("any bytes"), &WalletFileV4Options{
+		KDF:    kdfTypePbkdf2,
+		Pbkdf2: &Pbkdf2Options{C: 1024},
+	})
+	assert.NoError(t, err)
+
+	w2, err := ReadWalletFileV4(w1.JSON(), []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("any bytes"), w2.Secret())
+
+}
+
+func TestEIP2335CreateDefaults(t *testing.T) {
+
+	w1, err := NewWalletFileV4("myPrecious", []byte("any bytes"), nil)
+	assert.NoError(t, err)
+	var params kdfParamsScrypt
+	err = json.Unmarshal(w1.(*walletFileV4).Crypto.KDF.Params, &params)
+	assert.NoError(t, err)
+	assert.Equal(t, 262144, params.N)
+	assert.Equal(t, 8, params.R)
+	assert.Equal(t, 1, params.P)
+
+}
+
+func TestEIP2335CreateBadOptions(t *testing.T) {
+
+	_, err := NewWalletFileV4("myPrecious", []byte("any bytes"), &WalletFileV4Options{KDF: "wrong"})
+	assert.Regexp(t, "unsupported kdf", err)
+
+	_, err = NewWalletFileV4("myPrecious", []byte("any bytes"), &WalletFileV4Options{Scrypt: &ScryptOptions{N: 1000}})
+	assert.Regexp(t, "invalid scrypt keystore", err)
+
+}
+
+func TestEIP2335ReadErrors(t *testing.T) {
+
+	_, err := ReadWalletFileV4([]byte(`!! not json`), []byte(""))
+	assert.Regexp(t, "invalid wallet file", err)
+
+	_, err = ReadWalletFileV4([]byte(`{}`), []byte(""))
+	assert.Regexp(t, "missing keyfile uuid", err)
+
+	_, err = ReadWalletFileV4([]byte(`{"uuid":"1d85ae20-35c5-4611-98e8-aa14a633906f","version":3}`), []byte(""))
+	assert.Regexp(t, "incorrect keyfile version", err)
+
+	_, err = ReadWalletFileV4([]byte(`{"uuid":"1d85ae20-35c5-4611-98e8-aa14a633906f","version":4,
+		"crypto":{"checksum":{"function":"wrong"}}}`), []byte(""))
+	assert.Regexp(t, "unsupported checksum", err)
+
+	_, err = ReadWalletFileV4([]byte(`{"uuid":"1d85ae20-35c5-4611-98e8-aa14a633906f","version":4,
+		"crypto":{"checksum":{"function":"sha256"},"cipher":{"function":"wrong"}}}`), []byte(""))
+	assert.Regexp(t, "unsupported cipher", err)
+
+	_, err = ReadWalletFileV4([]byte(`{"uuid":"1d85ae20-35c5-4611-98e8-aa14a633906f","version":4,
+		"crypto":{"checksum":{"function":"sha256"},"cipher":{"function":"aes-128-ctr","params":[]}}}`), []byte(""))
+	assert.Regexp(t, "invalid cipher params", err)
+
+	_, err = ReadWalletFileV4([]byte(`{"uuid":"1d85ae20-35c5-4611-98e8-aa14a633906f","version":4,
+		"crypto":{"checksum":{"function":"sha256"},"cipher":{"function":"aes-128-ctr","params":{"iv":"00"}}}}`), []byte(""))
+	assert.Regexp(t, "invalid cipher params: iv length 1", err)
+
+	_, err = ReadWalletFileV4([]byte(`{"uuid":"1d85ae20-35c5-4611-98e8-aa14a633906f","version":4,
+		"crypto":{"checksum":{"function":"sha256"},"cipher":{"function":"aes-128-ctr","params":{"iv":"264daa3f303d7259501c93d997d84fe6"}},
+		"kdf":{"function":"wrong"}}}`), []byte(""))
+	assert.Regexp(t, "unsupported kdf", err)
+
+}
+
+func TestEIP2335DeriveKeyErrors(t *testing.T) {
+
+	w := &walletFileV4{}
+	w.Crypto.KDF = eip2335Module{Function: kdfTypeScrypt, Params: json.RawMessage(`[]`)}
+	_, err := w.deriveKey([]byte(""))
+	assert.Regexp(t, "invalid scrypt params", err)
+
+	w.Crypto.KDF = eip2335Module{Function: kdfTypePbkdf2, Params: json.RawMessage(`[]`)}
+	_, err = w.deriveKey([]byte(""))
+	assert.Regexp(t, "invalid pbkdf2 params", err)
+
+	w.Crypto.KDF = eip2335Module{Function: kdfTypePbkdf2, Params: json.RawMessage(`{"prf":"wrong"}`)}
+	_, err = w.deriveKey([]byte(""))
+	assert.Regexp(t, "unsupported prf", err)
+
+	w.Crypto.KDF = eip2335Module{Function: kdfTypePbkdf2, Params: json.RawMessage(`{"prf":"hmac-sha256","c":1,"dklen":16}`)}
+	_, err = w.deriveKey([]byte(""))
+	assert.Regexp(t, "derived key length 16 < 32", err)
+
+}
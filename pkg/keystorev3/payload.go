@@ -0,0 +1,42 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"context"
+)
+
+// EncryptPayload encrypts an arbitrary secret, such as a mnemonic or an API credential, into a Keystore V3
+// format envelope of any length. The KDF is selected by the options, and is scrypt with the standard cost if
+// none is selected. The envelope has no "address" field, as the payload is not a key.
+func EncryptPayload(password string, data []byte, options *KDFOptions) ([]byte, error) {
+	wf, err := newWalletFileKDFBytes(password, data, options)
+	if err != nil {
+		return nil, err
+	}
+	return wf.JSON(), nil
+}
+
+// DecryptPayload decrypts an envelope written by EncryptPayload, returning the payload. Any Keystore V3 file
+// can be decrypted, in which case the payload is the private key.
+func DecryptPayload(jsonEnvelope []byte, password []byte) ([]byte, error) {
+	wf, err := readWalletFile(context.Background(), jsonEnvelope, password, &ReadOptions{noAddress: true})
+	if err != nil {
+		return nil, err
+	}
+	return wf.PrivateKey(), nil
+}
@@ -0,0 +1,84 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+
+	mnemonic := []byte("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about")
+	for _, options := range []*KDFOptions{
+		nil,
+		{Pbkdf2: &Pbkdf2Options{C: 1024}},
+		{Argon2id: &Argon2idOptions{Time: 1, Memory: 1024, Parallelism: 1}},
+	} {
+		envelope, err := EncryptPayload("myPrecious", mnemonic, options)
+		assert.NoError(t, err)
+
+		var generic map[string]interface{}
+		err = json.Unmarshal(envelope, &generic)
+		assert.NoError(t, err)
+		_, hasAddress := generic["address"]
+		assert.False(t, hasAddress)
+		assert.Equal(t, float64(3), generic["version"])
+
+		payload, err := DecryptPayload(envelope, []byte("myPrecious"))
+		assert.NoError(t, err)
+		assert.Equal(t, mnemonic, payload)
+
+		_, err = DecryptPayload(envelope, []byte("wrong"))
+		assert.Regexp(t, "invalid password", err)
+	}
+
+}
+
+func TestPayloadEmpty(t *testing.T) {
+
+	envelope, err := EncryptPayload("myPrecious", []byte{}, nil)
+	assert.NoError(t, err)
+	payload, err := DecryptPayload(envelope, []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.Empty(t, payload)
+
+}
+
+func TestDecryptPayloadWalletFile(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	w := NewWalletFileLight("myPrecious", keypair)
+	payload, err := DecryptPayload(w.JSON(), []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), payload)
+
+}
+
+func TestPayloadErrors(t *testing.T) {
+
+	_, err := EncryptPayload("myPrecious", []byte("secret"), &KDFOptions{Scrypt: &ScryptOptions{N: 1000}})
+	assert.Error(t, err)
+
+	_, err = DecryptPayload([]byte(`!! not json`), []byte("myPrecious"))
+	assert.Regexp(t, "invalid wallet file", err)
+
+}
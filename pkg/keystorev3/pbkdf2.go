@@ -17,17 +17,30 @@
 package keystorev3
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
 	"golang.org/x/crypto/pbkdf2"
 )
 
 const (
 	prfHmacSHA256 = "hmac-sha256"
+
+	// Pbkdf2DefaultC is the iteration count used when none is set - the same as web3.js and ethers
+	Pbkdf2DefaultC = 262144
 )
 
+// Pbkdf2Options controls the PBKDF2-HMAC-SHA256 key derivation of a new wallet file
+type Pbkdf2Options struct {
+	// C is the iteration count, trading the CPU cost of decrypting the file against resistance to
+	// brute forcing the password. Pbkdf2DefaultC is used if it is not set
+	C int
+}
+
 func readPbkdf2WalletFile(jsonWallet []byte, password []byte, metadata map[string]interface{}) (WalletFile, error) {
 	var w *walletFilePbkdf2
 	if err := json.Unmarshal(jsonWallet, &w); err != nil {
@@ -37,6 +50,35 @@ func readPbkdf2WalletFile(jsonWallet []byte, password []byte, metadata map[strin
 	return w, w.decrypt(password)
 }
 
+func newPbkdf2WalletFileSecp256k1(password string, keypair *secp256k1.KeyPair, options *Pbkdf2Options) WalletFile {
+	wf := newPbkdf2WalletFileBytes(password, keypair.PrivateKeyBytes(), options)
+	wf.Metadata()["address"] = ethtypes.AddressPlainHex(keypair.Address).String()
+	return wf
+}
+
+func newPbkdf2WalletFileBytes(password string, privateKey []byte, options *Pbkdf2Options) *walletFilePbkdf2 {
+	c := Pbkdf2DefaultC
+	if options != nil && options.C > 0 {
+		c = options.C
+	}
+
+	salt := mustReadBytes(32, rand.Reader)
+	derivedKey := pbkdf2.Key([]byte(password), salt, c, 32, sha256.New)
+
+	return &walletFilePbkdf2{
+		walletFileBase: newWalletFileBase(privateKey),
+		Crypto: cryptoPbkdf2{
+			cryptoCommon: mustEncryptCommon(kdfTypePbkdf2, derivedKey, privateKey),
+			KDFParams: kdfParamsPbkdf2{
+				DKLen: 32,
+				C:     c,
+				PRF:   prfHmacSHA256,
+				Salt:  salt,
+			},
+		},
+	}
+}
+
 func (w *walletFilePbkdf2) decrypt(password []byte) (err error) {
 	if w.Crypto.KDFParams.PRF != prfHmacSHA256 {
 		return fmt.Errorf("invalid pbkdf2 wallet file: unsupported prf '%s'", w.Crypto.KDFParams.PRF)
@@ -94,3 +94,41 @@ func TestPbkdf2WalletFileUnsupportedPRF(t *testing.T) {
 	assert.Regexp(t, "invalid pbkdf2 wallet file: unsupported prf", err)
 
 }
+
+func TestPbkdf2WalletFileCreate(t *testing.T) {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	w1 := NewWalletFilePbkdf2("myPrecious", keypair, &Pbkdf2Options{C: 1024})
+
+	var generic map[string]interface{}
+	err = json.Unmarshal(w1.JSON(), &generic)
+	assert.NoError(t, err)
+	assert.Equal(t, ethtypes.AddressPlainHex(keypair.Address).String(), generic["address"])
+	crypto := generic["crypto"].(map[string]interface{})
+	assert.Equal(t, "pbkdf2", crypto["kdf"])
+	kdfParams := crypto["kdfparams"].(map[string]interface{})
+	assert.Equal(t, float64(1024), kdfParams["c"])
+	assert.Equal(t, "hmac-sha256", kdfParams["prf"])
+	assert.Equal(t, float64(32), kdfParams["dklen"])
+
+	w2, err := ReadWalletFile(w1.JSON(), []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), w2.PrivateKey())
+	assert.Equal(t, w1.GetID(), w2.GetID())
+
+	_, err = ReadWalletFile(w1.JSON(), []byte("wrong"))
+	assert.Regexp(t, "invalid password", err)
+
+}
+
+func TestPbkdf2WalletFileCreateDefaultC(t *testing.T) {
+
+	w1 := NewWalletFileCustomBytesPbkdf2("myPrecious", []byte("any bytes"), nil)
+	assert.Equal(t, Pbkdf2DefaultC, w1.(*walletFilePbkdf2).Crypto.KDFParams.C)
+
+	w2, err := ReadWalletFile(w1.JSON(), []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("any bytes"), w2.PrivateKey())
+
+}
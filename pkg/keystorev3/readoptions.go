@@ -0,0 +1,141 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// ReadOptions controls how strictly a wallet file is parsed by ReadWalletFileWithOptions.
+//
+// By default parsing is lenient, to accept the variants of the V3 format written by older clients - field names
+// in a different case (such as "Crypto"), a missing "address" field, and extra vendor fields (which are preserved
+// as metadata). A warning is reported for each variant, other than extra fields.
+//
+// Strict parsing is for validation tooling. It rejects all of these variants, and checks the "address" field
+// matches the decrypted key.
+type ReadOptions struct {
+	Strict bool
+	// Warn is called with each variant of the format accepted in lenient mode. They are logged if nil
+	Warn func(msg string)
+
+	noAddress bool // the file is not expected to have an address, as it holds a payload rather than a key
+}
+
+var (
+	v3Fields       = []string{"address", "crypto", "id", "version"}
+	v3CryptoFields = []string{"cipher", "ciphertext", "cipherparams", "kdf", "kdfparams", "mac"}
+)
+
+// ReadWalletFileWithOptions decrypts a wallet file, with the leniency of parsing controlled by the options
+func ReadWalletFileWithOptions(jsonWallet []byte, password []byte, options *ReadOptions) (WalletFile, error) {
+	return readWalletFile(context.Background(), jsonWallet, password, options)
+}
+
+func (o *ReadOptions) warn(ctx context.Context, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if o.Warn != nil {
+		o.Warn(msg)
+	} else {
+		log.L(ctx).Warnf("Keystore V3 file: %s", msg)
+	}
+}
+
+// normalizeWalletFile checks the top-level fields of the wallet file, returning the JSON with any core fields
+// renamed to their lower case names in lenient mode
+func normalizeWalletFile(ctx context.Context, jsonWallet []byte, options *ReadOptions) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(jsonWallet, &fields); err != nil {
+		return nil, fmt.Errorf("invalid wallet file: %s", err)
+	}
+	normalized := make(map[string]json.RawMessage, len(fields))
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := k
+		for _, f := range v3Fields {
+			if k != f && strings.EqualFold(k, f) {
+				if options.Strict {
+					return nil, fmt.Errorf("invalid wallet file: field '%s' must be '%s'", k, f)
+				}
+				options.warn(ctx, "field '%s' read as '%s'", k, f)
+				name = f
+			}
+		}
+		if _, dup := normalized[name]; dup {
+			return nil, fmt.Errorf("invalid wallet file: duplicate field '%s'", name)
+		}
+		normalized[name] = fields[k]
+	}
+	if _, ok := normalized["address"]; !ok && !options.noAddress {
+		if options.Strict {
+			return nil, fmt.Errorf("invalid wallet file: missing address")
+		}
+		options.warn(ctx, "missing address")
+	}
+	if options.Strict {
+		if err := checkExactFields(normalized, v3Fields, ""); err != nil {
+			return nil, err
+		}
+		var crypto map[string]json.RawMessage
+		if err := json.Unmarshal(normalized["crypto"], &crypto); err != nil {
+			return nil, fmt.Errorf("invalid wallet file: invalid crypto: %s", err)
+		}
+		if err := checkExactFields(crypto, v3CryptoFields, "crypto."); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(normalized)
+}
+
+func checkExactFields(fields map[string]json.RawMessage, allowed []string, prefix string) error {
+	for k := range fields {
+		found := false
+		for _, f := range allowed {
+			found = found || k == f
+		}
+		if !found {
+			return fmt.Errorf("invalid wallet file: unexpected field '%s%s'", prefix, k)
+		}
+	}
+	for _, f := range allowed {
+		if _, ok := fields[f]; !ok {
+			return fmt.Errorf("invalid wallet file: missing field '%s%s'", prefix, f)
+		}
+	}
+	return nil
+}
+
+// checkAddress verifies the address field of a decrypted wallet file matches its key, in strict mode
+func checkAddress(w WalletFile) error {
+	address, _ := w.Metadata()["address"].(string)
+	expected := ethtypes.AddressPlainHex(w.KeyPair().Address).String()
+	if !strings.EqualFold(strings.TrimPrefix(address, "0x"), expected) {
+		return fmt.Errorf("invalid wallet file: address '%s' does not match the key (%s)", address, expected)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// An older client's file - capitalized Crypto, no address, and a vendor field
+const sampleWalletVariant = `{
+	"Crypto": {
+	  "cipher": "aes-128-ctr",
+	  "ciphertext": "a28e5f6fd3189ef220f658392af0e967f17931530ac5b79376ed5be7d8adfb5a",
+	  "cipherparams": {
+		"iv": "7babf856e25f812d9dbc133e3122a1fc"
+	  },
+	  "kdf": "scrypt",
+	  "kdfparams": {
+		"dklen": 32,
+		"n": 262144,
+		"p": 1,
+		"r": 8,
+		"salt": "2844947e39e03785cad3ccda776279dbf5a86a5df9cb6d0ab5773bfcb7cbe3b7"
+	  },
+	  "mac": "69ed15cbb03a29ec194bdbd2c2d8084c62be620d5b3b0f668ed9aa1f45dbaf99"
+	},
+	"Id": "307cc063-2344-426a-b992-3b72d5d5be0b",
+	"version": 3,
+	"x-ethers": {
+	  "client": "ethers.js"
+	}
+  }`
+
+func TestReadWalletFileLenientVariants(t *testing.T) {
+
+	var warnings []string
+	w, err := ReadWalletFileWithOptions([]byte(sampleWalletVariant), []byte("correcthorsebatterystaple"), &ReadOptions{
+		Warn: func(msg string) { warnings = append(warnings, msg) },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, samplePrivateKey, hex.EncodeToString(w.PrivateKey()))
+	assert.Equal(t, "307cc063-2344-426a-b992-3b72d5d5be0b", w.GetID().String())
+	assert.Equal(t, []string{
+		"field 'Crypto' read as 'crypto'",
+		"field 'Id' read as 'id'",
+		"missing address",
+	}, warnings)
+
+	// The vendor field is kept, and the file is written back in the standard form
+	var generic map[string]interface{}
+	err = json.Unmarshal(w.JSON(), &generic)
+	assert.NoError(t, err)
+	assert.Contains(t, generic, "x-ethers")
+	assert.Contains(t, generic, "crypto")
+	assert.NotContains(t, generic, "Crypto")
+	assert.NotContains(t, generic, "Id")
+
+	// Logged when there is no callback
+	w, err = ReadWalletFile([]byte(sampleWalletVariant), []byte("correcthorsebatterystaple"))
+	assert.NoError(t, err)
+	assert.Equal(t, samplePrivateKey, hex.EncodeToString(w.PrivateKey()))
+
+	w, err = ReadWalletFileCtx(context.Background(), []byte(sampleWalletVariant), []byte("correcthorsebatterystaple"))
+	assert.NoError(t, err)
+	assert.Equal(t, samplePrivateKey, hex.EncodeToString(w.PrivateKey()))
+
+}
+
+func TestReadWalletFileDuplicateField(t *testing.T) {
+
+	_, err := ReadWalletFile([]byte(`{"crypto":{},"Crypto":{}}`), []byte(""))
+	assert.Regexp(t, "duplicate field 'crypto'", err)
+
+	_, err = ReadWalletFile([]byte(`{"Id":5}`), []byte(""))
+	assert.Regexp(t, "invalid wallet file", err)
+
+}
+
+func TestReadWalletFileStrictOK(t *testing.T) {
+
+	w, err := ReadWalletFileWithOptions([]byte(sampleWallet), []byte("correcthorsebatterystaple"), &ReadOptions{Strict: true})
+	assert.NoError(t, err)
+	assert.Equal(t, samplePrivateKey, hex.EncodeToString(w.PrivateKey()))
+
+}
+
+func TestReadWalletFileStrictRejectsVariants(t *testing.T) {
+
+	strict := &ReadOptions{Strict: true}
+	password := []byte("correcthorsebatterystaple")
+
+	_, err := ReadWalletFileWithOptions([]byte(sampleWalletVariant), password, strict)
+	assert.Regexp(t, "field 'Crypto' must be 'crypto'", err)
+
+	noAddress := strings.Replace(sampleWallet, `"address": "5d093e9b41911be5f5c4cf91b108bac5d130fa83",`, "", 1)
+	_, err = ReadWalletFileWithOptions([]byte(noAddress), password, strict)
+	assert.Regexp(t, "missing address", err)
+
+	vendorField := strings.Replace(sampleWallet, `"version": 3`, `"version": 3, "x-ethers": {}`, 1)
+	_, err = ReadWalletFileWithOptions([]byte(vendorField), password, strict)
+	assert.Regexp(t, "unexpected field 'x-ethers'", err)
+
+	noID := strings.Replace(sampleWallet, `"id": "307cc063-2344-426a-b992-3b72d5d5be0b",`, "", 1)
+	_, err = ReadWalletFileWithOptions([]byte(noID), password, strict)
+	assert.Regexp(t, "missing field 'id'", err)
+
+	cryptoVendorField := strings.Replace(sampleWallet, `"kdf": "scrypt",`, `"kdf": "scrypt", "KDF": "scrypt",`, 1)
+	_, err = ReadWalletFileWithOptions([]byte(cryptoVendorField), password, strict)
+	assert.Regexp(t, "unexpected field 'crypto.KDF'", err)
+
+	badCrypto := `{"address":"","crypto":[],"id":"307cc063-2344-426a-b992-3b72d5d5be0b","version":3}`
+	_, err = ReadWalletFileWithOptions([]byte(badCrypto), password, strict)
+	assert.Regexp(t, "invalid crypto", err)
+
+	wrongAddress := strings.Replace(sampleWallet, "5d093e9b41911be5f5c4cf91b108bac5d130fa83", "0x1f185718734552d08278aa70f804580bab5fd2b4", 1)
+	_, err = ReadWalletFileWithOptions([]byte(wrongAddress), password, strict)
+	assert.Regexp(t, "address '0x1f185718734552d08278aa70f804580bab5fd2b4' does not match the key", err)
+
+}
@@ -0,0 +1,108 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+// KDFOptions selects the key derivation function of a new wallet file, and its cost. At most one can be set
+type KDFOptions struct {
+	Scrypt   *ScryptOptions
+	Pbkdf2   *Pbkdf2Options
+	Argon2id *Argon2idOptions
+}
+
+func (o *KDFOptions) count() int {
+	count := 0
+	if o != nil {
+		for _, set := range []bool{o.Scrypt != nil, o.Pbkdf2 != nil, o.Argon2id != nil} {
+			if set {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// NewWalletFileKDF creates a wallet file with the KDF selected by the options, which is scrypt with the
+// standard cost if none is selected
+func NewWalletFileKDF(password string, keypair *secp256k1.KeyPair, options *KDFOptions) (WalletFile, error) {
+	wf, err := newWalletFileKDFBytes(password, keypair.PrivateKeyBytes(), options)
+	if err != nil {
+		return nil, err
+	}
+	wf.Metadata()["address"] = ethtypes.AddressPlainHex(keypair.Address).String()
+	return wf, nil
+}
+
+func newWalletFileKDFBytes(password string, privateKey []byte, options *KDFOptions) (WalletFile, error) {
+	if options == nil {
+		options = &KDFOptions{}
+	}
+	switch {
+	case options.count() > 1:
+		return nil, fmt.Errorf("only one kdf can be selected")
+	case options.Pbkdf2 != nil:
+		return newPbkdf2WalletFileBytes(password, privateKey, options.Pbkdf2), nil
+	case options.Argon2id != nil:
+		return newArgon2idWalletFileBytes(password, privateKey, options.Argon2id), nil
+	default:
+		return NewWalletFileCustomBytesScrypt(password, privateKey, options.Scrypt)
+	}
+}
+
+// Reencrypt keeps the scrypt cost of this file, unless the options select a different KDF. The metadata
+// (such as the address) is copied to the new file.
+func (w *walletFileScrypt) Reencrypt(newPassword string, options *KDFOptions) (WalletFile, error) {
+	params := &w.Crypto.KDFParams
+	return w.reencrypt(newPassword, options, &KDFOptions{
+		Scrypt: &ScryptOptions{N: params.N, R: params.R, P: params.P},
+	})
+}
+
+func (w *walletFilePbkdf2) Reencrypt(newPassword string, options *KDFOptions) (WalletFile, error) {
+	return w.reencrypt(newPassword, options, &KDFOptions{
+		Pbkdf2: &Pbkdf2Options{C: w.Crypto.KDFParams.C},
+	})
+}
+
+func (w *walletFileArgon2id) Reencrypt(newPassword string, options *KDFOptions) (WalletFile, error) {
+	params := &w.Crypto.KDFParams
+	return w.reencrypt(newPassword, options, &KDFOptions{
+		Argon2id: &Argon2idOptions{Time: params.Time, Memory: params.Memory, Parallelism: params.Parallelism},
+	})
+}
+
+func (w *walletFileBase) reencrypt(newPassword string, options, current *KDFOptions) (WalletFile, error) {
+	if options.count() == 0 {
+		options = current
+	}
+	// The new file has its own copy of the key, so destroying one file does not affect the other
+	wf, err := newWalletFileKDFBytes(newPassword, bytes.Clone(w.privateKey), options)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range w.metadata {
+		wf.Metadata()[k] = v
+	}
+	return wf, nil
+}
@@ -0,0 +1,136 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonCrypto(t *testing.T, w WalletFile) []byte {
+	var generic map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(w.JSON(), &generic))
+	b, _ := json.Marshal(map[string]json.RawMessage{"crypto": generic["crypto"]})
+	return b
+}
+
+func TestReencryptKeepsKDF(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	for _, w1 := range []WalletFile{
+		NewWalletFileLight("old", keypair),
+		NewWalletFilePbkdf2("old", keypair, &Pbkdf2Options{C: 1024}),
+		NewWalletFileArgon2id("old", keypair, &Argon2idOptions{Time: 1, Memory: 1024, Parallelism: 1}),
+	} {
+		w1.Metadata()["description"] = "my key"
+
+		w2, err := w1.Reencrypt("new", nil)
+		assert.NoError(t, err)
+		assert.NotEqual(t, w1.GetID(), w2.GetID())
+
+		var crypto1, crypto2 map[string]map[string]interface{}
+		assert.NoError(t, json.Unmarshal(jsonCrypto(t, w1), &crypto1))
+		assert.NoError(t, json.Unmarshal(jsonCrypto(t, w2), &crypto2))
+		assert.Equal(t, crypto1["crypto"]["kdf"], crypto2["crypto"]["kdf"])
+		kdfParams1 := crypto1["crypto"]["kdfparams"].(map[string]interface{})
+		kdfParams2 := crypto2["crypto"]["kdfparams"].(map[string]interface{})
+		assert.NotEqual(t, kdfParams1["salt"], kdfParams2["salt"])
+		delete(kdfParams1, "salt")
+		delete(kdfParams2, "salt")
+		assert.Equal(t, kdfParams1, kdfParams2)
+		assert.NotEqual(t, crypto1["crypto"]["cipherparams"], crypto2["crypto"]["cipherparams"])
+
+		w3, err := ReadWalletFile(w2.JSON(), []byte("new"))
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.PrivateKeyBytes(), w3.PrivateKey())
+		assert.Equal(t, "my key", w3.Metadata()["description"])
+		assert.Equal(t, w1.Metadata()["address"], w3.Metadata()["address"])
+
+		_, err = ReadWalletFile(w2.JSON(), []byte("old"))
+		assert.Regexp(t, "invalid password", err)
+
+		// The files hold separate copies of the key
+		w2.(interface{ Destroy() }).Destroy()
+		assert.Equal(t, keypair.PrivateKeyBytes(), w1.PrivateKey())
+	}
+
+}
+
+func TestReencryptChangeKDF(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	w1 := NewWalletFileLight("old", keypair)
+	w2, err := ReadWalletFile(w1.JSON(), []byte("old"))
+	assert.NoError(t, err)
+
+	w3, err := w2.Reencrypt("new", &KDFOptions{Pbkdf2: &Pbkdf2Options{C: 1024}})
+	assert.NoError(t, err)
+	assert.IsType(t, &walletFilePbkdf2{}, w3)
+	assert.Equal(t, 1024, w3.(*walletFilePbkdf2).Crypto.KDFParams.C)
+
+	w4, err := w3.Reencrypt("newer", &KDFOptions{Argon2id: &Argon2idOptions{Time: 1, Memory: 1024, Parallelism: 1}})
+	assert.NoError(t, err)
+	assert.IsType(t, &walletFileArgon2id{}, w4)
+
+	w5, err := w4.Reencrypt("newest", &KDFOptions{Scrypt: &ScryptOptions{N: 2048}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2048, w5.(*walletFileScrypt).Crypto.KDFParams.N)
+
+	w6, err := ReadWalletFile(w5.JSON(), []byte("newest"))
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), w6.PrivateKey())
+	assert.Equal(t, w1.Metadata()["address"], w6.Metadata()["address"])
+
+}
+
+func TestReencryptBadOptions(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	w1 := NewWalletFileLight("old", keypair)
+
+	_, err = w1.Reencrypt("new", &KDFOptions{Scrypt: &ScryptOptions{}, Pbkdf2: &Pbkdf2Options{}})
+	assert.Regexp(t, "only one kdf", err)
+
+	_, err = w1.Reencrypt("new", &KDFOptions{Scrypt: &ScryptOptions{N: 1000}})
+	assert.Error(t, err)
+
+}
+
+func TestNewWalletFileKDF(t *testing.T) {
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	w1, err := NewWalletFileKDF("pwd", keypair, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, nStandard, w1.(*walletFileScrypt).Crypto.KDFParams.N)
+
+	w2, err := ReadWalletFile(w1.JSON(), []byte("pwd"))
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), w2.PrivateKey())
+
+	_, err = NewWalletFileKDF("pwd", keypair, &KDFOptions{Scrypt: &ScryptOptions{N: 1000}})
+	assert.Error(t, err)
+
+}
@@ -17,98 +17,112 @@
 package keystorev3
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
 
-	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
 	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
-	"golang.org/x/crypto/scrypt"
 )
 
 const defaultR = 8
 
-func readScryptWalletFile(jsonWallet []byte, password []byte, metadata map[string]interface{}) (WalletFile, error) {
+func readScryptWalletFile(ctx context.Context, jsonWallet []byte, password []byte, metadata map[string]interface{}) (WalletFile, error) {
 	var w *walletFileScrypt
 	if err := json.Unmarshal(jsonWallet, &w); err != nil {
 		return nil, fmt.Errorf("invalid scrypt wallet file: %s", err)
 	}
 	w.metadata = metadata
-	return w, w.decrypt(password)
+	return w, w.decrypt(ctx, password)
 }
 
-func mustGenerateDerivedScryptKey(password string, salt []byte, n, p int) []byte {
-	b, err := scrypt.Key([]byte(password), salt, n, defaultR, p, 16)
-	if err != nil {
-		panic(fmt.Sprintf("Scrypt failed: %s", err))
+// ScryptOptions controls the scrypt key derivation of a new wallet file. Higher costs increase the memory
+// (128 * N * R bytes) and CPU needed to decrypt the file, and its resistance to brute forcing the password
+type ScryptOptions struct {
+	// N is the CPU/memory cost - a power of two greater than 1. The standard cost is used if it is not set
+	N int
+	// R is the block size - defaults to 8
+	R int
+	// P is the parallelization - defaults to 1
+	P int
+}
+
+func (o *ScryptOptions) params() (n, r, p int) {
+	n, r, p = nStandard, defaultR, pDefault
+	if o != nil {
+		if o.N != 0 {
+			n = o.N
+		}
+		if o.R != 0 {
+			r = o.R
+		}
+		if o.P != 0 {
+			p = o.P
+		}
 	}
-	return b
+	return n, r, p
 }
 
 // creates an ethereum address wallet file
-func newScryptWalletFileSecp256k1(password string, keypair *secp256k1.KeyPair, n int, p int) WalletFile {
-	wf := newScryptWalletFileBytes(password, keypair.PrivateKeyBytes(), n, p)
+func newScryptWalletFileSecp256k1(password string, keypair *secp256k1.KeyPair, n, r, p int) (WalletFile, error) {
+	wf, err := newScryptWalletFileBytes(password, keypair.PrivateKeyBytes(), n, r, p)
+	if err != nil {
+		return nil, err
+	}
 	wf.Metadata()["address"] = ethtypes.AddressPlainHex(keypair.Address).String()
+	return wf, nil
+}
+
+func mustNewScryptWalletFileSecp256k1(password string, keypair *secp256k1.KeyPair, n, p int) WalletFile {
+	wf, err := newScryptWalletFileSecp256k1(password, keypair, n, defaultR, p)
+	if err != nil {
+		panic(err)
+	}
+	return wf
+}
+
+func mustNewScryptWalletFileBytes(password string, privateKey []byte, n, p int) WalletFile {
+	wf, err := newScryptWalletFileBytes(password, privateKey, n, defaultR, p)
+	if err != nil {
+		panic(err)
+	}
 	return wf
 }
 
 // this allows creation of any size/type of key in the store
-func newScryptWalletFileBytes(password string, privateKey []byte, n int, p int) *walletFileScrypt {
+func newScryptWalletFileBytes(password string, privateKey []byte, n, r, p int) (*walletFileScrypt, error) {
 
 	// Generate a sale for the scrypt
 	salt := mustReadBytes(32, rand.Reader)
 
 	// Do the scrypt derivation of the key with the salt from the password
-	derivedKey := mustGenerateDerivedScryptKey(password, salt, n, p)
-
-	// Generate a random Initialization Vector (IV) for the AES/CTR/128 key encryption
-	iv := mustReadBytes(16 /* 128bit */, rand.Reader)
-
-	// First 16 bytes of derived key are used as the encryption key
-	encryptKey := derivedKey[0:16]
-
-	// Encrypt the private key with the encryption key
-	cipherText := mustAES128CtrEncrypt(encryptKey, iv, privateKey)
-
-	// Last 16 bytes of derived key are used for the MAC
-	mac := generateMac(derivedKey[16:32], cipherText)
+	derivedKey, err := scryptKey(context.Background(), []byte(password), salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scrypt parameters: %s", err)
+	}
 
 	return &walletFileScrypt{
-		walletFileBase: walletFileBase{
-			walletFileCoreFields: walletFileCoreFields{
-				ID:      fftypes.NewUUID(),
-				Version: version3,
-			},
-			walletFileMetadata: walletFileMetadata{
-				metadata: map[string]interface{}{},
-			},
-			privateKey: privateKey,
-		},
+		walletFileBase: newWalletFileBase(privateKey),
 		Crypto: cryptoScrypt{
-			cryptoCommon: cryptoCommon{
-				Cipher:     cipherAES128ctr,
-				CipherText: cipherText,
-				CipherParams: cipherParams{
-					IV: iv,
-				},
-				KDF: kdfTypeScrypt,
-				MAC: mac,
-			},
+			cryptoCommon: mustEncryptCommon(kdfTypeScrypt, derivedKey, privateKey),
 			KDFParams: kdfParamsScrypt{
 				DKLen: 32,
 				N:     n,
-				R:     defaultR,
+				R:     r,
 				P:     p,
 				Salt:  salt,
 			},
 		},
-	}
+	}, nil
 }
 
-func (w *walletFileScrypt) decrypt(password []byte) error {
-	derivedKey, err := scrypt.Key(password, w.Crypto.KDFParams.Salt, w.Crypto.KDFParams.N, w.Crypto.KDFParams.R, w.Crypto.KDFParams.P, w.Crypto.KDFParams.DKLen)
+func (w *walletFileScrypt) decrypt(ctx context.Context, password []byte) error {
+	derivedKey, err := scryptKey(ctx, password, w.Crypto.KDFParams.Salt, w.Crypto.KDFParams.N, w.Crypto.KDFParams.R, w.Crypto.KDFParams.P, w.Crypto.KDFParams.DKLen)
 	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
 		return fmt.Errorf("invalid scrypt keystore: %s", err)
 	}
 	w.privateKey, err = w.Crypto.decryptCommon(derivedKey)
@@ -17,9 +17,11 @@
 package keystorev3
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
 	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
 	"github.com/stretchr/testify/assert"
 )
@@ -58,23 +60,72 @@ func TestScryptWalletRoundTripStandard(t *testing.T) {
 
 func TestScryptReadInvalidFile(t *testing.T) {
 
-	_, err := readScryptWalletFile([]byte(`!bad JSON`), []byte(""), nil)
+	_, err := readScryptWalletFile(context.Background(), []byte(`!bad JSON`), []byte(""), nil)
 	assert.Error(t, err)
 
 }
 
-func TestMustGenerateDerivedScryptKeyPanic(t *testing.T) {
+func TestMustNewScryptWalletFilePanic(t *testing.T) {
 
 	assert.Panics(t, func() {
-		mustGenerateDerivedScryptKey("", nil, 0, 1)
+		mustNewScryptWalletFileBytes("", nil, 0, 1)
 	})
+	assert.Panics(t, func() {
+		mustNewScryptWalletFileSecp256k1("", nil, 0, 1)
+	})
+
+}
+
+func TestScryptWalletCustomParams(t *testing.T) {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	w1, err := NewWalletFileScrypt("correct horse", keypair, &ScryptOptions{N: 1 << 4, R: 4, P: 2})
+	assert.NoError(t, err)
+	params := w1.(*walletFileScrypt).Crypto.KDFParams
+	assert.Equal(t, 1<<4, params.N)
+	assert.Equal(t, 4, params.R)
+	assert.Equal(t, 2, params.P)
+	assert.Equal(t, ethtypes.AddressPlainHex(keypair.Address).String(), w1.Metadata()["address"])
+
+	w2, err := ReadWalletFile(w1.JSON(), []byte("correct horse"))
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), w2.PrivateKey())
+
+}
+
+func TestScryptWalletCustomBytesDefaultParams(t *testing.T) {
+
+	w1, err := NewWalletFileCustomBytesScrypt("correct horse", []byte("any bytes"), nil)
+	assert.NoError(t, err)
+	params := w1.(*walletFileScrypt).Crypto.KDFParams
+	assert.Equal(t, nStandard, params.N)
+	assert.Equal(t, defaultR, params.R)
+	assert.Equal(t, pDefault, params.P)
+
+	w2, err := ReadWalletFile(w1.JSON(), []byte("correct horse"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("any bytes"), w2.PrivateKey())
+
+}
+
+func TestScryptWalletCustomParamsInvalid(t *testing.T) {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	_, err = NewWalletFileScrypt("correct horse", keypair, &ScryptOptions{N: 1000})
+	assert.Regexp(t, "invalid scrypt parameters", err)
+
+	w, err := NewWalletFileCustomBytesScrypt("correct horse", []byte("any bytes"), &ScryptOptions{N: 1 << 4, R: -1})
+	assert.Regexp(t, "invalid scrypt parameters", err)
+	assert.Nil(t, w)
 
 }
 
 func TestScryptWalletFileDecryptInvalid(t *testing.T) {
 
 	w := &walletFileScrypt{}
-	err := w.decrypt([]byte(""))
+	err := w.decrypt(context.Background(), []byte(""))
 	assert.Regexp(t, "invalid scrypt keystore", err)
 
 }
@@ -86,7 +137,7 @@ func TestScryptWalletFileDecryptInvalidDKLen(t *testing.T) {
 	assert.NoError(t, err)
 
 	w.Crypto.KDFParams.DKLen = 16
-	err = w.decrypt([]byte("test"))
+	err = w.decrypt(context.Background(), []byte("test"))
 	assert.Regexp(t, "derived key length", err)
 
 }
@@ -97,7 +148,7 @@ func TestScryptWalletFileDecryptBadPassword(t *testing.T) {
 	err := json.Unmarshal([]byte(sampleWallet), &w)
 	assert.NoError(t, err)
 
-	err = w.decrypt([]byte("wrong"))
+	err = w.decrypt(context.Background(), []byte("wrong"))
 	assert.Regexp(t, "invalid password", err)
 
 }
@@ -0,0 +1,71 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/sync/semaphore"
+)
+
+var scryptMemory struct {
+	mux   sync.Mutex
+	limit int64
+	sem   *semaphore.Weighted // nil when there is no limit
+}
+
+// SetScryptMemoryLimit caps the memory (in bytes) used by the scrypt key derivations running concurrently in the
+// process, when reading and writing wallet files. A derivation that would take the total over the limit waits for
+// others to complete, so decrypting several production strength files at once does not spike the memory of the
+// process. A single derivation that needs more than the limit runs once no others are in progress.
+// A limit of zero (the default) removes the cap. Derivations that are already running are not affected.
+func SetScryptMemoryLimit(limit int64) {
+	scryptMemory.mux.Lock()
+	defer scryptMemory.mux.Unlock()
+	scryptMemory.limit = limit
+	scryptMemory.sem = nil
+	if limit > 0 {
+		scryptMemory.sem = semaphore.NewWeighted(limit)
+	}
+}
+
+// ScryptMemoryCost returns the memory (in bytes) used by a scrypt key derivation with the parameters
+func ScryptMemoryCost(n, r, p int) int64 {
+	return 128*int64(r)*int64(n) + 256*int64(r) + 128*int64(r)*int64(p)
+}
+
+// scryptKey runs scrypt within the memory limit, waiting until the context is done for memory to be available
+func scryptKey(ctx context.Context, password, salt []byte, n, r, p, keyLen int) ([]byte, error) {
+	scryptMemory.mux.Lock()
+	sem, limit := scryptMemory.sem, scryptMemory.limit
+	scryptMemory.mux.Unlock()
+	if sem != nil {
+		weight := ScryptMemoryCost(n, r, p)
+		if weight > limit {
+			weight = limit
+		} else if weight < 1 {
+			weight = 1 // invalid parameters, which scrypt rejects
+		}
+		if err := sem.Acquire(ctx, weight); err != nil {
+			return nil, err
+		}
+		defer sem.Release(weight)
+	}
+	return scrypt.Key(password, salt, n, r, p, keyLen)
+}
@@ -0,0 +1,75 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystorev3
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScryptMemoryCost(t *testing.T) {
+	assert.Equal(t, int64(128*8*262144+256*8+128*8), ScryptMemoryCost(262144, 8, 1))
+}
+
+func TestScryptMemoryLimit(t *testing.T) {
+	SetScryptMemoryLimit(ScryptMemoryCost(nLight, defaultR, pDefault))
+	defer SetScryptMemoryLimit(0)
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	// Within the limit, and over the limit (runs on its own)
+	w1 := NewWalletFileLight("myPrecious", keypair)
+	w2, err := NewWalletFileScrypt("myPrecious", keypair, &ScryptOptions{N: nLight * 2})
+	assert.NoError(t, err)
+	for _, w := range []WalletFile{w1, w2} {
+		w3, err := ReadWalletFile(w.JSON(), []byte("myPrecious"))
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.PrivateKeyBytes(), w3.PrivateKey())
+	}
+
+	// Invalid parameters are still rejected by scrypt
+	_, err = NewWalletFileScrypt("myPrecious", keypair, &ScryptOptions{N: -1024})
+	assert.Regexp(t, "invalid scrypt parameters", err)
+
+}
+
+func TestScryptMemoryLimitWait(t *testing.T) {
+	SetScryptMemoryLimit(ScryptMemoryCost(nLight, defaultR, pDefault))
+	defer SetScryptMemoryLimit(0)
+
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	w1 := NewWalletFileLight("myPrecious", keypair)
+
+	// All the memory is in use, so the read waits until it is cancelled
+	assert.True(t, scryptMemory.sem.TryAcquire(scryptMemory.limit))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = readWalletFile(ctx, w1.JSON(), []byte("myPrecious"), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Once released, the read proceeds
+	scryptMemory.sem.Release(scryptMemory.limit)
+	_, err = readWalletFile(context.Background(), w1.JSON(), []byte("myPrecious"), nil)
+	assert.NoError(t, err)
+
+}
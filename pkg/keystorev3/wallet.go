@@ -17,6 +17,8 @@
 package keystorev3
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -32,26 +34,74 @@ const (
 )
 
 func NewWalletFileLight(password string, keypair *secp256k1.KeyPair) WalletFile {
-	return newScryptWalletFileSecp256k1(password, keypair, nLight, pDefault)
+	return mustNewScryptWalletFileSecp256k1(password, keypair, nLight, pDefault)
 }
 
 func NewWalletFileStandard(password string, keypair *secp256k1.KeyPair) WalletFile {
-	return newScryptWalletFileSecp256k1(password, keypair, nStandard, pDefault)
+	return mustNewScryptWalletFileSecp256k1(password, keypair, nStandard, pDefault)
 }
 
 func NewWalletFileCustomBytesLight(password string, privateKey []byte) WalletFile {
-	return newScryptWalletFileBytes(password, privateKey, nStandard, pDefault)
+	return mustNewScryptWalletFileBytes(password, privateKey, nStandard, pDefault)
 }
 
 func NewWalletFileCustomBytesStandard(password string, privateKey []byte) WalletFile {
-	return newScryptWalletFileBytes(password, privateKey, nStandard, pDefault)
+	return mustNewScryptWalletFileBytes(password, privateKey, nStandard, pDefault)
 }
 
+// NewWalletFileScrypt creates a wallet file with the scrypt cost set by the options - such as a light cost
+// for test fixtures, or a heavy one for production keys. An error is returned if the parameters are invalid
+func NewWalletFileScrypt(password string, keypair *secp256k1.KeyPair, options *ScryptOptions) (WalletFile, error) {
+	n, r, p := options.params()
+	return newScryptWalletFileSecp256k1(password, keypair, n, r, p)
+}
+
+func NewWalletFileCustomBytesScrypt(password string, privateKey []byte, options *ScryptOptions) (WalletFile, error) {
+	n, r, p := options.params()
+	wf, err := newScryptWalletFileBytes(password, privateKey, n, r, p)
+	if err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+// NewWalletFilePbkdf2 creates a wallet file using PBKDF2-HMAC-SHA256 in place of scrypt, for compatibility
+// with clients that only support pbkdf2, or to tune the CPU cost of decryption with the iteration count
+func NewWalletFilePbkdf2(password string, keypair *secp256k1.KeyPair, options *Pbkdf2Options) WalletFile {
+	return newPbkdf2WalletFileSecp256k1(password, keypair, options)
+}
+
+func NewWalletFileCustomBytesPbkdf2(password string, privateKey []byte, options *Pbkdf2Options) WalletFile {
+	return newPbkdf2WalletFileBytes(password, privateKey, options)
+}
+
+// NewWalletFileArgon2id creates a wallet file using Argon2id in place of scrypt. This is a non-standard
+// extension ("kdf": "argon2id") that other V3 keystore clients will not be able to read
+func NewWalletFileArgon2id(password string, keypair *secp256k1.KeyPair, options *Argon2idOptions) WalletFile {
+	return newArgon2idWalletFileSecp256k1(password, keypair, options)
+}
+
+func NewWalletFileCustomBytesArgon2id(password string, privateKey []byte, options *Argon2idOptions) WalletFile {
+	return newArgon2idWalletFileBytes(password, privateKey, options)
+}
+
+// ReadWalletFile decrypts a wallet file, parsing it leniently (see ReadOptions)
 func ReadWalletFile(jsonWallet []byte, password []byte) (WalletFile, error) {
+	return readWalletFile(context.Background(), jsonWallet, password, nil)
+}
+
+func readWalletFile(ctx context.Context, jsonWallet []byte, password []byte, options *ReadOptions) (WalletFile, error) {
+	if options == nil {
+		options = &ReadOptions{}
+	}
+	jsonWallet, err := normalizeWalletFile(ctx, jsonWallet, options)
+	if err != nil {
+		return nil, err
+	}
 	var w walletFileCommon
-	err := json.Unmarshal(jsonWallet, &w)
+	err = json.Unmarshal(jsonWallet, &w)
 	if err == nil {
-		err = json.Unmarshal(jsonWallet, &w.metadata)
+		w.metadata, err = readMetadata(jsonWallet)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("invalid wallet file: %s", err)
@@ -62,14 +112,65 @@ func ReadWalletFile(jsonWallet []byte, password []byte) (WalletFile, error) {
 	if w.Version != version3 {
 		return nil, fmt.Errorf("incorrect keyfile version (only V3 supported): %d", w.Version)
 	}
+	var wf WalletFile
 	switch w.Crypto.KDF {
 	case kdfTypeScrypt:
-		return readScryptWalletFile(jsonWallet, password, w.metadata)
+		wf, err = readScryptWalletFile(ctx, jsonWallet, password, w.metadata)
 	case kdfTypePbkdf2:
-		return readPbkdf2WalletFile(jsonWallet, password, w.metadata)
+		wf, err = readPbkdf2WalletFile(jsonWallet, password, w.metadata)
+	case kdfTypeArgon2id:
+		wf, err = readArgon2idWalletFile(jsonWallet, password, w.metadata)
 	default:
 		return nil, fmt.Errorf("unsupported kdf: %s", w.Crypto.KDF)
 	}
+	if err == nil && options.Strict {
+		err = checkAddress(wf)
+	}
+	return wf, err
+}
+
+// readMetadata returns the top-level fields of the file other than the core fields (id/version/crypto), so they
+// are written back unchanged when the file is serialized. Numbers are kept in their original form, so large
+// integers do not lose precision.
+func readMetadata(jsonWallet []byte) (map[string]interface{}, error) {
+	var metadata map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonWallet))
+	decoder.UseNumber()
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, err
+	}
+	delete(metadata, "id")
+	delete(metadata, "version")
+	delete(metadata, "crypto")
+	return metadata, nil
+}
+
+// ReadWalletFileCtx behaves as ReadWalletFile, but returns to the caller as soon as the
+// context is cancelled or reaches its deadline.
+//
+// Note this does NOT stop the work. The KDF cannot be interrupted part way through, so it
+// runs to completion in the background (consuming the full CPU and memory of the KDF) and
+// the result is discarded. Callers that might retry should share or cache the result,
+// rather than calling this repeatedly for the same file.
+func ReadWalletFileCtx(ctx context.Context, jsonWallet []byte, password []byte) (WalletFile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type readResult struct {
+		wf  WalletFile
+		err error
+	}
+	done := make(chan readResult, 1)
+	go func() {
+		wf, err := readWalletFile(ctx, jsonWallet, password, nil)
+		done <- readResult{wf, err}
+	}()
+	select {
+	case r := <-done:
+		return r.wf, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 func mustReadBytes(size int, r io.Reader) []byte {
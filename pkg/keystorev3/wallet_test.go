@@ -17,12 +17,16 @@
 package keystorev3
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"testing"
 	"testing/iotest"
+	"time"
 
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
 	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
 	"github.com/stretchr/testify/assert"
 )
@@ -166,6 +170,29 @@ func TestWalletFileCustomBytesLight(t *testing.T) {
 	assert.Equal(t, kp.Address, w2.KeyPair().Address)
 }
 
+func TestWalletFileDestroy(t *testing.T) {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	w, err := ReadWalletFile(NewWalletFileLight("correcthorsebatterystaple", keypair).JSON(), []byte("correcthorsebatterystaple"))
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), w.PrivateKey())
+
+	w.(interface{ Destroy() }).Destroy()
+	assert.Equal(t, make([]byte, 32), w.PrivateKey())
+}
+
+func TestDerivedKeyWiped(t *testing.T) {
+	derivedKey := mustReadBytes(32, rand.Reader)
+	c := mustEncryptCommon(kdfTypePbkdf2, derivedKey, []byte("secret"))
+	assert.Equal(t, make([]byte, 32), derivedKey)
+
+	derivedKey = mustReadBytes(32, rand.Reader)
+	_, err := c.decryptCommon(derivedKey)
+	assert.Regexp(t, "invalid password", err)
+	assert.Equal(t, make([]byte, 32), derivedKey)
+}
+
 func TestMarshalWalletJSONFail(t *testing.T) {
 	_, err := marshalWalletJSON(&walletFileBase{}, map[bool]bool{false: true})
 	assert.Error(t, err)
@@ -195,3 +222,52 @@ func TestWalletFileCustomBytesUnsetAddress(t *testing.T) {
 	assert.Equal(t, w.GetID().String(), roundTripBackFromJSON["id"])
 
 }
+
+func TestReadWalletFileCtxOK(t *testing.T) {
+	w, err := ReadWalletFileCtx(context.Background(), []byte(sampleWalletPbkdf2), []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.NotNil(t, w.KeyPair())
+}
+
+func TestReadWalletFileCtxAlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ReadWalletFileCtx(ctx, []byte(sampleWallet), []byte("correcthorsebatterystaple"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReadWalletFileCtxTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
+	defer cancel()
+	_, err := ReadWalletFileCtx(ctx, []byte(sampleWallet), []byte("correcthorsebatterystaple"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestReadWalletFileRoundTripMetadata(t *testing.T) {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	w1 := NewWalletFilePbkdf2("myPrecious", keypair, &Pbkdf2Options{C: 1024})
+	var generic map[string]interface{}
+	err = json.Unmarshal(w1.JSON(), &generic)
+	assert.NoError(t, err)
+	generic["label"] = "treasury"
+	generic["tags"] = []interface{}{"a", "b"}
+	generic["vendor"] = map[string]interface{}{"created": json.Number("1700000000123456789")}
+	jsonWallet, err := json.Marshal(generic)
+	assert.NoError(t, err)
+
+	w2, err := ReadWalletFile(jsonWallet, []byte("myPrecious"))
+	assert.NoError(t, err)
+	assert.Equal(t, w1.GetID(), w2.GetID())
+	assert.Equal(t, 3, w2.GetVersion())
+	assert.Equal(t, map[string]interface{}{
+		"address": ethtypes.AddressPlainHex(keypair.Address).String(),
+		"label":   "treasury",
+		"tags":    []interface{}{"a", "b"},
+		"vendor":  map[string]interface{}{"created": json.Number("1700000000123456789")},
+	}, w2.Metadata())
+	assert.JSONEq(t, string(jsonWallet), string(w2.JSON()))
+	assert.Contains(t, string(w2.JSON()), `"created":1700000000123456789`)
+
+}
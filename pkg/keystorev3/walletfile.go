@@ -18,6 +18,7 @@ package keystorev3
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 
@@ -31,6 +32,7 @@ const (
 	cipherAES128ctr = "aes-128-ctr"
 	kdfTypeScrypt   = "scrypt"
 	kdfTypePbkdf2   = "pbkdf2"
+	kdfTypeArgon2id = "argon2id" // not part of the V3 standard
 )
 
 type WalletFile interface {
@@ -46,7 +48,14 @@ type WalletFile interface {
 	// an arbitrary string, adding new fields for different key identifiers (like "bjj" or "btc" for
 	// different public key compression algos).
 	// If you want to remove the address field completely, simple set "address": nil in the map.
+	// For a file that has been read, this holds every top-level field other than id/version/crypto, so fields
+	// added by other tooling are preserved when the file is written back out. The id and version are available
+	// from GetID and GetVersion.
 	Metadata() map[string]interface{}
+
+	// Reencrypt returns a new wallet file for the same key under a new password, with a fresh salt, IV and ID.
+	// The KDF and its cost are kept unless the options select a different one.
+	Reencrypt(newPassword string, options *KDFOptions) (WalletFile, error)
 }
 
 type kdfParamsScrypt struct {
@@ -64,6 +73,14 @@ type kdfParamsPbkdf2 struct {
 	Salt  ethtypes.HexBytesPlain `json:"salt"`
 }
 
+type kdfParamsArgon2id struct {
+	DKLen       int                    `json:"dklen"`
+	Memory      uint32                 `json:"memory"` // KiB
+	Time        uint32                 `json:"time"`
+	Parallelism uint8                  `json:"parallelism"`
+	Salt        ethtypes.HexBytesPlain `json:"salt"`
+}
+
 type cipherParams struct {
 	IV ethtypes.HexBytesPlain `json:"iv"`
 }
@@ -86,6 +103,11 @@ type cryptoPbkdf2 struct {
 	KDFParams kdfParamsPbkdf2 `json:"kdfparams"`
 }
 
+type cryptoArgon2id struct {
+	cryptoCommon
+	KDFParams kdfParamsArgon2id `json:"kdfparams"`
+}
+
 type walletFileCoreFields struct {
 	ID      *fftypes.UUID `json:"id"`
 	Version int           `json:"version"`
@@ -125,6 +147,15 @@ func (w *walletFileScrypt) MarshalJSON() ([]byte, error) {
 	return marshalWalletJSON(&w.walletFileBase, w.Crypto)
 }
 
+type walletFileArgon2id struct {
+	walletFileBase
+	Crypto cryptoArgon2id `json:"crypto"`
+}
+
+func (w *walletFileArgon2id) MarshalJSON() ([]byte, error) {
+	return marshalWalletJSON(&w.walletFileBase, w.Crypto)
+}
+
 func (w *walletFileBase) GetVersion() int {
 	return w.Version
 }
@@ -163,6 +194,19 @@ func (w *walletFileBase) PrivateKey() []byte {
 	return w.privateKey
 }
 
+// Destroy zeroes the decrypted private key held by the wallet file. The wallet file must not be used
+// for signing (or serialized) after it has been destroyed.
+func (w *walletFileBase) Destroy() {
+	zeroBytes(w.privateKey)
+}
+
+// zeroBytes wipes a buffer that held key material
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 func (w *walletFilePbkdf2) JSON() []byte {
 	b, _ := json.Marshal(w)
 	return b
@@ -173,7 +217,55 @@ func (w *walletFileScrypt) JSON() []byte {
 	return b
 }
 
+func (w *walletFileArgon2id) JSON() []byte {
+	b, _ := json.Marshal(w)
+	return b
+}
+
+func newWalletFileBase(privateKey []byte) walletFileBase {
+	return walletFileBase{
+		walletFileCoreFields: walletFileCoreFields{
+			ID:      fftypes.NewUUID(),
+			Version: version3,
+		},
+		walletFileMetadata: walletFileMetadata{
+			metadata: map[string]interface{}{},
+		},
+		privateKey: privateKey,
+	}
+}
+
+// mustEncryptCommon encrypts the private key with a key derived by the KDF, which must be 32 bytes.
+// The derived key is wiped once it has been used.
+func mustEncryptCommon(kdf string, derivedKey []byte, privateKey []byte) cryptoCommon {
+	defer zeroBytes(derivedKey)
+
+	// Generate a random Initialization Vector (IV) for the AES/CTR/128 key encryption
+	iv := mustReadBytes(16 /* 128bit */, rand.Reader)
+
+	// First 16 bytes of derived key are used as the encryption key
+	encryptKey := derivedKey[0:16]
+
+	// Encrypt the private key with the encryption key
+	cipherText := mustAES128CtrEncrypt(encryptKey, iv, privateKey)
+
+	// Last 16 bytes of derived key are used for the MAC
+	mac := generateMac(derivedKey[16:32], cipherText)
+
+	return cryptoCommon{
+		Cipher:     cipherAES128ctr,
+		CipherText: cipherText,
+		CipherParams: cipherParams{
+			IV: iv,
+		},
+		KDF: kdf,
+		MAC: mac,
+	}
+}
+
+// decryptCommon checks the MAC and decrypts the private key. The derived key is wiped once it has been used.
 func (c *cryptoCommon) decryptCommon(derivedKey []byte) ([]byte, error) {
+	defer zeroBytes(derivedKey)
 	if len(derivedKey) != 32 {
 		return nil, fmt.Errorf("invalid scrypt keystore: derived key length %d != 32", len(derivedKey))
 	}
@@ -0,0 +1,245 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memwallet is a wallet that holds its keys in memory, for use in tests and development
+// environments. The keys are supplied directly, or derived from a seed or mnemonic, so the same
+// accounts are available every time.
+package memwallet
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/hdwallet"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+)
+
+// DevMnemonic is the mnemonic of the pre-funded development accounts of Hardhat, Anvil and others.
+// The keys derived from it are published, so must never be used for anything of value.
+const DevMnemonic = "test test test test test test test test test test test junk"
+
+// DevAccountPath is the BIP-44 derivation path of the development accounts, with the account index appended
+const DevAccountPath = "m/44'/60'/0'/0"
+
+// Wallet is an ethsigner.Wallet with keys held in memory, that can be added to after creation
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	ethsigner.AuthorizationWallet
+	AddKey(ctx context.Context, privateKey []byte) (*ethtypes.Address0xHex, error)
+	AddHexKey(ctx context.Context, hexKey string) (*ethtypes.Address0xHex, error)
+	KeyPair(ctx context.Context, addr ethtypes.Address0xHex) (*secp256k1.KeyPair, error)
+}
+
+type memWallet struct {
+	mux         sync.Mutex
+	closed      bool
+	keys        map[ethtypes.Address0xHex]*secp256k1.KeyPair
+	addressList []*ethtypes.Address0xHex // in the order the keys were added
+}
+
+// New returns a wallet holding the supplied key pairs, which are destroyed when the wallet is closed
+func New(keys ...*secp256k1.KeyPair) Wallet {
+	w := &memWallet{
+		keys: make(map[ethtypes.Address0xHex]*secp256k1.KeyPair),
+	}
+	for _, kp := range keys {
+		w.add(kp)
+	}
+	return w
+}
+
+// NewFromHexKeys returns a wallet holding the supplied hex encoded private keys, optionally 0x prefixed
+func NewFromHexKeys(ctx context.Context, hexKeys ...string) (Wallet, error) {
+	w := New()
+	for _, hexKey := range hexKeys {
+		if _, err := w.AddHexKey(ctx, hexKey); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// NewFromSeed returns a wallet holding the first count keys derived from a BIP-32 seed at DevAccountPath/0, DevAccountPath/1 etc.
+func NewFromSeed(ctx context.Context, seed []byte, count int) (Wallet, error) {
+	master, err := hdwallet.NewMasterKey(seed)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgDeriveKeysFailed, err)
+	}
+	return newFromMasterKey(ctx, master, count)
+}
+
+// NewFromMnemonic returns a wallet holding the first count keys derived from a BIP-39 mnemonic (with no passphrase),
+// at DevAccountPath/0, DevAccountPath/1 etc. - the same accounts as most wallets and development tools use.
+func NewFromMnemonic(ctx context.Context, mnemonic string, count int) (Wallet, error) {
+	master, err := hdwallet.NewMasterKeyFromMnemonic(mnemonic, "")
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgDeriveKeysFailed, err)
+	}
+	return newFromMasterKey(ctx, master, count)
+}
+
+// NewDevWallet returns a wallet holding the first count development accounts derived from DevMnemonic,
+// which development chains such as Hardhat and Anvil fund at startup, and which can be funded on
+// other chains with GenesisAlloc
+func NewDevWallet(ctx context.Context, count int) (Wallet, error) {
+	return NewFromMnemonic(ctx, DevMnemonic, count)
+}
+
+func newFromMasterKey(ctx context.Context, master *hdwallet.ExtendedKey, count int) (Wallet, error) {
+	account, err := master.DerivePath(DevAccountPath)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgDeriveKeysFailed, err)
+	}
+	w := New()
+	for i := 0; i < count; i++ {
+		key, err := account.Child(uint32(i))
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgDeriveKeysFailed, err)
+		}
+		w.(*memWallet).add(key.KeyPair())
+	}
+	return w, nil
+}
+
+// GenesisAccount is the entry for an account in the "alloc" section of a genesis file
+type GenesisAccount struct {
+	Balance *ethtypes.HexInteger `json:"balance"`
+}
+
+// GenesisAlloc returns the "alloc" section of a genesis file, that funds each of the accounts with the balance (in wei)
+func GenesisAlloc(accounts []*ethtypes.Address0xHex, balance *ethtypes.HexInteger) map[string]*GenesisAccount {
+	alloc := make(map[string]*GenesisAccount, len(accounts))
+	for _, addr := range accounts {
+		alloc[addr.String()] = &GenesisAccount{Balance: balance}
+	}
+	return alloc
+}
+
+// must be called holding the mux, or before the wallet is returned
+func (w *memWallet) add(kp *secp256k1.KeyPair) *ethtypes.Address0xHex {
+	addr := kp.Address
+	if _, exists := w.keys[addr]; !exists {
+		w.addressList = append(w.addressList, &addr)
+	}
+	w.keys[addr] = kp
+	return &addr
+}
+
+func (w *memWallet) AddKey(ctx context.Context, privateKey []byte) (*ethtypes.Address0xHex, error) {
+	if err := secp256k1.ValidatePrivateKeyBytes(privateKey); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidPrivateKey, err)
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	return w.add(secp256k1.KeyPairFromBytes(privateKey)), nil
+}
+
+func (w *memWallet) AddHexKey(ctx context.Context, hexKey string) (*ethtypes.Address0xHex, error) {
+	privateKey, err := hex.DecodeString(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgInvalidPrivateKey, err)
+	}
+	return w.AddKey(ctx, privateKey)
+}
+
+// KeyPair returns the key pair for an address, which remains owned by the wallet (so must not be destroyed)
+func (w *memWallet) KeyPair(ctx context.Context, addr ethtypes.Address0xHex) (*secp256k1.KeyPair, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	kp := w.keys[addr]
+	if kp == nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+	}
+	return kp, nil
+}
+
+func (w *memWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *memWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	kp, err := w.KeyPair(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return txn.SignBig(kp, chainID)
+}
+
+func (w *memWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	kp, err := w.KeyPair(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return ethsigner.SignTypedDataV4(ctx, kp, payload)
+}
+
+func (w *memWallet) SignAuthorization(ctx context.Context, from ethtypes.Address0xHex, auth *ethsigner.Authorization) error {
+	kp, err := w.KeyPair(ctx, from)
+	if err != nil {
+		return err
+	}
+	return auth.Sign(kp)
+}
+
+func (w *memWallet) Initialize(_ context.Context) error {
+	return nil
+}
+
+func (w *memWallet) GetAccounts(ctx context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	return append([]*ethtypes.Address0xHex{}, w.addressList...), nil
+}
+
+func (w *memWallet) Refresh(_ context.Context) error {
+	return nil
+}
+
+// Close destroys all the keys held by the wallet
+func (w *memWallet) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for _, kp := range w.keys {
+		kp.Destroy()
+	}
+	w.keys = map[ethtypes.Address0xHex]*secp256k1.KeyPair{}
+	w.addressList = nil
+	w.closed = true
+	return nil
+}
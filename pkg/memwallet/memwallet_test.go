@@ -0,0 +1,196 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memwallet
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/hdwallet"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+// First development account of Hardhat and Anvil
+const devKey0 = "0xac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+
+func TestDevWallet(t *testing.T) {
+
+	ctx := context.Background()
+	w, err := NewDevWallet(ctx, 3)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Initialize(ctx))
+	assert.NoError(t, w.Refresh(ctx))
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{
+		ethtypes.MustNewAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"),
+		ethtypes.MustNewAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8"),
+		ethtypes.MustNewAddress("0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC"),
+	}, accounts)
+
+	kp, err := w.KeyPair(ctx, *accounts[0])
+	assert.NoError(t, err)
+	assert.Equal(t, devKey0, ethtypes.HexBytes0xPrefix(kp.PrivateKeyBytes()).String())
+
+}
+
+func TestHexKeys(t *testing.T) {
+
+	ctx := context.Background()
+	w, err := NewFromHexKeys(ctx, devKey0, devKey0[2:])
+	assert.NoError(t, err)
+
+	// Adding the same key again does not duplicate the account
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{ethtypes.MustNewAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")}, accounts)
+
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	addr, err := w.AddKey(ctx, kp.PrivateKeyBytes())
+	assert.NoError(t, err)
+	assert.Equal(t, kp.Address, *addr)
+
+	accounts, err = w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 2)
+
+}
+
+func TestBadHexKeys(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := NewFromHexKeys(ctx, "not hex")
+	assert.Regexp(t, "FF22172", err)
+
+	_, err = NewFromHexKeys(ctx, "0x"+"ff"+devKey0[4:]+"ffff")
+	assert.Regexp(t, "FF22172.*length", err)
+
+	_, err = NewFromHexKeys(ctx, "0x00")
+	assert.Regexp(t, "FF22172.*zero", err)
+
+}
+
+func TestFromSeed(t *testing.T) {
+
+	ctx := context.Background()
+	w, err := NewFromSeed(ctx, hdwallet.MnemonicToSeed(DevMnemonic, ""), 1)
+	assert.NoError(t, err)
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", accounts[0].String())
+
+	_, err = NewFromSeed(ctx, []byte("short"), 1)
+	assert.Regexp(t, "FF22173.*seed length", err)
+
+}
+
+func TestBadMnemonic(t *testing.T) {
+
+	_, err := NewFromMnemonic(context.Background(), "test test", 1)
+	assert.Regexp(t, "FF22173", err)
+
+}
+
+func TestSign(t *testing.T) {
+
+	ctx := context.Background()
+	w, err := NewFromHexKeys(ctx, devKey0)
+	assert.NoError(t, err)
+
+	raw, err := w.Sign(ctx, &ethsigner.Transaction{
+		From:     json.RawMessage(`"0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"`),
+		Nonce:    ethtypes.NewHexInteger64(0),
+		GasLimit: ethtypes.NewHexInteger64(21000),
+	}, 1337)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, raw)
+
+	result, err := w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, result.SignatureRSV, 65)
+
+	auth := &ethsigner.Authorization{ChainID: ethtypes.NewHexInteger64(1337)}
+	err = w.SignAuthorization(ctx, *ethtypes.MustNewAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"), auth)
+	assert.NoError(t, err)
+	authority, err := auth.RecoverAuthority()
+	assert.NoError(t, err)
+	assert.Equal(t, "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", authority.String())
+
+}
+
+func TestSignErrors(t *testing.T) {
+
+	ctx := context.Background()
+	w := New()
+
+	_, err := w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"bad"`)}, 1337)
+	assert.Regexp(t, "bad address", err)
+
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"`)}, 1337)
+	assert.Regexp(t, "FF22014", err)
+
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"), &eip712.TypedData{})
+	assert.Regexp(t, "FF22014", err)
+
+	err = w.SignAuthorization(ctx, *ethtypes.MustNewAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"), &ethsigner.Authorization{})
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestClose(t *testing.T) {
+
+	ctx := context.Background()
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	w := New(kp)
+	assert.NoError(t, w.Close())
+	assert.True(t, kp.PrivateKey.Key.IsZero())
+
+	_, err = w.GetAccounts(ctx)
+	assert.Regexp(t, "FF22103", err)
+	_, err = w.KeyPair(ctx, kp.Address)
+	assert.Regexp(t, "FF22103", err)
+	_, err = w.AddHexKey(ctx, devKey0)
+	assert.Regexp(t, "FF22103", err)
+
+}
+
+func TestGenesisAlloc(t *testing.T) {
+
+	ctx := context.Background()
+	w, err := NewDevWallet(ctx, 2)
+	assert.NoError(t, err)
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+
+	b, err := json.Marshal(GenesisAlloc(accounts, ethtypes.NewHexInteger64(1000000000000000000)))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266": {"balance": "0xde0b6b3a7640000"},
+		"0x70997970c51812dc3a010c7d01b50e0d17dc79c8": {"balance": "0xde0b6b3a7640000"}
+	}`, string(b))
+
+}
@@ -0,0 +1,237 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mpcwallet adapts a threshold (MPC) signing provider to an ethsigner.Wallet. The provider holds each
+// key as shares across a number of parties, any threshold of which can together sign a hash - so it only has to
+// implement the DistributedSigner interface, and the wallet takes care of hashing transactions and typed data,
+// collecting partial signatures and completing the aggregated signature for Ethereum.
+package mpcwallet
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+// PartialSignature is one party's signature over a hash with its share of a key. The data is opaque to the
+// wallet, and only interpreted by the Aggregate function of the same DistributedSigner.
+type PartialSignature struct {
+	Party string
+	Data  []byte
+}
+
+// DistributedSigner is the interface a threshold (MPC) signing provider implements. The hash is always
+// the 32 byte Keccak-256 hash of the payload to sign.
+type DistributedSigner interface {
+	// Accounts returns the addresses of the keys held by the parties
+	Accounts(ctx context.Context) ([]*ethtypes.Address0xHex, error)
+	// Parties returns the parties holding shares of the key for an address, and the number of them required to sign
+	Parties(ctx context.Context, addr ethtypes.Address0xHex) (parties []string, threshold int, err error)
+	// PartialSign asks one party to sign the hash with its share of the key for an address
+	PartialSign(ctx context.Context, party string, addr ethtypes.Address0xHex, hash []byte) (*PartialSignature, error)
+	// Aggregate combines exactly threshold partial signatures from different parties into the R and S of
+	// the signature over the hash
+	Aggregate(ctx context.Context, addr ethtypes.Address0xHex, hash []byte, partials []*PartialSignature) (r, s *big.Int, err error)
+}
+
+// Wallet is an ethsigner.Wallet that signs through a DistributedSigner
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+}
+
+type mpcWallet struct {
+	signer DistributedSigner
+
+	mux         sync.Mutex
+	addresses   map[ethtypes.Address0xHex]bool
+	addressList []*ethtypes.Address0xHex // in the order returned by the signer
+}
+
+// mpcSigner implements secp256k1.SignerDirect by collecting partial signatures for one address from the parties
+type mpcSigner struct {
+	ctx     context.Context
+	w       *mpcWallet
+	address ethtypes.Address0xHex
+}
+
+// NewMPCWallet returns a wallet that signs through the supplied DistributedSigner
+func NewMPCWallet(signer DistributedSigner) Wallet {
+	return &mpcWallet{
+		signer:    signer,
+		addresses: make(map[ethtypes.Address0xHex]bool),
+	}
+}
+
+func (w *mpcWallet) Initialize(ctx context.Context) error {
+	return w.Refresh(ctx)
+}
+
+// Refresh re-reads the accounts from the signer
+func (w *mpcWallet) Refresh(ctx context.Context) error {
+	accounts, err := w.signer.Accounts(ctx)
+	if err != nil {
+		return err
+	}
+	addresses := make(map[ethtypes.Address0xHex]bool, len(accounts))
+	addressList := make([]*ethtypes.Address0xHex, 0, len(accounts))
+	for _, addr := range accounts {
+		if !addresses[*addr] {
+			addresses[*addr] = true
+			addressList = append(addressList, addr)
+		}
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.addresses = addresses
+	w.addressList = addressList
+	log.L(ctx).Debugf("Indexed %d distributed keys", len(addressList))
+	return nil
+}
+
+// GetAccounts returns the addresses returned by the signer on the last Refresh
+func (w *mpcWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+func (w *mpcWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *mpcWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	signer, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return txn.SignBig(signer, chainID)
+}
+
+func (w *mpcWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	signer, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return ethsigner.SignTypedDataV4(ctx, signer, payload)
+}
+
+// getSignerForAddr returns a signer for the address, re-reading the accounts once if the address is
+// not known (as the key might have been generated by the parties since the last Refresh)
+func (w *mpcWallet) getSignerForAddr(ctx context.Context, addr ethtypes.Address0xHex) (*mpcSigner, error) {
+	w.mux.Lock()
+	ok := w.addresses[addr]
+	w.mux.Unlock()
+	if !ok {
+		if err := w.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		w.mux.Lock()
+		ok = w.addresses[addr]
+		w.mux.Unlock()
+		if !ok {
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+		}
+	}
+	return &mpcSigner{ctx: ctx, w: w, address: addr}, nil
+}
+
+func (w *mpcWallet) Close() error {
+	return nil
+}
+
+// Sign hashes the input then signs it
+func (s *mpcSigner) Sign(message []byte) (*secp256k1.SignatureData, error) {
+	msgHash := sha3.NewLegacyKeccak256()
+	msgHash.Write(message)
+	return s.SignDirect(msgHash.Sum(nil))
+}
+
+// SignDirect asks all the parties for a partial signature over the hash in parallel, and aggregates the
+// first threshold to be returned - so signing succeeds as long as enough of the parties are available
+func (s *mpcSigner) SignDirect(hash []byte) (*secp256k1.SignatureData, error) {
+	ctx := s.ctx
+	parties, threshold, err := s.w.signer.Parties(ctx, s.address)
+	if err != nil {
+		return nil, err
+	}
+	if threshold < 1 || threshold > len(parties) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgMPCBadThreshold, threshold, len(parties), s.address)
+	}
+	partials, err := s.collectPartials(ctx, parties, threshold, hash)
+	if err != nil {
+		return nil, err
+	}
+	r, sv, err := s.w.signer.Aggregate(ctx, s.address, hash, partials)
+	if err != nil {
+		return nil, err
+	}
+	sig, ok := secp256k1.NewSignatureFromRS(hash, r, sv, s.address)
+	if !ok {
+		return nil, i18n.NewError(ctx, signermsgs.MsgMPCSignatureInvalid, s.address)
+	}
+	return sig, nil
+}
+
+type partialResult struct {
+	party   string
+	partial *PartialSignature
+	err     error
+}
+
+func (s *mpcSigner) collectPartials(ctx context.Context, parties []string, threshold int, hash []byte) ([]*PartialSignature, error) {
+	// The parties still signing once the threshold is reached are cancelled
+	partyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan *partialResult, len(parties))
+	for _, party := range parties {
+		go func(party string) {
+			partial, err := s.w.signer.PartialSign(partyCtx, party, s.address, hash)
+			results <- &partialResult{party: party, partial: partial, err: err}
+		}(party)
+	}
+	partials := make([]*PartialSignature, 0, threshold)
+	var failures []string
+	for range parties {
+		res := <-results
+		if res.err != nil {
+			log.L(ctx).Warnf("Party %s failed to sign for %s: %s", res.party, s.address, res.err)
+			failures = append(failures, res.party+": "+res.err.Error())
+			continue
+		}
+		if partials = append(partials, res.partial); len(partials) == threshold {
+			return partials, nil
+		}
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgMPCNotEnoughPartials, len(partials), threshold, s.address, strings.Join(failures, "; "))
+}
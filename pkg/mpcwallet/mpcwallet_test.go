@@ -0,0 +1,319 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpcwallet
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+// thresholdSigner is a reference 2-of-3 DistributedSigner for tests. Each key is split with Shamir secret
+// sharing by a trusted dealer, and each party returns s_i = k^-1 * (z + r * x_i) for its share x_i - which
+// the Lagrange coefficients of any two parties combine into the ECDSA s = k^-1 * (z + r * d).
+// It is NOT secure: the nonce k is derived from a seed every party holds, so any one party and a signature
+// reveal the key. A real provider generates the nonce jointly, without any party learning it.
+type thresholdSigner struct {
+	mux         sync.Mutex
+	parties     map[string]*testParty
+	partyNames  []string
+	threshold   int
+	accounts    []*ethtypes.Address0xHex
+	nonceSeeds  map[ethtypes.Address0xHex][]byte
+	accountsErr error
+	partiesErr  error
+	aggErr      error
+	badAgg      bool
+}
+
+type testParty struct {
+	index  int64
+	shares map[ethtypes.Address0xHex]*big.Int
+	err    error
+	block  bool // until the request is cancelled
+}
+
+var curveN = btcec.S256().N
+
+func newThresholdSigner(t *testing.T, keys ...*secp256k1.KeyPair) *thresholdSigner {
+	ts := &thresholdSigner{
+		parties:    make(map[string]*testParty),
+		partyNames: []string{"alice", "bob", "carol"},
+		threshold:  2,
+		nonceSeeds: make(map[ethtypes.Address0xHex][]byte),
+	}
+	for i, name := range ts.partyNames {
+		ts.parties[name] = &testParty{index: int64(i + 1), shares: make(map[ethtypes.Address0xHex]*big.Int)}
+	}
+	for _, kp := range keys {
+		ts.deal(t, kp)
+	}
+	return ts
+}
+
+// deal splits the key into shares on the line f(x) = d + a*x, giving f(i) to party i
+func (ts *thresholdSigner) deal(t *testing.T, kp *secp256k1.KeyPair) {
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	a, err := rand.Int(rand.Reader, curveN)
+	assert.NoError(t, err)
+	d := new(big.Int).SetBytes(kp.PrivateKeyBytes())
+	for _, p := range ts.parties {
+		share := new(big.Int).Mul(a, big.NewInt(p.index))
+		p.shares[kp.Address] = share.Add(share, d).Mod(share, curveN)
+	}
+	seed := make([]byte, 32)
+	_, _ = rand.Read(seed)
+	ts.nonceSeeds[kp.Address] = seed
+	ts.accounts = append(ts.accounts, &kp.Address)
+}
+
+func (ts *thresholdSigner) setPartyErr(party string, err error) {
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	ts.parties[party].err = err
+}
+
+func (ts *thresholdSigner) Accounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	return append([]*ethtypes.Address0xHex{}, ts.accounts...), ts.accountsErr
+}
+
+func (ts *thresholdSigner) Parties(_ context.Context, _ ethtypes.Address0xHex) ([]string, int, error) {
+	return ts.partyNames, ts.threshold, ts.partiesErr
+}
+
+func (ts *thresholdSigner) PartialSign(ctx context.Context, party string, addr ethtypes.Address0xHex, hash []byte) (*PartialSignature, error) {
+	ts.mux.Lock()
+	p := ts.parties[party]
+	block, err := p.block, p.err
+	mac := hmac.New(sha256.New, ts.nonceSeeds[addr])
+	share := p.shares[addr]
+	ts.mux.Unlock()
+	if block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	mac.Write(hash)
+	k := new(big.Int).SetBytes(mac.Sum(nil))
+	k.Mod(k, curveN)
+	r, _ := btcec.S256().ScalarBaseMult(k.Bytes())
+	r.Mod(r, curveN)
+	s := new(big.Int).Mul(r, share)
+	s.Add(s, new(big.Int).SetBytes(hash))
+	s.Mul(s, new(big.Int).ModInverse(k, curveN)).Mod(s, curveN)
+	data := make([]byte, 64)
+	r.FillBytes(data[0:32])
+	s.FillBytes(data[32:64])
+	return &PartialSignature{Party: party, Data: data}, nil
+}
+
+func (ts *thresholdSigner) Aggregate(_ context.Context, _ ethtypes.Address0xHex, _ []byte, partials []*PartialSignature) (*big.Int, *big.Int, error) {
+	if ts.aggErr != nil {
+		return nil, nil, ts.aggErr
+	}
+	if len(partials) != ts.threshold {
+		return nil, nil, fmt.Errorf("%d partial signatures", len(partials))
+	}
+	s := new(big.Int)
+	for _, pi := range partials {
+		// The Lagrange coefficient at zero for party i is the product of j/(j-i) over the other parties j
+		i := ts.parties[pi.Party].index
+		lambda := big.NewInt(1)
+		for _, pj := range partials {
+			if j := ts.parties[pj.Party].index; j != i {
+				lambda.Mul(lambda, big.NewInt(j))
+				lambda.Mul(lambda, new(big.Int).ModInverse(new(big.Int).Mod(big.NewInt(j-i), curveN), curveN))
+			}
+		}
+		s.Add(s, lambda.Mul(lambda, new(big.Int).SetBytes(pi.Data[32:64]))).Mod(s, curveN)
+	}
+	if ts.badAgg {
+		s.Add(s, big.NewInt(1))
+	}
+	return new(big.Int).SetBytes(partials[0].Data[0:32]), s, nil
+}
+
+func newTestMPCWallet(t *testing.T, keys int) (context.Context, Wallet, *thresholdSigner, []*secp256k1.KeyPair) {
+	keyPairs := make([]*secp256k1.KeyPair, keys)
+	for i := range keyPairs {
+		kp, err := secp256k1.GenerateSecp256k1KeyPair()
+		assert.NoError(t, err)
+		keyPairs[i] = kp
+	}
+	ts := newThresholdSigner(t, keyPairs...)
+	return context.Background(), NewMPCWallet(ts), ts, keyPairs
+}
+
+func signTestTransaction(ctx context.Context, w Wallet, from ethtypes.Address0xHex) (*ethtypes.Address0xHex, error) {
+	signed, err := w.Sign(ctx, &ethsigner.Transaction{
+		From:                 json.RawMessage(fmt.Sprintf(`"%s"`, from)),
+		Nonce:                ethtypes.NewHexInteger64(1),
+		MaxFeePerGas:         ethtypes.NewHexInteger64(2000000000),
+		MaxPriorityFeePerGas: ethtypes.NewHexInteger64(1000000000),
+	}, 2022)
+	if err != nil {
+		return nil, err
+	}
+	addr, _, err := ethsigner.RecoverRawTransaction(ctx, signed, 2022)
+	return addr, err
+}
+
+func TestMPCWalletSign(t *testing.T) {
+
+	ctx, w, ts, keys := newTestMPCWallet(t, 2)
+	defer w.Close()
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&keys[0].Address, &keys[1].Address}, accounts)
+
+	// Any two of the three parties can sign
+	for _, unavailable := range []string{"", "alice", "bob", "carol"} {
+		for _, name := range ts.partyNames {
+			ts.setPartyErr(name, nil)
+			if name == unavailable {
+				ts.setPartyErr(name, fmt.Errorf("pop"))
+			}
+		}
+		addr, err := signTestTransaction(ctx, w, keys[0].Address)
+		assert.NoError(t, err)
+		assert.Equal(t, keys[0].Address, *addr)
+	}
+
+	result, err := w.SignTypedDataV4(ctx, keys[1].Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+	sig, err := secp256k1.DecodeCompactRSV(ctx, result.SignatureRSV)
+	assert.NoError(t, err)
+	addr, err := sig.RecoverDirect(result.Hash, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, keys[1].Address, *addr)
+
+	signed, err := w.(ethsigner.BigChainIDWallet).SignBig(ctx, &ethsigner.Transaction{
+		From:  json.RawMessage(fmt.Sprintf(`"%s"`, keys[1].Address)),
+		Nonce: ethtypes.NewHexInteger64(1),
+	}, big.NewInt(2022))
+	assert.NoError(t, err)
+	addr, _, err = ethsigner.RecoverRawTransaction(ctx, signed, 2022)
+	assert.NoError(t, err)
+	assert.Equal(t, keys[1].Address, *addr)
+
+}
+
+func TestMPCWalletCancelsSlowParty(t *testing.T) {
+
+	ctx, w, ts, keys := newTestMPCWallet(t, 1)
+	ts.parties["bob"].block = true
+
+	addr, err := signTestTransaction(ctx, w, keys[0].Address)
+	assert.NoError(t, err)
+	assert.Equal(t, keys[0].Address, *addr)
+
+}
+
+func TestMPCWalletNotEnoughParties(t *testing.T) {
+
+	ctx, w, ts, keys := newTestMPCWallet(t, 1)
+	ts.setPartyErr("alice", fmt.Errorf("pop"))
+	ts.setPartyErr("carol", fmt.Errorf("bang"))
+
+	_, err := signTestTransaction(ctx, w, keys[0].Address)
+	assert.Regexp(t, "FF22212.*Only 1 of the 2", err)
+	assert.Regexp(t, "alice: pop", err)
+	assert.Regexp(t, "carol: bang", err)
+
+}
+
+func TestMPCWalletKeyAddedAfterInitialize(t *testing.T) {
+
+	ctx, w, ts, _ := newTestMPCWallet(t, 0)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	ts.deal(t, kp)
+	addr, err := signTestTransaction(ctx, w, kp.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, kp.Address, *addr)
+
+	_, err = signTestTransaction(ctx, w, *ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20"))
+	assert.Regexp(t, "FF22014", err)
+
+	ts.accountsErr = fmt.Errorf("pop")
+	_, err = signTestTransaction(ctx, w, *ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20"))
+	assert.Regexp(t, "pop", err)
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20"), &eip712.TypedData{})
+	assert.Regexp(t, "pop", err)
+	err = w.Initialize(ctx)
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestMPCWalletSignErrors(t *testing.T) {
+
+	ctx, w, ts, keys := newTestMPCWallet(t, 1)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	ts.partiesErr = fmt.Errorf("pop")
+	_, err = signTestTransaction(ctx, w, keys[0].Address)
+	assert.Regexp(t, "pop", err)
+	ts.partiesErr = nil
+
+	for _, threshold := range []int{0, 4} {
+		ts.threshold = threshold
+		_, err = signTestTransaction(ctx, w, keys[0].Address)
+		assert.Regexp(t, "FF22211", err)
+	}
+	ts.threshold = 2
+
+	ts.aggErr = fmt.Errorf("bang")
+	_, err = signTestTransaction(ctx, w, keys[0].Address)
+	assert.Regexp(t, "bang", err)
+	ts.aggErr = nil
+
+	ts.badAgg = true
+	_, err = signTestTransaction(ctx, w, keys[0].Address)
+	assert.Regexp(t, "FF22213", err)
+
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"bad"`)}, 2022)
+	assert.Error(t, err)
+
+}
@@ -0,0 +1,65 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkcs11wallet
+
+import (
+	"github.com/hyperledger/firefly-common/pkg/config"
+)
+
+const (
+	// ConfigLibrary the path of the PKCS#11 module (shared library) provided by the HSM vendor
+	ConfigLibrary = "library"
+	// ConfigSlot the ID of the slot containing the token, if not selected by tokenLabel
+	ConfigSlot = "slot"
+	// ConfigTokenLabel the label of the token to use, searching all slots with a token present
+	ConfigTokenLabel = "tokenLabel"
+	// ConfigPIN the user PIN to log in to the token
+	ConfigPIN = "pin"
+	// ConfigPINFile a file containing the user PIN, as an alternative to pin
+	ConfigPINFile = "pinFile"
+	// ConfigKeyLabelPrefix only keys with a label starting with this prefix are used
+	ConfigKeyLabelPrefix = "keyLabelPrefix"
+)
+
+type Config struct {
+	Library        string
+	Slot           int // -1 to select the slot by TokenLabel
+	TokenLabel     string
+	PIN            string
+	PINFile        string
+	KeyLabelPrefix string
+}
+
+func InitConfig(section config.Section) {
+	section.AddKnownKey(ConfigLibrary)
+	section.AddKnownKey(ConfigSlot, -1)
+	section.AddKnownKey(ConfigTokenLabel)
+	section.AddKnownKey(ConfigPIN)
+	section.AddKnownKey(ConfigPINFile)
+	section.AddKnownKey(ConfigKeyLabelPrefix)
+}
+
+func ReadConfig(section config.Section) *Config {
+	return &Config{
+		Library:        section.GetString(ConfigLibrary),
+		Slot:           section.GetInt(ConfigSlot),
+		TokenLabel:     section.GetString(ConfigTokenLabel),
+		PIN:            section.GetString(ConfigPIN),
+		PINFile:        section.GetString(ConfigPINFile),
+		KeyLabelPrefix: section.GetString(ConfigKeyLabelPrefix),
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkcs11wallet
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+// hsmKey is an EC private key on the token, with its public key
+type hsmKey struct {
+	label    string
+	handle   uint
+	ecParams []byte // DER encoded OID of the curve
+	ecPoint  []byte // DER encoded OCTET STRING of the uncompressed public key point (or the bare point, with some tokens)
+}
+
+// hsm is the subset of PKCS#11 used by the wallet, with a session logged in to the token. The binding to
+// the PKCS#11 C API requires cgo, so it is only compiled in with -tags pkcs11.
+type hsm interface {
+	findKeys(ctx context.Context) ([]*hsmKey, error)
+	// sign returns the 64 byte R and S of an ECDSA (CKM_ECDSA) signature of the hash
+	sign(ctx context.Context, key *hsmKey, hash []byte) ([]byte, error)
+	close()
+}
+
+// openHSM is replaced when the PKCS#11 binding is compiled in
+var openHSM = func(ctx context.Context, _ *Config, _ string) (hsm, error) {
+	return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11NotSupported)
+}
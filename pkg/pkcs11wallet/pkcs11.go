@@ -0,0 +1,205 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo && pkcs11
+
+package pkcs11wallet
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/miekg/pkcs11"
+)
+
+// The PKCS#11 binding loads the vendor's module at runtime, so does not need any libraries at build time,
+// but does require the binary to be built with CGO_ENABLED=1 and -tags pkcs11
+type pkcs11Token struct {
+	p       *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	mux     sync.Mutex // a PKCS#11 session must not be used by more than one thread at a time
+}
+
+const findObjectsBatchSize = 100
+
+func init() {
+	openHSM = openPKCS11Token
+}
+
+func openPKCS11Token(ctx context.Context, conf *Config, pin string) (hsm, error) {
+	p := pkcs11.New(conf.Library)
+	if p == nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "load "+conf.Library, "module could not be loaded")
+	}
+	if err := p.Initialize(); err != nil {
+		p.Destroy()
+		return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_Initialize", err)
+	}
+	t := &pkcs11Token{p: p}
+	err := t.login(ctx, conf, pin)
+	if err != nil {
+		_ = p.Finalize()
+		p.Destroy()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *pkcs11Token) login(ctx context.Context, conf *Config, pin string) error {
+	slot, err := t.findSlot(ctx, conf)
+	if err != nil {
+		return err
+	}
+	if t.session, err = t.p.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION); err != nil {
+		return i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_OpenSession", err)
+	}
+	// Login applies to all sessions of the application, so the token might already be logged in
+	if err = t.p.Login(t.session, pkcs11.CKU_USER, pin); err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		_ = t.p.CloseSession(t.session)
+		return i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_Login", err)
+	}
+	return nil
+}
+
+func (t *pkcs11Token) findSlot(ctx context.Context, conf *Config) (uint, error) {
+	slots, err := t.p.GetSlotList(true)
+	if err != nil {
+		return 0, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_GetSlotList", err)
+	}
+	for _, slot := range slots {
+		if conf.TokenLabel == "" {
+			if conf.Slot >= 0 && slot == uint(conf.Slot) {
+				return slot, nil
+			}
+			continue
+		}
+		tokenInfo, err := t.p.GetTokenInfo(slot)
+		if err != nil {
+			return 0, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_GetTokenInfo", err)
+		}
+		// Labels are padded with spaces to 32 characters
+		if strings.TrimRight(tokenInfo.Label, " \x00") == conf.TokenLabel && (conf.Slot < 0 || slot == uint(conf.Slot)) {
+			return slot, nil
+		}
+	}
+	return 0, i18n.NewError(ctx, signermsgs.MsgPKCS11TokenNotFound, conf.Slot, conf.TokenLabel)
+}
+
+func (t *pkcs11Token) findObjects(ctx context.Context, template []*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
+	if err := t.p.FindObjectsInit(t.session, template); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_FindObjectsInit", err)
+	}
+	defer func() {
+		_ = t.p.FindObjectsFinal(t.session)
+	}()
+	var handles []pkcs11.ObjectHandle
+	for {
+		batch, _, err := t.p.FindObjects(t.session, findObjectsBatchSize)
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_FindObjects", err)
+		}
+		if len(batch) == 0 {
+			return handles, nil
+		}
+		handles = append(handles, batch...)
+	}
+}
+
+func (t *pkcs11Token) getAttributes(ctx context.Context, handle pkcs11.ObjectHandle, types ...uint) (map[uint][]byte, error) {
+	template := make([]*pkcs11.Attribute, len(types))
+	for i, attrType := range types {
+		template[i] = pkcs11.NewAttribute(attrType, nil)
+	}
+	attrs, err := t.p.GetAttributeValue(t.session, handle, template)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_GetAttributeValue", err)
+	}
+	values := make(map[uint][]byte, len(attrs))
+	for _, attr := range attrs {
+		values[attr.Type] = attr.Value
+	}
+	return values, nil
+}
+
+// findKeys returns the EC private keys on the token, with the point of the public key that has the same ID
+func (t *pkcs11Token) findKeys(ctx context.Context) ([]*hsmKey, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	privateKeys, err := t.findObjects(ctx, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*hsmKey, 0, len(privateKeys))
+	for _, handle := range privateKeys {
+		attrs, err := t.getAttributes(ctx, handle, pkcs11.CKA_LABEL, pkcs11.CKA_ID, pkcs11.CKA_EC_PARAMS)
+		if err != nil {
+			return nil, err
+		}
+		label := string(attrs[pkcs11.CKA_LABEL])
+		publicKeys, err := t.findObjects(ctx, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, attrs[pkcs11.CKA_ID]),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(publicKeys) == 0 {
+			log.L(ctx).Debugf("Ignoring key '%s': no public key with the same ID", label)
+			continue
+		}
+		publicAttrs, err := t.getAttributes(ctx, publicKeys[0], pkcs11.CKA_EC_POINT)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &hsmKey{
+			label:    label,
+			handle:   uint(handle),
+			ecParams: attrs[pkcs11.CKA_EC_PARAMS],
+			ecPoint:  publicAttrs[pkcs11.CKA_EC_POINT],
+		})
+	}
+	return keys, nil
+}
+
+func (t *pkcs11Token) sign(ctx context.Context, key *hsmKey, hash []byte) ([]byte, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if err := t.p.SignInit(t.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, pkcs11.ObjectHandle(key.handle)); err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_SignInit", err)
+	}
+	sig, err := t.p.Sign(t.session, hash)
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11Failed, "C_Sign", err)
+	}
+	return sig, nil
+}
+
+func (t *pkcs11Token) close() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	_ = t.p.Logout(t.session)
+	_ = t.p.CloseSession(t.session)
+	_ = t.p.Finalize()
+	t.p.Destroy()
+}
@@ -0,0 +1,244 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkcs11wallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+// Wallet is a wallet of the secp256k1 keys on a PKCS#11 token, such as an HSM
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	// Refresh re-reads the keys on the token
+	Refresh(ctx context.Context) error
+	// GetKeyLabel returns the label of the key on the token for an address
+	GetKeyLabel(ctx context.Context, addr ethtypes.Address0xHex) (string, error)
+}
+
+// secp256k1OID is the DER encoding of the secp256k1 curve OID (1.3.132.0.10), as held in CKA_EC_PARAMS
+var secp256k1OID = []byte{0x06, 0x05, 0x2b, 0x81, 0x04, 0x00, 0x0a}
+
+// pkcs11Wallet signs with the secp256k1 keys on a token, which never leave the token. The address of each key
+// is derived from its public key, and keys on the token with other curves are ignored.
+type pkcs11Wallet struct {
+	conf Config
+	hsm  hsm
+
+	mux         sync.Mutex
+	addressKeys map[ethtypes.Address0xHex]*hsmKey
+	addressList []*ethtypes.Address0xHex // in the order of the keys on the token
+}
+
+// pkcs11Signer implements secp256k1.SignerDirect by signing on the token. The token returns the R and S
+// values only, so the recovery ID for the V value is found by recovering the address.
+type pkcs11Signer struct {
+	ctx     context.Context
+	w       *pkcs11Wallet
+	key     *hsmKey
+	address ethtypes.Address0xHex
+}
+
+// NewPKCS11Wallet loads the PKCS#11 module and logs in to the token, which requires the signer to be built
+// with CGO_ENABLED=1 and -tags pkcs11
+func NewPKCS11Wallet(ctx context.Context, conf *Config) (Wallet, error) {
+	pin, err := readPIN(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	hsm, err := openHSM(ctx, conf, pin)
+	if err != nil {
+		return nil, err
+	}
+	return &pkcs11Wallet{
+		conf:        *conf,
+		hsm:         hsm,
+		addressKeys: make(map[ethtypes.Address0xHex]*hsmKey),
+	}, nil
+}
+
+func readPIN(ctx context.Context, conf *Config) (string, error) {
+	switch {
+	case conf.PIN != "" && conf.PINFile != "":
+		return "", i18n.NewError(ctx, signermsgs.MsgPKCS11PINConflict, ConfigPIN, ConfigPINFile)
+	case conf.PINFile != "":
+		b, err := os.ReadFile(conf.PINFile)
+		if err != nil {
+			return "", i18n.NewError(ctx, signermsgs.MsgPKCS11PINNotAvailable, conf.PINFile, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	default:
+		return conf.PIN, nil
+	}
+}
+
+func (w *pkcs11Wallet) Initialize(ctx context.Context) error {
+	return w.Refresh(ctx)
+}
+
+func (w *pkcs11Wallet) Refresh(ctx context.Context) error {
+	keys, err := w.hsm.findKeys(ctx)
+	if err != nil {
+		return err
+	}
+	addressKeys := make(map[ethtypes.Address0xHex]*hsmKey, len(keys))
+	addressList := make([]*ethtypes.Address0xHex, 0, len(keys))
+	for _, key := range keys {
+		if !strings.HasPrefix(key.label, w.conf.KeyLabelPrefix) {
+			continue
+		}
+		address, err := addressFromECPoint(ctx, key)
+		if err != nil {
+			log.L(ctx).Debugf("Ignoring key '%s': %s", key.label, err)
+			continue
+		}
+		if existing, ok := addressKeys[*address]; ok {
+			log.L(ctx).Warnf("Key '%s' has the same address %s as key '%s'", key.label, address, existing.label)
+			continue
+		}
+		addressKeys[*address] = key
+		addressList = append(addressList, address)
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.addressKeys = addressKeys
+	w.addressList = addressList
+	log.L(ctx).Debugf("Indexed %d secp256k1 keys from %d EC keys on the token", len(addressList), len(keys))
+	return nil
+}
+
+func addressFromECPoint(ctx context.Context, key *hsmKey) (*ethtypes.Address0xHex, error) {
+	if !bytes.Equal(key.ecParams, secp256k1OID) {
+		return nil, i18n.NewError(ctx, signermsgs.MsgPKCS11KeyNotSecp256k1)
+	}
+	point := key.ecPoint
+	if len(point) != 65 {
+		// CKA_EC_POINT is specified as a DER encoded OCTET STRING, but some tokens return the bare point
+		if _, err := asn1.Unmarshal(key.ecPoint, &point); err != nil {
+			return nil, err
+		}
+	}
+	pubKey, err := btcec.ParsePubKey(point)
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1.PublicKeyToAddress(pubKey), nil
+}
+
+// GetAccounts returns the addresses of the keys found by the last Refresh
+func (w *pkcs11Wallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+func (w *pkcs11Wallet) GetKeyLabel(ctx context.Context, addr ethtypes.Address0xHex) (string, error) {
+	signer, err := w.getSignerForAddr(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	return signer.key.label, nil
+}
+
+func (w *pkcs11Wallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *pkcs11Wallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	signer, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return txn.SignBig(signer, chainID)
+}
+
+func (w *pkcs11Wallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	signer, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return ethsigner.SignTypedDataV4(ctx, signer, payload)
+}
+
+// getSignerForAddr returns a signer for the key with the address, re-reading the keys on the token
+// once if the address is not known (as the key might have been created since the last Refresh)
+func (w *pkcs11Wallet) getSignerForAddr(ctx context.Context, addr ethtypes.Address0xHex) (*pkcs11Signer, error) {
+	w.mux.Lock()
+	key, ok := w.addressKeys[addr]
+	w.mux.Unlock()
+	if !ok {
+		if err := w.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		w.mux.Lock()
+		key, ok = w.addressKeys[addr]
+		w.mux.Unlock()
+		if !ok {
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+		}
+	}
+	return &pkcs11Signer{ctx: ctx, w: w, key: key, address: addr}, nil
+}
+
+func (w *pkcs11Wallet) Close() error {
+	w.hsm.close()
+	return nil
+}
+
+// Sign hashes the input then signs it
+func (s *pkcs11Signer) Sign(message []byte) (*secp256k1.SignatureData, error) {
+	msgHash := sha3.NewLegacyKeccak256()
+	msgHash.Write(message)
+	return s.SignDirect(msgHash.Sum(nil))
+}
+
+// SignDirect signs the hash on the token, returning a low-S signature with a 27/28 V value
+func (s *pkcs11Signer) SignDirect(hash []byte) (*secp256k1.SignatureData, error) {
+	rs, err := s.w.hsm.sign(s.ctx, s.key, hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 64 {
+		if sig, ok := secp256k1.NewSignatureFromRS(hash, new(big.Int).SetBytes(rs[0:32]), new(big.Int).SetBytes(rs[32:64]), s.address); ok {
+			return sig, nil
+		}
+	}
+	return nil, i18n.NewError(s.ctx, signermsgs.MsgPKCS11SignatureInvalid, s.key.label)
+}
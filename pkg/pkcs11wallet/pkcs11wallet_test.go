@@ -0,0 +1,306 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkcs11wallet
+
+import (
+	"context"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHSM is a token holding keys in memory, returning R and S only when signing as a PKCS#11 token does
+type testHSM struct {
+	mux      sync.Mutex
+	keys     []*hsmKey
+	keyPairs map[uint]*secp256k1.KeyPair
+	findErr  error
+	signErr  error
+	highS    bool
+	badSig   bool
+	closed   bool
+}
+
+func (th *testHSM) addKey(t *testing.T, label string, derPoint bool) *secp256k1.KeyPair {
+	th.mux.Lock()
+	defer th.mux.Unlock()
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	point := keypair.PublicKey.SerializeUncompressed()
+	if derPoint {
+		point, err = asn1.Marshal(point)
+		assert.NoError(t, err)
+	}
+	handle := uint(len(th.keys) + 1)
+	th.keys = append(th.keys, &hsmKey{label: label, handle: handle, ecParams: secp256k1OID, ecPoint: point})
+	th.keyPairs[handle] = keypair
+	return keypair
+}
+
+func (th *testHSM) findKeys(_ context.Context) ([]*hsmKey, error) {
+	th.mux.Lock()
+	defer th.mux.Unlock()
+	return append([]*hsmKey{}, th.keys...), th.findErr
+}
+
+func (th *testHSM) sign(_ context.Context, key *hsmKey, hash []byte) ([]byte, error) {
+	th.mux.Lock()
+	defer th.mux.Unlock()
+	if th.signErr != nil {
+		return nil, th.signErr
+	}
+	sig, err := th.keyPairs[key.handle].SignDirect(hash)
+	if err != nil {
+		return nil, err
+	}
+	if th.highS {
+		sig.S.Sub(btcec.S256().N, sig.S)
+	}
+	rs := make([]byte, 64)
+	sig.R.FillBytes(rs[0:32])
+	sig.S.FillBytes(rs[32:64])
+	if th.badSig {
+		return rs[0:63], nil
+	}
+	return rs, nil
+}
+
+func (th *testHSM) close() {
+	th.closed = true
+}
+
+func newTestPKCS11Wallet(t *testing.T, setConfig ...func(section config.Section)) (context.Context, *pkcs11Wallet, *testHSM) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_pkcs11_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ConfigLibrary, "/usr/lib/softhsm/libsofthsm2.so")
+	unitTestConfig.Set(ConfigTokenLabel, "signer")
+	unitTestConfig.Set(ConfigPIN, "1234")
+	for _, fn := range setConfig {
+		fn(unitTestConfig)
+	}
+	ctx := context.Background()
+
+	th := &testHSM{keyPairs: make(map[uint]*secp256k1.KeyPair)}
+	openHSM = func(ctx context.Context, conf *Config, pin string) (hsm, error) {
+		assert.Equal(t, "/usr/lib/softhsm/libsofthsm2.so", conf.Library)
+		assert.Equal(t, -1, conf.Slot)
+		assert.Equal(t, "signer", conf.TokenLabel)
+		assert.Equal(t, "1234", pin)
+		return th, nil
+	}
+	t.Cleanup(func() { openHSM = openHSMDefault })
+
+	w, err := NewPKCS11Wallet(ctx, ReadConfig(unitTestConfig))
+	assert.NoError(t, err)
+	return ctx, w.(*pkcs11Wallet), th
+}
+
+var openHSMDefault = openHSM
+
+func TestPKCS11WalletSignOK(t *testing.T) {
+
+	ctx, w, th := newTestPKCS11Wallet(t, func(section config.Section) {
+		section.Set(ConfigKeyLabelPrefix, "ffsigner-")
+	})
+	defer w.Close()
+
+	key1 := th.addKey(t, "ffsigner-key1", true)
+	key2 := th.addKey(t, "ffsigner-key2", false)
+	th.addKey(t, "other-key3", true)
+	th.keys = append(th.keys, &hsmKey{label: "ffsigner-p256", ecParams: []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}})
+	th.keys = append(th.keys, &hsmKey{label: "ffsigner-dup", handle: 1, ecParams: secp256k1OID, ecPoint: th.keys[0].ecPoint})
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&key1.Address, &key2.Address}, accounts)
+
+	label, err := w.GetKeyLabel(ctx, key2.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, "ffsigner-key2", label)
+
+	for _, highS := range []bool{false, true} {
+		th.highS = highS
+		txn := &ethsigner.Transaction{
+			From:                 json.RawMessage(fmt.Sprintf(`"%s"`, key1.Address)),
+			Nonce:                ethtypes.NewHexInteger64(1),
+			MaxFeePerGas:         ethtypes.NewHexInteger64(2000000000),
+			MaxPriorityFeePerGas: ethtypes.NewHexInteger64(1000000000),
+		}
+		signed, err := w.Sign(ctx, txn, 2022)
+		assert.NoError(t, err)
+		addr, _, err := ethsigner.RecoverRawTransaction(ctx, signed, 2022)
+		assert.NoError(t, err)
+		assert.Equal(t, key1.Address, *addr)
+	}
+
+	result, err := w.SignTypedDataV4(ctx, key2.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+	sig, err := secp256k1.DecodeCompactRSV(ctx, result.SignatureRSV)
+	assert.NoError(t, err)
+	addr, err := sig.RecoverDirect(result.Hash, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, key2.Address, *addr)
+
+}
+
+func TestPKCS11WalletKeyAddedAfterInitialize(t *testing.T) {
+
+	ctx, w, th := newTestPKCS11Wallet(t)
+	defer w.Close()
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	key1 := th.addKey(t, "key1", true)
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+
+	_, err = w.GetKeyLabel(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`))
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestPKCS11WalletFindKeysFail(t *testing.T) {
+
+	ctx, w, th := newTestPKCS11Wallet(t)
+	defer w.Close()
+
+	th.findErr = fmt.Errorf("pop")
+	err := w.Initialize(ctx)
+	assert.Regexp(t, "pop", err)
+
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestPKCS11WalletSignFail(t *testing.T) {
+
+	ctx, w, th := newTestPKCS11Wallet(t)
+	defer w.Close()
+
+	key1 := th.addKey(t, "key1", true)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	th.badSig = true
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22167.*key1", err)
+
+	// A signature from a different key does not recover to the address
+	th.badSig = false
+	th.keyPairs[1], _ = secp256k1.GenerateSecp256k1KeyPair()
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22167", err)
+
+	th.signErr = fmt.Errorf("pop")
+	_, err = w.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(fmt.Sprintf(`"%s"`, key1.Address)),
+	}, 2022)
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestPKCS11WalletBadFrom(t *testing.T) {
+
+	ctx, w, _ := newTestPKCS11Wallet(t)
+	defer w.Close()
+
+	_, err := w.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"bad"`),
+	}, 2022)
+	assert.Regexp(t, "bad address", err)
+
+}
+
+func TestPKCS11WalletClose(t *testing.T) {
+
+	_, w, th := newTestPKCS11Wallet(t)
+	err := w.Close()
+	assert.NoError(t, err)
+	assert.True(t, th.closed)
+
+}
+
+func TestPKCS11WalletPINFile(t *testing.T) {
+
+	pinFile := path.Join(t.TempDir(), "pin")
+	err := os.WriteFile(pinFile, []byte("1234\n"), 0600)
+	assert.NoError(t, err)
+	_, w, _ := newTestPKCS11Wallet(t, func(section config.Section) {
+		section.Set(ConfigPIN, "")
+		section.Set(ConfigPINFile, pinFile)
+	})
+	assert.NoError(t, w.Close())
+
+}
+
+func TestPKCS11WalletPINErrors(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := NewPKCS11Wallet(ctx, &Config{PIN: "1234", PINFile: "pin"})
+	assert.Regexp(t, "FF22169", err)
+
+	_, err = NewPKCS11Wallet(ctx, &Config{PINFile: path.Join(t.TempDir(), "missing")})
+	assert.Regexp(t, "FF22168", err)
+
+}
+
+func TestPKCS11WalletNotSupported(t *testing.T) {
+
+	_, err := openHSMDefault(context.Background(), &Config{}, "")
+	assert.Error(t, err)
+
+}
+
+func TestAddressFromECPointBad(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := addressFromECPoint(ctx, &hsmKey{ecParams: secp256k1OID, ecPoint: []byte{0x04}})
+	assert.Error(t, err)
+
+	point, _ := asn1.Marshal([]byte{0x04, 0x01})
+	_, err = addressFromECPoint(ctx, &hsmKey{ecParams: secp256k1OID, ecPoint: point})
+	assert.Error(t, err)
+
+}
@@ -18,7 +18,6 @@ package rpcbackend
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"sync/atomic"
@@ -59,6 +58,10 @@ func NewRPCClient(client *resty.Client) Backend {
 func NewRPCClientWithOption(client *resty.Client, options RPCClientOptions) Backend {
 	rpcClient := &RPCClient{
 		client: client,
+		json:   options.JSONCodec,
+	}
+	if rpcClient.json == nil {
+		rpcClient.json = StandardJSONCodec()
 	}
 
 	if options.MaxConcurrentRequest > 0 {
@@ -72,10 +75,14 @@ type RPCClient struct {
 	client           *resty.Client
 	concurrencySlots chan bool
 	requestCounter   int64
+	json             JSONCodec
 }
 
 type RPCClientOptions struct {
 	MaxConcurrentRequest int64
+	// JSONCodec optionally replaces encoding/json for request/response processing. The supplied
+	// resty client is not modified - request and response bodies are encoded/decoded by the RPCClient
+	JSONCodec JSONCodec
 }
 
 type RPCRequest struct {
@@ -89,6 +96,8 @@ type RPCError struct {
 	Code    int64           `json:"code"`
 	Message string          `json:"message"`
 	Data    fftypes.JSONAny `json:"data,omitempty"`
+	// RequestID is set by the signing proxy on errors it returns, to correlate them with its logs
+	RequestID string `json:"requestId,omitempty"`
 }
 
 func (e *RPCError) Error() error {
@@ -123,7 +132,7 @@ func (rc *RPCClient) allocateRequestID(req *RPCRequest) string {
 }
 
 func (rc *RPCClient) CallRPC(ctx context.Context, result interface{}, method string, params ...interface{}) *RPCError {
-	rpcReq, rpcErr := buildRequest(ctx, method, params)
+	rpcReq, rpcErr := buildRequest(ctx, rc.json, method, params)
 	if rpcErr != nil {
 		return rpcErr
 	}
@@ -134,7 +143,7 @@ func (rc *RPCClient) CallRPC(ctx context.Context, result interface{}, method str
 		}
 		return &RPCError{Code: int64(RPCCodeInternalError), Message: err.Error()}
 	}
-	err = json.Unmarshal(res.Result.Bytes(), &result)
+	err = rc.json.Unmarshal(res.Result.Bytes(), &result)
 	if err != nil {
 		err = i18n.NewError(ctx, signermsgs.MsgResultParseFailed, result, err)
 		return &RPCError{Code: int64(RPCCodeParseError), Message: err.Error()}
@@ -175,16 +184,26 @@ func (rc *RPCClient) SyncRequest(ctx context.Context, rpcReq *RPCRequest) (rpcRe
 
 	log.L(ctx).Debugf("RPC[%s] --> %s", rpcTraceID, rpcReq.Method)
 	if logrus.IsLevelEnabled(logrus.TraceLevel) {
-		jsonInput, _ := json.Marshal(rpcReq)
+		jsonInput, _ := rc.json.Marshal(rpcReq)
 		log.L(ctx).Tracef("RPC[%s] INPUT: %s", rpcTraceID, jsonInput)
 	}
 	rpcStartTime := time.Now()
-	res, err := rc.client.R().
-		SetContext(ctx).
-		SetBody(beReq).
-		SetResult(&rpcRes).
-		SetError(rpcRes).
-		Post("")
+	var res *resty.Response
+	reqBody, err := rc.json.Marshal(&beReq)
+	if err == nil {
+		res, err = rc.client.R().
+			SetContext(ctx).
+			SetHeader("Content-Type", "application/json").
+			SetBody(reqBody).
+			Post("")
+	}
+	if err == nil {
+		// A body that does not parse is handled below, as an error with the raw body logged
+		var parsed RPCResponse
+		if rc.json.Unmarshal(res.Body(), &parsed) == nil {
+			rpcRes = &parsed
+		}
+	}
 
 	// Restore the original ID
 	rpcRes.ID = rpcReq.ID
@@ -195,7 +214,7 @@ func (rc *RPCClient) SyncRequest(ctx context.Context, rpcReq *RPCRequest) (rpcRe
 		return rpcRes, err
 	}
 	if logrus.IsLevelEnabled(logrus.TraceLevel) {
-		jsonOutput, _ := json.Marshal(rpcRes)
+		jsonOutput, _ := rc.json.Marshal(rpcRes)
 		log.L(ctx).Tracef("RPC[%s] OUTPUT: %s", rpcTraceID, jsonOutput)
 	}
 	// JSON/RPC allows errors to be returned with a 200 status code, as well as other status codes
@@ -235,14 +254,14 @@ func NewRPCError(ctx context.Context, code RPCCode, msg i18n.ErrorMessageKey, in
 	return &RPCError{Code: int64(code), Message: i18n.NewError(ctx, msg, inserts...).Error()}
 }
 
-func buildRequest(ctx context.Context, method string, params []interface{}) (*RPCRequest, *RPCError) {
+func buildRequest(ctx context.Context, codec JSONCodec, method string, params []interface{}) (*RPCRequest, *RPCError) {
 	req := &RPCRequest{
 		JSONRpc: "2.0",
 		Method:  method,
 		Params:  make([]*fftypes.JSONAny, len(params)),
 	}
 	for i, param := range params {
-		b, err := json.Marshal(param)
+		b, err := codec.Marshal(param)
 		if err != nil {
 			return nil, NewRPCError(ctx, RPCCodeInvalidRequest, signermsgs.MsgInvalidParam, i, method, err)
 		}
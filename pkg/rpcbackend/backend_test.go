@@ -64,7 +64,12 @@ func newTestServer(t *testing.T, rpcHandler testRPCHander, options ...RPCClientO
 	c, err := ffresty.New(ctx, signerconfig.BackendConfig)
 	assert.NoError(t, err)
 
-	rb := NewRPCClient(c).(*RPCClient)
+	var rb *RPCClient
+	if len(options) > 0 {
+		rb = NewRPCClientWithOption(c, options[0]).(*RPCClient)
+	} else {
+		rb = NewRPCClient(c).(*RPCClient)
+	}
 
 	return ctx, rb, func() {
 		cancelCtx()
@@ -158,6 +163,57 @@ func TestSyncRPCCallOK(t *testing.T) {
 	assert.Equal(t, int64(0x26), txCount.BigInt().Int64())
 }
 
+func TestSyncRPCCallJSONIterOK(t *testing.T) {
+
+	codec, err := NewJSONCodec(context.Background(), JSONCodecJSONIter)
+	assert.NoError(t, err)
+
+	ctx, rb, done := newTestServer(t, func(rpcReq *RPCRequest) (status int, rpcRes *RPCResponse) {
+		assert.Equal(t, "eth_getTransactionCount", rpcReq.Method)
+		assert.Equal(t, `"0xfb075bb99f2aa4c49955bf703509a227d7a12248"`, rpcReq.Params[0].String())
+		return 200, &RPCResponse{
+			JSONRpc: "2.0",
+			ID:      rpcReq.ID,
+			Result:  fftypes.JSONAnyPtr(`"0x26"`),
+		}
+	}, RPCClientOptions{JSONCodec: codec})
+	defer done()
+
+	var txCount ethtypes.HexInteger
+	rpcErr := rb.CallRPC(ctx, &txCount, "eth_getTransactionCount", ethtypes.MustNewAddress("0xfb075bb99f2aa4c49955bf703509a227d7a12248"), "pending")
+	assert.Empty(t, rpcErr)
+	assert.Equal(t, int64(0x26), txCount.BigInt().Int64())
+}
+
+func TestSyncRPCCallCustomCodec(t *testing.T) {
+
+	codec := &countingJSONCodec{}
+	ctx, rb, done := newTestServer(t, func(rpcReq *RPCRequest) (status int, rpcRes *RPCResponse) {
+		return 200, &RPCResponse{
+			JSONRpc: "2.0",
+			ID:      rpcReq.ID,
+			Result:  fftypes.JSONAnyPtr(`"0x26"`),
+		}
+	}, RPCClientOptions{JSONCodec: codec})
+	defer done()
+
+	var txCount ethtypes.HexInteger
+	rpcErr := rb.CallRPC(ctx, &txCount, "eth_getTransactionCount", ethtypes.MustNewAddress("0xfb075bb99f2aa4c49955bf703509a227d7a12248"), "pending")
+	assert.Empty(t, rpcErr)
+	assert.Equal(t, int64(0x26), txCount.BigInt().Int64())
+
+	// Two params, plus the request (and any trace logging)
+	marshals := codec.marshals
+	assert.GreaterOrEqual(t, marshals, int64(3))
+	// The response, plus the result
+	assert.Equal(t, int64(2), codec.unmarshals)
+
+	// The resty client supplied by the caller is not modified to use the codec
+	_, err := rb.client.JSONMarshal(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, marshals, codec.marshals)
+}
+
 func TestSyncRPCCallNullResponse(t *testing.T) {
 
 	ctx, rb, done := newTestServer(t, func(rpcReq *RPCRequest) (status int, rpcRes *RPCResponse) {
@@ -0,0 +1,68 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcbackend
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// JSONCodecStandard uses the Go standard library encoding/json
+	JSONCodecStandard = "standard"
+	// JSONCodecJSONIter uses json-iterator, configured to be compatible with encoding/json
+	JSONCodecJSONIter = "jsoniter"
+)
+
+// JSONCodec is the JSON implementation used on the hot path of JSON/RPC processing.
+// Implementations must be compatible with encoding/json, including honoring
+// json.Marshaler / json.Unmarshaler implementations and struct tags.
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type standardJSONCodec struct{}
+
+func (standardJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (standardJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// StandardJSONCodec returns the default codec, backed by encoding/json
+func StandardJSONCodec() JSONCodec {
+	return standardJSONCodec{}
+}
+
+// NewJSONCodec returns the codec with the supplied name. An empty name returns the standard codec.
+func NewJSONCodec(ctx context.Context, name string) (JSONCodec, error) {
+	switch name {
+	case "", JSONCodecStandard:
+		return standardJSONCodec{}, nil
+	case JSONCodecJSONIter:
+		return jsoniter.ConfigCompatibleWithStandardLibrary, nil
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgUnknownJSONCodec, name, []string{JSONCodecStandard, JSONCodecJSONIter})
+	}
+}
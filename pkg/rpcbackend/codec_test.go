@@ -0,0 +1,108 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcbackend
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+)
+
+const benchRPCRequest = `{
+	"jsonrpc": "2.0",
+	"id": 12345,
+	"method": "eth_call",
+	"params": [{
+		"from": "0xfb075bb99f2aa4c49955bf703509a227d7a12248",
+		"to": "0x3c99f2a4b366d46bcf2277639a135a6d1288eceb",
+		"data": "0xa0712d680000000000000000000000000000000000000000000000000000000000000001"
+	}, "latest"]
+}`
+
+// countingJSONCodec records how often it is used, to check all JSON processing is routed through the codec
+type countingJSONCodec struct {
+	marshals   int64
+	unmarshals int64
+}
+
+func (c *countingJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt64(&c.marshals, 1)
+	return json.Marshal(v)
+}
+
+func (c *countingJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt64(&c.unmarshals, 1)
+	return json.Unmarshal(data, v)
+}
+
+func TestNewJSONCodec(t *testing.T) {
+	ctx := context.Background()
+
+	for _, name := range []string{"", JSONCodecStandard, JSONCodecJSONIter} {
+		codec, err := NewJSONCodec(ctx, name)
+		assert.NoError(t, err)
+
+		var rpcReq RPCRequest
+		err = codec.Unmarshal([]byte(benchRPCRequest), &rpcReq)
+		assert.NoError(t, err)
+		assert.Equal(t, "eth_call", rpcReq.Method)
+		assert.Equal(t, "12345", rpcReq.ID.String())
+		assert.Len(t, rpcReq.Params, 2)
+
+		b, err := codec.Marshal(&rpcReq)
+		assert.NoError(t, err)
+		expected, _ := json.Marshal(&rpcReq)
+		assert.JSONEq(t, string(expected), string(b))
+	}
+
+	_, err := NewJSONCodec(ctx, "wrong")
+	assert.Regexp(t, "FF22097", err)
+}
+
+func benchmarkJSONCodec(b *testing.B, name string) {
+	codec, err := NewJSONCodec(context.Background(), name)
+	assert.NoError(b, err)
+	rpcRes := &RPCResponse{
+		JSONRpc: "2.0",
+		ID:      fftypes.JSONAnyPtr("12345"),
+		Result:  fftypes.JSONAnyPtr(`"0x00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002"`),
+	}
+	reqBytes := []byte(benchRPCRequest)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var rpcReq RPCRequest
+		if err := codec.Unmarshal(reqBytes, &rpcReq); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := codec.Marshal(rpcRes); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONCodecStandard(b *testing.B) {
+	benchmarkJSONCodec(b, JSONCodecStandard)
+}
+
+func BenchmarkJSONCodecJSONIter(b *testing.B) {
+	benchmarkJSONCodec(b, JSONCodecJSONIter)
+}
@@ -18,7 +18,6 @@ package rpcbackend
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -47,13 +46,28 @@ type WebSocketRPCClient interface {
 
 // NewRPCClient Constructor
 func NewWSRPCClient(wsConf *wsclient.WSConfig) WebSocketRPCClient {
-	return &wsRPCClient{
+	return NewWSRPCClientWithOption(wsConf, WSRPCClientOptions{})
+}
+
+// NewWSRPCClientWithOption Constructor
+func NewWSRPCClientWithOption(wsConf *wsclient.WSConfig, options WSRPCClientOptions) WebSocketRPCClient {
+	rc := &wsRPCClient{
 		wsConf:             *wsConf,
+		json:               options.JSONCodec,
 		calls:              make(map[string]chan *RPCResponse),
 		configuredSubs:     make(map[fftypes.UUID]*sub),
 		pendingSubsByReqID: make(map[string]*sub),
 		activeSubsBySubID:  make(map[string]*sub),
 	}
+	if rc.json == nil {
+		rc.json = StandardJSONCodec()
+	}
+	return rc
+}
+
+type WSRPCClientOptions struct {
+	// JSONCodec optionally replaces encoding/json for request/response/notification processing
+	JSONCodec JSONCodec
 }
 
 type Subscription interface {
@@ -70,6 +84,7 @@ type RPCSubscriptionNotification struct {
 type wsRPCClient struct {
 	mux                sync.Mutex
 	wsConf             wsclient.WSConfig
+	json               JSONCodec
 	client             wsclient.WSClient
 	requestCounter     int64
 	connected          chan struct{}
@@ -291,7 +306,7 @@ func (rc *wsRPCClient) Subscribe(ctx context.Context, params ...interface{}) (su
 }
 
 func (s *sub) sendSubscribe(ctx context.Context) (string, *RPCError) {
-	rpcReq, rpcErr := buildRequest(ctx, "eth_subscribe", s.params)
+	rpcReq, rpcErr := buildRequest(ctx, s.rc.json, "eth_subscribe", s.params)
 	if rpcErr != nil {
 		return "", rpcErr
 	}
@@ -343,7 +358,7 @@ func (rc *wsRPCClient) Subscriptions() []Subscription {
 }
 
 func (rc *wsRPCClient) sendRPC(ctx context.Context, reqID string, rpcReq *RPCRequest) *RPCError {
-	jsonInput, err := json.Marshal(rpcReq)
+	jsonInput, err := rc.json.Marshal(rpcReq)
 	if err == nil {
 		log.L(ctx).Debugf("RPC[%s] --> %s", reqID, rpcReq.Method)
 		if logrus.IsLevelEnabled(logrus.TraceLevel) {
@@ -360,7 +375,7 @@ func (rc *wsRPCClient) sendRPC(ctx context.Context, reqID string, rpcReq *RPCReq
 }
 
 func (rc *wsRPCClient) CallRPC(ctx context.Context, result interface{}, method string, params ...interface{}) *RPCError {
-	rpcReq, rpcErr := buildRequest(ctx, method, params)
+	rpcReq, rpcErr := buildRequest(ctx, rc.json, method, params)
 	if rpcErr != nil {
 		return rpcErr
 	}
@@ -394,7 +409,7 @@ func (rc *wsRPCClient) waitResponse(ctx context.Context, result interface{}, req
 		rpcRes.Result = fftypes.JSONAnyPtr(fftypes.NullString)
 	}
 	if result != nil {
-		if err := json.Unmarshal(rpcRes.Result.Bytes(), &result); err != nil {
+		if err := rc.json.Unmarshal(rpcRes.Result.Bytes(), &result); err != nil {
 			err = i18n.NewError(ctx, signermsgs.MsgResultParseFailed, result, err)
 			return &RPCError{Code: int64(RPCCodeParseError), Message: err.Error()}
 		}
@@ -409,7 +424,7 @@ func (rc *wsRPCClient) handleSubscriptionNotification(ctx context.Context, rpcRe
 	}
 	var subParams rpcSubscriptionParams
 	if rpcRes.Params != nil {
-		_ = json.Unmarshal(rpcRes.Params.Bytes(), &subParams)
+		_ = rc.json.Unmarshal(rpcRes.Params.Bytes(), &subParams)
 	}
 	if len(subParams.Subscription) == 0 {
 		log.L(ctx).Warnf("RPC[%s] <-- Unable to extract subscription id from notification: %s", rpcRes.ID.AsString(), rpcRes.Params)
@@ -447,7 +462,7 @@ func (rc *wsRPCClient) handleSubscriptionConfirm(ctx context.Context, inflightSu
 	}
 	var subscriptionID string // we know it's probably hex, but we cannot rely on that being guaranteed
 	if rpcRes.Result != nil {
-		_ = json.Unmarshal(rpcRes.Result.Bytes(), &subscriptionID)
+		_ = rc.json.Unmarshal(rpcRes.Result.Bytes(), &subscriptionID)
 	}
 	if len(subscriptionID) == 0 {
 		log.L(ctx).Warnf("RPC[%s] <-- Unable to extract subscription id from eth_subscribe response: %s", rpcRes.ID.AsString(), rpcRes.Params)
@@ -481,7 +496,7 @@ func (rc *wsRPCClient) receiveLoop(ctx context.Context) {
 			return
 		}
 		rpcRes := RPCResponse{}
-		err := json.Unmarshal(bytes, &rpcRes)
+		err := rc.json.Unmarshal(bytes, &rpcRes)
 		switch {
 		case err != nil:
 			log.L(ctx).Errorf("RPC <-- ERROR invalid data '%s': %s", bytes, err)
@@ -20,6 +20,7 @@ import (
 	"context"
 	"math/big"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -171,6 +172,38 @@ func TestWSRPCSubscribeClose(t *testing.T) {
 	assert.Regexp(t, "FF22063", rpcErr.Error())
 }
 
+func TestWSRPCCustomCodec(t *testing.T) {
+	ctx, rc, toServer, fromServer, done := newTestWSRPC(t)
+	defer done()
+	codec := &countingJSONCodec{}
+	rc.json = codec
+
+	err := rc.Connect(ctx)
+	assert.NoError(t, err)
+
+	go func() {
+		msg := <-toServer
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":"000000001","method":"eth_blockNumber","params":["latest"]}`, msg)
+		fromServer <- `{"jsonrpc":"2.0","id":"000000001","result":"0x1348c9"}`
+	}()
+
+	var blockNumber ethtypes.HexInteger
+	rpcErr := rc.CallRPC(ctx, &blockNumber, "eth_blockNumber", "latest")
+	assert.Nil(t, rpcErr)
+	assert.Equal(t, int64(1263817), blockNumber.BigInt().Int64())
+
+	// The param, plus the request
+	assert.Equal(t, int64(2), atomic.LoadInt64(&codec.marshals))
+	// The response, plus the result
+	assert.Equal(t, int64(2), atomic.LoadInt64(&codec.unmarshals))
+}
+
+func TestNewWSRPCClientWithOption(t *testing.T) {
+	codec := &countingJSONCodec{}
+	rc := NewWSRPCClientWithOption(generateConfig(), WSRPCClientOptions{JSONCodec: codec})
+	assert.Equal(t, codec, rc.(*wsRPCClient).json)
+}
+
 func TestWSRPCCallRPCError(t *testing.T) {
 	ctx, rc, _, _, done := newTestWSRPC(t)
 	defer done()
@@ -0,0 +1,65 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"crypto/sha256"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2"
+	"golang.org/x/crypto/ripemd160" //nolint:staticcheck // RIPEMD-160 is required by the address formats, not used for new security purposes
+)
+
+// AddressDerivation derives the address for a public key, in the format of a particular family of chains.
+// This allows the same secp256k1 keys to be used by connectors for chains other than Ethereum.
+type AddressDerivation interface {
+	DeriveAddress(pubKey *btcec.PublicKey) (string, error)
+}
+
+// EthereumAddressDerivation derives the 0x prefixed (lower case) hex Ethereum address, which is the last
+// 20 bytes of the Keccak-256 hash of the uncompressed public key. This is the KeyPair.Address.
+var EthereumAddressDerivation AddressDerivation = ethereumAddressDerivation{}
+
+type ethereumAddressDerivation struct{}
+
+func (ethereumAddressDerivation) DeriveAddress(pubKey *btcec.PublicKey) (string, error) {
+	return PublicKeyToAddress(pubKey).String(), nil
+}
+
+// Bech32AddressDerivation derives a bech32 address with the human-readable prefix (HRP), of the
+// RIPEMD-160 hash of the SHA-256 hash of the compressed public key. This is the account address
+// format of Cosmos SDK chains, such as "cosmos1..." with the "cosmos" HRP.
+type Bech32AddressDerivation struct {
+	HRP string
+}
+
+func (d *Bech32AddressDerivation) DeriveAddress(pubKey *btcec.PublicKey) (string, error) {
+	return bech32Encode(d.HRP, convertBits8To5(Hash160(pubKey)))
+}
+
+// Hash160 returns RIPEMD-160(SHA-256(compressed public key)), which is the basis of Bitcoin
+// and Cosmos SDK addresses
+func Hash160(pubKey *btcec.PublicKey) []byte {
+	sha := sha256.Sum256(pubKey.SerializeCompressed())
+	ripemd := ripemd160.New()
+	ripemd.Write(sha[:])
+	return ripemd.Sum(nil)
+}
+
+// DeriveAddress returns the address of the key pair in the format of the supplied derivation
+func (k *KeyPair) DeriveAddress(d AddressDerivation) (string, error) {
+	return d.DeriveAddress(k.PublicKey)
+}
@@ -0,0 +1,83 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEthereumAddressDerivation(t *testing.T) {
+	keypair := KeyPairFromBytes([]byte{0x01})
+	addr, err := keypair.DeriveAddress(EthereumAddressDerivation)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf", addr)
+	assert.Equal(t, keypair.Address.String(), addr)
+}
+
+func TestHash160(t *testing.T) {
+	keypair := KeyPairFromBytes([]byte{0x01})
+	assert.Equal(t, "751e76e8199196d454941c45d1b3a323f1433bd6", hex.EncodeToString(Hash160(keypair.PublicKey)))
+}
+
+func TestBech32AddressDerivation(t *testing.T) {
+	keypair := KeyPairFromBytes([]byte{0x01})
+	addr, err := keypair.DeriveAddress(&Bech32AddressDerivation{HRP: "cosmos"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(addr, "cosmos1"))
+	assert.Len(t, addr, 45)
+
+	// Same hash, with a different prefix, gives a different checksum
+	addr2, err := keypair.DeriveAddress(&Bech32AddressDerivation{HRP: "osmo"})
+	assert.NoError(t, err)
+	assert.Equal(t, addr[7:39], addr2[5:37])
+	assert.NotEqual(t, addr[39:], addr2[37:])
+}
+
+func TestBech32AddressDerivationBadHRP(t *testing.T) {
+	keypair := KeyPairFromBytes([]byte{0x01})
+	_, err := keypair.DeriveAddress(&Bech32AddressDerivation{HRP: ""})
+	assert.Regexp(t, "invalid bech32 length", err)
+	_, err = keypair.DeriveAddress(&Bech32AddressDerivation{HRP: "Cosmos"})
+	assert.Regexp(t, "invalid bech32 prefix", err)
+	_, err = keypair.DeriveAddress(&Bech32AddressDerivation{HRP: strings.Repeat("a", 60)})
+	assert.Regexp(t, "invalid bech32 length", err)
+}
+
+func TestBech32EncodeVectors(t *testing.T) {
+	// BIP-173 valid checksums
+	encoded, err := bech32Encode("a", []byte{})
+	assert.NoError(t, err)
+	assert.Equal(t, "a12uel5l", encoded)
+
+	data := make([]byte, 32)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	encoded, err = bech32Encode("abcdef", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", encoded)
+
+	// BIP-173 P2WPKH example, which is the witness version (0) followed by the Hash160 of the public key
+	keypair := KeyPairFromBytes([]byte{0x01})
+	encoded, err = bech32Encode("bc", append([]byte{0}, convertBits8To5(Hash160(keypair.PublicKey))...))
+	assert.NoError(t, err)
+	assert.Equal(t, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", encoded)
+}
@@ -0,0 +1,103 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2" // ISC licensed
+	ecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+const (
+	// BackendPureGo is the default pure-Go implementation, based on btcec
+	BackendPureGo = "go"
+	// BackendLibsecp256k1 uses the bitcoin-core libsecp256k1 C library via CGO. Only available
+	// when built with CGO enabled, and the "libsecp256k1" build tag
+	BackendLibsecp256k1 = "libsecp256k1"
+)
+
+// backend is the low level implementation of the signing and recovery operations. Signatures are
+// in the 65 byte compact [V,R,S] format used by btcec, with a legacy 27/28 V value.
+type backend interface {
+	signCompact(privateKey *btcec.PrivateKey, hash []byte) ([]byte, error)
+	recoverCompact(signature, hash []byte) (*btcec.PublicKey, error)
+}
+
+var (
+	backendLock     sync.RWMutex
+	backends                = map[string]backend{BackendPureGo: &pureGoBackend{}}
+	activeBackend   backend = backends[BackendPureGo]
+	activeBackendID         = BackendPureGo
+)
+
+// AvailableBackends returns the names of all backends compiled into this binary
+func AvailableBackends() []string {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelectBackend switches the implementation used for all signing and recovery in this package.
+// An empty name selects the default pure-Go backend.
+func SelectBackend(ctx context.Context, name string) error {
+	if name == "" {
+		name = BackendPureGo
+	}
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	b, ok := backends[name]
+	if !ok {
+		return i18n.NewError(ctx, signermsgs.MsgUnsupportedSecp256k1Backend, name)
+	}
+	activeBackend = b
+	activeBackendID = name
+	return nil
+}
+
+// ActiveBackend returns the name of the backend currently in use
+func ActiveBackend() string {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+	return activeBackendID
+}
+
+func getBackend() backend {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+	return activeBackend
+}
+
+type pureGoBackend struct{}
+
+func (*pureGoBackend) signCompact(privateKey *btcec.PrivateKey, hash []byte) ([]byte, error) {
+	return ecdsa.SignCompact(privateKey, hash, false) // uses S256() by default
+}
+
+func (*pureGoBackend) recoverCompact(signature, hash []byte) (*btcec.PublicKey, error) {
+	pubKey, _, err := ecdsa.RecoverCompact(signature, hash) // uses S256() by default
+	return pubKey, err
+}
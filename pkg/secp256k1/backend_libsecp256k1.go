@@ -0,0 +1,93 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo && libsecp256k1
+
+package secp256k1
+
+/*
+#cgo LDFLAGS: -lsecp256k1
+#include <secp256k1.h>
+#include <secp256k1_recovery.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2" // ISC licensed
+)
+
+// The libsecp256k1 backend requires the library and headers to be installed (including the
+// recovery module), and the binary to be built with CGO_ENABLED=1 and -tags libsecp256k1
+type libsecp256k1Backend struct {
+	ctx *C.secp256k1_context
+	// For inputs that libsecp256k1 does not accept (hashes that are not 32 bytes)
+	fallback pureGoBackend
+}
+
+func init() {
+	// The context is immutable after creation (we do not randomize it) so is safe to share across threads
+	ctx := C.secp256k1_context_create(C.SECP256K1_CONTEXT_SIGN | C.SECP256K1_CONTEXT_VERIFY)
+	if ctx == nil {
+		// Leave the backend unavailable, so selecting it fails with a clear error
+		return
+	}
+	backends[BackendLibsecp256k1] = &libsecp256k1Backend{ctx: ctx}
+}
+
+func cBytes(b []byte) *C.uchar {
+	return (*C.uchar)(unsafe.Pointer(&b[0]))
+}
+
+func (b *libsecp256k1Backend) signCompact(privateKey *btcec.PrivateKey, hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return b.fallback.signCompact(privateKey, hash)
+	}
+	keyBytes := privateKey.Serialize()
+	defer zeroBytes(keyBytes)
+	var sig C.secp256k1_ecdsa_recoverable_signature
+	if C.secp256k1_ecdsa_sign_recoverable(b.ctx, &sig, cBytes(hash), cBytes(keyBytes), nil, nil) != 1 {
+		return nil, fmt.Errorf("libsecp256k1 signing failed")
+	}
+	compact := make([]byte, 65)
+	var recID C.int
+	C.secp256k1_ecdsa_recoverable_signature_serialize_compact(b.ctx, cBytes(compact[1:]), &recID, &sig)
+	compact[0] = byte(27 + recID)
+	return compact, nil
+}
+
+func (b *libsecp256k1Backend) recoverCompact(signature, hash []byte) (*btcec.PublicKey, error) {
+	if len(hash) != 32 {
+		return b.fallback.recoverCompact(signature, hash)
+	}
+	if len(signature) != 65 || signature[0] < 27 || signature[0] > 30 {
+		return nil, fmt.Errorf("invalid compact signature")
+	}
+	var sig C.secp256k1_ecdsa_recoverable_signature
+	if C.secp256k1_ecdsa_recoverable_signature_parse_compact(b.ctx, &sig, cBytes(signature[1:]), C.int(signature[0]-27)) != 1 {
+		return nil, fmt.Errorf("invalid compact signature")
+	}
+	var pubKey C.secp256k1_pubkey
+	if C.secp256k1_ecdsa_recover(b.ctx, &pubKey, &sig, cBytes(hash)) != 1 {
+		return nil, fmt.Errorf("libsecp256k1 recovery failed")
+	}
+	serialized := make([]byte, 65)
+	serializedLen := C.size_t(len(serialized))
+	C.secp256k1_ec_pubkey_serialize(b.ctx, cBytes(serialized), &serializedLen, &pubKey, C.SECP256K1_EC_UNCOMPRESSED)
+	return btcec.ParsePubKey(serialized[:serializedLen])
+}
@@ -0,0 +1,65 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo && libsecp256k1
+
+package secp256k1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLibsecp256k1BackendAvailable(t *testing.T) {
+	assert.Contains(t, AvailableBackends(), BackendLibsecp256k1)
+}
+
+func TestLibsecp256k1BackendMatchesPureGo(t *testing.T) {
+	keypair := testKeyPair(t)
+	b := backends[BackendLibsecp256k1]
+	hash := make([]byte, 32)
+	for i := range hash {
+		hash[i] = byte(i)
+	}
+
+	sig, err := b.signCompact(keypair.PrivateKey, hash)
+	assert.NoError(t, err)
+	sigGo, err := (&pureGoBackend{}).signCompact(keypair.PrivateKey, hash)
+	assert.NoError(t, err)
+	assert.Equal(t, sigGo, sig)
+
+	pubKey, err := b.recoverCompact(sig, hash)
+	assert.NoError(t, err)
+	assert.True(t, keypair.PublicKey.IsEqual(pubKey))
+}
+
+func TestLibsecp256k1BackendFallbackNon32ByteHash(t *testing.T) {
+	keypair := testKeyPair(t)
+	b := backends[BackendLibsecp256k1]
+
+	sig, err := b.signCompact(keypair.PrivateKey, []byte("short"))
+	assert.NoError(t, err)
+	pubKey, err := b.recoverCompact(sig, []byte("short"))
+	assert.NoError(t, err)
+	assert.True(t, keypair.PublicKey.IsEqual(pubKey))
+}
+
+func TestLibsecp256k1BackendBadSignature(t *testing.T) {
+	b := backends[BackendLibsecp256k1]
+	_, err := b.recoverCompact([]byte{0x00}, make([]byte, 32))
+	assert.Regexp(t, "invalid compact signature", err)
+}
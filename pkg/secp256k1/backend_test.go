@@ -0,0 +1,57 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectBackendDefault(t *testing.T) {
+	err := SelectBackend(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, BackendPureGo, ActiveBackend())
+	assert.Contains(t, AvailableBackends(), BackendPureGo)
+}
+
+func TestSelectBackendUnknown(t *testing.T) {
+	err := SelectBackend(context.Background(), "unknown")
+	assert.Regexp(t, "FF22093", err)
+	assert.Equal(t, BackendPureGo, ActiveBackend())
+}
+
+func TestAllBackendsSignAndRecover(t *testing.T) {
+	defer func() {
+		_ = SelectBackend(context.Background(), BackendPureGo)
+	}()
+	keypair := testKeyPair(t)
+	for _, name := range AvailableBackends() {
+		err := SelectBackend(context.Background(), name)
+		assert.NoError(t, err)
+
+		sig, err := keypair.Sign(addEthMessagePrefix([]byte(sampleMessage)))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(28), sig.V.Int64(), name)
+		assert.Equal(t, "464eee9e2fe1a10ffe48c78b80de1ed8dcf996f3f60955cb2e03cb21903d930", sig.R.Text(16), name)
+
+		addr, err := sig.Recover(addEthMessagePrefix([]byte(sampleMessage)), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.Address, *addr, name)
+	}
+}
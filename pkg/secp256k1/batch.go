@@ -0,0 +1,64 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// VerifyBatch checks each signature is of the Keccak-256 hash of the payload at the same index, by the address at
+// that index, recovering the signatures in parallel across the available CPUs. The result for each index is true
+// if the signature is valid. The V values must be legacy 27/28 or EIP-2930 0/1 values (not EIP-155).
+// An error is only returned if the lengths of the slices differ.
+func VerifyBatch(payloads [][]byte, signatures []*SignatureData, addresses []ethtypes.Address0xHex) ([]bool, error) {
+	if len(signatures) != len(payloads) || len(addresses) != len(payloads) {
+		return nil, fmt.Errorf("mismatched batch lengths: payloads=%d signatures=%d addresses=%d", len(payloads), len(signatures), len(addresses))
+	}
+	results := make([]bool, len(payloads))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(payloads) {
+		workers = len(payloads)
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < len(payloads); i = int(next.Add(1) - 1) {
+				results[i] = verifyOne(payloads[i], signatures[i], addresses[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func verifyOne(payload []byte, sig *SignatureData, addr ethtypes.Address0xHex) bool {
+	// Checked here, as recovery panics on values that do not fit in the 65 byte compact form
+	if sig == nil || sig.V == nil || sig.R == nil || sig.S == nil || sig.R.BitLen() > 256 || sig.S.BitLen() > 256 {
+		return false
+	}
+	recovered, err := sig.RecoverBig(payload, new(big.Int))
+	return err == nil && *recovered == addr
+}
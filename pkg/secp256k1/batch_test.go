@@ -0,0 +1,82 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyBatch(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	otherKey, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	var payloads [][]byte
+	var signatures []*SignatureData
+	var addresses []ethtypes.Address0xHex
+	for i := 0; i < 100; i++ {
+		payload := []byte(fmt.Sprintf("message %d", i))
+		sig, err := keypair.Sign(payload)
+		assert.NoError(t, err)
+		if i%2 == 1 {
+			sig.UpdateEIP2930()
+		}
+		payloads = append(payloads, payload)
+		signatures = append(signatures, sig)
+		addresses = append(addresses, keypair.Address)
+	}
+	addresses[3] = otherKey.Address                   // wrong address
+	payloads[5] = []byte("tampered")                  // wrong payload
+	signatures[7] = nil                               // missing
+	signatures[9] = &SignatureData{V: big.NewInt(27)} // incomplete
+	signatures[11].R = new(big.Int).Lsh(big.NewInt(1), 256)
+	signatures[13].V = big.NewInt(99)
+
+	results, err := VerifyBatch(payloads, signatures, addresses)
+	assert.NoError(t, err)
+	for i, valid := range results {
+		switch i {
+		case 3, 5, 7, 9, 11, 13:
+			assert.False(t, valid, i)
+		default:
+			assert.True(t, valid, i)
+		}
+	}
+
+}
+
+func TestVerifyBatchEmpty(t *testing.T) {
+
+	results, err := VerifyBatch(nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+}
+
+func TestVerifyBatchMismatchedLengths(t *testing.T) {
+
+	_, err := VerifyBatch([][]byte{{}}, nil, nil)
+	assert.Regexp(t, "mismatched batch lengths: payloads=1 signatures=0 addresses=0", err)
+
+}
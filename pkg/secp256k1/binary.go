@@ -0,0 +1,79 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2"
+)
+
+// keyPairBinaryVersion is the first byte of the binary form of a key pair, so the layout can change later
+const keyPairBinaryVersion = 0x01
+
+// keyPairBinaryLength is the version byte, the 32 byte private key, the 33 byte compressed public key
+// and the 20 byte address
+const keyPairBinaryLength = 1 + privateKeyLength + 33 + 20
+
+var (
+	_ encoding.BinaryMarshaler   = &KeyPair{}
+	_ encoding.BinaryUnmarshaler = &KeyPair{}
+)
+
+// MarshalBinary returns the private key, with the public key and address cached alongside it, so key pairs
+// can be kept in a store the caller encrypts without converting them to a keystore V3 JSON file.
+// The result is unencrypted key material, which the caller is responsible for protecting and wiping.
+func (k *KeyPair) MarshalBinary() ([]byte, error) {
+	if err := k.checkUsable(); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 1+privateKeyLength, keyPairBinaryLength)
+	b[0] = keyPairBinaryVersion
+	k.PrivateKey.Key.PutBytesUnchecked(b[1:])
+	b = append(b, k.PublicKey.SerializeCompressed()...)
+	return append(b, k.Address[:]...), nil
+}
+
+// UnmarshalBinary restores a key pair from the output of MarshalBinary. The cached public key and address
+// must match the private key, so a corrupted or tampered value is rejected rather than giving a key pair
+// that signs for a different address than it reports.
+func (k *KeyPair) UnmarshalBinary(data []byte) error {
+	if len(data) != keyPairBinaryLength {
+		return fmt.Errorf("invalid key pair binary length: %d", len(data))
+	}
+	if data[0] != keyPairBinaryVersion {
+		return fmt.Errorf("unsupported key pair binary version: %d", data[0])
+	}
+	privateKey := data[1 : 1+privateKeyLength]
+	if err := ValidatePrivateKeyBytes(privateKey); err != nil {
+		return err
+	}
+	key, pubKey := btcec.PrivKeyFromBytes(privateKey)
+	if !bytes.Equal(pubKey.SerializeCompressed(), data[1+privateKeyLength:1+privateKeyLength+33]) {
+		key.Zero()
+		return fmt.Errorf("public key does not match the private key")
+	}
+	restored := wrapSecp256k1Key(key, pubKey)
+	if !bytes.Equal(restored.Address[:], data[1+privateKeyLength+33:]) {
+		key.Zero()
+		return fmt.Errorf("address does not match the private key")
+	}
+	*k = *restored
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyPairBinaryRoundTrip(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	b, err := keypair.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Len(t, b, keyPairBinaryLength)
+	assert.Equal(t, keypair.PrivateKeyBytes(), b[1:33])
+
+	var restored KeyPair
+	err = restored.UnmarshalBinary(b)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKeyBytes(), restored.PrivateKeyBytes())
+	assert.True(t, keypair.PublicKey.IsEqual(restored.PublicKey))
+	assert.Equal(t, keypair.Address, restored.Address)
+
+	sig, err := restored.Sign([]byte("hello"))
+	assert.NoError(t, err)
+	addr, err := sig.Recover([]byte("hello"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, *addr)
+
+}
+
+func TestKeyPairMarshalBinaryDestroyed(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	keypair.Destroy()
+	_, err = keypair.MarshalBinary()
+	assert.Regexp(t, "destroyed", err)
+
+}
+
+func TestKeyPairUnmarshalBinaryFail(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	b, err := keypair.MarshalBinary()
+	assert.NoError(t, err)
+
+	var restored KeyPair
+	assert.Regexp(t, "invalid key pair binary length: 85", restored.UnmarshalBinary(b[1:]))
+
+	bad := append([]byte{}, b...)
+	bad[0] = 0x02
+	assert.Regexp(t, "unsupported key pair binary version: 2", restored.UnmarshalBinary(bad))
+
+	bad = append([]byte{}, b...)
+	copy(bad[1:33], make([]byte, 32))
+	assert.Regexp(t, "private key is zero", restored.UnmarshalBinary(bad))
+
+	bad = append([]byte{}, b...)
+	bad[33] ^= 0x01
+	assert.Regexp(t, "public key does not match", restored.UnmarshalBinary(bad))
+
+	bad = append([]byte{}, b...)
+	bad[len(bad)-1] ^= 0x01
+	assert.Regexp(t, "address does not match", restored.UnmarshalBinary(bad))
+
+	assert.Nil(t, restored.PrivateKey)
+
+}
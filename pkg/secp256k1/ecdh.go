@@ -0,0 +1,70 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ECDHKDF derives the key material returned by SharedSecret from the raw ECDH shared secret, which is the
+// 32 byte X coordinate of the shared point. The raw secret is wiped after the KDF returns, so the KDF
+// must not keep a reference to it.
+type ECDHKDF func(sharedX []byte) ([]byte, error)
+
+// ECDHRaw returns a copy of the raw 32 byte X coordinate, for interoperability with protocols that apply
+// their own KDF. The raw shared secret is not uniformly random, so should not be used directly as a key.
+func ECDHRaw() ECDHKDF {
+	return func(sharedX []byte) ([]byte, error) {
+		return append([]byte{}, sharedX...), nil
+	}
+}
+
+// ECDHHKDFSHA256 expands the shared secret with HKDF-SHA256 to a key of the requested length. The salt
+// and info are optional, and separate keys derived for different purposes from the same pair of keys.
+func ECDHHKDFSHA256(salt, info []byte, length int) ECDHKDF {
+	return func(sharedX []byte) ([]byte, error) {
+		key := make([]byte, length)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, sharedX, salt, info), key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
+// SharedSecret performs a secp256k1 ECDH key agreement between this key pair and the peer's public key,
+// giving the same result as the peer computes with its private key and this key pair's public key.
+// The shared secret is passed through the KDF, which defaults to a 32 byte HKDF-SHA256 key with no salt
+// or info when nil.
+func (k *KeyPair) SharedSecret(peerPubKey *btcec.PublicKey, kdf ECDHKDF) ([]byte, error) {
+	if err := k.checkUsable(); err != nil {
+		return nil, err
+	}
+	if peerPubKey == nil {
+		return nil, fmt.Errorf("nil peer public key")
+	}
+	if kdf == nil {
+		kdf = ECDHHKDFSHA256(nil, nil, 32)
+	}
+	sharedX := btcec.GenerateSharedSecret(k.PrivateKey, peerPubKey)
+	defer zeroBytes(sharedX)
+	return kdf(sharedX)
+}
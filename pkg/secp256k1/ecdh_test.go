@@ -0,0 +1,75 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedSecret(t *testing.T) {
+
+	alice, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	bob, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	// Both sides agree, with the default KDF
+	s1, err := alice.SharedSecret(bob.PublicKey, nil)
+	assert.NoError(t, err)
+	s2, err := bob.SharedSecret(alice.PublicKey, nil)
+	assert.NoError(t, err)
+	assert.Len(t, s1, 32)
+	assert.Equal(t, s1, s2)
+
+	// Raw differs from the default, and different salt/info give different keys
+	raw, err := alice.SharedSecret(bob.PublicKey, ECDHRaw())
+	assert.NoError(t, err)
+	assert.Len(t, raw, 32)
+	assert.NotEqual(t, s1, raw)
+	k1, err := alice.SharedSecret(bob.PublicKey, ECDHHKDFSHA256([]byte("salt"), []byte("one"), 16))
+	assert.NoError(t, err)
+	assert.Len(t, k1, 16)
+	k2, err := bob.SharedSecret(alice.PublicKey, ECDHHKDFSHA256([]byte("salt"), []byte("two"), 16))
+	assert.NoError(t, err)
+	assert.NotEqual(t, k1, k2)
+
+}
+
+func TestSharedSecretFail(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	_, err = keypair.SharedSecret(nil, nil)
+	assert.Regexp(t, "nil peer public key", err)
+
+	_, err = keypair.SharedSecret(keypair.PublicKey, func(sharedX []byte) ([]byte, error) {
+		return nil, fmt.Errorf("pop")
+	})
+	assert.Regexp(t, "pop", err)
+
+	_, err = keypair.SharedSecret(keypair.PublicKey, ECDHHKDFSHA256(nil, nil, 255*32+1))
+	assert.Regexp(t, "entropy limit", err)
+
+	keypair.Destroy()
+	_, err = keypair.SharedSecret(keypair.PublicKey, nil)
+	assert.Regexp(t, "destroyed", err)
+
+}
@@ -0,0 +1,98 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	eciesPubKeyLen = 33 // compressed ephemeral public key
+	eciesNonceLen  = 12 // AES-GCM standard nonce
+)
+
+var eciesInfo = []byte("firefly-signer-ecies")
+
+// Encrypt encrypts the plaintext such that only the holder of the private key for the recipient's
+// public key can decrypt it (ECIES). An ephemeral key is generated for an ECDH key agreement with the
+// recipient, the shared secret is expanded with HKDF-SHA256 to an AES-256 key, and the plaintext is
+// sealed with AES-GCM. The result is the compressed ephemeral public key (33 bytes), the nonce
+// (12 bytes), and the ciphertext with its authentication tag.
+func Encrypt(recipient *btcec.PublicKey, plaintext []byte) ([]byte, error) {
+	ephemeral, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPub := ephemeral.PubKey().SerializeCompressed()
+	gcm, err := eciesCipher(btcec.GenerateSharedSecret(ephemeral, recipient), ephemeralPub)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, eciesNonceLen)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append(ephemeralPub, nonce...)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+// Decrypt decrypts data produced by Encrypt for this key pair's public key
+func (k *KeyPair) Decrypt(data []byte) ([]byte, error) {
+	if err := k.checkUsable(); err != nil {
+		return nil, err
+	}
+	if len(data) < eciesPubKeyLen+eciesNonceLen {
+		return nil, fmt.Errorf("encrypted data too short (%d bytes)", len(data))
+	}
+	ephemeralPub, err := btcec.ParsePubKey(data[0:eciesPubKeyLen])
+	if err != nil {
+		return nil, err
+	}
+	sharedX, err := k.SharedSecret(ephemeralPub, ECDHRaw())
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := eciesCipher(sharedX, data[0:eciesPubKeyLen])
+	if err != nil {
+		return nil, err
+	}
+	nonce := data[eciesPubKeyLen : eciesPubKeyLen+eciesNonceLen]
+	return gcm.Open(nil, nonce, data[eciesPubKeyLen+eciesNonceLen:], nil)
+}
+
+// eciesCipher derives the AES-256-GCM cipher from the shared secret, salted with the ephemeral public key
+func eciesCipher(sharedSecret, ephemeralPub []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	defer zeroBytes(key)
+	defer zeroBytes(sharedSecret)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, ephemeralPub, eciesInfo), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
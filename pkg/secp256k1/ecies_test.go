@@ -0,0 +1,58 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	kp, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	data, err := Encrypt(kp.PublicKey, []byte("secret"))
+	assert.NoError(t, err)
+	assert.Len(t, data, 33+12+len("secret")+16)
+
+	plaintext, err := kp.Decrypt(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	// A different key cannot decrypt
+	other, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	_, err = other.Decrypt(data)
+	assert.Regexp(t, "authentication failed", err)
+
+	// Tampering is detected
+	data[len(data)-1] ^= 0xff
+	_, err = kp.Decrypt(data)
+	assert.Regexp(t, "authentication failed", err)
+}
+
+func TestDecryptBadData(t *testing.T) {
+	kp, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	_, err = kp.Decrypt([]byte{0x01})
+	assert.Regexp(t, "too short", err)
+
+	_, err = kp.Decrypt(make([]byte, 60))
+	assert.Error(t, err)
+}
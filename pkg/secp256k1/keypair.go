@@ -17,8 +17,14 @@
 package secp256k1
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
 	btcec "github.com/btcsuite/btcd/btcec/v2" // ISC licensed
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -26,17 +32,80 @@ type KeyPair struct {
 	PrivateKey *btcec.PrivateKey
 	PublicKey  *btcec.PublicKey
 	Address    ethtypes.Address0xHex
+	destroyed  bool
 }
 
 func (k *KeyPair) PrivateKeyBytes() []byte {
 	return k.PrivateKey.Serialize()
 }
 
+// Destroy zeroes the private key, so the key material does not stay in memory once the key pair is no
+// longer needed, and marks the key pair as unusable - signing and decryption fail after it is destroyed.
+func (k *KeyPair) Destroy() {
+	if k.PrivateKey != nil {
+		k.PrivateKey.Zero()
+	}
+	k.destroyed = true
+}
+
+// IsDestroyed returns true once Destroy has been called on the key pair
+func (k *KeyPair) IsDestroyed() bool {
+	return k.destroyed
+}
+
+func (k *KeyPair) checkUsable() error {
+	if k == nil {
+		return fmt.Errorf("nil signer")
+	}
+	if k.destroyed {
+		return fmt.Errorf("key pair has been destroyed")
+	}
+	return nil
+}
+
+// zeroBytes wipes a temporary buffer that held key material
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 func (k *KeyPair) PublicKeyBytes() []byte {
 	// Remove the "04" Prefix byte when computing the address. This byte indicates that it is an uncompressed public key.
 	return k.PublicKey.SerializeUncompressed()[1:]
 }
 
+// PublicKeyBytesCompressed returns the 33 byte compressed public key - the "02" or "03" Y-parity prefix byte,
+// followed by the X coordinate
+func (k *KeyPair) PublicKeyBytesCompressed() []byte {
+	return k.PublicKey.SerializeCompressed()
+}
+
+// ParsePublicKey parses a public key in the 33 byte compressed form, the 65 byte uncompressed form, or the
+// 64 byte uncompressed form without the "04" prefix byte (as returned by PublicKeyBytes)
+func ParsePublicKey(b []byte) (*btcec.PublicKey, error) {
+	if len(b) == 64 {
+		b = append([]byte{0x04}, b...)
+	}
+	pubKey, err := btcec.ParsePubKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %s", err)
+	}
+	return pubKey, nil
+}
+
+// CompressedPublicKeyToAddress returns the Ethereum address of a 33 byte compressed public key
+func CompressedPublicKeyToAddress(b []byte) (*ethtypes.Address0xHex, error) {
+	if len(b) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("invalid compressed public key length: %d", len(b))
+	}
+	pubKey, err := ParsePublicKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return PublicKeyToAddress(pubKey), nil
+}
+
 func GenerateSecp256k1KeyPair() (*KeyPair, error) {
 	// Generates key of curve S256() by default
 	key, _ := btcec.NewPrivateKey()
@@ -48,11 +117,56 @@ func NewSecp256k1KeyPair(b []byte) (*KeyPair, error) {
 	return KeyPairFromBytes(b), nil
 }
 
+// seedDerivationSalt separates the keys derived by NewSecp256k1KeyPairFromSeed from other uses of the same seed
+var seedDerivationSalt = []byte("firefly-signer secp256k1 seed derivation")
+
+// NewSecp256k1KeyPairFromSeed deterministically derives the key pair at the index from a seed of at least
+// 16 bytes, so test environments and development networks can regenerate the same accounts without storing
+// key files. The key is the first valid 32 byte output of HKDF-SHA256, with the big-endian index as the info.
+// These are not BIP-32 keys - use the hdwallet package to derive keys from a BIP-39 mnemonic.
+func NewSecp256k1KeyPairFromSeed(seed []byte, index uint32) (*KeyPair, error) {
+	if len(seed) < 16 {
+		return nil, fmt.Errorf("invalid seed length: %d", len(seed))
+	}
+	info := make([]byte, 4)
+	binary.BigEndian.PutUint32(info, index)
+	kdf := hkdf.New(sha256.New, seed, seedDerivationSalt, info)
+	b := make([]byte, 32)
+	for {
+		// The chance of an invalid key is less than 1 in 2^127, but the next output is used if it happens
+		if _, err := io.ReadFull(kdf, b); err != nil {
+			return nil, err
+		}
+		if ValidatePrivateKeyBytes(b) == nil {
+			keypair := KeyPairFromBytes(b)
+			zeroBytes(b)
+			return keypair, nil
+		}
+	}
+}
+
 func KeyPairFromBytes(b []byte) *KeyPair {
 	key, pubKey := btcec.PrivKeyFromBytes(b)
 	return wrapSecp256k1Key(key, pubKey)
 }
 
+// ValidatePrivateKeyBytes checks the supplied big-endian bytes are a usable secp256k1 private key,
+// which must be a non-zero scalar less than the order of the curve (N). KeyPairFromBytes silently
+// reduces out of range values, so this should be called on any key material read from outside.
+func ValidatePrivateKeyBytes(b []byte) error {
+	if len(b) == 0 || len(b) > 32 {
+		return fmt.Errorf("invalid private key length: %d", len(b))
+	}
+	var scalar btcec.ModNScalar
+	if overflow := scalar.SetByteSlice(b); overflow {
+		return fmt.Errorf("private key is not less than the secp256k1 curve order")
+	}
+	if scalar.IsZero() {
+		return fmt.Errorf("private key is zero")
+	}
+	return nil
+}
+
 func wrapSecp256k1Key(key *btcec.PrivateKey, pubKey *btcec.PublicKey) *KeyPair {
 	return &KeyPair{
 		PrivateKey: key,
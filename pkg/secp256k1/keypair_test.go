@@ -17,13 +17,55 @@
 package secp256k1
 
 import (
+	"bytes"
 	"context"
 	"math/big"
 	"testing"
 
+	btcec "github.com/btcsuite/btcd/btcec/v2"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestValidatePrivateKeyBytes(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	assert.NoError(t, ValidatePrivateKeyBytes(keypair.PrivateKeyBytes()))
+	assert.NoError(t, ValidatePrivateKeyBytes([]byte{0x01}))
+
+	n := btcec.S256().N
+	assert.NoError(t, ValidatePrivateKeyBytes(new(big.Int).Sub(n, big.NewInt(1)).Bytes()))
+	assert.Regexp(t, "curve order", ValidatePrivateKeyBytes(n.Bytes()))
+	assert.Regexp(t, "curve order", ValidatePrivateKeyBytes(bytes.Repeat([]byte{0xff}, 32)))
+	assert.Regexp(t, "zero", ValidatePrivateKeyBytes(make([]byte, 32)))
+	assert.Regexp(t, "length: 0", ValidatePrivateKeyBytes(nil))
+	assert.Regexp(t, "length: 33", ValidatePrivateKeyBytes(make([]byte, 33)))
+
+}
+
+func TestKeyPairDestroy(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	assert.False(t, keypair.IsDestroyed())
+	keypair.Destroy()
+	assert.True(t, keypair.IsDestroyed())
+	assert.True(t, keypair.PrivateKey.Key.IsZero())
+	assert.Equal(t, make([]byte, 32), keypair.PrivateKeyBytes())
+
+	// Unusable once destroyed
+	_, err = keypair.Sign([]byte("hello"))
+	assert.Regexp(t, "destroyed", err)
+	_, err = keypair.SignDigest([32]byte{})
+	assert.Regexp(t, "destroyed", err)
+	_, err = keypair.Decrypt(make([]byte, 100))
+	assert.Regexp(t, "destroyed", err)
+
+	// Safe with no private key
+	(&KeyPair{}).Destroy()
+
+}
+
 func TestGeneratedKeyRoundTrip(t *testing.T) {
 
 	keypair, err := GenerateSecp256k1KeyPair()
@@ -80,3 +122,67 @@ func TestGeneratedKeyRoundTrip(t *testing.T) {
 	assert.Error(t, err)
 
 }
+
+func TestCompressedPublicKey(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	compressed := keypair.PublicKeyBytesCompressed()
+	assert.Len(t, compressed, 33)
+	assert.Contains(t, []byte{0x02, 0x03}, compressed[0])
+
+	for _, b := range [][]byte{
+		compressed,
+		keypair.PublicKey.SerializeUncompressed(),
+		keypair.PublicKeyBytes(),
+	} {
+		pubKey, err := ParsePublicKey(b)
+		assert.NoError(t, err)
+		assert.True(t, pubKey.IsEqual(keypair.PublicKey))
+	}
+
+	addr, err := CompressedPublicKeyToAddress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, *addr)
+
+}
+
+func TestCompressedPublicKeyErrors(t *testing.T) {
+
+	_, err := ParsePublicKey([]byte{0x02})
+	assert.Regexp(t, "invalid public key", err)
+
+	_, err = CompressedPublicKeyToAddress(make([]byte, 65))
+	assert.Regexp(t, "invalid compressed public key length: 65", err)
+
+	// Not on the curve
+	_, err = CompressedPublicKeyToAddress(append([]byte{0x02}, bytes.Repeat([]byte{0xff}, 32)...))
+	assert.Regexp(t, "invalid public key", err)
+
+}
+
+func TestNewSecp256k1KeyPairFromSeed(t *testing.T) {
+
+	seed := []byte("0123456789abcdef")
+	k0, err := NewSecp256k1KeyPairFromSeed(seed, 0)
+	assert.NoError(t, err)
+	k0Again, err := NewSecp256k1KeyPairFromSeed(seed, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, k0.PrivateKeyBytes(), k0Again.PrivateKeyBytes())
+	assert.Equal(t, k0.Address, k0Again.Address)
+
+	k1, err := NewSecp256k1KeyPairFromSeed(seed, 1)
+	assert.NoError(t, err)
+	assert.NotEqual(t, k0.Address, k1.Address)
+
+	other, err := NewSecp256k1KeyPairFromSeed([]byte("0123456789abcdeF"), 0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, k0.Address, other.Address)
+
+	// Fixed, so accounts derived from a seed remain the same across releases
+	assert.Equal(t, "0x1003506ace9db98e75c1e5054149257783044f62", k0.Address.String())
+
+	_, err = NewSecp256k1KeyPairFromSeed([]byte("short"), 0)
+	assert.Regexp(t, "invalid seed length: 5", err)
+
+}
@@ -0,0 +1,90 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"fmt"
+	"math/big"
+	"sync/atomic"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2" // ISC licensed
+)
+
+var (
+	halfCurveOrder = new(big.Int).Rsh(btcec.S256().N, 1)
+	lowSDisabled   atomic.Bool
+)
+
+// SetLowSNormalization controls whether NewSignatureFromRS normalizes the S value of signatures produced outside
+// of this package (such as by an HSM or cloud KMS) to the lower half of the curve order, as Ethereum transactions
+// require (EIP-2). It is enabled by default, and should only be disabled when the signatures are verified by
+// something that requires the S value exactly as the external signer returned it. The signatures of the backends
+// in this package are always low-S.
+func SetLowSNormalization(enabled bool) {
+	lowSDisabled.Store(!enabled)
+}
+
+// LowSNormalization returns whether low-S normalization is enabled
+func LowSNormalization() bool {
+	return !lowSDisabled.Load()
+}
+
+// IsLowS returns true if the S value is in the lower half of the curve order
+func (s *SignatureData) IsLowS() bool {
+	return s.S.Cmp(halfCurveOrder) <= 0
+}
+
+// Canonical validates a signature (such as one produced by an external signer) and returns a copy with the S value
+// in the lower half of the curve order. The Y-parity of the V value is flipped when S is normalized, so the
+// signature still recovers to the same address. V can be a legacy 27/28, EIP-2930 0/1 or EIP-155 value.
+func (s *SignatureData) Canonical() (*SignatureData, error) {
+	n := btcec.S256().N
+	if s.R == nil || s.S == nil || s.V == nil {
+		return nil, fmt.Errorf("incomplete signature")
+	}
+	if s.R.Sign() <= 0 || s.R.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("invalid R value in signature: out of range")
+	}
+	if s.S.Sign() <= 0 || s.S.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("invalid S value in signature: out of range")
+	}
+	sig := &SignatureData{
+		V: new(big.Int).Set(s.V),
+		R: new(big.Int).Set(s.R),
+		S: new(big.Int).Set(s.S),
+	}
+	if sig.IsLowS() {
+		return sig, nil
+	}
+	sig.S.Sub(n, sig.S)
+	switch {
+	case sig.V.Sign() == 0, sig.V.Cmp(big27) == 0:
+		sig.V.Add(sig.V, big.NewInt(1))
+	case sig.V.Cmp(big.NewInt(1)) == 0, sig.V.Cmp(big28) == 0:
+		sig.V.Sub(sig.V, big.NewInt(1))
+	case sig.V.Cmp(big35) >= 0:
+		// EIP-155 V value of (2*ChainID + 35 + Y-parity)
+		if new(big.Int).Sub(sig.V, big35).Bit(0) == 0 {
+			sig.V.Add(sig.V, big.NewInt(1))
+		} else {
+			sig.V.Sub(sig.V, big.NewInt(1))
+		}
+	default:
+		return nil, fmt.Errorf("invalid V value in signature (V = %s)", s.V)
+	}
+	return sig, nil
+}
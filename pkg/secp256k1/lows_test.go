@@ -0,0 +1,125 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"math/big"
+	"testing"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/sha3"
+)
+
+func otherParity(v int64) *big.Int {
+	switch {
+	case v <= 1:
+		return big.NewInt(1 - v)
+	case v <= 28:
+		return big.NewInt(55 - v)
+	case (v-35)%2 == 0:
+		return big.NewInt(v + 1)
+	default:
+		return big.NewInt(v - 1)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte("hello world"))
+	digest := hash.Sum(nil)
+	sig, err := keypair.SignDirect(digest)
+	assert.NoError(t, err)
+	assert.True(t, sig.IsLowS())
+
+	// Already canonical
+	canonical, err := sig.Canonical()
+	assert.NoError(t, err)
+	assert.Equal(t, sig.CompactRSV(), canonical.CompactRSV())
+
+	for _, update := range []func(sig *SignatureData){
+		func(sig *SignatureData) {},
+		func(sig *SignatureData) { sig.UpdateEIP2930() },
+		func(sig *SignatureData) { sig.UpdateEIP155(1337) },
+	} {
+		expected, err := keypair.SignDirect(digest)
+		assert.NoError(t, err)
+		update(expected)
+
+		// The high-S form, with the other Y-parity, recovers to the same address
+		highS, err := keypair.SignDirect(digest)
+		assert.NoError(t, err)
+		update(highS)
+		highS.S.Sub(btcec.S256().N, highS.S)
+		highS.V = otherParity(highS.V.Int64())
+		assert.False(t, highS.IsLowS())
+
+		canonical, err := highS.Canonical()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, canonical)
+		recovered, err := canonical.RecoverDirect(digest, 1337)
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.Address, *recovered)
+	}
+
+}
+
+func TestCanonicalErrors(t *testing.T) {
+
+	n := btcec.S256().N
+	_, err := (&SignatureData{}).Canonical()
+	assert.Regexp(t, "incomplete signature", err)
+
+	_, err = (&SignatureData{V: big.NewInt(27), R: big.NewInt(0), S: big.NewInt(1)}).Canonical()
+	assert.Regexp(t, "invalid R value", err)
+
+	_, err = (&SignatureData{V: big.NewInt(27), R: big.NewInt(1), S: new(big.Int).Set(n)}).Canonical()
+	assert.Regexp(t, "invalid S value", err)
+
+	_, err = (&SignatureData{V: big.NewInt(30), R: big.NewInt(1), S: new(big.Int).Sub(n, big.NewInt(1))}).Canonical()
+	assert.Regexp(t, "invalid V value", err)
+
+}
+
+func TestNewSignatureFromRSLowSDisabled(t *testing.T) {
+
+	SetLowSNormalization(false)
+	defer SetLowSNormalization(true)
+	assert.False(t, LowSNormalization())
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte("hello world"))
+	digest := hash.Sum(nil)
+	sig, err := keypair.SignDirect(digest)
+	assert.NoError(t, err)
+
+	// The S value is kept, with the V that recovers the address for it
+	highS := new(big.Int).Sub(btcec.S256().N, sig.S)
+	rebuilt, ok := NewSignatureFromRS(digest, sig.R, highS, keypair.Address)
+	assert.True(t, ok)
+	assert.Equal(t, highS, rebuilt.S)
+	assert.False(t, rebuilt.IsLowS())
+	recovered, err := rebuilt.RecoverDirect(digest, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, *recovered)
+
+}
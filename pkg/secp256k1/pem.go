@@ -0,0 +1,140 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2" // ISC licensed
+)
+
+const (
+	pemTypeECParameters    = "EC PARAMETERS"
+	pemTypeECPrivateKey    = "EC PRIVATE KEY"
+	pemTypePKCS8PrivateKey = "PRIVATE KEY"
+	privateKeyLength       = 32
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveS256 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// ecPrivateKey is the SEC 1 (RFC 5915) ASN.1 structure of an EC private key
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// pkcs8PrivateKey is the PKCS#8 (RFC 5208) ASN.1 structure wrapping a private key
+type pkcs8PrivateKey struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// ParsePEMPrivateKey parses the first private key PEM block in the supplied data, which must
+// be an unencrypted secp256k1 private key in either SEC 1 "EC PRIVATE KEY" or PKCS#8
+// "PRIVATE KEY" form. Any "EC PARAMETERS" blocks before the key are skipped, as emitted
+// by "openssl ecparam -genkey" without "-noout".
+//
+// The Go standard library x509 package does not support the secp256k1 curve,
+// so the ASN.1 structures are parsed directly.
+func ParsePEMPrivateKey(pemBytes []byte) (*KeyPair, error) {
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM private key block found")
+		}
+		switch block.Type {
+		case pemTypeECParameters:
+			continue
+		case pemTypeECPrivateKey:
+			return parseECPrivateKey(block.Bytes, nil)
+		case pemTypePKCS8PrivateKey:
+			return parsePKCS8PrivateKey(block.Bytes)
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type '%s'", block.Type)
+		}
+	}
+}
+
+func parsePKCS8PrivateKey(der []byte) (*KeyPair, error) {
+	var p8 pkcs8PrivateKey
+	if _, err := asn1.Unmarshal(der, &p8); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#8 private key: %s", err)
+	}
+	if !p8.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("PKCS#8 private key is not an EC key (algorithm %s)", p8.Algo.Algorithm)
+	}
+	var curveOID asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(p8.Algo.Parameters.FullBytes, &curveOID); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#8 EC parameters: %s", err)
+	}
+	return parseECPrivateKey(p8.PrivateKey, curveOID)
+}
+
+// parseECPrivateKey parses a SEC 1 private key. The curve must be secp256k1, either from
+// the supplied OID (from the PKCS#8 wrapper) or the OID in the structure itself. If both
+// are present they must match, and if the optional public key is present it must match
+// the private key.
+func parseECPrivateKey(der []byte, curveOID asn1.ObjectIdentifier) (*KeyPair, error) {
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		return nil, fmt.Errorf("invalid EC private key: %s", err)
+	}
+	if key.Version != 1 {
+		return nil, fmt.Errorf("unsupported EC private key version %d", key.Version)
+	}
+	if curveOID == nil {
+		curveOID = key.NamedCurveOID
+	} else if key.NamedCurveOID != nil && !key.NamedCurveOID.Equal(curveOID) {
+		return nil, fmt.Errorf("EC private key curve %s does not match PKCS#8 curve %s", key.NamedCurveOID, curveOID)
+	}
+	if !curveOID.Equal(oidNamedCurveS256) {
+		return nil, fmt.Errorf("EC private key is not on the secp256k1 curve (curve %s)", curveOID)
+	}
+	if len(key.PrivateKey) > privateKeyLength {
+		return nil, fmt.Errorf("invalid EC private key length %d", len(key.PrivateKey))
+	}
+	if err := ValidatePrivateKeyBytes(key.PrivateKey); err != nil {
+		return nil, fmt.Errorf("invalid EC private key: %s", err)
+	}
+	// Left pad to the full key length, as some encoders strip leading zeros
+	keyBytes := make([]byte, privateKeyLength)
+	copy(keyBytes[privateKeyLength-len(key.PrivateKey):], key.PrivateKey)
+	keypair := KeyPairFromBytes(keyBytes)
+	zeroBytes(keyBytes)
+	zeroBytes(key.PrivateKey)
+	if len(key.PublicKey.Bytes) > 0 {
+		pubKey, err := btcec.ParsePubKey(key.PublicKey.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC public key: %s", err)
+		}
+		if !bytes.Equal(pubKey.SerializeCompressed(), keypair.PublicKey.SerializeCompressed()) {
+			return nil, fmt.Errorf("EC public key does not match the private key")
+		}
+	}
+	return keypair, nil
+}
@@ -0,0 +1,111 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"golang.org/x/crypto/sha3"
+)
+
+// RemoteSigner is the minimal interface for a hardware or cloud signer (an HSM, or a key management
+// service) that holds a secp256k1 private key and signs 32 byte digests. Such signers return only the
+// R and S values, so wrap one with NewRemoteSignerAdapter to use it wherever a Signer is accepted.
+type RemoteSigner interface {
+	PublicKey(ctx context.Context) (*btcec.PublicKey, error)
+	SignDigest(ctx context.Context, digest [32]byte) (r, s *big.Int, err error)
+}
+
+// RemoteSignerAdapter implements SignerDirect and SignerDigest for a RemoteSigner. The recovery ID for
+// the V value is found by recovering the address from each candidate, and S is normalized to low-S as
+// described on NewSignatureFromRS.
+type RemoteSignerAdapter struct {
+	ctx       context.Context
+	remote    RemoteSigner
+	publicKey *btcec.PublicKey
+	address   ethtypes.Address0xHex
+}
+
+var (
+	_ SignerDirect = &RemoteSignerAdapter{}
+	_ SignerDigest = &RemoteSignerAdapter{}
+)
+
+// NewRemoteSignerAdapter retrieves the public key from the remote signer once, to calculate the address
+// that signatures must recover to. The context is used for every signing request.
+func NewRemoteSignerAdapter(ctx context.Context, remote RemoteSigner) (*RemoteSignerAdapter, error) {
+	publicKey, err := remote.PublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if publicKey == nil {
+		return nil, fmt.Errorf("remote signer returned no public key")
+	}
+	return &RemoteSignerAdapter{
+		ctx:       ctx,
+		remote:    remote,
+		publicKey: publicKey,
+		address:   *PublicKeyToAddress(publicKey),
+	}, nil
+}
+
+// Address is the address of the remote signer's key
+func (a *RemoteSignerAdapter) Address() ethtypes.Address0xHex {
+	return a.address
+}
+
+// PublicKey is the public key of the remote signer, as retrieved when the adapter was created
+func (a *RemoteSignerAdapter) PublicKey() *btcec.PublicKey {
+	return a.publicKey
+}
+
+// Sign hashes the input then signs it remotely
+func (a *RemoteSignerAdapter) Sign(message []byte) (*SignatureData, error) {
+	var digest [32]byte
+	msgHash := sha3.NewLegacyKeccak256()
+	msgHash.Write(message)
+	copy(digest[:], msgHash.Sum(nil))
+	return a.SignDigest(digest)
+}
+
+// SignDirect signs a 32 byte hash remotely - give legacy 27/28 V values
+func (a *RemoteSignerAdapter) SignDirect(hash []byte) (*SignatureData, error) {
+	if len(hash) != 32 {
+		return nil, fmt.Errorf("invalid hash length for remote signing: %d", len(hash))
+	}
+	return a.SignDigest([32]byte(hash))
+}
+
+// SignDigest signs a 32 byte digest remotely - give legacy 27/28 V values
+func (a *RemoteSignerAdapter) SignDigest(digest [32]byte) (*SignatureData, error) {
+	r, s, err := a.remote.SignDigest(a.ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil || s == nil {
+		return nil, fmt.Errorf("remote signer returned an incomplete signature")
+	}
+	sig, ok := NewSignatureFromRS(digest[:], r, s, a.address)
+	if !ok {
+		return nil, fmt.Errorf("remote signature does not recover to address %s", a.address)
+	}
+	return sig, nil
+}
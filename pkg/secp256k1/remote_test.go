@@ -0,0 +1,148 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRemoteSigner struct {
+	keypair *KeyPair
+	highS   bool
+	pubErr  error
+	signErr error
+	badSig  bool
+	nilSig  bool
+}
+
+func (ts *testRemoteSigner) PublicKey(ctx context.Context) (*btcec.PublicKey, error) {
+	if ts.pubErr != nil {
+		return nil, ts.pubErr
+	}
+	if ts.keypair == nil {
+		return nil, nil
+	}
+	return ts.keypair.PublicKey, nil
+}
+
+func (ts *testRemoteSigner) SignDigest(ctx context.Context, digest [32]byte) (*big.Int, *big.Int, error) {
+	if ts.signErr != nil {
+		return nil, nil, ts.signErr
+	}
+	if ts.nilSig {
+		return nil, nil, nil
+	}
+	if ts.badSig {
+		return big.NewInt(1), big.NewInt(1), nil
+	}
+	sig, err := ts.keypair.SignDigest(digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := sig.S
+	if ts.highS {
+		s = new(big.Int).Sub(btcec.S256().N, s)
+	}
+	return sig.R, s, nil
+}
+
+func TestRemoteSignerAdapter(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	for _, highS := range []bool{false, true} {
+		a, err := NewRemoteSignerAdapter(context.Background(), &testRemoteSigner{keypair: keypair, highS: highS})
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.Address, a.Address())
+		assert.True(t, keypair.PublicKey.IsEqual(a.PublicKey()))
+
+		sig, err := a.Sign([]byte("hello"))
+		assert.NoError(t, err)
+		assert.True(t, sig.IsLowS())
+		expected, err := keypair.Sign([]byte("hello"))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, sig)
+
+		addr, err := sig.Recover([]byte("hello"), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.Address, *addr)
+	}
+
+}
+
+func TestRemoteSignerAdapterSignDirect(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	a, err := NewRemoteSignerAdapter(context.Background(), &testRemoteSigner{keypair: keypair})
+	assert.NoError(t, err)
+
+	hash := make([]byte, 32)
+	hash[0] = 0x01
+	sig, err := a.SignDirect(hash)
+	assert.NoError(t, err)
+	addr, err := sig.RecoverDirect(hash, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, *addr)
+
+	_, err = a.SignDirect(make([]byte, 31))
+	assert.Regexp(t, "invalid hash length for remote signing: 31", err)
+
+}
+
+func TestRemoteSignerAdapterFail(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := NewRemoteSignerAdapter(ctx, &testRemoteSigner{pubErr: fmt.Errorf("pop")})
+	assert.Regexp(t, "pop", err)
+
+	_, err = NewRemoteSignerAdapter(ctx, &testRemoteSigner{})
+	assert.Regexp(t, "no public key", err)
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+
+	a, err := NewRemoteSignerAdapter(ctx, &testRemoteSigner{keypair: keypair, signErr: fmt.Errorf("pop")})
+	assert.NoError(t, err)
+	_, err = a.SignDigest([32]byte{})
+	assert.Regexp(t, "pop", err)
+
+	a, err = NewRemoteSignerAdapter(ctx, &testRemoteSigner{keypair: keypair, badSig: true})
+	assert.NoError(t, err)
+	_, err = a.SignDigest([32]byte{})
+	assert.Regexp(t, "does not recover to address", err)
+
+	other, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	a, err = NewRemoteSignerAdapter(ctx, &testRemoteSigner{keypair: keypair})
+	assert.NoError(t, err)
+	a.remote = &testRemoteSigner{keypair: other}
+	_, err = a.SignDigest([32]byte{})
+	assert.Regexp(t, "does not recover to address", err)
+
+	a.remote = &testRemoteSigner{nilSig: true}
+	_, err = a.SignDigest([32]byte{})
+	assert.Regexp(t, "incomplete signature", err)
+
+}
@@ -0,0 +1,65 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// SchnorrSigner is implemented by modules that provide BIP-340 Schnorr signatures over secp256k1. It is
+// separate to Signer, as the signatures are not interchangeable with ECDSA - a Schnorr signature is a fixed
+// 64 bytes, verified against the 32 byte x-only public key rather than recovered to an address.
+type SchnorrSigner interface {
+	SignSchnorr(digest [32]byte) ([]byte, error)
+	SchnorrPublicKey() []byte
+}
+
+// SignSchnorr returns the 64 byte BIP-340 signature of a 32 byte digest. The nonce is derived
+// deterministically (RFC 6979) from the key and digest, so signing the same digest twice gives the same
+// signature, as with ECDSA signing.
+func (k *KeyPair) SignSchnorr(digest [32]byte) ([]byte, error) {
+	if err := k.checkUsable(); err != nil {
+		return nil, err
+	}
+	sig, err := schnorr.Sign(k.PrivateKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return sig.Serialize(), nil
+}
+
+// SchnorrPublicKey returns the 32 byte x-only public key that BIP-340 signatures are verified against
+func (k *KeyPair) SchnorrPublicKey() []byte {
+	return schnorr.SerializePubKey(k.PublicKey)
+}
+
+// VerifySchnorr checks a 64 byte BIP-340 signature of a 32 byte digest against a 32 byte x-only public key.
+// An error is returned if the public key or signature cannot be parsed, and false if the signature does not
+// verify.
+func VerifySchnorr(pubKey []byte, digest [32]byte, signature []byte) (bool, error) {
+	pub, err := schnorr.ParsePubKey(pubKey)
+	if err != nil {
+		return false, fmt.Errorf("invalid schnorr public key: %s", err)
+	}
+	sig, err := schnorr.ParseSignature(signature)
+	if err != nil {
+		return false, fmt.Errorf("invalid schnorr signature: %s", err)
+	}
+	return sig.Verify(digest[:], pub), nil
+}
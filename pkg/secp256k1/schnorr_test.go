@@ -0,0 +1,86 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secp256k1
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchnorrSignVerify(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	var signer SchnorrSigner = keypair
+
+	digest := [32]byte{0x01, 0x02, 0x03}
+	sig, err := signer.SignSchnorr(digest)
+	assert.NoError(t, err)
+	assert.Len(t, sig, 64)
+	assert.Len(t, signer.SchnorrPublicKey(), 32)
+
+	// Deterministic
+	sig2, err := signer.SignSchnorr(digest)
+	assert.NoError(t, err)
+	assert.Equal(t, sig, sig2)
+
+	ok, err := VerifySchnorr(signer.SchnorrPublicKey(), digest, sig)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = VerifySchnorr(signer.SchnorrPublicKey(), [32]byte{0x01}, sig)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	keypair.Destroy()
+	_, err = keypair.SignSchnorr(digest)
+	assert.Regexp(t, "destroyed", err)
+
+}
+
+func TestSchnorrBIP340Vector(t *testing.T) {
+
+	// Test vector 1 from https://github.com/bitcoin/bips/blob/master/bip-0340/test-vectors.csv
+	pubKey, _ := hex.DecodeString("DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659")
+	var digest [32]byte
+	d, _ := hex.DecodeString("243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89")
+	copy(digest[:], d)
+	sig, _ := hex.DecodeString("6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A")
+
+	ok, err := VerifySchnorr(pubKey, digest, sig)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	privateKey, _ := hex.DecodeString("B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF")
+	keypair := KeyPairFromBytes(privateKey)
+	assert.Equal(t, pubKey, keypair.SchnorrPublicKey())
+
+}
+
+func TestVerifySchnorrInvalid(t *testing.T) {
+
+	_, err := VerifySchnorr([]byte{0x01}, [32]byte{}, make([]byte, 64))
+	assert.Regexp(t, "invalid schnorr public key", err)
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	_, err = VerifySchnorr(keypair.SchnorrPublicKey(), [32]byte{}, make([]byte, 63))
+	assert.Regexp(t, "invalid schnorr signature", err)
+
+}
@@ -21,7 +21,7 @@ import (
 	"fmt"
 	"math/big"
 
-	ecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	btcec "github.com/btcsuite/btcd/btcec/v2" // ISC licensed
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-signer/internal/signermsgs"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
@@ -44,49 +44,80 @@ type SignerDirect interface {
 	SignDirect(message []byte) (*SignatureData, error)
 }
 
-// getVNormalized returns the original 27/28 parity
-func (s *SignatureData) getVNormalized(chainID int64) (byte, error) {
-	v := s.V.Int64()
-	var vB byte
-	switch v {
-	case 0, 1:
-		vB = byte(v + 27)
-	case 27, 28:
-		vB = byte(v)
-	default:
-		vB = byte(v - 35 - (chainID * 2) + 27)
+// SignerDigest is implemented by signers that accept a pre-computed 32 byte Keccak-256 digest, such as a
+// remote or HSM signer that cannot be given the full message. Transaction and typed data signing use it
+// in preference to Sign when available, so the payload is only hashed once.
+type SignerDigest interface {
+	Signer
+	SignDigest(digest [32]byte) (*SignatureData, error)
+}
+
+var (
+	big27 = big.NewInt(27)
+	big28 = big.NewInt(28)
+	big35 = big.NewInt(35)
+)
+
+// getVNormalized returns the original 27/28 parity. The V value and chain ID can be any size, as some chains
+// use hash-derived chain IDs that make an EIP-155 V value too large for an int64.
+func (s *SignatureData) getVNormalized(chainID *big.Int) (byte, error) {
+	v := s.V
+	switch {
+	case v.Sign() == 0, v.Cmp(big.NewInt(1)) == 0:
+		return byte(v.Int64() + 27), nil
+	case v.Cmp(big27) == 0, v.Cmp(big28) == 0:
+		return byte(v.Int64()), nil
 	}
-	if vB != 27 && vB != 28 {
-		return 0, fmt.Errorf("invalid V value in signature (chain ID = %d, V = %d)", chainID, v)
+	// EIP-155 V value of (2*ChainID + 35 + Y-parity). A compact 65 byte R,S,V signature only has room for
+	// the low byte of the V value, so that is all that is compared when V is a single byte and it cannot
+	// hold the full value.
+	for parity := int64(0); parity <= 1; parity++ {
+		eip155V := new(big.Int).Lsh(chainID, 1)
+		eip155V.Add(eip155V, big.NewInt(35+parity))
+		if eip155V.Cmp(v) == 0 || (v.BitLen() <= 8 && eip155V.BitLen() > 8 && new(big.Int).And(eip155V, big.NewInt(0xff)).Cmp(v) == 0) {
+			return byte(27 + parity), nil
+		}
 	}
-	return vB, nil
+	return 0, fmt.Errorf("invalid V value in signature (chain ID = %s, V = %s)", chainID, v)
 }
 
 // EIP-155 rules - 2xChainID + 35 - starting point must be legacy 27/28
 func (s *SignatureData) UpdateEIP155(chainID int64) {
-	chainIDx2 := big.NewInt(chainID)
-	chainIDx2 = chainIDx2.Mul(chainIDx2, big.NewInt(2))
-	s.V = s.V.Add(s.V, chainIDx2).Add(s.V, big.NewInt(35-27))
+	s.UpdateEIP155Big(big.NewInt(chainID))
+}
 
+// UpdateEIP155Big is UpdateEIP155 for a chain ID of any size
+func (s *SignatureData) UpdateEIP155Big(chainID *big.Int) {
+	chainIDx2 := new(big.Int).Lsh(chainID, 1)
+	s.V = s.V.Add(s.V, chainIDx2).Add(s.V, big.NewInt(35-27))
 }
 
 // EIP-2930 (/ EIP-1559) rules - 0 or 1 V value for raw Y-parity value (chainID goes into the payload)
 func (s *SignatureData) UpdateEIP2930() {
-	vi64 := s.V.Int64()
-	if vi64 == 27 || vi64 == 28 {
-		s.V = s.V.Sub(s.V, big.NewInt(27))
+	if s.V.Cmp(big27) == 0 || s.V.Cmp(big28) == 0 {
+		s.V = s.V.Sub(s.V, big27)
 	}
 }
 
 // Recover obtains the original signer from the hash of the message
 func (s *SignatureData) Recover(message []byte, chainID int64) (a *ethtypes.Address0xHex, err error) {
+	return s.RecoverBig(message, big.NewInt(chainID))
+}
+
+// RecoverBig is Recover for a chain ID of any size
+func (s *SignatureData) RecoverBig(message []byte, chainID *big.Int) (a *ethtypes.Address0xHex, err error) {
 	msgHash := sha3.NewLegacyKeccak256()
 	msgHash.Write(message)
-	return s.RecoverDirect(msgHash.Sum(nil), chainID)
+	return s.RecoverDirectBig(msgHash.Sum(nil), chainID)
 }
 
 // Recover obtains the original signer
 func (s *SignatureData) RecoverDirect(message []byte, chainID int64) (a *ethtypes.Address0xHex, err error) {
+	return s.RecoverDirectBig(message, big.NewInt(chainID))
+}
+
+// RecoverDirectBig is RecoverDirect for a chain ID of any size
+func (s *SignatureData) RecoverDirectBig(message []byte, chainID *big.Int) (a *ethtypes.Address0xHex, err error) {
 
 	signatureBytes := make([]byte, 65)
 	signatureBytes[0], err = s.getVNormalized(chainID)
@@ -95,13 +126,53 @@ func (s *SignatureData) RecoverDirect(message []byte, chainID int64) (a *ethtype
 	}
 	s.R.FillBytes(signatureBytes[1:33])
 	s.S.FillBytes(signatureBytes[33:65])
-	pubKey, _, err := ecdsa.RecoverCompact(signatureBytes, message) // uses S256() by default
+	pubKey, err := getBackend().recoverCompact(signatureBytes, message)
 	if err != nil {
 		return nil, err
 	}
 	return PublicKeyToAddress(pubKey), nil
 }
 
+// RecoverAny obtains the candidate signers from the hash of the message, ignoring the V value
+func (s *SignatureData) RecoverAny(message []byte) ([]*ethtypes.Address0xHex, error) {
+	msgHash := sha3.NewLegacyKeccak256()
+	msgHash.Write(message)
+	return s.RecoverAnyDirect(msgHash.Sum(nil))
+}
+
+// RecoverAnyDirect recovers the public key with each of the four recovery IDs, ignoring the V value, and returns the
+// distinct addresses of those that succeed. This is for signatures where V is missing or has been mangled upstream,
+// and the caller can match the candidates against a list of known addresses. Usually there are two candidates,
+// as recovery IDs 2 and 3 only apply to the tiny fraction of signatures where R overflowed the curve order.
+func (s *SignatureData) RecoverAnyDirect(message []byte) ([]*ethtypes.Address0xHex, error) {
+	if s.R == nil || s.S == nil || s.R.BitLen() > 256 || s.S.BitLen() > 256 {
+		return nil, fmt.Errorf("invalid R or S value in signature")
+	}
+	signatureBytes := make([]byte, 65)
+	s.R.FillBytes(signatureBytes[1:33])
+	s.S.FillBytes(signatureBytes[33:65])
+	var candidates []*ethtypes.Address0xHex
+	for recoveryID := byte(0); recoveryID < 4; recoveryID++ {
+		signatureBytes[0] = 27 + recoveryID
+		pubKey, err := getBackend().recoverCompact(signatureBytes, message)
+		if err != nil {
+			continue
+		}
+		addr := PublicKeyToAddress(pubKey)
+		duplicate := false
+		for _, c := range candidates {
+			duplicate = duplicate || *c == *addr
+		}
+		if !duplicate {
+			candidates = append(candidates, addr)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no public key could be recovered from the signature")
+	}
+	return candidates, nil
+}
+
 // We use the ethereum convention of R,S,V for compact packing (mentioned because Golang tends to prefer V,R,S)
 func (s *SignatureData) CompactRSV() []byte {
 	signatureBytes := make([]byte, 65)
@@ -122,6 +193,60 @@ func DecodeCompactRSV(ctx context.Context, compactRSV []byte) (*SignatureData, e
 	return &sig, nil
 }
 
+// CompactEIP2098 returns the 64 byte EIP-2098 compact form of the signature, which is R followed by S with the
+// Y-parity folded into the top bit of S. The V value must be a legacy 27/28 or EIP-2930 0/1 value (not EIP-155),
+// and S must be in the lower half of the curve order, as it is for all signatures Ethereum accepts (EIP-2).
+func (s *SignatureData) CompactEIP2098() ([]byte, error) {
+	var yParity uint
+	switch {
+	case s.V.Sign() == 0, s.V.Cmp(big27) == 0:
+		yParity = 0
+	case s.V.Cmp(big.NewInt(1)) == 0, s.V.Cmp(big28) == 0:
+		yParity = 1
+	default:
+		return nil, fmt.Errorf("invalid V value for a compact signature: %s", s.V)
+	}
+	if s.S.Cmp(halfCurveOrder) > 0 {
+		return nil, fmt.Errorf("S value of a compact signature must be in the lower half of the curve order")
+	}
+	yParityAndS := new(big.Int).SetBit(new(big.Int).Set(s.S), 255, yParity)
+	signatureBytes := make([]byte, 64)
+	s.R.FillBytes(signatureBytes[0:32])
+	yParityAndS.FillBytes(signatureBytes[32:64])
+	return signatureBytes, nil
+}
+
+// DecodeCompactEIP2098 decodes a 64 byte EIP-2098 compact signature, returning it with a legacy 27/28 V value
+func DecodeCompactEIP2098(ctx context.Context, compact []byte) (*SignatureData, error) {
+	if len(compact) != 64 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgSigningInvalidEIP2098, len(compact))
+	}
+	yParityAndS := new(big.Int).SetBytes(compact[32:64])
+	var sig SignatureData
+	sig.R = new(big.Int).SetBytes(compact[0:32])
+	sig.V = big.NewInt(27 + int64(yParityAndS.Bit(255)))
+	sig.S = yParityAndS.SetBit(yParityAndS, 255, 0)
+	return &sig, nil
+}
+
+// NewSignatureFromRS completes a signature from a signer that only returns R and S (such as an HSM, or a
+// cloud key management service) with the legacy 27/28 V that recovers to the address of the signing key.
+// S is normalized to the lower half of the curve order, as Ethereum requires (EIP-2), unless disabled with
+// SetLowSNormalization. Returns false if neither V recovers to the address.
+func NewSignatureFromRS(hash []byte, r, s *big.Int, addr ethtypes.Address0xHex) (*SignatureData, bool) {
+	lowS := new(big.Int).Set(s)
+	if LowSNormalization() && lowS.Cmp(halfCurveOrder) > 0 {
+		lowS.Sub(btcec.S256().N, lowS)
+	}
+	for _, v := range []int64{27, 28} {
+		sig := &SignatureData{V: big.NewInt(v), R: new(big.Int).Set(r), S: lowS}
+		if recovered, err := sig.RecoverDirect(hash, 0); err == nil && *recovered == addr {
+			return sig, true
+		}
+	}
+	return nil, false
+}
+
 // Sign hashes the input then signs it
 func (k *KeyPair) Sign(message []byte) (ethSig *SignatureData, err error) {
 	msgHash := sha3.NewLegacyKeccak256()
@@ -130,12 +255,17 @@ func (k *KeyPair) Sign(message []byte) (ethSig *SignatureData, err error) {
 	return k.SignDirect(hashed)
 }
 
+// SignDigest signs a pre-computed 32 byte digest - give legacy 27/28 V values
+func (k *KeyPair) SignDigest(digest [32]byte) (*SignatureData, error) {
+	return k.SignDirect(digest[:])
+}
+
 // SignDirect performs raw signing - give legacy 27/28 V values
 func (k *KeyPair) SignDirect(message []byte) (ethSig *SignatureData, err error) {
-	if k == nil {
-		return nil, fmt.Errorf("nil signer")
+	if err := k.checkUsable(); err != nil {
+		return nil, err
 	}
-	sig, err := ecdsa.SignCompact(k.PrivateKey, message, false) // uses S256() by default
+	sig, err := getBackend().signCompact(k.PrivateKey, message)
 	if err == nil {
 		// btcec does all the hard work for us. However, the interface of btcec is such
 		// that we need to unpack the result for Ethereum encoding.
@@ -18,12 +18,16 @@ package secp256k1
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
+	"math/big"
 	"strconv"
 	"testing"
 
+	btcec "github.com/btcsuite/btcd/btcec/v2"
 	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/sha3"
 )
 
 const ethMessagePrefix = "\u0019Ethereum Signed Message:\n"
@@ -78,9 +82,192 @@ func TestSignMessage(t *testing.T) {
 	assert.Equal(t, int64(2038), sig.V.Int64())
 }
 
+func TestSignDigest(t *testing.T) {
+
+	keypair := testKeyPair(t)
+	var digest [32]byte
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(addEthMessagePrefix([]byte(sampleMessage)))
+	copy(digest[:], hash.Sum(nil))
+
+	var signer SignerDigest = keypair
+	sig, err := signer.SignDigest(digest)
+	assert.NoError(t, err)
+	sigMsg, err := keypair.Sign(addEthMessagePrefix([]byte(sampleMessage)))
+	assert.NoError(t, err)
+	assert.Equal(t, sigMsg, sig)
+
+	_, err = (*KeyPair)(nil).SignDigest(digest)
+	assert.Regexp(t, "nil signer", err)
+}
+
 func TestSignFailNil(t *testing.T) {
 
 	_, err := (*KeyPair)(nil).Sign(addEthMessagePrefix([]byte(sampleMessage)))
 	assert.Regexp(t, "nil signer", err)
 
 }
+
+func TestNewSignatureFromRS(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte("hello world"))
+	digest := hash.Sum(nil)
+	sig, err := keypair.SignDirect(digest)
+	assert.NoError(t, err)
+
+	rebuilt, ok := NewSignatureFromRS(digest, sig.R, sig.S, keypair.Address)
+	assert.True(t, ok)
+	assert.Equal(t, sig.CompactRSV(), rebuilt.CompactRSV())
+
+	// The high S form of the same signature is normalized
+	highS := new(big.Int).Sub(btcec.S256().N, sig.S)
+	rebuilt, ok = NewSignatureFromRS(digest, sig.R, highS, keypair.Address)
+	assert.True(t, ok)
+	assert.Equal(t, sig.CompactRSV(), rebuilt.CompactRSV())
+
+	otherKey, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	_, ok = NewSignatureFromRS(digest, sig.R, sig.S, otherKey.Address)
+	assert.False(t, ok)
+
+}
+
+func TestRecoverLargeChainID(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	data := []byte("hello world")
+
+	// A chain ID where the EIP-155 V value does not fit in an int64
+	chainID := new(big.Int).Lsh(big.NewInt(1), 64)
+	sig, err := keypair.Sign(data)
+	assert.NoError(t, err)
+	sig.UpdateEIP155Big(chainID)
+	assert.False(t, sig.V.IsInt64())
+
+	addr, err := sig.RecoverBig(data, chainID)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, *addr)
+
+	_, err = sig.RecoverBig(data, new(big.Int).Add(chainID, big.NewInt(1)))
+	assert.Regexp(t, "invalid V value in signature", err)
+
+}
+
+func TestRecoverRejectsWrappedV(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	data := []byte("hello world")
+
+	sig, err := keypair.Sign(data)
+	assert.NoError(t, err)
+	sig.UpdateEIP155(1)
+
+	// A V value that only matches the EIP-155 V value in its low byte
+	sig.V.Add(sig.V, big.NewInt(256))
+	_, err = sig.Recover(data, 1)
+	assert.Regexp(t, "invalid V value in signature", err)
+
+}
+
+func TestCompactEIP2098(t *testing.T) {
+
+	// Test vectors from https://eips.ethereum.org/EIPS/eip-2098
+	keypair := KeyPairFromBytes(ethtypes.MustNewHexBytes0xPrefix("0x1234567890123456789012345678901234567890123456789012345678901234"))
+	sig, err := keypair.Sign(addEthMessagePrefix([]byte("Hello World")))
+	assert.NoError(t, err)
+	compact, err := sig.CompactEIP2098()
+	assert.NoError(t, err)
+	assert.Equal(t, "68a020a209d3d56c46f38cc50a33f704f4a9a10a59377f8dd762ac66910e9b90"+
+		"7e865ad05c4035ab5792787d4a0297a43617ae897930a6fe4d822b8faea52064", hex.EncodeToString(compact))
+
+	for _, v := range []struct {
+		compact string
+		r, s    string
+		v       int64
+	}{
+		{
+			compact: "68a020a209d3d56c46f38cc50a33f704f4a9a10a59377f8dd762ac66910e9b90" +
+				"7e865ad05c4035ab5792787d4a0297a43617ae897930a6fe4d822b8faea52064",
+			r: "68a020a209d3d56c46f38cc50a33f704f4a9a10a59377f8dd762ac66910e9b90",
+			s: "7e865ad05c4035ab5792787d4a0297a43617ae897930a6fe4d822b8faea52064",
+			v: 27,
+		},
+		{
+			compact: "9328da16089fcba9bececa81663203989f2df5fe1faa6291a45381c81bd17f76" +
+				"939c6d6b623b42da56557e5e734a43dc83345ddfadec52cbe24d0cc64f550793",
+			r: "9328da16089fcba9bececa81663203989f2df5fe1faa6291a45381c81bd17f76",
+			s: "139c6d6b623b42da56557e5e734a43dc83345ddfadec52cbe24d0cc64f550793",
+			v: 28,
+		},
+	} {
+		b, _ := hex.DecodeString(v.compact)
+		sig, err := DecodeCompactEIP2098(context.Background(), b)
+		assert.NoError(t, err)
+		assert.Equal(t, v.r, hex.EncodeToString(sig.R.Bytes()))
+		assert.Equal(t, v.s, hex.EncodeToString(sig.S.Bytes()))
+		assert.Equal(t, v.v, sig.V.Int64())
+
+		// 0/1 Y-parity values encode the same
+		sig.UpdateEIP2930()
+		compact, err := sig.CompactEIP2098()
+		assert.NoError(t, err)
+		assert.Equal(t, b, compact)
+	}
+
+	recovered, err := sig.Recover(addEthMessagePrefix([]byte("Hello World")), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.Address, *recovered)
+
+}
+
+func TestCompactEIP2098Errors(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	sig, err := keypair.Sign([]byte("hello world"))
+	assert.NoError(t, err)
+
+	sig.UpdateEIP155(1)
+	_, err = sig.CompactEIP2098()
+	assert.Regexp(t, "invalid V value", err)
+
+	sig, err = keypair.Sign([]byte("hello world"))
+	assert.NoError(t, err)
+	sig.S = new(big.Int).Sub(btcec.S256().N, sig.S)
+	_, err = sig.CompactEIP2098()
+	assert.Regexp(t, "lower half of the curve order", err)
+
+	_, err = DecodeCompactEIP2098(context.Background(), make([]byte, 65))
+	assert.Regexp(t, "FF22240", err)
+
+}
+
+func TestRecoverAny(t *testing.T) {
+
+	keypair, err := GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	sig, err := keypair.Sign([]byte("hello world"))
+	assert.NoError(t, err)
+
+	// The V value is ignored
+	sig.V = nil
+	candidates, err := sig.RecoverAny([]byte("hello world"))
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 2)
+	assert.Contains(t, candidates, &keypair.Address)
+
+	_, err = (&SignatureData{R: big.NewInt(0), S: big.NewInt(1)}).RecoverAny([]byte("hello world"))
+	assert.Regexp(t, "no public key could be recovered", err)
+
+	_, err = (&SignatureData{R: new(big.Int).Lsh(big.NewInt(1), 256), S: big.NewInt(1)}).RecoverAny([]byte("hello world"))
+	assert.Regexp(t, "invalid R or S value", err)
+
+	_, err = (&SignatureData{}).RecoverAny([]byte("hello world"))
+	assert.Regexp(t, "invalid R or S value", err)
+
+}
@@ -0,0 +1,263 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signer embeds the FireFly signer in another Go service: the JSON/RPC proxy server with its wallet
+// (New), or just the wallet (NewWallet), built from the same configuration as the ffsigner binary.
+//
+// The configuration is held globally for the process, so only one signer can be configured at a time.
+package signer
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/rpcserver"
+	"github.com/hyperledger/firefly-signer/internal/selftest"
+	"github.com/hyperledger/firefly-signer/internal/signerconfig"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/azurewallet"
+	"github.com/hyperledger/firefly-signer/pkg/clefwallet"
+	"github.com/hyperledger/firefly-signer/pkg/compositewallet"
+	"github.com/hyperledger/firefly-signer/pkg/dbwallet"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/hyperledger/firefly-signer/pkg/k8swallet"
+	"github.com/hyperledger/firefly-signer/pkg/pkcs11wallet"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/hyperledger/firefly-signer/pkg/signhook"
+	"github.com/hyperledger/firefly-signer/pkg/usbwallet"
+	"github.com/hyperledger/firefly-signer/pkg/vaultwallet"
+	"github.com/hyperledger/firefly-signer/pkg/web3signerwallet"
+)
+
+// Signer is the JSON/RPC proxy server, and the wallet it signs with
+type Signer interface {
+	// Wallet returns the wallet the server signs with
+	Wallet() ethsigner.WalletTypedData
+	// Start starts the server, after initializing the wallet
+	Start() error
+	// Stop stops the server
+	Stop()
+	// WaitStop waits for the server to stop, returning any error that caused it to stop
+	WaitStop() error
+}
+
+// Option configures the signer
+type Option func(o *options)
+
+type configValue struct {
+	key   string
+	value interface{}
+}
+
+type options struct {
+	configFile    string
+	configValues  []configValue
+	wallet        ethsigner.WalletTypedData
+	postSignHooks []*signhook.Registration
+}
+
+// WithConfigFile reads the configuration from a YAML file, with the same format as the ffsigner binary
+func WithConfigFile(file string) Option {
+	return func(o *options) {
+		o.configFile = file
+	}
+}
+
+// WithConfig sets a configuration key (such as "server.address" or "fileWallet.path"), in place of any
+// value in the configuration file
+func WithConfig(key string, value interface{}) Option {
+	return func(o *options) {
+		o.configValues = append(o.configValues, configValue{key: key, value: value})
+	}
+}
+
+// WithWallet signs with the supplied wallet, in place of the wallet enabled in the configuration
+func WithWallet(wallet ethsigner.WalletTypedData) Option {
+	return func(o *options) {
+		o.wallet = wallet
+	}
+}
+
+// WithPostSignHook invokes the hook for each transaction signed for eth_sendTransaction that the policy selects
+// (every transaction, if nil), before it is submitted. Hooks are invoked in the order they are added.
+func WithPostSignHook(name string, hook signhook.PostSignHook, policy *signhook.Policy) Option {
+	return func(o *options) {
+		o.postSignHooks = append(o.postSignHooks, &signhook.Registration{Name: name, Hook: hook, Policy: policy})
+	}
+}
+
+type signer struct {
+	rpcserver.Server
+	wallet ethsigner.WalletTypedData
+}
+
+// New builds the JSON/RPC proxy server, with the wallet enabled in the configuration (or supplied with WithWallet).
+// The configuration is reset to its defaults before the options are applied.
+func New(ctx context.Context, opts ...Option) (Signer, error) {
+	o, err := loadConfig(opts)
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgConfigFailed)
+	}
+	wallet := o.wallet
+	if wallet == nil {
+		if wallet, err = NewWalletFromConfig(ctx); err != nil {
+			return nil, err
+		}
+	}
+	server, err := rpcserver.NewServer(ctx, wallet, o.postSignHooks...)
+	if err != nil {
+		return nil, err
+	}
+	return &signer{Server: server, wallet: wallet}, nil
+}
+
+// NewWallet builds just the signing core - the wallet enabled in the configuration, which the caller must
+// Initialize before use. The configuration is reset to its defaults before the options are applied.
+func NewWallet(ctx context.Context, opts ...Option) (ethsigner.WalletTypedData, error) {
+	if _, err := loadConfig(opts); err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgConfigFailed)
+	}
+	return NewWalletFromConfig(ctx)
+}
+
+// NewWalletFromConfig creates the enabled wallet from the configuration that has already been read, after
+// selecting the crypto backend and low-S normalization (and checking the backend with the self-test, if enabled)
+func NewWalletFromConfig(ctx context.Context) (ethsigner.WalletTypedData, error) {
+	if err := secp256k1.SelectBackend(ctx, config.GetString(signerconfig.CryptoSecp256k1Backend)); err != nil {
+		return nil, err
+	}
+	secp256k1.SetLowSNormalization(config.GetBool(signerconfig.CryptoLowS))
+	if config.GetBool(signerconfig.SelfTestEnabled) {
+		if err := selftest.Run(ctx, config.GetString(signerconfig.SelfTestOnFailure)); err != nil {
+			return nil, err
+		}
+	}
+	var enabled []string
+	for _, w := range []struct {
+		name    string
+		enabled config.RootKey
+	}{
+		{name: walletFile, enabled: signerconfig.FileWalletEnabled},
+		{name: walletVault, enabled: signerconfig.VaultWalletEnabled},
+		{name: walletAzure, enabled: signerconfig.AzureWalletEnabled},
+		{name: walletPKCS11, enabled: signerconfig.PKCS11WalletEnabled},
+		{name: walletWeb3Signer, enabled: signerconfig.Web3SignerWalletEnabled},
+		{name: walletClef, enabled: signerconfig.ClefWalletEnabled},
+		{name: walletDB, enabled: signerconfig.DBWalletEnabled},
+		{name: walletUSB, enabled: signerconfig.USBWalletEnabled},
+		{name: walletK8s, enabled: signerconfig.K8sWalletEnabled},
+	} {
+		if config.GetBool(w.enabled) {
+			enabled = append(enabled, w.name)
+		}
+	}
+	switch {
+	case len(enabled) == 0:
+		return nil, i18n.NewError(ctx, signermsgs.MsgNoWalletEnabled)
+	case config.GetBool(signerconfig.CompositeWalletEnabled):
+		members := make([]*compositewallet.Member, len(enabled))
+		for i, name := range enabled {
+			wallet, err := newWallet(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			members[i] = &compositewallet.Member{Name: name, Wallet: wallet}
+		}
+		return compositewallet.NewCompositeWallet(ctx, compositewallet.ReadConfig(signerconfig.CompositeWalletConfig), members...)
+	case len(enabled) > 1:
+		return nil, i18n.NewError(ctx, signermsgs.MsgMultipleWalletsEnabled)
+	default:
+		return newWallet(ctx, enabled[0])
+	}
+}
+
+const (
+	walletFile       = "fileWallet"
+	walletVault      = "vaultWallet"
+	walletAzure      = "azureWallet"
+	walletPKCS11     = "pkcs11Wallet"
+	walletWeb3Signer = "web3SignerWallet"
+	walletClef       = "clefWallet"
+	walletDB         = "dbWallet"
+	walletUSB        = "usbWallet"
+	walletK8s        = "k8sWallet"
+)
+
+func newWallet(ctx context.Context, name string) (ethsigner.WalletTypedData, error) {
+	switch name {
+	case walletAzure:
+		conf, err := azurewallet.ReadConfig(ctx, signerconfig.AzureWalletConfig)
+		if err != nil {
+			return nil, err
+		}
+		return azurewallet.NewAzureWallet(ctx, conf)
+	case walletPKCS11:
+		return pkcs11wallet.NewPKCS11Wallet(ctx, pkcs11wallet.ReadConfig(signerconfig.PKCS11WalletConfig))
+	case walletWeb3Signer:
+		conf, err := web3signerwallet.ReadConfig(ctx, signerconfig.Web3SignerWalletConfig)
+		if err != nil {
+			return nil, err
+		}
+		return web3signerwallet.NewWeb3SignerWallet(ctx, conf)
+	case walletClef:
+		conf, err := clefwallet.ReadConfig(ctx, signerconfig.ClefWalletConfig)
+		if err != nil {
+			return nil, err
+		}
+		return clefwallet.NewClefWallet(ctx, conf)
+	case walletDB:
+		return dbwallet.NewDBWallet(ctx, dbwallet.ReadConfig(signerconfig.DBWalletConfig))
+	case walletUSB:
+		return usbwallet.NewUSBWallet(ctx, usbwallet.ReadConfig(signerconfig.USBWalletConfig))
+	case walletK8s:
+		conf, err := k8swallet.ReadConfig(ctx, signerconfig.K8sWalletConfig)
+		if err != nil {
+			return nil, err
+		}
+		return k8swallet.NewK8sWallet(ctx, conf)
+	case walletVault:
+		conf, err := vaultwallet.ReadConfig(ctx, signerconfig.VaultWalletConfig)
+		if err != nil {
+			return nil, err
+		}
+		return vaultwallet.NewVaultWallet(ctx, conf)
+	default:
+		return fswallet.NewFilesystemWallet(ctx, fswallet.ReadConfig(signerconfig.FileWalletConfig))
+	}
+}
+
+func loadConfig(opts []Option) (*options, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	signerconfig.Reset()
+	if o.configFile != "" {
+		if err := config.ReadConfig("ffsigner", o.configFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, cv := range o.configValues {
+		config.Set(config.RootKey(cv.key), cv.value)
+	}
+	return o, nil
+}
+
+func (s *signer) Wallet() ethsigner.WalletTypedData {
+	return s.wallet
+}
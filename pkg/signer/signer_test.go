@@ -0,0 +1,355 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/mocks/ethsignermocks"
+	"github.com/hyperledger/firefly-signer/pkg/clefwallet"
+	"github.com/hyperledger/firefly-signer/pkg/compositewallet"
+	"github.com/hyperledger/firefly-signer/pkg/dbwallet"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/fswallet"
+	"github.com/hyperledger/firefly-signer/pkg/k8swallet"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/hyperledger/firefly-signer/pkg/signhook"
+	"github.com/hyperledger/firefly-signer/pkg/usbwallet"
+	"github.com/hyperledger/firefly-signer/pkg/vaultwallet"
+	"github.com/hyperledger/firefly-signer/pkg/web3signerwallet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewStartStop(t *testing.T) {
+
+	ctx := context.Background()
+	s, err := New(ctx,
+		WithConfigFile("../../test/firefly.ffsigner.yaml"),
+		WithConfig("fileWallet.path", "../../test/keystore_toml"),
+		WithConfig("server.address", "127.0.0.1"),
+		WithConfig("server.port", 0),
+	)
+	assert.NoError(t, err)
+	assert.Implements(t, (*fswallet.Wallet)(nil), s.Wallet())
+
+	err = s.Start()
+	assert.NoError(t, err)
+
+	accounts, err := s.Wallet().GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, accounts, ethtypes.MustNewAddress("0x1f185718734552d08278aa70f804580bab5fd2b4"))
+
+	s.Stop()
+	err = s.WaitStop()
+	assert.NoError(t, err)
+
+}
+
+func TestNewWithWallet(t *testing.T) {
+
+	w := &ethsignermocks.WalletTypedData{}
+	w.On("Initialize", mock.Anything).Return(nil)
+
+	s, err := New(context.Background(),
+		WithWallet(w),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("backend.chainId", 0),
+		WithConfig("server.address", "127.0.0.1"),
+		WithConfig("server.port", 0),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, w, s.Wallet())
+
+	err = s.Start()
+	assert.NoError(t, err)
+	s.Stop()
+	err = s.WaitStop()
+	assert.NoError(t, err)
+
+	w.AssertExpectations(t)
+
+}
+
+func TestWithPostSignHook(t *testing.T) {
+
+	policy := &signhook.Policy{ChainIDs: []int64{1}}
+	o, err := loadConfig([]Option{
+		WithPostSignHook("relay", nil, policy),
+		WithPostSignHook("broadcast", nil, nil),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, o.postSignHooks, 2)
+	assert.Equal(t, "relay", o.postSignHooks[0].Name)
+	assert.Equal(t, policy, o.postSignHooks[0].Policy)
+	assert.Equal(t, "broadcast", o.postSignHooks[1].Name)
+
+}
+
+func TestNewBadConfigFile(t *testing.T) {
+
+	_, err := New(context.Background(), WithConfigFile("../../test/bad-config.ffsigner.yaml"))
+	assert.Regexp(t, "FF00101", err)
+
+	_, err = NewWallet(context.Background(), WithConfigFile("../../test/bad-config.ffsigner.yaml"))
+	assert.Regexp(t, "FF00101", err)
+
+}
+
+func TestNewNoWallet(t *testing.T) {
+
+	_, err := New(context.Background(), WithConfig("fileWallet.enabled", false))
+	assert.Regexp(t, "FF22017", err)
+
+}
+
+func TestNewBadServerConfig(t *testing.T) {
+
+	_, err := New(context.Background(), WithConfig("server.jsonCodec", "wrong"))
+	assert.Error(t, err)
+
+}
+
+func TestNewWalletVault(t *testing.T) {
+
+	w, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("vaultWallet.enabled", true),
+		WithConfig("vaultWallet.url", "http://localhost:8200"),
+	)
+	assert.NoError(t, err)
+	assert.Implements(t, (*vaultwallet.Wallet)(nil), w)
+	assert.NoError(t, w.Close())
+
+}
+
+func TestNewWalletAzure(t *testing.T) {
+
+	w, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("azureWallet.enabled", true),
+		WithConfig("azureWallet.url", "https://myvault.vault.azure.net"),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+}
+
+func TestNewWalletAzureBadConfig(t *testing.T) {
+
+	_, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("azureWallet.enabled", true),
+		WithConfig("azureWallet.tls.enabled", true),
+		WithConfig("azureWallet.tls.caFile", "!!!"),
+	)
+	assert.Error(t, err)
+
+}
+
+func TestNewWalletWeb3Signer(t *testing.T) {
+
+	w, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("web3SignerWallet.enabled", true),
+		WithConfig("web3SignerWallet.url", "http://localhost:9000"),
+	)
+	assert.NoError(t, err)
+	assert.Implements(t, (*web3signerwallet.Wallet)(nil), w)
+	assert.NoError(t, w.Close())
+
+	_, err = NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("web3SignerWallet.enabled", true),
+		WithConfig("web3SignerWallet.tls.enabled", true),
+		WithConfig("web3SignerWallet.tls.caFile", "!!!"),
+	)
+	assert.Error(t, err)
+
+}
+
+func TestNewWalletClef(t *testing.T) {
+
+	w, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("clefWallet.enabled", true),
+		WithConfig("clefWallet.ipcPath", "/tmp/clef.ipc"),
+	)
+	assert.NoError(t, err)
+	assert.Implements(t, (*clefwallet.Wallet)(nil), w)
+	assert.NoError(t, w.Close())
+
+	_, err = NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("clefWallet.enabled", true),
+		WithConfig("clefWallet.tls.enabled", true),
+		WithConfig("clefWallet.tls.caFile", "!!!"),
+	)
+	assert.Error(t, err)
+
+}
+
+func TestNewWalletUSB(t *testing.T) {
+
+	w, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("usbWallet.enabled", true),
+		WithConfig("usbWallet.driver", "trezor"),
+	)
+	assert.NoError(t, err)
+	assert.Implements(t, (*usbwallet.Wallet)(nil), w)
+	assert.NoError(t, w.Close())
+
+	_, err = NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("usbWallet.enabled", true),
+		WithConfig("usbWallet.driver", "wrong"),
+	)
+	assert.Regexp(t, "FF22201", err)
+
+}
+
+func TestNewWalletK8s(t *testing.T) {
+
+	w, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("k8sWallet.enabled", true),
+		WithConfig("k8sWallet.source", "volume"),
+		WithConfig("k8sWallet.path", t.TempDir()),
+	)
+	assert.NoError(t, err)
+	assert.Implements(t, (*k8swallet.Wallet)(nil), w)
+	assert.NoError(t, w.Close())
+
+	_, err = NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("k8sWallet.enabled", true),
+		WithConfig("k8sWallet.source", "wrong"),
+	)
+	assert.Regexp(t, "FF22214", err)
+
+}
+
+func TestNewWalletDB(t *testing.T) {
+
+	w, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("dbWallet.enabled", true),
+		WithConfig("dbWallet.url", "postgres://localhost:5432/signer"),
+	)
+	assert.NoError(t, err)
+	assert.Implements(t, (*dbwallet.Wallet)(nil), w)
+	assert.NoError(t, w.Close())
+
+	_, err = NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("dbWallet.enabled", true),
+		WithConfig("dbWallet.table", "bad table"),
+	)
+	assert.Regexp(t, "FF22187", err)
+
+}
+
+func TestNewWalletPKCS11NotSupported(t *testing.T) {
+
+	_, err := NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("pkcs11Wallet.enabled", true),
+		WithConfig("pkcs11Wallet.library", "/usr/lib/softhsm/libsofthsm2.so"),
+	)
+	assert.Regexp(t, "FF22164", err)
+
+}
+
+func TestNewWalletMultipleWallets(t *testing.T) {
+
+	_, err := NewWallet(context.Background(), WithConfig("vaultWallet.enabled", true))
+	assert.Regexp(t, "FF22155", err)
+
+	_, err = NewWallet(context.Background(),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("vaultWallet.enabled", true),
+		WithConfig("azureWallet.enabled", true),
+	)
+	assert.Regexp(t, "FF22155", err)
+
+}
+
+func TestNewWalletComposite(t *testing.T) {
+
+	w, err := NewWallet(context.Background(),
+		WithConfig("compositeWallet.enabled", true),
+		WithConfig("compositeWallet.precedence", []string{"vaultWallet"}),
+		WithConfig("vaultWallet.enabled", true),
+		WithConfig("vaultWallet.url", "http://localhost:8200"),
+	)
+	assert.NoError(t, err)
+	members := w.(compositewallet.Wallet).Members()
+	assert.Len(t, members, 2)
+	assert.Equal(t, "vaultWallet", members[0].Name)
+	assert.Implements(t, (*vaultwallet.Wallet)(nil), members[0].Wallet)
+	assert.Equal(t, "fileWallet", members[1].Name)
+	assert.Implements(t, (*fswallet.Wallet)(nil), members[1].Wallet)
+	assert.NoError(t, w.Close())
+
+}
+
+func TestNewWalletCompositeBadConfig(t *testing.T) {
+
+	_, err := NewWallet(context.Background(),
+		WithConfig("compositeWallet.enabled", true),
+		WithConfig("fileWallet.enabled", false),
+		WithConfig("azureWallet.enabled", true),
+		WithConfig("azureWallet.tls.enabled", true),
+		WithConfig("azureWallet.tls.caFile", "!!!"),
+	)
+	assert.Error(t, err)
+
+	_, err = NewWallet(context.Background(),
+		WithConfig("compositeWallet.enabled", true),
+		WithConfig("compositeWallet.precedence", []string{"vaultWallet"}),
+	)
+	assert.Regexp(t, "FF22176", err)
+
+}
+
+func TestNewWalletBadCryptoBackend(t *testing.T) {
+
+	_, err := NewWallet(context.Background(), WithConfig("crypto.secp256k1Backend", "wrong"))
+	assert.Regexp(t, "FF22093", err)
+
+}
+
+func TestNewWalletSelfTest(t *testing.T) {
+
+	_, err := NewWallet(context.Background(),
+		WithConfig("selfTest.enabled", true),
+		WithConfig("selfTest.onFailure", "ignore"),
+	)
+	assert.Regexp(t, "FF22157", err)
+
+}
+
+func TestNewWalletLowSDisabled(t *testing.T) {
+
+	defer secp256k1.SetLowSNormalization(true)
+	_, err := NewWallet(context.Background(), WithConfig("crypto.lowS", false))
+	assert.NoError(t, err)
+	assert.False(t, secp256k1.LowSNormalization())
+
+}
@@ -0,0 +1,112 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signhook defines the hooks the JSON/RPC server invokes for each transaction it signs for
+// eth_sendTransaction, after signing and before submitting it to the node - such as to send it to a private
+// (MEV-protect) relay or a bundler in place of the node, or to broadcast it to additional endpoints.
+package signhook
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+// Result is what a hook did with the signed transaction
+type Result int
+
+const (
+	// Continue invokes the next hook, and then submits the transaction to the node
+	Continue Result = iota
+	// Submitted means the hook has submitted the transaction itself, so no further hooks are invoked and it
+	// is not submitted to the node. The transaction hash is returned to the client.
+	Submitted
+)
+
+const (
+	// SubmissionPrivate is requested by a client for a transaction that must not be sent to the public mempool
+	SubmissionPrivate = "private"
+	// SubmissionPublic is requested by a client for a transaction that must be sent to the node as normal
+	SubmissionPublic = "public"
+)
+
+// SignedTransaction is a transaction signed for eth_sendTransaction, with its nonce assigned
+type SignedTransaction struct {
+	From        ethtypes.Address0xHex
+	ChainID     *big.Int
+	Transaction *ethsigner.Transaction
+	Raw         ethtypes.HexBytes0xPrefix
+	Hash        ethtypes.HexBytes0xPrefix
+	// Submission is the submission option of the request (SubmissionPrivate or SubmissionPublic), or empty if not set
+	Submission string
+}
+
+// PostSignHook is invoked with each signed transaction its policy selects. An error fails the request,
+// without submitting the transaction.
+type PostSignHook interface {
+	PostSign(ctx context.Context, signed *SignedTransaction) (Result, error)
+}
+
+// Policy selects the transactions a hook is invoked for. Each list that is not empty must contain the value
+// from the transaction - so a policy with only To set selects transactions to those addresses, from any address.
+type Policy struct {
+	From     []ethtypes.Address0xHex
+	To       []ethtypes.Address0xHex
+	ChainIDs []int64
+}
+
+// Registration is a named hook, and the policy selecting the transactions it is invoked for (nil for all)
+type Registration struct {
+	Name   string
+	Hook   PostSignHook
+	Policy *Policy
+}
+
+// Selects returns true if the policy selects the transaction
+func (p *Policy) Selects(signed *SignedTransaction) bool {
+	if p == nil {
+		return true
+	}
+	if len(p.From) > 0 && !containsAddress(p.From, &signed.From) {
+		return false
+	}
+	if len(p.To) > 0 && !containsAddress(p.To, signed.Transaction.To) {
+		return false
+	}
+	if len(p.ChainIDs) > 0 {
+		for _, chainID := range p.ChainIDs {
+			if signed.ChainID.Cmp(big.NewInt(chainID)) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsAddress(list []ethtypes.Address0xHex, addr *ethtypes.Address0xHex) bool {
+	if addr == nil {
+		return false
+	}
+	for _, a := range list {
+		if a == *addr {
+			return true
+		}
+	}
+	return false
+}
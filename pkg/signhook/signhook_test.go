@@ -0,0 +1,54 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signhook
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicySelects(t *testing.T) {
+
+	addr1 := *ethtypes.MustNewAddress("0xfb075bb99f2aa4c49955bf703509a227d7a12248")
+	addr2 := *ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20")
+	signed := &SignedTransaction{
+		From:        addr1,
+		ChainID:     big.NewInt(1),
+		Transaction: &ethsigner.Transaction{To: &addr2},
+	}
+	deploy := &SignedTransaction{
+		From:        addr1,
+		ChainID:     big.NewInt(1),
+		Transaction: &ethsigner.Transaction{},
+	}
+
+	var nilPolicy *Policy
+	assert.True(t, nilPolicy.Selects(signed))
+	assert.True(t, (&Policy{}).Selects(signed))
+	assert.True(t, (&Policy{From: []ethtypes.Address0xHex{addr2, addr1}}).Selects(signed))
+	assert.False(t, (&Policy{From: []ethtypes.Address0xHex{addr2}}).Selects(signed))
+	assert.True(t, (&Policy{To: []ethtypes.Address0xHex{addr2}}).Selects(signed))
+	assert.False(t, (&Policy{To: []ethtypes.Address0xHex{addr1}}).Selects(signed))
+	assert.False(t, (&Policy{To: []ethtypes.Address0xHex{addr2}}).Selects(deploy))
+	assert.True(t, (&Policy{ChainIDs: []int64{5, 1}}).Selects(signed))
+	assert.False(t, (&Policy{From: []ethtypes.Address0xHex{addr1}, ChainIDs: []int64{5}}).Selects(signed))
+
+}
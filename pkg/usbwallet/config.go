@@ -0,0 +1,73 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usbwallet
+
+import (
+	"github.com/hyperledger/firefly-common/pkg/config"
+)
+
+const (
+	// DriverLedger a Ledger Nano device, running the Ethereum app
+	DriverLedger = "ledger"
+	// DriverTrezor a Trezor One or Trezor Model T device
+	DriverTrezor = "trezor"
+)
+
+const (
+	// ConfigDriver the type of device - supported: ledger / trezor
+	ConfigDriver = "driver"
+	// ConfigDevicePath the USB path of the device to use, if more than one device of the type is connected
+	ConfigDevicePath = "devicePath"
+	// ConfigDerivationPaths the BIP-32 derivation paths of the accounts to use from the device
+	ConfigDerivationPaths = "derivationPaths"
+	// ConfigDiscoveryBasePath the BIP-32 path under which accounts are enumerated by index, in addition to the derivationPaths
+	ConfigDiscoveryBasePath = "discovery.basePath"
+	// ConfigDiscoveryCount the number of accounts to enumerate under the discovery base path
+	ConfigDiscoveryCount = "discovery.count"
+)
+
+type Config struct {
+	Driver          string
+	DevicePath      string
+	DerivationPaths []string
+	Discovery       DiscoveryConfig
+}
+
+type DiscoveryConfig struct {
+	BasePath string
+	Count    int
+}
+
+func InitConfig(section config.Section) {
+	section.AddKnownKey(ConfigDriver, DriverLedger)
+	section.AddKnownKey(ConfigDevicePath)
+	section.AddKnownKey(ConfigDerivationPaths, []string{"m/44'/60'/0'/0/0"})
+	section.AddKnownKey(ConfigDiscoveryBasePath, "m/44'/60'/0'/0")
+	section.AddKnownKey(ConfigDiscoveryCount, 0)
+}
+
+func ReadConfig(section config.Section) *Config {
+	return &Config{
+		Driver:          section.GetString(ConfigDriver),
+		DevicePath:      section.GetString(ConfigDevicePath),
+		DerivationPaths: section.GetStringSlice(ConfigDerivationPaths),
+		Discovery: DiscoveryConfig{
+			BasePath: section.GetString(ConfigDiscoveryBasePath),
+			Count:    section.GetInt(ConfigDiscoveryCount),
+		},
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usbwallet
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+)
+
+// usbID identifies a type of device on the USB bus. A product ID of zero matches any product of the vendor.
+type usbID struct {
+	vendorID  uint16
+	productID uint16
+}
+
+// device is an open USB HID (or WebUSB) device, exchanging 64 byte reports
+type device interface {
+	io.ReadWriteCloser
+}
+
+// deviceInfo is a device found on the USB bus, that can be opened
+type deviceInfo struct {
+	path string
+	open func() (device, error)
+}
+
+// enumerateDevices is replaced when the USB binding is compiled in. The binding to hidapi and libusb
+// requires cgo, so it is only compiled in with -tags usb.
+var enumerateDevices = func(ctx context.Context, _ []usbID) ([]*deviceInfo, error) {
+	return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletNotSupported)
+}
+
+// openDevice opens the first device of the type, or the device with the path if set
+func openDevice(ctx context.Context, name string, ids []usbID, path string) (device, error) {
+	infos, err := enumerateDevices(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if path == "" || info.path == path {
+			return info.open()
+		}
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletNoDevice, name, path)
+}
+
+// firmwareVersion is the major, minor and patch version reported by a device
+type firmwareVersion [3]uint64
+
+func (v firmwareVersion) atLeast(major, minor, patch uint64) bool {
+	for i, min := range []uint64{major, minor, patch} {
+		if v[i] != min {
+			return v[i] > min
+		}
+	}
+	return true
+}
+
+func (v firmwareVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
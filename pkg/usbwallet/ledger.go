@@ -0,0 +1,221 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usbwallet
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+)
+
+const (
+	ledgerName = "Ledger"
+
+	// APDU instructions of the Ledger Ethereum app
+	ledgerCLA                 = 0xe0
+	ledgerInsGetAddress       = 0x02
+	ledgerInsSignTransaction  = 0x04
+	ledgerInsGetConfiguration = 0x06
+	ledgerInsSignTypedHash    = 0x0c
+	ledgerP1FirstChunk        = 0x00
+	ledgerP1MoreChunks        = 0x80
+	ledgerMaxChunk            = 255
+
+	// HID transport framing of each 64 byte report - channel, tag and sequence number
+	ledgerChannel    = 0x0101
+	ledgerTagAPDU    = 0x05
+	ledgerHeaderSize = 5
+	reportSize       = 64
+
+	ledgerStatusOK     = 0x9000
+	ledgerStatusDenied = 0x6985
+)
+
+// ledgerStatusLocked are the statuses returned when the device is locked, or the Ethereum app is not open
+var ledgerStatusLocked = map[uint16]bool{0x5515: true, 0x6982: true, 0x6511: true, 0x6d00: true, 0x6e00: true, 0x6e01: true}
+
+// ledgerDriver exchanges APDUs with the Ethereum app on a Ledger device
+type ledgerDriver struct {
+	dev     device
+	appVers firmwareVersion
+}
+
+func (l *ledgerDriver) version(ctx context.Context) (string, error) {
+	reply, err := l.exchange(ctx, "configuration", ledgerInsGetConfiguration, ledgerP1FirstChunk, nil)
+	if err == nil && len(reply) < 4 {
+		err = i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, ledgerName, "configuration", "short reply")
+	}
+	if err != nil {
+		return "", err
+	}
+	l.appVers = firmwareVersion{uint64(reply[1]), uint64(reply[2]), uint64(reply[3])}
+	return l.appVers.String(), nil
+}
+
+func (l *ledgerDriver) deriveAddress(ctx context.Context, path []uint32) (*ethtypes.Address0xHex, error) {
+	reply, err := l.exchange(ctx, "address", ledgerInsGetAddress, ledgerP1FirstChunk, ledgerPath(path))
+	if err != nil {
+		return nil, err
+	}
+	// The reply is the public key, and the address as 40 hex characters, each prefixed with its length
+	if len(reply) > 0 && len(reply) > 1+int(reply[0]) {
+		addrStart := 2 + int(reply[0])
+		if addrEnd := addrStart + int(reply[addrStart-1]); len(reply) >= addrEnd {
+			if addr, err := ethtypes.NewAddress(string(reply[addrStart:addrEnd])); err == nil {
+				return addr, nil
+			}
+		}
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, ledgerName, "address", "invalid address in reply")
+}
+
+func (l *ledgerDriver) signTransaction(ctx context.Context, path []uint32, _ *ethsigner.Transaction, _ *big.Int, payload []byte) (*big.Int, *big.Int, error) {
+	if len(payload) > 0 && payload[0] == ethsigner.TransactionType1559 && !l.appVers.atLeast(1, 9, 0) {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, ledgerName, l.appVers, "EIP-1559 transactions")
+	}
+	if len(payload) > 0 && payload[0] == ethsigner.TransactionType2930 && !l.appVers.atLeast(1, 9, 0) {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, ledgerName, l.appVers, "EIP-2930 transactions")
+	}
+	if len(payload) > 0 && payload[0] == ethsigner.TransactionType4844 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, ledgerName, l.appVers, "EIP-4844 transactions")
+	}
+	if len(payload) > 0 && payload[0] == ethsigner.TransactionType7702 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, ledgerName, l.appVers, "EIP-7702 transactions")
+	}
+	// The payload is streamed in chunks, with the derivation path at the start of the first
+	data := append(ledgerPath(path), payload...)
+	var reply []byte
+	var err error
+	for p1 := byte(ledgerP1FirstChunk); len(data) > 0; p1 = ledgerP1MoreChunks {
+		chunk := data
+		if len(chunk) > ledgerMaxChunk {
+			chunk = chunk[:ledgerMaxChunk]
+		}
+		data = data[len(chunk):]
+		if reply, err = l.exchange(ctx, "sign transaction", ledgerInsSignTransaction, p1, chunk); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ledgerSignature(ctx, "sign transaction", reply)
+}
+
+func (l *ledgerDriver) signTypedData(ctx context.Context, path []uint32, domainSeparator, messageHash []byte) (*big.Int, *big.Int, error) {
+	if !l.appVers.atLeast(1, 5, 0) {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, ledgerName, l.appVers, "EIP-712 typed data")
+	}
+	if len(messageHash) == 0 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, ledgerName, l.appVers, "EIP-712 typed data with the EIP712Domain primary type")
+	}
+	data := append(append(ledgerPath(path), domainSeparator...), messageHash...)
+	reply, err := l.exchange(ctx, "sign typed data", ledgerInsSignTypedHash, ledgerP1FirstChunk, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ledgerSignature(ctx, "sign typed data", reply)
+}
+
+// ledgerPath encodes the derivation path as its length, followed by each index
+func ledgerPath(path []uint32) []byte {
+	b := []byte{byte(len(path))}
+	for _, index := range path {
+		b = binary.BigEndian.AppendUint32(b, index)
+	}
+	return b
+}
+
+// ledgerSignature returns R and S from a V, R, S reply
+func ledgerSignature(ctx context.Context, op string, reply []byte) (*big.Int, *big.Int, error) {
+	if len(reply) != 65 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, ledgerName, op, "invalid signature in reply")
+	}
+	return new(big.Int).SetBytes(reply[1:33]), new(big.Int).SetBytes(reply[33:65]), nil
+}
+
+// exchange sends an APDU, and returns the reply data after checking the status word at the end of it
+func (l *ledgerDriver) exchange(ctx context.Context, op string, ins, p1 byte, data []byte) ([]byte, error) {
+	apdu := append([]byte{ledgerCLA, ins, p1, 0x00, byte(len(data))}, data...)
+	err := l.write(apdu)
+	var reply []byte
+	if err == nil {
+		reply, err = l.read()
+	}
+	if err == nil && len(reply) < 2 {
+		err = fmt.Errorf("short reply")
+	}
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, ledgerName, op, err)
+	}
+	status := binary.BigEndian.Uint16(reply[len(reply)-2:])
+	switch {
+	case status == ledgerStatusOK:
+		return reply[:len(reply)-2], nil
+	case ledgerStatusLocked[status]:
+		return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletLocked, ledgerName)
+	case status == ledgerStatusDenied:
+		return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, ledgerName, op, "denied on the device")
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, ledgerName, op, fmt.Sprintf("status 0x%04x", status))
+	}
+}
+
+// write sends the APDU, prefixed with its length, in as many reports as needed
+func (l *ledgerDriver) write(apdu []byte) error {
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(apdu)))
+	data = append(data, apdu...)
+	for seq := uint16(0); len(data) > 0; seq++ {
+		report := make([]byte, reportSize)
+		binary.BigEndian.PutUint16(report[0:2], ledgerChannel)
+		report[2] = ledgerTagAPDU
+		binary.BigEndian.PutUint16(report[3:5], seq)
+		data = data[copy(report[ledgerHeaderSize:], data):]
+		if _, err := l.dev.Write(report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read reads reports until it has the length of the reply given in the first
+func (l *ledgerDriver) read() ([]byte, error) {
+	var reply []byte
+	replyLen := 0
+	report := make([]byte, reportSize)
+	for seq := uint16(0); ; seq++ {
+		if _, err := io.ReadFull(l.dev, report); err != nil {
+			return nil, err
+		}
+		if binary.BigEndian.Uint16(report[0:2]) != ledgerChannel || report[2] != ledgerTagAPDU || binary.BigEndian.Uint16(report[3:5]) != seq {
+			return nil, fmt.Errorf("invalid reply header")
+		}
+		data := report[ledgerHeaderSize:]
+		if seq == 0 {
+			replyLen = int(binary.BigEndian.Uint16(data[0:2]))
+			data = data[2:]
+		}
+		if remaining := replyLen - len(reply); remaining <= len(data) {
+			return append(reply, data[:remaining]...), nil
+		}
+		reply = append(reply, data...)
+	}
+}
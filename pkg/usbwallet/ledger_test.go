@@ -0,0 +1,278 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usbwallet
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/hyperledger/firefly-signer/pkg/hdwallet"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+// testLedger emulates the Ethereum app on a Ledger, with the keys derived from a mnemonic
+type testLedger struct {
+	t        *testing.T
+	master   *hdwallet.ExtendedKey
+	version  []byte
+	status   uint16 // returned in place of processing the APDU, when set
+	reply    []byte // returned in place of processing the APDU, when set
+	writeErr error
+	closed   bool
+
+	in      []byte
+	inLen   int
+	out     [][]byte
+	apdus   [][]byte
+	path    []uint32
+	payload []byte
+}
+
+func newTestLedger(t *testing.T) *testLedger {
+	master, err := hdwallet.NewMasterKeyFromMnemonic(testMnemonic, "")
+	assert.NoError(t, err)
+	return &testLedger{t: t, master: master, version: []byte{1, 10, 3}}
+}
+
+func (d *testLedger) Write(report []byte) (int, error) {
+	if d.writeErr != nil {
+		return 0, d.writeErr
+	}
+	assert.Len(d.t, report, reportSize)
+	assert.Equal(d.t, []byte{0x01, 0x01, 0x05}, report[0:3])
+	data := report[ledgerHeaderSize:]
+	if d.in == nil {
+		d.inLen = int(binary.BigEndian.Uint16(data[0:2]))
+		data = data[2:]
+		d.in = []byte{}
+	}
+	d.in = append(d.in, data...)
+	if len(d.in) >= d.inLen {
+		apdu := d.in[:d.inLen]
+		d.in = nil
+		d.apdus = append(d.apdus, apdu)
+		d.writeReply(d.handle(apdu))
+	}
+	return len(report), nil
+}
+
+func (d *testLedger) writeReply(reply []byte) {
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(reply)))
+	data = append(data, reply...)
+	for seq := uint16(0); len(data) > 0; seq++ {
+		report := make([]byte, reportSize)
+		binary.BigEndian.PutUint16(report[0:2], ledgerChannel)
+		report[2] = ledgerTagAPDU
+		binary.BigEndian.PutUint16(report[3:5], seq)
+		data = data[copy(report[ledgerHeaderSize:], data):]
+		d.out = append(d.out, report)
+	}
+}
+
+func (d *testLedger) Read(b []byte) (int, error) {
+	if len(d.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, d.out[0])
+	d.out = d.out[1:]
+	return n, nil
+}
+
+func (d *testLedger) Close() error {
+	d.closed = true
+	return nil
+}
+
+func (d *testLedger) handle(apdu []byte) []byte {
+	assert.Equal(d.t, byte(ledgerCLA), apdu[0])
+	assert.Equal(d.t, int(apdu[4]), len(apdu)-5)
+	if d.status != 0 {
+		return binary.BigEndian.AppendUint16(nil, d.status)
+	}
+	if d.reply != nil {
+		return append(d.reply, 0x90, 0x00)
+	}
+	ins, p1, data := apdu[1], apdu[2], apdu[5:]
+	var reply []byte
+	switch ins {
+	case ledgerInsGetConfiguration:
+		reply = append([]byte{0x01}, d.version...)
+	case ledgerInsGetAddress:
+		keyPair := d.key(d.readPath(data))
+		addr := keyPair.Address.String()[2:]
+		reply = append([]byte{65}, keyPair.PublicKey.SerializeUncompressed()...)
+		reply = append(append(reply, byte(len(addr))), addr...)
+	case ledgerInsSignTransaction:
+		if p1 == ledgerP1FirstChunk {
+			d.path = d.readPath(data)
+			d.payload = append([]byte{}, data[1+4*len(d.path):]...)
+		} else {
+			d.payload = append(d.payload, data...)
+		}
+		reply = d.sign(keccak256(d.payload))
+	case ledgerInsSignTypedHash:
+		d.path = d.readPath(data)
+		reply = d.sign(keccak256(append([]byte{0x19, 0x01}, data[1+4*len(d.path):]...)))
+	default:
+		return []byte{0x6d, 0x00}
+	}
+	return append(reply, 0x90, 0x00)
+}
+
+func (d *testLedger) readPath(data []byte) []uint32 {
+	path := make([]uint32, data[0])
+	for i := range path {
+		path[i] = binary.BigEndian.Uint32(data[1+4*i:])
+	}
+	return path
+}
+
+func (d *testLedger) sign(hash []byte) []byte {
+	sig, err := d.key(d.path).SignDirect(hash)
+	assert.NoError(d.t, err)
+	reply := []byte{byte(sig.V.Int64())}
+	reply = append(reply, sig.R.FillBytes(make([]byte, 32))...)
+	return append(reply, sig.S.FillBytes(make([]byte, 32))...)
+}
+
+func (d *testLedger) key(path []uint32) *secp256k1.KeyPair {
+	key, err := d.master.Derive(path)
+	assert.NoError(d.t, err)
+	return key.KeyPair()
+}
+
+func TestLedgerChunking(t *testing.T) {
+
+	ctx, w, d := newTestLedgerWallet(t)
+
+	// A large payload is sent in chunks of up to 255 bytes, and a long APDU in multiple reports
+	txn := testTransaction(t, true)
+	txn.Data = make([]byte, 600)
+	raw, err := w.Sign(ctx, txn, 1)
+	assert.NoError(t, err)
+	assertSignedBy(t, raw, 1, testAddress0)
+	signAPDUs := d.apdus[len(d.apdus)-3:]
+	assert.Equal(t, []byte{ledgerCLA, ledgerInsSignTransaction, ledgerP1FirstChunk, 0x00, 0xff}, signAPDUs[0][0:5])
+	assert.Equal(t, []byte{ledgerCLA, ledgerInsSignTransaction, ledgerP1MoreChunks, 0x00, 0xff}, signAPDUs[1][0:5])
+	assert.Equal(t, ledgerInsSignTransaction, int(signAPDUs[2][1]))
+
+}
+
+func TestLedgerAccessList(t *testing.T) {
+
+	ctx, w, _ := newTestLedgerWallet(t)
+
+	// The device is sent the typed payload, so EIP-2930 transactions need no special handling
+	raw, err := w.Sign(ctx, testTransactionAccessList(t), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x01), raw[0])
+	signed := assertSignedBy(t, raw, 1, testAddress0)
+	assert.Equal(t, testAccessList(), signed.AccessList)
+
+}
+
+func TestLedgerErrors(t *testing.T) {
+
+	ctx, w, d := newTestLedgerWallet(t)
+	txn := testTransaction(t, false)
+
+	d.status = 0x6985
+	_, err := w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22203.*denied", err)
+
+	d.status = 0x6e00
+	_, err = w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22206", err)
+
+	d.status = 0x6a80
+	_, err = w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22203.*0x6a80", err)
+
+	d.status = 0
+	d.reply = []byte{0x1b}
+	_, err = w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22203.*invalid signature", err)
+
+	// A signature by a different key
+	d.path = []uint32{0}
+	d.reply = d.sign(make([]byte, 32))
+	_, err = w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22207", err)
+
+	d.reply = []byte{65}
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22203.*invalid address", err)
+
+	d.reply = []byte{0x01}
+	_, err = w.driver.version(ctx)
+	assert.Regexp(t, "FF22203.*short reply", err)
+
+	d.reply = nil
+	d.out = append(d.out, make([]byte, reportSize))
+	_, err = w.driver.version(ctx)
+	assert.Regexp(t, "FF22203.*invalid reply header", err)
+	d.out = nil
+
+	d.writeErr = fmt.Errorf("pop")
+	_, err = w.driver.version(ctx)
+	assert.Regexp(t, "FF22203.*pop", err)
+
+}
+
+func TestLedgerEmptyReply(t *testing.T) {
+
+	d := newTestLedger(t)
+	d.writeReply([]byte{})
+	reply, err := (&ledgerDriver{dev: d}).read()
+	assert.NoError(t, err)
+	assert.Empty(t, reply)
+
+	d.writeReply([]byte{0x01})
+	_, err = (&ledgerDriver{dev: d}).exchange(context.Background(), "test", 0, 0, nil)
+	assert.Regexp(t, "FF22203.*short reply", err)
+
+}
+
+func TestLedgerFirmwareSupport(t *testing.T) {
+
+	ctx, w, _ := newTestLedgerWallet(t)
+
+	w.driver.(*ledgerDriver).appVers = firmwareVersion{1, 8, 9}
+	_, err := w.Sign(ctx, testTransaction(t, true), 1)
+	assert.Regexp(t, "FF22205.*1.8.9.*EIP-1559", err)
+	_, err = w.Sign(ctx, testTransactionAccessList(t), 1)
+	assert.Regexp(t, "FF22205.*1.8.9.*EIP-2930", err)
+	_, err = w.Sign(ctx, testTransactionBlob(t), 1)
+	assert.Regexp(t, "FF22205.*EIP-4844", err)
+	_, err = w.Sign(ctx, testTransactionSetCode(t), 1)
+	assert.Regexp(t, "FF22205.*EIP-7702", err)
+	_, err = w.Sign(ctx, testTransaction(t, false), 1)
+	assert.NoError(t, err)
+
+	w.driver.(*ledgerDriver).appVers = firmwareVersion{1, 4, 0}
+	_, err = w.SignTypedDataV4(ctx, testAddress0, testTypedData())
+	assert.Regexp(t, "FF22205.*1.4.0.*EIP-712", err)
+
+	w.driver.(*ledgerDriver).appVers = firmwareVersion{1, 5, 0}
+	_, err = w.SignTypedDataV4(ctx, testAddress0, testTypedDataDomainOnly())
+	assert.Regexp(t, "FF22205.*EIP712Domain", err)
+
+}
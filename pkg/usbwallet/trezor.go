@@ -0,0 +1,340 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usbwallet
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const trezorName = "Trezor"
+
+// Trezor message types, from messages.proto of trezor-common
+const (
+	trezorInitialize                 uint16 = 0
+	trezorFailure                    uint16 = 3
+	trezorFeatures                   uint16 = 17
+	trezorPinMatrixRequest           uint16 = 18
+	trezorButtonRequest              uint16 = 26
+	trezorButtonAck                  uint16 = 27
+	trezorPassphraseRequest          uint16 = 41
+	trezorPassphraseAck              uint16 = 42
+	trezorEthereumGetAddress         uint16 = 56
+	trezorEthereumAddress            uint16 = 57
+	trezorEthereumSignTx             uint16 = 58
+	trezorEthereumTxRequest          uint16 = 59
+	trezorEthereumTxAck              uint16 = 60
+	trezorEthereumSignTxEIP1559      uint16 = 452
+	trezorEthereumTypedDataSignature uint16 = 469
+	trezorEthereumSignTypedHash      uint16 = 470
+)
+
+const (
+	// trezorMaxChunk is the most data sent with the transaction, and in each EthereumTxAck after it
+	trezorMaxChunk = 1024
+	// trezorReportID starts every report, and trezorMagic starts every message
+	trezorReportID = 0x3f
+	trezorMagic    = 0x23
+	trezorHeadSize = 9
+)
+
+// trezorDriver exchanges protobuf messages with a Trezor device
+type trezorDriver struct {
+	dev      device
+	firmware firmwareVersion
+}
+
+func (t *trezorDriver) version(ctx context.Context) (string, error) {
+	features, err := t.exchange(ctx, "initialize", trezorInitialize, nil, trezorFeatures)
+	if err != nil {
+		return "", err
+	}
+	t.firmware = firmwareVersion{features.uint(2), features.uint(3), features.uint(4)}
+	return t.firmware.String(), nil
+}
+
+func (t *trezorDriver) deriveAddress(ctx context.Context, path []uint32) (*ethtypes.Address0xHex, error) {
+	reply, err := t.exchange(ctx, "address", trezorEthereumGetAddress, trezorPath(path), trezorEthereumAddress)
+	if err != nil {
+		return nil, err
+	}
+	// Older firmware returns the address as 20 bytes in field 1, and newer as a hex string in field 2
+	if addr := reply.bytes(2); addr != nil {
+		if a, err := ethtypes.NewAddress(string(addr)); err == nil {
+			return a, nil
+		}
+	} else if addr := reply.bytes(1); len(addr) == 20 {
+		a := ethtypes.Address0xHex(addr)
+		return &a, nil
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, trezorName, "address", "invalid address in reply")
+}
+
+func (t *trezorDriver) signTransaction(ctx context.Context, path []uint32, txn *ethsigner.Transaction, chainID *big.Int, payload []byte) (*big.Int, *big.Int, error) {
+	if !chainID.IsInt64() {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgChainIDTooLarge, chainID)
+	}
+	data := []byte(txn.Data)
+	initialChunk := data
+	if len(initialChunk) > trezorMaxChunk {
+		initialChunk = initialChunk[:trezorMaxChunk]
+	}
+	data = data[len(initialChunk):]
+
+	var msgType uint16
+	req := trezorPath(path)
+	if len(payload) > 0 && payload[0] == ethsigner.TransactionType2930 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, trezorName, t.firmware, "EIP-2930 transactions")
+	}
+	if len(payload) > 0 && payload[0] == ethsigner.TransactionType4844 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, trezorName, t.firmware, "EIP-4844 transactions")
+	}
+	if len(payload) > 0 && payload[0] == ethsigner.TransactionType7702 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, trezorName, t.firmware, "EIP-7702 transactions")
+	}
+	if len(payload) > 0 && payload[0] == ethsigner.TransactionType1559 {
+		if !t.firmware.atLeast(1, 10, 4) || (t.firmware[0] == 2 && !t.firmware.atLeast(2, 4, 2)) {
+			return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, trezorName, t.firmware, "EIP-1559 transactions")
+		}
+		msgType = trezorEthereumSignTxEIP1559
+		req = protowire.AppendTag(req, 2, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.Nonce.BigInt().Bytes())
+		req = protowire.AppendTag(req, 3, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.MaxFeePerGas.BigInt().Bytes())
+		req = protowire.AppendTag(req, 4, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.MaxPriorityFeePerGas.BigInt().Bytes())
+		req = protowire.AppendTag(req, 5, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.GasLimit.BigInt().Bytes())
+		if txn.To != nil {
+			req = protowire.AppendTag(req, 6, protowire.BytesType)
+			req = protowire.AppendString(req, txn.To.String())
+		}
+		req = protowire.AppendTag(req, 7, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.Value.BigInt().Bytes())
+		req = protowire.AppendTag(req, 8, protowire.BytesType)
+		req = protowire.AppendBytes(req, initialChunk)
+		req = protowire.AppendTag(req, 9, protowire.VarintType)
+		req = protowire.AppendVarint(req, uint64(len(txn.Data)))
+		req = protowire.AppendTag(req, 10, protowire.VarintType)
+		req = protowire.AppendVarint(req, chainID.Uint64())
+		for _, entry := range txn.AccessList {
+			req = protowire.AppendTag(req, 11, protowire.BytesType)
+			req = protowire.AppendBytes(req, trezorAccessListEntry(entry))
+		}
+	} else {
+		msgType = trezorEthereumSignTx
+		req = protowire.AppendTag(req, 2, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.Nonce.BigInt().Bytes())
+		req = protowire.AppendTag(req, 3, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.GasPrice.BigInt().Bytes())
+		req = protowire.AppendTag(req, 4, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.GasLimit.BigInt().Bytes())
+		req = protowire.AppendTag(req, 6, protowire.BytesType)
+		req = protowire.AppendBytes(req, txn.Value.BigInt().Bytes())
+		req = protowire.AppendTag(req, 7, protowire.BytesType)
+		req = protowire.AppendBytes(req, initialChunk)
+		req = protowire.AppendTag(req, 8, protowire.VarintType)
+		req = protowire.AppendVarint(req, uint64(len(txn.Data)))
+		req = protowire.AppendTag(req, 9, protowire.VarintType)
+		req = protowire.AppendVarint(req, chainID.Uint64())
+		if txn.To != nil {
+			req = protowire.AppendTag(req, 11, protowire.BytesType)
+			req = protowire.AppendString(req, txn.To.String())
+		}
+	}
+
+	// The device requests the rest of the data in chunks, until it returns the signature
+	for {
+		reply, err := t.exchange(ctx, "sign transaction", msgType, req, trezorEthereumTxRequest)
+		if err != nil {
+			return nil, nil, err
+		}
+		if r, s := reply.bytes(3), reply.bytes(4); r != nil && s != nil {
+			return new(big.Int).SetBytes(r), new(big.Int).SetBytes(s), nil
+		}
+		requested := int(reply.uint(1))
+		if requested == 0 || requested > len(data) {
+			return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, trezorName, "sign transaction", "invalid data request")
+		}
+		msgType = trezorEthereumTxAck
+		req = protowire.AppendTag(nil, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, data[:requested])
+		data = data[requested:]
+	}
+}
+
+func (t *trezorDriver) signTypedData(ctx context.Context, path []uint32, domainSeparator, messageHash []byte) (*big.Int, *big.Int, error) {
+	// Only the Trezor One signs typed data by its hashes - Trezor Model T firmware requires the full structure
+	if t.firmware[0] != 1 || !t.firmware.atLeast(1, 10, 5) {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletUnsupported, trezorName, t.firmware, "EIP-712 typed data")
+	}
+	req := trezorPath(path)
+	req = protowire.AppendTag(req, 2, protowire.BytesType)
+	req = protowire.AppendBytes(req, domainSeparator)
+	if len(messageHash) > 0 {
+		req = protowire.AppendTag(req, 3, protowire.BytesType)
+		req = protowire.AppendBytes(req, messageHash)
+	}
+	reply, err := t.exchange(ctx, "sign typed data", trezorEthereumSignTypedHash, req, trezorEthereumTypedDataSignature)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature := reply.bytes(1)
+	if len(signature) != 65 {
+		return nil, nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, trezorName, "sign typed data", "invalid signature in reply")
+	}
+	return new(big.Int).SetBytes(signature[0:32]), new(big.Int).SetBytes(signature[32:64]), nil
+}
+
+// trezorAccessListEntry encodes an EthereumAccessList message, of the address and its storage keys
+func trezorAccessListEntry(entry ethsigner.AccessListEntry) []byte {
+	b := protowire.AppendTag(nil, 1, protowire.BytesType)
+	b = protowire.AppendString(b, entry.Address.String())
+	for _, key := range entry.StorageKeys {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, key)
+	}
+	return b
+}
+
+// trezorPath encodes the derivation path as the repeated address_n field, which is field 1 of every request that has one
+func trezorPath(path []uint32) []byte {
+	var b []byte
+	for _, index := range path {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(index))
+	}
+	return b
+}
+
+// exchange sends a message, acknowledging the requests for button presses (the user confirming on the device)
+// and the passphrase (which is entered on the device, if it is enabled) until the expected reply is received
+func (t *trezorDriver) exchange(ctx context.Context, op string, msgType uint16, req []byte, expected uint16) (protoFields, error) {
+	for {
+		replyType, reply, err := t.roundTrip(msgType, req)
+		var fields protoFields
+		if err == nil {
+			fields, err = parseProto(reply)
+		}
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, trezorName, op, err)
+		}
+		switch replyType {
+		case expected:
+			return fields, nil
+		case trezorButtonRequest:
+			msgType, req = trezorButtonAck, nil
+		case trezorPassphraseRequest:
+			msgType, req = trezorPassphraseAck, protowire.AppendVarint(protowire.AppendTag(nil, 3, protowire.VarintType), 1)
+		case trezorPinMatrixRequest:
+			return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletLocked, trezorName)
+		case trezorFailure:
+			return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, trezorName, op, string(fields.bytes(2)))
+		default:
+			return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletRequestFailed, trezorName, op, fmt.Sprintf("unexpected reply type %d", replyType))
+		}
+	}
+}
+
+// roundTrip writes the message with its type and length, in as many reports as needed, and reads the reply
+func (t *trezorDriver) roundTrip(msgType uint16, req []byte) (uint16, []byte, error) {
+	data := []byte{trezorMagic, trezorMagic}
+	data = binary.BigEndian.AppendUint16(data, msgType)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(req)))
+	data = append(data, req...)
+	for len(data) > 0 {
+		report := make([]byte, reportSize)
+		report[0] = trezorReportID
+		data = data[copy(report[1:], data):]
+		if _, err := t.dev.Write(report); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var replyType uint16
+	var reply []byte
+	replyLen := -1
+	report := make([]byte, reportSize)
+	for {
+		if _, err := io.ReadFull(t.dev, report); err != nil {
+			return 0, nil, err
+		}
+		if report[0] != trezorReportID || (replyLen < 0 && (report[1] != trezorMagic || report[2] != trezorMagic)) {
+			return 0, nil, fmt.Errorf("invalid reply header")
+		}
+		data := report[1:]
+		if replyLen < 0 {
+			replyType = binary.BigEndian.Uint16(report[3:5])
+			replyLen = int(binary.BigEndian.Uint32(report[5:9]))
+			data = report[trezorHeadSize:]
+		}
+		if remaining := replyLen - len(reply); remaining <= len(data) {
+			return replyType, append(reply, data[:remaining]...), nil
+		}
+		reply = append(reply, data...)
+	}
+}
+
+// protoFields are the varint (uint64) and length delimited ([]byte) fields of a protobuf message
+type protoFields map[protowire.Number]interface{}
+
+func parseProto(b []byte) (protoFields, error) {
+	fields := protoFields{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			fields[num] = v
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			fields[num] = v
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return fields, nil
+}
+
+func (f protoFields) uint(num protowire.Number) uint64 {
+	v, _ := f[num].(uint64)
+	return v
+}
+
+func (f protoFields) bytes(num protowire.Number) []byte {
+	v, _ := f[num].([]byte)
+	return v
+}
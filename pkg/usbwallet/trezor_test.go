@@ -0,0 +1,408 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usbwallet
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/hdwallet"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testTrezor emulates a Trezor, with the keys derived from a mnemonic. Each request is confirmed with a
+// button request, and the passphrase is requested once.
+type testTrezor struct {
+	t              *testing.T
+	master         *hdwallet.ExtendedKey
+	version        firmwareVersion
+	passphrase     bool
+	legacyAddress  bool
+	replyType      uint16 // returned in place of processing the message, when set
+	reply          []byte
+	writeErr       error
+	maxDataRequest int
+	closed         bool
+
+	in      []byte
+	inType  uint16
+	inLen   int
+	out     [][]byte
+	pending func() (uint16, []byte)
+	path    []uint32
+	signTx  protoFields
+	data    []byte
+	msgs    []uint16
+}
+
+func newTestTrezor(t *testing.T) *testTrezor {
+	master, err := hdwallet.NewMasterKeyFromMnemonic(testMnemonic, "")
+	assert.NoError(t, err)
+	return &testTrezor{t: t, master: master, version: firmwareVersion{1, 12, 1}, passphrase: true, maxDataRequest: trezorMaxChunk}
+}
+
+// newTestTrezorWallet returns the emulator, to configure before the wallet is started and initialized
+func newTestTrezorWallet(t *testing.T, setConfig ...func(section config.Section)) (*testTrezor, func() (context.Context, *usbWallet)) {
+	d := newTestTrezor(t)
+	return d, func() (context.Context, *usbWallet) {
+		ctx, w := newTestUSBWallet(t, DriverTrezor, d, setConfig...)
+		t.Cleanup(func() { _ = w.Close() })
+		return ctx, w
+	}
+}
+
+func (d *testTrezor) Write(report []byte) (int, error) {
+	if d.writeErr != nil {
+		return 0, d.writeErr
+	}
+	assert.Len(d.t, report, reportSize)
+	assert.Equal(d.t, byte(trezorReportID), report[0])
+	data := report[1:]
+	if d.in == nil {
+		assert.Equal(d.t, []byte{trezorMagic, trezorMagic}, data[0:2])
+		d.inType = binary.BigEndian.Uint16(data[2:4])
+		d.inLen = int(binary.BigEndian.Uint32(data[4:8]))
+		data = data[8:]
+		d.in = []byte{}
+	}
+	d.in = append(d.in, data...)
+	if len(d.in) >= d.inLen {
+		msg := d.in[:d.inLen]
+		d.in = nil
+		d.msgs = append(d.msgs, d.inType)
+		fields, err := parseProto(msg)
+		assert.NoError(d.t, err)
+		d.writeReply(d.handle(d.inType, fields))
+	}
+	return len(report), nil
+}
+
+func (d *testTrezor) writeReply(replyType uint16, reply []byte) {
+	data := []byte{trezorMagic, trezorMagic}
+	data = binary.BigEndian.AppendUint16(data, replyType)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(reply)))
+	data = append(data, reply...)
+	for len(data) > 0 {
+		report := make([]byte, reportSize)
+		report[0] = trezorReportID
+		data = data[copy(report[1:], data):]
+		d.out = append(d.out, report)
+	}
+}
+
+func (d *testTrezor) Read(b []byte) (int, error) {
+	if len(d.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, d.out[0])
+	d.out = d.out[1:]
+	return n, nil
+}
+
+func (d *testTrezor) Close() error {
+	d.closed = true
+	return nil
+}
+
+func (d *testTrezor) handle(msgType uint16, fields protoFields) (uint16, []byte) {
+	if d.replyType != 0 {
+		return d.replyType, d.reply
+	}
+	switch msgType {
+	case trezorInitialize:
+		var features []byte
+		for i, v := range d.version {
+			features = protowire.AppendTag(features, protowire.Number(i+2), protowire.VarintType)
+			features = protowire.AppendVarint(features, v)
+		}
+		return trezorFeatures, features
+	case trezorButtonAck:
+		return d.pending()
+	case trezorPassphraseAck:
+		assert.Equal(d.t, uint64(1), fields.uint(3))
+		d.passphrase = false
+		return d.pending()
+	case trezorEthereumGetAddress:
+		d.path = d.readPath(fields)
+		d.pending = func() (uint16, []byte) {
+			addr := d.key().Address
+			if d.legacyAddress {
+				return trezorEthereumAddress, protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), addr[:])
+			}
+			return trezorEthereumAddress, protowire.AppendString(protowire.AppendTag(nil, 2, protowire.BytesType), addr.String())
+		}
+		if d.passphrase {
+			return trezorPassphraseRequest, nil
+		}
+		return d.pending()
+	case trezorEthereumSignTx, trezorEthereumSignTxEIP1559:
+		d.path = d.readPath(fields)
+		d.signTx = fields
+		d.signTx[0] = uint64(msgType)
+		dataField := protowire.Number(7)
+		if msgType == trezorEthereumSignTxEIP1559 {
+			dataField = 8
+		}
+		d.data = append([]byte{}, fields.bytes(dataField)...)
+		return d.requestData()
+	case trezorEthereumTxAck:
+		d.data = append(d.data, fields.bytes(1)...)
+		return d.requestData()
+	case trezorEthereumSignTypedHash:
+		d.path = d.readPath(fields)
+		d.pending = func() (uint16, []byte) {
+			message := append(append([]byte{0x19, 0x01}, fields.bytes(2)...), fields.bytes(3)...)
+			sig := d.sign(keccak256(message))
+			signature := append(append(sig.R.FillBytes(make([]byte, 32)), sig.S.FillBytes(make([]byte, 32))...), byte(sig.V.Int64()))
+			return trezorEthereumTypedDataSignature, protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), signature)
+		}
+		return trezorButtonRequest, nil
+	default:
+		return trezorFailure, protowire.AppendString(protowire.AppendTag(nil, 2, protowire.BytesType), "Unexpected message")
+	}
+}
+
+func (d *testTrezor) readPath(fields protoFields) []uint32 {
+	// Only the last index of a repeated field is held by parseProto, so the emulator only supports
+	// the standard Ethereum paths under m/44'/60'/0'/0
+	return []uint32{44 + hdwallet.HardenedKeyStart, 60 + hdwallet.HardenedKeyStart, hdwallet.HardenedKeyStart, 0, uint32(fields.uint(1))}
+}
+
+func (d *testTrezor) requestData() (uint16, []byte) {
+	eip1559 := d.signTx.uint(0) == uint64(trezorEthereumSignTxEIP1559)
+	dataLengthField := protowire.Number(8)
+	if eip1559 {
+		dataLengthField = 9
+	}
+	if remaining := int(d.signTx.uint(dataLengthField)) - len(d.data); remaining > 0 {
+		if remaining > d.maxDataRequest {
+			remaining = d.maxDataRequest
+		}
+		return trezorEthereumTxRequest, protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), uint64(remaining))
+	}
+	d.pending = func() (uint16, []byte) {
+		bigField := func(num protowire.Number) *ethtypes.HexInteger {
+			return (*ethtypes.HexInteger)(new(big.Int).SetBytes(d.signTx.bytes(num)))
+		}
+		txn := &ethsigner.Transaction{Data: d.data}
+		var chainID uint64
+		var to []byte
+		if eip1559 {
+			txn.Nonce, txn.MaxFeePerGas, txn.MaxPriorityFeePerGas, txn.GasLimit, txn.Value = bigField(2), bigField(3), bigField(4), bigField(5), bigField(7)
+			to, chainID = d.signTx.bytes(6), d.signTx.uint(10)
+			if accessList := d.signTx.bytes(11); accessList != nil {
+				// As with the path, only a single entry with a single storage key is supported
+				entry, err := parseProto(accessList)
+				assert.NoError(d.t, err)
+				txn.AccessList = ethsigner.AccessList{{
+					Address:     *ethtypes.MustNewAddress(string(entry.bytes(1))),
+					StorageKeys: []ethtypes.HexBytes0xPrefix{entry.bytes(2)},
+				}}
+			}
+		} else {
+			txn.Nonce, txn.GasPrice, txn.GasLimit, txn.Value = bigField(2), bigField(3), bigField(4), bigField(6)
+			to, chainID = d.signTx.bytes(11), d.signTx.uint(9)
+		}
+		if to != nil {
+			txn.To = ethtypes.MustNewAddress(string(to))
+		}
+		sig := d.sign(keccak256(txn.SignaturePayloadBig(new(big.Int).SetUint64(chainID)).Bytes()))
+		reply := protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), sig.V.Uint64())
+		reply = protowire.AppendBytes(protowire.AppendTag(reply, 3, protowire.BytesType), sig.R.Bytes())
+		return trezorEthereumTxRequest, protowire.AppendBytes(protowire.AppendTag(reply, 4, protowire.BytesType), sig.S.Bytes())
+	}
+	return trezorButtonRequest, nil
+}
+
+func (d *testTrezor) sign(hash []byte) *secp256k1.SignatureData {
+	key, err := d.master.Derive(d.path)
+	assert.NoError(d.t, err)
+	sig, err := key.KeyPair().SignDirect(hash)
+	assert.NoError(d.t, err)
+	return sig
+}
+
+func (d *testTrezor) key() *secp256k1.KeyPair {
+	key, err := d.master.Derive(d.path)
+	assert.NoError(d.t, err)
+	return key.KeyPair()
+}
+
+func TestTrezorWalletSignOK(t *testing.T) {
+
+	d, start := newTestTrezorWallet(t, func(section config.Section) {
+		section.Set(ConfigDerivationPaths, []string{"m/44'/60'/0'/0/0", "m/44'/60'/0'/0/1"})
+	})
+	ctx, w := start()
+
+	testSignAll(t, ctx, w)
+	assert.Contains(t, d.msgs, trezorPassphraseAck)
+	assert.Contains(t, d.msgs, trezorButtonAck)
+
+}
+
+func TestTrezorDataChunks(t *testing.T) {
+
+	d, start := newTestTrezorWallet(t)
+	d.legacyAddress = true
+	d.maxDataRequest = 100
+	ctx, w := start()
+
+	txn := testTransaction(t, false)
+	txn.Data = make([]byte, trezorMaxChunk+250)
+	txn.Data[trezorMaxChunk+249] = 0xff
+	raw, err := w.Sign(ctx, txn, 1)
+	assert.NoError(t, err)
+	signed := assertSignedBy(t, raw, 1, testAddress0)
+	assert.Equal(t, txn.Data.String(), signed.Data.String())
+	assert.Equal(t, 3, countMsgs(d.msgs, trezorEthereumTxAck))
+
+}
+
+func TestTrezorAccessList(t *testing.T) {
+
+	d, start := newTestTrezorWallet(t)
+	d.legacyAddress = true
+	ctx, w := start()
+
+	txn := testTransaction(t, true)
+	txn.AccessList = testAccessList()
+	raw, err := w.Sign(ctx, txn, 1)
+	assert.NoError(t, err)
+	signed := assertSignedBy(t, raw, 1, testAddress0)
+	assert.Equal(t, txn.AccessList, signed.AccessList)
+
+	// There is no EIP-2930 message
+	_, err = w.Sign(ctx, testTransactionAccessList(t), 1)
+	assert.Regexp(t, "FF22205.*EIP-2930", err)
+
+	// There is no EIP-4844 message
+	_, err = w.Sign(ctx, testTransactionBlob(t), 1)
+	assert.Regexp(t, "FF22205.*EIP-4844", err)
+
+	// There is no EIP-7702 message
+	_, err = w.Sign(ctx, testTransactionSetCode(t), 1)
+	assert.Regexp(t, "FF22205.*EIP-7702", err)
+
+}
+
+func countMsgs(msgs []uint16, msgType uint16) (count int) {
+	for _, m := range msgs {
+		if m == msgType {
+			count++
+		}
+	}
+	return count
+}
+
+func TestTrezorFirmwareSupport(t *testing.T) {
+
+	d, start := newTestTrezorWallet(t)
+	d.version = firmwareVersion{2, 4, 1}
+	ctx, w := start()
+
+	_, err := w.Sign(ctx, testTransaction(t, true), 1)
+	assert.Regexp(t, "FF22205.*2.4.1.*EIP-1559", err)
+	_, err = w.SignTypedDataV4(ctx, testAddress0, testTypedData())
+	assert.Regexp(t, "FF22205.*2.4.1.*EIP-712", err)
+
+	w.driver.(*trezorDriver).firmware = firmwareVersion{1, 10, 3}
+	_, err = w.Sign(ctx, testTransaction(t, true), 1)
+	assert.Regexp(t, "FF22205.*1.10.3.*EIP-1559", err)
+	_, err = w.SignBig(ctx, testTransaction(t, false), new(big.Int).Lsh(big.NewInt(1), 64))
+	assert.Regexp(t, "FF22174", err)
+
+	// Typed data with only a domain has no message hash
+	w.driver.(*trezorDriver).firmware = firmwareVersion{1, 10, 5}
+	_, err = w.SignTypedDataV4(ctx, testAddress0, testTypedDataDomainOnly())
+	assert.NoError(t, err)
+
+}
+
+func TestTrezorErrors(t *testing.T) {
+
+	d, start := newTestTrezorWallet(t)
+	ctx, w := start()
+	txn := testTransaction(t, false)
+
+	d.replyType = trezorPinMatrixRequest
+	_, err := w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22206", err)
+
+	d.replyType, d.reply = trezorFailure, protowire.AppendString(protowire.AppendTag(nil, 2, protowire.BytesType), "Cancelled")
+	_, err = w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22203.*sign transaction.*Cancelled", err)
+
+	d.replyType, d.reply = trezorFeatures, nil
+	_, err = w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22203.*unexpected reply type 17", err)
+
+	d.replyType, d.reply = trezorEthereumTxRequest, nil
+	_, err = w.Sign(ctx, txn, 1)
+	assert.Regexp(t, "FF22203.*invalid data request", err)
+
+	d.replyType, d.reply = trezorEthereumAddress, protowire.AppendString(protowire.AppendTag(nil, 2, protowire.BytesType), "wrong")
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22203.*invalid address", err)
+
+	d.replyType, d.reply = trezorEthereumAddress, []byte{0xff}
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22203", err)
+
+	w.driver.(*trezorDriver).firmware = firmwareVersion{1, 10, 5}
+	d.replyType, d.reply = trezorEthereumTypedDataSignature, nil
+	_, err = w.SignTypedDataV4(ctx, testAddress0, testTypedData())
+	assert.Regexp(t, "FF22203.*invalid signature", err)
+
+	d.replyType = 0
+	d.out = append(d.out, make([]byte, reportSize))
+	_, err = w.driver.version(ctx)
+	assert.Regexp(t, "FF22203.*invalid reply header", err)
+	d.out = nil
+
+	d.writeErr = fmt.Errorf("pop")
+	_, err = w.driver.version(ctx)
+	assert.Regexp(t, "FF22203.*pop", err)
+
+}
+
+func TestParseProto(t *testing.T) {
+
+	b := protowire.AppendTag(nil, 1, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 12345)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, 42)
+	fields, err := parseProto(b)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), fields.uint(2))
+	assert.Nil(t, fields.bytes(1))
+
+	_, err = parseProto([]byte{0xff})
+	assert.Error(t, err)
+	_, err = parseProto(protowire.AppendTag(nil, 1, protowire.BytesType))
+	assert.Error(t, err)
+
+}
@@ -0,0 +1,54 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo && usb
+
+package usbwallet
+
+import (
+	"context"
+
+	"github.com/karalabe/usb"
+)
+
+// Ledger and Trezor devices expose the wallet on the first interface, or on a HID interface with a
+// vendor defined usage page (0xffa0 for Ledger, 0xff00 for Trezor One)
+const vendorUsagePageMin = 0xff00
+
+func init() {
+	enumerateDevices = enumerateUSBDevices
+}
+
+func enumerateUSBDevices(_ context.Context, ids []usbID) ([]*deviceInfo, error) {
+	var devices []*deviceInfo
+	for _, id := range ids {
+		infos, err := usb.Enumerate(id.vendorID, id.productID)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if info.Interface != 0 && info.UsagePage < vendorUsagePageMin {
+				continue
+			}
+			info := info
+			devices = append(devices, &deviceInfo{
+				path: info.Path,
+				open: func() (device, error) { return info.Open() },
+			})
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,282 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package usbwallet signs with the keys held on a Ledger or Trezor hardware wallet connected over USB.
+// The binding to the USB bus requires cgo, so it is only compiled in with -tags usb.
+package usbwallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/hdwallet"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+// Wallet signs with the keys at the configured derivation paths of a Ledger or Trezor device. Every
+// transaction and typed data payload must be confirmed by the user on the device.
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+}
+
+// driver implements the protocol of a type of device, over the open device
+type driver interface {
+	// version returns the version of the firmware (or of the Ethereum app on a Ledger)
+	version(ctx context.Context) (string, error)
+	deriveAddress(ctx context.Context, path []uint32) (*ethtypes.Address0xHex, error)
+	// signTransaction signs the transaction, for which the payload is the unsigned encoding that is hashed
+	// for the signature, returning R and S (the V returned by the device is not used, as it is truncated
+	// to a single byte for large chain IDs)
+	signTransaction(ctx context.Context, path []uint32, txn *ethsigner.Transaction, chainID *big.Int, payload []byte) (r, s *big.Int, err error)
+	// signTypedData signs the EIP-712 hashes, where the message hash is empty for the EIP712Domain primary type
+	signTypedData(ctx context.Context, path []uint32, domainSeparator, messageHash []byte) (r, s *big.Int, err error)
+}
+
+type deviceType struct {
+	name      string
+	ids       []usbID
+	newDriver func(dev device) driver
+}
+
+var deviceTypes = map[string]*deviceType{
+	DriverLedger: {
+		name:      "Ledger",
+		ids:       []usbID{{vendorID: 0x2c97}},
+		newDriver: func(dev device) driver { return &ledgerDriver{dev: dev} },
+	},
+	DriverTrezor: {
+		name:      "Trezor",
+		ids:       []usbID{{vendorID: 0x534c, productID: 0x0001}, {vendorID: 0x1209, productID: 0x53c1}},
+		newDriver: func(dev device) driver { return &trezorDriver{dev: dev} },
+	},
+}
+
+type accountPath struct {
+	path    string
+	indexes []uint32
+}
+
+type usbWallet struct {
+	conf       *Config
+	deviceType *deviceType
+	paths      []*accountPath
+
+	mux          sync.Mutex // requests are exchanged with the device one at a time
+	dev          device
+	driver       driver
+	addressPaths map[ethtypes.Address0xHex]*accountPath
+	addressList  []*ethtypes.Address0xHex
+}
+
+func NewUSBWallet(ctx context.Context, conf *Config) (Wallet, error) {
+	dt, ok := deviceTypes[conf.Driver]
+	if !ok {
+		return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletBadDriver, conf.Driver)
+	}
+	w := &usbWallet{conf: conf, deviceType: dt}
+	paths := append([]string{}, conf.DerivationPaths...)
+	for i := 0; i < conf.Discovery.Count; i++ {
+		paths = append(paths, fmt.Sprintf("%s/%d", conf.Discovery.BasePath, i))
+	}
+	for _, path := range paths {
+		indexes, err := hdwallet.ParseDerivationPath(path)
+		if err == nil && len(indexes) == 0 {
+			err = fmt.Errorf("the master key cannot be used")
+		}
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletBadPath, path, err)
+		}
+		w.paths = append(w.paths, &accountPath{path: path, indexes: indexes})
+	}
+	return w, nil
+}
+
+// Initialize opens the device, and derives the address of each account
+func (w *usbWallet) Initialize(ctx context.Context) error {
+	dev, err := openDevice(ctx, w.deviceType.name, w.deviceType.ids, w.conf.DevicePath)
+	if err != nil {
+		return err
+	}
+	w.mux.Lock()
+	w.dev = dev
+	w.driver = w.deviceType.newDriver(dev)
+	version, err := w.driver.version(ctx)
+	w.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	log.L(ctx).Infof("Opened %s with firmware version %s", w.deviceType.name, version)
+	return w.Refresh(ctx)
+}
+
+// Refresh derives the address of each account from the device
+func (w *usbWallet) Refresh(ctx context.Context) error {
+	addressPaths := make(map[ethtypes.Address0xHex]*accountPath, len(w.paths))
+	addressList := make([]*ethtypes.Address0xHex, 0, len(w.paths))
+	for _, p := range w.paths {
+		var addr *ethtypes.Address0xHex
+		err := w.withDriver(ctx, func(d driver) (err error) {
+			addr, err = d.deriveAddress(ctx, p.indexes)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if _, exists := addressPaths[*addr]; !exists {
+			log.L(ctx).Debugf("Account %s at path %s", addr, p.path)
+			addressPaths[*addr] = p
+			addressList = append(addressList, addr)
+		}
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.addressPaths = addressPaths
+	w.addressList = addressList
+	return nil
+}
+
+func (w *usbWallet) withDriver(ctx context.Context, fn func(d driver) error) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.driver == nil {
+		return i18n.NewError(ctx, signermsgs.MsgUSBWalletNoDevice, w.deviceType.name, w.conf.DevicePath)
+	}
+	return fn(w.driver)
+}
+
+// GetAccounts returns the addresses derived by the last Refresh
+func (w *usbWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+func (w *usbWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+// SignBig signs the transaction on the device, which shows it to the user for confirmation
+func (w *usbWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	path, err := w.getPathForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return txn.SignBig(&transactionSigner{ctx: ctx, w: w, path: path, address: from, txn: txn, chainID: chainID}, chainID)
+}
+
+// SignTypedDataV4 signs the domain separator and message hash of the typed data on the device
+func (w *usbWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	path, err := w.getPathForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return ethsigner.SignTypedDataV4Message(ctx, &typedDataSigner{ctx: ctx, w: w, path: path, address: from}, payload)
+}
+
+func (w *usbWallet) getPathForAddr(ctx context.Context, addr ethtypes.Address0xHex) (*accountPath, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	path, ok := w.addressPaths[addr]
+	if !ok {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+	}
+	return path, nil
+}
+
+// signature completes the R and S returned by the device with the V that recovers to the address
+func (w *usbWallet) signature(ctx context.Context, hash []byte, r, s *big.Int, addr ethtypes.Address0xHex) (*secp256k1.SignatureData, error) {
+	sig, ok := secp256k1.NewSignatureFromRS(hash, r, s, addr)
+	if !ok {
+		return nil, i18n.NewError(ctx, signermsgs.MsgUSBWalletSignatureInvalid, w.deviceType.name, addr)
+	}
+	return sig, nil
+}
+
+func (w *usbWallet) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.dev != nil {
+		w.driver = nil
+		return w.dev.Close()
+	}
+	return nil
+}
+
+// transactionSigner signs the payload of a transaction on the device, which needs the transaction (not
+// just the hash of the payload) so it can be shown to the user
+type transactionSigner struct {
+	ctx     context.Context
+	w       *usbWallet
+	path    *accountPath
+	address ethtypes.Address0xHex
+	txn     *ethsigner.Transaction
+	chainID *big.Int
+}
+
+func (s *transactionSigner) Sign(payload []byte) (*secp256k1.SignatureData, error) {
+	var r, sv *big.Int
+	err := s.w.withDriver(s.ctx, func(d driver) (err error) {
+		r, sv, err = d.signTransaction(s.ctx, s.path.indexes, s.txn, s.chainID, payload)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.w.signature(s.ctx, keccak256(payload), r, sv, s.address)
+}
+
+// typedDataSigner signs the 0x19 0x01 prefixed EIP-712 message, of the domain separator and message hash
+type typedDataSigner struct {
+	ctx     context.Context
+	w       *usbWallet
+	path    *accountPath
+	address ethtypes.Address0xHex
+}
+
+func (s *typedDataSigner) Sign(message []byte) (*secp256k1.SignatureData, error) {
+	var r, sv *big.Int
+	err := s.w.withDriver(s.ctx, func(d driver) (err error) {
+		r, sv, err = d.signTypedData(s.ctx, s.path.indexes, message[2:34], message[34:])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.w.signature(s.ctx, keccak256(message), r, sv, s.address)
+}
+
+func keccak256(b []byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(b)
+	return hash.Sum(nil)
+}
@@ -0,0 +1,284 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usbwallet
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMnemonic = "test test test test test test test test test test test junk"
+
+var (
+	testAddress0 = *ethtypes.MustNewAddress("0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266") // m/44'/60'/0'/0/0
+	testAddress1 = *ethtypes.MustNewAddress("0x70997970c51812dc3a010c7d01b50e0d17dc79c8") // m/44'/60'/0'/0/1
+)
+
+var enumerateDevicesDefault = enumerateDevices
+
+func newTestUSBWallet(t *testing.T, driverName string, dev device, setConfig ...func(section config.Section)) (context.Context, *usbWallet) {
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_usb_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ConfigDriver, driverName)
+	for _, fn := range setConfig {
+		fn(unitTestConfig)
+	}
+	ctx := context.Background()
+
+	enumerateDevices = func(ctx context.Context, ids []usbID) ([]*deviceInfo, error) {
+		assert.Equal(t, deviceTypes[driverName].ids, ids)
+		return []*deviceInfo{{path: "1-1:1.0", open: func() (device, error) { return dev, nil }}}, nil
+	}
+	t.Cleanup(func() { enumerateDevices = enumerateDevicesDefault })
+
+	w, err := NewUSBWallet(ctx, ReadConfig(unitTestConfig))
+	assert.NoError(t, err)
+	err = w.Initialize(ctx)
+	assert.NoError(t, err)
+	return ctx, w.(*usbWallet)
+}
+
+func newTestLedgerWallet(t *testing.T, setConfig ...func(section config.Section)) (context.Context, *usbWallet, *testLedger) {
+	d := newTestLedger(t)
+	ctx, w := newTestUSBWallet(t, DriverLedger, d, setConfig...)
+	return ctx, w, d
+}
+
+func testTransaction(t *testing.T, eip1559 bool) *ethsigner.Transaction {
+	txn := &ethsigner.Transaction{
+		From:     fftypes.JSONAnyPtr(fmt.Sprintf(`"%s"`, testAddress0)).Bytes(),
+		Nonce:    ethtypes.NewHexInteger64(3),
+		GasLimit: ethtypes.NewHexInteger64(100000),
+		To:       ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20"),
+		Value:    ethtypes.NewHexInteger64(1000000000),
+		Data:     ethtypes.MustNewHexBytes0xPrefix("0x12345678"),
+	}
+	if eip1559 {
+		txn.MaxFeePerGas = ethtypes.NewHexInteger64(30000000000)
+		txn.MaxPriorityFeePerGas = ethtypes.NewHexInteger64(1000000000)
+	} else {
+		txn.GasPrice = ethtypes.NewHexInteger64(20000000000)
+	}
+	return txn
+}
+
+// testTransactionAccessList is an EIP-2930 transaction, with a gas price and an access list
+func testTransactionAccessList(t *testing.T) *ethsigner.Transaction {
+	txn := testTransaction(t, false)
+	txn.AccessList = testAccessList()
+	return txn
+}
+
+// testTransactionBlob is an EIP-4844 blob transaction, without the blobs
+func testTransactionBlob(t *testing.T) *ethsigner.Transaction {
+	txn := testTransaction(t, true)
+	txn.MaxFeePerBlobGas = ethtypes.NewHexInteger64(1000000000)
+	txn.BlobVersionedHashes = []ethtypes.HexBytes0xPrefix{ethsigner.KZGToVersionedHash(make([]byte, ethsigner.KZGCommitmentSize))}
+	return txn
+}
+
+// testTransactionSetCode is an EIP-7702 set code transaction, with an authorization signed by another key
+func testTransactionSetCode(t *testing.T) *ethsigner.Transaction {
+	txn := testTransaction(t, true)
+	kp, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	auth := ethsigner.Authorization{ChainID: ethtypes.NewHexInteger64(1), Address: *ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20")}
+	assert.NoError(t, auth.Sign(kp))
+	txn.AuthorizationList = ethsigner.AuthorizationList{auth}
+	return txn
+}
+
+func testAccessList() ethsigner.AccessList {
+	return ethsigner.AccessList{{
+		Address:     *ethtypes.MustNewAddress("0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20"),
+		StorageKeys: []ethtypes.HexBytes0xPrefix{ethtypes.MustNewHexBytes0xPrefix("0x0000000000000000000000000000000000000000000000000000000000000001")},
+	}}
+}
+
+func assertSignedBy(t *testing.T, raw []byte, chainID int64, addr ethtypes.Address0xHex) *ethsigner.Transaction {
+	signer, signed, err := ethsigner.RecoverRawTransaction(context.Background(), raw, chainID)
+	assert.NoError(t, err)
+	assert.Equal(t, addr, *signer)
+	return signed.Transaction
+}
+
+func testTypedData() *eip712.TypedData {
+	return &eip712.TypedData{
+		Types: eip712.TypeSet{
+			eip712.EIP712Domain: {{Name: "name", Type: "string"}, {Name: "chainId", Type: "uint256"}},
+			"Transfer":          {{Name: "to", Type: "address"}, {Name: "amount", Type: "uint256"}},
+		},
+		PrimaryType: "Transfer",
+		Domain:      map[string]interface{}{"name": "test", "chainId": float64(1)},
+		Message:     map[string]interface{}{"to": "0x6ace7d7b5cc67b0e5ef8c16d3ea1b2b0d9f8bc20", "amount": "1000"},
+	}
+}
+
+func testTypedDataDomainOnly() *eip712.TypedData {
+	return &eip712.TypedData{
+		Types:       eip712.TypeSet{eip712.EIP712Domain: {{Name: "name", Type: "string"}}},
+		PrimaryType: eip712.EIP712Domain,
+		Domain:      map[string]interface{}{"name": "test"},
+	}
+}
+
+func testSignAll(t *testing.T, ctx context.Context, w *usbWallet) {
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&testAddress0, &testAddress1}, accounts)
+
+	// EIP-155
+	raw, err := w.Sign(ctx, testTransaction(t, false), 1337)
+	assert.NoError(t, err)
+	signed := assertSignedBy(t, raw, 1337, testAddress0)
+	assert.Equal(t, "0x12345678", signed.Data.String())
+
+	// EIP-1559 from the second account, with a chain ID that does not fit in the V byte of the device reply
+	txn := testTransaction(t, true)
+	txn.From = fftypes.JSONAnyPtr(fmt.Sprintf(`"%s"`, testAddress1)).Bytes()
+	raw, err = w.SignBig(ctx, txn, big.NewInt(11155111))
+	assert.NoError(t, err)
+	signed = assertSignedBy(t, raw, 11155111, testAddress1)
+	assert.Equal(t, int64(30000000000), signed.MaxFeePerGas.BigInt().Int64())
+
+	// Contract deployment, without a to address
+	txn = testTransaction(t, false)
+	txn.To = nil
+	raw, err = w.Sign(ctx, txn, 1)
+	assert.NoError(t, err)
+	assertSignedBy(t, raw, 1, testAddress0)
+
+	result, err := w.SignTypedDataV4(ctx, testAddress0, testTypedData())
+	assert.NoError(t, err)
+	hash, err := eip712.EncodeTypedDataV4(ctx, testTypedData())
+	assert.NoError(t, err)
+	assert.Equal(t, hash, result.Hash)
+	sig, err := secp256k1.DecodeCompactRSV(ctx, result.SignatureRSV)
+	assert.NoError(t, err)
+	addr, err := sig.RecoverDirect(hash, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, testAddress0, *addr)
+
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: []byte(`"0x0000000000000000000000000000000000000000"`)}, 1)
+	assert.Regexp(t, "FF22014", err)
+	_, err = w.SignTypedDataV4(ctx, ethtypes.Address0xHex{}, testTypedData())
+	assert.Regexp(t, "FF22014", err)
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: []byte(`!json`)}, 1)
+	assert.Error(t, err)
+}
+
+func TestLedgerWalletSignOK(t *testing.T) {
+
+	ctx, w, d := newTestLedgerWallet(t, func(section config.Section) {
+		section.Set(ConfigDiscoveryCount, 2)
+	})
+
+	testSignAll(t, ctx, w)
+
+	err := w.Close()
+	assert.NoError(t, err)
+	assert.True(t, d.closed)
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22202", err)
+
+}
+
+func TestNewUSBWalletBadConfig(t *testing.T) {
+
+	ctx := context.Background()
+	_, err := NewUSBWallet(ctx, &Config{Driver: "wrong"})
+	assert.Regexp(t, "FF22201", err)
+
+	_, err = NewUSBWallet(ctx, &Config{Driver: DriverLedger, DerivationPaths: []string{"m"}})
+	assert.Regexp(t, "FF22204.*master", err)
+
+	_, err = NewUSBWallet(ctx, &Config{Driver: DriverTrezor, Discovery: DiscoveryConfig{BasePath: "m/wrong", Count: 1}})
+	assert.Regexp(t, "FF22204.*m/wrong/0", err)
+
+}
+
+func TestInitializeFail(t *testing.T) {
+
+	ctx := context.Background()
+	w, err := NewUSBWallet(ctx, &Config{Driver: DriverLedger, DevicePath: "1-2:1.0", DerivationPaths: []string{"m/44'/60'/0'/0/0"}})
+	assert.NoError(t, err)
+	defer func() { enumerateDevices = enumerateDevicesDefault }()
+
+	enumerateDevices = func(ctx context.Context, ids []usbID) ([]*deviceInfo, error) {
+		return nil, fmt.Errorf("pop")
+	}
+	err = w.Initialize(ctx)
+	assert.Regexp(t, "pop", err)
+
+	enumerateDevices = func(ctx context.Context, ids []usbID) ([]*deviceInfo, error) {
+		return []*deviceInfo{{path: "1-1:1.0"}}, nil
+	}
+	err = w.Initialize(ctx)
+	assert.Regexp(t, "FF22202.*Ledger.*1-2:1.0", err)
+
+	d := newTestLedger(t)
+	enumerateDevices = func(ctx context.Context, ids []usbID) ([]*deviceInfo, error) {
+		return []*deviceInfo{
+			{path: "1-1:1.0"},
+			{path: "1-2:1.0", open: func() (device, error) { return d, nil }},
+		}, nil
+	}
+	d.status = 0x6e00
+	err = w.Initialize(ctx)
+	assert.Regexp(t, "FF22206", err)
+
+	d.status = 0
+	d.reply = []byte{0x00, 0x01, 0x0a, 0x03}
+	err = w.Initialize(ctx)
+	assert.Regexp(t, "FF22203.*invalid address", err)
+
+	err = w.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestNotInitialized(t *testing.T) {
+
+	ctx := context.Background()
+	w, err := NewUSBWallet(ctx, &Config{Driver: DriverTrezor, DerivationPaths: []string{"m/44'/60'/0'/0/0"}})
+	assert.NoError(t, err)
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22202", err)
+	err = w.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestFirmwareVersion(t *testing.T) {
+
+	assert.True(t, firmwareVersion{1, 9, 0}.atLeast(1, 9, 0))
+	assert.True(t, firmwareVersion{2, 0, 0}.atLeast(1, 9, 19))
+	assert.False(t, firmwareVersion{1, 8, 99}.atLeast(1, 9, 0))
+	assert.Equal(t, "2.4.2", firmwareVersion{2, 4, 2}.String())
+
+}
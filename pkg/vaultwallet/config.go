@@ -0,0 +1,77 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultwallet
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+)
+
+const (
+	// ConfigToken the Vault token, sent in the X-Vault-Token header
+	ConfigToken = "token"
+	// ConfigKVMount the path the KV version 2 secrets engine is mounted at
+	ConfigKVMount = "kv.mount"
+	// ConfigKVPath the path within the KV secrets engine under which there is a secret for each key, named by its address
+	ConfigKVPath = "kv.path"
+	// ConfigSignerCacheSize the number of signing keys to keep in memory
+	ConfigSignerCacheSize = "signerCacheSize"
+	// ConfigSignerCacheTTL the time to keep an unused signing key in memory
+	ConfigSignerCacheTTL = "signerCacheTTL"
+)
+
+type Config struct {
+	HTTP            ffresty.Config
+	Token           string
+	KV              KVConfig
+	SignerCacheSize string
+	SignerCacheTTL  time.Duration
+}
+
+type KVConfig struct {
+	Mount string
+	Path  string
+}
+
+func InitConfig(section config.Section) {
+	ffresty.InitConfig(section)
+	section.AddKnownKey(ConfigToken)
+	section.AddKnownKey(ConfigKVMount, "secret")
+	section.AddKnownKey(ConfigKVPath, "firefly-signer/keys")
+	section.AddKnownKey(ConfigSignerCacheSize, 250)
+	section.AddKnownKey(ConfigSignerCacheTTL, "24h")
+}
+
+func ReadConfig(ctx context.Context, section config.Section) (*Config, error) {
+	httpConf, err := ffresty.GenerateConfig(ctx, section)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		HTTP:  *httpConf,
+		Token: section.GetString(ConfigToken),
+		KV: KVConfig{
+			Mount: section.GetString(ConfigKVMount),
+			Path:  section.GetString(ConfigKVPath),
+		},
+		SignerCacheSize: section.GetString(ConfigSignerCacheSize),
+		SignerCacheTTL:  section.GetDuration(ConfigSignerCacheTTL),
+	}, nil
+}
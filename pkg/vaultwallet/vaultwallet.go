@@ -0,0 +1,408 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultwallet
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/karlseguin/ccache"
+	"golang.org/x/sync/singleflight"
+)
+
+// Wallet signs with keys held in the HashiCorp Vault KV (version 2) secrets engine, with a secret for each
+// key named by its address (with or without the 0x prefix). The secret contains either the hex private key
+// in a "privateKey" field, or a keystore V3 file in a "keystore" field with its password in a "password" field.
+//
+// Keys are loaded into a signer cache on first use, as for the filesystem wallet. The Vault Transit secrets
+// engine does not support secp256k1 keys, so keys cannot be kept in Vault for remote signing.
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	// ListAccounts returns a page of the indexed accounts, in the order they were indexed (Vault lists
+	// secrets in name order, so this is address order for the accounts found by the first Refresh)
+	ListAccounts(ctx context.Context, skip, limit int) ([]*ethtypes.Address0xHex, error)
+	// AccountCount returns the number of accounts indexed so far
+	AccountCount(ctx context.Context) (int, error)
+	// InvalidateCache removes any cached key for the address, so it is re-read from Vault on next use
+	InvalidateCache(ctx context.Context, addr ethtypes.Address0xHex)
+	// HealthCheck returns an error if Vault cannot be reached, or the token cannot list the KV path
+	HealthCheck(ctx context.Context) error
+}
+
+type vaultWallet struct {
+	conf          Config
+	client        *resty.Client
+	signerCache   *ccache.Cache
+	inflightLoads singleflight.Group
+	closeMux      sync.RWMutex // held for read while using the signer cache, so it is not used after Close stops it
+	closed        bool
+
+	mux         sync.Mutex
+	secretNames map[ethtypes.Address0xHex]string // the name of the secret for each indexed address
+	addressList []*ethtypes.Address0xHex         // ordered list in listing order, then the order keys were found (append only)
+	cachedKeys  map[*cachedKey]bool              // keys loaded into the signer cache, so they can be zeroed on Close
+}
+
+// cachedKey is a key pair in the signer cache, which is zeroed when it is evicted. Signers take
+// a copy of the key pair, so a key evicted while in use is not zeroed under them.
+type cachedKey struct {
+	mux     sync.Mutex
+	keypair *secp256k1.KeyPair
+}
+
+type kvListResponse struct {
+	Data struct {
+		Keys []string `json:"keys"`
+	} `json:"data"`
+}
+
+type kvReadResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+func NewVaultWallet(ctx context.Context, conf *Config) (Wallet, error) {
+	w := &vaultWallet{
+		conf:        *conf,
+		client:      ffresty.NewWithConfig(ctx, conf.HTTP),
+		secretNames: make(map[ethtypes.Address0xHex]string),
+		cachedKeys:  make(map[*cachedKey]bool),
+	}
+	if conf.Token != "" {
+		w.client.SetHeader("X-Vault-Token", conf.Token)
+	}
+	w.signerCache = ccache.New(
+		// We use a LRU cache with a size-aware max
+		ccache.Configure().
+			MaxSize(fftypes.ParseToByteSize(conf.SignerCacheSize)).
+			OnDelete(func(item *ccache.Item) {
+				w.destroyKey(item.Value().(*cachedKey))
+			}),
+	)
+	return w, nil
+}
+
+func (w *vaultWallet) Initialize(ctx context.Context) error {
+	return w.Refresh(ctx)
+}
+
+// Refresh lists the secrets in Vault, indexing any that are named by an address and have not been seen before
+func (w *vaultWallet) Refresh(ctx context.Context) error {
+	names, err := w.listSecrets(ctx)
+	if err != nil {
+		return err
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		addr, err := ethtypes.NewAddress(name)
+		if err != nil {
+			log.L(ctx).Tracef("Ignoring secret '%s': %s", name, err)
+			continue
+		}
+		w.indexAddress(ctx, *addr, name)
+	}
+	return nil
+}
+
+// HealthCheck lists the secrets in Vault without indexing them, which checks that Vault is reachable, and
+// that the token is valid and has access to the KV path
+func (w *vaultWallet) HealthCheck(ctx context.Context) error {
+	_, err := w.listSecrets(ctx)
+	return err
+}
+
+func (w *vaultWallet) listSecrets(ctx context.Context) ([]string, error) {
+	var list kvListResponse
+	res, err := w.client.R().
+		SetContext(ctx).
+		SetResult(&list).
+		Execute("LIST", w.secretURL("metadata", ""))
+	if err == nil && res.StatusCode() == http.StatusNotFound {
+		// Vault returns a 404 when there are no secrets under the path
+		return nil, nil
+	}
+	if err != nil || res.IsError() {
+		return nil, ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgVaultRequestFailed)
+	}
+	return list.Data.Keys, nil
+}
+
+// indexAddress adds an address to the account list, if it is not already indexed. Called with the mux held.
+func (w *vaultWallet) indexAddress(ctx context.Context, addr ethtypes.Address0xHex, name string) {
+	if _, exists := w.secretNames[addr]; exists {
+		return
+	}
+	log.L(ctx).Debugf("Added address: %s (secret=%s)", addr, name)
+	w.secretNames[addr] = name
+	w.addressList = append(w.addressList, &addr)
+}
+
+func (w *vaultWallet) secretURL(kind, name string) string {
+	p := strings.Trim(w.conf.KV.Mount, "/") + "/" + kind + "/" + strings.Trim(w.conf.KV.Path, "/")
+	if name != "" {
+		p += "/" + name
+	}
+	return "/v1/" + p
+}
+
+// GetAccounts returns the currently cached list of known addresses
+func (w *vaultWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+// ListAccounts returns a page of the currently cached list of known addresses. A limit
+// of zero or less returns all accounts after the skip.
+func (w *vaultWallet) ListAccounts(_ context.Context, skip, limit int) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if skip < 0 {
+		skip = 0
+	}
+	if skip >= len(w.addressList) {
+		return []*ethtypes.Address0xHex{}, nil
+	}
+	end := len(w.addressList)
+	if limit > 0 && skip+limit < end {
+		end = skip + limit
+	}
+	accounts := make([]*ethtypes.Address0xHex, end-skip)
+	copy(accounts, w.addressList[skip:end])
+	return accounts, nil
+}
+
+func (w *vaultWallet) AccountCount(_ context.Context) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return len(w.addressList), nil
+}
+
+func (w *vaultWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *vaultWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	keypair, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return txn.SignBig(keypair, chainID)
+}
+
+func (w *vaultWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	keypair, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	defer keypair.Destroy()
+	return ethsigner.SignTypedDataV4(ctx, keypair, payload)
+}
+
+// getSignerForAddr returns a copy of the key pair for the address, which the caller destroys once it has
+// finished signing. Loads are de-duplicated, so concurrent requests for a key not in the cache read it once.
+func (w *vaultWallet) getSignerForAddr(ctx context.Context, addr ethtypes.Address0xHex) (*secp256k1.KeyPair, error) {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+	if w.closed {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWalletClosed)
+	}
+	addrString := addr.String()
+	for {
+		if item := w.signerCache.Get(addrString); item != nil && !item.Expired() {
+			item.Extend(w.conf.SignerCacheTTL)
+			if keypair := item.Value().(*cachedKey).copy(); keypair != nil {
+				return keypair, nil
+			}
+		}
+		res, err, _ := w.inflightLoads.Do(addrString, func() (interface{}, error) {
+			keypair, err := w.loadKey(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			ck := &cachedKey{keypair: keypair}
+			w.mux.Lock()
+			w.cachedKeys[ck] = true
+			w.mux.Unlock()
+			w.signerCache.Set(addrString, ck, w.conf.SignerCacheTTL)
+			return ck, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The key is only nil if it was evicted and zeroed already, in which case we load it again
+		if keypair := res.(*cachedKey).copy(); keypair != nil {
+			return keypair, nil
+		}
+	}
+}
+
+// loadKey reads the secret for the address from Vault. An address that has not been indexed is looked
+// up by name, and added to the account list if found.
+func (w *vaultWallet) loadKey(ctx context.Context, addr ethtypes.Address0xHex) (*secp256k1.KeyPair, error) {
+	w.mux.Lock()
+	name, indexed := w.secretNames[addr]
+	w.mux.Unlock()
+	names := []string{name}
+	if !indexed {
+		names = []string{strings.TrimPrefix(addr.String(), "0x"), addr.String()}
+	}
+	for _, name := range names {
+		var secret kvReadResponse
+		res, err := w.client.R().
+			SetContext(ctx).
+			SetResult(&secret).
+			Get(w.secretURL("data", name))
+		if err == nil && res.StatusCode() == http.StatusNotFound {
+			continue
+		}
+		if err != nil || res.IsError() {
+			return nil, ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgVaultRequestFailed)
+		}
+		keypair, err := keyPairFromSecret(ctx, name, secret.Data.Data)
+		if err != nil {
+			return nil, err
+		}
+		if keypair.Address != addr {
+			keypair.Destroy()
+			return nil, i18n.NewError(ctx, signermsgs.MsgAddressMismatch, keypair.Address, addr)
+		}
+		if !indexed {
+			w.mux.Lock()
+			w.indexAddress(ctx, addr, name)
+			w.mux.Unlock()
+		}
+		log.L(ctx).Infof("Loaded signing key for address: %s", addr)
+		return keypair, nil
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+}
+
+func keyPairFromSecret(ctx context.Context, name string, data map[string]interface{}) (*secp256k1.KeyPair, error) {
+	if privateKey, ok := data["privateKey"].(string); ok {
+		b, err := hex.DecodeString(strings.TrimPrefix(privateKey, "0x"))
+		if err == nil {
+			err = secp256k1.ValidatePrivateKeyBytes(b)
+		}
+		if err != nil {
+			return nil, i18n.NewError(ctx, signermsgs.MsgVaultSecretInvalid, name, err)
+		}
+		return secp256k1.KeyPairFromBytes(b), nil
+	}
+	var keystore []byte
+	switch v := data["keystore"].(type) {
+	case string:
+		keystore = []byte(v)
+	case map[string]interface{}:
+		keystore, _ = json.Marshal(v)
+	default:
+		return nil, i18n.NewError(ctx, signermsgs.MsgVaultSecretInvalid, name, "no privateKey or keystore field")
+	}
+	password, _ := data["password"].(string)
+	wf, err := keystorev3.ReadWalletFileCtx(ctx, keystore, []byte(password))
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgVaultSecretInvalid, name, err)
+	}
+	return wf.KeyPair(), nil
+}
+
+// InvalidateCache removes any cached key for the address, so it is re-read from Vault on next use
+func (w *vaultWallet) InvalidateCache(_ context.Context, addr ethtypes.Address0xHex) {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+	if w.closed {
+		return
+	}
+	addrString := addr.String()
+	// The cache only calls OnDelete for items its worker has already promoted, so destroy directly as well
+	if item := w.signerCache.Get(addrString); item != nil {
+		w.signerCache.Delete(addrString)
+		w.destroyKey(item.Value().(*cachedKey))
+	}
+}
+
+// destroyKey zeroes a key removed from the signer cache
+func (w *vaultWallet) destroyKey(ck *cachedKey) {
+	w.mux.Lock()
+	delete(w.cachedKeys, ck)
+	w.mux.Unlock()
+	ck.destroy()
+}
+
+// Close stops the signer cache, and zeroes all the keys that were loaded into it
+func (w *vaultWallet) Close() error {
+	w.closeMux.Lock()
+	defer w.closeMux.Unlock()
+	if !w.closed {
+		w.closed = true
+		w.signerCache.Stop()
+		w.mux.Lock()
+		for ck := range w.cachedKeys {
+			ck.destroy()
+		}
+		w.cachedKeys = make(map[*cachedKey]bool)
+		w.mux.Unlock()
+	}
+	return nil
+}
+
+func (ck *cachedKey) copy() *secp256k1.KeyPair {
+	ck.mux.Lock()
+	defer ck.mux.Unlock()
+	if ck.keypair == nil {
+		return nil
+	}
+	return secp256k1.KeyPairFromBytes(ck.keypair.PrivateKeyBytes())
+}
+
+func (ck *cachedKey) destroy() {
+	ck.mux.Lock()
+	defer ck.mux.Unlock()
+	if ck.keypair != nil {
+		ck.keypair.Destroy()
+		ck.keypair = nil
+	}
+}
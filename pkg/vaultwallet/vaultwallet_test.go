@@ -0,0 +1,364 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultwallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/keystorev3"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "s.testtoken"
+
+// testVault is a minimal Vault KV version 2 server, with secrets under secret/firefly-signer/keys
+type testVault struct {
+	mux       sync.Mutex
+	secrets   map[string]map[string]interface{}
+	extraList []string
+	reads     map[string]int
+	status    int
+}
+
+func (tv *testVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tv.mux.Lock()
+	defer tv.mux.Unlock()
+	if r.Header.Get("X-Vault-Token") != testToken {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if tv.status != 0 {
+		w.WriteHeader(tv.status)
+		_, _ = w.Write([]byte(`{"errors":["pop"]}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == "LIST" && r.URL.Path == "/v1/secret/metadata/firefly-signer/keys":
+		keys := append([]string{}, tv.extraList...)
+		for name := range tv.secrets {
+			if !strings.HasPrefix(name, "0x") {
+				keys = append(keys, name)
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/secret/data/firefly-signer/keys/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/firefly-signer/keys/")
+		tv.reads[name]++
+		data, ok := tv.secrets[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (tv *testVault) readCount(name string) int {
+	tv.mux.Lock()
+	defer tv.mux.Unlock()
+	return tv.reads[name]
+}
+
+func newTestVaultWallet(t *testing.T) (context.Context, *vaultWallet, *testVault, func()) {
+	tv := &testVault{
+		secrets: make(map[string]map[string]interface{}),
+		reads:   make(map[string]int),
+	}
+	server := httptest.NewServer(tv)
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_vault_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ffresty.HTTPConfigURL, server.URL)
+	unitTestConfig.Set(ffresty.HTTPConfigRetryEnabled, false)
+	unitTestConfig.Set(ConfigToken, testToken)
+	ctx := context.Background()
+
+	conf, err := ReadConfig(ctx, unitTestConfig)
+	assert.NoError(t, err)
+	w, err := NewVaultWallet(ctx, conf)
+	assert.NoError(t, err)
+
+	return ctx, w.(*vaultWallet), tv, func() {
+		w.Close()
+		server.Close()
+	}
+}
+
+func newTestKey(t *testing.T) *secp256k1.KeyPair {
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	return keypair
+}
+
+func TestVaultWalletSignOK(t *testing.T) {
+
+	ctx, w, tv, done := newTestVaultWallet(t)
+	defer done()
+
+	hexKey := newTestKey(t)
+	hexName := hexKey.Address.String()[2:]
+	tv.secrets[hexName] = map[string]interface{}{
+		"privateKey": fmt.Sprintf("0x%x", hexKey.PrivateKeyBytes()),
+	}
+	keystoreKey := newTestKey(t)
+	tv.secrets[keystoreKey.Address.String()[2:]] = map[string]interface{}{
+		"keystore": string(keystorev3.NewWalletFileLight("pass", keystoreKey).JSON()),
+		"password": "pass",
+	}
+	tv.extraList = []string{"subfolder/", "not-an-address"}
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 2)
+	assert.ElementsMatch(t, []string{hexKey.Address.String(), keystoreKey.Address.String()}, []string{accounts[0].String(), accounts[1].String()})
+
+	count, err := w.AccountCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	page, err := w.ListAccounts(ctx, 1, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, accounts[1:], page)
+
+	page, err = w.ListAccounts(ctx, -1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, accounts[0:1], page)
+
+	page, err = w.ListAccounts(ctx, 2, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+
+	for _, keypair := range []*secp256k1.KeyPair{hexKey, keystoreKey} {
+		txn := &ethsigner.Transaction{
+			From:  json.RawMessage(fmt.Sprintf(`"%s"`, keypair.Address)),
+			Nonce: ethtypes.NewHexInteger64(1),
+		}
+		signed, err := w.Sign(ctx, txn, 2022)
+		assert.NoError(t, err)
+		expected, err := txn.Sign(keypair, 2022)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, signed)
+	}
+
+	// Served from the cache
+	result, err := w.SignTypedDataV4(ctx, hexKey.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, 1, tv.readCount(hexName))
+
+	// Re-read once invalidated
+	w.InvalidateCache(ctx, hexKey.Address)
+	_, err = w.SignTypedDataV4(ctx, hexKey.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, tv.readCount(hexName))
+
+}
+
+func TestVaultWalletLookupNotIndexed(t *testing.T) {
+
+	ctx, w, tv, done := newTestVaultWallet(t)
+	defer done()
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	keypair := newTestKey(t)
+	tv.secrets[keypair.Address.String()] = map[string]interface{}{
+		"keystore": json.RawMessage(keystorev3.NewWalletFileLight("pass", keypair).JSON()),
+		"password": "pass",
+	}
+
+	_, err = w.SignTypedDataV4(ctx, keypair.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&keypair.Address}, accounts)
+	assert.Equal(t, "0x"+keypair.Address.String()[2:], w.secretNames[keypair.Address])
+
+}
+
+func TestVaultWalletNotFound(t *testing.T) {
+
+	ctx, w, _, done := newTestVaultWallet(t)
+	defer done()
+
+	_, err := w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestVaultWalletAddressMismatch(t *testing.T) {
+
+	ctx, w, tv, done := newTestVaultWallet(t)
+	defer done()
+
+	keypair := newTestKey(t)
+	tv.secrets["ffffffffffffffffffffffffffffffffffffffff"] = map[string]interface{}{
+		"privateKey": fmt.Sprintf("%x", keypair.PrivateKeyBytes()),
+	}
+
+	_, err := w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22059", err)
+
+}
+
+func TestVaultWalletBadSecrets(t *testing.T) {
+
+	ctx, w, tv, done := newTestVaultWallet(t)
+	defer done()
+
+	keypair := newTestKey(t)
+	for _, data := range []map[string]interface{}{
+		{},
+		{"privateKey": "not hex"},
+		{"privateKey": "00"},
+		{"keystore": "{}", "password": "pass"},
+		{"keystore": string(keystorev3.NewWalletFileLight("pass", keypair).JSON()), "password": "wrong"},
+	} {
+		tv.secrets[keypair.Address.String()[2:]] = data
+		w.InvalidateCache(ctx, keypair.Address)
+		_, err := w.SignTypedDataV4(ctx, keypair.Address, &eip712.TypedData{
+			PrimaryType: eip712.EIP712Domain,
+		})
+		assert.Regexp(t, "FF22154", err)
+	}
+
+}
+
+func TestVaultWalletRequestFailures(t *testing.T) {
+
+	ctx, w, tv, done := newTestVaultWallet(t)
+	defer done()
+
+	tv.status = http.StatusInternalServerError
+
+	err := w.Refresh(ctx)
+	assert.Regexp(t, "FF22153.*pop", err)
+
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22153.*pop", err)
+
+}
+
+func TestVaultWalletHealthCheck(t *testing.T) {
+
+	ctx, w, tv, done := newTestVaultWallet(t)
+	defer done()
+
+	// An empty path is healthy
+	assert.NoError(t, w.HealthCheck(ctx))
+
+	tv.mux.Lock()
+	tv.status = http.StatusForbidden
+	tv.mux.Unlock()
+	assert.Regexp(t, "FF22153.*pop", w.HealthCheck(ctx))
+
+	// Nothing is indexed by a health check
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, accounts)
+
+}
+
+func TestVaultWalletBadFrom(t *testing.T) {
+
+	ctx, w, _, done := newTestVaultWallet(t)
+	defer done()
+
+	_, err := w.Sign(ctx, &ethsigner.Transaction{
+		From: json.RawMessage(`"bad"`),
+	}, 2022)
+	assert.Regexp(t, "bad address", err)
+
+}
+
+func TestVaultWalletClosed(t *testing.T) {
+
+	ctx, w, tv, done := newTestVaultWallet(t)
+	defer done()
+
+	keypair := newTestKey(t)
+	tv.secrets[keypair.Address.String()[2:]] = map[string]interface{}{
+		"privateKey": fmt.Sprintf("%x", keypair.PrivateKeyBytes()),
+	}
+	_, err := w.SignTypedDataV4(ctx, keypair.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.NoError(t, err)
+	var ck *cachedKey
+	for ck = range w.cachedKeys {
+	}
+
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Nil(t, ck.keypair)
+	assert.Empty(t, w.cachedKeys)
+	w.InvalidateCache(ctx, keypair.Address)
+
+	_, err = w.SignTypedDataV4(ctx, keypair.Address, &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22103", err)
+
+}
+
+func TestCachedKeyDestroyed(t *testing.T) {
+
+	ck := &cachedKey{keypair: newTestKey(t)}
+	assert.NotNil(t, ck.copy())
+	ck.destroy()
+	assert.Nil(t, ck.copy())
+	ck.destroy()
+
+}
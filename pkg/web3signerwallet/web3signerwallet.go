@@ -0,0 +1,231 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web3signerwallet
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-signer/internal/signermsgs"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+// web3SignerWallet signs with the secp256k1 keys loaded into a Consensys Web3Signer, using its eth1 REST API,
+// so the private keys never leave Web3Signer. Each account is identified to Web3Signer by its public key.
+// Web3Signer hashes the data it signs, so typed data is sent as the prefixed message rather than its hash.
+type web3SignerWallet struct {
+	conf   Config
+	client *resty.Client
+
+	mux         sync.Mutex
+	keys        map[ethtypes.Address0xHex]*web3SignerKey
+	addressList []*ethtypes.Address0xHex // in the order Web3Signer lists the keys
+}
+
+type web3SignerKey struct {
+	publicKey string // the identifier of the key in Web3Signer
+	address   ethtypes.Address0xHex
+}
+
+// web3Signer implements secp256k1.Signer by signing in Web3Signer. The R and S values of the signature
+// are checked against the address, and the V value is the one that recovers to it.
+type web3Signer struct {
+	ctx context.Context
+	w   *web3SignerWallet
+	key *web3SignerKey
+}
+
+type signRequest struct {
+	Data ethtypes.HexBytes0xPrefix `json:"data"`
+}
+
+// Wallet is the Web3Signer wallet, which supports transactions and EIP-712 typed data
+type Wallet interface {
+	ethsigner.WalletTypedData
+	ethsigner.BigChainIDWallet
+	ethsigner.HealthCheckWallet
+}
+
+func NewWeb3SignerWallet(ctx context.Context, conf *Config) (Wallet, error) {
+	w := &web3SignerWallet{
+		conf:   *conf,
+		client: ffresty.NewWithConfig(ctx, conf.HTTP),
+		keys:   make(map[ethtypes.Address0xHex]*web3SignerKey),
+	}
+	return w, nil
+}
+
+func (w *web3SignerWallet) Initialize(ctx context.Context) error {
+	return w.Refresh(ctx)
+}
+
+// Refresh reads the list of public keys from Web3Signer, replacing the accounts of the wallet, as keys
+// can be removed as well as added when Web3Signer reloads its key configuration
+func (w *web3SignerWallet) Refresh(ctx context.Context) error {
+	var publicKeys []string
+	res, err := w.client.R().
+		SetContext(ctx).
+		SetResult(&publicKeys).
+		Get("/api/v1/eth1/publicKeys")
+	if err != nil || res.IsError() {
+		return ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgWeb3SignerRequestFailed)
+	}
+	keys := make(map[ethtypes.Address0xHex]*web3SignerKey, len(publicKeys))
+	addressList := make([]*ethtypes.Address0xHex, 0, len(publicKeys))
+	for _, publicKey := range publicKeys {
+		address, err := addressFromPublicKey(ctx, publicKey)
+		if err != nil {
+			return err
+		}
+		if _, exists := keys[*address]; !exists {
+			keys[*address] = &web3SignerKey{publicKey: publicKey, address: *address}
+			addressList = append(addressList, address)
+		}
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for _, address := range addressList {
+		if _, known := w.keys[*address]; !known {
+			log.L(ctx).Debugf("Added address: %s", address)
+		}
+	}
+	w.keys = keys
+	w.addressList = addressList
+	return nil
+}
+
+// HealthCheck calls the Web3Signer upcheck endpoint, which checks that Web3Signer is reachable and running
+func (w *web3SignerWallet) HealthCheck(ctx context.Context) error {
+	res, err := w.client.R().
+		SetContext(ctx).
+		Get("/upcheck")
+	if err != nil || res.IsError() {
+		return ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgWeb3SignerRequestFailed)
+	}
+	return nil
+}
+
+// addressFromPublicKey accepts the 64 byte X and Y coordinates Web3Signer returns, as well as the
+// uncompressed (0x04 prefixed) and compressed forms of the public key
+func addressFromPublicKey(ctx context.Context, publicKey string) (*ethtypes.Address0xHex, error) {
+	b, err := ethtypes.NewHexBytes0xPrefix(publicKey)
+	if err == nil && len(b) == 64 {
+		b = append([]byte{0x04}, b...)
+	}
+	var pubKey *btcec.PublicKey
+	if err == nil {
+		pubKey, err = btcec.ParsePubKey(b)
+	}
+	if err != nil {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWeb3SignerBadPublicKey, publicKey, err)
+	}
+	return secp256k1.PublicKeyToAddress(pubKey), nil
+}
+
+// GetAccounts returns the accounts read from Web3Signer by the last Refresh
+func (w *web3SignerWallet) GetAccounts(_ context.Context) ([]*ethtypes.Address0xHex, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	accounts := make([]*ethtypes.Address0xHex, len(w.addressList))
+	copy(accounts, w.addressList)
+	return accounts, nil
+}
+
+func (w *web3SignerWallet) Sign(ctx context.Context, txn *ethsigner.Transaction, chainID int64) ([]byte, error) {
+	return w.SignBig(ctx, txn, big.NewInt(chainID))
+}
+
+func (w *web3SignerWallet) SignBig(ctx context.Context, txn *ethsigner.Transaction, chainID *big.Int) ([]byte, error) {
+	var from ethtypes.Address0xHex
+	if err := json.Unmarshal(txn.From, &from); err != nil {
+		return nil, err
+	}
+	signer, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return txn.SignBig(signer, chainID)
+}
+
+func (w *web3SignerWallet) SignTypedDataV4(ctx context.Context, from ethtypes.Address0xHex, payload *eip712.TypedData) (*ethsigner.EIP712Result, error) {
+	signer, err := w.getSignerForAddr(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	return ethsigner.SignTypedDataV4Message(ctx, signer, payload)
+}
+
+// getSignerForAddr returns a signer for the key with the address, re-reading the keys once
+// if the address is not known (as the key might have been added since the last Refresh)
+func (w *web3SignerWallet) getSignerForAddr(ctx context.Context, addr ethtypes.Address0xHex) (*web3Signer, error) {
+	w.mux.Lock()
+	key, ok := w.keys[addr]
+	w.mux.Unlock()
+	if !ok {
+		if err := w.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		w.mux.Lock()
+		key, ok = w.keys[addr]
+		w.mux.Unlock()
+		if !ok {
+			return nil, i18n.NewError(ctx, signermsgs.MsgWalletNotAvailable, addr)
+		}
+	}
+	return &web3Signer{ctx: ctx, w: w, key: key}, nil
+}
+
+func (w *web3SignerWallet) Close() error {
+	return nil
+}
+
+// Sign sends the message to Web3Signer, which hashes it then signs it, returning a low-S signature with a 27/28 V value
+func (s *web3Signer) Sign(message []byte) (*secp256k1.SignatureData, error) {
+	ctx := s.ctx
+	res, err := s.w.client.R().
+		SetContext(ctx).
+		SetPathParam("identifier", s.key.publicKey).
+		SetBody(&signRequest{Data: message}).
+		Post("/api/v1/eth1/sign/{identifier}")
+	if err != nil || res.IsError() {
+		return nil, ffresty.WrapRestErr(ctx, res, err, signermsgs.MsgWeb3SignerRequestFailed)
+	}
+	// The signature is returned as hex text, R (32B), S (32B), V (1B)
+	rsv, err := ethtypes.NewHexBytes0xPrefix(strings.Trim(strings.TrimSpace(res.String()), `"`))
+	if err != nil || len(rsv) != 65 {
+		return nil, i18n.NewError(ctx, signermsgs.MsgWeb3SignerSignatureInvalid, s.key.address)
+	}
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(message)
+	sig, ok := secp256k1.NewSignatureFromRS(hash.Sum(nil), new(big.Int).SetBytes(rsv[0:32]), new(big.Int).SetBytes(rsv[32:64]), s.key.address)
+	if ok {
+		return sig, nil
+	}
+	return nil, i18n.NewError(ctx, signermsgs.MsgWeb3SignerSignatureInvalid, s.key.address)
+}
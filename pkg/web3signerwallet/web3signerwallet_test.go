@@ -0,0 +1,322 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web3signerwallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-signer/pkg/eip712"
+	"github.com/hyperledger/firefly-signer/pkg/ethsigner"
+	"github.com/hyperledger/firefly-signer/pkg/ethtypes"
+	"github.com/hyperledger/firefly-signer/pkg/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+// testWeb3Signer is a minimal Web3Signer eth1 REST API
+type testWeb3Signer struct {
+	mux          sync.Mutex
+	keys         map[string]*secp256k1.KeyPair // by public key identifier
+	order        []string
+	signRequests int
+	highS        bool
+	badSignature bool
+	status       int
+}
+
+func (tw *testWeb3Signer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if tw.status != 0 {
+		w.WriteHeader(tw.status)
+		_, _ = w.Write([]byte(`pop`))
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/upcheck":
+		_, _ = w.Write([]byte(`OK`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/eth1/publicKeys":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tw.order)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/v1/eth1/sign/"):
+		tw.signRequests++
+		keypair, ok := tw.keys[strings.TrimPrefix(r.URL.Path, "/api/v1/eth1/sign/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req signRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		sig, _ := keypair.Sign(req.Data)
+		if tw.highS {
+			sig.S.Sub(btcec.S256().N, sig.S)
+		}
+		rsv := make([]byte, 65)
+		sig.R.FillBytes(rsv[0:32])
+		sig.S.FillBytes(rsv[32:64])
+		rsv[64] = byte(sig.V.Int64())
+		if tw.badSignature {
+			rsv = rsv[0:64]
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(ethtypes.HexBytes0xPrefix(rsv).String()))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// addKey adds a key identified by its 64 byte public key, as Web3Signer lists them
+func (tw *testWeb3Signer) addKey(t *testing.T) *secp256k1.KeyPair {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	keypair, err := secp256k1.GenerateSecp256k1KeyPair()
+	assert.NoError(t, err)
+	publicKey := ethtypes.HexBytes0xPrefix(keypair.PublicKey.SerializeUncompressed()[1:]).String()
+	tw.keys[publicKey] = keypair
+	tw.order = append(tw.order, publicKey)
+	return keypair
+}
+
+func (tw *testWeb3Signer) removeKey(keypair *secp256k1.KeyPair) {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	publicKey := ethtypes.HexBytes0xPrefix(keypair.PublicKey.SerializeUncompressed()[1:]).String()
+	delete(tw.keys, publicKey)
+	for i, pk := range tw.order {
+		if pk == publicKey {
+			tw.order = append(tw.order[:i], tw.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func newTestWeb3SignerWallet(t *testing.T) (context.Context, *web3SignerWallet, *testWeb3Signer, func()) {
+	tw := &testWeb3Signer{
+		keys: make(map[string]*secp256k1.KeyPair),
+	}
+	server := httptest.NewServer(tw)
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_web3signer_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set(ffresty.HTTPConfigURL, server.URL)
+	unitTestConfig.Set(ffresty.HTTPConfigRetryEnabled, false)
+	ctx := context.Background()
+
+	conf, err := ReadConfig(ctx, unitTestConfig)
+	assert.NoError(t, err)
+	w, err := NewWeb3SignerWallet(ctx, conf)
+	assert.NoError(t, err)
+
+	return ctx, w.(*web3SignerWallet), tw, func() {
+		w.Close()
+		server.Close()
+	}
+}
+
+func TestWeb3SignerWalletSignOK(t *testing.T) {
+
+	ctx, w, tw, done := newTestWeb3SignerWallet(t)
+	defer done()
+
+	key1 := tw.addKey(t)
+	key2 := tw.addKey(t)
+
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&key1.Address, &key2.Address}, accounts)
+
+	for _, highS := range []bool{false, true} {
+		tw.highS = highS
+		txn := &ethsigner.Transaction{
+			From:                 json.RawMessage(fmt.Sprintf(`"%s"`, key2.Address)),
+			Nonce:                ethtypes.NewHexInteger64(1),
+			MaxFeePerGas:         ethtypes.NewHexInteger64(2000000000),
+			MaxPriorityFeePerGas: ethtypes.NewHexInteger64(1000000000),
+		}
+		signed, err := w.Sign(ctx, txn, 2022)
+		assert.NoError(t, err)
+		addr, _, err := ethsigner.RecoverRawTransaction(ctx, signed, 2022)
+		assert.NoError(t, err)
+		assert.Equal(t, key2.Address, *addr)
+	}
+
+	// Typed data is signed by sending the message for Web3Signer to hash
+	payload := &eip712.TypedData{PrimaryType: eip712.EIP712Domain}
+	result, err := w.SignTypedDataV4(ctx, key1.Address, payload)
+	assert.NoError(t, err)
+	hash, err := eip712.EncodeTypedDataV4(ctx, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, result.Hash)
+	sig, err := secp256k1.DecodeCompactRSV(ctx, result.SignatureRSV)
+	assert.NoError(t, err)
+	assert.True(t, sig.S.Cmp(new(big.Int).Rsh(btcec.S256().N, 1)) <= 0)
+	addr, err := sig.RecoverDirect(result.Hash, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, key1.Address, *addr)
+
+}
+
+func TestWeb3SignerWalletKeysChanged(t *testing.T) {
+
+	ctx, w, tw, done := newTestWeb3SignerWallet(t)
+	defer done()
+
+	key1 := tw.addKey(t)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	// A key added since the last refresh is found when it is first used
+	key2 := tw.addKey(t)
+	_, err = w.SignTypedDataV4(ctx, key2.Address, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.NoError(t, err)
+
+	// A key removed from Web3Signer is removed from the accounts
+	tw.removeKey(key1)
+	err = w.Refresh(ctx)
+	assert.NoError(t, err)
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&key2.Address}, accounts)
+
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestWeb3SignerWalletDuplicateKey(t *testing.T) {
+
+	ctx, w, tw, done := newTestWeb3SignerWallet(t)
+	defer done()
+
+	key1 := tw.addKey(t)
+	tw.order = append(tw.order, ethtypes.HexBytes0xPrefix(key1.PublicKey.SerializeCompressed()).String())
+	err := w.Refresh(ctx)
+	assert.NoError(t, err)
+	accounts, err := w.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ethtypes.Address0xHex{&key1.Address}, accounts)
+
+}
+
+func TestWeb3SignerWalletRequestFailures(t *testing.T) {
+
+	ctx, w, tw, done := newTestWeb3SignerWallet(t)
+	defer done()
+
+	tw.status = http.StatusInternalServerError
+	err := w.Refresh(ctx)
+	assert.Regexp(t, "FF22179.*pop", err)
+
+	_, err = w.SignTypedDataV4(ctx, *ethtypes.MustNewAddress(`0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF`), &eip712.TypedData{
+		PrimaryType: eip712.EIP712Domain,
+	})
+	assert.Regexp(t, "FF22179.*pop", err)
+
+}
+
+func TestWeb3SignerWalletHealthCheck(t *testing.T) {
+
+	ctx, w, tw, done := newTestWeb3SignerWallet(t)
+	defer done()
+
+	assert.NoError(t, w.HealthCheck(ctx))
+
+	tw.status = http.StatusServiceUnavailable
+	assert.Regexp(t, "FF22179.*pop", w.HealthCheck(ctx))
+
+}
+
+func TestWeb3SignerWalletBadPublicKey(t *testing.T) {
+
+	ctx, w, tw, done := newTestWeb3SignerWallet(t)
+	defer done()
+
+	tw.order = []string{"0x1234"}
+	err := w.Refresh(ctx)
+	assert.Regexp(t, "FF22180", err)
+
+	tw.order = []string{"not hex"}
+	err = w.Refresh(ctx)
+	assert.Regexp(t, "FF22180", err)
+
+}
+
+func TestWeb3SignerWalletSignFailures(t *testing.T) {
+
+	ctx, w, tw, done := newTestWeb3SignerWallet(t)
+	defer done()
+
+	key1 := tw.addKey(t)
+	err := w.Initialize(ctx)
+	assert.NoError(t, err)
+
+	tw.badSignature = true
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22181", err)
+
+	// A signature from a different key does not recover to the address
+	tw.badSignature = false
+	for pk := range tw.keys {
+		tw.keys[pk], _ = secp256k1.GenerateSecp256k1KeyPair()
+	}
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22181", err)
+
+	tw.status = http.StatusForbidden
+	_, err = w.SignTypedDataV4(ctx, key1.Address, &eip712.TypedData{PrimaryType: eip712.EIP712Domain})
+	assert.Regexp(t, "FF22179", err)
+
+}
+
+func TestWeb3SignerWalletBadFrom(t *testing.T) {
+
+	ctx, w, _, done := newTestWeb3SignerWallet(t)
+	defer done()
+
+	_, err := w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"bad"`)}, 1)
+	assert.Regexp(t, "bad address", err)
+
+	_, err = w.Sign(ctx, &ethsigner.Transaction{From: json.RawMessage(`"0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"`)}, 1)
+	assert.Regexp(t, "FF22014", err)
+
+}
+
+func TestWeb3SignerWalletBadConfig(t *testing.T) {
+
+	config.RootConfigReset()
+	unitTestConfig := config.RootSection("ut_web3signer_config")
+	InitConfig(unitTestConfig)
+	unitTestConfig.Set("tls.enabled", true)
+	unitTestConfig.Set("tls.caFile", "!!!")
+	_, err := ReadConfig(context.Background(), unitTestConfig)
+	assert.Error(t, err)
+
+}